@@ -42,6 +42,8 @@ const (
 	ERR_CREATE_STREAM       = 17
 	ERR_INVALID_PARAM       = 18
 	ERR_CRC_CHECK           = 19
+	ERR_MEMORY_LIMIT        = 20
+	ERR_OUTPUT_LIMIT        = 21
 	ERR_UNKNOWN             = 127
 )
 
@@ -21,16 +21,20 @@ import (
 )
 
 const (
-	EVT_COMPRESSION_START     = 0 // Compression starts
-	EVT_DECOMPRESSION_START   = 1 // Decompression starts
-	EVT_BEFORE_TRANSFORM      = 2 // Transform forward/inverse starts
-	EVT_AFTER_TRANSFORM       = 3 // Transform forward/inverse ends
-	EVT_BEFORE_ENTROPY        = 4 // Entropy encoding/decoding starts
-	EVT_AFTER_ENTROPY         = 5 // Entropy encoding/decoding ends
-	EVT_COMPRESSION_END       = 6 // Compression ends
-	EVT_DECOMPRESSION_END     = 7 // Decompression ends
-	EVT_AFTER_HEADER_DECODING = 8 // Compression header decoding ends
-	EVT_BLOCK_INFO            = 9 // Display block information
+	EVT_COMPRESSION_START      = 0  // Compression starts
+	EVT_DECOMPRESSION_START    = 1  // Decompression starts
+	EVT_BEFORE_TRANSFORM       = 2  // Transform forward/inverse starts
+	EVT_AFTER_TRANSFORM        = 3  // Transform forward/inverse ends
+	EVT_BEFORE_ENTROPY         = 4  // Entropy encoding/decoding starts
+	EVT_AFTER_ENTROPY          = 5  // Entropy encoding/decoding ends
+	EVT_COMPRESSION_END        = 6  // Compression ends
+	EVT_DECOMPRESSION_END      = 7  // Decompression ends
+	EVT_AFTER_HEADER_DECODING  = 8  // Compression header decoding ends
+	EVT_BLOCK_INFO             = 9  // Display block information
+	EVT_TRANSFORM_FAILURE      = 10 // Block transform failed, block emitted untransformed
+	EVT_BUFFER_REALLOC         = 11 // Block buffer grown beyond its initial allocation
+	EVT_COMPRESSION_PROGRESS   = 12 // Block written to the compressed stream
+	EVT_DECOMPRESSION_PROGRESS = 13 // Block decoded from the compressed stream
 
 	EVT_HASH_NONE   = 0
 	EVT_HASH_32BITS = 32
@@ -46,6 +50,30 @@ type Event struct {
 	hashType  int
 	eventTime time.Time
 	msg       string
+	progress  *Progress
+	fields    []Field
+}
+
+// Field a typed attribute of a structured event
+type Field struct {
+	Key   string
+	Value any // int, int64, uint, uint64, bool, string or error
+}
+
+// EventV2 the structured form of an event (see ListenerV2): the attributes
+// formatted in the message of an Event are provided as typed fields.
+type EventV2 struct {
+	Type   int
+	ID     int // block ID, -1 or 0 if the event is not related to a block
+	Time   time.Time
+	Fields []Field
+}
+
+// Progress cumulative byte counters of a progress event
+type Progress struct {
+	InputBytes  int64 // bytes consumed so far (uncompressed when compressing)
+	OutputBytes int64 // bytes produced so far (uncompressed when decompressing)
+	TotalBytes  int64 // expected total of uncompressed bytes, 0 if unknown
 }
 
 // NewEventFromString creates a new Event instance that wraps a message
@@ -57,6 +85,14 @@ func NewEventFromString(evtType, id int, msg string, evtTime time.Time) *Event {
 	return &Event{eventType: evtType, id: id, size: 0, msg: msg, eventTime: evtTime}
 }
 
+// NewEventWithFields creates a new Event instance that wraps a message and
+// the typed fields it was formatted from (see EventV2)
+func NewEventWithFields(evtType, id int, msg string, fields []Field, evtTime time.Time) *Event {
+	evt := NewEventFromString(evtType, id, msg, evtTime)
+	evt.fields = fields
+	return evt
+}
+
 // NewEvent creates a new Event instance with size and hash info
 // Returns nil if the hashType is not in { EVT_HASH_NONE, EVT_HASH_32BITS, EVT_HASH_64BITS }
 func NewEvent(evtType, id int, size int64, hash uint64, hashType int, evtTime time.Time) *Event {
@@ -72,6 +108,17 @@ func NewEvent(evtType, id int, size int64, hash uint64, hashType int, evtTime ti
 		hashType: hashType, eventTime: evtTime}
 }
 
+// NewProgressEvent creates a new progress Event instance (EVT_COMPRESSION_PROGRESS
+// or EVT_DECOMPRESSION_PROGRESS) with cumulative byte counters
+func NewProgressEvent(evtType, id int, progress Progress, evtTime time.Time) *Event {
+	if evtTime.IsZero() {
+		evtTime = time.Now()
+	}
+
+	return &Event{eventType: evtType, id: id, size: progress.InputBytes, progress: &progress,
+		eventTime: evtTime}
+}
+
 // Type returns the type info
 func (this *Event) Type() int {
 	return this.eventType
@@ -102,6 +149,32 @@ func (this *Event) HashType() int {
 	return this.hashType
 }
 
+// Progress returns the byte counters of a progress event and true, or false
+// for other events
+func (this *Event) Progress() (Progress, bool) {
+	if this.progress == nil {
+		return Progress{}, false
+	}
+
+	return *this.progress, true
+}
+
+// Percent returns the percentage of the uncompressed data processed and true
+// if the total is known
+func (this *Event) Percent() (float64, bool) {
+	if this.progress == nil || this.progress.TotalBytes <= 0 {
+		return 0, false
+	}
+
+	done := this.progress.InputBytes
+
+	if this.eventType == EVT_DECOMPRESSION_PROGRESS {
+		done = this.progress.OutputBytes
+	}
+
+	return 100 * float64(done) / float64(this.progress.TotalBytes), true
+}
+
 // String returns a string representation of this event.
 // If the event wraps a message, the the message is returned.
 // Owtherwise a string is built from the fields.
@@ -111,7 +184,6 @@ func (this *Event) String() string {
 	}
 
 	hash := ""
-	t := ""
 	id := ""
 
 	if this.hashType != EVT_HASH_NONE {
@@ -122,37 +194,92 @@ func (this *Event) String() string {
 		id = fmt.Sprintf(", \"id\":%d", this.id)
 	}
 
-	switch this.eventType {
+	t := EventName(this.eventType)
+
+	if this.progress != nil {
+		return fmt.Sprintf("{ \"type\":\"%s\"%s, \"input\":%d, \"output\":%d, \"total\":%d, \"time\":%d }", t, id,
+			this.progress.InputBytes, this.progress.OutputBytes, this.progress.TotalBytes,
+			this.eventTime.UnixNano()/1000000)
+	}
+
+	return fmt.Sprintf("{ \"type\":\"%s\"%s, \"size\":%d, \"time\":%d%s }", t, id, this.size,
+		this.eventTime.UnixNano()/1000000, hash)
+}
+
+// V2 returns the structured form of the event
+func (this *Event) V2() EventV2 {
+	res := EventV2{Type: this.eventType, ID: this.id, Time: this.eventTime}
+
+	if this.fields != nil {
+		res.Fields = this.fields
+	} else if this.progress != nil {
+		res.Fields = []Field{{"input", this.progress.InputBytes}, {"output", this.progress.OutputBytes},
+			{"total", this.progress.TotalBytes}}
+	} else if len(this.msg) > 0 {
+		res.Fields = []Field{{"msg", this.msg}}
+	} else {
+		res.Fields = []Field{{"size", this.size}}
+
+		if this.hashType != EVT_HASH_NONE {
+			res.Fields = append(res.Fields, Field{"hash", this.hash}, Field{"hashBits", this.hashType})
+		}
+	}
+
+	return res
+}
+
+// Name returns the name of the event type, EG. "COMPRESSION_START"
+func (this EventV2) Name() string {
+	return EventName(this.Type)
+}
+
+// EventName returns the name of an event type, EG. "COMPRESSION_START"
+func EventName(evtType int) string {
+	switch evtType {
 	case EVT_BEFORE_TRANSFORM:
-		t = "BEFORE_TRANSFORM"
+		return "BEFORE_TRANSFORM"
 
 	case EVT_AFTER_TRANSFORM:
-		t = "AFTER_TRANSFORM"
+		return "AFTER_TRANSFORM"
 
 	case EVT_BEFORE_ENTROPY:
-		t = "BEFORE_ENTROPY"
+		return "BEFORE_ENTROPY"
 
 	case EVT_AFTER_ENTROPY:
-		t = "AFTER_ENTROPY"
+		return "AFTER_ENTROPY"
 
 	case EVT_COMPRESSION_START:
-		t = "COMPRESSION_START"
+		return "COMPRESSION_START"
 
 	case EVT_DECOMPRESSION_START:
-		t = "DECOMPRESSION_START"
+		return "DECOMPRESSION_START"
 
 	case EVT_COMPRESSION_END:
-		t = "COMPRESSION_END"
+		return "COMPRESSION_END"
 
 	case EVT_DECOMPRESSION_END:
-		t = "DECOMPRESSION_END"
+		return "DECOMPRESSION_END"
+
+	case EVT_AFTER_HEADER_DECODING:
+		return "AFTER_HEADER_DECODING"
 
 	case EVT_BLOCK_INFO:
-		t = "BLOCK_INFO"
+		return "BLOCK_INFO"
+
+	case EVT_TRANSFORM_FAILURE:
+		return "TRANSFORM_FAILURE"
+
+	case EVT_BUFFER_REALLOC:
+		return "BUFFER_REALLOC"
+
+	case EVT_COMPRESSION_PROGRESS:
+		return "COMPRESSION_PROGRESS"
+
+	case EVT_DECOMPRESSION_PROGRESS:
+		return "DECOMPRESSION_PROGRESS"
 	}
 
-	return fmt.Sprintf("{ \"type\":\"%s\"%s, \"size\":%d, \"time\":%d%s }", t, id, this.size,
-		this.eventTime.UnixNano()/1000000, hash)
+	return ""
 }
 
 // Listener is an interface implemented by event processors
@@ -160,3 +287,13 @@ type Listener interface {
 	// ProcessEvent is the method called whenever a Listener receives an event.
 	ProcessEvent(evt *Event)
 }
+
+// ListenerV2 is implemented by the listeners receiving structured events.
+// The compressed streams call ProcessEventV2 instead of ProcessEvent for
+// the listeners implementing it.
+type ListenerV2 interface {
+	Listener
+
+	// ProcessEventV2 is the method called whenever a ListenerV2 receives an event.
+	ProcessEventV2(evt EventV2)
+}
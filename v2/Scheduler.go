@@ -0,0 +1,76 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kanzi
+
+import (
+	"errors"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Schedule describes how to spread jobs over concurrent tasks, each task
+// processing one block (see PlanJobs).
+type Schedule struct {
+	Tasks       int    // number of blocks processed concurrently
+	JobsPerTask []uint // number of jobs (EG. ctx["jobs"] of the codecs) of each task
+	Batches     int    // number of rounds of Tasks blocks (0 if the number of blocks is unknown)
+}
+
+// ComputeJobsPerTask computes the number of jobs associated with each task
+// given a number of jobs available and a number of tasks to perform.
+// The provided 'jobsPerTask' slice is returned as result.
+func ComputeJobsPerTask(jobsPerTask []uint, jobs, tasks uint) ([]uint, error) {
+	return internal.ComputeJobsPerTask(jobsPerTask, jobs, tasks)
+}
+
+// PlanJobs returns the schedule used by the Writer and the Reader to process
+// 'blocks' blocks (0 if unknown) with 'jobs' jobs: as many blocks as jobs are
+// processed concurrently and the jobs left (fewer blocks than jobs) are
+// assigned to the tasks. If memoryBudget is not 0, the number of concurrent
+// tasks is limited so that tasks*memoryPerTask fits in the budget (at least
+// one task).
+func PlanJobs(blocks int, jobs uint, memoryPerTask, memoryBudget int64) (Schedule, error) {
+	if blocks < 0 {
+		return Schedule{}, errors.New("Invalid number of blocks provided: negative")
+	}
+
+	if jobs == 0 {
+		return Schedule{}, errors.New("Invalid number of jobs provided: 0")
+	}
+
+	if memoryPerTask < 0 || memoryBudget < 0 {
+		return Schedule{}, errors.New("Invalid memory parameters provided: negative")
+	}
+
+	tasks := int(jobs)
+
+	if blocks > 0 {
+		tasks = min(tasks, blocks)
+	}
+
+	if memoryBudget > 0 && memoryPerTask > 0 {
+		tasks = int(min(int64(tasks), max(memoryBudget/memoryPerTask, 1)))
+	}
+
+	res := Schedule{Tasks: tasks}
+	res.JobsPerTask, _ = internal.ComputeJobsPerTask(make([]uint, tasks), jobs, uint(tasks))
+
+	if blocks > 0 {
+		res.Batches = (blocks + tasks - 1) / tasks
+	}
+
+	return res, nil
+}
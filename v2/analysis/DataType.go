@@ -0,0 +1,132 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"fmt"
+)
+
+// DataType captures the type of input data
+type DataType int
+
+const (
+	DT_UNDEFINED      DataType = 0
+	DT_TEXT           DataType = 1
+	DT_MULTIMEDIA     DataType = 2
+	DT_EXE            DataType = 3
+	DT_NUMERIC        DataType = 4
+	DT_BASE64         DataType = 5
+	DT_DNA            DataType = 6
+	DT_BIN            DataType = 7
+	DT_UTF8           DataType = 8
+	DT_SMALL_ALPHABET DataType = 9
+	DT_UTF16          DataType = 10
+)
+
+var (
+	_DATA_TYPE_NAMES = [...]string{"UNDEFINED", "TEXT", "MULTIMEDIA", "EXE", "NUMERIC",
+		"BASE64", "DNA", "BIN", "UTF8", "SMALL_ALPHABET", "UTF16"}
+
+	_BASE64_SYMBOLS  = []byte(`ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/`)
+	_NUMERIC_SYMBOLS = []byte(`0123456789+-*/=,.:; `)
+	_DNA_SYMBOLS     = []byte(`acgntuACGNTU"`) // either T or U and N for unknown
+)
+
+// String returns the name of the data type (EG. "TEXT")
+func (this DataType) String() string {
+	if this >= 0 && int(this) < len(_DATA_TYPE_NAMES) {
+		return _DATA_TYPE_NAMES[this]
+	}
+
+	return fmt.Sprintf("TYPE_%d", int(this))
+}
+
+// DetectSimpleType returns the data type of count symbols from their
+// frequencies (DNA, NUMERIC, BASE64, BIN, SMALL_ALPHABET or UNDEFINED)
+func DetectSimpleType(count int, freqs0 []int) DataType {
+	if count == 0 {
+		return DT_UNDEFINED
+	}
+
+	sum := 0
+
+	for i := 0; i < 12; i++ {
+		sum += freqs0[_DNA_SYMBOLS[i]]
+	}
+
+	if sum > count-count/12 {
+		return DT_DNA
+	}
+
+	sum = 0
+
+	for i := 0; i < 20; i++ {
+		sum += freqs0[_NUMERIC_SYMBOLS[i]]
+	}
+
+	if sum == count {
+		return DT_NUMERIC
+	}
+
+	sum = 0
+
+	for i := 0; i < 64; i++ {
+		sum += freqs0[_BASE64_SYMBOLS[i]]
+	}
+
+	if sum+freqs0[0x3D] == count {
+		return DT_BASE64
+	}
+
+	sum = 0
+
+	for i := 0; i < 256; i += 8 {
+		if freqs0[i] > 0 {
+			sum++
+		}
+		if freqs0[i+1] > 0 {
+			sum++
+		}
+		if freqs0[i+2] > 0 {
+			sum++
+		}
+		if freqs0[i+3] > 0 {
+			sum++
+		}
+		if freqs0[i+4] > 0 {
+			sum++
+		}
+		if freqs0[i+5] > 0 {
+			sum++
+		}
+		if freqs0[i+6] > 0 {
+			sum++
+		}
+		if freqs0[i+7] > 0 {
+			sum++
+		}
+	}
+
+	if sum == 256 {
+		return DT_BIN
+	}
+
+	if sum <= 4 {
+		return DT_SMALL_ALPHABET
+	}
+
+	return DT_UNDEFINED
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package analysis provides the classification of the data used by the
+// compressor (magic numbers, symbol statistics, text and UTF-8 checks) to
+// the applications that need it without compressing the data.
+package analysis
+
+import (
+	"fmt"
+)
+
+// Confidence the reliability of a data type returned by Detect
+type Confidence int
+
+const (
+	CONFIDENCE_NONE   Confidence = 0 // empty block
+	CONFIDENCE_LOW    Confidence = 1 // few symbols or no specific type detected
+	CONFIDENCE_MEDIUM Confidence = 2 // statistical detection
+	CONFIDENCE_HIGH   Confidence = 3 // magic number or exact symbol set
+)
+
+const (
+	_DETECT_MIN_BLOCK_SIZE = 64 // below, the statistics are not reliable
+)
+
+var _CONFIDENCE_NAMES = [...]string{"NONE", "LOW", "MEDIUM", "HIGH"}
+
+// String returns the name of the confidence (EG. "HIGH")
+func (this Confidence) String() string {
+	if this >= 0 && int(this) < len(_CONFIDENCE_NAMES) {
+		return _CONFIDENCE_NAMES[this]
+	}
+
+	return fmt.Sprintf("CONFIDENCE_%d", int(this))
+}
+
+// Detect returns the data type of the block and the confidence of the
+// detection: from the magic number (MULTIMEDIA, EXE or BIN for compressed
+// data), the symbol statistics (see DetectSimpleType) or the proportion of
+// text characters (TEXT, or UTF8 for valid UTF-8 text with enough
+// non ASCII symbols). UNDEFINED if no type is detected.
+func Detect(block []byte) (DataType, Confidence) {
+	if len(block) == 0 {
+		return DT_UNDEFINED, CONFIDENCE_NONE
+	}
+
+	if len(block) >= 8 {
+		magic := GetMagicType(block)
+
+		if IsDataMultimedia(magic) == true {
+			return DT_MULTIMEDIA, CONFIDENCE_HIGH
+		}
+
+		if IsDataExecutable(magic) == true {
+			return DT_EXE, CONFIDENCE_HIGH
+		}
+
+		if IsDataCompressed(magic) == true {
+			return DT_BIN, CONFIDENCE_HIGH
+		}
+	}
+
+	var histo [256]int
+
+	for _, b := range block {
+		histo[b]++
+	}
+
+	confidence := CONFIDENCE_MEDIUM
+
+	if len(block) < _DETECT_MIN_BLOCK_SIZE {
+		confidence = CONFIDENCE_LOW
+	}
+
+	if dt := DetectSimpleType(len(block), histo[:]); dt != DT_UNDEFINED {
+		// All the symbols in the alphabet of the type
+		if confidence == CONFIDENCE_MEDIUM && (dt == DT_NUMERIC || dt == DT_BASE64 || dt == DT_SMALL_ALPHABET) {
+			confidence = CONFIDENCE_HIGH
+		}
+
+		return dt, confidence
+	}
+
+	// Printable ASCII, whitespaces and UTF-8 bytes
+	text := histo[0x09] + histo[0x0A] + histo[0x0D]
+
+	for i := 0x20; i < 0x7F; i++ {
+		text += histo[i]
+	}
+
+	nonASCII := 0
+
+	for i := 0x80; i < 0x100; i++ {
+		nonASCII += histo[i]
+	}
+
+	if text+nonASCII < len(block)-len(block)>>5 {
+		return DT_UNDEFINED, CONFIDENCE_LOW
+	}
+
+	if nonASCII > 0 && IsUTF8(block) == true {
+		return DT_UTF8, confidence
+	}
+
+	if confidence == CONFIDENCE_MEDIUM && text == len(block) {
+		confidence = CONFIDENCE_HIGH
+	}
+
+	return DT_TEXT, confidence
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDetect(b *testing.T) {
+	fmt.Println("Detect Test")
+	r := rand.New(rand.NewSource(12345))
+	random := make([]byte, 65536)
+	r.Read(random)
+	png := append([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}, random[0:1000]...)
+	elf := append([]byte{0x7F, 0x45, 0x4C, 0x46, 0x02, 0x01, 0x01, 0x00}, random[0:1000]...)
+	gzip := append([]byte{0x1F, 0x8B, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00}, random[0:1000]...)
+	dna := make([]byte, 10000)
+
+	for i := range dna {
+		dna[i] = "ACGT"[r.Intn(4)]
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		dataType   DataType
+		confidence Confidence
+	}{
+		{"empty", nil, DT_UNDEFINED, CONFIDENCE_NONE},
+		{"png", png, DT_MULTIMEDIA, CONFIDENCE_HIGH},
+		{"elf", elf, DT_EXE, CONFIDENCE_HIGH},
+		{"gzip", gzip, DT_BIN, CONFIDENCE_HIGH},
+		{"random", random, DT_BIN, CONFIDENCE_MEDIUM},
+		{"dna", dna, DT_DNA, CONFIDENCE_MEDIUM},
+		{"numeric", []byte(strings.Repeat("3.14159, 2.71828; 1.41421 ", 100)), DT_NUMERIC, CONFIDENCE_HIGH},
+		{"base64", []byte(strings.Repeat("SGVsbG8gV29ybGQh", 100) + "=="), DT_BASE64, CONFIDENCE_HIGH},
+		{"small alphabet", bytes.Repeat([]byte{0, 1, 0, 2, 3}, 1000), DT_SMALL_ALPHABET, CONFIDENCE_HIGH},
+		{"text", []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 100)), DT_TEXT, CONFIDENCE_HIGH},
+		{"latin", []byte(strings.Repeat("Voil\xe0 l'\xe9t\xe9, un caf\xe9 cr\xe8me.\n", 100)), DT_TEXT, CONFIDENCE_MEDIUM},
+		{"utf8", []byte(strings.Repeat("Съешь же ещё этих мягких французских булок. ", 100)), DT_UTF8, CONFIDENCE_MEDIUM},
+		{"short text", []byte("Hello, World!"), DT_TEXT, CONFIDENCE_LOW},
+		{"binary", bytes.Repeat([]byte{0, 0, 0, 1, 0x20, 0x41, 0xFF, 0x80, 0x10, 0x11}, 1000), DT_UNDEFINED, CONFIDENCE_LOW},
+	}
+
+	for _, test := range tests {
+		dt, c := Detect(test.data)
+		fmt.Printf("%-15s %-15v %v\n", test.name, dt, c)
+
+		if dt != test.dataType || c != test.confidence {
+			b.Errorf("%s: got %v (%v), expected %v (%v)", test.name, dt, c, test.dataType, test.confidence)
+		}
+	}
+
+	if DT_UTF16.String() != "UTF16" || DataType(42).String() != "TYPE_42" {
+		b.Errorf("Invalid data type names: %v, %v", DT_UTF16, DataType(42))
+	}
+
+	// Invalid UTF-8 sequences
+	for _, data := range [][]byte{{0xC0, 0x80}, {0xE0, 0x80, 0x80}, {0xF5, 0x80, 0x80, 0x80}, {0xC3, 0x28}} {
+		if IsUTF8(bytes.Repeat(data, 100)) == true {
+			b.Errorf("Invalid UTF-8 accepted: %x", data)
+		}
+	}
+}
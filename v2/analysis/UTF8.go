@@ -0,0 +1,149 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package analysis
+
+// IsUTF8 returns true if the block looks like UTF-8 text: no invalid byte
+// nor invalid pair of bytes, and at least 1/8 of continuation bytes.
+// A quick partial validation (the rules for 3 and 4 byte sequences are not
+// fully checked), faster than utf8.Valid([]byte), especially at rejecting
+// a block.
+func IsUTF8(block []byte) bool {
+	var freqs0 [256]int
+	var freqs1 [256][256]int
+	count := len(block)
+	end4 := count & -4
+	prv := byte(0)
+
+	// Unroll loop
+	for i := 0; i < end4; i += 4 {
+		cur0 := block[i]
+		cur1 := block[i+1]
+		cur2 := block[i+2]
+		cur3 := block[i+3]
+		freqs0[cur0]++
+		freqs0[cur1]++
+		freqs0[cur2]++
+		freqs0[cur3]++
+		freqs1[prv][cur0]++
+		freqs1[cur0][cur1]++
+		freqs1[cur1][cur2]++
+		freqs1[cur2][cur3]++
+		prv = cur3
+
+		if i&0x0FFF == 0 {
+			// Early check rules for 1 byte
+			sum := freqs0[0xC0] + freqs0[0xC1]
+
+			for _, f := range freqs0[0xF5:] {
+				sum += f
+			}
+
+			if sum != 0 {
+				return false
+			}
+		}
+	}
+
+	if end4 != count {
+		for i := end4; i < count; i++ {
+			cur := block[i]
+			freqs0[cur]++
+			freqs1[prv][cur]++
+			prv = cur
+		}
+
+		// Check rules for 1 byte
+		sum := freqs0[0xC0] + freqs0[0xC1]
+
+		for _, f := range freqs0[0xF5:] {
+			sum += f
+		}
+
+		if sum != 0 {
+			return false
+		}
+	}
+
+	// Valid UTF-8 sequences
+	// See Unicode 16 Standard - UTF-8 Table 3.7
+	// U+0000..U+007F          00..7F
+	// U+0080..U+07FF          C2..DF 80..BF
+	// U+0800..U+0FFF          E0 A0..BF 80..BF
+	// U+1000..U+CFFF          E1..EC 80..BF 80..BF
+	// U+D000..U+D7FF          ED 80..9F 80..BF 80..BF
+	// U+E000..U+FFFF          EE..EF 80..BF 80..BF
+	// U+10000..U+3FFFF        F0 90..BF 80..BF 80..BF
+	// U+40000..U+FFFFF        F1..F3 80..BF 80..BF 80..BF
+	// U+100000..U+10FFFF      F4 80..8F 80..BF 80..BF
+	sum := 0
+	sum2 := 0
+
+	// Check rules for first 2 bytes
+	for i := 0; i < 256; i++ {
+		// Exclude < 0xE0A0 || > 0xE0BF
+		if i < 0xA0 || i > 0xBF {
+			sum += freqs1[0xE0][i]
+		}
+
+		// Exclude < 0xED80 || > 0xEDE9F
+		if i < 0x80 || i > 0x9F {
+			sum += freqs1[0xED][i]
+		}
+
+		// Exclude < 0xF090 || > 0xF0BF
+		if i < 0x90 || i > 0xBF {
+			sum += freqs1[0xF0][i]
+		}
+
+		// Exclude < 0xF480 || > 0xF48F
+		if i < 0x80 || i > 0x8F {
+			sum += freqs1[0xF4][i]
+		}
+
+		if i < 0x80 || i > 0xBF {
+			// Exclude < 0x??80 || > 0x??BF with ?? in [C2..DF]
+			for j := 0xC2; j <= 0xDF; j++ {
+				sum += freqs1[j][i]
+			}
+
+			// Exclude < 0x??80 || > 0x??BF with ?? in [E1..EC]
+			for j := 0xE1; j <= 0xEC; j++ {
+				sum += freqs1[j][i]
+			}
+
+			// Exclude < 0x??80 || > 0x??BF with ?? in [F1..F3]
+			sum += freqs1[0xF1][i]
+			sum += freqs1[0xF2][i]
+			sum += freqs1[0xF3][i]
+
+			// Exclude < 0xEE80 || > 0xEEBF
+			sum += freqs1[0xEE][i]
+
+			// Exclude < 0xEF80 || > 0xEFBF
+			sum += freqs1[0xEF][i]
+		} else {
+			// Count non-primary bytes
+			sum2 += freqs0[i]
+		}
+
+		if sum != 0 {
+			return false
+		}
+	}
+
+	// Ad-hoc threshold
+	return sum2 >= (count / 8)
+}
@@ -39,6 +39,7 @@ const (
 	_COMP_MIN_BLOCK_SIZE      = 1024
 	_COMP_MAX_BLOCK_SIZE      = 1024 * 1024 * 1024
 	_COMP_MAX_CONCURRENCY     = 64
+	_COMP_DETERMINISTIC_JOBS  = 8 // jobs assumed by the auto block size in deterministic mode
 	_COMP_NONE                = "NONE"
 	_COMP_STDIN               = "STDIN"
 	_COMP_STDOUT              = "STDOUT"
@@ -55,12 +56,16 @@ type BlockCompressor struct {
 	noDotFiles    bool
 	noLinks       bool
 	autoBlockSize bool
+	autoTune      bool
+	deterministic bool
+	rsyncable     bool
 	inputName     string
 	outputName    string
 	entropyCodec  string
 	transform     string
 	blockSize     uint
 	jobs          uint
+	lzLevel       uint
 	listeners     []kanzi.Listener
 	cpuProf       string
 }
@@ -87,6 +92,7 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 		}
 
 		delete(argsMap, "level")
+		this.lzLevel = getLZLevel(level)
 		tranformAndCodec := getTransformAndCodec(level)
 		tokens := strings.Split(tranformAndCodec, "&")
 		this.transform = tokens[0]
@@ -97,6 +103,7 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 
 		if prstC == false && prstF == false {
 			// Default to level 3
+			this.lzLevel = getLZLevel(3)
 			tranformAndCodec := getTransformAndCodec(3)
 			tokens := strings.Split(tranformAndCodec, "&")
 			this.transform = tokens[0]
@@ -152,6 +159,27 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 		this.autoBlockSize = false
 	}
 
+	if auto, prst := argsMap["autoTune"]; prst == true {
+		this.autoTune = auto.(bool)
+		delete(argsMap, "autoTune")
+	} else {
+		this.autoTune = false
+	}
+
+	if det, prst := argsMap["deterministic"]; prst == true {
+		this.deterministic = det.(bool)
+		delete(argsMap, "deterministic")
+	} else {
+		this.deterministic = false
+	}
+
+	if rs, prst := argsMap["rsyncable"]; prst == true {
+		this.rsyncable = rs.(bool)
+		delete(argsMap, "rsyncable")
+	} else {
+		this.rsyncable = false
+	}
+
 	this.inputName = argsMap["inputName"].(string)
 	delete(argsMap, "inputName")
 
@@ -302,6 +330,16 @@ func (this *BlockCompressor) CPUProf() string {
 	return this.cpuProf
 }
 
+// autoBlockJobs returns the number of jobs used to compute the block size
+// in 'auto' mode (independent of the number of cores in deterministic mode)
+func (this *BlockCompressor) autoBlockJobs() uint {
+	if this.deterministic == true {
+		return _COMP_DETERMINISTIC_JOBS
+	}
+
+	return this.jobs
+}
+
 func fileCompressWorker(tasks <-chan fileCompressTask, cancel <-chan bool, results chan<- fileCompressResult) {
 	// Pull tasks from channel and run them
 	more := true
@@ -499,9 +537,17 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 	ctx["remove"] = this.removeSource
 	ctx["overwrite"] = this.overwrite
 	ctx["skipBlocks"] = this.skipBlocks
+	ctx["autoTune"] = this.autoTune
+	ctx["deterministic"] = this.deterministic
+	ctx["rsyncable"] = this.rsyncable
 	ctx["checksum"] = this.checksum
 	ctx["entropy"] = this.entropyCodec
 	ctx["transform"] = this.transform
+
+	if this.lzLevel != 0 {
+		ctx["lzLevel"] = this.lzLevel
+	}
+
 	var res int
 
 	if nbFiles == 1 {
@@ -517,7 +563,7 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 			ctx["fileSize"] = files[0].Size
 
 			if this.autoBlockSize == true && this.jobs > 0 {
-				bl := files[0].Size / int64(this.jobs)
+				bl := files[0].Size / int64(this.autoBlockJobs())
 				bl = (bl + 63) & ^63
 
 				if bl > _COMP_MAX_BLOCK_SIZE {
@@ -572,7 +618,7 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 			}
 
 			if this.autoBlockSize == true && this.jobs > 0 {
-				bl := f.Size / int64(this.jobs)
+				bl := f.Size / int64(this.autoBlockJobs())
 				bl = (bl + 63) & ^63
 				bl = min(bl, _COMP_MAX_BLOCK_SIZE)
 				bl = max(bl, _COMP_MIN_BLOCK_SIZE)
@@ -699,6 +745,21 @@ func getTransformAndCodec(level int) string {
 	}
 }
 
+// getLZLevel returns the match finder level of the LZ transforms for a
+// compression level (0 for the default, see transform.LZOptions)
+func getLZLevel(level int) uint {
+	switch level {
+	case 1:
+		return 1
+
+	case 3:
+		return 3
+
+	default:
+		return 0
+	}
+}
+
 type fileCompressTask struct {
 	ctx       map[string]any
 	listeners []kanzi.Listener
@@ -47,6 +47,7 @@ type BlockDecompressor struct {
 	removeSource bool
 	noDotFiles   bool
 	noLinks      bool
+	sparse       bool
 	inputName    string
 	outputName   string
 	jobs         uint
@@ -96,6 +97,13 @@ func NewBlockDecompressor(argsMap map[string]any) (*BlockDecompressor, error) {
 		this.noLinks = false
 	}
 
+	if sparse, prst := argsMap["sparse"]; prst == true {
+		this.sparse = sparse.(bool)
+		delete(argsMap, "sparse")
+	} else {
+		this.sparse = false
+	}
+
 	this.inputName = argsMap["inputName"].(string)
 	delete(argsMap, "inputName")
 
@@ -373,6 +381,7 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 	ctx["verbosity"] = this.verbosity
 	ctx["overwrite"] = this.overwrite
 	ctx["remove"] = this.removeSource
+	ctx["sparse"] = this.sparse
 	var res int
 
 	if this.from >= 0 {
@@ -598,6 +607,20 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 	}
 
 	defer output.Close()
+	var sink io.Writer = output
+	var sparse *kio.SparseWriter
+
+	// Leave the pages of zeros as holes in the output file
+	if file, isFile := output.(*os.File); isFile == true && this.ctx["sparse"].(bool) == true {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() == true {
+			if sparse, err = kio.NewSparseWriter(file); err != nil {
+				fmt.Printf("Cannot open output file '%s' for writing: %v\n", outputName, err)
+				return kanzi.ERR_CREATE_FILE, 0, err
+			}
+
+			sink = sparse
+		}
+	}
 
 	// Decode
 	log.Println("\nDecompressing "+inputName+" ...", verbosity > 1)
@@ -662,7 +685,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		}
 
 		if decodedBlock > 0 {
-			_, err := output.Write(buffer[0:decodedBlock])
+			_, err := sink.Write(buffer[0:decodedBlock])
 
 			if err != nil {
 				fmt.Printf("Failed to write decompressed block to file '%s': %v\n", outputName, err)
@@ -677,6 +700,14 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		}
 	}
 
+	// Set the size of the output file (trailing holes)
+	if sparse != nil {
+		if err := sparse.Close(); err != nil {
+			fmt.Printf("Failed to write decompressed block to file '%s': %v\n", outputName, err)
+			return kanzi.ERR_WRITE_FILE, uint64(decoded), err
+		}
+	}
+
 	// Close streams to ensure all data are flushed
 	// Deferred close is fallback for error paths
 	if err := cis.Close(); err != nil {
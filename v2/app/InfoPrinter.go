@@ -193,6 +193,8 @@ func (this *InfoPrinter) ProcessEvent(evt *kanzi.Event) {
 		}
 	} else if evt.Type() == kanzi.EVT_AFTER_HEADER_DECODING && this.level >= 3 {
 		fmt.Fprintln(this.writer, evt)
+	} else if evt.Type() == kanzi.EVT_TRANSFORM_FAILURE && this.level >= 1 {
+		fmt.Fprintln(this.writer, evt)
 	} else if this.level >= 5 {
 		fmt.Fprintln(this.writer, evt)
 	}
@@ -208,6 +208,10 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 	level := -1
 	mode := " "
 	autoBlockSize := false
+	autoTune := false
+	deterministic := false
+	rsyncable := false
+	sparse := false
 	showHelp := false
 	warningNoValOpt := "Warning: ignoring option [%s] with no value."
 	warningCompressOpt := "Warning: ignoring option [%s]. Only applicable in compress mode."
@@ -400,6 +404,54 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 			continue
 		}
 
+		if arg == "--deterministic" {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, arg), verbose > 0)
+				continue
+			}
+
+			deterministic = true
+			continue
+		}
+
+		if arg == "--rsyncable" {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, arg), verbose > 0)
+				continue
+			}
+
+			rsyncable = true
+			continue
+		}
+
+		if arg == "--sparse" {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "d" {
+				log.Println(fmt.Sprintf(warningDecompressOpt, arg), verbose > 0)
+				continue
+			}
+
+			sparse = true
+			continue
+		}
+
 		if arg == "--no-dot-file" {
 			if ctx != -1 {
 				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
@@ -564,12 +616,18 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 
 			str = strings.TrimSpace(str)
 
-			if level != -1 {
+			if level != -1 || autoTune == true {
 				log.Println(fmt.Sprintf(warningDupOpt, "compression level", str), verbose > 0)
 				ctx = -1
 				continue
 			}
 
+			if strings.ToUpper(str) == "AUTO" {
+				autoTune = true
+				ctx = -1
+				continue
+			}
+
 			level, err = strconv.Atoi(str)
 
 			if err != nil || level < 0 || level > 9 {
@@ -803,6 +861,22 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		argsMap["autoBlock"] = true
 	}
 
+	if mode == "c" && autoTune == true {
+		argsMap["autoTune"] = true
+	}
+
+	if deterministic == true {
+		argsMap["deterministic"] = true
+	}
+
+	if rsyncable == true {
+		argsMap["rsyncable"] = true
+	}
+
+	if sparse == true {
+		argsMap["sparse"] = true
+	}
+
 	argsMap["verbosity"] = uint(verbose)
 	argsMap["mode"] = mode
 	argsMap["inputName"] = inputName
@@ -919,7 +993,7 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("        'auto' means that the compressor derives the best value'", true)
 		log.Println("        based on input size (when available) and number of jobs.\n", true)
 		log.Println("   -l, --level=<compression>", true)
-		log.Println("        Set the compression level [0..9]", true)
+		log.Println("        Set the compression level [0..9] or 'auto'", true)
 		log.Println("        Providing this option forces entropy and transform.", true)
 		log.Println("        Defaults to level 3 if not provided.", true)
 		log.Println("        0=NONE&NONE (store)", true)
@@ -931,18 +1005,26 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("        6=TEXT+UTF+BWT+SRT+ZRLT&FPAQ", true)
 		log.Println("        7=LZP+TEXT+UTF+BWT+LZP&CM", true)
 		log.Println("        8=EXE+RLT+TEXT+UTF+DNA&TPAQ", true)
-		log.Println("        9=EXE+RLT+TEXT+UTF+DNA&TPAQX\n", true)
+		log.Println("        9=EXE+RLT+TEXT+UTF+DNA&TPAQX", true)
+		log.Println("        'auto' means that the transform and entropy codec of each block", true)
+		log.Println("        are selected by trying several combinations on a sample of the block.\n", true)
 		log.Println("   -e, --entropy=<codec>", true)
 		log.Println("        Entropy codec [None|Huffman|ANS0|ANS1|Range|FPAQ|TPAQ|TPAQX|CM]\n", true)
 		log.Println("   -t, --transform=<codec>", true)
 		log.Println("        Transform [None|BWT|BWTS|LZ|LZX|LZP|ROLZ|ROLZX|RLT|ZRLT]", true)
-		log.Println("                  [MTFT|RANK|SRT|TEXT|MM|EXE|UTF|PACK]", true)
-		log.Println("        EG: BWT+RANK or BWTS+MTFT\n", true)
+		log.Println("                  [MTFT|RANK|SRT|TEXT|MM|EXE|UTF|UTF16|PACK|LRM|JSON|GENOMIC|IMG]", true)
+		log.Println("                  [NUMERIC|ST4|ST6|SPARSE]", true)
+		log.Println("        EG: BWT+RANK or BWTS+MTFT or LRM+LZX\n", true)
 		log.Println("   -x, -x32, -x64, --checksum=<size>", true)
 		log.Println("        Enable block checksum (32 or 64 bits).", true)
 		log.Println("        -x is equivalent to -x32.\n", true)
 		log.Println("   -s, --skip", true)
 		log.Println("        Copy blocks with high entropy instead of compressing them.\n", true)
+		log.Println("   --deterministic", true)
+		log.Println("        Produce the same output regardless of the number of jobs and cores.\n", true)
+		log.Println("   --rsyncable", true)
+		log.Println("        End the blocks at content defined boundaries so that a local change", true)
+		log.Println("        of the input only changes the compressed blocks around it.\n", true)
 	}
 
 	log.Println("   -j, --jobs=<jobs>", true)
@@ -971,6 +1053,8 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("        The first block ID is 1.\n", true)
 		log.Println("   --to=blockID", true)
 		log.Println("        Decompress ending at the provided block (excluded).\n", true)
+		log.Println("   --sparse", true)
+		log.Println("        Leave the pages of zeros as holes in the output files (sparse files).\n", true)
 		log.Println("", true)
 		log.Println("EG. Kanzi -d -i foo.knz -f -v 2 -j 2\n", true)
 		log.Println("EG. Kanzi --decompress --input=foo.knz --force --verbose=2 --jobs=2\n", true)
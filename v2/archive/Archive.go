@@ -0,0 +1,110 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package archive stores several files in one archive. Each file is
+// compressed in its own stream (see package io), so that the blocks never
+// mix data from different files and the transforms detect the type of each
+// file (text, executable, DNA, ...). A central directory at the end of the
+// archive lists the files and locates their streams, so that any file (or
+// any subset of files, EG. the columns of a table, see Reader.Project) can
+// be extracted without reading the others.
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Layout (big endian, byte aligned):
+//
+//	magic "KANA" (4) | version (1)
+//	one compressed stream per file
+//	directory: number of entries (4) | entries
+//	entry: name length (2) | name | mode (4) | modification time (8, Unix ns)
+//	       size (8) | offset (8) | length (8) | first block (4) | blocks (4)
+//	trailer: directory offset (8) | directory length (8) | XXH64 of the
+//	         directory (8) | magic "KDIR" (4)
+//
+// Offsets are relative to the start of the archive. The blocks of the
+// files are numbered across the archive (starting at 0).
+
+const (
+	_ARCHIVE_MAGIC        = 0x4B414E41 // "KANA"
+	_ARCHIVE_DIR_MAGIC    = 0x4B444952 // "KDIR"
+	_ARCHIVE_VERSION      = 1
+	_ARCHIVE_HEADER_SIZE  = 5
+	_ARCHIVE_TRAILER_SIZE = 28
+	_ARCHIVE_ENTRY_SIZE   = 2 + 4 + 8 + 8 + 8 + 8 + 4 + 4 // without the name
+	_ARCHIVE_MAX_NAME     = 65535
+	_ARCHIVE_BLOCK_SIZE   = 1024 * 1024 // default block size
+	_ARCHIVE_HASH_SEED    = 0x4B414E41
+)
+
+// Header the metadata of a file in an archive
+type Header struct {
+	Name    string      // path of the file in the archive (unique)
+	Mode    fs.FileMode // permission and mode bits
+	ModTime time.Time   // modification time
+}
+
+// Entry a file in the directory of an archive
+type Entry struct {
+	Header
+	Size       int64 // original size (bytes)
+	Offset     int64 // position of the compressed stream in the archive
+	Length     int64 // size of the compressed stream (bytes)
+	FirstBlock int   // index of the first block of the file in the archive
+	Blocks     int   // number of blocks of the file
+}
+
+// streamContext returns the context map of the stream of a file
+func streamContext(opts kio.Options) map[string]any {
+	ctx := make(map[string]any)
+	ctx["transform"] = opts.Transform
+	ctx["entropy"] = opts.Entropy
+	ctx["blockSize"] = opts.BlockSize
+	ctx["jobs"] = opts.Jobs
+	ctx["checksum"] = opts.Checksum
+	ctx["headerless"] = false
+
+	if opts.Transform == "" {
+		ctx["transform"] = "NONE"
+	}
+
+	if opts.Entropy == "" {
+		ctx["entropy"] = "NONE"
+	}
+
+	if opts.BlockSize == 0 {
+		ctx["blockSize"] = uint(_ARCHIVE_BLOCK_SIZE)
+	}
+
+	if opts.Jobs == 0 {
+		ctx["jobs"] = uint(1)
+	}
+
+	return ctx
+}
+
+func checkName(name string) error {
+	if len(name) == 0 || len(name) > _ARCHIVE_MAX_NAME {
+		return fmt.Errorf("Invalid file name in archive: '%s'", name)
+	}
+
+	return nil
+}
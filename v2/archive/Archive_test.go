@@ -0,0 +1,226 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+func TestArchive(t *testing.T) {
+	fmt.Println("Archive Test")
+
+	files := map[string][]byte{
+		"doc/readme.txt": bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog.\n"), 3000),
+		"data/random":    make([]byte, 100000),
+		"data/genome":    make([]byte, 150000),
+		"empty":          {},
+	}
+
+	rand.Read(files["data/random"])
+
+	for i := range files["data/genome"] {
+		files["data/genome"][i] = "ACGT"[rand.Intn(4)]
+	}
+
+	names := []string{"doc/readme.txt", "data/random", "empty", "data/genome"}
+	modTime := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	opts := kio.Options{Transform: "TEXT+UTF+PACK+MM+LZX", Entropy: "HUFFMAN", BlockSize: 65536, Jobs: 2, Checksum: 32}
+	w, err := NewWriter(&buf, opts)
+
+	if err != nil {
+		t.Fatalf("Cannot create archive: %v", err)
+	}
+
+	for _, name := range names {
+		if err = w.Add(Header{Name: name, Mode: 0644, ModTime: modTime}, bytes.NewReader(files[name])); err != nil {
+			t.Fatalf("Cannot add '%s': %v", name, err)
+		}
+	}
+
+	if _, err = w.Create(Header{Name: "empty"}); err == nil {
+		t.Errorf("Expected error on duplicate name")
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Cannot close archive: %v", err)
+	}
+
+	data := buf.Bytes()
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), 2)
+
+	if err != nil {
+		t.Fatalf("Cannot read archive: %v", err)
+	}
+
+	entries := r.Entries()
+
+	if len(entries) != len(names) {
+		t.Fatalf("Expected %d entries, got %d", len(names), len(entries))
+	}
+
+	blocks := 0
+
+	for i, e := range entries {
+		fmt.Printf("%-16s %7d => %7d bytes, blocks [%d..%d)\n", e.Name, e.Size, e.Length, e.FirstBlock, e.FirstBlock+e.Blocks)
+
+		if e.Name != names[i] || e.Size != int64(len(files[e.Name])) || e.ModTime.Equal(modTime) == false || e.Mode != 0644 {
+			t.Errorf("Incorrect entry: %+v", e)
+		}
+
+		if e.FirstBlock != blocks {
+			t.Errorf("Incorrect first block for '%s': %d", e.Name, e.FirstBlock)
+		}
+
+		blocks += e.Blocks
+	}
+
+	// Selective extraction (in any order)
+	for i := len(names) - 1; i >= 0; i-- {
+		f, err := r.Open(names[i])
+
+		if err != nil {
+			t.Fatalf("Cannot open '%s': %v", names[i], err)
+		}
+
+		res, err := io.ReadAll(f)
+		f.Close()
+
+		if err != nil || bytes.Equal(res, files[names[i]]) == false {
+			t.Errorf("Incorrect data for '%s': %v", names[i], err)
+		}
+	}
+
+	if _, err = r.Open("missing"); err == nil {
+		t.Errorf("Expected error on missing file")
+	}
+
+	// Corrupted directory
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-_ARCHIVE_TRAILER_SIZE-10] ^= 1
+
+	if _, err = NewReader(bytes.NewReader(corrupted), int64(len(corrupted)), 1); err == nil {
+		t.Errorf("Expected error on corrupted directory")
+	}
+}
+
+// rangeReader records the ranges read from the archive
+type rangeReader struct {
+	r      *bytes.Reader
+	ranges [][2]int64
+}
+
+func (this *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := this.r.ReadAt(p, off)
+	this.ranges = append(this.ranges, [2]int64{off, off + int64(n)})
+	return n, err
+}
+
+func TestProjection(t *testing.T) {
+	fmt.Println("Projection Test")
+
+	// One file per column
+	columns := []string{"id", "name", "price", "quantity", "comment"}
+	files := make(map[string][]byte)
+
+	for i, col := range columns {
+		var b bytes.Buffer
+
+		for row := 0; row < 20000; row++ {
+			fmt.Fprintf(&b, "%s-%d\n", col, row*(i+1)+rand.Intn(10))
+		}
+
+		files[col] = b.Bytes()
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, kio.Options{Transform: "LZ", Entropy: "HUFFMAN", BlockSize: 65536, Checksum: 32})
+
+	for _, col := range columns {
+		if err := w.Add(Header{Name: col}, bytes.NewReader(files[col])); err != nil {
+			t.Fatalf("Cannot add '%s': %v", col, err)
+		}
+	}
+
+	w.Close()
+	data := buf.Bytes()
+	rr := &rangeReader{r: bytes.NewReader(data)}
+	r, err := NewReader(rr, int64(len(data)), 2)
+
+	if err != nil {
+		t.Fatalf("Cannot read archive: %v", err)
+	}
+
+	// Ranges read after the directory
+	rr.ranges = rr.ranges[:0]
+	entries := make(map[string]Entry)
+
+	for _, e := range r.Entries() {
+		entries[e.Name] = e
+	}
+
+	projected := make([]string, 0)
+	err = r.Project([]string{"quantity", "name", "quantity"}, func(e Entry, f io.Reader) error {
+		res, err := io.ReadAll(f)
+
+		if err == nil && bytes.Equal(res, files[e.Name]) == false {
+			err = fmt.Errorf("Incorrect data for '%s'", e.Name)
+		}
+
+		projected = append(projected, e.Name)
+		return err
+	})
+
+	if err != nil {
+		t.Fatalf("Projection failed: %v", err)
+	}
+
+	if len(projected) != 2 || projected[0] != "name" || projected[1] != "quantity" {
+		t.Errorf("Incorrect projected columns: %v", projected)
+	}
+
+	read := int64(0)
+
+	for _, rg := range rr.ranges {
+		inside := false
+
+		for _, col := range projected {
+			e := entries[col]
+			inside = inside || (rg[0] >= e.Offset && rg[1] <= e.Offset+e.Length)
+		}
+
+		if inside == false {
+			t.Errorf("Read outside of the projected columns: [%d..%d)", rg[0], rg[1])
+		}
+
+		read += rg[1] - rg[0]
+	}
+
+	fmt.Printf("Projection: %d bytes read out of %d\n", read, len(data))
+
+	rr.ranges = rr.ranges[:0]
+
+	if err = r.Project([]string{"name", "missing"}, nil); err == nil || len(rr.ranges) != 0 {
+		t.Errorf("Expected error on missing column before any read")
+	}
+}
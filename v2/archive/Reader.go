@@ -0,0 +1,221 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Reader provides access to the files of an archive
+type Reader struct {
+	r       io.ReaderAt
+	entries []Entry
+	index   map[string]int
+	jobs    uint
+}
+
+// NewReader reads the directory of the archive of the provided size.
+// The files are decoded using up to 'jobs' concurrent jobs (1 if 0).
+func NewReader(r io.ReaderAt, size int64, jobs uint) (*Reader, error) {
+	if r == nil {
+		return nil, errors.New("Invalid null reader parameter")
+	}
+
+	if size < _ARCHIVE_HEADER_SIZE+_ARCHIVE_TRAILER_SIZE {
+		return nil, errors.New("Invalid archive: too small")
+	}
+
+	var hdr [_ARCHIVE_HEADER_SIZE]byte
+
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint32(hdr[0:]) != _ARCHIVE_MAGIC {
+		return nil, errors.New("Invalid archive: missing header")
+	}
+
+	if hdr[4] != _ARCHIVE_VERSION {
+		return nil, fmt.Errorf("Unsupported archive version: %d", hdr[4])
+	}
+
+	var trailer [_ARCHIVE_TRAILER_SIZE]byte
+
+	if _, err := r.ReadAt(trailer[:], size-_ARCHIVE_TRAILER_SIZE); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint32(trailer[24:]) != _ARCHIVE_DIR_MAGIC {
+		return nil, errors.New("Invalid archive: missing directory")
+	}
+
+	offset := int64(binary.BigEndian.Uint64(trailer[0:]))
+	length := int64(binary.BigEndian.Uint64(trailer[8:]))
+
+	if offset < _ARCHIVE_HEADER_SIZE || length < 4 || offset > size-_ARCHIVE_TRAILER_SIZE-length {
+		return nil, errors.New("Invalid archive: invalid directory location")
+	}
+
+	dir := make([]byte, length)
+
+	if _, err := r.ReadAt(dir, offset); err != nil {
+		return nil, err
+	}
+
+	hasher, _ := hash.NewXXHash64(_ARCHIVE_HASH_SEED)
+
+	if hasher.Hash(dir) != binary.BigEndian.Uint64(trailer[16:]) {
+		return nil, errors.New("Invalid archive: corrupted directory")
+	}
+
+	if jobs == 0 {
+		jobs = 1
+	}
+
+	this := &Reader{r: r, index: make(map[string]int), jobs: jobs}
+	count := int(binary.BigEndian.Uint32(dir))
+	dir = dir[4:]
+
+	for i := 0; i < count; i++ {
+		if len(dir) < 2 || len(dir) < _ARCHIVE_ENTRY_SIZE+int(binary.BigEndian.Uint16(dir)) {
+			return nil, errors.New("Invalid archive: truncated directory")
+		}
+
+		n := int(binary.BigEndian.Uint16(dir))
+		var e Entry
+		e.Name = string(dir[2 : 2+n])
+		dir = dir[2+n:]
+		e.Mode = fs.FileMode(binary.BigEndian.Uint32(dir[0:]))
+		e.ModTime = time.Unix(0, int64(binary.BigEndian.Uint64(dir[4:])))
+		e.Size = int64(binary.BigEndian.Uint64(dir[12:]))
+		e.Offset = int64(binary.BigEndian.Uint64(dir[20:]))
+		e.Length = int64(binary.BigEndian.Uint64(dir[28:]))
+		e.FirstBlock = int(binary.BigEndian.Uint32(dir[36:]))
+		e.Blocks = int(binary.BigEndian.Uint32(dir[40:]))
+		dir = dir[_ARCHIVE_ENTRY_SIZE-2:]
+
+		if e.Offset < _ARCHIVE_HEADER_SIZE || e.Length < 0 || e.Offset > offset-e.Length {
+			return nil, fmt.Errorf("Invalid archive: invalid location of '%s'", e.Name)
+		}
+
+		this.index[e.Name] = len(this.entries)
+		this.entries = append(this.entries, e)
+	}
+
+	return this, nil
+}
+
+// Entries returns the files of the archive (in archive order)
+func (this *Reader) Entries() []Entry {
+	res := make([]Entry, len(this.entries))
+	copy(res, this.entries)
+	return res
+}
+
+// Open returns a reader decoding the file with the provided name. Only the
+// stream of this file is read.
+func (this *Reader) Open(name string) (io.ReadCloser, error) {
+	i, ok := this.index[name]
+
+	if ok == false {
+		return nil, fmt.Errorf("File not found in archive: '%s'", name)
+	}
+
+	e := this.entries[i]
+	section := io.NewSectionReader(this.r, e.Offset, e.Length)
+	r, err := kio.NewReaderWithCtx(io.NopCloser(section), map[string]any{"jobs": this.jobs})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileReader{reader: r, name: e.Name, size: e.Size}, nil
+}
+
+// Project decodes the files with the provided names (EG. the columns of a
+// table stored as one file per column) and calls fn for each of them, in
+// archive order. Only the streams of these files are read: the rest of the
+// archive is not touched. Fails before reading anything if a name is not
+// in the archive. The reader passed to fn is valid during the call only.
+func (this *Reader) Project(names []string, fn func(e Entry, r io.Reader) error) error {
+	selected := make([]bool, len(this.entries))
+
+	for _, name := range names {
+		i, ok := this.index[name]
+
+		if ok == false {
+			return fmt.Errorf("File not found in archive: '%s'", name)
+		}
+
+		selected[i] = true
+	}
+
+	// Archive order: the streams are read sequentially (no backward seek)
+	for i, e := range this.entries {
+		if selected[i] == false {
+			continue
+		}
+
+		f, err := this.Open(e.Name)
+
+		if err != nil {
+			return err
+		}
+
+		err = fn(e, f)
+
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileReader checks the size of the decoded file
+type fileReader struct {
+	reader *kio.Reader
+	name   string
+	size   int64
+	read   int64
+}
+
+func (this *fileReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	this.read += int64(n)
+
+	if err == io.EOF && this.read != this.size {
+		return n, fmt.Errorf("Invalid size of '%s' in archive: %d bytes decoded, expected %d", this.name, this.read, this.size)
+	}
+
+	return n, err
+}
+
+func (this *fileReader) Close() error {
+	return this.reader.Close()
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Writer writes the files of an archive in sequence
+type Writer struct {
+	out       *countingWriter
+	opts      kio.Options
+	blockSize int64
+	entries   []Entry
+	names     map[string]bool
+	current   *kio.Writer
+	blocks    int
+	closed    bool
+}
+
+// countingWriter counts the bytes written to the archive. The streams of
+// the files do not close it.
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (this *countingWriter) Write(p []byte) (int, error) {
+	n, err := this.w.Write(p)
+	this.written += int64(n)
+	return n, err
+}
+
+func (this *countingWriter) Close() error {
+	return nil
+}
+
+// fileWriter the writer returned by Create
+type fileWriter struct {
+	archive *Writer
+	stream  *kio.Writer
+}
+
+func (this *fileWriter) Write(p []byte) (int, error) {
+	if this.archive.current != this.stream {
+		return 0, errors.New("Archive file closed")
+	}
+
+	n, err := this.stream.Write(p)
+	this.archive.entries[len(this.archive.entries)-1].Size += int64(n)
+	return n, err
+}
+
+// NewWriter creates a Writer and writes the archive header to w. The
+// options apply to all the files (1 MB blocks by default).
+func NewWriter(w io.Writer, opts kio.Options) (*Writer, error) {
+	if w == nil {
+		return nil, errors.New("Invalid null writer parameter")
+	}
+
+	this := &Writer{out: &countingWriter{w: w}, opts: opts, names: make(map[string]bool)}
+	this.blockSize = int64(streamContext(opts)["blockSize"].(uint))
+	var buf [_ARCHIVE_HEADER_SIZE]byte
+	binary.BigEndian.PutUint32(buf[0:], _ARCHIVE_MAGIC)
+	buf[4] = _ARCHIVE_VERSION
+
+	if _, err := this.out.Write(buf[:]); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// Create adds a file to the archive and returns a writer for its data. The
+// previous file is closed: its writer must not be used anymore.
+func (this *Writer) Create(hdr Header) (io.Writer, error) {
+	if this.closed == true {
+		return nil, errors.New("Archive closed")
+	}
+
+	if err := checkName(hdr.Name); err != nil {
+		return nil, err
+	}
+
+	if this.names[hdr.Name] == true {
+		return nil, fmt.Errorf("Duplicate file name in archive: '%s'", hdr.Name)
+	}
+
+	if err := this.closeFile(); err != nil {
+		return nil, err
+	}
+
+	stream, err := kio.NewWriterWithCtx(this.out, streamContext(this.opts))
+
+	if err != nil {
+		return nil, err
+	}
+
+	this.names[hdr.Name] = true
+	this.entries = append(this.entries, Entry{Header: hdr, Offset: this.out.written, FirstBlock: this.blocks})
+	this.current = stream
+	return &fileWriter{archive: this, stream: stream}, nil
+}
+
+// Add adds a file to the archive with the data read from r
+func (this *Writer) Add(hdr Header, r io.Reader) error {
+	w, err := this.Create(hdr)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// closeFile closes the stream of the current file (if any)
+func (this *Writer) closeFile() error {
+	if this.current == nil {
+		return nil
+	}
+
+	err := this.current.Close()
+	this.current = nil
+
+	if err != nil {
+		return err
+	}
+
+	e := &this.entries[len(this.entries)-1]
+	e.Length = this.out.written - e.Offset
+	e.Blocks = int((e.Size + this.blockSize - 1) / this.blockSize)
+	this.blocks += e.Blocks
+	return nil
+}
+
+// Close closes the last file and writes the directory and the trailer.
+// It does not close the underlying writer.
+func (this *Writer) Close() error {
+	if this.closed == true {
+		return nil
+	}
+
+	this.closed = true
+
+	if err := this.closeFile(); err != nil {
+		return err
+	}
+
+	dir := make([]byte, 4, 4+len(this.entries)*(_ARCHIVE_ENTRY_SIZE+16))
+	binary.BigEndian.PutUint32(dir, uint32(len(this.entries)))
+
+	for _, e := range this.entries {
+		dir = binary.BigEndian.AppendUint16(dir, uint16(len(e.Name)))
+		dir = append(dir, e.Name...)
+		dir = binary.BigEndian.AppendUint32(dir, uint32(e.Mode))
+		dir = binary.BigEndian.AppendUint64(dir, uint64(e.ModTime.UnixNano()))
+		dir = binary.BigEndian.AppendUint64(dir, uint64(e.Size))
+		dir = binary.BigEndian.AppendUint64(dir, uint64(e.Offset))
+		dir = binary.BigEndian.AppendUint64(dir, uint64(e.Length))
+		dir = binary.BigEndian.AppendUint32(dir, uint32(e.FirstBlock))
+		dir = binary.BigEndian.AppendUint32(dir, uint32(e.Blocks))
+	}
+
+	hasher, _ := hash.NewXXHash64(_ARCHIVE_HASH_SEED)
+	offset := this.out.written
+	trailer := make([]byte, 0, _ARCHIVE_TRAILER_SIZE)
+	trailer = binary.BigEndian.AppendUint64(trailer, uint64(offset))
+	trailer = binary.BigEndian.AppendUint64(trailer, uint64(len(dir)))
+	trailer = binary.BigEndian.AppendUint64(trailer, hasher.Hash(dir))
+	trailer = binary.BigEndian.AppendUint32(trailer, _ARCHIVE_DIR_MAGIC)
+
+	if _, err := this.out.Write(dir); err != nil {
+		return err
+	}
+
+	_, err := this.out.Write(trailer)
+	return err
+}
+
+// Entries returns the files written so far
+func (this *Writer) Entries() []Entry {
+	res := make([]Entry, len(this.entries))
+	copy(res, this.entries)
+	return res
+}
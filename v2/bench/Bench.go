@@ -0,0 +1,170 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bench measures the transforms and entropy codecs on user data
+// (through the actual compression pipeline) to help select the codecs.
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+const (
+	_BENCH_MIN_BLOCK_SIZE = 1024
+	_BENCH_MAX_BLOCK_SIZE = 4 * 1024 * 1024
+)
+
+// Result the measures of a codec (or combination of codecs) on some data
+type Result struct {
+	Name        string  // as requested (EG. "BWT", "ANS0" or "TEXT+BWT&ANS0")
+	Transform   string  // transform(s) used, "NONE" if none
+	Entropy     string  // entropy codec used, "NONE" if none
+	InputSize   int     // bytes
+	OutputSize  int     // size of the compressed stream (bytes)
+	Ratio       float64 // OutputSize / InputSize
+	EncodeSpeed float64 // MB/s
+	DecodeSpeed float64 // MB/s
+	Memory      uint64  // bytes allocated to encode and decode the data
+	Err         error   // if not nil, the other measures are not valid
+}
+
+// RunTransforms compresses and decompresses data with each of the codecs
+// provided (sequentially, with one job). A name is a transform (EG.
+// "TEXT+BWT"), an entropy codec (EG. "ANS0") or a combination of both
+// separated by '&' (EG. "TEXT+BWT&ANS0"). If names is empty, all the
+// transforms and entropy codecs (including the registered ones) are run.
+func RunTransforms(data []byte, names []string) []Result {
+	if len(names) == 0 {
+		names = append(transform.Names(), entropy.Names()...)
+	}
+
+	res := make([]Result, len(names))
+
+	for i, name := range names {
+		res[i] = run(data, name)
+	}
+
+	return res
+}
+
+// codecs returns the transform and the entropy codec of a benchmark name
+func codecs(name string) (string, string, error) {
+	name = strings.ToUpper(name)
+
+	if t, e, found := strings.Cut(name, "&"); found == true {
+		if _, err := transform.GetType(t); err != nil {
+			return "", "", err
+		}
+
+		if _, err := entropy.GetType(e); err != nil {
+			return "", "", err
+		}
+
+		return t, e, nil
+	}
+
+	if _, err := transform.GetType(name); err == nil {
+		return name, "NONE", nil
+	}
+
+	if _, err := entropy.GetType(name); err == nil {
+		return "NONE", name, nil
+	}
+
+	return "", "", fmt.Errorf("Unknown transform or entropy codec: '%s'", name)
+}
+
+func run(data []byte, name string) Result {
+	res := Result{Name: name, InputSize: len(data)}
+	var err error
+
+	if res.Transform, res.Entropy, err = codecs(name); err != nil {
+		res.Err = err
+		return res
+	}
+
+	// One block for small inputs
+	blockSize := min(max((len(data)+15) & ^15, _BENCH_MIN_BLOCK_SIZE), _BENCH_MAX_BLOCK_SIZE)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	start := time.Now()
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"transform": res.Transform, "entropy": res.Entropy, "blockSize": uint(blockSize),
+		"jobs": uint(1), "checksum": uint(0), "fileSize": int64(len(data))}
+	w, err := kio.NewWriterWithCtx(bs, ctx)
+
+	if err == nil {
+		if _, err = w.Write(data); err == nil {
+			err = w.Close()
+		}
+	}
+
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.EncodeSpeed = speed(len(data), time.Since(start))
+	compressed := bs.Bytes()
+	res.OutputSize = len(compressed)
+
+	start = time.Now()
+	r, err := kio.NewReaderWithCtx(internal.NewBufferStream(compressed), map[string]any{"jobs": uint(1)})
+
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	decoded, err := io.ReadAll(r)
+	r.Close()
+
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.DecodeSpeed = speed(len(data), time.Since(start))
+	runtime.ReadMemStats(&after)
+	res.Memory = after.TotalAlloc - before.TotalAlloc
+
+	if bytes.Equal(decoded, data) == false {
+		res.Err = fmt.Errorf("Invalid decompressed data for '%s'", name)
+		return res
+	}
+
+	if len(data) > 0 {
+		res.Ratio = float64(res.OutputSize) / float64(len(data))
+	}
+
+	return res
+}
+
+// speed returns the processing speed in MB/s
+func speed(length int, elapsed time.Duration) float64 {
+	return float64(length) / max(elapsed.Seconds(), 1e-9) / (1 << 20)
+}
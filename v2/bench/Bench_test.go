@@ -0,0 +1,67 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+func TestRunTransforms(t *testing.T) {
+	fmt.Println("Run Transforms Test")
+
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. 0123456789\n"), 2000)
+	results := RunTransforms(data, nil)
+
+	if len(results) != len(transform.Names())+len(entropy.Names()) {
+		t.Fatalf("Invalid number of results: %d", len(results))
+	}
+
+	for _, r := range results {
+		fmt.Printf("%-10s %8d => %8d (%.3f) %9.2f MB/s %9.2f MB/s %10d bytes\n",
+			r.Name, r.InputSize, r.OutputSize, r.Ratio, r.EncodeSpeed, r.DecodeSpeed, r.Memory)
+
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Name, r.Err)
+		}
+	}
+
+	results = RunTransforms(data, []string{"text+bwt&ans0", "LZ", "TPAQ", "none", "UNKNOWN", "BWT&UNKNOWN"})
+
+	if r := results[0]; r.Err != nil || r.Transform != "TEXT+BWT" || r.Entropy != "ANS0" || r.Ratio <= 0 || r.Ratio >= 0.5 {
+		t.Errorf("Invalid result: %+v", r)
+	}
+
+	if r := results[1]; r.Err != nil || r.Transform != "LZ" || r.Entropy != "NONE" {
+		t.Errorf("Invalid result: %+v", r)
+	}
+
+	if r := results[2]; r.Err != nil || r.Transform != "NONE" || r.Entropy != "TPAQ" {
+		t.Errorf("Invalid result: %+v", r)
+	}
+
+	if r := results[3]; r.Err != nil || r.Ratio < 1 {
+		t.Errorf("Invalid result: %+v", r)
+	}
+
+	if results[4].Err == nil || results[5].Err == nil {
+		t.Errorf("Expected errors on unknown codecs")
+	}
+}
@@ -43,6 +43,38 @@ func BenchmarkBWTS(b *testing.B) {
 	}
 }
 
+// Forward transform of large blocks, with and without the low memory mode.
+// The bytes allocated per operation are the extra memory used by the
+// transform (the buffers are allocated once per block).
+func BenchmarkBWTForward(b *testing.B) {
+	for _, size := range []int{1 << 20, 4 << 20, 16 << 20} {
+		for _, lowMemory := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%dMB/lowMemory=%v", size>>20, lowMemory), func(b *testing.B) {
+				r := rand.New(rand.NewSource(1234567))
+				buf1 := make([]byte, size)
+				buf2 := make([]byte, size)
+
+				for i := range buf1 {
+					buf1[i] = byte(r.Intn(64) + 32)
+				}
+
+				ctx := map[string]any{"jobs": uint(1), "bwtLowMemory": lowMemory}
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					bwt, _ := transform.NewBWTWithCtx(&ctx)
+
+					if _, _, err := bwt.Forward(buf1, buf2); err != nil {
+						b.Fatalf("Forward failed: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
 func testBWTSpeed(isBWT bool, iter, size int) error {
 	buf1 := make([]byte, size)
 	buf2 := make([]byte, size)
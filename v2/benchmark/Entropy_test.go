@@ -168,3 +168,30 @@ func testEntropySpeed(b *testing.B, name string) error {
 
 	return nil
 }
+
+func BenchmarkBatchANS0(b *testing.B) {
+	blocks := make([][]byte, 1000)
+
+	for i := range blocks {
+		blocks[i] = make([]byte, 64+rand.Intn(512))
+
+		for j := range blocks[i] {
+			blocks[i][j] = byte(97 + rand.Intn(20))
+		}
+	}
+
+	ctx := map[string]any{"entropy": "ANS0"}
+	b.ResetTimer()
+
+	for iter := 0; iter < b.N; iter++ {
+		encoded, err := entropy.EncodeBatch(blocks, ctx)
+
+		if err != nil {
+			b.Fatalf(err.Error())
+		}
+
+		if _, err = entropy.DecodeBatch(encoded, ctx); err != nil {
+			b.Fatalf(err.Error())
+		}
+	}
+}
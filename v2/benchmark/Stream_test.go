@@ -0,0 +1,99 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Allocations of the compression and decompression of a stream (several
+// blocks per task). The block buffers of the tasks are pooled: the bytes
+// allocated per operation do not grow with the number of blocks.
+func BenchmarkStreamAllocs(b *testing.B) {
+	const blockSize = 256 * 1024
+	data := make([]byte, 32*blockSize)
+	r := rand.New(rand.NewSource(1234567))
+
+	for i := range data {
+		data[i] = byte(r.Intn(16) + 65)
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(blockSize),
+			"jobs": jobs, "checksum": uint(32)}
+		var compressed bytes.Buffer
+
+		compress := func() error {
+			compressed.Reset()
+			w, err := kio.NewWriterWithCtx(nopCloser{&compressed}, ctx)
+
+			if err == nil {
+				w.Write(data)
+				err = w.Close()
+			}
+
+			return err
+		}
+
+		if err := compress(); err != nil {
+			b.Fatalf("Compression failed: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("Compress/jobs=%d", jobs), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if err := compress(); err != nil {
+					b.Fatalf("Compression failed: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Decompress/jobs=%d", jobs), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				r, err := kio.NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed.Bytes())), map[string]any{"jobs": jobs})
+
+				if err != nil {
+					b.Fatalf("Cannot create reader: %v", err)
+				}
+
+				if n, err := io.Copy(io.Discard, r); err != nil || n != int64(len(data)) {
+					b.Fatalf("Decompression failed: %v", err)
+				}
+
+				r.Close()
+			}
+		})
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -16,8 +16,11 @@ limitations under the License.
 package benchmark
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"testing"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
@@ -69,6 +72,10 @@ func getTransform(name string) (kanzi.ByteTransform, error) {
 		res, err := transform.NewROLZCodecWithCtx(&ctx)
 		return res, err
 
+	case "TEXT":
+		res, err := transform.NewTextCodecWithCtx(&ctx)
+		return res, err
+
 	case "RANK":
 		res, err := transform.NewSBRT(transform.SBRT_MODE_RANK)
 		return res, err
@@ -152,6 +159,81 @@ func BenchmarkMTFT(b *testing.B) {
 	}
 }
 
+func BenchmarkTextCodec(b *testing.B) {
+	if err := testTextCodecSpeed(b.N, false); err != nil {
+		b.Fatalf(err.Error())
+	}
+}
+
+func BenchmarkTextCodecPseudoText(b *testing.B) {
+	if err := testTextCodecSpeed(b.N, true); err != nil {
+		b.Fatalf(err.Error())
+	}
+}
+
+// testTextCodecSpeed measures Forward and Inverse on text made of common
+// words or, with pseudo set, on random words the dictionary cannot match
+// (the transform is expected to bail out early).
+func testTextCodecSpeed(iter int, pseudo bool) error {
+	// Initialize with a fixed seed to get consistent results
+	r := rand.New(rand.NewSource(1234567))
+	words := strings.Fields(`the of and to in is that for it as was with be by on not he this are
+		or his from at which but have an they you were her she there been one all we their has would
+		when if so no will more can time who about other into only its then some them could these`)
+	size := 1024 * 1024
+	input := make([]byte, 0, size+32)
+
+	for len(input) < size {
+		if pseudo == true {
+			n := 2 + r.Intn(8)
+
+			for i := 0; i < n; i++ {
+				input = append(input, byte('a'+r.Intn(26)))
+			}
+		} else {
+			input = append(input, words[r.Intn(len(words))]...)
+		}
+
+		input = append(input, ' ')
+	}
+
+	input = input[0:size]
+	reverse := make([]byte, size)
+	f, _ := getTransform("TEXT")
+	output := make([]byte, f.MaxEncodedLen(size))
+	var dstIdx uint
+	var err error
+
+	for ii := 0; ii < iter; ii++ {
+		f, _ = getTransform("TEXT")
+		_, dstIdx, err = f.Forward(input, output)
+
+		if pseudo == true {
+			if err == nil {
+				return errors.New("Text transform should skip pseudo text")
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		f, _ = getTransform("TEXT")
+
+		if _, _, err = f.Inverse(output[0:dstIdx], reverse); err != nil {
+			return err
+		}
+	}
+
+	if pseudo == false && bytes.Equal(input, reverse) == false {
+		return errors.New("Text transform: roundtrip failed")
+	}
+
+	return nil
+}
+
 func testTransformSpeed(name string, iter int) error {
 	// Initialize with a fixed seed to get consistent results
 	r := rand.New(rand.NewSource(1234567))
@@ -225,3 +307,40 @@ func testTransformSpeed(name string, iter int) error {
 
 	return nil
 }
+
+// Forward transform of data with long matches (match extension loops)
+func BenchmarkLongMatches(b *testing.B) {
+	r := rand.New(rand.NewSource(1234567))
+	chunk := make([]byte, 4096)
+
+	for i := range chunk {
+		chunk[i] = byte(r.Intn(256))
+	}
+
+	// Copies of the chunk with a few random changes
+	input := make([]byte, 0, 1<<20)
+
+	for len(input) < 1<<20 {
+		n := len(input)
+		input = append(input, chunk...)
+
+		for j := 0; j < 8; j++ {
+			input[n+r.Intn(len(chunk))] = byte(r.Intn(256))
+		}
+	}
+
+	for _, name := range []string{"LZX", "ROLZ", "ROLZX"} {
+		b.Run(name, func(b *testing.B) {
+			output := make([]byte, 2*len(input))
+			b.SetBytes(int64(len(input)))
+
+			for i := 0; i < b.N; i++ {
+				f, _ := getTransform(name)
+
+				if _, _, err := f.Forward(input, output); err != nil {
+					b.Fatalf("%s: forward failed: %v", name, err)
+				}
+			}
+		})
+	}
+}
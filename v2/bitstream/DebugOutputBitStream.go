@@ -178,6 +178,16 @@ func (this *DebugOutputBitStream) Close() error {
 	return this.delegate.Close()
 }
 
+// Flush writes the complete bytes written so far to the underlying stream.
+// Calls Flush() on the underlying bitstream delegate if it is supported.
+func (this *DebugOutputBitStream) Flush() error {
+	if f, ok := this.delegate.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
 // Written returns the number of bits written
 // Calls Written() on the underlying bitstream delegate.
 func (this *DebugOutputBitStream) Written() uint64 {
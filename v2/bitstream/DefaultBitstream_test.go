@@ -95,7 +95,7 @@ func testCorrectnessAligned1() error {
 			if test < 5 {
 				values[i] = rand.Intn(test*1000 + 100)
 			} else {
-				values[i] = rand.Intn(1 << 31)
+				values[i] = int(rand.Int31())
 			}
 
 			fmt.Printf("%v ", values[i])
@@ -210,7 +210,7 @@ func testCorrectnessMisaligned1() error {
 			if test < 5 {
 				values[i] = rand.Intn(test*1000 + 100)
 			} else {
-				values[i] = rand.Intn(1 << 31)
+				values[i] = int(rand.Int31())
 			}
 
 			mask := (1 << (1 + uint(i&63))) - 1
@@ -299,7 +299,7 @@ func testCorrectnessAligned2() error {
 			if test < 5 {
 				input[i] = byte(rand.Intn(test*1000 + 100))
 			} else {
-				input[i] = byte(rand.Intn(1 << 31))
+				input[i] = byte(int(rand.Int31()))
 			}
 
 			fmt.Printf("%v ", input[i])
@@ -382,7 +382,7 @@ func testCorrectnessMisaligned2() error {
 			if test < 5 {
 				input[i] = byte(rand.Intn(test*1000 + 100))
 			} else {
-				input[i] = byte(rand.Intn(1 << 31))
+				input[i] = byte(int(rand.Int31()))
 			}
 
 			fmt.Printf("%v ", input[i])
@@ -471,3 +471,59 @@ func testReadPostClose(ibs kanzi.InputBitStream) {
 	fmt.Printf("\nTrying to read from closed stream\n")
 	ibs.ReadBit()
 }
+
+func TestSelfTest(b *testing.T) {
+	fmt.Println("Self Test")
+
+	if err := SelfTest(); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestReset(b *testing.T) {
+	fmt.Println("Reset Test")
+
+	obs, _ := NewDefaultOutputBitStream(internal.NewBufferStream(), 1024)
+	obs.WriteBits(0x123456789, 40) // discarded by Reset
+	bs := internal.NewBufferStream()
+
+	if err := obs.Reset(bs); err != nil {
+		b.Fatalf("Reset failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		obs.WriteBits(0x5A5A5A5A5A, 40)
+		obs.WriteBit(1)
+
+		if err := obs.Close(); err != nil {
+			b.Fatalf("Close failed: %v", err)
+		}
+
+		if obs.Written() != 41 {
+			b.Fatalf("Invalid number of bits written: %d", obs.Written())
+		}
+
+		if i == 0 {
+			obs.Reset(bs)
+		}
+	}
+
+	ibs, _ := NewDefaultInputBitStream(internal.NewBufferStream(), 1024)
+	ibs.Close()
+	data := bs.Bytes()
+
+	for i := 0; i < 2; i++ {
+		// Each stream is 6 bytes long (41 bits padded)
+		if err := ibs.Reset(internal.NewBufferStream(data[6*i : 6*i+6])); err != nil {
+			b.Fatalf("Reset failed: %v", err)
+		}
+
+		if val := ibs.ReadBits(40); val != 0x5A5A5A5A5A || ibs.ReadBit() != 1 || ibs.Read() != 41 {
+			b.Errorf("Invalid data read from stream %d: %x", i, val)
+		}
+	}
+
+	if obs.Reset(nil) == nil || ibs.Reset(nil) == nil {
+		b.Errorf("Missing error for null stream")
+	}
+}
@@ -218,7 +218,7 @@ func (this *DefaultInputBitStream) readFromInputStream(count int) (int, error) {
 		return 0, nil
 	}
 
-	this.read += (int64(this.position << 3))
+	this.read += int64(this.position) << 3
 	size, err := this.is.Read(this.buffer[0:count])
 	this.position = 0
 
@@ -238,7 +238,7 @@ func (this *DefaultInputBitStream) HasMoreToRead() (bool, error) {
 		return false, errors.New("Stream closed")
 	}
 
-	if this.position < this.maxPosition || this.availBits != 0 {
+	if this.position <= this.maxPosition || this.availBits != 0 {
 		return true, nil
 	}
 
@@ -291,6 +291,23 @@ func (this *DefaultInputBitStream) Close() error {
 	return nil
 }
 
+// Reset discards the buffered bits and starts reading from the provided
+// stream, reusing the buffer
+func (this *DefaultInputBitStream) Reset(stream io.ReadCloser) error {
+	if stream == nil {
+		return errors.New("Invalid null input stream parameter")
+	}
+
+	this.is = stream
+	this.closed = false
+	this.read = 0
+	this.position = 0
+	this.availBits = 0
+	this.maxPosition = -1
+	this.current = 0
+	return nil
+}
+
 // Read returns the number of bits read so far
 func (this *DefaultInputBitStream) Read() uint64 {
 	return uint64(this.read + int64(this.position)<<3 - int64(this.availBits))
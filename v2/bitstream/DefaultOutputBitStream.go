@@ -103,7 +103,8 @@ func (this *DefaultOutputBitStream) WriteArray(bits []byte, count uint) uint {
 		panic(errors.New("Stream closed"))
 	}
 
-	if count > uint(len(bits)<<3) {
+	// 64 bit comparison (no overflow on 32 bit platforms)
+	if uint64(count) > uint64(len(bits))<<3 {
 		panic(fmt.Errorf("Invalid length: %d (must be in [1..%d])", count, len(bits)<<3))
 	}
 
@@ -191,8 +192,9 @@ func (this *DefaultOutputBitStream) WriteArray(bits []byte, count uint) uint {
 		remaining -= 8
 	}
 
+	// Last bits (only read the last byte: bits may end there)
 	if remaining > 0 {
-		this.WriteBits(binary.BigEndian.Uint64(bits[start:start+8])>>uint(64-remaining), uint(remaining))
+		this.WriteBits(uint64(bits[start])>>uint(8-remaining), uint(remaining))
 	}
 
 	return count
@@ -228,6 +230,33 @@ func (this *DefaultOutputBitStream) flush() error {
 	return nil
 }
 
+// Flush writes all the complete bytes written so far to the underlying stream.
+// The bits of an incomplete last byte (if any) are retained until the next
+// write. If the underlying stream has a Flush method, it is invoked as well.
+func (this *DefaultOutputBitStream) Flush() error {
+	if this.Closed() {
+		return errors.New("Stream closed")
+	}
+
+	// Move complete bytes from 'current' to the buffer
+	for this.availBits <= 56 {
+		this.buffer[this.position] = byte(this.current >> 56)
+		this.position++
+		this.current <<= 8
+		this.availBits += 8
+	}
+
+	if err := this.flush(); err != nil {
+		return err
+	}
+
+	if f, ok := this.os.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
 // Close prevents further writes
 func (this *DefaultOutputBitStream) Close() error {
 	if this.Closed() {
@@ -262,14 +291,33 @@ func (this *DefaultOutputBitStream) Close() error {
 	this.position = 0
 	this.availBits = 0
 	this.written -= 64 // adjust because this.availBits = 0
-	this.buffer = make([]byte, 8)
+
+	// Keep the capacity of the buffer for Reset
+	this.buffer = this.buffer[0:8]
+	return nil
+}
+
+// Reset discards the bits not flushed and starts writing to the provided
+// stream, reusing the buffer
+func (this *DefaultOutputBitStream) Reset(stream io.WriteCloser) error {
+	if stream == nil {
+		return errors.New("Invalid null output stream parameter")
+	}
+
+	this.buffer = this.buffer[0:cap(this.buffer)]
+	this.os = stream
+	this.closed = false
+	this.written = 0
+	this.position = 0
+	this.availBits = 64
+	this.current = 0
 	return nil
 }
 
 // Written returns the number of bits written so far
 func (this *DefaultOutputBitStream) Written() uint64 {
 	// Number of bits flushed + bytes written in memory + bits written in memory
-	return uint64(this.written + int64(this.position<<3) + int64(64-this.availBits))
+	return uint64(this.written + int64(this.position)<<3 + int64(64-this.availBits))
 }
 
 // Closed says whether this stream can be written to
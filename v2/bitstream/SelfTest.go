@@ -0,0 +1,206 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitstream
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// The bitstream layout is platform independent: bits are written MSB first
+// and 64 bit words are stored in big-endian order regardless of the byte
+// order and the word size of the CPU. SelfTest checks it at runtime.
+
+const (
+	_SELF_TEST_OPS         = 4000
+	_SELF_TEST_BUFFER_SIZE = 1024 // small buffer to exercise the flushes
+)
+
+type selfTestOp struct {
+	kind  int // 0: bit, 1: bits, 2: array
+	value uint64
+	count uint
+	array []byte
+}
+
+// refBitWriter writes one bit at a time (reference implementation)
+type refBitWriter struct {
+	buf []byte
+	n   uint64
+}
+
+func (this *refBitWriter) writeBit(bit uint64) {
+	if this.n&7 == 0 {
+		this.buf = append(this.buf, 0)
+	}
+
+	this.buf[len(this.buf)-1] |= byte(bit&1) << (7 - (this.n & 7))
+	this.n++
+}
+
+func (this *refBitWriter) writeBits(value uint64, count uint) {
+	for i := int(count) - 1; i >= 0; i-- {
+		this.writeBit(value >> uint(i))
+	}
+}
+
+// SelfTest checks that the default bitstreams produce the reference bit
+// layout on the current platform and read back the bits written, using
+// bits, values and arrays at every alignment. It returns nil on success or
+// an error describing the first mismatch (with the platform).
+func SelfTest() (err error) {
+	platform := fmt.Sprintf("%s/%s, %d bit int", runtime.GOOS, runtime.GOARCH, strconv.IntSize)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Bitstream self test failed on %s: %v", platform, r)
+		}
+	}()
+
+	ops := selfTestOps()
+	ref := &refBitWriter{}
+	bs := internal.NewBufferStream()
+	obs, err := NewDefaultOutputBitStream(bs, _SELF_TEST_BUFFER_SIZE)
+
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		switch op.kind {
+		case 0:
+			obs.WriteBit(int(op.value))
+			ref.writeBit(op.value)
+		case 1:
+			obs.WriteBits(op.value, op.count)
+			ref.writeBits(op.value, op.count)
+		default:
+			obs.WriteArray(op.array, op.count)
+
+			for i := uint(0); i < op.count; i++ {
+				ref.writeBit(uint64(op.array[i>>3] >> (7 - (i & 7))))
+			}
+		}
+	}
+
+	if obs.Written() != ref.n {
+		return fmt.Errorf("Bitstream self test failed on %s: %d bits written, expected %d", platform, obs.Written(), ref.n)
+	}
+
+	if err = obs.Close(); err != nil {
+		return err
+	}
+
+	output := bs.Bytes()
+
+	if bytes.Equal(output, ref.buf) == false {
+		idx := 0
+
+		for idx < min(len(output), len(ref.buf)) && output[idx] == ref.buf[idx] {
+			idx++
+		}
+
+		return fmt.Errorf("Bitstream self test failed on %s: invalid layout at byte %d", platform, idx)
+	}
+
+	ibs, err := NewDefaultInputBitStream(internal.NewBufferStream(output), _SELF_TEST_BUFFER_SIZE)
+
+	if err != nil {
+		return err
+	}
+
+	for i, op := range ops {
+		switch op.kind {
+		case 0:
+			if v := uint64(ibs.ReadBit()); v != op.value {
+				return fmt.Errorf("Bitstream self test failed on %s: operation %d, read bit %d, expected %d", platform, i, v, op.value)
+			}
+		case 1:
+			if v := ibs.ReadBits(op.count); v != op.value {
+				return fmt.Errorf("Bitstream self test failed on %s: operation %d, read %x, expected %x", platform, i, v, op.value)
+			}
+		default:
+			array := make([]byte, len(op.array))
+			ibs.ReadArray(array, op.count)
+			mask := byte(0xFF << (8 - (op.count & 7)))
+
+			// Compare the full bytes then the bits of the last byte (if any)
+			full := op.count >> 3
+
+			if bytes.Equal(array[0:full], op.array[0:full]) == false ||
+				(op.count&7 != 0 && array[full]&mask != op.array[full]&mask) {
+				return fmt.Errorf("Bitstream self test failed on %s: operation %d, invalid array", platform, i)
+			}
+		}
+	}
+
+	if ibs.Read() != ref.n {
+		return fmt.Errorf("Bitstream self test failed on %s: %d bits read, expected %d", platform, ibs.Read(), ref.n)
+	}
+
+	return ibs.Close()
+}
+
+// selfTestOps returns a deterministic sequence of operations
+func selfTestOps() []selfTestOp {
+	res := make([]selfTestOp, _SELF_TEST_OPS)
+	seed := uint64(0x9E3779B97F4A7C15)
+
+	next := func() uint64 {
+		// xorshift64
+		seed ^= seed << 13
+		seed ^= seed >> 7
+		seed ^= seed << 17
+		return seed
+	}
+
+	for i := range res {
+		r := next()
+
+		switch r % 8 {
+		case 0:
+			res[i] = selfTestOp{kind: 0, value: next() & 1}
+		case 1:
+			// Long arrays (buffer flushes, 256 bit paths)
+			count := uint(next()%(16*_SELF_TEST_BUFFER_SIZE)) + 1
+			array := make([]byte, (count+7)>>3)
+
+			for j := range array {
+				array[j] = byte(next())
+			}
+
+			res[i] = selfTestOp{kind: 2, count: count, array: array}
+		case 2:
+			count := uint(next()%300) + 1
+			array := make([]byte, (count+7)>>3)
+
+			for j := range array {
+				array[j] = byte(next())
+			}
+
+			res[i] = selfTestOp{kind: 2, count: count, array: array}
+		default:
+			count := uint(next()%64) + 1
+			res[i] = selfTestOp{kind: 1, count: count, value: next() >> (64 - count)}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// ANS lanes: with ctx["entropyLanes"] = n (2 to 16), the ANS codecs split
+// the large blocks into up to n lanes made of whole chunks (order 1 chunks
+// are much larger than order 0 chunks), encoded
+// independently so that several jobs (ctx["jobs"]) can code a single block
+// in both directions. The number of lanes only depends on n and the block
+// size (at least _ANS_MIN_LANE_SIZE bytes per lane), not on the jobs.
+// Each block (of more than 32 bytes) starts with the number of lanes minus
+// one (4 bits). A single lane is followed by the chunks as usual, otherwise
+// by the size in bytes of each lane (VarInt) and the lanes, one after the
+// other, each padded to a byte boundary. The decoder expects the lane header
+// if ctx["entropyLanes"] is not 0.
+
+const (
+	_ANS_MAX_LANES     = 16
+	_ANS_MIN_LANE_SIZE = 1 << 18
+	_ANS_LANE_IO_SIZE  = 1 << 27 // max bytes per bitstream array access
+)
+
+// getLanes returns the max number of lanes and the number of jobs in the
+// context
+func getLanes(ctx *map[string]any) (uint, uint) {
+	lanes, jobs := uint(0), uint(1)
+
+	if ctx == nil {
+		return lanes, jobs
+	}
+
+	if val, containsKey := (*ctx)["entropyLanes"]; containsKey {
+		lanes = min(val.(uint), _ANS_MAX_LANES)
+	}
+
+	if val, containsKey := (*ctx)["jobs"]; containsKey {
+		jobs = max(val.(uint), 1)
+	}
+
+	return lanes, jobs
+}
+
+// getLaneSize returns the size of the lanes of a block split in count
+// lanes (the last lanes may be shorter or empty)
+func getLaneSize(length, count, chunkSize int) int {
+	laneSize := (length + count - 1) / count
+	return (laneSize + chunkSize - 1) / chunkSize * chunkSize
+}
+
+// laneBounds returns the start and end of a lane in the block
+func laneBounds(i, laneSize, length int) (int, int) {
+	start := min(i*laneSize, length)
+	return start, min(start+laneSize, length)
+}
+
+// runLanes calls fn for each lane with up to jobs goroutines and raises the
+// first panic of the workers (if any) on the calling goroutine
+func runLanes(count int, jobs uint, fn func(i int)) {
+	workers := min(int(jobs), count)
+
+	if workers <= 1 {
+		for i := 0; i < count; i++ {
+			fn(i)
+		}
+
+		return
+	}
+
+	var wg sync.WaitGroup
+	panics := make([]any, workers)
+
+	for j := 0; j < workers; j++ {
+		wg.Add(1)
+
+		go func(j int) {
+			defer func() {
+				internal.RecoverWorker(panics, j, recover())
+				wg.Done()
+			}()
+
+			for i := j; i < count; i += workers {
+				fn(i)
+			}
+		}(j)
+	}
+
+	wg.Wait()
+	internal.RaiseWorkerPanic(panics)
+}
+
+// writeLanes encodes the block in independent lanes
+func (this *ANSRangeEncoder) writeLanes(block []byte) (int, error) {
+	chunks := (len(block) + this.chunkSize - 1) / this.chunkSize
+	count := min(int(this.lanes), len(block)/_ANS_MIN_LANE_SIZE, chunks)
+
+	if count <= 1 {
+		this.bitstream.WriteBits(0, 4)
+		return this.encodeChunks(block)
+	}
+
+	this.bitstream.WriteBits(uint64(count-1), 4)
+	laneSize := getLaneSize(len(block), count, this.chunkSize)
+	outputs := make([][]byte, count)
+	errs := make([]error, count)
+
+	runLanes(count, this.jobs, func(i int) {
+		start, end := laneBounds(i, laneSize, len(block))
+		bs := internal.NewBufferStream(make([]byte, 0, end-start+(end-start)>>3+1024))
+		obs, _ := bitstream.NewDefaultOutputBitStream(bs, 65536)
+		_, errs[i] = this.newLane(obs).encodeChunks(block[start:end])
+		obs.Close()
+		outputs[i] = bs.Bytes()
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for i := range outputs {
+		WriteVarInt(this.bitstream, uint32(len(outputs[i])))
+	}
+
+	for i := range outputs {
+		for n := 0; n < len(outputs[i]); n += _ANS_LANE_IO_SIZE {
+			chunk := outputs[i][n:min(n+_ANS_LANE_IO_SIZE, len(outputs[i]))]
+			this.bitstream.WriteArray(chunk, uint(8*len(chunk)))
+		}
+	}
+
+	return len(block), nil
+}
+
+// newLane returns an encoder with the same parameters writing to bs
+func (this *ANSRangeEncoder) newLane(bs kanzi.OutputBitStream) *ANSRangeEncoder {
+	dim := int(255*this.order + 1)
+	return &ANSRangeEncoder{bitstream: bs, freqs: make([]int, dim*257), symbols: make([]encSymbol, dim*256),
+		buffer: make([]byte, 0), chunkSize: this.chunkSize, order: this.order, logRange: this.logRange}
+}
+
+// readLanes decodes the lanes of the block
+func (this *ANSRangeDecoder) readLanes(block []byte) (int, error) {
+	count := int(this.bitstream.ReadBits(4)) + 1
+
+	if count == 1 {
+		return this.decodeChunks(block)
+	}
+
+	laneSize := getLaneSize(len(block), count, this.chunkSize)
+	inputs := make([][]byte, count)
+
+	for i := range inputs {
+		sz := int(ReadVarInt(this.bitstream))
+		start, end := laneBounds(i, laneSize, len(block))
+
+		// Protect against corrupted bitstreams (the ANS coded data never
+		// reaches twice the size of the lane)
+		if sz > 2*(end-start)+1024 {
+			return 0, errCorrupted("Invalid bitstream: incorrect size %d for ANS lane %d", sz, i)
+		}
+
+		inputs[i] = make([]byte, sz)
+	}
+
+	for i := range inputs {
+		for n := 0; n < len(inputs[i]); n += _ANS_LANE_IO_SIZE {
+			chunk := inputs[i][n:min(n+_ANS_LANE_IO_SIZE, len(inputs[i]))]
+			this.bitstream.ReadArray(chunk, uint(8*len(chunk)))
+		}
+	}
+
+	errs := make([]error, count)
+
+	runLanes(count, this.jobs, func(i int) {
+		start, end := laneBounds(i, laneSize, len(block))
+
+		if start == end {
+			return
+		}
+
+		ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(inputs[i]), 65536)
+		n, err := this.newLane(ibs).decodeChunks(block[start:end])
+
+		if err == nil && n != end-start {
+			err = errCorrupted("Invalid bitstream: incomplete ANS lane %d", i)
+		}
+
+		errs[i] = err
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(block), nil
+}
+
+// newLane returns a decoder with the same parameters reading from bs
+func (this *ANSRangeDecoder) newLane(bs kanzi.InputBitStream) *ANSRangeDecoder {
+	dim := int(255*this.order + 1)
+	return &ANSRangeDecoder{bitstream: bs, freqs: make([]int, dim*256), symbols: make([]decSymbol, dim*256),
+		f2s: make([]byte, 0), buffer: make([]byte, 0), chunkSize: this.chunkSize, order: this.order,
+		bsVersion: this.bsVersion, logRange: this.logRange}
+}
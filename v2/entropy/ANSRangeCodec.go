@@ -45,6 +45,8 @@ type ANSRangeEncoder struct {
 	chunkSize int
 	order     uint
 	logRange  uint
+	lanes     uint // max number of lanes of a block (see ANSLanes.go)
+	jobs      uint
 }
 
 // NewANSRangeEncoder creates an instance of ANS encoder.
@@ -164,6 +166,7 @@ func NewANSRangeEncoderWithCtx(bs kanzi.OutputBitStream, ctx *map[string]any, ar
 	this.buffer = make([]byte, 0)
 	this.logRange = max(logRange - order, 8)
 	this.chunkSize = int(chkSize)
+	this.lanes, this.jobs = getLanes(ctx)
 	return this, nil
 }
 
@@ -281,6 +284,16 @@ func (this *ANSRangeEncoder) Write(block []byte) (int, error) {
 		return len(block), nil
 	}
 
+	if this.lanes != 0 {
+		// Block split in independent lanes (see ANSLanes.go)
+		return this.writeLanes(block)
+	}
+
+	return this.encodeChunks(block)
+}
+
+// encodeChunks encodes the chunks of the block sequentially
+func (this *ANSRangeEncoder) encodeChunks(block []byte) (int, error) {
 	sizeChunk := this.chunkSize
 	size := min(2*len(block), sizeChunk+(sizeChunk>>3))
 	size = max(size, 65536)
@@ -482,6 +495,8 @@ type ANSRangeDecoder struct {
 	logRange  uint
 	order     uint
 	bsVersion uint
+	lanes     bool // each block starts with a lane header (see ANSLanes.go)
+	jobs      uint
 }
 
 // NewANSRangeDecoder creates an instance of ANS decoder.
@@ -597,6 +612,8 @@ func NewANSRangeDecoderWithCtx(bs kanzi.InputBitStream, ctx *map[string]any, arg
 	this.f2s = make([]byte, 0)
 	this.symbols = make([]decSymbol, dim*256)
 	this.bsVersion = bsVersion
+	lanes, jobs := getLanes(ctx)
+	this.lanes, this.jobs = lanes != 0, jobs
 	return this, nil
 }
 
@@ -605,7 +622,7 @@ func (this *ANSRangeDecoder) decodeHeader(frequencies, alphabet []int) (int, err
 	this.logRange = uint(8 + this.bitstream.ReadBits(3))
 
 	if this.logRange < 8 || this.logRange > 16 {
-		return 0, fmt.Errorf("Invalid bitstream: range = %d (must be in [8..16])", this.logRange)
+		return 0, errCorrupted("Invalid bitstream: range = %d (must be in [8..16])", this.logRange)
 	}
 
 	res := 0
@@ -655,7 +672,7 @@ func (this *ANSRangeDecoder) decodeHeader(frequencies, alphabet []int) (int, err
 			logMax := uint(this.bitstream.ReadBits(llr))
 
 			if 1<<logMax > scale {
-				err := fmt.Errorf("Invalid bitstream: incorrect frequency size %d in ANS range decoder", logMax)
+				err := errCorrupted("Invalid bitstream: incorrect frequency size %d in ANS range decoder", logMax)
 				return alphabetSize, err
 			}
 
@@ -669,7 +686,7 @@ func (this *ANSRangeDecoder) decodeHeader(frequencies, alphabet []int) (int, err
 					freq = int(1 + this.bitstream.ReadBits(logMax))
 
 					if freq <= 0 || freq >= scale {
-						err := fmt.Errorf("Invalid bitstream: incorrect frequency %d for symbol '%d' in ANS range decoder", freq, alphabet[j])
+						err := errCorrupted("Invalid bitstream: incorrect frequency %d for symbol '%d' in ANS range decoder", freq, alphabet[j])
 						return alphabetSize, err
 					}
 				}
@@ -681,7 +698,7 @@ func (this *ANSRangeDecoder) decodeHeader(frequencies, alphabet []int) (int, err
 
 		// Infer first frequency
 		if scale <= sum {
-			err := fmt.Errorf("Invalid bitstream: incorrect frequency %d for symbol '%d' in ANS range decoder", frequencies[alphabet[0]], alphabet[0])
+			err := errCorrupted("Invalid bitstream: incorrect frequency %d for symbol '%d' in ANS range decoder", frequencies[alphabet[0]], alphabet[0])
 			return alphabetSize, err
 		}
 
@@ -722,6 +739,16 @@ func (this *ANSRangeDecoder) Read(block []byte) (int, error) {
 		return len(block), nil
 	}
 
+	if this.lanes == true {
+		// Block split in independent lanes (see ANSLanes.go)
+		return this.readLanes(block)
+	}
+
+	return this.decodeChunks(block)
+}
+
+// decodeChunks decodes the chunks of the block sequentially
+func (this *ANSRangeDecoder) decodeChunks(block []byte) (int, error) {
 	sizeChunk := this.chunkSize
 	end := len(block)
 	var err error
@@ -743,13 +770,17 @@ func (this *ANSRangeDecoder) Read(block []byte) (int, error) {
 				block[i] = byte(alphabet[0])
 			}
 		} else {
+			ok := false
+
 			if this.bsVersion == 1 {
-				this.decodeChunkV1(block[startChunk:endChunk])
+				ok = this.decodeChunkV1(block[startChunk:endChunk])
 			} else {
-				if this.decodeChunkV2(block[startChunk:endChunk]) == false {
-					err = errors.New("Invalid bitstream: incorrect chunk size")
-					break
-				}
+				ok = this.decodeChunkV2(block[startChunk:endChunk])
+			}
+
+			if ok == false {
+				err = errCorrupted("Invalid bitstream: incorrect chunk size")
+				break
 			}
 		}
 
@@ -759,7 +790,8 @@ func (this *ANSRangeDecoder) Read(block []byte) (int, error) {
 	return startChunk, err
 }
 
-func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
+// decodeChunkV1 returns false if the chunk is too small for the block
+func (this *ANSRangeDecoder) decodeChunkV1(block []byte) bool {
 	// Read chunk size
 	sz := ReadVarInt(this.bitstream) & (_ANS_MAX_CHUNK_SIZE - 1)
 
@@ -772,7 +804,7 @@ func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
 	}
 
 	if sz == 0 {
-		return
+		return true
 	}
 
 	// Add some padding
@@ -786,6 +818,7 @@ func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
 	n := 0
 	lr := this.logRange
 	mask := (1 << lr) - 1
+	end := len(this.buffer) - 1 // protect against corrupted bitstream
 
 	if this.order == 0 {
 		freq2sym := this.f2s[0 : mask+1]
@@ -807,12 +840,20 @@ func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
 
 			// Normalize
 			for st1 < _ANS_TOP {
+				if n >= end {
+					return false
+				}
+
 				st1 = (st1 << 8) | int(this.buffer[n])
 				st1 = (st1 << 8) | int(this.buffer[n+1])
 				n += 2
 			}
 
 			for st0 < _ANS_TOP {
+				if n >= end {
+					return false
+				}
+
 				st0 = (st0 << 8) | int(this.buffer[n])
 				st0 = (st0 << 8) | int(this.buffer[n+1])
 				n += 2
@@ -836,6 +877,10 @@ func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
 
 			// Normalize
 			for st0 < _ANS_TOP {
+				if n >= end {
+					return false
+				}
+
 				st0 = (st0 << 8) | int(this.buffer[n])
 				st0 = (st0 << 8) | int(this.buffer[n+1])
 				n += 2
@@ -844,6 +889,8 @@ func (this *ANSRangeDecoder) decodeChunkV1(block []byte) {
 			prv = int(cur)
 		}
 	}
+
+	return true
 }
 
 func (this *ANSRangeDecoder) decodeSymbol(n int, st int, sym decSymbol, mask int) (int, int) {
@@ -878,7 +925,12 @@ func (this *ANSRangeDecoder) decodeChunkV2(block []byte) bool {
 		return true
 	}
 
-	minBufSize := max(2*len(block), 256) // protect against corrupted bitstream
+	// At most 2 bytes per symbol: protect against corrupted bitstream
+	minBufSize := max(2*len(block), 256)
+
+	if int(sz) > minBufSize {
+		return false
+	}
 
 	// Add some padding
 	if len(this.buffer) < minBufSize {
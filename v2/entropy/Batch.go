@@ -0,0 +1,281 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"errors"
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Batch API: entropy code many small independent blocks (EG. records) at
+// once. Each encoded block is self-contained: the size of the original
+// block (VarInt) followed by the coded data, padded to a byte boundary.
+// The codecs without state between calls to Write (Huffman, ANS, Range and
+// None) share one encoder (or decoder) and its tables for the whole batch.
+// The adaptive codecs (FPAQ, CM, TPAQ) use a fresh model for each block.
+// All the encoded blocks share one output buffer.
+// The codec is selected with ctx["entropy"] (EG. "ANS0") and the decoder
+// must be given the same context as the encoder.
+
+const _BATCH_MAX_BLOCK_SIZE = 1 << 28 // max value of a 4 byte VarInt
+
+// EncodeBatch entropy codes each block independently and returns the
+// encoded blocks (slices of a shared buffer) in the same order.
+func EncodeBatch(blocks [][]byte, ctx map[string]any) ([][]byte, error) {
+	eType, shared, err := batchCodec(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+
+	for i, b := range blocks {
+		if len(b) >= _BATCH_MAX_BLOCK_SIZE {
+			return nil, fmt.Errorf("Invalid size for block %d: %d (must be less than %d)", i, len(b), _BATCH_MAX_BLOCK_SIZE)
+		}
+
+		total += len(b) + len(b)>>3 + 16
+	}
+
+	bufStream := internal.NewBufferStream(make([]byte, 0, total))
+	obs, err := bitstream.NewDefaultOutputBitStream(bufStream, 65536)
+
+	if err != nil {
+		return nil, err
+	}
+
+	params := batchContext(ctx)
+	ends := make([]uint64, len(blocks))
+	var ee kanzi.EntropyEncoder
+
+	for i, b := range blocks {
+		WriteVarInt(obs, uint32(len(b)))
+
+		if ee == nil {
+			// Adaptive codecs get a fresh model sized for each block
+			params["blockSize"] = uint(len(b))
+			internal.GetScratch(&params).Reset(uint(len(b)))
+
+			if ee, err = NewEntropyEncoder(obs, params, eType); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err = ee.Write(b); err != nil {
+			ee.Dispose()
+			return nil, fmt.Errorf("Cannot encode block %d: %v", i, err)
+		}
+
+		if shared == false {
+			ee.Dispose()
+			ee = nil
+		}
+
+		// Each block ends on a byte boundary
+		if pad := uint(-obs.Written() & 7); pad != 0 {
+			obs.WriteBits(0, pad)
+		}
+
+		ends[i] = obs.Written() >> 3
+	}
+
+	if ee != nil {
+		ee.Dispose()
+	}
+
+	if err = obs.Close(); err != nil {
+		return nil, err
+	}
+
+	data := bufStream.Bytes()
+	res := make([][]byte, len(blocks))
+	start := uint64(0)
+
+	for i, end := range ends {
+		res[i] = data[start:end:end]
+		start = end
+	}
+
+	return res, nil
+}
+
+// DecodeBatch decodes blocks encoded by EncodeBatch with the same context
+// and returns the original blocks (slices of a shared buffer) in the same
+// order.
+func DecodeBatch(blocks [][]byte, ctx map[string]any) (res [][]byte, err error) {
+	eType, shared, err := batchCodec(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]int, len(blocks))
+	total := 0
+
+	for i, b := range blocks {
+		size, n := readBatchSize(b)
+
+		if n == 0 {
+			return nil, fmt.Errorf("Cannot decode block %d: invalid block size", i)
+		}
+
+		sizes[i] = size
+		total += size
+	}
+
+	var i int
+
+	defer func() {
+		// Corrupted data may make the codecs panic
+		if r := recover(); r != nil {
+			res = nil
+			err = fmt.Errorf("Cannot decode block %d: %v", i, r)
+		}
+	}()
+
+	params := batchContext(ctx)
+	output := make([]byte, total)
+	res = make([][]byte, len(blocks))
+	var ed kanzi.EntropyDecoder
+	var ibs kanzi.InputBitStream
+	var input []byte
+	offset := 0
+
+	if shared == true {
+		// One decoder for all the blocks, laid out as produced by the encoder
+		for _, b := range blocks {
+			input = append(input, b...)
+		}
+
+		if ibs, err = bitstream.NewDefaultInputBitStream(internal.NewBufferStream(input), 65536); err != nil {
+			return nil, err
+		}
+
+		if ed, err = NewEntropyDecoder(ibs, params, eType); err != nil {
+			return nil, err
+		}
+	}
+
+	for i = range blocks {
+		if shared == false {
+			if ibs, err = bitstream.NewDefaultInputBitStream(internal.NewBufferStream(blocks[i]), 65536); err != nil {
+				return nil, err
+			}
+		}
+
+		start := ibs.Read()
+
+		if size := int(ReadVarInt(ibs)); size != sizes[i] {
+			return nil, fmt.Errorf("Cannot decode block %d: invalid block size", i)
+		}
+
+		if shared == false {
+			params["blockSize"] = uint(sizes[i])
+			internal.GetScratch(&params).Reset(uint(sizes[i]))
+
+			if ed, err = NewEntropyDecoder(ibs, params, eType); err != nil {
+				return nil, err
+			}
+		}
+
+		res[i] = output[offset : offset+sizes[i] : offset+sizes[i]]
+		offset += sizes[i]
+
+		if _, err = ed.Read(res[i]); err != nil {
+			return nil, fmt.Errorf("Cannot decode block %d: %v", i, err)
+		}
+
+		if shared == false {
+			ed.Dispose()
+			ibs.Close()
+			continue
+		}
+
+		// Skip the padding and check that the block was entirely consumed
+		if pad := uint(-ibs.Read() & 7); pad != 0 {
+			ibs.ReadBits(pad)
+		}
+
+		if (ibs.Read()-start)>>3 != uint64(len(blocks[i])) {
+			return nil, fmt.Errorf("Cannot decode block %d: invalid block length", i)
+		}
+	}
+
+	if ed != nil && shared == true {
+		ed.Dispose()
+		ibs.Close()
+	}
+
+	return res, nil
+}
+
+// batchCodec returns the entropy type in ctx and true if the codec can be
+// shared by all the blocks.
+func batchCodec(ctx map[string]any) (uint32, bool, error) {
+	name, ok := ctx["entropy"].(string)
+
+	if ok == false {
+		return 0, false, errors.New("Missing entropy codec name in context")
+	}
+
+	eType, err := GetType(name)
+
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch eType {
+	case NONE_TYPE, HUFFMAN_TYPE, ANS0_TYPE, ANS1_TYPE, RANGE_TYPE:
+		return eType, true, nil
+	default:
+		return eType, false, nil
+	}
+}
+
+// batchContext returns a copy of ctx the codecs can modify, with its own
+// block scratch
+func batchContext(ctx map[string]any) map[string]any {
+	res := make(map[string]any, len(ctx)+2)
+
+	for k, v := range ctx {
+		res[k] = v
+	}
+
+	res[internal.SCRATCH_KEY] = &internal.BlockScratch{}
+	return res
+}
+
+// readBatchSize decodes the VarInt block size at the start of data. It
+// returns the size and the number of bytes read (0 if invalid).
+func readBatchSize(data []byte) (int, int) {
+	res := 0
+
+	// Same encoding as ReadVarInt: at most 4 bytes
+	for i := 0; i < len(data) && i < 4; i++ {
+		res |= int(data[i]&0x7F) << (7 * i)
+
+		if data[i] < 0x80 || i == 3 {
+			return res, i + 1
+		}
+	}
+
+	return 0, 0
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"errors"
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Adapter for external block entropy coders (EG. the FSE and Huff0 coders
+// of zstd, see Zstd.go) registered as user defined entropy codecs. The
+// data is split into chunks of at most MaxChunkSize() bytes, each chunk is
+// written as a mode (2 bits) followed by a byte (RLE), the chunk itself
+// (stored) or the size of the coded chunk (VarInt) and the coded bytes.
+
+const (
+	_BLOCK_CODER_STORED = 0
+	_BLOCK_CODER_RLE    = 1
+	_BLOCK_CODER_CODED  = 2
+)
+
+// ErrStoredChunk is returned by BlockCoder.Encode for a chunk that must be
+// stored as is (EG. incompressible)
+var ErrStoredChunk = errors.New("Chunk not coded")
+
+// BlockCoder an external entropy coder of independent chunks of bytes
+type BlockCoder interface {
+	// Encode returns the coded chunk (valid until the next call) or
+	// ErrStoredChunk
+	Encode(src []byte) ([]byte, error)
+
+	// Decode decodes the coded chunk src into dst (the size of dst is the
+	// size of the original chunk)
+	Decode(dst, src []byte) error
+
+	// MaxChunkSize returns the maximum size of a chunk
+	MaxChunkSize() int
+}
+
+// RegisterBlockCoder registers an external block entropy coder as a user
+// defined entropy codec (see Register). The factory is called for each
+// encoder and decoder.
+func RegisterBlockCoder(name string, typeID uint32, factory func(ctx map[string]any) (BlockCoder, error)) error {
+	if factory == nil {
+		return errors.New("Invalid entropy codec: missing constructor")
+	}
+
+	encFactory := func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error) {
+		coder, err := factory(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBlockCoderEncoder(obs, coder)
+	}
+
+	decFactory := func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error) {
+		coder, err := factory(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBlockCoderDecoder(ibs, coder)
+	}
+
+	return Register(name, typeID, encFactory, decFactory)
+}
+
+// BlockCoderEncoder entropy encoder delegating the coding of the chunks to
+// an external block coder
+type BlockCoderEncoder struct {
+	bitstream kanzi.OutputBitStream
+	coder     BlockCoder
+}
+
+// NewBlockCoderEncoder creates a new instance of BlockCoderEncoder
+func NewBlockCoderEncoder(bs kanzi.OutputBitStream, coder BlockCoder) (*BlockCoderEncoder, error) {
+	if coder == nil || coder.MaxChunkSize() <= 0 {
+		return nil, errors.New("Invalid block coder")
+	}
+
+	this := &BlockCoderEncoder{}
+	this.bitstream = bs
+	this.coder = coder
+	return this, nil
+}
+
+// Write encodes the data provided into the bitstream. Return the number of byte
+// written to the bitstream
+func (this *BlockCoderEncoder) Write(block []byte) (int, error) {
+	written := this.bitstream.Written()
+	chunkSize := this.coder.MaxChunkSize()
+
+	for start := 0; start < len(block); start += chunkSize {
+		chunk := block[start:min(start+chunkSize, len(block))]
+
+		if isRun(chunk) == true {
+			this.bitstream.WriteBits(_BLOCK_CODER_RLE, 2)
+			this.bitstream.WriteBits(uint64(chunk[0]), 8)
+			continue
+		}
+
+		coded, err := this.coder.Encode(chunk)
+
+		if err != nil && err != ErrStoredChunk {
+			return 0, err
+		}
+
+		if err == ErrStoredChunk || len(coded) >= len(chunk) {
+			this.bitstream.WriteBits(_BLOCK_CODER_STORED, 2)
+			this.bitstream.WriteArray(chunk, uint(8*len(chunk)))
+			continue
+		}
+
+		this.bitstream.WriteBits(_BLOCK_CODER_CODED, 2)
+		WriteVarInt(this.bitstream, uint32(len(coded)))
+		this.bitstream.WriteArray(coded, uint(8*len(coded)))
+	}
+
+	return int((this.bitstream.Written() - written) >> 3), nil
+}
+
+// BitStream returns the underlying bitstream
+func (this *BlockCoderEncoder) BitStream() kanzi.OutputBitStream {
+	return this.bitstream
+}
+
+// Dispose this implementation does nothing
+func (this *BlockCoderEncoder) Dispose() {
+}
+
+// BlockCoderDecoder entropy decoder delegating the decoding of the chunks
+// to an external block coder
+type BlockCoderDecoder struct {
+	bitstream kanzi.InputBitStream
+	coder     BlockCoder
+	buffer    []byte
+}
+
+// NewBlockCoderDecoder creates a new instance of BlockCoderDecoder
+func NewBlockCoderDecoder(bs kanzi.InputBitStream, coder BlockCoder) (*BlockCoderDecoder, error) {
+	if coder == nil || coder.MaxChunkSize() <= 0 {
+		return nil, errors.New("Invalid block coder")
+	}
+
+	this := &BlockCoderDecoder{}
+	this.bitstream = bs
+	this.coder = coder
+	this.buffer = make([]byte, 0)
+	return this, nil
+}
+
+// Read decodes data from the bitstream and return it in the provided buffer.
+// Return the number of bytes read from the bitstream
+func (this *BlockCoderDecoder) Read(block []byte) (int, error) {
+	read := this.bitstream.Read()
+	chunkSize := this.coder.MaxChunkSize()
+
+	for start := 0; start < len(block); start += chunkSize {
+		chunk := block[start:min(start+chunkSize, len(block))]
+
+		switch mode := this.bitstream.ReadBits(2); mode {
+		case _BLOCK_CODER_STORED:
+			this.bitstream.ReadArray(chunk, uint(8*len(chunk)))
+
+		case _BLOCK_CODER_RLE:
+			val := byte(this.bitstream.ReadBits(8))
+
+			for i := range chunk {
+				chunk[i] = val
+			}
+
+		case _BLOCK_CODER_CODED:
+			size := int(ReadVarInt(this.bitstream))
+
+			if size == 0 || size >= len(chunk) {
+				return 0, errCorrupted("Invalid coded chunk size: %d (chunk size %d)", size, len(chunk))
+			}
+
+			if len(this.buffer) < size {
+				this.buffer = make([]byte, size)
+			}
+
+			this.bitstream.ReadArray(this.buffer[0:size], uint(8*size))
+
+			if err := this.coder.Decode(chunk, this.buffer[0:size]); err != nil {
+				return 0, &corruptedError{msg: fmt.Sprintf("Invalid coded chunk: %v", err)}
+			}
+
+		default:
+			return 0, errCorrupted("Invalid chunk mode: %d", mode)
+		}
+	}
+
+	return int((this.bitstream.Read() - read) >> 3), nil
+}
+
+// BitStream returns the underlying bitstream
+func (this *BlockCoderDecoder) BitStream() kanzi.InputBitStream {
+	return this.bitstream
+}
+
+// Dispose this implementation does nothing
+func (this *BlockCoderDecoder) Dispose() {
+}
+
+// isRun returns true if all the bytes of the chunk are identical
+func isRun(chunk []byte) bool {
+	for i := 1; i < len(chunk); i++ {
+		if chunk[i] != chunk[0] {
+			return false
+		}
+	}
+
+	return true
+}
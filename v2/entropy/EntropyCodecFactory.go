@@ -73,6 +73,10 @@ func NewEntropyDecoder(ibs kanzi.InputBitStream, ctx map[string]any,
 		return NewNullEntropyDecoder(ibs)
 
 	default:
+		if e, ok := findRegistered(entropyType, ""); ok == true {
+			return e.decFactory(ibs, ctx)
+		}
+
 		return nil, fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
 	}
 }
@@ -109,6 +113,10 @@ func NewEntropyEncoder(obs kanzi.OutputBitStream, ctx map[string]any,
 		return NewNullEntropyEncoder(obs)
 
 	default:
+		if e, ok := findRegistered(entropyType, ""); ok == true {
+			return e.encFactory(obs, ctx)
+		}
+
 		return nil, fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
 	}
 }
@@ -145,13 +153,19 @@ func GetName(entropyType uint32) (string, error) {
 		return "NONE", nil
 
 	default:
+		if e, ok := findRegistered(entropyType, ""); ok == true {
+			return e.name, nil
+		}
+
 		return "", fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
 	}
 }
 
 // GetType returns the type of the entropy codec given its name
 func GetType(entropyName string) (uint32, error) {
-	switch strings.ToUpper(entropyName) {
+	entropyName = strings.ToUpper(entropyName)
+
+	switch entropyName {
 
 	case "HUFFMAN":
 		return HUFFMAN_TYPE, nil
@@ -181,6 +195,10 @@ func GetType(entropyName string) (uint32, error) {
 		return NONE_TYPE, nil
 
 	default:
+		if e, ok := findRegistered(0, entropyName); ok == true {
+			return e.typeID, nil
+		}
+
 		return 0, fmt.Errorf("Unsupported entropy codec type: '%v'", entropyName)
 	}
 }
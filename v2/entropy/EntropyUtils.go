@@ -16,6 +16,7 @@ limitations under the License.
 package entropy
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 
@@ -32,6 +33,28 @@ const (
 	_ALPHABET_0       = 1 // Flag for alphabet not with no symbol
 )
 
+// ErrCorrupted matches (errors.Is) the errors returned by the entropy
+// decoders when the content of the bitstream is invalid
+var ErrCorrupted = errors.New("Invalid bitstream: corrupted data")
+
+// corruptedError a decoding error caused by invalid bitstream content
+type corruptedError struct {
+	msg string
+}
+
+func (this *corruptedError) Error() string {
+	return this.msg
+}
+
+func (this *corruptedError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// errCorrupted returns a decoding error matching ErrCorrupted
+func errCorrupted(format string, args ...any) error {
+	return &corruptedError{msg: fmt.Sprintf(format, args...)}
+}
+
 type freqSortData struct {
 	freq   *int
 	symbol int
@@ -91,10 +114,13 @@ func EncodeAlphabet(obs kanzi.OutputBitStream, alphabet []int) (int, error) {
 			masks[alphabet[i]>>3] |= (1 << uint8(alphabet[i]&7))
 		}
 
-		// Encode presence flags
+		// Encode presence flags (byte per byte: no escape of masks)
 		lastMask := alphabet[count-1] >> 3
 		obs.WriteBits(uint64(lastMask), 5)
-		obs.WriteArray(masks[:], 8*uint(lastMask+1))
+
+		for i := 0; i <= lastMask; i++ {
+			obs.WriteBits(uint64(masks[i]), 8)
+		}
 	}
 
 	return count, nil
@@ -127,7 +153,10 @@ func DecodeAlphabet(ibs kanzi.InputBitStream, alphabet []int) (int, error) {
 	lastMask := int(ibs.ReadBits(5))
 	masks := [32]byte{}
 	count := 0
-	ibs.ReadArray(masks[:], 8*uint(lastMask+1))
+
+	for i := 0; i <= lastMask; i++ {
+		masks[i] = byte(ibs.ReadBits(8))
+	}
 
 	// Decode presence flags
 	for i := 0; i <= lastMask; i++ {
@@ -206,3 +206,248 @@ func testEntropyCorrectness(name string) error {
 
 	return error(nil)
 }
+
+func TestBatch(b *testing.T) {
+	fmt.Println("Batch Test")
+	blocks := make([][]byte, 40)
+
+	for i := range blocks {
+		// Empty, tiny and larger blocks with various statistics
+		blocks[i] = make([]byte, (i*i*37)%3000)
+
+		for j := range blocks[i] {
+			blocks[i][j] = byte(65 + rand.Intn(4+i*6))
+		}
+	}
+
+	blocks[7] = blocks[7][0:1]
+
+	for _, name := range []string{"NONE", "HUFFMAN", "ANS0", "ANS1", "RANGE", "FPAQ", "CM", "TPAQ"} {
+		ctx := map[string]any{"entropy": name}
+		encoded, err := EncodeBatch(blocks, ctx)
+
+		if err != nil {
+			b.Fatalf("%s: encoding failed: %v", name, err)
+		}
+
+		// Each block can be decoded on its own
+		single, err := DecodeBatch(encoded[3:4], ctx)
+
+		if err != nil || string(single[0]) != string(blocks[3]) {
+			b.Errorf("%s: single block decoding failed: %v", name, err)
+		}
+
+		decoded, err := DecodeBatch(encoded, ctx)
+
+		if err != nil {
+			b.Fatalf("%s: decoding failed: %v", name, err)
+		}
+
+		size := 0
+
+		for i := range blocks {
+			size += len(encoded[i])
+
+			if string(decoded[i]) != string(blocks[i]) {
+				b.Errorf("%s: block %d: input and inverse are different", name, i)
+			}
+		}
+
+		fmt.Printf("%-8s %d blocks -> %d bytes\n", name, len(blocks), size)
+	}
+
+	if _, err := EncodeBatch(blocks, map[string]any{}); err == nil {
+		b.Errorf("Missing entropy codec: no error reported")
+	}
+}
+
+func TestANSLanes(b *testing.T) {
+	fmt.Println("ANS Lanes Test")
+	block := make([]byte, 5*_ANS_MIN_LANE_SIZE+1234)
+
+	for i := range block {
+		block[i] = byte(65 + rand.Intn(4+(i>>16)))
+	}
+
+	// Order 1 chunks of 256 KB (made of whole chunks, the lanes of order 1
+	// are larger by default)
+	args := [][]uint{{0}, {1, 1024}}
+
+	encode := func(order int, lanes, jobs uint) []byte {
+		bs := internal.NewBufferStream()
+		obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+		ctx := map[string]any{"entropyLanes": lanes, "jobs": jobs}
+		ee, _ := NewANSRangeEncoderWithCtx(obs, &ctx, args[order]...)
+
+		if _, err := ee.Write(block); err != nil {
+			b.Fatalf("Encoding failed: %v", err)
+		}
+
+		ee.Dispose()
+		obs.Close()
+		return bs.Bytes()
+	}
+
+	decode := func(order int, data []byte, jobs uint) (res []byte, err error) {
+		// The bitstream panics when reading past the end of corrupted data
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(data), 16384)
+		ctx := map[string]any{"entropyLanes": uint(1), "jobs": jobs}
+		ed, _ := NewANSRangeDecoderWithCtx(ibs, &ctx, args[order]...)
+		res = make([]byte, len(block))
+		_, err = ed.Read(res)
+		return res, err
+	}
+
+	for order := range args {
+		ref := encode(order, 0, 1)
+
+		for _, lanes := range []uint{2, 4, 16} {
+			// The output does not depend on the number of jobs
+			output := encode(order, lanes, 1)
+
+			if string(encode(order, lanes, 4)) != string(output) {
+				b.Errorf("Order %d, %d lanes: different output with 4 jobs", order, lanes)
+			}
+
+			fmt.Printf("Order %d, %d lanes: %d => %d bytes (%d bytes without lanes)\n", order, lanes, len(block), len(output), len(ref))
+
+			for _, jobs := range []uint{1, 3} {
+				if res, err := decode(order, output, jobs); err != nil || string(res) != string(block) {
+					b.Errorf("Order %d, %d lanes, %d jobs: decoding failed: %v", order, lanes, jobs, err)
+				}
+			}
+		}
+
+		// Corrupted size of the first lane (flipped bits: always a different size)
+		corrupted := encode(order, 4, 1)
+		corrupted[0] ^= 0x07
+
+		if _, err := decode(order, corrupted, 2); err == nil {
+			b.Errorf("Order %d: corrupted lane header: no error", order)
+		}
+	}
+}
+
+// nibbleCoder packs chunks of bytes smaller than 16 (2 per byte)
+type nibbleCoder struct{}
+
+func (this nibbleCoder) Encode(src []byte) ([]byte, error) {
+	res := make([]byte, (len(src)+1)/2)
+
+	for i, b := range src {
+		if b >= 16 {
+			return nil, ErrStoredChunk
+		}
+
+		res[i>>1] |= b << (4 * uint(i&1))
+	}
+
+	return res, nil
+}
+
+func (this nibbleCoder) Decode(dst, src []byte) error {
+	if len(src) != (len(dst)+1)/2 {
+		return errors.New("Invalid chunk size")
+	}
+
+	for i := range dst {
+		dst[i] = (src[i>>1] >> (4 * uint(i&1))) & 0x0F
+	}
+
+	return nil
+}
+
+func (this nibbleCoder) MaxChunkSize() int {
+	return 100
+}
+
+func TestBlockCoder(b *testing.T) {
+	fmt.Println("Block Coder Test")
+	factory := func(ctx map[string]any) (BlockCoder, error) { return nibbleCoder{}, nil }
+
+	if err := RegisterBlockCoder("NIBBLE", USER_TYPE_MIN+3, factory); err != nil {
+		b.Fatalf("Registration failed: %v", err)
+	}
+
+	defer Unregister("NIBBLE")
+
+	if RegisterBlockCoder("NIBBLE2", USER_TYPE_MIN+3, factory) == nil || RegisterBlockCoder("OTHER", USER_TYPE_MIN+4, nil) == nil {
+		b.Errorf("Invalid registration: no error reported")
+	}
+
+	if err := testEntropyCorrectness("NIBBLE"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	// Coded, stored and RLE chunks
+	block := make([]byte, 1000)
+
+	for i := range block {
+		switch (i / 100) % 3 {
+		case 0:
+			block[i] = byte(rand.Intn(16))
+		case 1:
+			block[i] = byte(rand.Intn(256))
+		default:
+			block[i] = 7
+		}
+	}
+
+	bs := internal.NewBufferStream()
+	obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+	ec := getEncoder("NIBBLE", obs)
+
+	if _, err := ec.Write(block); err != nil {
+		b.Fatalf("Encoding failed: %v", err)
+	}
+
+	ec.Dispose()
+	obs.Close()
+	data := bs.Bytes()
+
+	if len(data) >= 800 {
+		b.Errorf("Chunks not coded: %d => %d bytes", len(block), len(data))
+	}
+
+	decode := func(data []byte) ([]byte, error) {
+		ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(data), 16384)
+		ed := getDecoder("NIBBLE", ibs)
+		res := make([]byte, len(block))
+		_, err := ed.Read(res)
+		return res, err
+	}
+
+	if res, err := decode(data); err != nil || string(res) != string(block) {
+		b.Errorf("Decoding failed: %v", err)
+	}
+
+	// Invalid mode of the first chunk
+	corrupted := append([]byte{}, data...)
+	corrupted[0] |= 0xC0
+
+	if _, err := decode(corrupted); errors.Is(err, ErrCorrupted) == false {
+		b.Errorf("Corrupted chunk mode: expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestBlockSize(b *testing.T) {
+	fmt.Println("=== Testing the block size of the codecs ===")
+	scratch := &internal.BlockScratch{Size: 1000}
+
+	// Size in the block scratch only
+	if size, known := BlockSize(map[string]any{internal.SCRATCH_KEY: scratch, "size": uint(12)}); known == false || size != 1000 {
+		b.Errorf("Incorrect block size: %d (%v)", size, known)
+	}
+
+	for _, ctx := range []map[string]any{{}, {"size": uint(1000)}} {
+		if _, known := BlockSize(ctx); known == true {
+			b.Errorf("Unexpected block size")
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// encodeSample returns the encoded data (entropy codec name) and the size of
+// the input
+func encodeSample(name string, data []byte) []byte {
+	bs := internal.NewBufferStream()
+	obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+	ee := getEncoder(name, obs)
+	ee.Write(data)
+	ee.Dispose()
+	obs.Close()
+	return bs.Bytes()
+}
+
+// decodeUntrusted decodes size bytes from data with the entropy codec. The
+// decoder must return ErrCorrupted or succeed, never panic, except at the
+// end of the input (reported by the bitstream, the decoders do not know
+// the size of the encoded data).
+func decodeUntrusted(t *testing.T, name string, data []byte, size int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if strings.Contains(fmt.Sprint(r), "No more data to read") == false {
+				t.Fatalf("%s: panic on corrupted data: %v", name, r)
+			}
+
+			err = nil
+		}
+	}()
+
+	ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(data), 16384)
+	ed := getDecoder(name, ibs)
+	_, err = ed.Read(make([]byte, size))
+
+	if err != nil && errors.Is(err, ErrCorrupted) == false {
+		t.Errorf("%s: expected ErrCorrupted, got %v", name, err)
+	}
+
+	return err
+}
+
+func sampleInputs() [][]byte {
+	res := [][]byte{[]byte(strings.Repeat("entropy decoders must not trust the bitstream. ", 200))}
+	rnd := rand.New(rand.NewSource(7))
+
+	for _, n := range []int{33, 1000, 70000} {
+		b := make([]byte, n)
+
+		for i := range b {
+			b[i] = byte(rnd.Intn(1 + i%64))
+		}
+
+		res = append(res, b)
+	}
+
+	return res
+}
+
+func TestCorruptedStreams(b *testing.T) {
+	fmt.Println("Corrupted Streams Test")
+	rnd := rand.New(rand.NewSource(12345))
+
+	for _, name := range []string{"HUFFMAN", "ANS0", "ANS1", "RANGE"} {
+		detected := 0
+
+		for _, input := range sampleInputs() {
+			encoded := encodeSample(name, input)
+
+			if err := decodeUntrusted(b, name, encoded, len(input)); err != nil {
+				b.Fatalf("%s: cannot decode valid data: %v", name, err)
+			}
+
+			for i := 0; i < 300; i++ {
+				corrupted := append([]byte(nil), encoded...)
+
+				for j := 0; j <= i%4; j++ {
+					corrupted[rnd.Intn(min(len(corrupted), 64+i*8))] ^= byte(1 + rnd.Intn(255))
+				}
+
+				if decodeUntrusted(b, name, corrupted, len(input)) != nil {
+					detected++
+				}
+			}
+		}
+
+		fmt.Printf("%-8s %d corruptions detected\n", name, detected)
+	}
+}
+
+func FuzzDecodeHuffman(f *testing.F) {
+	for _, input := range sampleInputs() {
+		f.Add(uint32(len(input)), encodeSample("HUFFMAN", input))
+	}
+
+	f.Fuzz(func(t *testing.T, size uint32, data []byte) {
+		decodeUntrusted(t, "HUFFMAN", data, int(size&0x3FFFF))
+	})
+}
+
+func FuzzDecodeANS(f *testing.F) {
+	for _, input := range sampleInputs() {
+		f.Add(false, uint32(len(input)), encodeSample("ANS0", input))
+		f.Add(true, uint32(len(input)), encodeSample("ANS1", input))
+	}
+
+	f.Fuzz(func(t *testing.T, order1 bool, size uint32, data []byte) {
+		name := "ANS0"
+
+		if order1 == true {
+			name = "ANS1"
+		}
+
+		decodeUntrusted(t, name, data, int(size&0x3FFFF))
+	})
+}
@@ -613,21 +613,21 @@ func (this *HuffmanDecoder) readLengths() (int, error) {
 	// Decode lengths
 	for _, s := range symbols {
 		if s > 255 {
-			return 0, fmt.Errorf("Invalid bitstream: incorrect Huffman symbol %d", s)
+			return 0, errCorrupted("Invalid bitstream: incorrect Huffman symbol %d", s)
 		}
 
 		this.codes[s] = 0
 		curSize += int8(egdec.DecodeByte())
 
 		if curSize <= 0 || curSize > int8(this.maxSymbolSize) {
-			return 0, fmt.Errorf("Invalid bitstream: incorrect size %d for Huffman symbol %d", curSize, s)
+			return 0, errCorrupted("Invalid bitstream: incorrect size %d for Huffman symbol %d", curSize, s)
 		}
 
 		this.sizes[s] = byte(curSize)
 	}
 
 	if _, err := generateCanonicalCodes(this.sizes[:], this.codes[:], symbols, this.maxSymbolSize); err != nil {
-		return count, err
+		return count, errCorrupted("Invalid bitstream: %v", err)
 	}
 
 	egdec.Dispose()
@@ -711,7 +711,7 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 		}
 
 		if this.buildDecodingTable(alphabetSize) == false {
-			return 0, errors.New("Invalid bitstream: incorrect symbol size")
+			return 0, errCorrupted("Invalid bitstream: incorrect symbol size")
 		}
 
 		if this.isBsVersion3 == true {
@@ -770,7 +770,7 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 					}
 
 					if codeLen >= _HUF_MAX_SYMBOL_SIZE_V3 {
-						panic(errors.New("Invalid bitstream: incorrect Huffman code"))
+						return i, errCorrupted("Invalid bitstream: incorrect Huffman code")
 					}
 				}
 			}
@@ -778,12 +778,17 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 			// bsVersion >= 4
 			// Read number of streams. Only 1 stream supported for now
 			if this.bitstream.ReadBits(2) != 0 {
-				return startChunk, errors.New("Invalid Huffman data: number streams not supported in this version")
+				return startChunk, errCorrupted("Invalid Huffman data: number streams not supported in this version")
 			}
 
 			// Read chunk size
 			szBits := ReadVarInt(this.bitstream)
 
+			// At most maxSymbolSize bits per symbol
+			if uint64(szBits) > uint64(this.maxSymbolSize)*uint64(endChunk-startChunk) {
+				return startChunk, errCorrupted("Invalid bitstream: incorrect Huffman chunk size %d", szBits)
+			}
+
 			// Read compressed data from the bitstream
 			if szBits != 0 {
 				sz := int(szBits+7) >> 3
@@ -803,7 +808,7 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 				idx := 0
 				n := startChunk
 
-				for idx < sz-8 {
+				for idx < sz-8 && n+4 <= endChunk {
 					shift := uint8((56 - bits) & 0xF8)
 					state = (state << shift) | (binary.BigEndian.Uint64(this.buffer[idx:idx+8]) >> 1 >> (63 - shift)) // handle shift = 0
 					idx += int(shift >> 3)
@@ -846,7 +851,7 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 
 					// Sanity check
 					if bits > 64 {
-						return n, errors.New("Invalid bitstream: incorrect symbol size")
+						return n, errCorrupted("Invalid bitstream: incorrect symbol size")
 					}
 
 					var val uint16
@@ -438,7 +438,7 @@ func (this *RangeDecoder) decodeHeader(frequencies []int) (int, error) {
 		logMax := uint(this.bitstream.ReadBits(llr))
 
 		if 1<<logMax > scale {
-			err := fmt.Errorf("Invalid bitstream: incorrect frequency size %v in range decoder", logMax)
+			err := errCorrupted("Invalid bitstream: incorrect frequency size %v in range decoder", logMax)
 			return alphabetSize, err
 		}
 
@@ -452,7 +452,7 @@ func (this *RangeDecoder) decodeHeader(frequencies []int) (int, error) {
 				freq = int(1 + this.bitstream.ReadBits(logMax))
 
 				if freq <= 0 || freq >= scale {
-					err := fmt.Errorf("Invalid bitstream: incorrect frequency %v for symbol '%v' in range decoder", freq, this.alphabet[j])
+					err := errCorrupted("Invalid bitstream: incorrect frequency %v for symbol '%v' in range decoder", freq, this.alphabet[j])
 					return alphabetSize, err
 				}
 			}
@@ -464,7 +464,7 @@ func (this *RangeDecoder) decodeHeader(frequencies []int) (int, error) {
 
 	// Infer first frequency
 	if scale <= sum {
-		err := fmt.Errorf("Invalid bitstream: incorrect frequency %v for symbol '%v' in range decoder", frequencies[this.alphabet[0]], this.alphabet[0])
+		err := errCorrupted("Invalid bitstream: incorrect frequency %v for symbol '%v' in range decoder", frequencies[this.alphabet[0]], this.alphabet[0])
 		return alphabetSize, err
 	}
 
@@ -524,7 +524,13 @@ func (this *RangeDecoder) Read(block []byte) (int, error) {
 		buf := block[startChunk:endChunk]
 
 		for i := range buf {
-			buf[i] = this.decodeByte()
+			b, ok := this.decodeByte()
+
+			if ok == false {
+				return startChunk + i, errCorrupted("Invalid bitstream: incorrect range decoder state")
+			}
+
+			buf[i] = b
 		}
 
 		startChunk = endChunk
@@ -533,10 +539,22 @@ func (this *RangeDecoder) Read(block []byte) (int, error) {
 	return len(block), nil
 }
 
-func (this *RangeDecoder) decodeByte() byte {
+// decodeByte returns the next symbol or false if the decoder state is
+// invalid (corrupted bitstream)
+func (this *RangeDecoder) decodeByte() (byte, bool) {
 	// Compute next low and range
 	this.rng >>= this.shift
-	count := int((this.code - this.low) / this.rng)
+
+	if this.rng == 0 {
+		return 0, false
+	}
+
+	count := (this.code - this.low) / this.rng
+
+	if count >= 1<<this.shift {
+		return 0, false
+	}
+
 	symbol := this.f2s[count]
 	cumFreq := this.cumFreqs[symbol]
 	this.low += (cumFreq * this.rng)
@@ -551,6 +569,10 @@ func (this *RangeDecoder) decodeByte() byte {
 
 			// Normalize
 			this.rng = -this.low & _BOTTOM_RANGE
+
+			if this.rng == 0 {
+				return 0, false
+			}
 		}
 
 		this.code = (this.code << 28) | this.bitstream.ReadBits(28)
@@ -558,7 +580,7 @@ func (this *RangeDecoder) decodeByte() byte {
 		this.low <<= 28
 	}
 
-	return byte(symbol)
+	return byte(symbol), true
 }
 
 // BitStream returns the underlying bitstream
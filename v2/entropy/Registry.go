@@ -0,0 +1,148 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// User defined entropy codecs.
+// Applications can register their own entropy codecs with a name and a
+// type in [USER_TYPE_MIN..USER_TYPE_MAX]. Once registered, a codec can be
+// selected by name (EG. ctx["entropy"]) like the built-in codecs and the
+// type is stored in the bitstream: the decoder must register the same
+// codec with the same type. The size of the block is given by BlockSize.
+// The last two types are reserved for the entropy stages of zstd: the
+// builds with the tag kanzi_zstd register them (see Zstd.go) and they are
+// not available to applications in these builds.
+
+const (
+	USER_TYPE_MIN   = uint32(16)        // first type available for user defined codecs
+	USER_TYPE_MAX   = uint32(31)        // last type available for user defined codecs
+	ZSTD_HUFF0_TYPE = USER_TYPE_MAX - 1 // type of the Huff0 codec of zstd (reserved)
+	ZSTD_FSE_TYPE   = USER_TYPE_MAX     // type of the FSE codec of zstd (reserved)
+)
+
+type registeredCodec struct {
+	name       string
+	typeID     uint32
+	encFactory func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error)
+	decFactory func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error)
+}
+
+var registry = struct {
+	lock    sync.RWMutex
+	entries []registeredCodec
+}{}
+
+// Register adds a user defined entropy codec. The name (case insensitive)
+// and the type must not be used by another codec.
+func Register(name string, typeID uint32,
+	encFactory func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error),
+	decFactory func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error)) error {
+	if encFactory == nil || decFactory == nil {
+		return errors.New("Invalid entropy codec: missing constructor")
+	}
+
+	name = strings.ToUpper(name)
+
+	if name == "" || strings.ContainsAny(name, "+&") {
+		return fmt.Errorf("Invalid entropy codec name: '%s'", name)
+	}
+
+	if typeID < USER_TYPE_MIN || typeID > USER_TYPE_MAX {
+		return fmt.Errorf("Invalid entropy codec type: %d (must be in [%d..%d])", typeID, USER_TYPE_MIN, USER_TYPE_MAX)
+	}
+
+	if _, err := GetType(name); err == nil {
+		return fmt.Errorf("Entropy codec name already used: '%s'", name)
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, e := range registry.entries {
+		if e.name == name {
+			return fmt.Errorf("Entropy codec name already used: '%s'", name)
+		}
+
+		if e.typeID == typeID {
+			return fmt.Errorf("Entropy codec type already used: %d", typeID)
+		}
+	}
+
+	registry.entries = append(registry.entries, registeredCodec{name: name, typeID: typeID,
+		encFactory: encFactory, decFactory: decFactory})
+	return nil
+}
+
+// Unregister removes the user defined entropy codec with the provided name.
+// Returns true if it was found.
+func Unregister(name string) bool {
+	name = strings.ToUpper(name)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for i := range registry.entries {
+		if registry.entries[i].name == name {
+			registry.entries = append(registry.entries[:i], registry.entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// BlockSize returns the size of the block processed by the codec created
+// with the context (false if unknown)
+func BlockSize(ctx map[string]any) (uint, bool) {
+	return internal.GetDataSize(&ctx)
+}
+
+// findRegistered returns the user defined entropy codec with the provided
+// type or name (if not empty)
+func findRegistered(typeID uint32, name string) (registeredCodec, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	for _, e := range registry.entries {
+		if (name == "" && e.typeID == typeID) || (name != "" && e.name == name) {
+			return e, true
+		}
+	}
+
+	return registeredCodec{}, false
+}
+
+// Names returns the names of the available entropy codecs: the built-in
+// ones followed by the registered ones
+func Names() []string {
+	res := []string{"HUFFMAN", "ANS0", "ANS1", "RANGE", "FPAQ", "CM", "TPAQ", "TPAQX"}
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	for _, e := range registry.entries {
+		res = append(res, e.name)
+	}
+
+	return res
+}
@@ -260,8 +260,8 @@ func NewTPAQPredictor(ctx *map[string]any) (*TPAQPredictor, error) {
 		// Actual size of the current block
 		// Too many mixers hurts compression for small blocks.
 		// Too few mixers hurts compression for big blocks.
-		if val, containsKey := (*ctx)["size"]; containsKey {
-			absz = val.(uint)
+		if size, known := internal.GetDataSize(ctx); known == true {
+			absz = size
 		}
 
 		switch s := absz; {
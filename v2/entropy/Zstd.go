@@ -0,0 +1,121 @@
+//go:build kanzi_zstd
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/fse"
+	"github.com/klauspost/compress/huff0"
+)
+
+// Entropy stages of zstd (build tag kanzi_zstd, using the module
+// github.com/klauspost/compress required in go.mod): the Huff0 and FSE
+// coders are registered as user defined entropy codecs "HUFF0" and "FSE"
+// (see BlockCoder.go) to compare them with the kanzi codecs after the
+// same transforms, with the types reserved in Registry.go. Not compatible
+// with zstd streams. The decoder must be built with the same tag.
+
+const (
+	_ZSTD_FSE_MAX_CHUNK_SIZE = (2 << 30) - 1 // input limit of fse.Compress
+)
+
+func init() {
+	RegisterBlockCoder("HUFF0", ZSTD_HUFF0_TYPE, func(ctx map[string]any) (BlockCoder, error) {
+		return &huff0Coder{scratch: &huff0.Scratch{Reuse: huff0.ReusePolicyNone}}, nil
+	})
+
+	RegisterBlockCoder("FSE", ZSTD_FSE_TYPE, func(ctx map[string]any) (BlockCoder, error) {
+		return &fseCoder{scratch: &fse.Scratch{}}, nil
+	})
+}
+
+// huff0Coder Huff0 coder (4 streams), each chunk carrying its own table
+type huff0Coder struct {
+	scratch *huff0.Scratch
+}
+
+func (this *huff0Coder) Encode(src []byte) ([]byte, error) {
+	res, _, err := huff0.Compress4X(src, this.scratch)
+
+	if err == huff0.ErrIncompressible || err == huff0.ErrUseRLE {
+		return nil, ErrStoredChunk
+	}
+
+	return res, err
+}
+
+func (this *huff0Coder) Decode(dst, src []byte) error {
+	s, remaining, err := huff0.ReadTable(src, this.scratch)
+
+	if err != nil {
+		return err
+	}
+
+	this.scratch = s
+	res, err := s.Decoder().Decompress4X(dst[0:0:len(dst)], remaining)
+
+	if err != nil {
+		return err
+	}
+
+	if len(res) != len(dst) {
+		return errors.New("Invalid size of decoded chunk")
+	}
+
+	return nil
+}
+
+func (this *huff0Coder) MaxChunkSize() int {
+	return huff0.BlockSizeMax
+}
+
+// fseCoder FSE coder, each chunk carrying its own table
+type fseCoder struct {
+	scratch *fse.Scratch
+}
+
+func (this *fseCoder) Encode(src []byte) ([]byte, error) {
+	res, err := fse.Compress(src, this.scratch)
+
+	if err == fse.ErrIncompressible || err == fse.ErrUseRLE {
+		return nil, ErrStoredChunk
+	}
+
+	return res, err
+}
+
+func (this *fseCoder) Decode(dst, src []byte) error {
+	this.scratch.DecompressLimit = len(dst)
+	res, err := fse.Decompress(src, this.scratch)
+
+	if err != nil {
+		return err
+	}
+
+	if len(res) != len(dst) {
+		return errors.New("Invalid size of decoded chunk")
+	}
+
+	copy(dst, res)
+	return nil
+}
+
+func (this *fseCoder) MaxChunkSize() int {
+	return _ZSTD_FSE_MAX_CHUNK_SIZE
+}
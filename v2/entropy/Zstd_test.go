@@ -0,0 +1,63 @@
+//go:build kanzi_zstd
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package entropy
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestZstd(b *testing.T) {
+	fmt.Println("Zstd Test")
+
+	for _, name := range []string{"HUFF0", "FSE"} {
+		if err := testEntropyCorrectness(name); err != nil {
+			b.Errorf("%s: %v", name, err)
+		}
+
+		// Several chunks for HUFF0, one for FSE (see MaxChunkSize)
+		block := make([]byte, 600000)
+
+		for i := range block {
+			block[i] = byte(65 + rand.Intn(1+i/20000))
+		}
+
+		bs := internal.NewBufferStream()
+		obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+		ec := getEncoder(name, obs)
+
+		if _, err := ec.Write(block); err != nil {
+			b.Fatalf("%s: encoding failed: %v", name, err)
+		}
+
+		ec.Dispose()
+		obs.Close()
+		fmt.Printf("%s: %d => %d bytes\n", name, len(block), len(bs.Bytes()))
+		ibs, _ := bitstream.NewDefaultInputBitStream(bs, 16384)
+		ed := getDecoder(name, ibs)
+		res := make([]byte, len(block))
+
+		if _, err := ed.Read(res); err != nil || string(res) != string(block) {
+			b.Errorf("%s: decoding failed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flate mirrors the API of compress/flate (and of the constructors
+// of compress/zlib and compress/gzip) on top of kanzi streams, to ease the
+// adoption by code written against the standard compressors. The levels 1
+// to 9 select the same transform and entropy presets as the -l option of
+// the kanzi command. The streams are kanzi bitstreams: they are not
+// compatible with the deflate format.
+package flate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Compression levels (same values as compress/flate)
+const (
+	NoCompression      = 0
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1
+	HuffmanOnly        = -2
+)
+
+// The presets use 1 MB blocks, so that the memory used by a Writer stays
+// bounded whatever the level.
+const _FLATE_BLOCK_SIZE = 1024 * 1024
+
+// presets maps the levels (shifted by 2 for HuffmanOnly and
+// DefaultCompression) to transforms and entropy codecs.
+var presets = [...][2]string{
+	{"NONE", "HUFFMAN"},                   // HuffmanOnly
+	{"TEXT+UTF+PACK+MM+LZX", "HUFFMAN"},   // DefaultCompression (level 3)
+	{"NONE", "NONE"},                      // NoCompression
+	{"PACK+LZ", "NONE"},                   // 1
+	{"DNA+LZ", "HUFFMAN"},                 // 2
+	{"TEXT+UTF+PACK+MM+LZX", "HUFFMAN"},   // 3
+	{"TEXT+UTF+EXE+PACK+MM+ROLZ", "NONE"}, // 4
+	{"TEXT+UTF+BWT+RANK+ZRLT", "ANS0"},    // 5
+	{"TEXT+UTF+BWT+SRT+ZRLT", "FPAQ"},     // 6
+	{"LZP+TEXT+UTF+BWT+LZP", "CM"},        // 7
+	{"EXE+RLT+TEXT+UTF+DNA", "TPAQ"},      // 8
+	{"EXE+RLT+TEXT+UTF+DNA", "TPAQX"},     // 9
+}
+
+// Resetter resets a Reader returned by NewReader or NewReaderDict to read
+// a new stream (same as flate.Resetter).
+type Resetter interface {
+	Reset(r io.Reader, dict []byte) error
+}
+
+// nopCloser prevents the kanzi streams from closing the underlying
+// writer or reader, as required by the compress/flate contract.
+type nopCloser struct {
+	io.Writer
+}
+
+func (this nopCloser) Close() error {
+	return nil
+}
+
+// Writer compresses the data written to it (see flate.Writer)
+type Writer struct {
+	opts   kio.WriterOptions
+	stream *kio.Writer
+}
+
+// NewWriter creates a Writer with the default compression level
+func NewWriter(w io.Writer) *Writer {
+	this, _ := NewWriterDict(w, DefaultCompression, nil)
+	return this
+}
+
+// NewWriterLevel creates a Writer with the provided compression level
+// (DefaultCompression, HuffmanOnly or 0 to 9).
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	return NewWriterDict(w, level, nil)
+}
+
+// NewWriterDict creates a Writer primed with a dictionary. The stream can
+// only be decompressed by a Reader created with the same dictionary.
+func NewWriterDict(w io.Writer, level int, dict []byte) (*Writer, error) {
+	if level < HuffmanOnly || level > BestCompression {
+		return nil, fmt.Errorf("flate: invalid compression level %d: want value in range [-2, 9]", level)
+	}
+
+	opts := kio.WriterOptions{
+		Transform: presets[level-HuffmanOnly][0],
+		Entropy:   presets[level-HuffmanOnly][1],
+		BlockSize: _FLATE_BLOCK_SIZE,
+	}
+
+	if len(dict) > 0 {
+		shared, err := kio.NewSharedContext(dict)
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Shared = shared
+	}
+
+	this := &Writer{opts: opts}
+
+	if err := this.Reset(w); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// Write compresses the provided data
+func (this *Writer) Write(data []byte) (int, error) {
+	return this.stream.Write(data)
+}
+
+// Flush compresses the pending data and writes it to the underlying writer
+// (see kio.Writer.Flush).
+func (this *Writer) Flush() error {
+	return this.stream.Flush()
+}
+
+// Close flushes the pending data and ends the stream. The underlying
+// writer is not closed.
+func (this *Writer) Close() error {
+	return this.stream.Close()
+}
+
+// Reset discards the state of the Writer (without closing the current
+// stream) and starts a new stream on w with the same level and dictionary.
+// The buffers are reused (see kio.Writer.Reset).
+func (this *Writer) Reset(w io.Writer) error {
+	if w == nil {
+		return errors.New("flate: invalid null writer parameter")
+	}
+
+	if this.stream != nil {
+		return this.stream.Reset(nopCloser{w})
+	}
+
+	stream, err := kio.NewWriterWithOptions(nopCloser{w}, this.opts)
+
+	if err != nil {
+		return err
+	}
+
+	this.stream = stream
+	return nil
+}
+
+// Reader decompresses a stream created by a Writer (see flate.NewReader).
+// The underlying reader may be read past the end of the stream.
+type Reader struct {
+	stream *kio.Reader
+	dict   []byte
+	err    error
+}
+
+// NewReader creates a Reader. Errors are reported by Read.
+func NewReader(r io.Reader) io.ReadCloser {
+	return NewReaderDict(r, nil)
+}
+
+// NewReaderDict creates a Reader for a stream created with a dictionary
+func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
+	this := &Reader{}
+	this.Reset(r, dict)
+	return this
+}
+
+// Read decompresses data into the provided buffer
+func (this *Reader) Read(block []byte) (int, error) {
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	return this.stream.Read(block)
+}
+
+// Close releases the resources of the Reader. The underlying reader is not
+// closed.
+func (this *Reader) Close() error {
+	if this.err != nil {
+		return this.err
+	}
+
+	return this.stream.Close()
+}
+
+// Reset discards the state of the Reader and starts reading a new stream
+// from r, created with the provided dictionary (or none if empty).
+func (this *Reader) Reset(r io.Reader, dict []byte) error {
+	if r == nil {
+		this.stream, this.err = nil, errors.New("flate: invalid null reader parameter")
+		return this.err
+	}
+
+	// Same dictionary: the kanzi Reader is reused
+	if this.stream != nil && bytes.Equal(dict, this.dict) == true {
+		this.err = this.stream.Reset(io.NopCloser(r))
+		return this.err
+	}
+
+	this.stream, this.err = nil, nil
+	this.dict = append([]byte(nil), dict...)
+	var opts kio.ReaderOptions
+
+	if len(dict) > 0 {
+		if opts.Shared, this.err = kio.NewSharedContext(dict); this.err != nil {
+			return this.err
+		}
+	}
+
+	this.stream, this.err = kio.NewReaderWithOptions(io.NopCloser(r), opts)
+	return this.err
+}
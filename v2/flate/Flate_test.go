@@ -0,0 +1,131 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flate
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func compress(t *testing.T, w *Writer, data []byte) {
+	t.Helper()
+
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+func decompress(t *testing.T, r io.ReadCloser) []byte {
+	t.Helper()
+	res, err := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	return res
+}
+
+func TestLevels(t *testing.T) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 2000)
+
+	for level := HuffmanOnly; level <= BestCompression; level++ {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+
+		if err != nil {
+			t.Fatalf("Level %d: %v", level, err)
+		}
+
+		compress(t, w, data)
+
+		if level != NoCompression && buf.Len() >= len(data) {
+			t.Errorf("Level %d: no compression (%d bytes)", level, buf.Len())
+		}
+
+		if res := decompress(t, NewReader(&buf)); bytes.Equal(res, data) == false {
+			t.Errorf("Level %d: data mismatch", level)
+		}
+	}
+
+	for _, level := range []int{-3, 10} {
+		if _, err := NewWriterLevel(io.Discard, level); err == nil {
+			t.Errorf("Level %d: missing error", level)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	dict := []byte("a dictionary shared by the writer and the reader")
+	var bufs [2]bytes.Buffer
+	w, err := NewWriterDict(&bufs[0], BestSpeed, dict)
+
+	if err != nil {
+		t.Fatalf("NewWriterDict failed: %v", err)
+	}
+
+	compress(t, w, []byte("first stream"))
+
+	if err := w.Reset(&bufs[1]); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	// Flush makes the data available before Close
+	if _, err := w.Write([]byte("second stream")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if bufs[1].Len() == 0 {
+		t.Errorf("No data after Flush")
+	}
+
+	compress(t, w, nil)
+	r := NewReaderDict(&bufs[0], dict)
+
+	if res := decompress(t, r); string(res) != "first stream" {
+		t.Errorf("Invalid first stream: %q", res)
+	}
+
+	if err := r.(Resetter).Reset(&bufs[1], dict); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	if res := decompress(t, r); string(res) != "second stream" {
+		t.Errorf("Invalid second stream: %q", res)
+	}
+
+	// A stream with a dictionary cannot be read without it
+	bufs[0].Reset()
+	w.Reset(&bufs[0])
+	compress(t, w, []byte("third stream"))
+
+	if _, err := io.ReadAll(NewReader(&bufs[0])); err == nil {
+		t.Errorf("Missing error without dictionary")
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/flanglet/kanzi-go/v2
 
 go 1.21
+
+require github.com/klauspost/compress v1.17.11
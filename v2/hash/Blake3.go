@@ -0,0 +1,244 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Blake3 is a cryptographic hash function designed by Jack O'Connor,
+// Jean-Philippe Aumasson, Samuel Neves and Zooko Wilcox-O'Hearn.
+// Port to Go from the reference implementation: https://github.com/BLAKE3-team/BLAKE3
+// Only the default (unkeyed) mode with a 256 bit output is provided.
+
+const (
+	_BLAKE3_BLOCK_LEN   = 64
+	_BLAKE3_CHUNK_LEN   = 1024
+	_BLAKE3_CHUNK_START = 1
+	_BLAKE3_CHUNK_END   = 2
+	_BLAKE3_PARENT      = 4
+	_BLAKE3_ROOT        = 8
+)
+
+var _BLAKE3_IV = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var _BLAKE3_PERMUTATION = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// Blake3 one shot hash
+type Blake3 struct {
+}
+
+// NewBlake3 creates a new instance of Blake3
+func NewBlake3() (*Blake3, error) {
+	return new(Blake3), nil
+}
+
+// Hash hashes the provided data
+func (this *Blake3) Hash(data []byte) [32]byte {
+	var s Blake3Stream
+	s.Reset()
+	s.Write(data)
+	return s.Sum256()
+}
+
+// Blake3Stream computes the Blake3 hash of data provided in several calls.
+type Blake3Stream struct {
+	cv        [8]uint32 // chaining value of the current chunk
+	block     [_BLAKE3_BLOCK_LEN]byte
+	blockLen  int
+	blocks    int           // compressed blocks in the current chunk
+	chunks    uint64        // completed chunks
+	stack     [54][8]uint32 // chaining values of the subtrees
+	stackSize int
+}
+
+// NewBlake3Stream creates a new instance of Blake3Stream
+func NewBlake3Stream() (*Blake3Stream, error) {
+	this := new(Blake3Stream)
+	this.Reset()
+	return this, nil
+}
+
+// Reset discards the data hashed so far
+func (this *Blake3Stream) Reset() {
+	this.cv = _BLAKE3_IV
+	this.blockLen = 0
+	this.blocks = 0
+	this.chunks = 0
+	this.stackSize = 0
+}
+
+// Write adds data to the hash. Never fails.
+func (this *Blake3Stream) Write(data []byte) (int, error) {
+	res := len(data)
+
+	for len(data) > 0 {
+		// The last block of a chunk is only compressed once it is known
+		// that more data follows (it may be the root block)
+		if this.blockLen == _BLAKE3_BLOCK_LEN {
+			if this.blocks == _BLAKE3_CHUNK_LEN/_BLAKE3_BLOCK_LEN-1 {
+				this.endChunk()
+			} else {
+				this.compressBlock(0)
+			}
+		}
+
+		n := copy(this.block[this.blockLen:], data)
+		this.blockLen += n
+		data = data[n:]
+	}
+
+	return res, nil
+}
+
+func (this *Blake3Stream) chunkFlags() uint32 {
+	if this.blocks == 0 {
+		return _BLAKE3_CHUNK_START
+	}
+
+	return 0
+}
+
+func (this *Blake3Stream) compressBlock(flags uint32) {
+	var m [16]uint32
+	blake3Words(&m, this.block[:])
+	out := blake3Compress(&this.cv, &m, this.chunks, _BLAKE3_BLOCK_LEN, this.chunkFlags()|flags)
+	copy(this.cv[:], out[0:8])
+	this.blocks++
+	this.blockLen = 0
+}
+
+// endChunk compresses the last block of a full chunk and merges the
+// chaining value into the tree (the number of trailing zero bits of the
+// chunk count gives the number of subtrees to merge)
+func (this *Blake3Stream) endChunk() {
+	this.compressBlock(_BLAKE3_CHUNK_END)
+	cv := this.cv
+	this.chunks++
+
+	for total := this.chunks; total&1 == 0; total >>= 1 {
+		this.stackSize--
+		cv = blake3Parent(&this.stack[this.stackSize], &cv, 0)
+	}
+
+	this.stack[this.stackSize] = cv
+	this.stackSize++
+	this.cv = _BLAKE3_IV
+	this.blocks = 0
+}
+
+// Sum256 returns the hash of the data written so far
+func (this *Blake3Stream) Sum256() [32]byte {
+	var m [16]uint32
+	var block [_BLAKE3_BLOCK_LEN]byte
+	copy(block[:], this.block[0:this.blockLen])
+	blake3Words(&m, block[:])
+	flags := this.chunkFlags() | _BLAKE3_CHUNK_END
+	cv := this.cv
+	counter := this.chunks
+	blockLen := uint32(this.blockLen)
+
+	// Merge the subtrees from right to left, the last compression is the root
+	for i := this.stackSize - 1; i >= 0; i-- {
+		out := blake3Compress(&cv, &m, counter, blockLen, flags)
+		copy(cv[:], out[0:8])
+		copy(m[0:8], this.stack[i][:])
+		copy(m[8:16], cv[:])
+		cv = _BLAKE3_IV
+		counter = 0
+		blockLen = _BLAKE3_BLOCK_LEN
+		flags = _BLAKE3_PARENT
+	}
+
+	out := blake3Compress(&cv, &m, counter, blockLen, flags|_BLAKE3_ROOT)
+	var res [32]byte
+
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(res[4*i:], out[i])
+	}
+
+	return res
+}
+
+func blake3Parent(left, right *[8]uint32, flags uint32) [8]uint32 {
+	var m [16]uint32
+	copy(m[0:8], left[:])
+	copy(m[8:16], right[:])
+	iv := _BLAKE3_IV
+	out := blake3Compress(&iv, &m, 0, _BLAKE3_BLOCK_LEN, _BLAKE3_PARENT|flags)
+	var res [8]uint32
+	copy(res[:], out[0:8])
+	return res
+}
+
+func blake3Words(m *[16]uint32, block []byte) {
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+}
+
+func blake3G(s *[16]uint32, a, b, c, d int, x, y uint32) {
+	s[a] += s[b] + x
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + y
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func blake3Compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	var s [16]uint32
+	copy(s[0:8], cv[:])
+	copy(s[8:12], _BLAKE3_IV[0:4])
+	s[12] = uint32(counter)
+	s[13] = uint32(counter >> 32)
+	s[14] = blockLen
+	s[15] = flags
+	m := *block
+
+	for r := 0; r < 7; r++ {
+		blake3G(&s, 0, 4, 8, 12, m[0], m[1])
+		blake3G(&s, 1, 5, 9, 13, m[2], m[3])
+		blake3G(&s, 2, 6, 10, 14, m[4], m[5])
+		blake3G(&s, 3, 7, 11, 15, m[6], m[7])
+		blake3G(&s, 0, 5, 10, 15, m[8], m[9])
+		blake3G(&s, 1, 6, 11, 12, m[10], m[11])
+		blake3G(&s, 2, 7, 8, 13, m[12], m[13])
+		blake3G(&s, 3, 4, 9, 14, m[14], m[15])
+
+		if r < 6 {
+			var p [16]uint32
+
+			for i := range p {
+				p[i] = m[_BLAKE3_PERMUTATION[i]]
+			}
+
+			m = p
+		}
+	}
+
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+
+	return s
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// Input: byte(i % 251), as in the BLAKE3 test vectors
+var _HASH_TEST_VECTORS = []struct {
+	size   int
+	xxh3   string // seed 0
+	xxh3S  string // seed 0x4B414E5A
+	blake3 string
+}{
+	{0, "99aa06d3014798d86001c324468d497f", "a8d44790aa692a2742b3f74ce4ebf702", "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	{1, "a6cd5e9392000f6ac44bdff4074eecdb", "6f737bcc4150781dbd6d29d20d5a7f69", "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+	{3, "e3b55f57945a17cf5f4299fc161c9cbb", "f5a952e9b4d82376ce2ad50eacad34fd", "e1be4d7a8ab5560aa4199eea339849ba8e293d55ca0a81006726d184519e647f"},
+	{8, "e1e4432a62217fe4cfd50c61c8bb98c1", "592fde0589a7de6bf948106da8d2a359", "2351207d04fc16ade43ccab08600939c7c1fa70a5c0aaca76063d04c3228eaeb"},
+	{16, "72950631827607e2842812cc870dcae2", "05002cb468ca82cf1c7a0bfff78a7858", "a6a492965517a830cb75fdb713465aa465f2f098233896fea44c1d98268bf9e3"},
+	{100, "da95ef16fd9566f329b20ba5f03ec01e", "a00c95b31040872bf2c101891e84d68a", "8e2eb1bba3040b8f611a1240a0e111c74b45cfc9caed10b95f6372db1c40b8b5"},
+	{200, "cb0395310643ba0edd97e9af3609d9f5", "1b73e9fac933e5fc1c6b346d778f8a84", "f9c991a91ce818ab00f3bf22cef993a2f8d9ab0206f2b9efcef063bb19046966"},
+	{1024, "d0ac1f7b93bf57b9e5d78bafa45b2aa5", "2317073599366dc25e07286d542a5b4c", "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+	{1025, "2882ebca04ec915ce95c42288f28186e", "bf1ce60e870ec8be8fb65ac74a13c7c9", "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+	{5000, "b92ec02c39d33ce7b418500fc42320ee", "82d0a5aaa6db8183f542ef3ed2176f7f", "ee78d92070de3df1c57c37002abf0a6b1a6589acdeef4d8ffac7cf3d9e8f2836"},
+	{100000, "54182c58bbb1337c42c23aeead96750d", "56f9d46797a397e4aeea612b623deda6", "d93c23eedaf165a7e0be908ba86f1a7a520d568d2d13cde787c8580c5c72cc54"},
+}
+
+func TestStrongHashes(t *testing.T) {
+	fmt.Println("Strong Hashes Test")
+	xxh3, _ := NewXXHash128(0)
+	xxh3S, _ := NewXXHash128(0x4B414E5A)
+	blake3, _ := NewBlake3()
+	xxh3Stream, _ := NewXXHash128Stream(0x4B414E5A)
+	blake3Stream, _ := NewBlake3Stream()
+
+	for _, v := range _HASH_TEST_VECTORS {
+		data := make([]byte, v.size)
+
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+
+		h1 := xxh3.Hash(data)
+		h2 := xxh3S.Hash(data)
+		h3 := blake3.Hash(data)
+
+		if hex.EncodeToString(h1[:]) != v.xxh3 || hex.EncodeToString(h2[:]) != v.xxh3S {
+			t.Errorf("Size %d: invalid XXH3-128 %x %x", v.size, h1, h2)
+		}
+
+		if hex.EncodeToString(h3[:]) != v.blake3 {
+			t.Errorf("Size %d: invalid BLAKE3 %x", v.size, h3)
+		}
+
+		// Streaming: chunks of various sizes
+		xxh3Stream.Reset()
+		blake3Stream.Reset()
+
+		for off, n := 0, 1; off < len(data); n = n*3 + 1 {
+			end := min(off+n, len(data))
+			xxh3Stream.Write(data[off:end])
+			blake3Stream.Write(data[off:end])
+			off = end
+		}
+
+		if xxh3Stream.Sum128() != h2 {
+			t.Errorf("Size %d: invalid streaming XXH3-128", v.size)
+		}
+
+		if blake3Stream.Sum256() != h3 {
+			t.Errorf("Size %d: invalid streaming BLAKE3", v.size)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXHash128 is the 128 bit variant of XXH3, written by Yann Collet.
+// Port to Go from the original source code: https://github.com/Cyan4973/xxHash
+// The digest is returned in the canonical (big endian) representation.
+
+const (
+	_XXH3_STRIPE_LEN        = 64
+	_XXH3_SECRET_SIZE       = 192
+	_XXH3_SECRET_MIN_SIZE   = 136
+	_XXH3_MID_SIZE_MAX      = 240
+	_XXH3_STRIPES_PER_BLOCK = (_XXH3_SECRET_SIZE - _XXH3_STRIPE_LEN) / 8
+	_XXH3_BUFFER_SIZE       = 256
+)
+
+var _XXH3_DEFAULT_SECRET = [_XXH3_SECRET_SIZE]byte{
+	0xb8, 0xfe, 0x6c, 0x39, 0x23, 0xa4, 0x4b, 0xbe, 0x7c, 0x01, 0x81, 0x2c, 0xf7, 0x21, 0xad, 0x1c,
+	0xde, 0xd4, 0x6d, 0xe9, 0x83, 0x90, 0x97, 0xdb, 0x72, 0x40, 0xa4, 0xa4, 0xb7, 0xb3, 0x67, 0x1f,
+	0xcb, 0x79, 0xe6, 0x4e, 0xcc, 0xc0, 0xe5, 0x78, 0x82, 0x5a, 0xd0, 0x7d, 0xcc, 0xff, 0x72, 0x21,
+	0xb8, 0x08, 0x46, 0x74, 0xf7, 0x43, 0x24, 0x8e, 0xe0, 0x35, 0x90, 0xe6, 0x81, 0x3a, 0x26, 0x4c,
+	0x3c, 0x28, 0x52, 0xbb, 0x91, 0xc3, 0x00, 0xcb, 0x88, 0xd0, 0x65, 0x8b, 0x1b, 0x53, 0x2e, 0xa3,
+	0x71, 0x64, 0x48, 0x97, 0xa2, 0x0d, 0xf9, 0x4e, 0x38, 0x19, 0xef, 0x46, 0xa9, 0xde, 0xac, 0xd8,
+	0xa8, 0xfa, 0x76, 0x3f, 0xe3, 0x9c, 0x34, 0x3f, 0xf9, 0xdc, 0xbb, 0xc7, 0xc7, 0x0b, 0x4f, 0x1d,
+	0x8a, 0x51, 0xe0, 0x4b, 0xcd, 0xb4, 0x59, 0x31, 0xc8, 0x9f, 0x7e, 0xc9, 0xd9, 0x78, 0x73, 0x64,
+	0xea, 0xc5, 0xac, 0x83, 0x34, 0xd3, 0xeb, 0xc3, 0xc5, 0x81, 0xa0, 0xff, 0xfa, 0x13, 0x63, 0xeb,
+	0x17, 0x0d, 0xdd, 0x51, 0xb7, 0xf0, 0xda, 0x49, 0xd3, 0x16, 0x55, 0x26, 0x29, 0xd4, 0x68, 0x9e,
+	0x2b, 0x16, 0xbe, 0x58, 0x7d, 0x47, 0xa1, 0xfc, 0x8f, 0xf8, 0xb8, 0xd1, 0x7a, 0xd0, 0x31, 0xce,
+	0x45, 0xcb, 0x3a, 0x8f, 0x95, 0x16, 0x04, 0x28, 0xaf, 0xd7, 0xfb, 0xca, 0xbb, 0x4b, 0x40, 0x7e,
+}
+
+// XXHash128 hash seed and secret derived from the seed
+type XXHash128 struct {
+	seed   uint64
+	secret [_XXH3_SECRET_SIZE]byte
+}
+
+// NewXXHash128 creates a new instance of XXHash128
+func NewXXHash128(seed uint64) (*XXHash128, error) {
+	this := new(XXHash128)
+	this.SetSeed(seed)
+	return this, nil
+}
+
+// SetSeed sets the hash seed
+func (this *XXHash128) SetSeed(seed uint64) {
+	this.seed = seed
+	xxh3InitSecret(this.secret[:], seed)
+}
+
+// Hash hashes the provided data
+func (this *XXHash128) Hash(data []byte) [16]byte {
+	var lo, hi uint64
+
+	if len(data) <= _XXH3_MID_SIZE_MAX {
+		// The short inputs use the default secret and the seed
+		lo, hi = xxh3Hash128Short(data, this.seed, _XXH3_DEFAULT_SECRET[:])
+	} else {
+		acc := xxh3InitAcc()
+		xxh3HashLong(&acc, data, this.secret[:])
+		lo, hi = xxh3Merge128(&acc, this.secret[:], uint64(len(data)))
+	}
+
+	return xxh3Canonical(lo, hi)
+}
+
+// XXHash128Stream computes the 128 bit XXH3 hash of data provided
+// in several calls.
+type XXHash128Stream struct {
+	seed    uint64
+	secret  [_XXH3_SECRET_SIZE]byte
+	acc     [8]uint64
+	buf     [_XXH3_BUFFER_SIZE]byte
+	bufLen  int
+	stripes int
+	total   uint64
+}
+
+// NewXXHash128Stream creates a new instance of XXHash128Stream
+func NewXXHash128Stream(seed uint64) (*XXHash128Stream, error) {
+	this := &XXHash128Stream{seed: seed}
+	xxh3InitSecret(this.secret[:], seed)
+	this.Reset()
+	return this, nil
+}
+
+// Reset discards the data hashed so far
+func (this *XXHash128Stream) Reset() {
+	this.acc = xxh3InitAcc()
+	this.bufLen = 0
+	this.stripes = 0
+	this.total = 0
+}
+
+// Write adds data to the hash. Never fails.
+func (this *XXHash128Stream) Write(data []byte) (int, error) {
+	res := len(data)
+	this.total += uint64(res)
+
+	if this.bufLen+len(data) <= _XXH3_BUFFER_SIZE {
+		this.bufLen += copy(this.buf[this.bufLen:], data)
+		return res, nil
+	}
+
+	if this.bufLen > 0 {
+		n := copy(this.buf[this.bufLen:], data)
+		this.consumeStripes(this.buf[:], _XXH3_BUFFER_SIZE/_XXH3_STRIPE_LEN)
+		data = data[n:]
+		this.bufLen = 0
+	}
+
+	if len(data) > _XXH3_BUFFER_SIZE {
+		n := 0
+
+		for len(data)-n > _XXH3_BUFFER_SIZE {
+			this.consumeStripes(data[n:], _XXH3_BUFFER_SIZE/_XXH3_STRIPE_LEN)
+			n += _XXH3_BUFFER_SIZE
+		}
+
+		// Keep the last stripe consumed for the digest of a short tail
+		copy(this.buf[_XXH3_BUFFER_SIZE-_XXH3_STRIPE_LEN:], data[n-_XXH3_STRIPE_LEN:n])
+		data = data[n:]
+	}
+
+	this.bufLen = copy(this.buf[:], data)
+	return res, nil
+}
+
+func (this *XXHash128Stream) consumeStripes(data []byte, count int) {
+	if _XXH3_STRIPES_PER_BLOCK-this.stripes <= count {
+		n := _XXH3_STRIPES_PER_BLOCK - this.stripes
+		xxh3Accumulate(&this.acc, data, this.secret[8*this.stripes:], n)
+		xxh3Scramble(&this.acc, this.secret[_XXH3_SECRET_SIZE-_XXH3_STRIPE_LEN:])
+		xxh3Accumulate(&this.acc, data[n*_XXH3_STRIPE_LEN:], this.secret[:], count-n)
+		this.stripes = count - n
+	} else {
+		xxh3Accumulate(&this.acc, data, this.secret[8*this.stripes:], count)
+		this.stripes += count
+	}
+}
+
+// Sum128 returns the hash of the data written so far
+func (this *XXHash128Stream) Sum128() [16]byte {
+	if this.total <= _XXH3_MID_SIZE_MAX {
+		lo, hi := xxh3Hash128Short(this.buf[0:this.bufLen], this.seed, _XXH3_DEFAULT_SECRET[:])
+		return xxh3Canonical(lo, hi)
+	}
+
+	// Work on a copy of the state to allow more writes
+	acc := this.acc
+	lastSecret := this.secret[_XXH3_SECRET_SIZE-_XXH3_STRIPE_LEN-7:]
+
+	if this.bufLen >= _XXH3_STRIPE_LEN {
+		state := *this
+		state.consumeStripes(this.buf[:], (this.bufLen-1)/_XXH3_STRIPE_LEN)
+		acc = state.acc
+		xxh3Accumulate512(&acc, this.buf[this.bufLen-_XXH3_STRIPE_LEN:], lastSecret)
+	} else {
+		// The last stripe overlaps the previous buffer
+		var last [_XXH3_STRIPE_LEN]byte
+		n := copy(last[:], this.buf[_XXH3_BUFFER_SIZE-(_XXH3_STRIPE_LEN-this.bufLen):])
+		copy(last[n:], this.buf[0:this.bufLen])
+		xxh3Accumulate512(&acc, last[:], lastSecret)
+	}
+
+	lo, hi := xxh3Merge128(&acc, this.secret[:], this.total)
+	return xxh3Canonical(lo, hi)
+}
+
+func xxh3InitAcc() [8]uint64 {
+	return [8]uint64{
+		uint64(_XXHASH_PRIME32_3), _XXHASH_PRIME64_1, _XXHASH_PRIME64_2, _XXHASH_PRIME64_3,
+		_XXHASH_PRIME64_4, uint64(_XXHASH_PRIME32_2), _XXHASH_PRIME64_5, uint64(_XXHASH_PRIME32_1),
+	}
+}
+
+func xxh3InitSecret(secret []byte, seed uint64) {
+	for i := 0; i < _XXH3_SECRET_SIZE; i += 16 {
+		lo := binary.LittleEndian.Uint64(_XXH3_DEFAULT_SECRET[i:]) + seed
+		hi := binary.LittleEndian.Uint64(_XXH3_DEFAULT_SECRET[i+8:]) - seed
+		binary.LittleEndian.PutUint64(secret[i:], lo)
+		binary.LittleEndian.PutUint64(secret[i+8:], hi)
+	}
+}
+
+func xxh3Canonical(lo, hi uint64) [16]byte {
+	var res [16]byte
+	binary.BigEndian.PutUint64(res[0:8], hi)
+	binary.BigEndian.PutUint64(res[8:16], lo)
+	return res
+}
+
+func xxh3Accumulate512(acc *[8]uint64, data, secret []byte) {
+	for i := 0; i < 8; i++ {
+		val := binary.LittleEndian.Uint64(data[8*i:])
+		key := val ^ binary.LittleEndian.Uint64(secret[8*i:])
+		acc[i^1] += val
+		acc[i] += (key & 0xFFFFFFFF) * (key >> 32)
+	}
+}
+
+func xxh3Accumulate(acc *[8]uint64, data, secret []byte, stripes int) {
+	for i := 0; i < stripes; i++ {
+		xxh3Accumulate512(acc, data[i*_XXH3_STRIPE_LEN:], secret[8*i:])
+	}
+}
+
+func xxh3Scramble(acc *[8]uint64, secret []byte) {
+	for i := 0; i < 8; i++ {
+		a := acc[i] ^ (acc[i] >> 47) ^ binary.LittleEndian.Uint64(secret[8*i:])
+		acc[i] = a * uint64(_XXHASH_PRIME32_1)
+	}
+}
+
+func xxh3HashLong(acc *[8]uint64, data, secret []byte) {
+	blockLen := _XXH3_STRIPE_LEN * _XXH3_STRIPES_PER_BLOCK
+	blocks := (len(data) - 1) / blockLen
+
+	for i := 0; i < blocks; i++ {
+		xxh3Accumulate(acc, data[i*blockLen:], secret, _XXH3_STRIPES_PER_BLOCK)
+		xxh3Scramble(acc, secret[_XXH3_SECRET_SIZE-_XXH3_STRIPE_LEN:])
+	}
+
+	stripes := ((len(data) - 1) - blockLen*blocks) / _XXH3_STRIPE_LEN
+	xxh3Accumulate(acc, data[blocks*blockLen:], secret, stripes)
+	xxh3Accumulate512(acc, data[len(data)-_XXH3_STRIPE_LEN:], secret[_XXH3_SECRET_SIZE-_XXH3_STRIPE_LEN-7:])
+}
+
+func xxh3Merge128(acc *[8]uint64, secret []byte, length uint64) (uint64, uint64) {
+	lo := xxh3MergeAccs(acc, secret[11:], length*_XXHASH_PRIME64_1)
+	hi := xxh3MergeAccs(acc, secret[_XXH3_SECRET_SIZE-64-11:], ^(length * _XXHASH_PRIME64_2))
+	return lo, hi
+}
+
+func xxh3MergeAccs(acc *[8]uint64, secret []byte, res uint64) uint64 {
+	for i := 0; i < 4; i++ {
+		res += xxh3Mul128Fold64(acc[2*i]^binary.LittleEndian.Uint64(secret[16*i:]),
+			acc[2*i+1]^binary.LittleEndian.Uint64(secret[16*i+8:]))
+	}
+
+	return xxh3Avalanche(res)
+}
+
+func xxh3Mul128Fold64(x, y uint64) uint64 {
+	hi, lo := bits.Mul64(x, y)
+	return hi ^ lo
+}
+
+func xxh3Avalanche(h uint64) uint64 {
+	h ^= h >> 37
+	h *= 0x165667919E3779F9
+	return h ^ (h >> 32)
+}
+
+func xxh64Avalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= _XXHASH_PRIME64_2
+	h ^= h >> 29
+	h *= _XXHASH_PRIME64_3
+	return h ^ (h >> 32)
+}
+
+func xxh3Mix16(data, secret []byte, seed uint64) uint64 {
+	lo := binary.LittleEndian.Uint64(data[0:8]) ^ (binary.LittleEndian.Uint64(secret[0:8]) + seed)
+	hi := binary.LittleEndian.Uint64(data[8:16]) ^ (binary.LittleEndian.Uint64(secret[8:16]) - seed)
+	return xxh3Mul128Fold64(lo, hi)
+}
+
+func xxh3Mix32(lo, hi uint64, data1, data2, secret []byte, seed uint64) (uint64, uint64) {
+	lo += xxh3Mix16(data1, secret[0:16], seed)
+	lo ^= binary.LittleEndian.Uint64(data2[0:8]) + binary.LittleEndian.Uint64(data2[8:16])
+	hi += xxh3Mix16(data2, secret[16:32], seed)
+	hi ^= binary.LittleEndian.Uint64(data1[0:8]) + binary.LittleEndian.Uint64(data1[8:16])
+	return lo, hi
+}
+
+// xxh3Hash128Short hashes inputs up to _XXH3_MID_SIZE_MAX bytes
+func xxh3Hash128Short(data []byte, seed uint64, secret []byte) (uint64, uint64) {
+	length := len(data)
+
+	if length == 0 {
+		flipLo := binary.LittleEndian.Uint64(secret[64:]) ^ binary.LittleEndian.Uint64(secret[72:])
+		flipHi := binary.LittleEndian.Uint64(secret[80:]) ^ binary.LittleEndian.Uint64(secret[88:])
+		return xxh64Avalanche(seed ^ flipLo), xxh64Avalanche(seed ^ flipHi)
+	}
+
+	if length <= 3 {
+		c1, c2, c3 := uint32(data[0]), uint32(data[length>>1]), uint32(data[length-1])
+		inLo := c1<<16 | c2<<24 | c3 | uint32(length)<<8
+		inHi := bits.RotateLeft32(bits.ReverseBytes32(inLo), 13)
+		flipLo := uint64(binary.LittleEndian.Uint32(secret[0:])^binary.LittleEndian.Uint32(secret[4:])) + seed
+		flipHi := uint64(binary.LittleEndian.Uint32(secret[8:])^binary.LittleEndian.Uint32(secret[12:])) - seed
+		return xxh64Avalanche(uint64(inLo) ^ flipLo), xxh64Avalanche(uint64(inHi) ^ flipHi)
+	}
+
+	if length <= 8 {
+		seed ^= uint64(bits.ReverseBytes32(uint32(seed))) << 32
+		in64 := uint64(binary.LittleEndian.Uint32(data[0:])) + uint64(binary.LittleEndian.Uint32(data[length-4:]))<<32
+		flip := (binary.LittleEndian.Uint64(secret[16:]) ^ binary.LittleEndian.Uint64(secret[24:])) + seed
+		hi, lo := bits.Mul64(in64^flip, _XXHASH_PRIME64_1+uint64(length)<<2)
+		hi += lo << 1
+		lo ^= hi >> 3
+		lo ^= lo >> 35
+		lo *= 0x9FB21C651E98DF25
+		lo ^= lo >> 28
+		return lo, xxh3Avalanche(hi)
+	}
+
+	if length <= 16 {
+		flipLo := (binary.LittleEndian.Uint64(secret[32:]) ^ binary.LittleEndian.Uint64(secret[40:])) - seed
+		flipHi := (binary.LittleEndian.Uint64(secret[48:]) ^ binary.LittleEndian.Uint64(secret[56:])) + seed
+		inLo := binary.LittleEndian.Uint64(data[0:])
+		inHi := binary.LittleEndian.Uint64(data[length-8:])
+		mulHi, mulLo := bits.Mul64(inLo^inHi^flipLo, _XXHASH_PRIME64_1)
+		mulLo += uint64(length-1) << 54
+		inHi ^= flipHi
+		mulHi += inHi + uint64(uint32(inHi))*uint64(_XXHASH_PRIME32_2-1)
+		mulLo ^= bits.ReverseBytes64(mulHi)
+		resHi, resLo := bits.Mul64(mulLo, _XXHASH_PRIME64_2)
+		resHi += mulHi * _XXHASH_PRIME64_2
+		return xxh3Avalanche(resLo), xxh3Avalanche(resHi)
+	}
+
+	lo := uint64(length) * _XXHASH_PRIME64_1
+	hi := uint64(0)
+
+	if length <= 128 {
+		if length > 32 {
+			if length > 64 {
+				if length > 96 {
+					lo, hi = xxh3Mix32(lo, hi, data[48:], data[length-64:], secret[96:], seed)
+				}
+
+				lo, hi = xxh3Mix32(lo, hi, data[32:], data[length-48:], secret[64:], seed)
+			}
+
+			lo, hi = xxh3Mix32(lo, hi, data[16:], data[length-32:], secret[32:], seed)
+		}
+
+		lo, hi = xxh3Mix32(lo, hi, data, data[length-16:], secret, seed)
+	} else {
+		rounds := length / 32
+
+		for i := 0; i < 4; i++ {
+			lo, hi = xxh3Mix32(lo, hi, data[32*i:], data[32*i+16:], secret[32*i:], seed)
+		}
+
+		lo = xxh3Avalanche(lo)
+		hi = xxh3Avalanche(hi)
+
+		for i := 4; i < rounds; i++ {
+			lo, hi = xxh3Mix32(lo, hi, data[32*i:], data[32*i+16:], secret[3+32*(i-4):], seed)
+		}
+
+		lo, hi = xxh3Mix32(lo, hi, data[length-16:], data[length-32:], secret[_XXH3_SECRET_MIN_SIZE-17-16:], -seed)
+	}
+
+	resLo := xxh3Avalanche(lo + hi)
+	resHi := -xxh3Avalanche(lo*_XXHASH_PRIME64_1 + hi*_XXHASH_PRIME64_4 + (uint64(length)-seed)*_XXHASH_PRIME64_2)
+	return resLo, resHi
+}
@@ -69,18 +69,106 @@ func (this *XXHash64) Hash(data []byte) uint64 {
 			n += 32
 		}
 
-		h64 = ((v1 << 1) | (v1 >> 31)) + ((v2 << 7) | (v2 >> 25)) +
-			((v3 << 12) | (v3 >> 20)) + ((v4 << 18) | (v4 >> 14))
-
-		h64 = xxHash64MergeRound(h64, v1)
-		h64 = xxHash64MergeRound(h64, v2)
-		h64 = xxHash64MergeRound(h64, v3)
-		h64 = xxHash64MergeRound(h64, v4)
+		h64 = xxHash64Merge(v1, v2, v3, v4)
 	} else {
 		h64 = this.seed + _XXHASH_PRIME64_5
 	}
 
 	h64 += uint64(end)
+	return xxHash64Finalize(h64, data[n:end])
+}
+
+// XXHash64Stream computes the same hash as XXHash64 over data provided
+// in several calls.
+type XXHash64Stream struct {
+	seed   uint64
+	v1     uint64
+	v2     uint64
+	v3     uint64
+	v4     uint64
+	total  uint64
+	buf    [32]byte
+	bufLen int
+}
+
+// NewXXHash64Stream creates a new instance of XXHash64Stream
+func NewXXHash64Stream(seed uint64) (*XXHash64Stream, error) {
+	this := &XXHash64Stream{seed: seed}
+	this.Reset()
+	return this, nil
+}
+
+// Reset discards the data hashed so far
+func (this *XXHash64Stream) Reset() {
+	this.v1 = this.seed + _XXHASH_PRIME64_1 + _XXHASH_PRIME64_2
+	this.v2 = this.seed + _XXHASH_PRIME64_2
+	this.v3 = this.seed
+	this.v4 = this.seed - _XXHASH_PRIME64_1
+	this.total = 0
+	this.bufLen = 0
+}
+
+// Write adds data to the hash. Never fails.
+func (this *XXHash64Stream) Write(data []byte) (int, error) {
+	res := len(data)
+	this.total += uint64(res)
+
+	if this.bufLen+len(data) < 32 {
+		this.bufLen += copy(this.buf[this.bufLen:], data)
+		return res, nil
+	}
+
+	if this.bufLen > 0 {
+		n := copy(this.buf[this.bufLen:], data)
+		this.update(this.buf[:])
+		data = data[n:]
+		this.bufLen = 0
+	}
+
+	for len(data) >= 32 {
+		this.update(data[0:32])
+		data = data[32:]
+	}
+
+	this.bufLen = copy(this.buf[:], data)
+	return res, nil
+}
+
+func (this *XXHash64Stream) update(buf []byte) {
+	this.v1 = xxHash64Round(this.v1, binary.LittleEndian.Uint64(buf[0:8]))
+	this.v2 = xxHash64Round(this.v2, binary.LittleEndian.Uint64(buf[8:16]))
+	this.v3 = xxHash64Round(this.v3, binary.LittleEndian.Uint64(buf[16:24]))
+	this.v4 = xxHash64Round(this.v4, binary.LittleEndian.Uint64(buf[24:32]))
+}
+
+// Sum64 returns the hash of the data written so far
+func (this *XXHash64Stream) Sum64() uint64 {
+	var h64 uint64
+
+	if this.total >= 32 {
+		h64 = xxHash64Merge(this.v1, this.v2, this.v3, this.v4)
+	} else {
+		h64 = this.seed + _XXHASH_PRIME64_5
+	}
+
+	h64 += this.total
+	return xxHash64Finalize(h64, this.buf[0:this.bufLen])
+}
+
+func xxHash64Merge(v1, v2, v3, v4 uint64) uint64 {
+	h64 := ((v1 << 1) | (v1 >> 31)) + ((v2 << 7) | (v2 >> 25)) +
+		((v3 << 12) | (v3 >> 20)) + ((v4 << 18) | (v4 >> 14))
+
+	h64 = xxHash64MergeRound(h64, v1)
+	h64 = xxHash64MergeRound(h64, v2)
+	h64 = xxHash64MergeRound(h64, v3)
+	return xxHash64MergeRound(h64, v4)
+}
+
+// xxHash64Finalize hashes the remaining bytes (less than 32)
+func xxHash64Finalize(h64 uint64, data []byte) uint64 {
+	end := len(data)
+	n := 0
 
 	for n+8 <= end {
 		h64 ^= xxHash64Round(0, binary.LittleEndian.Uint64(data[n:n+8]))
@@ -0,0 +1,132 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	_POOL_MIN_CLASS = 10 // 1 KB
+	_POOL_MAX_CLASS = 30 // 1 GB (elements)
+)
+
+// BufferPool recycles scratch buffers (grouped by size class, a power of 2)
+// to avoid allocating new ones for each block. Long running processes that
+// compress many blocks put much less pressure on the garbage collector.
+// The content of a buffer returned by Get is undefined.
+// The slice headers stored in the pools are recycled as well so that the
+// steady state of Get and Put does not allocate.
+type BufferPool struct {
+	bytes        [_POOL_MAX_CLASS + 1]sync.Pool
+	ints         [_POOL_MAX_CLASS + 1]sync.Pool
+	bytesHeaders sync.Pool // *[]byte not in use
+	intsHeaders  sync.Pool // *[]int32 not in use
+}
+
+// DefaultBufferPool is the pool shared by the compression tasks and transforms
+var DefaultBufferPool = &BufferPool{}
+
+// sizeClass returns the size class of a buffer of n elements or -1 if
+// such a buffer is not pooled.
+func sizeClass(n int) int {
+	if n <= 1<<_POOL_MIN_CLASS {
+		return _POOL_MIN_CLASS
+	}
+
+	c := bits.Len(uint(n - 1))
+
+	if c > _POOL_MAX_CLASS {
+		return -1
+	}
+
+	return c
+}
+
+// GetBytes returns a byte slice of length n
+func (this *BufferPool) GetBytes(n int) []byte {
+	c := sizeClass(n)
+
+	if c < 0 {
+		return make([]byte, n)
+	}
+
+	if p, ok := this.bytes[c].Get().(*[]byte); ok {
+		res := (*p)[0:n]
+		*p = nil
+		this.bytesHeaders.Put(p)
+		return res
+	}
+
+	return make([]byte, n, 1<<c)
+}
+
+// PutBytes makes a slice obtained with GetBytes available for reuse.
+// The slice must not be used after this call.
+func (this *BufferPool) PutBytes(buf []byte) {
+	c := sizeClass(cap(buf))
+
+	if c < 0 || cap(buf) != 1<<c {
+		return
+	}
+
+	p, ok := this.bytesHeaders.Get().(*[]byte)
+
+	if ok == false {
+		p = new([]byte)
+	}
+
+	*p = buf[0:0]
+	this.bytes[c].Put(p)
+}
+
+// GetInts returns an int32 slice of length n
+func (this *BufferPool) GetInts(n int) []int32 {
+	c := sizeClass(n)
+
+	if c < 0 {
+		return make([]int32, n)
+	}
+
+	if p, ok := this.ints[c].Get().(*[]int32); ok {
+		res := (*p)[0:n]
+		*p = nil
+		this.intsHeaders.Put(p)
+		return res
+	}
+
+	return make([]int32, n, 1<<c)
+}
+
+// PutInts makes a slice obtained with GetInts available for reuse.
+// The slice must not be used after this call.
+func (this *BufferPool) PutInts(buf []int32) {
+	c := sizeClass(cap(buf))
+
+	if c < 0 || cap(buf) != 1<<c {
+		return
+	}
+
+	p, ok := this.intsHeaders.Get().(*[]int32)
+
+	if ok == false {
+		p = new([]int32)
+	}
+
+	*p = buf[0:0]
+	this.ints[c].Put(p)
+}
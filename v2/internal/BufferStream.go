@@ -39,6 +39,13 @@ func NewBufferStream(args ...[]byte) *BufferStream {
 	return this
 }
 
+// Reset discards the content of the stream and reopens it with buf as the
+// internal buffer (no allocation)
+func (this *BufferStream) Reset(buf []byte) {
+	*this.buf = *bytes.NewBuffer(buf)
+	this.closed = false
+}
+
 // Write returns an error if the stream is closed, otherwise writes the given
 // data to the internal buffer (growing the buffer as needed).
 // Returns the number of bytes written.
@@ -72,6 +79,12 @@ func (this *BufferStream) Len() int {
 	return this.buf.Len()
 }
 
+// Bytes returns the unread portion of the internal buffer. The slice
+// is only valid until the next modification of the stream.
+func (this *BufferStream) Bytes() []byte {
+	return this.buf.Bytes()
+}
+
 // Available returns the number of bytes available for read
 func (this *BufferStream) Available() int {
 	if this.closed == true {
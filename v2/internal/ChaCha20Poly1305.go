@@ -0,0 +1,275 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// ChaCha20-Poly1305 AEAD as described in RFC 8439 (the standard library
+// does not provide it and the default build of the module has no external
+// dependency). See ChaCha20Poly1305_test.go for the RFC test vectors.
+
+const (
+	CHACHA20_POLY1305_KEY_SIZE   = 32
+	CHACHA20_POLY1305_NONCE_SIZE = 12
+	CHACHA20_POLY1305_TAG_SIZE   = 16
+)
+
+type chaCha20Poly1305 struct {
+	key [8]uint32
+}
+
+// NewChaCha20Poly1305 creates a ChaCha20-Poly1305 AEAD using a 32 byte key.
+// The AEAD is safe for concurrent use.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	if len(key) != CHACHA20_POLY1305_KEY_SIZE {
+		return nil, errors.New("ChaCha20-Poly1305: invalid key size")
+	}
+
+	this := &chaCha20Poly1305{}
+
+	for i := range this.key {
+		this.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+
+	return this, nil
+}
+
+func (this *chaCha20Poly1305) NonceSize() int {
+	return CHACHA20_POLY1305_NONCE_SIZE
+}
+
+func (this *chaCha20Poly1305) Overhead() int {
+	return CHACHA20_POLY1305_TAG_SIZE
+}
+
+// Seal encrypts and authenticates plaintext and appends the result to dst
+func (this *chaCha20Poly1305) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != CHACHA20_POLY1305_NONCE_SIZE {
+		panic("ChaCha20-Poly1305: invalid nonce size")
+	}
+
+	res, out := sliceForAppend(dst, len(plaintext)+CHACHA20_POLY1305_TAG_SIZE)
+	ct := out[0:len(plaintext)]
+	var polyKey [64]byte
+	this.xorKeyStream(polyKey[:], polyKey[:], nonce, 0)
+	this.xorKeyStream(ct, plaintext, nonce, 1)
+	tag := poly1305Tag(polyKey[0:32], additionalData, ct)
+	copy(out[len(plaintext):], tag[:])
+	return res
+}
+
+// Open authenticates and decrypts ciphertext and appends the result to dst
+func (this *chaCha20Poly1305) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != CHACHA20_POLY1305_NONCE_SIZE {
+		panic("ChaCha20-Poly1305: invalid nonce size")
+	}
+
+	if len(ciphertext) < CHACHA20_POLY1305_TAG_SIZE {
+		return nil, errors.New("ChaCha20-Poly1305: message authentication failed")
+	}
+
+	ct := ciphertext[0 : len(ciphertext)-CHACHA20_POLY1305_TAG_SIZE]
+	var polyKey [64]byte
+	this.xorKeyStream(polyKey[:], polyKey[:], nonce, 0)
+	tag := poly1305Tag(polyKey[0:32], additionalData, ct)
+
+	if subtle.ConstantTimeCompare(tag[:], ciphertext[len(ct):]) != 1 {
+		return nil, errors.New("ChaCha20-Poly1305: message authentication failed")
+	}
+
+	res, out := sliceForAppend(dst, len(ct))
+	this.xorKeyStream(out, ct, nonce, 1)
+	return res, nil
+}
+
+// sliceForAppend extends dst by n bytes and returns the whole slice and
+// the extension
+func sliceForAppend(dst []byte, n int) ([]byte, []byte) {
+	total := len(dst) + n
+
+	if cap(dst) >= total {
+		res := dst[0:total]
+		return res, res[len(dst):]
+	}
+
+	res := make([]byte, total)
+	copy(res, dst)
+	return res, res[len(dst):]
+}
+
+// xorKeyStream xors src with the ChaCha20 key stream starting at block
+// counter. Dst and src may overlap exactly.
+func (this *chaCha20Poly1305) xorKeyStream(dst, src, nonce []byte, counter uint32) {
+	var state [16]uint32
+	var block [64]byte
+	state[0] = 0x61707865
+	state[1] = 0x3320646E
+	state[2] = 0x79622D32
+	state[3] = 0x6B206574
+	copy(state[4:12], this.key[:])
+	state[13] = binary.LittleEndian.Uint32(nonce[0:])
+	state[14] = binary.LittleEndian.Uint32(nonce[4:])
+	state[15] = binary.LittleEndian.Uint32(nonce[8:])
+
+	for n := 0; n < len(src); n += 64 {
+		state[12] = counter
+		chaCha20Block(&state, &block)
+		counter++
+		end := min(n+64, len(src))
+
+		for i := n; i < end; i++ {
+			dst[i] = src[i] ^ block[i-n]
+		}
+	}
+}
+
+func chaCha20Block(state *[16]uint32, out *[64]byte) {
+	x := *state
+
+	for i := 0; i < 10; i++ {
+		chaCha20QuarterRound(&x, 0, 4, 8, 12)
+		chaCha20QuarterRound(&x, 1, 5, 9, 13)
+		chaCha20QuarterRound(&x, 2, 6, 10, 14)
+		chaCha20QuarterRound(&x, 3, 7, 11, 15)
+		chaCha20QuarterRound(&x, 0, 5, 10, 15)
+		chaCha20QuarterRound(&x, 1, 6, 11, 12)
+		chaCha20QuarterRound(&x, 2, 7, 8, 13)
+		chaCha20QuarterRound(&x, 3, 4, 9, 14)
+	}
+
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+state[i])
+	}
+}
+
+func chaCha20QuarterRound(x *[16]uint32, a, b, c, d int) {
+	x[a] += x[b]
+	x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+	x[c] += x[d]
+	x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+	x[a] += x[b]
+	x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+	x[c] += x[d]
+	x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+}
+
+// poly1305Tag computes the Poly1305 tag of the AEAD construction:
+// aad | pad | ciphertext | pad | len(aad) | len(ciphertext)
+func poly1305Tag(key, aad, ct []byte) [16]byte {
+	var p poly1305
+	p.init(key)
+	p.update(aad, true)
+	p.update(ct, true)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[0:], uint64(len(aad)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ct)))
+	p.update(lengths[:], false)
+	return p.sum()
+}
+
+// poly1305 accumulator h (130 bits) modulo 2^130-5
+type poly1305 struct {
+	h0, h1, h2 uint64
+	r0, r1     uint64
+	s0, s1     uint64
+}
+
+func (this *poly1305) init(key []byte) {
+	this.r0 = binary.LittleEndian.Uint64(key[0:]) & 0x0FFFFFFC0FFFFFFF
+	this.r1 = binary.LittleEndian.Uint64(key[8:]) & 0x0FFFFFFC0FFFFFFC
+	this.s0 = binary.LittleEndian.Uint64(key[16:])
+	this.s1 = binary.LittleEndian.Uint64(key[24:])
+}
+
+// update processes msg by 16 byte blocks. The last block is zero padded
+// (AEAD padding) if pad is true.
+func (this *poly1305) update(msg []byte, pad bool) {
+	h0, h1, h2 := this.h0, this.h1, this.h2
+
+	for len(msg) > 0 {
+		var buf [16]byte
+		n := copy(buf[:], msg)
+		msg = msg[n:]
+
+		if n < 16 && pad == false {
+			buf[n] = 1
+		}
+
+		var c uint64
+		h0, c = bits.Add64(h0, binary.LittleEndian.Uint64(buf[0:]), 0)
+		h1, c = bits.Add64(h1, binary.LittleEndian.Uint64(buf[8:]), c)
+		h2 += c
+
+		if n == 16 || pad == true {
+			h2++ // 2^128
+		}
+
+		// h *= r (r0 and r1 < 2^60, h2 < 8)
+		h0r0Hi, h0r0Lo := bits.Mul64(h0, this.r0)
+		h1r0Hi, h1r0Lo := bits.Mul64(h1, this.r0)
+		h0r1Hi, h0r1Lo := bits.Mul64(h0, this.r1)
+		h1r1Hi, h1r1Lo := bits.Mul64(h1, this.r1)
+		h2r0 := h2 * this.r0
+		h2r1 := h2 * this.r1
+
+		m1Lo, c1 := bits.Add64(h1r0Lo, h0r1Lo, 0)
+		m1Hi, _ := bits.Add64(h1r0Hi, h0r1Hi, c1)
+		m2Lo, c2 := bits.Add64(h2r0, h1r1Lo, 0)
+		m2Hi, _ := bits.Add64(0, h1r1Hi, c2)
+
+		t0 := h0r0Lo
+		t1, c := bits.Add64(m1Lo, h0r0Hi, 0)
+		t2, c := bits.Add64(m2Lo, m1Hi, c)
+		t3, _ := bits.Add64(h2r1, m2Hi, c)
+
+		// Reduce: h = t mod 2^130 + 5 * (t >> 130)
+		h0, h1, h2 = t0, t1, t2&3
+		cLo, cHi := t2&^3, t3
+		h0, c = bits.Add64(h0, cLo, 0)
+		h1, c = bits.Add64(h1, cHi, c)
+		h2 += c
+		cLo, cHi = (cLo>>2)|(cHi<<62), cHi>>2
+		h0, c = bits.Add64(h0, cLo, 0)
+		h1, c = bits.Add64(h1, cHi, c)
+		h2 += c
+	}
+
+	this.h0, this.h1, this.h2 = h0, h1, h2
+}
+
+func (this *poly1305) sum() [16]byte {
+	// h - p = h + 5 - 2^130, selected if no borrow (h >= p)
+	g0, b := bits.Sub64(this.h0, 0xFFFFFFFFFFFFFFFB, 0)
+	g1, b := bits.Sub64(this.h1, 0xFFFFFFFFFFFFFFFF, b)
+	_, b = bits.Sub64(this.h2, 3, b)
+	mask := b - 1 // all ones if h >= p
+	h0 := (this.h0 &^ mask) | (g0 & mask)
+	h1 := (this.h1 &^ mask) | (g1 & mask)
+
+	var c uint64
+	h0, c = bits.Add64(h0, this.s0, 0)
+	h1, _ = bits.Add64(h1, this.s1, c)
+	var res [16]byte
+	binary.LittleEndian.PutUint64(res[0:], h0)
+	binary.LittleEndian.PutUint64(res[8:], h1)
+	return res
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// Test vectors of RFC 8439
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	res, err := hex.DecodeString(s)
+
+	if err != nil {
+		t.Fatalf("Invalid hex string: %v", err)
+	}
+
+	return res
+}
+
+func rangeBytes(from, n int) []byte {
+	res := make([]byte, n)
+
+	for i := range res {
+		res[i] = byte(from + i)
+	}
+
+	return res
+}
+
+const _RFC8439_SUNSCREEN = "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."
+
+func TestChaCha20KeyStream(t *testing.T) {
+	fmt.Println("Test ChaCha20 Key Stream")
+
+	tests := []struct {
+		name    string
+		key     string
+		nonce   string
+		counter uint32
+		stream  string
+	}{
+		// 2.3.2
+		{"2.3.2", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "000000090000004a00000000", 1,
+			"10f1e7e4d13b5915500fdd1fa32071c4c7d1f4c733c068030422aa9ac3d46c4ed2826446079faa0914c2d705d98b02a2b5129cd1de164eb9cbd083e8a2503c4e"},
+		// A.1 #1 to #5
+		{"A.1 #1", "0000000000000000000000000000000000000000000000000000000000000000", "000000000000000000000000", 0,
+			"76b8e0ada0f13d90405d6ae55386bd28bdd219b8a08ded1aa836efcc8b770dc7da41597c5157488d7724e03fb8d84a376a43b8f41518a11cc387b669b2ee6586"},
+		{"A.1 #2", "0000000000000000000000000000000000000000000000000000000000000000", "000000000000000000000000", 1,
+			"9f07e7be5551387a98ba977c732d080dcb0f29a048e3656912c6533e32ee7aed29b721769ce64e43d57133b074d839d531ed1f28510afb45ace10a1f4b794d6f"},
+		{"A.1 #3", "0000000000000000000000000000000000000000000000000000000000000001", "000000000000000000000000", 1,
+			"3aeb5224ecf849929b9d828db1ced4dd832025e8018b8160b82284f3c949aa5a8eca00bbb4a73bdad192b5c42f73f2fd4e273644c8b36125a64addeb006c13a0"},
+		{"A.1 #4", "00ff000000000000000000000000000000000000000000000000000000000000", "000000000000000000000000", 2,
+			"72d54dfbf12ec44b362692df94137f328fea8da73990265ec1bbbea1ae9af0ca13b25aa26cb4a648cb9b9d1be65b2c0924a66c54d545ec1b7374f4872e99f096"},
+		{"A.1 #5", "0000000000000000000000000000000000000000000000000000000000000000", "000000000000000000000002", 0,
+			"c2c64d378cd536374ae204b9ef933fcd1a8b2288b3dfa49672ab765b54ee27c78a970e0e955c14f3a88e741b97c286f75f8fc299e8148362fa198a39531bed6d"},
+		// 2.6.2 (Poly1305 key generation: first 32 bytes of block 0)
+		{"2.6.2", "808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f", "000000000001020304050607", 0,
+			"8ad5a08b905f81cc815040274ab29471a833b637e3fd0da508dbb8e2fdd1a646"},
+	}
+
+	for _, test := range tests {
+		aead, err := NewChaCha20Poly1305(mustDecodeHex(t, test.key))
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		expected := mustDecodeHex(t, test.stream)
+		res := make([]byte, len(expected))
+		aead.(*chaCha20Poly1305).xorKeyStream(res, res, mustDecodeHex(t, test.nonce), test.counter)
+
+		if bytes.Equal(res, expected) == false {
+			t.Errorf("%s: expected %x, got %x", test.name, expected, res)
+		}
+	}
+}
+
+func TestChaCha20Encryption(t *testing.T) {
+	fmt.Println("Test ChaCha20 Encryption")
+	// 2.4.2
+	aead, _ := NewChaCha20Poly1305(rangeBytes(0, 32))
+	expected := mustDecodeHex(t, "6e2e359a2568f98041ba0728dd0d6981e97e7aec1d4360c20a27afccfd9fae0bf91b65c5524733ab8f593dabcd62b3571639d624e65152ab8f530c359f0861d807ca0dbf500d6a6156a38e088a22b65e52bc514d16ccf806818ce91ab77937365af90bbf74a35be6b40b8eedf2785e42874d")
+	res := make([]byte, len(_RFC8439_SUNSCREEN))
+	aead.(*chaCha20Poly1305).xorKeyStream(res, []byte(_RFC8439_SUNSCREEN), mustDecodeHex(t, "000000000000004a00000000"), 1)
+
+	if bytes.Equal(res, expected) == false {
+		t.Errorf("Expected %x, got %x", expected, res)
+	}
+}
+
+func TestPoly1305(t *testing.T) {
+	fmt.Println("Test Poly1305")
+	zero := "00000000000000000000000000000000"
+	ones := "ffffffffffffffffffffffffffffffff"
+
+	tests := []struct {
+		name string
+		key  string
+		msg  string
+		tag  string
+	}{
+		// 2.5.2
+		{"2.5.2", "85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b",
+			hex.EncodeToString([]byte("Cryptographic Forum Research Group")), "a8061dc1305136c6c22b8baf0c0127a9"},
+		// A.3 #1
+		{"A.3 #1", zero + zero, zero + zero + zero + zero, zero},
+		// A.3 #5 to #11: edge cases of the modular reduction
+		{"A.3 #5", "02000000000000000000000000000000" + zero, ones, "03000000000000000000000000000000"},
+		{"A.3 #6", "02000000000000000000000000000000" + ones, "02000000000000000000000000000000", "03000000000000000000000000000000"},
+		{"A.3 #7", "01000000000000000000000000000000" + zero,
+			ones + "f0ffffffffffffffffffffffffffffff" + "11000000000000000000000000000000", "05000000000000000000000000000000"},
+		{"A.3 #8", "01000000000000000000000000000000" + zero,
+			ones + "fbfefefefefefefefefefefefefefefe" + "01010101010101010101010101010101", zero},
+		{"A.3 #9", "02000000000000000000000000000000" + zero, "fdffffffffffffffffffffffffffffff", "faffffffffffffffffffffffffffffff"},
+		{"A.3 #10", "01000000000000000400000000000000" + zero,
+			"e33594d7505e43b900000000000000003394d7505e4379cd01000000000000000000000000000000000000000000000001000000000000000000000000000000",
+			"14000000000000005500000000000000"},
+		{"A.3 #11", "01000000000000000400000000000000" + zero,
+			"e33594d7505e43b900000000000000003394d7505e4379cd010000000000000000000000000000000000000000000000",
+			"13000000000000000000000000000000"},
+	}
+
+	for _, test := range tests {
+		var p poly1305
+		p.init(mustDecodeHex(t, test.key))
+		p.update(mustDecodeHex(t, test.msg), false)
+		tag := p.sum()
+
+		if expected := mustDecodeHex(t, test.tag); bytes.Equal(tag[:], expected) == false {
+			t.Errorf("%s: expected %x, got %x", test.name, expected, tag)
+		}
+	}
+}
+
+func TestChaCha20Poly1305(t *testing.T) {
+	fmt.Println("Test ChaCha20-Poly1305")
+	// 2.8.2
+	key := rangeBytes(0x80, 32)
+	nonce := mustDecodeHex(t, "070000004041424344454647")
+	aad := mustDecodeHex(t, "50515253c0c1c2c3c4c5c6c7")
+	expected := mustDecodeHex(t, "d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116"+
+		"1ae10b594f09e26a7e902ecbd0600691")
+	aead, err := NewChaCha20Poly1305(key)
+
+	if err != nil {
+		t.Fatalf("Cannot create AEAD: %v", err)
+	}
+
+	prefix := []byte{1, 2, 3}
+	sealed := aead.Seal(bytes.Clone(prefix), nonce, []byte(_RFC8439_SUNSCREEN), aad)
+
+	if bytes.Equal(sealed[0:3], prefix) == false || bytes.Equal(sealed[3:], expected) == false {
+		t.Fatalf("Expected %x, got %x", expected, sealed[3:])
+	}
+
+	opened, err := aead.Open(nil, nonce, expected, aad)
+
+	if err != nil || string(opened) != _RFC8439_SUNSCREEN {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// In place
+	buf := []byte(_RFC8439_SUNSCREEN)
+	buf = append(buf, make([]byte, aead.Overhead())...)[0:len(_RFC8439_SUNSCREEN)]
+
+	if sealed = aead.Seal(buf[0:0], nonce, buf, aad); bytes.Equal(sealed, expected) == false {
+		t.Errorf("In place seal: expected %x, got %x", expected, sealed)
+	}
+
+	if opened, err = aead.Open(sealed[0:0], nonce, sealed, aad); err != nil || string(opened) != _RFC8439_SUNSCREEN {
+		t.Errorf("In place open failed: %v", err)
+	}
+
+	if _, err = NewChaCha20Poly1305(key[0:16]); err == nil {
+		t.Errorf("Expected error on invalid key size")
+	}
+}
+
+func TestChaCha20Poly1305Tampering(t *testing.T) {
+	fmt.Println("Test ChaCha20-Poly1305 Tampering")
+	aead, _ := NewChaCha20Poly1305(rangeBytes(0x80, 32))
+	nonce := mustDecodeHex(t, "070000004041424344454647")
+	aad := mustDecodeHex(t, "50515253c0c1c2c3c4c5c6c7")
+
+	// Lengths around the ChaCha20 (64) and Poly1305 (16) block sizes
+	for _, n := range []int{0, 1, 15, 16, 17, 63, 64, 65, 128, 1000} {
+		msg := rangeBytes(n, n)
+		sealed := aead.Seal(nil, nonce, msg, aad)
+
+		if len(sealed) != n+aead.Overhead() {
+			t.Fatalf("Length %d: invalid sealed size %d", n, len(sealed))
+		}
+
+		if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || bytes.Equal(opened, msg) == false {
+			t.Fatalf("Length %d: round trip failed: %v", n, err)
+		}
+
+		// Any bit flip in the ciphertext or the tag
+		for i := range sealed {
+			for bit := 0; bit < 8; bit += 7 {
+				sealed[i] ^= 1 << bit
+
+				if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+					t.Errorf("Length %d: undetected change of bit %d of byte %d", n, bit, i)
+				}
+
+				sealed[i] ^= 1 << bit
+			}
+		}
+
+		// Additional data or nonce changed
+		for i := range aad {
+			aad[i] ^= 0x80
+
+			if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+				t.Errorf("Length %d: undetected change of the additional data", n)
+			}
+
+			aad[i] ^= 0x80
+		}
+
+		for i := range nonce {
+			nonce[i] ^= 1
+
+			if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+				t.Errorf("Length %d: undetected change of the nonce", n)
+			}
+
+			nonce[i] ^= 1
+		}
+
+		// Missing or extra additional data, truncation
+		if _, err := aead.Open(nil, nonce, sealed, nil); err == nil {
+			t.Errorf("Length %d: undetected removal of the additional data", n)
+		}
+
+		if _, err := aead.Open(nil, nonce, sealed, append(bytes.Clone(aad), 0)); err == nil {
+			t.Errorf("Length %d: undetected extension of the additional data", n)
+		}
+
+		if _, err := aead.Open(nil, nonce, sealed[0:len(sealed)-1], aad); err == nil {
+			t.Errorf("Length %d: undetected truncation", n)
+		}
+
+		if n > 0 {
+			if _, err := aead.Open(nil, nonce, sealed[1:], aad); err == nil {
+				t.Errorf("Length %d: undetected removal of the first byte", n)
+			}
+		}
+	}
+
+	if _, err := aead.Open(nil, nonce, make([]byte, aead.Overhead()-1), aad); err == nil {
+		t.Errorf("Expected error on message shorter than the tag")
+	}
+}
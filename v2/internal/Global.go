@@ -17,22 +17,25 @@ package internal
 
 import (
 	"errors"
+
+	"github.com/flanglet/kanzi-go/v2/analysis"
 )
 
-// DataType captures the type of input data
-type DataType int
+// DataType see analysis.DataType
+type DataType = analysis.DataType
 
 const (
-	DT_UNDEFINED      DataType = 0
-	DT_TEXT           DataType = 1
-	DT_MULTIMEDIA     DataType = 2
-	DT_EXE            DataType = 3
-	DT_NUMERIC        DataType = 4
-	DT_BASE64         DataType = 5
-	DT_DNA            DataType = 6
-	DT_BIN            DataType = 7
-	DT_UTF8           DataType = 8
-	DT_SMALL_ALPHABET DataType = 9
+	DT_UNDEFINED      = analysis.DT_UNDEFINED
+	DT_TEXT           = analysis.DT_TEXT
+	DT_MULTIMEDIA     = analysis.DT_MULTIMEDIA
+	DT_EXE            = analysis.DT_EXE
+	DT_NUMERIC        = analysis.DT_NUMERIC
+	DT_BASE64         = analysis.DT_BASE64
+	DT_DNA            = analysis.DT_DNA
+	DT_BIN            = analysis.DT_BIN
+	DT_UTF8           = analysis.DT_UTF8
+	DT_SMALL_ALPHABET = analysis.DT_SMALL_ALPHABET
+	DT_UTF16          = analysis.DT_UTF16
 )
 
 var (
@@ -95,10 +98,6 @@ var (
 		65536,
 	}
 
-	_BASE64_SYMBOLS  = []byte(`ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/`)
-	_NUMERIC_SYMBOLS = []byte(`0123456789+-*/=,.:; `)
-	_DNA_SYMBOLS     = []byte(`acgntuACGNTU"`) // either T or U and N for unknown
-
 	// SQUASH contains p = 1/(1 + exp(-d)), d scaled by 8 bits, p scaled by 12 bits
 	SQUASH [4096]int
 
@@ -343,79 +342,9 @@ func ComputeHistogram(block []byte, freqs []int, isOrder0, withTotal bool) {
 	}
 }
 
+// DetectSimpleType see analysis.DetectSimpleType
 func DetectSimpleType(count int, freqs0 []int) DataType {
-	if count == 0 {
-		return DT_UNDEFINED
-	}
-
-	sum := 0
-
-	for i := 0; i < 12; i++ {
-		sum += freqs0[_DNA_SYMBOLS[i]]
-	}
-
-	if sum > count-count/12 {
-		return DT_DNA
-	}
-
-	sum = 0
-
-	for i := 0; i < 20; i++ {
-		sum += freqs0[_NUMERIC_SYMBOLS[i]]
-	}
-
-	if sum == count {
-		return DT_NUMERIC
-	}
-
-	sum = 0
-
-	for i := 0; i < 64; i++ {
-		sum += freqs0[_BASE64_SYMBOLS[i]]
-	}
-
-	if sum+freqs0[0x3D] == count {
-		return DT_BASE64
-	}
-
-	sum = 0
-
-	for i := 0; i < 256; i += 8 {
-		if freqs0[i] > 0 {
-			sum++
-		}
-		if freqs0[i+1] > 0 {
-			sum++
-		}
-		if freqs0[i+2] > 0 {
-			sum++
-		}
-		if freqs0[i+3] > 0 {
-			sum++
-		}
-		if freqs0[i+4] > 0 {
-			sum++
-		}
-		if freqs0[i+5] > 0 {
-			sum++
-		}
-		if freqs0[i+6] > 0 {
-			sum++
-		}
-		if freqs0[i+7] > 0 {
-			sum++
-		}
-	}
-
-	if sum == 256 {
-		return DT_BIN
-	}
-
-	if sum <= 4 {
-		return DT_SMALL_ALPHABET
-	}
-
-	return DT_UNDEFINED
+	return analysis.DetectSimpleType(count, freqs0)
 }
 
 // ComputeJobsPerTask computes the number of jobs associated with each task
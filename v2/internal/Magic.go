@@ -16,191 +16,213 @@ limitations under the License.
 package internal
 
 import (
+	"bytes"
 	"encoding/binary"
+	"strconv"
+
+	"github.com/flanglet/kanzi-go/v2/analysis"
 )
 
+// The magic detection is part of the public analysis package
 const (
-	NO_MAGIC     = 0
-	JPG_MAGIC    = 0xFFD8FFE0
-	GIF_MAGIC    = 0x47494638
-	PDF_MAGIC    = 0x25504446
-	ZIP_MAGIC    = 0x504B0304 // Works for jar & office docs
-	LZMA_MAGIC   = 0x377ABCAF // Works for 7z  37 7A BC AF 27 1C
-	PNG_MAGIC    = 0x89504E47
-	ELF_MAGIC    = 0x7F454C46
-	MAC_MAGIC32  = 0xFEEDFACE
-	MAC_CIGAM32  = 0xCEFAEDFE
-	MAC_MAGIC64  = 0xFEEDFACF
-	MAC_CIGAM64  = 0xCFFAEDFE
-	ZSTD_MAGIC   = 0x28B52FFD
-	BROTLI_MAGIC = 0x81CFB2CE
-	RIFF_MAGIC   = 0x52494646 // WAV, AVI, WEBP
-	CAB_MAGIC    = 0x4D534346
-	FLAC_MAGIC   = 0x664C6143
-	XZ_MAGIC     = 0xFD377A58 // FD 37 7A 58 5A 00
-	RAR_MAGIC    = 0x52617221 // 52 61 72 21 1A 07 00
-	KNZ_MAGIC    = 0x4B414E5A
-
-	BZIP2_MAGIC   = 0x425A68
-	MP3_ID3_MAGIC = 0x494433
-
-	GZIP_MAGIC = 0x1F8B
-	BMP_MAGIC  = 0x424D
-	WIN_MAGIC  = 0x4D5A
-	PBM_MAGIC  = 0x5034 // bin only
-	PGM_MAGIC  = 0x5035 // bin only
-	PPM_MAGIC  = 0x5036 // bin only
-
+	NO_MAGIC      = analysis.NO_MAGIC
+	JPG_MAGIC     = analysis.JPG_MAGIC
+	GIF_MAGIC     = analysis.GIF_MAGIC
+	PDF_MAGIC     = analysis.PDF_MAGIC
+	ZIP_MAGIC     = analysis.ZIP_MAGIC
+	LZMA_MAGIC    = analysis.LZMA_MAGIC
+	PNG_MAGIC     = analysis.PNG_MAGIC
+	ELF_MAGIC     = analysis.ELF_MAGIC
+	MAC_MAGIC32   = analysis.MAC_MAGIC32
+	MAC_CIGAM32   = analysis.MAC_CIGAM32
+	MAC_MAGIC64   = analysis.MAC_MAGIC64
+	MAC_CIGAM64   = analysis.MAC_CIGAM64
+	ZSTD_MAGIC    = analysis.ZSTD_MAGIC
+	BROTLI_MAGIC  = analysis.BROTLI_MAGIC
+	RIFF_MAGIC    = analysis.RIFF_MAGIC
+	CAB_MAGIC     = analysis.CAB_MAGIC
+	FLAC_MAGIC    = analysis.FLAC_MAGIC
+	XZ_MAGIC      = analysis.XZ_MAGIC
+	RAR_MAGIC     = analysis.RAR_MAGIC
+	KNZ_MAGIC     = analysis.KNZ_MAGIC
+	PARQUET_MAGIC = analysis.PARQUET_MAGIC
+	AVRO_MAGIC    = analysis.AVRO_MAGIC
+	BZIP2_MAGIC   = analysis.BZIP2_MAGIC
+	MP3_ID3_MAGIC = analysis.MP3_ID3_MAGIC
+	ORC_MAGIC     = analysis.ORC_MAGIC
+	GZIP_MAGIC    = analysis.GZIP_MAGIC
+	BMP_MAGIC     = analysis.BMP_MAGIC
+	WIN_MAGIC     = analysis.WIN_MAGIC
+	PBM_MAGIC     = analysis.PBM_MAGIC
+	PGM_MAGIC     = analysis.PGM_MAGIC
+	PPM_MAGIC     = analysis.PPM_MAGIC
+	PAM_MAGIC     = analysis.PAM_MAGIC
 )
 
-// Magic is a utility to detect common header magic values
-type Magic struct {
+// GetMagicType see analysis.GetMagicType
+func GetMagicType(src []byte) uint {
+	return analysis.GetMagicType(src)
 }
 
-var (
-	_KEYS32 = [18]uint{
-		GIF_MAGIC, PDF_MAGIC, ZIP_MAGIC, LZMA_MAGIC, PNG_MAGIC,
-		ELF_MAGIC, MAC_MAGIC32, MAC_CIGAM32, MAC_MAGIC64, MAC_CIGAM64,
-		ZSTD_MAGIC, BROTLI_MAGIC, CAB_MAGIC, RIFF_MAGIC, FLAC_MAGIC,
-		XZ_MAGIC, KNZ_MAGIC, RAR_MAGIC,
-	}
+// IsDataCompressed see analysis.IsDataCompressed
+func IsDataCompressed(magic uint) bool {
+	return analysis.IsDataCompressed(magic)
+}
 
-	_KEYS16 = [3]uint{
-		GZIP_MAGIC, BMP_MAGIC, WIN_MAGIC,
-	}
-)
+// IsDataContainer see analysis.IsDataContainer
+func IsDataContainer(magic uint) bool {
+	return analysis.IsDataContainer(magic)
+}
 
-// GetMagicType checks the first bytes of the slice against a list of common magic values
-func GetMagicType(src []byte) uint {
-	if len(src) < 4 {
-		return NO_MAGIC
-	}
+// IsDataMultimedia see analysis.IsDataMultimedia
+func IsDataMultimedia(magic uint) bool {
+	return analysis.IsDataMultimedia(magic)
+}
 
-	key := uint(binary.BigEndian.Uint32(src))
+// IsDataExecutable see analysis.IsDataExecutable
+func IsDataExecutable(magic uint) bool {
+	return analysis.IsDataExecutable(magic)
+}
 
-	if (key & ^uint(0x0F)) == JPG_MAGIC {
-		return key
-	}
+// ImageInfo describes the pixels of an uncompressed image
+type ImageInfo struct {
+	Offset int // start of the pixels
+	Width  int // in pixels
+	Height int // in rows
+	Bpp    int // bytes per pixel
+	Stride int // bytes per row (including padding)
+}
 
-	if ((key >> 8) == BZIP2_MAGIC) || ((key >> 8) == MP3_ID3_MAGIC) {
-		return key >> 8
-	}
+// GetImageInfo parses the header of uncompressed BMP and PNM (PGM, PPM,
+// PAM) images. Returns false if the header is missing or not supported.
+func GetImageInfo(src []byte) (ImageInfo, bool) {
+	var info ImageInfo
 
-	for _, k := range _KEYS32 {
-		if key == k {
-			return key
+	switch GetMagicType(src) {
+	case BMP_MAGIC:
+		if len(src) < 54 {
+			return info, false
 		}
-	}
 
-	key16 := key >> 16
+		bits := int(binary.LittleEndian.Uint16(src[28:]))
+		compression := binary.LittleEndian.Uint32(src[30:])
+		height := int(int32(binary.LittleEndian.Uint32(src[22:])))
 
-	for _, k := range _KEYS16 {
-		if key16 == k {
-			return key16
+		// Only uncompressed pixels (BI_RGB or BI_BITFIELDS)
+		if compression != 0 && compression != 3 {
+			return info, false
 		}
-	}
 
-	if (key16 == PBM_MAGIC) || (key16 == PGM_MAGIC) || (key16 == PPM_MAGIC) {
-		subkey := (key >> 8) & 0xFF
+		if bits != 8 && bits != 16 && bits != 24 && bits != 32 {
+			return info, false
+		}
 
-		if (subkey == 0x07) || (subkey == 0x0A) || (subkey == 0x0D) || (subkey == 0x20) {
-			return key16
+		if height < 0 {
+			// Top down image
+			height = -height
 		}
-	}
 
-	return NO_MAGIC
-}
+		info.Offset = int(binary.LittleEndian.Uint32(src[10:]))
+		info.Width = int(int32(binary.LittleEndian.Uint32(src[18:])))
+		info.Height = height
+		info.Bpp = bits >> 3
+		info.Stride = ((info.Width*bits + 31) >> 5) << 2
+
+	case PGM_MAGIC, PPM_MAGIC:
+		var values [3]int
+		idx := 2
+
+		// Width, height and max value separated by whitespaces and comments
+		for i := range values {
+			for idx < len(src) && (src[idx] == '#' || isSpace(src[idx])) {
+				if src[idx] == '#' {
+					for idx < len(src) && src[idx] != '\n' {
+						idx++
+					}
+				}
+
+				idx++
+			}
+
+			start := idx
+
+			for idx < len(src) && src[idx] >= '0' && src[idx] <= '9' {
+				idx++
+			}
+
+			val, err := strconv.Atoi(string(src[start:idx]))
+
+			if err != nil {
+				return info, false
+			}
+
+			values[i] = val
+		}
+
+		if idx >= len(src) || isSpace(src[idx]) == false {
+			return info, false
+		}
+
+		channels := 1
+
+		if src[1] == '6' {
+			channels = 3
+		}
+
+		info.Offset = idx + 1
+		info.Width = values[0]
+		info.Height = values[1]
+		info.Bpp = channels * bytesPerSample(values[2])
+		info.Stride = info.Width * info.Bpp
+
+	case PAM_MAGIC:
+		end := bytes.Index(src, []byte("ENDHDR\n"))
+
+		if end < 0 {
+			return info, false
+		}
+
+		fields := map[string]int{}
+
+		for _, line := range bytes.Split(src[3:end], []byte("\n")) {
+			tokens := bytes.Fields(line)
+
+			if len(tokens) == 2 {
+				if val, err := strconv.Atoi(string(tokens[1])); err == nil {
+					fields[string(tokens[0])] = val
+				}
+			}
+		}
+
+		info.Offset = end + 7
+		info.Width = fields["WIDTH"]
+		info.Height = fields["HEIGHT"]
+		info.Bpp = fields["DEPTH"] * bytesPerSample(fields["MAXVAL"])
+		info.Stride = info.Width * info.Bpp
 
-// IsDataCompressed return true if the provided magic parameter corresponds
-// to a known compressed data type.
-func IsDataCompressed(magic uint) bool {
-	switch magic {
-	case JPG_MAGIC:
-		return true
-	case GIF_MAGIC:
-		return true
-	case PNG_MAGIC:
-		return true
-	//case RIFF_MAGIC: may or may not
-	//	return true
-	case LZMA_MAGIC:
-		return true
-	case ZSTD_MAGIC:
-		return true
-	case BROTLI_MAGIC:
-		return true
-	case CAB_MAGIC:
-		return true
-	case ZIP_MAGIC:
-		return true
-	case GZIP_MAGIC:
-		return true
-	case BZIP2_MAGIC:
-		return true
-	case FLAC_MAGIC:
-		return true
-	case MP3_ID3_MAGIC:
-		return true
-	case XZ_MAGIC:
-		return true
-	case KNZ_MAGIC:
-		return true
-	case RAR_MAGIC:
-		return true
 	default:
+		return info, false
 	}
 
-	return false
-}
+	if info.Width <= 0 || info.Height <= 0 || info.Width >= 1<<24 || info.Height >= 1<<24 {
+		return info, false
+	}
 
-// IsDataMultimedia return true if the provided magic parameter corresponds
-// to a known multimedia data type.
-func IsDataMultimedia(magic uint) bool {
-	switch magic {
-	case JPG_MAGIC:
-		return true
-	case GIF_MAGIC:
-		return true
-	case PNG_MAGIC:
-		return true
-	case RIFF_MAGIC:
-		return true
-	case FLAC_MAGIC:
-		return true
-	case MP3_ID3_MAGIC:
-		return true
-	case BMP_MAGIC:
-		return true
-	case PBM_MAGIC:
-		return true
-	case PGM_MAGIC:
-		return true
-	case PPM_MAGIC:
-		return true
-	default:
+	if info.Bpp <= 0 || info.Bpp > 16 || info.Offset < 0 || info.Stride < info.Width*info.Bpp {
+		return info, false
 	}
 
-	return false
+	return info, true
 }
 
-// IsDataExecutable return true if the provided magic parameter corresponds
-// to a known executable data type.
-func IsDataExecutable(magic uint) bool {
-	switch magic {
-	case ELF_MAGIC:
-		return true
-	case WIN_MAGIC:
-		return true
-	case MAC_MAGIC32:
-		return true
-	case MAC_CIGAM32:
-		return true
-	case MAC_MAGIC64:
-		return true
-	case MAC_CIGAM64:
-		return true
-	default:
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func bytesPerSample(maxVal int) int {
+	if maxVal < 256 {
+		return 1
 	}
 
-	return false
+	return 2
 }
@@ -0,0 +1,59 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// WorkerPanic is a panic recovered in a worker goroutine (EG. the concurrent
+// jobs of a transform). A panic cannot be recovered from another goroutine,
+// so the worker records it and the goroutine waiting for the workers raises
+// it again, where the caller (EG. the retry of a failed block) can recover it.
+type WorkerPanic struct {
+	Value any    // the value passed to panic
+	Stack []byte // the stack of the worker goroutine
+}
+
+func (this *WorkerPanic) Error() string {
+	return fmt.Sprint(this.Value)
+}
+
+// RecoverWorker stores the value r returned by recover() in the deferred
+// function of the worker goroutine j (if not nil) in panics[j], along with
+// the stack of the worker.
+func RecoverWorker(panics []any, j int, r any) {
+	if r == nil {
+		return
+	}
+
+	if _, ok := r.(*WorkerPanic); ok == false {
+		r = &WorkerPanic{Value: r, Stack: debug.Stack()}
+	}
+
+	panics[j] = r
+}
+
+// RaiseWorkerPanic raises the first panic recovered by the workers (if any)
+// on the calling goroutine.
+func RaiseWorkerPanic(panics []any) {
+	for _, r := range panics {
+		if r != nil {
+			panic(r)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+// Block scratch: the state of the block processed by a task (size and type
+// of the data, order 0 histogram, ...) is kept in a BlockScratch referenced
+// by the context of the codecs (ctx["scratch"]), instead of entries written
+// in a copy of the context for each block. The other entries are the
+// configuration of the stream, shared by the tasks and not modified by the
+// codecs. Without a scratch, the helpers below return the default values.
+
+// SCRATCH_KEY the key of the block scratch in the context
+const SCRATCH_KEY = "scratch"
+
+// BlockScratch the state of a block shared by the codecs of a task
+type BlockScratch struct {
+	Size        uint     // size of the data of the current stage
+	DataType    DataType // type of the block data, DT_UNDEFINED if unknown
+	Histo       [256]int // order 0 histogram of the input of the current stage
+	Priming     []byte   // priming data of the block (nil if none)
+	Dictionary  []byte   // priming data of the stream (shared dictionary, nil if none)
+	Substituted []string // names of the transforms replaced (see transform.Substitution)
+	histo       []byte   // data of Histo (nil if not computed)
+}
+
+// Reset prepares the scratch for a new block of the given size (the
+// dictionary is kept)
+func (this *BlockScratch) Reset(size uint) {
+	this.Size = size
+	this.DataType = DT_UNDEFINED
+	this.Priming = nil
+	this.Substituted = this.Substituted[0:0]
+	this.histo = nil
+}
+
+// InvalidateHistogram discards the histogram once the data of the stage has
+// been transformed
+func (this *BlockScratch) InvalidateHistogram() {
+	if this != nil {
+		this.histo = nil
+	}
+}
+
+// GetScratch returns the block scratch of the context (nil if none)
+func GetScratch(ctx *map[string]any) *BlockScratch {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := (*ctx)[SCRATCH_KEY].(*BlockScratch)
+	return s
+}
+
+// GetDataType returns the type of the block data (DT_UNDEFINED if unknown)
+func GetDataType(ctx *map[string]any) DataType {
+	if s := GetScratch(ctx); s != nil {
+		return s.DataType
+	}
+
+	return DT_UNDEFINED
+}
+
+// SetDataType records the type of the block data
+func SetDataType(ctx *map[string]any, dt DataType) {
+	if s := GetScratch(ctx); s != nil {
+		s.DataType = dt
+	}
+}
+
+// GetDataSize returns the size of the data of the current stage (false if
+// unknown)
+func GetDataSize(ctx *map[string]any) (uint, bool) {
+	if s := GetScratch(ctx); s != nil {
+		return s.Size, true
+	}
+
+	return 0, false
+}
+
+// GetPriming returns the priming data of the block (nil if none): the data
+// of the block or else the one of the stream (EG. a dictionary)
+func GetPriming(ctx *map[string]any) []byte {
+	s := GetScratch(ctx)
+
+	if s == nil {
+		return nil
+	}
+
+	if s.Priming != nil {
+		return s.Priming
+	}
+
+	return s.Dictionary
+}
+
+// AddSubstitution records the name of a substitution used for the block
+func AddSubstitution(ctx *map[string]any, name string) {
+	if s := GetScratch(ctx); s != nil {
+		s.Substituted = append(s.Substituted, name)
+	}
+}
+
+// GetSubstitutions returns the names of the substitutions used for the block
+func GetSubstitutions(ctx *map[string]any) []string {
+	if s := GetScratch(ctx); s != nil {
+		return s.Substituted
+	}
+
+	return nil
+}
+
+// Histogram computes the order 0 histogram of the input of the current stage
+// in freqs (256 entries set to 0), reusing the histogram of the scratch (if
+// any) if it was computed for the same data
+func Histogram(ctx *map[string]any, data []byte, freqs []int) {
+	GetScratch(ctx).Histogram(data, freqs)
+}
+
+// Histogram computes the order 0 histogram of data in freqs (256 entries
+// set to 0) and keeps it for the next stages of the block until the data is
+// transformed. The receiver can be nil.
+func (this *BlockScratch) Histogram(data []byte, freqs []int) {
+	if this != nil && len(data) > 0 && len(this.histo) == len(data) && &this.histo[0] == &data[0] {
+		copy(freqs, this.Histo[:])
+		return
+	}
+
+	ComputeHistogram(data, freqs, true, false)
+
+	if this != nil && len(data) > 0 {
+		copy(this.Histo[:], freqs)
+		this.histo = data
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Input an adversarial input of the corpus
+type Input struct {
+	Name string
+	Data []byte
+}
+
+// NearThresholdSizes returns the sizes from t-2 to t+2 around each threshold
+// t (EG. the min block size of a transform) plus a few small sizes, sorted
+// and without duplicates.
+func NearThresholdSizes(thresholds ...int) []int {
+	set := map[int]bool{0: true, 1: true, 2: true, 3: true, 7: true, 16: true}
+
+	for _, t := range thresholds {
+		for s := t - 2; s <= t+2; s++ {
+			if s >= 0 {
+				set[s] = true
+			}
+		}
+	}
+
+	res := make([]int, 0, len(set))
+
+	for s := range set {
+		res = append(res, s)
+	}
+
+	sort.Ints(res)
+	return res
+}
+
+// Corpus returns the adversarial inputs of each size: uniform, random and
+// low entropy data, runs, periodic repeats (pathological matches), colliding
+// contexts and words of each length in wordLengths (EG. around the max word
+// length of a text transform). The corpus only depends on the seed.
+func Corpus(seed int64, sizes []int, wordLengths ...int) []Input {
+	rnd := rand.New(rand.NewSource(seed))
+	res := make([]Input, 0)
+
+	for _, size := range sizes {
+		add := func(name string, data []byte) {
+			res = append(res, Input{Name: fmt.Sprintf("%s/%d", name, size), Data: data})
+		}
+
+		add("zeros", make([]byte, size))
+		add("random", Random(rnd, size, 256))
+		add("alphabet4", Random(rnd, size, 4))
+		add("runs", Runs(rnd, size))
+
+		for _, period := range []int{1, 2, 3, 7, 64, 1000} {
+			add(fmt.Sprintf("period%d", period), Repeats(rnd, size, period))
+		}
+
+		add("contexts", Contexts(rnd, size))
+
+		for _, length := range wordLengths {
+			add(fmt.Sprintf("words%d", length), Words(rnd, size, length))
+		}
+	}
+
+	return res
+}
+
+// Random returns size random symbols in [0..alphabet)
+func Random(rnd *rand.Rand, size, alphabet int) []byte {
+	res := make([]byte, size)
+
+	for i := range res {
+		res[i] = byte(rnd.Intn(alphabet))
+	}
+
+	return res
+}
+
+// Runs returns runs of random length (from 1 to 300) of a few symbols
+func Runs(rnd *rand.Rand, size int) []byte {
+	res := make([]byte, size)
+
+	for i := 0; i < size; {
+		n := min(1+rnd.Intn(300), size-i)
+		val := byte(rnd.Intn(3) * 85)
+
+		for j := i; j < i+n; j++ {
+			res[j] = val
+		}
+
+		i += n
+	}
+
+	return res
+}
+
+// Repeats returns a random pattern of the given period repeated over size
+// bytes with rare mutations: long overlapping matches at every distance
+// multiple of the period.
+func Repeats(rnd *rand.Rand, size, period int) []byte {
+	pattern := Random(rnd, period, 256)
+	res := make([]byte, size)
+
+	for i := range res {
+		res[i] = pattern[i%period]
+
+		if rnd.Intn(4096) == 0 {
+			res[i] ^= 1
+		}
+	}
+
+	return res
+}
+
+// Contexts returns the same 2 byte context followed by a few random bytes,
+// repeated: many candidate positions per context with short, different
+// continuations (EG. to saturate the match buckets of ROLZ).
+func Contexts(rnd *rand.Rand, size int) []byte {
+	res := make([]byte, size)
+
+	for i := 0; i < size; {
+		res[i] = 'x'
+
+		if i+1 < size {
+			res[i+1] = 'y'
+		}
+
+		i += 2
+
+		for n := 1 + rnd.Intn(6); n > 0 && i < size; n-- {
+			res[i] = byte(rnd.Intn(256))
+			i++
+		}
+	}
+
+	return res
+}
+
+// Words returns text made of words of the given length (and of length - 1
+// and length + 1), some capitalized, separated by spaces, punctuation and
+// line breaks.
+func Words(rnd *rand.Rand, size, length int) []byte {
+	res := make([]byte, 0, size+length+2)
+	separators := []string{" ", " ", " ", ", ", ".\n", "\r\n", "\t"}
+	vocabulary := make([][]byte, 0, 16)
+
+	for i := 0; i < 16; i++ {
+		word := make([]byte, max(length+i%3-1, 1))
+
+		for j := range word {
+			word[j] = byte('a' + rnd.Intn(26))
+		}
+
+		if i%5 == 0 {
+			word[0] -= 'a' - 'A'
+		}
+
+		vocabulary = append(vocabulary, word)
+	}
+
+	for len(res) < size {
+		res = append(res, vocabulary[rnd.Intn(len(vocabulary))]...)
+		res = append(res, separators[rnd.Intn(len(separators))]...)
+	}
+
+	return res[0:size]
+}
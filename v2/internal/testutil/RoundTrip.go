@@ -0,0 +1,91 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil provides the round trip checks and the adversarial
+// inputs shared by the tests of the transforms.
+package testutil
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/debug"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// RoundTripCheck applies the forward and the inverse function of t to data
+// and checks the result. A transform may decline the input (error or
+// partial forward): no error is returned in this case. Otherwise, the
+// following are reported as errors: a panic, a forward output larger than
+// MaxEncodedLen, a modified input, a second forward with a different output
+// (the transforms are stateless), an inverse failure or an inverse output
+// different from data.
+func RoundTripCheck(t kanzi.ByteTransform, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%d bytes: panic: %v\n%s", len(data), r, debug.Stack())
+		}
+	}()
+
+	input := bytes.Clone(data)
+	maxLen := t.MaxEncodedLen(len(data))
+
+	if maxLen < 0 {
+		// Unknown bound
+		maxLen = 2*len(data) + 1024
+	}
+
+	// No capacity past the bound: a larger output panics
+	output := make([]byte, maxLen)
+	srcIdx, dstIdx, err := t.Forward(input, output[0:maxLen:maxLen])
+
+	if bytes.Equal(input, data) == false {
+		return fmt.Errorf("%d bytes: forward modified the input", len(data))
+	}
+
+	if err != nil || srcIdx != uint(len(data)) {
+		return nil
+	}
+
+	if dstIdx > uint(maxLen) {
+		return fmt.Errorf("%d bytes: forward output of %d bytes, max encoded length %d", len(data), dstIdx, maxLen)
+	}
+
+	again := make([]byte, maxLen)
+
+	if _, n, err := t.Forward(input, again); err != nil || bytes.Equal(output[0:dstIdx], again[0:n]) == false {
+		return fmt.Errorf("%d bytes: second forward: different output (%d bytes, was %d), %v", len(data), n, dstIdx, err)
+	}
+
+	encoded := bytes.Clone(output[0:dstIdx])
+	reverse := make([]byte, len(data))
+	srcIdx, dstIdx, err = t.Inverse(encoded, reverse[0:len(data):len(data)])
+
+	if err != nil {
+		return fmt.Errorf("%d bytes: inverse failed: %v", len(data), err)
+	}
+
+	if srcIdx != uint(len(encoded)) || dstIdx != uint(len(data)) {
+		return fmt.Errorf("%d bytes: inverse read %d of %d bytes, wrote %d bytes", len(data), srcIdx, len(encoded), dstIdx)
+	}
+
+	for i := range data {
+		if data[i] != reverse[i] {
+			return fmt.Errorf("%d bytes: mismatch at index %d (%d <-> %d)", len(data), i, data[i], reverse[i])
+		}
+	}
+
+	return nil
+}
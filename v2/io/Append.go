@@ -0,0 +1,191 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+)
+
+// Append mode: the blocks of an existing stream are scanned (without being
+// decoded) up to the end block, which is overwritten by the new blocks.
+// The codecs, block size and checksum are those of the existing header and
+// the block IDs continue from the last block. Streams with an original size
+// in the header, encrypted or linked blocks, a compact header or data after
+// the end block (statistics, footer, archive trailer, chained stream) cannot
+// be extended.
+
+// nopWriteCloser an io.WriteCloser that does not close the underlying writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (this nopWriteCloser) Close() error {
+	return nil
+}
+
+// OpenWriterForAppend returns a Writer appending blocks to the stream in rw.
+// If rw is empty, a new stream is created. The parameters of the stream
+// (transform, entropy, blockSize, checksum, autoTune, rsyncable, blockHash) override
+// the ones in ctx. Closing the Writer does not close rw.
+func OpenWriterForAppend(rw io.ReadWriteSeeker, ctx map[string]any) (*Writer, error) {
+	size, err := rw.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_OPEN_FILE, cause: err}
+	}
+
+	if size == 0 {
+		return NewWriterWithCtx(nopWriteCloser{rw}, ctx)
+	}
+
+	if _, err = rw.Seek(0, io.SeekStart); err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_OPEN_FILE, cause: err}
+	}
+
+	rCtx := map[string]any{"jobs": uint(1)}
+
+	if shared, hasKey := ctx["shared"]; hasKey == true {
+		rCtx["shared"] = shared
+	}
+
+	r, err := NewReaderWithCtx(io.NopCloser(rw), rCtx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.readHeader(); err != nil {
+		return nil, err
+	}
+
+	seg := r.segments[0]
+
+	if seg.Compact == true || seg.OriginalSize != 0 || seg.Cipher != "NONE" || r.linked == true ||
+		seg.BitstreamVersion < _BITSTREAM_BASE_VERSION {
+		errMsg := "Cannot append to a stream with a compact header, an original size, encrypted or linked blocks or an older version"
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	end, blocks, err := findEndBlock(r.ibs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if (end+8+7)>>3 != uint64(size) {
+		errMsg := fmt.Sprintf("Cannot append to the stream: %d bytes after the end block", size-int64((end+8+7)>>3))
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	// Keep the bits of the last block sharing a byte with the end block
+	last := []byte{0}
+
+	if _, err = rw.Seek(int64(end>>3), io.SeekStart); err == nil {
+		_, err = io.ReadFull(rw, last)
+	}
+
+	if err == nil {
+		_, err = rw.Seek(int64(end>>3), io.SeekStart)
+	}
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_READ_FILE, cause: err}
+	}
+
+	obs, err := bitstream.NewDefaultOutputBitStream(nopWriteCloser{rw}, _STREAM_DEFAULT_BUFFER_SIZE)
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot create output bit stream: %v", err)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+	}
+
+	if n := uint(end & 7); n != 0 {
+		obs.WriteBits(uint64(last[0]>>(8-n)), n)
+	}
+
+	wCtx := make(map[string]any, len(ctx)+8)
+
+	for k, v := range ctx {
+		wCtx[k] = v
+	}
+
+	wCtx["transform"] = seg.Transform
+	wCtx["entropy"] = seg.Entropy
+	wCtx["blockSize"] = seg.BlockSize
+	wCtx["checksum"] = seg.Checksum
+	wCtx["autoTune"] = seg.AutoTune
+	wCtx["rsyncable"] = seg.Rsyncable
+	wCtx["blockHash"] = seg.BlockHash
+	wCtx["dedup"] = seg.Dedup
+	wCtx["linkedBlocks"] = false
+	wCtx["headerless"] = true
+	delete(wCtx, "fileSize")
+
+	// The new blocks use the dictionary of the existing stream (if any)
+	if seg.Dictionary == 0 {
+		delete(wCtx, "shared")
+	}
+
+	if _, hasKey := wCtx["jobs"]; hasKey == false {
+		wCtx["jobs"] = uint(1)
+	}
+
+	w, err := createWriterWithCtx(obs, wCtx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The new blocks are decoded with the version of the existing header
+	w.ctx["bsVersion"] = seg.BitstreamVersion
+	w.blockID = int32(blocks)
+	w.streamOffset = end >> 3
+	return w, nil
+}
+
+// findEndBlock reads the blocks up to the end block and returns the position
+// of the end block (in bits) and the number of blocks
+func findEndBlock(ibs kanzi.InputBitStream) (end uint64, blocks int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: fmt.Sprintf("Cannot find the end of the stream: %v", r), code: kanzi.ERR_INVALID_FILE}
+		}
+	}()
+
+	buf := make([]byte, 1<<16)
+
+	for {
+		end = ibs.Read()
+		lr := uint(ibs.ReadBits(5)) + 3
+		read := ibs.ReadBits(lr)
+
+		if read == 0 {
+			return end, blocks, nil
+		}
+
+		for read > 0 {
+			n := min(read, uint64(8*len(buf)))
+			ibs.ReadArray(buf, uint(n))
+			read -= n
+		}
+
+		blocks++
+	}
+}
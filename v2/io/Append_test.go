@@ -0,0 +1,84 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	fmt.Println("Append Test")
+
+	path := filepath.Join(t.TempDir(), "log.knz")
+	f, _ := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	defer f.Close()
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(16384),
+		"jobs": uint(2), "checksum": uint(32)}
+	expected := make([]byte, 0)
+
+	// Empty file: new stream, then 2 appends with other codecs (ignored)
+	for i := 0; i < 3; i++ {
+		w, err := OpenWriterForAppend(f, ctx)
+
+		if err != nil {
+			t.Fatalf("Append %d: cannot open writer: %v", i, err)
+		}
+
+		if i > 0 && w.blockID == 0 {
+			t.Errorf("Append %d: block IDs do not continue", i)
+		}
+
+		day := []byte(fmt.Sprintf("day %d: %s", i, strings.Repeat("GET /index.html 200 ", 1000+i*777)))
+		w.Write(day)
+		expected = append(expected, day...)
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Append %d: close failed: %v", i, err)
+		}
+
+		ctx["transform"] = "TEXT+BWT"
+		ctx["entropy"] = "CM"
+	}
+
+	data, _ := os.ReadFile(path)
+	res, r, err := decompressData(data, map[string]any{"blockInfo": true})
+
+	if err != nil || bytes.Equal(res, expected) == false {
+		t.Errorf("Invalid decompressed data: %v", err)
+	}
+
+	if len(r.Segments()) != 1 {
+		t.Errorf("Expected 1 segment, got %d", len(r.Segments()))
+	}
+
+	if info, _ := r.BlockInfo(r.BlockInfoCount() - 1); info.Transform != "LZ" || info.ID != r.BlockInfoCount() {
+		t.Errorf("Incorrect last block: %+v", info)
+	}
+
+	// Data after the end block
+	f.Truncate(0)
+	f.WriteAt(compressData(t, expected, map[string]any{"transform": "LZ", "blockSize": uint(16384), "footer": true}), 0)
+
+	if _, err = OpenWriterForAppend(f, ctx); errors.Is(err, ErrInvalidFile) == false {
+		t.Errorf("Expected invalid file error, got %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	kanzihash "github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Archival mode (ctx["archival"] = true): a profile for long term storage.
+// The blocks carry 64 bit checksums and are byte aligned. The end block is
+// followed by a trailer (big endian, byte aligned):
+//
+//	type "KARC" (4) | trailer size (8) | version (1) | trailer offset (8)
+//	header size (2) | copy of the stream header
+//	original size (8) | stream digest: SHA-256 of the original data (32)
+//	number of blocks (4) | parity group size (1)
+//	index: offset (8), length (4), original size (4), XXH64 (8) per block
+//	parity: length (4), XOR of the blocks of the group, per group
+//	footer: trailer size (8) | XXH64 of the trailer (8) | type (4), twice
+//
+// Offsets are relative to the start of the stream and the index covers the
+// whole block records (length and data). The trailer is located from the
+// end of the data using the footer. RepairArchive uses it to restore the
+// header and one damaged block per parity group. A Reader ignores the
+// trailer unless ctx["archival"] is true, in which case it checks the
+// stream digest. Reader.ReadAt uses the index as a seek table (see
+// SeekTable.go).
+
+const (
+	_ARCHIVE_TYPE        = 0x4B415243 // "KARC"
+	_ARCHIVE_VERSION     = 1
+	_ARCHIVE_GROUP_SIZE  = 8 // blocks per parity group
+	_ARCHIVE_FOOTER_SIZE = 20
+	_ARCHIVE_FIXED_SIZE  = 4 + 8 + 1 + 8 + 2 + 8 + 32 // up to the stream digest
+)
+
+// ArchiveReport the result of RepairArchive
+type ArchiveReport struct {
+	Blocks         int   // number of blocks in the index
+	Damaged        []int // IDs (starting at 1) of the blocks that did not match the index
+	Repaired       []int // IDs of the damaged blocks restored from the parity data
+	HeaderRepaired bool  // the stream header was restored from its copy
+	FooterRepaired bool  // one of the footers was restored from the other one
+}
+
+type archiveBlock struct {
+	offset uint64
+	length uint32
+	size   uint32
+	hash   uint64
+}
+
+// archiveBuilder collects the block records emitted by the encoding tasks
+// (in order) and the digest of the original data.
+type archiveBuilder struct {
+	lock   sync.Mutex
+	digest hash.Hash
+	size   uint64
+	blocks []archiveBlock
+	parity [][]byte
+	hasher *kanzihash.XXHash64
+}
+
+func newArchiveBuilder() (*archiveBuilder, error) {
+	hasher, err := kanzihash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveBuilder{digest: sha256.New(), hasher: hasher}, nil
+}
+
+func (this *archiveBuilder) update(data []byte) {
+	this.digest.Write(data)
+	this.size += uint64(len(data))
+}
+
+func (this *archiveBuilder) add(offset uint64, record []byte, size int) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	g := len(this.blocks) / _ARCHIVE_GROUP_SIZE
+	this.blocks = append(this.blocks, archiveBlock{offset: offset, length: uint32(len(record)),
+		size: uint32(size), hash: this.hasher.Hash(record)})
+
+	if g == len(this.parity) {
+		this.parity = append(this.parity, append([]byte(nil), record...))
+		return
+	}
+
+	if len(this.parity[g]) < len(record) {
+		this.parity[g] = append(this.parity[g], make([]byte, len(record)-len(this.parity[g]))...)
+	}
+
+	xorBytes(this.parity[g], record)
+}
+
+// trailer returns the archive trailer of a stream with the provided header
+// starting at offset (in bytes) from the start of the stream.
+func (this *archiveBuilder) trailer(header []byte, offset uint64) []byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	res := binary.BigEndian.AppendUint32(nil, _ARCHIVE_TYPE)
+	res = binary.BigEndian.AppendUint64(res, 0) // size, set below
+	res = append(res, _ARCHIVE_VERSION)
+	res = binary.BigEndian.AppendUint64(res, offset)
+	res = binary.BigEndian.AppendUint16(res, uint16(len(header)))
+	res = append(res, header...)
+	res = binary.BigEndian.AppendUint64(res, this.size)
+	res = append(res, this.digest.Sum(nil)...)
+	res = binary.BigEndian.AppendUint32(res, uint32(len(this.blocks)))
+	res = append(res, _ARCHIVE_GROUP_SIZE)
+
+	for _, b := range this.blocks {
+		res = binary.BigEndian.AppendUint64(res, b.offset)
+		res = binary.BigEndian.AppendUint32(res, b.length)
+		res = binary.BigEndian.AppendUint32(res, b.size)
+		res = binary.BigEndian.AppendUint64(res, b.hash)
+	}
+
+	for _, p := range this.parity {
+		res = binary.BigEndian.AppendUint32(res, uint32(len(p)))
+		res = append(res, p...)
+	}
+
+	size := uint64(len(res) + 2*_ARCHIVE_FOOTER_SIZE)
+	binary.BigEndian.PutUint64(res[4:], size)
+	var footer [_ARCHIVE_FOOTER_SIZE]byte
+	binary.BigEndian.PutUint64(footer[0:], size)
+	binary.BigEndian.PutUint64(footer[8:], this.hasher.Hash(res))
+	binary.BigEndian.PutUint32(footer[16:], _ARCHIVE_TYPE)
+	res = append(res, footer[:]...)
+	return append(res, footer[:]...)
+}
+
+// archiveChecker computes the digest of the data decoded by a Reader
+type archiveChecker struct {
+	digest hash.Hash
+}
+
+func newArchiveChecker() *archiveChecker {
+	return &archiveChecker{digest: sha256.New()}
+}
+
+// writeArchiveTrailer writes the trailer after the end block
+func (this *Writer) writeArchiveTrailer() error {
+	// The trailer starts on a byte boundary
+	if pad := uint(8-(this.obs.Written()&7)) & 7; pad != 0 {
+		this.obs.WriteBits(0, pad)
+	}
+
+	bufStream := internal.NewBufferStream(make([]byte, 0, 64))
+	obs, err := bitstream.NewDefaultOutputBitStream(bufStream, 1024)
+
+	if err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	if err := this.encodeHeader(obs); err != nil {
+		return err
+	}
+
+	obs.Close()
+	trailer := this.archive.trailer(bufStream.Bytes(), this.obs.Written()>>3)
+
+	for off := 0; off < len(trailer); {
+		n := min(len(trailer)-off, 1<<23)
+		this.obs.WriteArray(trailer[off:], uint(8*n))
+		off += n
+	}
+
+	return nil
+}
+
+// readArchiveTrailer skips the trailer following the end block (the type
+// has already been read) and checks the stream digest if required.
+func (this *Reader) readArchiveTrailer() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid archive trailer: truncated data", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	size := this.ibs.ReadBits(64)
+
+	if version := this.ibs.ReadBits(8); version != _ARCHIVE_VERSION {
+		errMsg := fmt.Sprintf("Invalid archive trailer: unsupported version %d", version)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this.ibs.ReadBits(64) // offset
+	hSize := this.ibs.ReadBits(16)
+	remaining := size - _ARCHIVE_FIXED_SIZE - hSize
+
+	if size < _ARCHIVE_FIXED_SIZE+hSize {
+		return &IOError{msg: "Invalid archive trailer: bad size", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	buf := make([]byte, 65536)
+	this.ibs.ReadArray(buf, uint(8*hSize))
+	this.ibs.ReadBits(64) // original size
+	digest := make([]byte, sha256.Size)
+	this.ibs.ReadArray(digest, 8*sha256.Size)
+
+	// Skip index, parity and footers
+	for remaining > 0 {
+		n := min(remaining, uint64(len(buf)))
+		this.ibs.ReadArray(buf, uint(8*n))
+		remaining -= n
+	}
+
+	if this.archive != nil && this.damaged == 0 && bytes.Equal(digest, this.archive.digest.Sum(nil)) == false {
+		return &IOError{msg: "Archive verification failed: stream digest mismatch", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return nil
+}
+
+// archiveTrailer a parsed archive trailer
+type archiveTrailer struct {
+	start  int // position of the trailer in the data
+	offset uint64
+	header []byte
+	blocks []archiveBlock
+	group  int
+	parity [][]byte
+}
+
+// parseArchiveTrailer locates the archive trailer at the end of data using
+// one of the footers and parses it.
+func parseArchiveTrailer(data []byte, hasher *kanzihash.XXHash64) (*archiveTrailer, error) {
+	var res *archiveTrailer
+
+	for i := 1; i <= 2 && res == nil; i++ {
+		end := len(data) - (i-1)*_ARCHIVE_FOOTER_SIZE
+
+		if end < _ARCHIVE_FOOTER_SIZE {
+			break
+		}
+
+		footer := data[end-_ARCHIVE_FOOTER_SIZE : end]
+		size := binary.BigEndian.Uint64(footer[0:])
+
+		if binary.BigEndian.Uint32(footer[16:]) != _ARCHIVE_TYPE || size > uint64(len(data)) ||
+			size < _ARCHIVE_FIXED_SIZE+2*_ARCHIVE_FOOTER_SIZE {
+			continue
+		}
+
+		start := len(data) - int(size)
+		content := data[start : len(data)-2*_ARCHIVE_FOOTER_SIZE]
+
+		if hasher.Hash(content) != binary.BigEndian.Uint64(footer[8:]) {
+			continue
+		}
+
+		res = decodeArchiveTrailer(content)
+
+		if res != nil {
+			res.start = start
+		}
+	}
+
+	if res == nil {
+		return nil, &IOError{msg: "Cannot locate a valid archive trailer", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	return res, nil
+}
+
+// decodeArchiveTrailer parses the content of a trailer (checksum verified)
+func decodeArchiveTrailer(content []byte) *archiveTrailer {
+	idx := 0
+
+	next := func(n int) []byte {
+		if n < 0 || idx+n > len(content) {
+			return nil
+		}
+
+		idx += n
+		return content[idx-n : idx]
+	}
+
+	if next(12) == nil {
+		return nil
+	}
+
+	if v := next(1); v == nil || v[0] != _ARCHIVE_VERSION {
+		return nil
+	}
+
+	res := &archiveTrailer{}
+	res.offset = binary.BigEndian.Uint64(next(8))
+	b := next(2)
+
+	if b == nil {
+		return nil
+	}
+
+	if res.header = next(int(binary.BigEndian.Uint16(b))); res.header == nil {
+		return nil
+	}
+
+	if next(8+sha256.Size) == nil {
+		return nil
+	}
+
+	if b = next(5); b == nil || b[4] == 0 {
+		return nil
+	}
+
+	nbBlocks := int(binary.BigEndian.Uint32(b))
+	res.group = int(b[4])
+
+	if nbBlocks > len(content)/24 {
+		return nil
+	}
+
+	res.blocks = make([]archiveBlock, nbBlocks)
+
+	for i := range res.blocks {
+		b = next(24)
+		res.blocks[i] = archiveBlock{offset: binary.BigEndian.Uint64(b[0:]), length: binary.BigEndian.Uint32(b[8:]),
+			size: binary.BigEndian.Uint32(b[12:]), hash: binary.BigEndian.Uint64(b[16:])}
+	}
+
+	res.parity = make([][]byte, (nbBlocks+res.group-1)/res.group)
+
+	for i := range res.parity {
+		if b = next(4); b == nil {
+			return nil
+		}
+
+		if res.parity[i] = next(int(binary.BigEndian.Uint32(b))); res.parity[i] == nil {
+			return nil
+		}
+	}
+
+	return res
+}
+
+// RepairArchive checks a stream written in archival mode (the stream must
+// end the data, a prefix such as previous chained streams is allowed) and
+// repairs it in place when possible: the header is restored from its copy in
+// the trailer and each parity group can restore one damaged block. An error
+// is returned if the trailer cannot be found or if some damaged blocks
+// cannot be restored. The block checksums and the stream digest are checked
+// when the repaired stream is decoded.
+func RepairArchive(data []byte) (*ArchiveReport, error) {
+	hasher, err := kanzihash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	trailer, err := parseArchiveTrailer(data, hasher)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if trailer.offset > uint64(trailer.start) {
+		return nil, &IOError{msg: "Invalid archive trailer: bad offset", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	res := &ArchiveReport{Blocks: len(trailer.blocks)}
+	streamStart := trailer.start - int(trailer.offset)
+	content := data[trailer.start : len(data)-2*_ARCHIVE_FOOTER_SIZE]
+	var footer [_ARCHIVE_FOOTER_SIZE]byte
+	binary.BigEndian.PutUint64(footer[0:], uint64(len(data)-trailer.start))
+	binary.BigEndian.PutUint64(footer[8:], hasher.Hash(content))
+	binary.BigEndian.PutUint32(footer[16:], _ARCHIVE_TYPE)
+
+	for i := 1; i <= 2; i++ {
+		if f := data[len(data)-i*_ARCHIVE_FOOTER_SIZE : len(data)-(i-1)*_ARCHIVE_FOOTER_SIZE]; bytes.Equal(f, footer[:]) == false {
+			copy(f, footer[:])
+			res.FooterRepaired = true
+		}
+	}
+
+	if streamStart+len(trailer.header) > trailer.start {
+		return res, &IOError{msg: "Invalid archive trailer: bad header size", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	if header := data[streamStart : streamStart+len(trailer.header)]; bytes.Equal(header, trailer.header) == false {
+		copy(header, trailer.header)
+		res.HeaderRepaired = true
+	}
+
+	records := make([][]byte, len(trailer.blocks))
+
+	for i, b := range trailer.blocks {
+		start := uint64(streamStart) + b.offset
+		end := start + uint64(b.length)
+
+		if end > uint64(trailer.start) {
+			return res, &IOError{msg: fmt.Sprintf("Invalid archive index: block %d", i+1), code: kanzi.ERR_INVALID_FILE}
+		}
+
+		records[i] = data[start:end]
+
+		if hasher.Hash(records[i]) != b.hash {
+			res.Damaged = append(res.Damaged, i+1)
+		}
+	}
+
+	lost := 0
+
+	for _, id := range res.Damaged {
+		g := (id - 1) / trailer.group
+		damaged := 0
+		rebuilt := append([]byte(nil), trailer.parity[g]...)
+
+		for i := g * trailer.group; i < min((g+1)*trailer.group, len(records)); i++ {
+			if i == id-1 {
+				continue
+			}
+
+			if hasher.Hash(records[i]) != trailer.blocks[i].hash {
+				damaged++
+			}
+
+			xorBytes(rebuilt, records[i])
+		}
+
+		rec := records[id-1]
+
+		if damaged > 0 || len(rebuilt) < len(rec) || hasher.Hash(rebuilt[0:len(rec)]) != trailer.blocks[id-1].hash {
+			lost++
+			continue
+		}
+
+		copy(rec, rebuilt)
+		res.Repaired = append(res.Repaired, id)
+	}
+
+	if lost > 0 {
+		errMsg := fmt.Sprintf("Cannot repair %d damaged block(s) out of %d", lost, len(res.Damaged))
+		return res, &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return res, nil
+}
+
+// xorBytes XORs src into dst (len(dst) >= len(src))
+func xorBytes(dst, src []byte) {
+	for i := range src {
+		dst[i] ^= src[i]
+	}
+}
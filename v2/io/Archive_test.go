@@ -0,0 +1,132 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestArchival(t *testing.T) {
+	fmt.Println("Archival Test")
+	data := []byte(strings.Repeat("Archives must remain readable for decades. ", 30000))
+
+	for i := 0; i < len(data); i += 7919 {
+		data[i] = byte(rand.Intn(256))
+	}
+
+	decompress := func(input []byte, archival bool) ([]byte, error) {
+		res, _, err := decompressData(input, map[string]any{"jobs": uint(2), "archival": archival, "chained": true})
+		return res, err
+	}
+
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(65536),
+		"jobs": uint(4), "checksum": uint(0), "archival": true}
+	archive := compressData(t, data, ctx)
+
+	for _, archival := range []bool{true, false} {
+		res, err := decompress(archive, archival)
+
+		if err != nil {
+			t.Fatalf("Decompression failed (archival=%v): %v", archival, err)
+		}
+
+		if bytes.Equal(res, data) == false {
+			t.Errorf("Roundtrip failed (archival=%v)", archival)
+		}
+	}
+
+	report, err := RepairArchive(append([]byte(nil), archive...))
+
+	if err != nil || len(report.Damaged) != 0 || report.Blocks != (len(data)+65535)/65536 {
+		t.Fatalf("Unexpected report for intact archive: %+v, %v", report, err)
+	}
+
+	hasher, _ := hash.NewXXHash64(_BITSTREAM_TYPE)
+	trailer, err := parseArchiveTrailer(archive, hasher)
+
+	if err != nil {
+		t.Fatalf("Cannot parse trailer: %v", err)
+	}
+
+	// Damage the header, two blocks in different parity groups and a footer
+	damaged := append([]byte(nil), archive...)
+	damaged[5] ^= 0x55
+	damaged[trailer.blocks[2].offset+10] ^= 0xFF
+	damaged[trailer.blocks[10].offset+uint64(trailer.blocks[10].length/2)] ^= 0x01
+	damaged[len(damaged)-3] ^= 0x10
+	report, err = RepairArchive(damaged)
+
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+
+	if report.HeaderRepaired == false || report.FooterRepaired == false || len(report.Repaired) != 2 {
+		t.Errorf("Unexpected repair report: %+v", report)
+	}
+
+	if bytes.Equal(damaged, archive) == false {
+		t.Errorf("The repaired archive does not match the original one")
+	}
+
+	// Two damaged blocks in the same group cannot be restored
+	damaged = append([]byte(nil), archive...)
+	damaged[trailer.blocks[0].offset+20] ^= 0xFF
+	damaged[trailer.blocks[1].offset+20] ^= 0xFF
+
+	if _, err = RepairArchive(damaged); err == nil {
+		t.Errorf("Repair of two blocks in the same parity group should fail")
+	}
+
+	// The stream digest is checked by the archival Reader only
+	damaged = append([]byte(nil), archive...)
+	damaged[trailer.start+_ARCHIVE_FIXED_SIZE+len(trailer.header)-1] ^= 0xFF
+
+	if _, err = decompress(damaged, true); err == nil {
+		t.Errorf("Stream digest mismatch not detected")
+	}
+
+	if _, err = decompress(damaged, false); err != nil {
+		t.Errorf("Decompression failed: %v", err)
+	}
+
+	// Streams without trailer are rejected by the archival Reader
+	delete(ctx, "archival")
+	plain := compressData(t, data, ctx)
+
+	if _, err = decompress(plain, true); err == nil {
+		t.Errorf("Missing trailer not detected")
+	}
+
+	// Streams chained after an archival stream
+	ctx["archival"] = true
+	res, err := decompress(append(append([]byte(nil), archive...), plain...), false)
+
+	if err != nil || len(res) != 2*len(data) {
+		t.Errorf("Decompression of chained streams failed: %d bytes, %v", len(res), err)
+	}
+
+	ctx["checksum"] = uint(32)
+
+	if _, err = NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+		t.Errorf("32 bit checksums should be rejected in archival mode")
+	}
+}
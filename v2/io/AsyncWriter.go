@@ -0,0 +1,225 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"io"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// AsyncWriter a compressed stream writer that encodes in the background.
+// Write copies the data to a bounded queue and returns immediately unless
+// the queue is full. Errors of the background encoding are reported by the
+// next call to Write, Drain or Close. Not available in single thread builds
+// (kanzi_singlethread).
+type AsyncWriter struct {
+	writer  *Writer
+	queue   chan []byte
+	quit    chan struct{}
+	done    chan struct{}
+	lock    sync.Mutex
+	cond    *sync.Cond
+	pending int   // blocks queued or being encoded
+	err     error // first error (or error provided to CloseWithError)
+	closed  bool
+}
+
+// NewAsyncWriter creates a new instance of AsyncWriter writing a compressed
+// stream to os. The context is the one of NewWriterWithCtx. At most
+// queueDepth blocks of data (as provided to Write) are waiting to be encoded.
+func NewAsyncWriter(os io.WriteCloser, ctx map[string]any, queueDepth int) (*AsyncWriter, error) {
+	if queueDepth < 1 {
+		return nil, &IOError{msg: "Invalid queue depth (must be at least 1)", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	// The blocks are encoded by a background goroutine
+	if _SINGLE_THREAD == true {
+		return nil, &IOError{msg: "The async writer is not available in single thread builds", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	w, err := NewWriterWithCtx(os, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	this := &AsyncWriter{writer: w}
+	this.queue = make(chan []byte, queueDepth)
+	this.quit = make(chan struct{})
+	this.done = make(chan struct{})
+	this.cond = sync.NewCond(&this.lock)
+	go this.run()
+	return this, nil
+}
+
+// run encodes the queued blocks until the writer is closed
+func (this *AsyncWriter) run() {
+	defer close(this.done)
+
+	for {
+		select {
+		case block := <-this.queue:
+			this.lock.Lock()
+			failed := this.err != nil
+			this.lock.Unlock()
+
+			// Once failed, the remaining blocks are dropped
+			if failed == false {
+				if _, err := this.writer.Write(block); err != nil {
+					this.setError(err)
+				}
+			}
+
+			this.lock.Lock()
+			this.pending--
+			this.cond.Broadcast()
+			this.lock.Unlock()
+
+		case <-this.quit:
+			return
+		}
+	}
+}
+
+func (this *AsyncWriter) setError(err error) {
+	this.lock.Lock()
+
+	if this.err == nil {
+		this.err = err
+	}
+
+	this.cond.Broadcast()
+	this.lock.Unlock()
+}
+
+// Write queues a copy of block for encoding. It blocks only if the queue
+// is full.
+func (this *AsyncWriter) Write(block []byte) (int, error) {
+	this.lock.Lock()
+
+	if this.err != nil {
+		err := this.err
+		this.lock.Unlock()
+		return 0, err
+	}
+
+	if this.closed == true {
+		this.lock.Unlock()
+		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if len(block) == 0 {
+		this.lock.Unlock()
+		return 0, nil
+	}
+
+	this.pending++
+	this.lock.Unlock()
+	buf := make([]byte, len(block))
+	copy(buf, block)
+
+	select {
+	case this.queue <- buf:
+		return len(block), nil
+
+	case <-this.quit:
+		this.lock.Lock()
+		this.pending--
+		err := this.err
+		this.lock.Unlock()
+
+		if err == nil {
+			err = &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+		}
+
+		return 0, err
+	}
+}
+
+// wait blocks until all the queued blocks have been encoded (or dropped)
+func (this *AsyncWriter) wait() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for this.pending > 0 {
+		this.cond.Wait()
+	}
+
+	return this.err
+}
+
+// Drain blocks until all the data queued so far has been encoded, then
+// flushes it to the output (see Writer.Flush).
+func (this *AsyncWriter) Drain() error {
+	if err := this.wait(); err != nil {
+		return err
+	}
+
+	if err := this.writer.Flush(); err != nil {
+		this.setError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Close encodes the queued data and completes the compressed stream
+func (this *AsyncWriter) Close() error {
+	return this.CloseWithError(nil)
+}
+
+// CloseWithError closes the writer. If err is nil, the queued data is
+// encoded and the stream is completed (see Writer.Close). Otherwise, the
+// queued data is dropped, the stream is left incomplete and err is returned
+// by subsequent calls. It does not wait for a block being encoded.
+func (this *AsyncWriter) CloseWithError(err error) error {
+	this.lock.Lock()
+
+	if this.closed == true {
+		this.lock.Unlock()
+		return nil
+	}
+
+	this.closed = true
+
+	if err != nil && this.err == nil {
+		this.err = err
+	}
+
+	this.lock.Unlock()
+
+	if err != nil {
+		close(this.quit)
+		return nil
+	}
+
+	res := this.wait()
+	close(this.quit)
+	<-this.done
+
+	if res != nil {
+		return res
+	}
+
+	return this.writer.Close()
+}
+
+// GetWritten returns the number of bytes written to the output so far
+func (this *AsyncWriter) GetWritten() uint64 {
+	return this.writer.GetWritten()
+}
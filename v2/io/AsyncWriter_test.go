@@ -0,0 +1,142 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"testing"
+	"time"
+)
+
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (this blockingWriter) Write(b []byte) (int, error) {
+	<-this.release
+	return len(b), nil
+}
+
+func (this blockingWriter) Close() error {
+	return nil
+}
+
+func TestAsyncWriter(t *testing.T) {
+	fmt.Println("Async Writer Test")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20000)
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(65536),
+		"jobs": uint(2), "checksum": uint(32)}
+
+	if _, err := NewAsyncWriter(internal.NewBufferStream(), ctx, 0); errors.Is(err, ErrInvalidParam) == false {
+		t.Errorf("Expected invalid queue depth error, got %v", err)
+	}
+
+	if _SINGLE_THREAD == true {
+		if _, err := NewAsyncWriter(internal.NewBufferStream(), ctx, 4); errors.Is(err, ErrInvalidParam) == false {
+			t.Errorf("Expected the async writer to be rejected in single thread builds, got %v", err)
+		}
+
+		return
+	}
+
+	// Round trip
+	bs := internal.NewBufferStream()
+	w, err := NewAsyncWriter(bs, ctx, 4)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	chunk := make([]byte, 10000)
+
+	for i := 0; i < len(text); i += len(chunk) {
+		// The data is copied: the buffer can be reused
+		n := copy(chunk, text[i:])
+
+		if _, err = w.Write(chunk[0:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if i == len(text)/2 {
+			if err = w.Drain(); err != nil || w.GetWritten() == 0 {
+				t.Errorf("Drain failed: %v (%d bytes written)", err, w.GetWritten())
+			}
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if res, _, err := decompressData(bs.Bytes(), nil); err != nil || bytes.Equal(res, text) == false {
+		t.Errorf("Invalid decompressed data: %v", err)
+	}
+
+	if _, err = w.Write(text[0:10]); errors.Is(err, ErrWriteFile) == false {
+		t.Errorf("Expected error after close, got %v", err)
+	}
+
+	// Errors of the output are reported by the following calls
+	failure := errors.New("connection reset")
+	w, _ = NewAsyncWriter(failingWriter{err: failure}, ctx, 2)
+	err = nil
+
+	for i := 0; i < len(text) && err == nil; i += 65536 {
+		_, err = w.Write(text[i:min(i+65536, len(text))])
+	}
+
+	if err == nil {
+		err = w.Drain()
+	}
+
+	if errors.Is(err, failure) == false || errors.Is(w.Close(), failure) == false {
+		t.Errorf("Expected output error, got %v", err)
+	}
+
+	// CloseWithError releases a Write blocked on a full queue
+	release := make(chan struct{})
+	w, _ = NewAsyncWriter(blockingWriter{release: release}, ctx, 1)
+	abort := errors.New("client gone")
+	res := make(chan error, 1)
+
+	go func() {
+		var err error
+
+		for err == nil {
+			_, err = w.Write(text)
+		}
+
+		res <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	w.CloseWithError(abort)
+
+	select {
+	case err = <-res:
+		if errors.Is(err, abort) == false {
+			t.Errorf("Expected abort error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Write not released by CloseWithError")
+	}
+
+	close(release)
+}
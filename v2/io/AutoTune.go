@@ -0,0 +1,164 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"errors"
+
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Automatic codec selection (ctx["autoTune"] = true): the transform and
+// entropy codec of each block are selected by compressing a sample of the
+// block with a few candidate combinations (and the ones of the stream).
+// The size of each candidate is weighted by a static cost reflecting its
+// speed (so that the choice does not depend on the machine or the load)
+// and the smallest wins. The selected codecs are stored in the block
+// header (48 bits for the transform and 8 bits for the entropy codec).
+
+const (
+	_AUTO_TUNE_CHUNK_SIZE = 4096 // size of each sampled chunk
+	_AUTO_TUNE_CHUNKS     = 3    // chunks at the start, middle and end of the block
+	_AUTO_TUNE_BLOCK_BITS = 56   // size of the codec selection in the block header
+)
+
+type autoTuneCandidate struct {
+	transform string
+	entropy   string
+	cost      int // size penalty in percent (slower codecs cost more)
+}
+
+var autoTuneCandidates = []autoTuneCandidate{
+	{transform: "NONE", entropy: "NONE", cost: 0},
+	{transform: "PACK+LZ", entropy: "HUFFMAN", cost: 1},
+	{transform: "DNA+LZ", entropy: "HUFFMAN", cost: 2},
+	{transform: "RLT+TEXT+UTF", entropy: "HUFFMAN", cost: 2},
+	{transform: "TEXT+UTF+PACK+MM+LZX", entropy: "HUFFMAN", cost: 3},
+	{transform: "BWT+RANK+ZRLT", entropy: "ANS0", cost: 5},
+	{transform: "TEXT+UTF+BWT+RANK+ZRLT", entropy: "ANS0", cost: 5},
+	{transform: "TEXT+UTF+BWT+SRT+ZRLT", entropy: "FPAQ", cost: 8},
+}
+
+// selectCodecs returns the transform and entropy types minimizing the
+// weighted compressed size of a sample of the block. The codecs of the
+// stream (tType and eType) are returned if no candidate does better.
+func selectCodecs(block []byte, ctx map[string]any, tType uint64, eType uint32, candidates []autoTuneCandidate) (uint64, uint32) {
+	sample := sampleBlock(block)
+	bestT, bestE := tType, eType
+	bestScore := -1
+
+	if size, err := trialCompress(sample, ctx, tType, eType); err == nil {
+		bestScore = size * 100
+	}
+
+	for _, c := range candidates {
+		t, err1 := transform.GetType(c.transform)
+		e, err2 := entropy.GetType(c.entropy)
+
+		if err1 != nil || err2 != nil || (t == tType && e == eType) {
+			continue
+		}
+
+		size, err := trialCompress(sample, ctx, t, e)
+
+		if err != nil {
+			continue
+		}
+
+		if score := size * (100 + c.cost); bestScore < 0 || score < bestScore {
+			bestT, bestE, bestScore = t, e, score
+		}
+	}
+
+	return bestT, bestE
+}
+
+// sampleBlock returns chunks from the start, middle and end of the block
+// (or the whole block if it is small)
+func sampleBlock(block []byte) []byte {
+	if len(block) <= _AUTO_TUNE_CHUNKS*_AUTO_TUNE_CHUNK_SIZE {
+		return block
+	}
+
+	res := make([]byte, 0, _AUTO_TUNE_CHUNKS*_AUTO_TUNE_CHUNK_SIZE)
+	step := (len(block) - _AUTO_TUNE_CHUNK_SIZE) / (_AUTO_TUNE_CHUNKS - 1)
+
+	for i := 0; i < _AUTO_TUNE_CHUNKS; i++ {
+		res = append(res, block[i*step:i*step+_AUTO_TUNE_CHUNK_SIZE]...)
+	}
+
+	return res
+}
+
+// trialCompress returns the compressed size of the sample using the
+// provided transform and entropy codec
+func trialCompress(sample []byte, ctx map[string]any, tType uint64, eType uint32) (size int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("Trial compression failed")
+		}
+	}()
+
+	trialCtx := make(map[string]any, len(ctx))
+
+	for k, v := range ctx {
+		trialCtx[k] = v
+	}
+
+	// The trial has its own block scratch (not the one of the task)
+	scratch := &internal.BlockScratch{Size: uint(len(sample))}
+
+	if s := internal.GetScratch(&ctx); s != nil {
+		scratch.Dictionary = s.Dictionary
+	}
+
+	trialCtx[internal.SCRATCH_KEY] = scratch
+	t, err := transform.New(&trialCtx, tType)
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Transforms may overwrite the input
+	src := make([]byte, len(sample))
+	copy(src, sample)
+	dst := make([]byte, t.MaxEncodedLen(len(src)))
+	_, length, err := t.Forward(src, dst)
+
+	if err != nil {
+		return 0, err
+	}
+
+	scratch.Size = length
+	bufStream := internal.NewBufferStream(make([]byte, 0, length+1024))
+	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
+	ee, err := entropy.NewEntropyEncoder(obs, trialCtx, eType)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = ee.Write(dst[0:length]); err != nil {
+		return 0, err
+	}
+
+	ee.Dispose()
+	obs.Close()
+	return int((obs.Written() + 7) >> 3), nil
+}
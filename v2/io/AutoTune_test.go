@@ -0,0 +1,96 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestAutoTune(t *testing.T) {
+	fmt.Println("Auto Tune Test")
+
+	// Blocks of text, random data and DNA
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1500)[0:65536]
+	random := make([]byte, 65536)
+	rand.Read(random)
+	dna := make([]byte, 65536)
+
+	for i := range dna {
+		dna[i] = "ACGT"[rand.Intn(4)]
+	}
+
+	data := append(append(append([]byte(nil), text...), random...), dna...)
+
+	for _, headerless := range []bool{false, true} {
+		ctx := map[string]any{"transform": "NONE", "entropy": "NONE", "blockSize": uint(65536),
+			"jobs": uint(2), "checksum": uint(0), "autoTune": true, "headerless": headerless}
+		output := compressData(t, data, ctx)
+		fmt.Printf("Headerless=%v: %d => %d\n", headerless, len(data), len(output))
+
+		if len(output) >= len(data)*2/3 {
+			t.Errorf("No compression gain with automatic codec selection")
+		}
+
+		rctx := map[string]any{"jobs": uint(2), "blockInfo": true}
+
+		if headerless == true {
+			for k, v := range ctx {
+				rctx[k] = v
+			}
+
+			rctx["bsVersion"] = uint(_BITSTREAM_FORMAT_VERSION)
+			rctx["blockInfo"] = true
+		}
+
+		res, r, err := decompressData(output, rctx)
+
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if bytes.Equal(res, data) == false {
+			t.Fatalf("Invalid decompressed data")
+		}
+
+		if r.BlockInfoCount() != 3 {
+			t.Fatalf("Invalid number of blocks: %d", r.BlockInfoCount())
+		}
+
+		for i := 0; i < r.BlockInfoCount(); i++ {
+			info, _ := r.BlockInfo(i)
+			fmt.Printf("Block %d: %s&%s, %d => %d\n", info.ID, info.Transform, info.Entropy, info.DecodedSize, info.CompressedSize)
+		}
+
+		info1, _ := r.BlockInfo(0)
+		info2, _ := r.BlockInfo(1)
+		info3, _ := r.BlockInfo(2)
+
+		if info1.Transform == "NONE" || info1.Ratio() > 0.1 {
+			t.Errorf("Text block: expected a transform, got %s", info1.Transform)
+		}
+
+		if info2.Copied == false {
+			t.Errorf("Random block: expected a copy block, got %s&%s", info2.Transform, info2.Entropy)
+		}
+
+		if info3.Entropy == "NONE" || info3.Ratio() > 0.3 {
+			t.Errorf("DNA block: expected an entropy codec, got %s", info3.Entropy)
+		}
+	}
+}
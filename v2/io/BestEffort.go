@@ -0,0 +1,74 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+)
+
+// Best effort mode (ctx["bestEffort"] = true): a block that fails to decode
+// (invalid data, checksum mismatch, ...) is skipped and the decoding goes
+// on with the next block. The data of the block is missing from the output
+// and the block is reported to the ctx["onCorruptedBlock"] callback (if
+// any). Only the content of a block can be skipped: a corrupted block
+// length makes the rest of the stream unreadable and stops the decoding,
+// unless the blocks are preceded by sync markers (see Resync.go).
+// The stream digests (footer, archive trailer, manifest) are not checked
+// for the segments with skipped blocks.
+
+// CorruptedBlock describes a block skipped in best effort mode
+type CorruptedBlock struct {
+	Segment       int    // index of the segment (stream) of the block
+	BlockID       int    // ID of the block in the segment (starting at 1)
+	Start         uint64 // position of the block in the compressed input (bytes)
+	End           uint64 // position of the end of the block in the compressed input (bytes)
+	DecodedOffset int64  // position of the missing data in the decompressed output (bytes)
+	Err           error  // cause of the failure (*DecodingError)
+}
+
+func getCorruptedBlockCallback(ctx map[string]any) (func(CorruptedBlock), error) {
+	val, hasKey := ctx["onCorruptedBlock"]
+
+	if hasKey == false || val == nil {
+		return nil, nil
+	}
+
+	cb, ok := val.(func(CorruptedBlock))
+
+	if ok == false {
+		return nil, fmt.Errorf("Invalid corrupted block callback: %T", val)
+	}
+
+	return cb, nil
+}
+
+// skipBlock reports a block that could not be decoded
+func (this *Reader) skipBlock(r *decodingTaskResult, decodedOffset int64) {
+	this.damaged++
+
+	if this.onCorrupted == nil {
+		return
+	}
+
+	this.onCorrupted(CorruptedBlock{
+		Segment:       len(this.segments) - 1,
+		BlockID:       r.blockID,
+		Start:         r.offset >> 3,
+		End:           (r.end + 7) >> 3,
+		DecodedOffset: decodedOffset,
+		Err:           newDecodingError(r.err, r.blockID, r.offset),
+	})
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestBestEffort(t *testing.T) {
+	fmt.Println("Best Effort Test")
+
+	const blockSize = 32768
+	data := make([]byte, 200000)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(4*(i/20000+1)))
+	}
+
+	compressed := compressData(t, data, map[string]any{"transform": "LZ", "entropy": "HUFFMAN",
+		"blockSize": uint(blockSize), "jobs": uint(2), "checksum": uint(32)})
+	_, r, err := decompressData(compressed, map[string]any{"blockInfo": true})
+
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// Corrupt the payload of the 3rd block
+	info, _ := r.BlockInfo(2)
+	corrupted := bytes.Clone(compressed)
+	corrupted[info.Offset>>3+uint64(info.CompressedSize/2)] ^= 0x5A
+	expected := append(bytes.Clone(data[0:2*blockSize]), data[3*blockSize:]...)
+
+	if _, _, err = decompressData(corrupted, map[string]any{"jobs": uint(2)}); err == nil {
+		t.Errorf("Expected decoding error without best effort mode")
+	}
+
+	for _, jobs := range []uint{1, 2, 4} {
+		reports := make([]CorruptedBlock, 0)
+		ctx := map[string]any{"jobs": jobs, "bestEffort": true,
+			"onCorruptedBlock": func(b CorruptedBlock) { reports = append(reports, b) }}
+		r, err = NewReaderWithCtx(internal.NewBufferStream(corrupted), ctx)
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Read failed with %d jobs: %v", jobs, err)
+		}
+
+		if bytes.Equal(res, expected) == false {
+			t.Errorf("Invalid decompressed data with %d jobs: %d bytes", jobs, len(res))
+		}
+
+		if len(reports) != 1 {
+			t.Fatalf("Expected 1 corrupted block with %d jobs, got %d", jobs, len(reports))
+		}
+
+		b := reports[0]
+
+		if jobs == 1 {
+			fmt.Printf("Skipped block %d: bytes [%d..%d), decoded offset %d: %v\n", b.BlockID, b.Start, b.End, b.DecodedOffset, b.Err)
+		}
+
+		if b.BlockID != 3 || b.DecodedOffset != 2*blockSize || b.Start != info.Offset>>3 || b.End-b.Start < uint64(info.CompressedSize) || b.Err == nil {
+			t.Errorf("Invalid corrupted block report: %+v", b)
+		}
+	}
+
+	if _, err = NewReaderWithCtx(internal.NewBufferStream(corrupted), map[string]any{"jobs": uint(1), "onCorruptedBlock": 1}); err == nil {
+		t.Errorf("Expected error on invalid callback")
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Raw blocks: the transform + entropy pipeline applied to a single buffer,
+// without stream header nor block framing (no checksum either), to embed
+// kanzi in existing container formats. A raw block starts with a 4 byte
+// header (big endian): transform skip flags (8 bits), stored flag (1 bit)
+// and length of the transformed data (23 bits). The entropy coded data
+// follows. Blocks that do not compress are stored (copied after the header).
+// The decoder must be provided the same options as the encoder.
+
+const (
+	_RAW_BLOCK_HEADER_SIZE = 4
+	_RAW_BLOCK_MAX_SIZE    = (1 << 23) - 1
+	_RAW_BLOCK_STORED_FLAG = 1 << 23
+)
+
+// Options the compression parameters of the raw block and pipe APIs
+type Options struct {
+	Transform string // EG. "TEXT+BWT+SRT+ZRLT", "NONE" if empty
+	Entropy   string // EG. "ANS0", "NONE" if empty
+	BlockSize uint   // streams only, 1 MB if 0
+	Jobs      uint   // streams only, 1 if 0
+	Checksum  uint   // streams only, 0 (none), 32 or 64
+}
+
+// context returns the codec types and a context map built from the options.
+// The context must not depend on the size of the original data, unknown
+// to the decoder: 'blockSize' is only set for the entropy codec.
+func (this Options) context() (uint64, uint32, map[string]any, error) {
+	t := this.Transform
+	e := this.Entropy
+
+	if t == "" {
+		t = "NONE"
+	}
+
+	if e == "" {
+		e = "NONE"
+	}
+
+	tType, err := transform.GetType(t)
+
+	if err != nil {
+		return 0, 0, nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	eType, err := entropy.GetType(e)
+
+	if err != nil {
+		return 0, 0, nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	ctx := make(map[string]any)
+	ctx["transform"] = t
+	ctx["entropy"] = e
+	ctx["jobs"] = uint(1)
+	ctx["bsVersion"] = uint(_BITSTREAM_FORMAT_VERSION)
+	ctx[internal.SCRATCH_KEY] = &internal.BlockScratch{}
+	return tType, eType, ctx, nil
+}
+
+// CompressBlockBound returns the max size of a raw block produced by
+// CompressBlock for an input of srcLen bytes.
+func CompressBlockBound(srcLen int) int {
+	return _RAW_BLOCK_HEADER_SIZE + srcLen
+}
+
+// CompressBlock compresses src into dst as a raw block (see above) and
+// returns the number of bytes written to dst. The size of src must be less
+// than 8 MB and dst must be at least CompressBlockBound(len(src)) bytes long.
+func CompressBlock(src, dst []byte, opts Options) (int, error) {
+	if len(src) > _RAW_BLOCK_MAX_SIZE {
+		errMsg := fmt.Sprintf("Invalid raw block size: %d (must be at most %d)", len(src), _RAW_BLOCK_MAX_SIZE)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_BLOCK_SIZE}
+	}
+
+	if n := CompressBlockBound(len(src)); len(dst) < n {
+		errMsg := fmt.Sprintf("Output buffer too small: %d, required %d", len(dst), n)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+	}
+
+	tType, eType, ctx, err := opts.context()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(src) <= _SMALL_BLOCK_SIZE {
+		return storeBlock(src, dst), nil
+	}
+
+	scratch := internal.GetScratch(&ctx)
+	scratch.Size = uint(len(src))
+	t, err := transform.New(&ctx, tType)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
+	}
+
+	buffer := make([]byte, max(t.MaxEncodedLen(len(src)), len(src)))
+	skipFlags := byte(0xFF)
+	length := len(src)
+
+	if len(src) > 0 && tType != transform.NONE_TYPE {
+		// Transforms may overwrite the input
+		input := make([]byte, len(buffer))
+		copy(input, src)
+
+		if _, n, err := t.Forward(input[0:len(src)], buffer); err == nil && n <= _RAW_BLOCK_MAX_SIZE {
+			skipFlags = t.SkipFlags()
+			length = int(n)
+		}
+	}
+
+	if skipFlags == 0xFF {
+		copy(buffer, src)
+		length = len(src)
+	}
+
+	ctx["blockSize"] = uint(length)
+	scratch.Size = uint(length)
+	scratch.InvalidateHistogram()
+	bufStream := internal.NewBufferStream(make([]byte, 0, len(src)))
+	obs, err := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	ee, err := entropy.NewEntropyEncoder(obs, ctx, eType)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
+	}
+
+	if _, err = ee.Write(buffer[0:length]); err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+	}
+
+	ee.Dispose()
+	obs.Close()
+	data := bufStream.Bytes()
+
+	if len(data) >= len(src) {
+		// No compression
+		return storeBlock(src, dst), nil
+	}
+
+	binary.BigEndian.PutUint32(dst, uint32(skipFlags)<<24|uint32(length))
+	copy(dst[_RAW_BLOCK_HEADER_SIZE:], data)
+	return _RAW_BLOCK_HEADER_SIZE + len(data), nil
+}
+
+// storeBlock copies src uncompressed as a raw block
+func storeBlock(src, dst []byte) int {
+	binary.BigEndian.PutUint32(dst, uint32(0xFF)<<24|_RAW_BLOCK_STORED_FLAG|uint32(len(src)))
+	return _RAW_BLOCK_HEADER_SIZE + copy(dst[_RAW_BLOCK_HEADER_SIZE:], src)
+}
+
+// DecompressBlock decompresses the raw block in src (produced by
+// CompressBlock with the same options) into dst and returns the number
+// of bytes written to dst.
+func DecompressBlock(src, dst []byte, opts Options) (n int, err error) {
+	if len(src) < _RAW_BLOCK_HEADER_SIZE {
+		return 0, &IOError{msg: "Invalid raw block: missing header", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	header := binary.BigEndian.Uint32(src)
+	skipFlags := byte(header >> 24)
+	length := int(header & _RAW_BLOCK_MAX_SIZE)
+
+	if header&_RAW_BLOCK_STORED_FLAG != 0 {
+		if len(src) < _RAW_BLOCK_HEADER_SIZE+length {
+			return 0, &IOError{msg: "Invalid raw block: truncated data", code: kanzi.ERR_INVALID_FILE}
+		}
+
+		if len(dst) < length {
+			errMsg := fmt.Sprintf("Output buffer too small: %d, required %d", len(dst), length)
+			return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+		}
+
+		return copy(dst, src[_RAW_BLOCK_HEADER_SIZE:_RAW_BLOCK_HEADER_SIZE+length]), nil
+	}
+
+	tType, eType, ctx, err := opts.context()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		// Corrupted data may make the codecs panic
+		if r := recover(); r != nil {
+			n = 0
+			err = &IOError{msg: fmt.Sprintf("Invalid raw block: %v", r), code: kanzi.ERR_PROCESS_BLOCK}
+		}
+	}()
+
+	ctx["blockSize"] = uint(length)
+	internal.GetScratch(&ctx).Size = uint(length)
+	ibs, err := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(src[_RAW_BLOCK_HEADER_SIZE:]), 16384)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	ed, err := entropy.NewEntropyDecoder(ibs, ctx, eType)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
+	}
+
+	buffer := make([]byte, length)
+
+	if _, err = ed.Read(buffer); err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+	}
+
+	ed.Dispose()
+	ibs.Close()
+
+	if skipFlags == 0xFF {
+		if len(dst) < length {
+			errMsg := fmt.Sprintf("Output buffer too small: %d, required %d", len(dst), length)
+			return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+		}
+
+		return copy(dst, buffer), nil
+	}
+
+	t, err := transform.New(&ctx, tType)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
+	}
+
+	// Some inverse transforms require extra room in the output buffer
+	output := make([]byte, max(len(dst), length)+_EXTRA_BUFFER_SIZE)
+	t.SetSkipFlags(skipFlags)
+	_, oIdx, err := t.Inverse(buffer, output)
+
+	if err != nil {
+		return 0, &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+	}
+
+	if int(oIdx) > len(dst) {
+		errMsg := fmt.Sprintf("Output buffer too small: %d, required %d", len(dst), oIdx)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+	}
+
+	return copy(dst, output[0:oIdx]), nil
+}
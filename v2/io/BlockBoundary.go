@@ -0,0 +1,56 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+)
+
+// Block boundaries (ctx["onBlock"] = func(BlockBoundary)): the Writer calls
+// the function for each block, in block order, when the block is written to
+// the bitstream. It maps the input offsets to the compressed blocks (EG. to
+// build an external index) without decoding the stream. The function is
+// called by the encoding tasks and must return quickly.
+// The blocks of a Writer with a block callback are byte aligned, so that
+// decoding can start at a block (headerless Reader with the parameters of
+// the stream). The compressed offsets are counted from the start of the
+// stream, including the blocks written before OpenWriterForAppend (if these
+// blocks are not byte aligned, the first appended block starts within the
+// byte at the reported offset).
+
+// BlockBoundary describes a block written by a Writer
+type BlockBoundary struct {
+	BlockID            int    // ID of the block in the stream (starting at 1)
+	UncompressedOffset int64  // position of the block data in the input (bytes)
+	UncompressedSize   int    // size of the block data (bytes)
+	CompressedOffset   uint64 // position of the block in the compressed output (bytes)
+}
+
+func getBlockCallback(ctx map[string]any) (func(BlockBoundary), error) {
+	val, hasKey := ctx["onBlock"]
+
+	if hasKey == false || val == nil {
+		return nil, nil
+	}
+
+	cb, ok := val.(func(BlockBoundary))
+
+	if ok == false {
+		return nil, fmt.Errorf("Invalid block callback: %T", val)
+	}
+
+	return cb, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlockCallback(t *testing.T) {
+	fmt.Println("Block Callback Test")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 5000)
+
+	for _, codecs := range [][2]string{{"LZ", "HUFFMAN"}, {"NONE", "NONE"}} {
+		boundaries := make([]BlockBoundary, 0)
+		ctx := map[string]any{"transform": codecs[0], "entropy": codecs[1], "blockSize": uint(16384),
+			"jobs": uint(4), "checksum": uint(32),
+			"onBlock": func(b BlockBoundary) { boundaries = append(boundaries, b) }}
+		_, r := roundTrip(t, text, ctx, map[string]any{"blockInfo": true})
+
+		if len(boundaries) != r.BlockInfoCount() || len(boundaries) != (len(text)+16383)/16384 {
+			t.Fatalf("%v: incorrect number of blocks: %d", codecs, len(boundaries))
+		}
+
+		offset := int64(0)
+
+		for i, b := range boundaries {
+			info, _ := r.BlockInfo(i)
+
+			if b.BlockID != i+1 || b.UncompressedOffset != offset || 8*b.CompressedOffset != info.Offset {
+				t.Errorf("%v: incorrect block boundary %+v (block info %+v)", codecs, b, info)
+			}
+
+			offset += int64(b.UncompressedSize)
+		}
+
+		if offset != int64(len(text)) {
+			t.Errorf("%v: incorrect total size: %d", codecs, offset)
+		}
+	}
+
+	ctx := map[string]any{"transform": "LZ", "entropy": "NONE", "blockSize": uint(16384),
+		"jobs": uint(1), "checksum": uint(0), "onBlock": func(int) {}}
+
+	if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); errors.Is(err, ErrInvalidParam) == false {
+		t.Errorf("Expected invalid parameter error, got %v", err)
+	}
+}
+
+// Decoding from the offsets reported by the block callback of a stream
+// extended with OpenWriterForAppend
+func TestBlockBoundarySeek(t *testing.T) {
+	fmt.Println("Block Boundary Seek Test")
+
+	path := filepath.Join(t.TempDir(), "log.knz")
+	f, _ := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	defer f.Close()
+	boundaries := make([]BlockBoundary, 0)
+	starts := make([]int64, 0) // offset of each block in the whole input
+	expected := make([]byte, 0)
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(4096),
+		"jobs": uint(3), "checksum": uint(32)}
+
+	for i := 0; i < 3; i++ {
+		base := int64(len(expected))
+		ctx["onBlock"] = func(b BlockBoundary) {
+			boundaries = append(boundaries, b)
+			starts = append(starts, base+b.UncompressedOffset)
+		}
+
+		w, err := OpenWriterForAppend(f, ctx)
+
+		if err != nil {
+			t.Fatalf("Append %d: cannot open writer: %v", i, err)
+		}
+
+		day := []byte(fmt.Sprintf("day %d: %s", i, strings.Repeat("GET /index.html 200 ", 700+i*333)))
+		w.Write(day)
+		expected = append(expected, day...)
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Append %d: close failed: %v", i, err)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	_, r, err := decompressData(data, map[string]any{"blockInfo": true})
+
+	if err != nil || len(boundaries) != r.BlockInfoCount() {
+		t.Fatalf("Expected %d blocks, got %d: %v", r.BlockInfoCount(), len(boundaries), err)
+	}
+
+	for i, b := range boundaries {
+		info, _ := r.BlockInfo(i)
+
+		if b.BlockID != info.ID || 8*b.CompressedOffset != info.Offset {
+			t.Errorf("Incorrect block boundary %+v (block info %+v)", b, info)
+		}
+
+		// Decode from the block to the end of the stream
+		res, _, err := decompressData(data[b.CompressedOffset:], map[string]any{"headerless": true,
+			"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(4096), "checksum": uint(32),
+			"bsVersion": uint(_BITSTREAM_BASE_VERSION)})
+
+		if err != nil || bytes.Equal(res, expected[starts[i]:]) == false {
+			t.Errorf("Block %d: invalid data decoded from offset %d: %v", b.BlockID, b.CompressedOffset, err)
+		}
+	}
+}
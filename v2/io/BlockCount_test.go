@@ -0,0 +1,82 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockCount(t *testing.T) {
+	fmt.Println("Block Count Test")
+	values := make([]byte, 100*1024+1)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + 65)
+	}
+
+	for _, fileSize := range []int64{int64(len(values)), 0} {
+		for _, flush := range []bool{false, true} {
+			bs := internal.NewBufferStream()
+			w, _ := NewWriter(bs, "NONE", "HUFFMAN", 1024, 4, 0, fileSize, false)
+			expected := 101
+
+			if flush == true {
+				// Flushed blocks are shorter: the original size does not
+				// give the number of blocks
+				w.Write(values[0:100])
+				w.Flush()
+				w.Write(values[100:200])
+				w.Flush()
+				expected++
+				w.Write(values[200:])
+			} else {
+				w.Write(values)
+			}
+
+			w.Close()
+
+			r, _ := NewReader(internal.NewBufferStream(bytes.Clone(bs.Bytes())), 8)
+			res := make([]byte, 10)
+
+			if _, err := io.ReadFull(r, res); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if count, known := r.BlockCount(); known == true {
+				t.Errorf("Expected unknown block count before the end block, got %d", count)
+			}
+
+			if rest, err := io.ReadAll(r); err != nil || !bytes.Equal(append(res, rest...), values) {
+				t.Fatalf("Incorrect decompressed data: %v", err)
+			}
+
+			count, known := r.BlockCount()
+
+			if known == false || count != expected {
+				t.Errorf("Expected %d blocks, got %d (known: %v)", expected, count, known)
+			}
+
+			if r.Segments()[0].BlockCount != count {
+				t.Errorf("Incorrect segment block count: %d", r.Segments()[0].BlockCount)
+			}
+		}
+	}
+}
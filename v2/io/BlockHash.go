@@ -0,0 +1,126 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+// Strong block hashes (ctx["blockHash"] = "XXH3" or "BLAKE3"): the 32/64 bit
+// block checksums are meant to detect corruption, not to identify blocks, and
+// collide too often at billions of blocks. With a strong hash, each block
+// carries the 128 bit XXH3 or the 256 bit BLAKE3 digest of its original data
+// (unseeded, so that external tools compute the same values), written after
+// the block checksum. The hashes are computed by the encoding tasks, in
+// parallel, and verified by the decoder. The hash type is stored in the
+// header flags (bitstream version 7) and exposed in BlockInfo.Hash for dedup
+// and verification tooling.
+
+const (
+	_BLOCK_HASH_NONE   = 0
+	_BLOCK_HASH_XXH3   = 1
+	_BLOCK_HASH_BLAKE3 = 2
+)
+
+func getBlockHashType(name string) (uint, error) {
+	switch strings.ToUpper(name) {
+	case "NONE", "":
+		return _BLOCK_HASH_NONE, nil
+	case "XXH3":
+		return _BLOCK_HASH_XXH3, nil
+	case "BLAKE3":
+		return _BLOCK_HASH_BLAKE3, nil
+	default:
+		return _BLOCK_HASH_NONE, fmt.Errorf("Unknown block hash: '%s'", name)
+	}
+}
+
+func getBlockHashName(hashType uint) string {
+	switch hashType {
+	case _BLOCK_HASH_XXH3:
+		return "XXH3"
+	case _BLOCK_HASH_BLAKE3:
+		return "BLAKE3"
+	default:
+		return "NONE"
+	}
+}
+
+// blockHasher computes the strong hash of blocks. Safe for concurrent use.
+type blockHasher struct {
+	hashType uint
+	xxh3     *hash.XXHash128
+	blake3   *hash.Blake3
+}
+
+// newBlockHasher returns the hasher of the provided type (nil for NONE)
+func newBlockHasher(hashType uint) (*blockHasher, error) {
+	var err error
+	this := &blockHasher{hashType: hashType}
+
+	switch hashType {
+	case _BLOCK_HASH_NONE:
+		return nil, nil
+	case _BLOCK_HASH_XXH3:
+		this.xxh3, err = hash.NewXXHash128(0)
+	case _BLOCK_HASH_BLAKE3:
+		this.blake3, err = hash.NewBlake3()
+	default:
+		err = fmt.Errorf("Invalid block hash type: %d", hashType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// bits returns the size of the hash in bits (0 if this is nil)
+func (this *blockHasher) bits() uint {
+	if this == nil {
+		return 0
+	}
+
+	if this.hashType == _BLOCK_HASH_XXH3 {
+		return 128
+	}
+
+	return 256
+}
+
+// sum returns the hash of the block data
+func (this *blockHasher) sum(block []byte) []byte {
+	if this.hashType == _BLOCK_HASH_XXH3 {
+		res := this.xxh3.Hash(block)
+		return res[:]
+	}
+
+	res := this.blake3.Hash(block)
+	return res[:]
+}
+
+// getType returns the hash type (_BLOCK_HASH_NONE if this is nil)
+func (this *blockHasher) getType() uint {
+	if this == nil {
+		return _BLOCK_HASH_NONE
+	}
+
+	return this.hashType
+}
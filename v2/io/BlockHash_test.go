@@ -0,0 +1,85 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestBlockHash(t *testing.T) {
+	fmt.Println("Block Hash Test")
+
+	// Text blocks followed by random (stored) blocks
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 3000)
+	random := make([]byte, 100000)
+	rand.Read(random)
+	data := append(append([]byte(nil), text...), random...)
+	xxh3, _ := hash.NewXXHash128(0)
+	blake3, _ := hash.NewBlake3()
+
+	for _, name := range []string{"XXH3", "BLAKE3"} {
+		for _, codecs := range [][2]string{{"TEXT+LZ", "HUFFMAN"}, {"NONE", "NONE"}} {
+			fmt.Printf("Block hash %s with %s/%s\n", name, codecs[0], codecs[1])
+			ctx := map[string]any{"transform": codecs[0], "entropy": codecs[1], "blockSize": uint(65536),
+				"jobs": uint(4), "checksum": uint(32), "blockHash": name}
+			output, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "blockInfo": true})
+			seg := r.Segments()[0]
+
+			if seg.BlockHash != name || seg.BitstreamVersion != _BITSTREAM_FORMAT_VERSION {
+				t.Errorf("Invalid segment: block hash %s, version %d", seg.BlockHash, seg.BitstreamVersion)
+			}
+
+			for i := 0; i < r.BlockInfoCount(); i++ {
+				info, _ := r.BlockInfo(i)
+				block := data[i*65536 : min((i+1)*65536, len(data))]
+				var expected []byte
+
+				if name == "XXH3" {
+					h := xxh3.Hash(block)
+					expected = h[:]
+				} else {
+					h := blake3.Hash(block)
+					expected = h[:]
+				}
+
+				if bytes.Equal(info.Hash, expected) == false {
+					t.Errorf("Block %d: invalid hash %x, expected %x", info.ID, info.Hash, expected)
+				}
+			}
+
+			// Corrupt the data of a stored block (NONE/NONE, no checksum)
+			if codecs[0] == "NONE" {
+				ctx["checksum"] = uint(0)
+				output = compressData(t, data, ctx)
+				output[len(output)/2] ^= 0x10
+
+				if _, _, err := decompressData(output, nil); err == nil {
+					t.Errorf("Expected error on corrupted block")
+				}
+			}
+		}
+	}
+
+	if _, err := NewWriterWithCtx(internal.NewBufferStream(), withDefaults(map[string]any{"blockHash": "MD5"})); err == nil {
+		t.Errorf("Expected error on invalid block hash")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"strings"
+)
+
+// BlockInfo describes a block decoded by a Reader. The Reader records the
+// blocks when created with ctx["blockInfo"] = true.
+type BlockInfo struct {
+	Segment        int    // index of the segment (stream) of the block
+	ID             int    // ID of the block in the segment (starting at 1)
+	Offset         uint64 // position of the block in the compressed input (in bits)
+	CompressedSize int    // size of the block data in the input (bytes)
+	EntropySize    int    // size after entropy decoding (bytes)
+	DecodedSize    int    // size of the decoded block (bytes)
+	Transform      string // transforms of the block ("NONE" for copied blocks)
+	SkipFlags      byte   // one bit per transform (MSB first), 1 means skipped
+	Entropy        string // entropy codec ("NONE" for copied blocks)
+	Copied         bool   // block stored uncompressed
+	Checksum       uint64 // block checksum (if any)
+	ChecksumSize   uint   // 0, 32 or 64 bits
+	Hash           []byte // strong hash of the original block data (see SegmentInfo.BlockHash)
+	RepeatOf       int    // ID of the identical earlier block (see SegmentInfo.Dedup), 0 if none
+}
+
+// AppliedTransforms returns the transforms that were not skipped
+func (this BlockInfo) AppliedTransforms() []string {
+	res := make([]string, 0)
+
+	if this.Transform == "" || this.Transform == "NONE" {
+		return res
+	}
+
+	for i, name := range strings.Split(this.Transform, "+") {
+		if i < 8 && this.SkipFlags&(1<<(7-uint(i))) == 0 {
+			res = append(res, name)
+		}
+	}
+
+	return res
+}
+
+// Ratio returns the compressed size divided by the decoded size
+func (this BlockInfo) Ratio() float64 {
+	if this.DecodedSize == 0 {
+		return 0
+	}
+
+	return float64(this.CompressedSize) / float64(this.DecodedSize)
+}
+
+// BlockInfoCount returns the number of blocks recorded so far (all segments)
+func (this *Reader) BlockInfoCount() int {
+	return len(this.blockInfos)
+}
+
+// BlockInfo returns the information about the i-th decoded block (all
+// segments, starting at 0) and true if it has been recorded.
+func (this *Reader) BlockInfo(i int) (BlockInfo, bool) {
+	if i < 0 || i >= len(this.blockInfos) {
+		return BlockInfo{}, false
+	}
+
+	return this.blockInfos[i], true
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestBlockInfo(t *testing.T) {
+	fmt.Println("Block Info Test")
+
+	// Text blocks followed by random (incompressible) blocks
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 3000)
+	random := make([]byte, 100000)
+	rand.Read(random)
+	data := append(append([]byte(nil), text...), random...)
+	ctx := map[string]any{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "blockSize": uint(65536),
+		"jobs": uint(2), "checksum": uint(32)}
+	_, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "blockInfo": true})
+	nbBlocks := (len(data) + 65535) / 65536
+
+	if r.BlockInfoCount() != nbBlocks {
+		t.Fatalf("Invalid number of blocks: expected %d, got %d", nbBlocks, r.BlockInfoCount())
+	}
+
+	total := 0
+	offset := uint64(0)
+
+	for i := 0; i < r.BlockInfoCount(); i++ {
+		info, _ := r.BlockInfo(i)
+		fmt.Printf("Block %d: offset=%d, size=%d => %d, transforms=%v, entropy=%s, copied=%v\n",
+			info.ID, info.Offset, info.CompressedSize, info.DecodedSize, info.AppliedTransforms(), info.Entropy, info.Copied)
+
+		if info.ID != i+1 || info.Segment != 0 {
+			t.Errorf("Block %d: invalid id or segment: %d, %d", i, info.ID, info.Segment)
+		}
+
+		if info.Offset <= offset || info.ChecksumSize != 32 {
+			t.Errorf("Block %d: invalid offset or checksum size: %d, %d", i, info.Offset, info.ChecksumSize)
+		}
+
+		offset = info.Offset
+		total += info.DecodedSize
+	}
+
+	if total != len(data) {
+		t.Errorf("Invalid total decoded size: expected %d, got %d", len(data), total)
+	}
+
+	first, _ := r.BlockInfo(0)
+	last, _ := r.BlockInfo(nbBlocks - 1)
+
+	if first.Copied == true || len(first.AppliedTransforms()) == 0 || first.Ratio() > 0.5 {
+		t.Errorf("First block: text block not compressed")
+	}
+
+	if len(last.AppliedTransforms()) != 0 {
+		t.Errorf("Last block: no transform expected on random data, got %v", last.AppliedTransforms())
+	}
+
+	if _, ok := r.BlockInfo(nbBlocks); ok == true {
+		t.Errorf("Unexpected block info out of range")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Block range decoding (Reader.SetRange or ctx["from"] and ctx["to"], int):
+// Read only returns the original data of the blocks in [from, to), the
+// blocks being numbered from 1 (to = 0 for the end of the stream). If the
+// stream has a seek table (see SeekTable.go), the blocks of the range are
+// read directly from the input and the other blocks are never read.
+// Otherwise, the blocks before the range are read and skipped, and the
+// input is not read past the end of the range (unless chained streams are
+// decoded: the range then applies to each stream). The blocks decoded with
+// the seek table are not reported to the listeners nor in the block infos.
+
+// blockRange the blocks selected for decoding
+type blockRange struct {
+	from     int   // first block (starting at 1), 0 if none
+	to       int   // first block not decoded, 0 if none
+	opened   bool  // seek table looked up
+	seekable bool  // blocks read with the seek table
+	pos      int64 // next position in the original data (seek table)
+	end      int64 // end of the range in the original data (seek table)
+}
+
+// getBlockRange returns the block range in the context (nil if none)
+func getBlockRange(ctx map[string]any) (*blockRange, error) {
+	res := &blockRange{}
+	val1, hasFrom := ctx["from"]
+	val2, hasTo := ctx["to"]
+
+	if hasFrom == false && hasTo == false {
+		return nil, nil
+	}
+
+	ok1 := true
+	ok2 := true
+
+	if hasFrom == true {
+		res.from, ok1 = val1.(int)
+	}
+
+	if hasTo == true {
+		res.to, ok2 = val2.(int)
+	}
+
+	if ok1 == false || ok2 == false {
+		errMsg := fmt.Sprintf("Invalid block range: from %v to %v", val1, val2)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if err := validateBlockRange(res.from, res.to); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func validateBlockRange(from, to int) error {
+	if from < 0 || to < 0 || (to > 0 && to < from) {
+		errMsg := fmt.Sprintf("Invalid block range: [%d..%d)", from, to)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
+
+// SetRange selects the blocks returned by Read: from fromBlock (starting at
+// 1, 0 for the first block) to toBlock (excluded, 0 for the end of the
+// stream). Same as ctx["from"] and ctx["to"]. Must be called before the
+// first call to Read.
+func (this *Reader) SetRange(fromBlock, toBlock int) error {
+	if err := validateBlockRange(fromBlock, toBlock); err != nil {
+		return err
+	}
+
+	if loadInt32(&this.blockID) != 0 || this.decodedBytes != 0 || (this.blockRange != nil && this.blockRange.opened == true) {
+		return &IOError{msg: "The block range must be set before the first read", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.linked == true && (fromBlock != 0 || toBlock != 0) {
+		return &IOError{msg: "Partial decoding is not supported with linked blocks", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	// Also kept for a reset Reader (see Reset.go)
+	for _, ctx := range []map[string]any{this.ctx, this.options} {
+		delete(ctx, "from")
+		delete(ctx, "to")
+
+		if fromBlock != 0 {
+			ctx["from"] = fromBlock
+		}
+
+		if toBlock != 0 {
+			ctx["to"] = toBlock
+		}
+	}
+
+	this.blockRange = nil
+
+	if fromBlock != 0 || toBlock != 0 {
+		this.blockRange = &blockRange{from: fromBlock, to: toBlock}
+	}
+
+	return nil
+}
+
+// openBlockRange looks up the seek table on the first read of a block
+// range and returns true if the range is read with it
+func (this *Reader) openBlockRange() (bool, error) {
+	rg := this.blockRange
+
+	if rg.opened == true {
+		return rg.seekable, nil
+	}
+
+	rg.opened = true
+
+	if this.headless == true || this.chained == true || this.linked == true {
+		return false, nil
+	}
+
+	this.seek.once.Do(func() {
+		this.seek.reader, this.seek.err = this.openSeekTable()
+	})
+
+	if this.seek.err != nil {
+		// No seek table: sequential decoding
+		return false, nil
+	}
+
+	// Positions of the first block of the range and of the first block after
+	rr := this.seek.reader
+	rg.pos = 0
+	rg.end = rr.size
+
+	if rg.from > len(rr.blocks) {
+		rg.pos = rr.size
+	} else if rg.from > 1 {
+		rg.pos = rr.positions[rg.from-1]
+	}
+
+	if rg.to > 0 && rg.to <= len(rr.blocks) {
+		rg.end = max(rr.positions[rg.to-1], rg.pos)
+	}
+
+	if this.maxOutput > 0 && rg.end-rg.pos > this.maxOutput {
+		return false, newOutputLimitError("decoded data", rg.end-rg.pos, this.maxOutput)
+	}
+
+	rg.seekable = true
+	return true, nil
+}
+
+// readBlockRange reads the next bytes of the block range with the seek
+// table
+func (this *Reader) readBlockRange(block []byte) (int, error) {
+	rg := this.blockRange
+
+	if rg.pos >= rg.end {
+		return 0, io.EOF
+	}
+
+	if int64(len(block)) > rg.end-rg.pos {
+		block = block[0 : rg.end-rg.pos]
+	}
+
+	n, err := this.seek.reader.ReadAt(block, rg.pos)
+	rg.pos += int64(n)
+	this.decodedBytes += int64(n)
+
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+
+	return n, err
+}
+
+// blockRangeEnded returns true once the blocks of the range have been
+// decoded (sequential decoding of a single stream)
+func (this *Reader) blockRangeEnded() bool {
+	if this.blockRange == nil || this.blockRange.to == 0 || this.chained == true {
+		return false
+	}
+
+	return int(loadInt32(&this.blockID)) >= this.blockRange.to-1
+}
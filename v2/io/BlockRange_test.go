@@ -0,0 +1,200 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// countingInput an in memory input counting the bytes read
+type countingInput struct {
+	*bytes.Reader
+	read int64
+}
+
+func (this *countingInput) Read(buf []byte) (int, error) {
+	n, err := this.Reader.Read(buf)
+	this.read += int64(n)
+	return n, err
+}
+
+func (this *countingInput) ReadAt(buf []byte, off int64) (int, error) {
+	n, err := this.Reader.ReadAt(buf, off)
+	this.read += int64(n)
+	return n, err
+}
+
+func (this *countingInput) Close() error {
+	return nil
+}
+
+func TestBlockRange(t *testing.T) {
+	fmt.Println("Block Range Test")
+	const blockSize = 65536
+	data := make([]byte, 40*blockSize+1234)
+
+	// Poorly compressible data: the stream is much larger than the buffer of
+	// the input bitstream
+	for i := range data {
+		data[i] = byte('a' + rand.Intn(16))
+	}
+
+	wCtx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(blockSize)}
+	stream := compressData(t, data, wCtx)
+	wCtx["archival"] = true
+	archive := compressData(t, data, wCtx)
+	nbBlocks := (len(data) + blockSize - 1) / blockSize
+
+	expected := func(from, to int) []byte {
+		start := min(max(from-1, 0)*blockSize, len(data))
+		end := len(data)
+
+		if to > 0 {
+			end = min(max(to-1, 0)*blockSize, len(data))
+		}
+
+		return data[start:max(start, end)]
+	}
+
+	decode := func(input []byte, from, to int) ([]byte, *Reader, *countingInput) {
+		src := &countingInput{Reader: bytes.NewReader(input)}
+		r, err := NewReaderWithCtx(src, map[string]any{"jobs": uint(2)})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		if err = r.SetRange(from, to); err != nil {
+			t.Fatalf("SetRange(%d, %d) failed: %v", from, to, err)
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Decompression of [%d..%d) failed: %v", from, to, err)
+		}
+
+		r.Close()
+		return res, r, src
+	}
+
+	ranges := [][2]int{{2, 4}, {0, 2}, {3, 0}, {nbBlocks, 0}, {nbBlocks + 5, 0}, {4, 4}, {1, nbBlocks + 3}}
+
+	for _, rg := range ranges {
+		for _, input := range [][]byte{stream, archive} {
+			res, _, _ := decode(input, rg[0], rg[1])
+
+			if bytes.Equal(res, expected(rg[0], rg[1])) == false {
+				t.Errorf("Invalid data for [%d..%d): %d bytes, expected %d", rg[0], rg[1], len(res), len(expected(rg[0], rg[1])))
+			}
+		}
+	}
+
+	// Seek table: the blocks outside of the range are not read
+	res, r, src := decode(archive, 2, 4)
+
+	if r.blockRange == nil || r.blockRange.seekable == false {
+		t.Errorf("Expected the block range to be read with the seek table")
+	}
+
+	if src.read >= int64(len(archive))/2 {
+		t.Errorf("Too many bytes read with the seek table: %d of %d", src.read, len(archive))
+	}
+
+	// No seek table: the input is not read past the end of the range
+	res2, r, src := decode(stream, 1, 3)
+
+	if r.blockRange == nil || r.blockRange.seekable == true {
+		t.Errorf("Expected the block range to be read sequentially")
+	}
+
+	if src.read >= int64(len(stream))/2 {
+		t.Errorf("Too many bytes read without seek table: %d of %d", src.read, len(stream))
+	}
+
+	// Same as the context keys
+	for i, input := range [][]byte{stream, archive} {
+		out, _, err := decompressData(input, map[string]any{"from": 2, "to": 4})
+
+		if err != nil || bytes.Equal(out, res) == false {
+			t.Errorf("Stream %d: context range [2..4) differs from SetRange: %v", i, err)
+		}
+
+		out, _, err = decompressData(input, map[string]any{"to": 3})
+
+		if err != nil || bytes.Equal(out, res2) == false {
+			t.Errorf("Stream %d: context range [0..3) differs from SetRange: %v", i, err)
+		}
+	}
+
+	// Invalid ranges
+	for _, rg := range [][2]int{{-1, 0}, {0, -2}, {5, 3}} {
+		r := mustReader(t, stream, map[string]any{"jobs": uint(1)})
+
+		if err := r.SetRange(rg[0], rg[1]); err == nil {
+			t.Errorf("Expected an error for the range [%d..%d)", rg[0], rg[1])
+		}
+	}
+
+	if _, err := NewReaderWithCtx(internal.NewBufferStream(stream), map[string]any{"jobs": uint(1), "from": uint(2)}); err == nil {
+		t.Errorf("Expected an error for an invalid type of block range")
+	}
+
+	// Too late after the first read
+	for _, input := range [][]byte{stream, archive} {
+		r, err := NewReaderWithCtx(bytesReadCloser{bytes.NewReader(input)}, map[string]any{"jobs": uint(1)})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		if _, err = r.Read(make([]byte, 100)); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if err = r.SetRange(2, 3); err == nil {
+			t.Errorf("Expected an error for a block range set after a read")
+		}
+
+		r.Close()
+	}
+
+	// Output size limit checked against the size of the range
+	for _, input := range [][]byte{stream, archive} {
+		r, err := NewReaderWithCtx(bytesReadCloser{bytes.NewReader(input)},
+			map[string]any{"jobs": uint(1), "maxOutputSize": int64(3 * blockSize)})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		if err = r.SetRange(2, 4); err != nil {
+			t.Fatalf("SetRange failed: %v", err)
+		}
+
+		if out, err := io.ReadAll(r); err != nil || bytes.Equal(out, res) == false {
+			t.Errorf("Decompression of the block range within the output limit failed: %v", err)
+		}
+
+		r.Close()
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRawBlock(t *testing.T) {
+	fmt.Println("Raw Block Test")
+	text := []byte(strings.Repeat("The raw block API embeds kanzi in other container formats. ", 2000))
+	random := make([]byte, 100000)
+	rand.Read(random)
+
+	configs := []Options{
+		{},
+		{Transform: "TEXT+LZ", Entropy: "HUFFMAN"},
+		{Transform: "BWT+SRT+ZRLT", Entropy: "ANS0"},
+		{Transform: "ROLZ", Entropy: "NONE"},
+		{Transform: "NONE", Entropy: "TPAQ"},
+	}
+
+	for _, opts := range configs {
+		for _, input := range [][]byte{text, random, text[0:10], nil} {
+			output := make([]byte, CompressBlockBound(len(input)))
+			n, err := CompressBlock(input, output, opts)
+
+			if err != nil {
+				t.Fatalf("%+v: compression failed: %v", opts, err)
+			}
+
+			// The output buffer may be bigger than the original data
+			reverse := make([]byte, len(input)+100)
+			m, err := DecompressBlock(output[0:n], reverse, opts)
+
+			if err != nil {
+				t.Fatalf("%+v: decompression failed: %v", opts, err)
+			}
+
+			if bytes.Equal(input, reverse[0:m]) == false {
+				t.Errorf("%+v: roundtrip failed for input of size %d", opts, len(input))
+			}
+
+			if len(input) == len(text) && opts.Entropy != "" && n >= len(input)/4 {
+				t.Errorf("%+v: poor compression of text: %d => %d", opts, len(input), n)
+			}
+		}
+	}
+
+	opts := Options{Transform: "LZ", Entropy: "ANS0"}
+	output := make([]byte, CompressBlockBound(len(text)))
+
+	if _, err := CompressBlock(text, output[0:10], opts); err == nil {
+		t.Errorf("Expected error on small output buffer")
+	}
+
+	if _, err := CompressBlock(text, output, Options{Transform: "FOO"}); err == nil {
+		t.Errorf("Expected error on invalid transform")
+	}
+
+	n, _ := CompressBlock(text, output, opts)
+
+	for i := 4; i < n; i += 7 {
+		output[i] ^= 0x5A
+	}
+
+	// Must not panic
+	if _, err := DecompressBlock(output[0:n], make([]byte, len(text)), opts); err == nil {
+		fmt.Println("Corrupted block decoded without error")
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Bounds of the output of a Writer. A block that the codecs would expand
+// is stored instead (copy block), so that the block data never exceeds the
+// size of a stored block: mode, length, checksum and original data. The
+// bounds add the block framing, the stream header, the end block and the
+// trailers (archive, footer).
+
+// MaxCompressedLen returns the max size of the stream produced by a Writer
+// created with ctx (same keys as NewWriterWithCtx, the missing ones get
+// default values) for an input of inputLen bytes, written without calls to
+// Flush. Returns -1 if the parameters are invalid.
+func MaxCompressedLen(inputLen int, ctx map[string]any) int {
+	w := newBoundWriter(ctx)
+
+	if w == nil || inputLen < 0 {
+		return -1
+	}
+
+	bits := w.headerBits() + 8 + w.syncMarkerBits() // end block
+
+	if w.compact == true && int64(inputLen) <= w.inputSize {
+		bits = w.compactHeaderBits() + 8
+	}
+	blocks := 0
+	maxRecord := uint64(0)
+
+	if inputLen > 0 {
+		if w.chunker != nil {
+			// Content defined blocks: all but the last one are at least
+			// chunker.minSize long
+			blocks = inputLen/w.chunker.minSize + 1
+			overhead := w.maxBlockBits(w.blockSize) - 8*uint64(w.blockSize)
+			bits += uint64(blocks)*overhead + 8*uint64(inputLen)
+			maxRecord = w.maxBlockBits(min(w.blockSize, inputLen))
+		} else {
+			full, last := inputLen/w.blockSize, inputLen%w.blockSize
+			bits += uint64(full) * w.maxBlockBits(w.blockSize)
+			blocks = full
+
+			if last > 0 {
+				bits += w.maxBlockBits(last)
+				blocks++
+			}
+
+			maxRecord = w.maxBlockBits(min(w.blockSize, inputLen))
+		}
+	}
+
+	return int((bits+7)>>3) + w.trailerSize(blocks, int((maxRecord+7)>>3))
+}
+
+// HeaderOverhead returns the size of the parts of the stream produced by a
+// Writer created with ctx that do not depend on the input: header, end
+// block and trailers. It is the size of the stream of an empty input.
+// Returns -1 if the parameters are invalid.
+func HeaderOverhead(ctx map[string]any) int {
+	return MaxCompressedLen(0, ctx)
+}
+
+// newBoundWriter returns a Writer (discarding its output) with the
+// parameters in ctx or nil if they are invalid
+func newBoundWriter(ctx map[string]any) *Writer {
+	params := withDefaults(ctx)
+	delete(params, "flushInterval")
+	delete(params, "onBlock")
+	os, _ := NewNullOutputStream()
+	w, err := NewWriterWithCtx(os, params)
+
+	if err != nil {
+		return nil
+	}
+
+	return w
+}
+
+// headerBits returns the size of the stream header in bits
+func (this *Writer) headerBits() uint64 {
+	if this.headless == true {
+		return 0
+	}
+
+	res := 160 + 16*uint64(getSizeMask(this.inputSize))
+
+	if this.cipherType != _CIPHER_NONE {
+		res += 8 * _CIPHER_SALT_SIZE
+	}
+
+	if this.customSeed == true {
+		res += 32
+	}
+
+	return res
+}
+
+// maxBlockBits returns the max size in bits of a block of 'length' bytes,
+// including the block framing
+func (this *Writer) maxBlockBits(length int) uint64 {
+	written := getStoredBlockBits(uint(length), this.checksumBits()+this.checksumFlagBits()+this.blockHash.bits())
+
+	if this.aead != nil {
+		written = 8 * (((written + 7) >> 3) + uint64(this.aead.Overhead()))
+	}
+
+	if this.archive != nil {
+		// Byte aligned blocks
+		written += 7
+	}
+
+	return this.syncMarkerBits() + 5 + uint64(getBlockSizeBits(written)) + written
+}
+
+// trailerSize returns the max size of the archive trailer and footer
+func (this *Writer) trailerSize(blocks, maxRecord int) int {
+	res := 0
+
+	if this.archive != nil {
+		groups := (blocks + _ARCHIVE_GROUP_SIZE - 1) / _ARCHIVE_GROUP_SIZE
+		res += _ARCHIVE_FIXED_SIZE + int((this.headerBits()+7)>>3) + 5 + 24*blocks +
+			groups*(4+maxRecord) + 2*_ARCHIVE_FOOTER_SIZE
+	}
+
+	if this.footer != nil {
+		res += _FOOTER_SIZE
+	}
+
+	return res
+}
+
+func (this *Writer) checksumBits() uint {
+	if this.hasher32 != nil {
+		return 32
+	}
+
+	if this.hasher64 != nil {
+		return 64
+	}
+
+	return 0
+}
+
+// getStoredBlockBits returns the size in bits of a stored block of
+// 'length' bytes (without block framing). ckBits includes the checksum flag and the block hash.
+func getStoredBlockBits(length, ckBits uint) uint64 {
+	dataSize := uint(1)
+
+	if length >= 256 {
+		dataSize = uint(internal.Log2NoCheck(uint32(length))>>3) + 1
+	}
+
+	return uint64(8+8*dataSize+ckBits) + 8*uint64(length)
+}
+
+// storedBlockBits returns the size in bits of the block once stored
+func (this *encodingTask) storedBlockBits(checksummed bool) uint64 {
+	return getStoredBlockBits(this.blockLength, this.checksumBits(checksummed)+this.blockHash.bits())
+}
+
+// storeExpandedBlock writes the original block as a copy block to data
+// (reused) and returns the block data and its size in bits
+func (this *encodingTask) storeExpandedBlock(original, data []byte, checksum uint64, checksummed bool, blockHash []byte) ([]byte, uint64) {
+	bufStream := internal.NewBufferStream(data[0:0:cap(data)])
+	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
+	dataSize := uint(1)
+
+	if this.blockLength >= 256 {
+		dataSize = uint(internal.Log2NoCheck(uint32(this.blockLength))>>3) + 1
+	}
+
+	mode := byte(_COPY_BLOCK_MASK) | byte(((dataSize-1)&0x03)<<5) | byte(0x7F>>4)
+	obs.WriteBits(uint64(mode), 8)
+	obs.WriteBits(uint64(this.blockLength), 8*dataSize)
+	this.writeChecksum(obs, checksum, checksummed)
+
+	if blockHash != nil {
+		obs.WriteArray(blockHash, uint(8*len(blockHash)))
+	}
+
+	for n := uint(0); n < this.blockLength; {
+		chkSize := min(this.blockLength-n, 1<<26)
+		obs.WriteArray(original[n:], 8*chkSize)
+		n += chkSize
+	}
+
+	obs.Close()
+	return bufStream.Bytes(), obs.Written()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestMaxCompressedLen(t *testing.T) {
+	fmt.Println("Max Compressed Length Test")
+
+	key := bytes.Repeat([]byte{0x5A}, 32)
+	random := make([]byte, 300000)
+	rand.Read(random)
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 4000)
+
+	configs := []map[string]any{
+		{"transform": "NONE", "entropy": "NONE"},
+		{"transform": "LZ", "entropy": "HUFFMAN", "checksum": uint(32)},
+		{"transform": "TEXT+BWT+MTFT+ZRLT", "entropy": "ANS1", "checksum": uint(64), "footer": true},
+		{"transform": "RLT+ZRLT", "entropy": "TPAQ", "blockSize": uint(65536), "archival": true},
+		{"transform": "BWT", "entropy": "CM", "blockSize": uint(32768), "cipher": "AES-GCM", "key": key},
+		{"transform": "LZX", "entropy": "RANGE", "blockSize": uint(32768), "autoTune": true, "checksum": uint(32)},
+		{"transform": "LZ", "entropy": "FPAQ", "blockSize": uint(32768), "rsyncable": true},
+	}
+
+	for i, cfg := range configs {
+		cfg["jobs"] = uint(2)
+		empty, err := compressedSize(nil, withDefaults(cfg))
+
+		if err != nil {
+			t.Fatalf("Config %d: compression failed: %v", i, err)
+		}
+
+		if overhead := HeaderOverhead(cfg); int64(overhead) != empty {
+			t.Errorf("Config %d: invalid header overhead: %d, expected %d", i, overhead, empty)
+		}
+
+		for _, data := range [][]byte{random, random[0:1000], random[0:10], text} {
+			for _, withSize := range []bool{false, true} {
+				ctx := withDefaults(cfg)
+
+				if withSize == true {
+					ctx["fileSize"] = int64(len(data))
+				}
+
+				bound := MaxCompressedLen(len(data), ctx)
+				output := compressData(t, data, ctx)
+
+				if len(output) > bound {
+					t.Errorf("Config %d: %d bytes => %d bytes, above the bound %d", i, len(data), len(output), bound)
+				}
+
+				res, _, err := decompressData(output, map[string]any{"jobs": uint(2), "key": key})
+
+				if err != nil || bytes.Equal(res, data) == false {
+					t.Errorf("Config %d: invalid decompressed data (%d bytes): %v", i, len(data), err)
+				}
+			}
+		}
+	}
+
+	if MaxCompressedLen(100, map[string]any{"transform": "UNKNOWN"}) != -1 || MaxCompressedLen(-1, nil) != -1 {
+		t.Errorf("Expected -1 on invalid parameters")
+	}
+
+	// Random data with a codec that expands it: blocks stored
+	ctx := map[string]any{"entropy": "HUFFMAN", "blockSize": uint(65536), "checksum": uint(32)}
+	size, _ := compressedSize(random, withDefaults(ctx))
+	fmt.Printf("Random data: %d => %d bytes (bound %d)\n", len(random), size, MaxCompressedLen(len(random), ctx))
+
+	if size > int64(len(random)+HeaderOverhead(ctx)+5*16) {
+		t.Errorf("Random data expanded: %d => %d bytes", len(random), size)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// eventCollector records the events of a given type
+type eventCollector struct {
+	lock      sync.Mutex
+	eventType int
+	events    []string
+}
+
+func (this *eventCollector) ProcessEvent(evt *kanzi.Event) {
+	if evt.Type() != this.eventType {
+		return
+	}
+
+	this.lock.Lock()
+	this.events = append(this.events, evt.String())
+	this.lock.Unlock()
+}
+
+func TestBufferReallocEvents(t *testing.T) {
+	fmt.Println("Buffer Realloc Events Test")
+	values := make([]byte, 4*64512+17)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(256))
+	}
+
+	// The block buffers come from the buffer pool (power of 2 capacity):
+	// 64512 bytes blocks fill a 64 KB buffer
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{
+		"entropy":      "ANS1",
+		"transform":    "NONE",
+		"blockSize":    uint(64512),
+		"jobs":         uint(1),
+		"checksum":     uint(0),
+		"bufferFloor":  uint(0),
+		"bufferMargin": uint(16),
+	}
+
+	w, _ := NewWriterWithCtx(bs, ctx)
+	collector := &eventCollector{eventType: kanzi.EVT_BUFFER_REALLOC}
+	w.AddListener(collector)
+	w.Write(values)
+	w.Close()
+
+	// Random data expands with ANS1: the entropy output buffer must grow
+	if len(collector.events) == 0 {
+		t.Fatalf("No buffer reallocation event")
+	}
+
+	fmt.Println(collector.events[0])
+
+	if !strings.Contains(collector.events[0], "\"reason\":\"entropyOutput\"") {
+		t.Errorf("Unexpected event: %s", collector.events[0])
+	}
+}
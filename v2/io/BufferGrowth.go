@@ -0,0 +1,79 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// Growth of the block buffers of a Writer: the input buffers start small
+// (64 KB) and double as data is written, up to the block size plus padding,
+// so that a small stream does not allocate full blocks. The buffers much
+// larger than the recent blocks (EG. after a burst of large blocks followed
+// by small flushed blocks) are returned to the buffer pool and regrow on
+// demand. With a memory budget (ctx["maxMemory"]), the buffers retained
+// between two batches of blocks never exceed the budget.
+
+const (
+	_BUFFER_INITIAL_SIZE = 1 << 16 // first stage of the input buffers
+	_BUFFER_SHRINK_RATIO = 4       // buffers larger than this ratio times the recent blocks are released
+	_BUFFER_SHRINK_BATCH = 16      // batches of blocks between two checks
+)
+
+// growInput makes room for size bytes in the input buffer bufID (the data
+// already written is kept)
+func (this *Writer) growInput(bufID, size int) []byte {
+	buf := &this.buffers[bufID]
+
+	if len(buf.Buf) >= size {
+		return buf.Buf
+	}
+
+	full := max(this.blockSize+this.blockSize>>6, _BUFFER_INITIAL_SIZE)
+	n := max(2*len(buf.Buf), _BUFFER_INITIAL_SIZE)
+
+	for n < size {
+		n <<= 1
+	}
+
+	return buf.grow(min(n, full), true)
+}
+
+// shrinkBuffers releases the oversized buffers once a batch of blocks (the
+// largest one being blockMax bytes long) has been encoded
+func (this *Writer) shrinkBuffers(blockMax int) {
+	this.recentBlock = max(this.recentBlock, blockMax)
+	this.batches++
+	retained := int64(0)
+
+	for i := range this.buffers {
+		retained += int64(len(this.buffers[i].Buf))
+	}
+
+	overBudget := this.maxMemory > 0 && retained > this.maxMemory
+
+	if this.batches < _BUFFER_SHRINK_BATCH && overBudget == false {
+		return
+	}
+
+	// The buffers used as entropy output grow to the output buffer floor
+	limit := max(_BUFFER_SHRINK_RATIO*this.recentBlock, _BUFFER_INITIAL_SIZE, int(this.bufferFloor))
+
+	for i := range this.buffers {
+		if len(this.buffers[i].Buf) > limit || (overBudget == true && len(this.buffers[i].Buf) > _BUFFER_INITIAL_SIZE) {
+			this.buffers[i].release()
+		}
+	}
+
+	this.batches = 0
+	this.recentBlock = 0
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// retainedBuffers returns the size of the block buffers of a Writer
+func retainedBuffers(w *Writer) int {
+	res := 0
+
+	for i := range w.buffers {
+		res += len(w.buffers[i].Buf)
+	}
+
+	return res
+}
+
+func TestBufferGrowth(t *testing.T) {
+	fmt.Println("Buffer Growth Test")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20000)
+	ctx := withDefaults(map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(4 << 20), "jobs": uint(2)})
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	if retainedBuffers(w) != 0 {
+		t.Errorf("Buffers allocated before the first write: %d bytes", retainedBuffers(w))
+	}
+
+	// Staged growth: 64 KB, then doubling
+	steps := []struct {
+		size     int
+		expected int
+	}{{1000, 1 << 16}, {100000, 1 << 17}, {300000, 1 << 19}}
+	written := 0
+
+	for _, s := range steps {
+		w.Write(text[written : written+s.size])
+		written += s.size
+
+		if n := len(w.buffers[0].Buf); n != s.expected {
+			t.Errorf("After %d bytes: expected a %d byte buffer, got %d", written, s.expected, n)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if res, _, err := decompressData(bs.Bytes(), nil); err != nil || bytes.Equal(res, text[:written]) == false {
+		t.Errorf("Invalid decompressed data: %v", err)
+	}
+
+	// Small blocks after a burst of large blocks: the buffers shrink
+	bs = internal.NewBufferStream()
+	w, _ = NewWriterWithCtx(bs, withDefaults(map[string]any{"transform": "LZ", "entropy": "HUFFMAN",
+		"blockSize": uint(1 << 20), "jobs": uint(2)}))
+	w.Write(text)
+	w.Write(text)
+	large := retainedBuffers(w)
+
+	// The shrink happens once a whole series of batches has small blocks
+	for i := 0; i < 2*_BUFFER_SHRINK_BATCH; i++ {
+		w.Write(text[:100])
+		w.Flush()
+	}
+
+	if small := retainedBuffers(w); small > large/2 {
+		t.Errorf("Buffers not shrunk: %d bytes (%d after the burst)", small, large)
+	}
+
+	w.Write(text)
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	expected := append(append([]byte(nil), text...), text...)
+	expected = append(expected, bytes.Repeat(text[:100], 2*_BUFFER_SHRINK_BATCH)...)
+	expected = append(expected, text...)
+
+	if res, _, err := decompressData(bs.Bytes(), map[string]any{"jobs": uint(2)}); err != nil || bytes.Equal(res, expected) == false {
+		t.Errorf("Invalid decompressed data after shrink: %v", err)
+	}
+
+	// With a budget, the retained buffers fit in it (the large output
+	// buffer floor makes each block use 8 MB)
+	const budget = 4 << 20
+	w, err = NewWriterWithCtx(internal.NewBufferStream(), withDefaults(map[string]any{"entropy": "HUFFMAN",
+		"blockSize": uint(65536), "bufferFloor": uint(8 << 20), "maxMemory": int64(budget)}))
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		w.Write(text[:65536])
+		w.Flush()
+
+		if n := retainedBuffers(w); n > budget {
+			t.Errorf("Retained buffers over budget: %d bytes", n)
+		}
+	}
+
+	w.Close()
+}
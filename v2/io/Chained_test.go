@@ -0,0 +1,136 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestChainedStreams(t *testing.T) {
+	fmt.Println("Chained Streams Test")
+	text := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 500))
+	values := make([]byte, 200000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(8))
+	}
+
+	type segment struct {
+		data      []byte
+		transform string
+		entropy   string
+		blockSize uint
+		checksum  uint
+	}
+
+	segments := []segment{
+		{text, "TEXT+UTF", "HUFFMAN", 4096, 32},
+		{values, "LZ", "ANS0", 65536, 0},
+		{text[0:1000], "NONE", "NONE", 1024, 64},
+	}
+
+	for _, jobs := range []uint{1, 3} {
+		bs := internal.NewBufferStream()
+		expected := make([]byte, 0)
+
+		for _, seg := range segments {
+			w, err := NewWriter(bs, seg.transform, seg.entropy, seg.blockSize, jobs, seg.checksum, int64(len(seg.data)), false)
+
+			if err != nil {
+				t.Fatalf("Cannot create writer: %v", err)
+			}
+
+			if _, err = w.Write(seg.data); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			expected = append(expected, seg.data...)
+		}
+
+		// Trailing bytes after the last stream are ignored
+		bs.Write([]byte{1, 2, 3})
+		ctx := make(map[string]any)
+		ctx["jobs"] = jobs
+		ctx["chained"] = true
+		r, err := NewReaderWithCtx(bs, ctx)
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if !bytes.Equal(res, expected) {
+			t.Fatalf("Roundtrip failed with %d jobs", jobs)
+		}
+
+		infos := r.Segments()
+
+		if len(infos) != len(segments) {
+			t.Fatalf("Incorrect number of segments: expected %d, got %d", len(segments), len(infos))
+		}
+
+		offset := int64(0)
+
+		for i, info := range infos {
+			fmt.Printf("Segment %d: %+v\n", i, info)
+
+			if info.Transform != segments[i].transform || info.Entropy != segments[i].entropy ||
+				info.BlockSize != segments[i].blockSize || info.Checksum != segments[i].checksum {
+				t.Errorf("Incorrect parameters for segment %d", i)
+			}
+
+			if info.DecodedOffset != offset || info.OriginalSize != int64(len(segments[i].data)) {
+				t.Errorf("Incorrect sizes for segment %d", i)
+			}
+
+			offset += info.OriginalSize
+		}
+
+		if ctx["outputSize"].(int64) != int64(len(expected)) {
+			t.Errorf("Incorrect total output size: %d", ctx["outputSize"].(int64))
+		}
+	}
+
+	// By default, the data after the end block is ignored (even a stream)
+	first := compressData(t, text, map[string]any{"transform": "LZ", "checksum": uint(32)})
+
+	for _, trailer := range [][]byte{[]byte("KANZ trailing bytes"), first, {0}} {
+		res, r, err := decompressData(append(bytes.Clone(first), trailer...), nil)
+
+		if err != nil || bytes.Equal(res, text) == false {
+			t.Errorf("Trailing data not ignored: %v", err)
+		}
+
+		if len(r.Segments()) != 1 {
+			t.Errorf("Incorrect number of segments: %d", len(r.Segments()))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/analysis"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Checksum policy (ctx["checksumPolicy"] = ChecksumPolicy): the block
+// checksums are only computed for the blocks selected by the policy, EG.
+// the text blocks only or all the blocks but the copied multimedia ones.
+// Each block then carries a flag (1 bit, before the checksum) telling
+// whether it has a checksum and the decoder only verifies those. The repeat
+// records of the deduplicated blocks always carry the checksum.
+// The seed of the XXHash block checksums can be set with
+// ctx["checksumSeed"] = uint32 (default _BITSTREAM_TYPE) and is stored in
+// the header. Both require a stream header (version 7).
+
+// BlockClass the description of a block provided to the checksum policy
+type BlockClass struct {
+	ID       int    // block ID (starting at 1)
+	Size     int    // size of the block in bytes
+	DataType string // "TEXT", "MULTIMEDIA", "EXE", "BIN", ... or "UNDEFINED"
+	Copied   bool   // stored as is (no transform, no entropy codec)
+}
+
+// ChecksumPolicy returns true if the block must carry a checksum
+type ChecksumPolicy func(class BlockClass) bool
+
+// getChecksumPolicy returns the checksum policy in the context (nil if none)
+func getChecksumPolicy(ctx map[string]any) (ChecksumPolicy, error) {
+	val, hasKey := ctx["checksumPolicy"]
+
+	if hasKey == false || val == nil {
+		return nil, nil
+	}
+
+	switch policy := val.(type) {
+	case ChecksumPolicy:
+		return policy, nil
+	case func(BlockClass) bool:
+		return policy, nil
+	}
+
+	errMsg := fmt.Sprintf("Invalid checksum policy: %T", val)
+	return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+}
+
+// getChecksumSeed returns the checksum seed in the context and true if
+// there is one
+func getChecksumSeed(ctx map[string]any) (uint32, bool, error) {
+	val, hasKey := ctx["checksumSeed"]
+
+	if hasKey == false {
+		return _BITSTREAM_TYPE, false, nil
+	}
+
+	seed, ok := val.(uint32)
+
+	if ok == false {
+		errMsg := fmt.Sprintf("Invalid checksum seed: %v", val)
+		return 0, false, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return seed, true, nil
+}
+
+// classifyBlock returns the data type of the block (see analysis.Detect),
+// UTF-8 text being text
+func classifyBlock(block []byte) internal.DataType {
+	if dt, _ := analysis.Detect(block); dt != analysis.DT_UTF8 {
+		return dt
+	}
+
+	return internal.DT_TEXT
+}
+
+// checksumFlagBits returns the size in bits of the per block checksum flag
+func (this *Writer) checksumFlagBits() uint {
+	if this.ckPolicy != nil {
+		return 1
+	}
+
+	return 0
+}
+
+// hasChecksum returns true if the block must carry a checksum
+func (this *encodingTask) hasChecksum(block []byte, copied bool) bool {
+	if this.hasher32 == nil && this.hasher64 == nil {
+		return false
+	}
+
+	if this.ckPolicy == nil {
+		return true
+	}
+
+	class := BlockClass{ID: int(this.currentBlockID), Size: len(block), Copied: copied,
+		DataType: statsDataTypeName(byte(classifyBlock(block)))}
+	return this.ckPolicy(class)
+}
+
+// blockChecksum returns the checksum of the block and the hash type
+func (this *encodingTask) blockChecksum(block []byte) (uint64, int) {
+	if this.hasher32 != nil {
+		return uint64(this.hasher32.Hash(block)), kanzi.EVT_HASH_32BITS
+	}
+
+	if this.hasher64 != nil {
+		return this.hasher64.Hash(block), kanzi.EVT_HASH_64BITS
+	}
+
+	return 0, kanzi.EVT_HASH_NONE
+}
+
+// checksumBits returns the size in bits of the checksum and its flag
+func (this *encodingTask) checksumBits(checksummed bool) uint {
+	res := uint(0)
+
+	if this.ckPolicy != nil {
+		res++
+	}
+
+	if checksummed == true {
+		if this.hasher32 != nil {
+			res += 32
+		} else if this.hasher64 != nil {
+			res += 64
+		}
+	}
+
+	return res
+}
+
+// writeChecksum writes the checksum flag (with a checksum policy) and the
+// checksum of the block (if any)
+func (this *encodingTask) writeChecksum(obs kanzi.OutputBitStream, checksum uint64, checksummed bool) {
+	if this.ckPolicy != nil {
+		if checksummed == true {
+			obs.WriteBit(1)
+		} else {
+			obs.WriteBit(0)
+		}
+	}
+
+	if checksummed == false {
+		return
+	}
+
+	if this.hasher32 != nil {
+		obs.WriteBits(checksum, 32)
+	} else if this.hasher64 != nil {
+		obs.WriteBits(checksum, 64)
+	}
+}
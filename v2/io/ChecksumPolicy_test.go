@@ -0,0 +1,126 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+func TestChecksumPolicy(t *testing.T) {
+	fmt.Println("Checksum Policy Test")
+
+	// Text blocks followed by random blocks (copied)
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog.\n"), 3000)
+	random := make([]byte, 3*65536)
+	rand.Read(random)
+	data := append(append([]byte(nil), text[0:2*65536]...), random...)
+	var lock sync.Mutex
+	classes := make(map[int]BlockClass)
+
+	policy := func(class BlockClass) bool {
+		lock.Lock()
+		classes[class.ID] = class
+		lock.Unlock()
+		return class.DataType == "TEXT"
+	}
+
+	for _, entropy := range []string{"HUFFMAN", "NONE"} {
+		transform := "LZ"
+
+		if entropy == "NONE" {
+			transform = "NONE"
+		}
+
+		ctx := map[string]any{"transform": transform, "entropy": entropy, "blockSize": uint(65536),
+			"jobs": uint(2), "checksum": uint(32), "skipBlocks": true, "checksumPolicy": ChecksumPolicy(policy)}
+		_, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "blockInfo": true})
+
+		for i := 0; i < r.BlockInfoCount(); i++ {
+			info, _ := r.BlockInfo(i)
+			class := classes[info.ID]
+			fmt.Printf("%s block %d: %s, copied=%v, checksum size=%d\n", entropy, info.ID, class.DataType,
+				class.Copied, info.ChecksumSize)
+
+			if expected := (i < 2); (info.ChecksumSize == 32) != expected {
+				t.Errorf("%s block %d: invalid checksum size %d", entropy, info.ID, info.ChecksumSize)
+			}
+
+			if i >= 2 && class.Copied == false {
+				t.Errorf("%s block %d: random block not copied", entropy, info.ID)
+			}
+		}
+	}
+
+	// Invalid parameters
+	bad := []map[string]any{
+		{"checksum": uint(32), "checksumPolicy": "TEXT"},
+		{"checksum": uint(32), "checksumSeed": 1234},
+		{"checksum": uint(32), "checksumPolicy": policy, "headerless": true},
+	}
+
+	for i, ctx := range bad {
+		os, _ := NewNullOutputStream()
+
+		if _, err := NewWriterWithCtx(os, withDefaults(ctx)); err == nil {
+			t.Errorf("Invalid parameters %d: no error", i)
+		}
+	}
+}
+
+func TestChecksumSeed(t *testing.T) {
+	fmt.Println("Checksum Seed Test")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	key := bytes.Repeat([]byte{0x5A}, 32)
+	var outputs [][]byte
+
+	for _, seed := range []uint32{1234, 0} {
+		for _, checksum := range []uint{32, 64} {
+			ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536),
+				"checksum": checksum, "checksumSeed": seed}
+			output, r := roundTrip(t, data, ctx, map[string]any{"blockInfo": true})
+			outputs = append(outputs, output)
+			info, _ := r.BlockInfo(0)
+			var expected uint64
+
+			if checksum == 32 {
+				h, _ := hash.NewXXHash32(seed)
+				expected = uint64(h.Hash(data[0:65536]))
+			} else {
+				h, _ := hash.NewXXHash64(uint64(seed))
+				expected = h.Hash(data[0:65536])
+			}
+
+			if info.Checksum != expected {
+				t.Errorf("Seed %d, checksum %d: invalid checksum %x, expected %x", seed, checksum, info.Checksum, expected)
+			}
+		}
+	}
+
+	if bytes.Equal(outputs[0], outputs[2]) == true {
+		t.Errorf("The seed does not change the checksums")
+	}
+
+	// Header encoded again for the encrypted blocks (see Cipher.go)
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "checksum": uint(32), "checksumSeed": uint32(99),
+		"checksumPolicy": func(BlockClass) bool { return true }, "cipher": "AES-GCM", "key": key}
+	roundTrip(t, data, ctx, map[string]any{"key": key})
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Encryption (ctx["cipher"] = "AES-GCM" or "CHACHA20-POLY1305" and
+// ctx["key"] = []byte): each block is compressed then encrypted and
+// authenticated with an AEAD. The cipher is stored in the header flags
+// (bitstream version 7), followed by a random 16 byte salt.
+// The key of the stream is HMAC-SHA256(key, salt) truncated to the size
+// of the key (16, 24 or 32 bytes for AES-GCM, 32 bytes for ChaCha20-Poly1305)
+// and the nonce of each block is its ID. The additional data of each block
+// is the stream header (including the salt) followed by the block ID. Hence,
+// a key can be reused for several streams, the header cannot be altered and
+// blocks cannot be reordered or moved between streams without detection.
+// Truncation at a block boundary is detected by the footer (see Footer.go),
+// which is not encrypted.
+
+const (
+	_CIPHER_NONE              = 0
+	_CIPHER_AES_GCM           = 1
+	_CIPHER_CHACHA20_POLY1305 = 2
+	_CIPHER_SALT_SIZE         = 16
+)
+
+func getCipherType(name string) (uint, error) {
+	switch strings.ToUpper(name) {
+	case "NONE", "":
+		return _CIPHER_NONE, nil
+	case "AES-GCM":
+		return _CIPHER_AES_GCM, nil
+	case "CHACHA20-POLY1305":
+		return _CIPHER_CHACHA20_POLY1305, nil
+	default:
+		return _CIPHER_NONE, fmt.Errorf("Unknown cipher: '%s'", name)
+	}
+}
+
+func getCipherName(cipherType uint) string {
+	switch cipherType {
+	case _CIPHER_AES_GCM:
+		return "AES-GCM"
+	case _CIPHER_CHACHA20_POLY1305:
+		return "CHACHA20-POLY1305"
+	default:
+		return "NONE"
+	}
+}
+
+// newStreamCipher returns the AEAD of a stream given the user key and
+// the salt of the stream
+func newStreamCipher(cipherType uint, key, salt []byte) (cipher.AEAD, error) {
+	switch cipherType {
+	case _CIPHER_AES_GCM:
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, fmt.Errorf("Invalid key size for AES-GCM: %d (must be 16, 24 or 32 bytes)", len(key))
+		}
+
+	case _CIPHER_CHACHA20_POLY1305:
+		if len(key) != internal.CHACHA20_POLY1305_KEY_SIZE {
+			return nil, fmt.Errorf("Invalid key size for ChaCha20-Poly1305: %d (must be 32 bytes)", len(key))
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid cipher type: %d", cipherType)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	streamKey := mac.Sum(nil)[0:len(key)]
+
+	if cipherType == _CIPHER_CHACHA20_POLY1305 {
+		return internal.NewChaCha20Poly1305(streamKey)
+	}
+
+	block, err := aes.NewCipher(streamKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// cipherParams reads the cipher and the key from the context
+func cipherParams(ctx map[string]any) (uint, []byte, error) {
+	name, _ := ctx["cipher"].(string)
+	cipherType, err := getCipherType(name)
+
+	if err != nil {
+		return _CIPHER_NONE, nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	key, _ := ctx["key"].([]byte)
+
+	if cipherType != _CIPHER_NONE && len(key) == 0 {
+		return _CIPHER_NONE, nil, &IOError{msg: "Missing encryption key", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return cipherType, key, nil
+}
+
+// blockNonce returns the nonce of the block with the provided ID
+func blockNonce(aead cipher.AEAD, blockID int32) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(blockID))
+	return nonce
+}
+
+// blockAdditionalData returns the data authenticated with the block: the
+// stream header and the block ID
+func blockAdditionalData(header []byte, blockID int32) []byte {
+	res := make([]byte, len(header)+8)
+	copy(res, header)
+	binary.BigEndian.PutUint64(res[len(header):], uint64(blockID))
+	return res
+}
+
+// encrypt encrypts the block data in place (if possible)
+func (this *encodingTask) encrypt(data []byte) []byte {
+	aad := blockAdditionalData(this.header, this.currentBlockID)
+	return this.aead.Seal(data[:0], blockNonce(this.aead, this.currentBlockID), data, aad)
+}
+
+// decrypt authenticates and decrypts the block data in place
+func (this *decodingTask) decrypt(data []byte) ([]byte, *IOError) {
+	aad := blockAdditionalData(this.header, this.currentBlockID)
+	res, err := this.aead.Open(data[:0], blockNonce(this.aead, this.currentBlockID), data, aad)
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Block %d: authentication failed (wrong key or corrupted data)", this.currentBlockID)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return res, nil
+}
+
+// readCipherSalt reads the salt following the header of an encrypted
+// stream and creates the AEAD of the stream. The header bytes read (see
+// headerRecorder) are kept to authenticate the blocks.
+func (this *Reader) readCipherSalt(header *headerRecorder) error {
+	this.aead = nil
+
+	if this.cipherType == _CIPHER_NONE {
+		return nil
+	}
+
+	if this.cipherType != _CIPHER_AES_GCM && this.cipherType != _CIPHER_CHACHA20_POLY1305 {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect cipher type: %d", this.cipherType)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+	}
+
+	key, _ := this.ctx["key"].([]byte)
+
+	if len(key) == 0 {
+		return &IOError{msg: "The stream is encrypted: missing decryption key", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	salt := make([]byte, _CIPHER_SALT_SIZE)
+	this.ibs.ReadArray(salt, 8*_CIPHER_SALT_SIZE)
+	var err error
+
+	if this.aead, err = newStreamCipher(this.cipherType, key, salt); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	// The salt is the last field of the header
+	this.header = header.bytes()
+	return nil
+}
+
+// headerRecorder an input bitstream keeping a copy of the bits of the
+// stream header read (authenticated with each encrypted block)
+type headerRecorder struct {
+	kanzi.InputBitStream
+	bufStream *internal.BufferStream
+	obs       *bitstream.DefaultOutputBitStream
+}
+
+// newHeaderRecorder creates a headerRecorder reading from ibs. The stream
+// type (already read) is recorded first.
+func newHeaderRecorder(ibs kanzi.InputBitStream) (*headerRecorder, error) {
+	this := &headerRecorder{InputBitStream: ibs}
+	this.bufStream = internal.NewBufferStream(make([]byte, 0, 64))
+	var err error
+
+	if this.obs, err = bitstream.NewDefaultOutputBitStream(this.bufStream, 1024); err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	this.obs.WriteBits(_BITSTREAM_TYPE, 32)
+	return this, nil
+}
+
+func (this *headerRecorder) ReadBit() int {
+	bit := this.InputBitStream.ReadBit()
+	this.obs.WriteBit(bit)
+	return bit
+}
+
+func (this *headerRecorder) ReadBits(length uint) uint64 {
+	bits := this.InputBitStream.ReadBits(length)
+	this.obs.WriteBits(bits, length)
+	return bits
+}
+
+func (this *headerRecorder) ReadArray(bits []byte, length uint) uint {
+	n := this.InputBitStream.ReadArray(bits, length)
+	this.obs.WriteArray(bits, n)
+	return n
+}
+
+// bytes returns the header recorded (padded to a byte boundary as written
+// by the Writer)
+func (this *headerRecorder) bytes() []byte {
+	this.obs.Close()
+	return this.bufStream.Bytes()
+}
+
+// headerBytes returns the stream header written by encodeHeader
+func (this *Writer) headerBytes() ([]byte, error) {
+	bufStream := internal.NewBufferStream(make([]byte, 0, 64))
+	obs, err := bitstream.NewDefaultOutputBitStream(bufStream, 1024)
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	if err := this.encodeHeader(obs); err != nil {
+		return nil, err
+	}
+
+	obs.Close()
+	return bufStream.Bytes(), nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"strings"
+	"testing"
+)
+
+func TestCipher(t *testing.T) {
+	fmt.Println("Cipher Test")
+
+	key := make([]byte, 32)
+
+	for i := range key {
+		key[i] = byte(0x80 + i)
+	}
+
+	data := []byte(strings.Repeat("Compress then encrypt, block by block. ", 10000))
+
+	compress := func(ctx map[string]any) []byte {
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, ctx)
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		// Flush in the middle to get a byte aligned block
+		if _, err = w.Write(data[0:100000]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if err = w.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+
+		if _, err = w.Write(data[100000:]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		return bs.Bytes()
+	}
+
+	decompress := func(input []byte, key []byte) ([]byte, error) {
+		ctx := map[string]any{"jobs": uint(4), "chained": true}
+
+		if key != nil {
+			ctx["key"] = key
+		}
+
+		res, _, err := decompressData(input, ctx)
+		return res, err
+	}
+
+	for _, c := range []string{"AES-GCM", "CHACHA20-POLY1305"} {
+		for _, checksum := range []uint{0, 32} {
+			ctx := map[string]any{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "blockSize": uint(32768),
+				"jobs": uint(4), "checksum": checksum, "cipher": c, "key": key}
+			output1 := compress(ctx)
+			output2 := compress(ctx)
+
+			if bytes.Equal(output1, output2) == true {
+				t.Errorf("%s: streams encrypted with the same key must differ", c)
+			}
+
+			if bytes.Contains(output1, []byte("encrypt")) == true {
+				t.Errorf("%s: the output contains plain text", c)
+			}
+
+			res, err := decompress(output1, key)
+
+			if err != nil {
+				t.Fatalf("%s: decompression failed: %v", c, err)
+			}
+
+			if bytes.Equal(res, data) == false {
+				t.Errorf("%s: roundtrip failed", c)
+			}
+
+			// Chained encrypted streams
+			res, err = decompress(append(append([]byte(nil), output1...), output2...), key)
+
+			if err != nil || bytes.Equal(res, append(append([]byte(nil), data...), data...)) == false {
+				t.Errorf("%s: chained streams roundtrip failed: %v", c, err)
+			}
+
+			wrongKey := append([]byte(nil), key...)
+			wrongKey[0] ^= 1
+
+			if _, err = decompress(output1, wrongKey); err == nil {
+				t.Errorf("%s: wrong key not detected", c)
+			}
+
+			if _, err = decompress(output1, nil); err == nil {
+				t.Errorf("%s: missing key not detected", c)
+			}
+
+			tampered := append([]byte(nil), output1...)
+			tampered[len(tampered)/2] ^= 0x04
+
+			if _, err = decompress(tampered, key); err == nil {
+				t.Errorf("%s: tampered block not detected", c)
+			}
+
+			// The header flags are not covered by the header checksum but
+			// are authenticated with each block (rsyncable flag changed)
+			tampered = append([]byte(nil), output1...)
+			tampered[18] ^= 0x04
+
+			if _, err = decompress(tampered, key); err == nil {
+				t.Errorf("%s: tampered header not detected", c)
+			}
+
+			tampered[18] ^= 0x04
+			tampered[19] ^= 0x01
+
+			if _, err = decompress(tampered, key); errors.Is(err, ErrInvalidFile) == false {
+				t.Errorf("%s: expected error on reserved header bits, got %v", c, err)
+			}
+		}
+	}
+
+	invalid := []map[string]any{
+		{"cipher": "AES-GCM"},
+		{"cipher": "AES-GCM", "key": make([]byte, 20)},
+		{"cipher": "CHACHA20-POLY1305", "key": make([]byte, 16)},
+		{"cipher": "RC4", "key": key},
+		{"cipher": "AES-GCM", "key": key, "archival": true},
+	}
+
+	for _, ctx := range invalid {
+		ctx["transform"] = "NONE"
+		ctx["entropy"] = "NONE"
+		ctx["blockSize"] = uint(65536)
+		ctx["jobs"] = uint(1)
+		ctx["checksum"] = uint(0)
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+			t.Errorf("Invalid parameters should be rejected: %v", ctx["cipher"])
+		}
+	}
+}
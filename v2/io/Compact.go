@@ -0,0 +1,228 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Compact framing for small inputs (ctx["compact"] = true, off by default:
+// decoders prior to the compact framing cannot read such streams). When the
+// size of the input is known (ctx["fileSize"]), below _COMPACT_MAX_SIZE and
+// fits in one block, the
+// 20+ byte stream header is replaced with a 2 byte header (plus 6 bits per
+// transform) and the stream contains a single block:
+// 'k' (8) | checksum size (2) | entropy type (5) | transforms flag (1) |
+// [number of transforms - 1 (3) | transform types (6 each)]
+// The block size of a compact stream is _COMPACT_BLOCK_SIZE, the original
+// size and the number of blocks are not stored. The options that need the
+// regular header (encryption, archive, footer, statistics, linked blocks, rsyncable,
+// codec selection, flush interval, block callback, block hash) disable the compact framing, as do a
+// call to Flush or more data than announced.
+
+const (
+	_COMPACT_MAGIC      = 0x6B // 'k', the regular streams start with 'K'
+	_COMPACT_MAX_SIZE   = 65536
+	_COMPACT_BLOCK_SIZE = 65536
+)
+
+// readStreamType reads the type of the next stream: _COMPACT_MAGIC for a
+// compact stream, a 32 bit type otherwise
+func readStreamType(ibs kanzi.InputBitStream) uint64 {
+	first := ibs.ReadBits(8)
+
+	if first == _COMPACT_MAGIC {
+		return _COMPACT_MAGIC
+	}
+
+	return (first << 24) | ibs.ReadBits(24)
+}
+
+// allowCompact returns true if the stream can use the compact framing
+func (this *Writer) allowCompact(ctx map[string]any) bool {
+	if val, hasKey := ctx["compact"]; hasKey == false || val.(bool) == false {
+		return false
+	}
+
+	if this.inputSize <= 0 || this.inputSize >= _COMPACT_MAX_SIZE || this.inputSize > int64(this.blockSize) {
+		return false
+	}
+
+	return this.headless == false && this.aead == nil && this.archive == nil && this.footer == nil && this.stats == nil &&
+		this.linked == false && this.chunker == nil && this.autoTune == false && this.governor == nil &&
+		this.flushInterval == 0 && this.volumes == nil && this.onBlock == nil && this.blockHash == nil &&
+		this.shared == nil && this.index == nil && this.ckPolicy == nil && this.customSeed == false &&
+		this.stageParams == 0 && this.syncMarkers == false && this.entropyLanes == 0
+}
+
+// encodeCompactHeader writes the compact stream header to the provided
+// bitstream and sets the block size expected by the decoder
+func (this *Writer) encodeCompactHeader(obs kanzi.OutputBitStream) *IOError {
+	ckSize := uint64(this.checksumBits() >> 5)
+	count := getTransformCount(this.transformType)
+	hdr := uint64(_COMPACT_MAGIC)<<8 | ckSize<<6 | uint64(this.entropyType)<<1
+
+	if count > 0 {
+		hdr |= 1
+	}
+
+	if obs.WriteBits(hdr, 16) != 16 {
+		return &IOError{msg: "Cannot write compact header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if count > 0 {
+		obs.WriteBits(uint64(count-1), 3)
+		obs.WriteBits(this.transformType>>(48-6*uint(count)), 6*uint(count))
+	}
+
+	this.ctx["blockSize"] = uint(_COMPACT_BLOCK_SIZE)
+	return nil
+}
+
+// compactHeaderBits returns the size of the compact stream header in bits
+func (this *Writer) compactHeaderBits() uint64 {
+	if count := getTransformCount(this.transformType); count > 0 {
+		return 16 + 3 + 6*uint64(count)
+	}
+
+	return 16
+}
+
+// getTransformCount returns the number of transforms in the sequence
+// (the transform types occupy the top 6 bit slots)
+func getTransformCount(transformType uint64) int {
+	count := 0
+
+	for count < 8 && (transformType>>(42-6*uint(count)))&0x3F != 0 {
+		count++
+	}
+
+	return count
+}
+
+// readCompactHeader reads a compact stream header (the magic byte has
+// already been read)
+func (this *Reader) readCompactHeader() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid compact bitstream header", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	offset := (this.ibs.Read() >> 3) - 1
+	ckSize := this.ibs.ReadBits(2)
+
+	if ckSize == 1 {
+		this.hasher32, err = hash.NewXXHash32(_BITSTREAM_TYPE)
+	} else if ckSize == 2 {
+		this.hasher64, err = hash.NewXXHash64(_BITSTREAM_TYPE)
+	} else if ckSize == 3 {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect checksum size: %d", ckSize)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	this.entropyType = uint32(this.ibs.ReadBits(5))
+	var eType string
+
+	if eType, err = entropy.GetName(this.entropyType); err != nil {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect entropy type: %d", this.entropyType)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+	}
+
+	this.transformType = 0
+
+	if this.ibs.ReadBit() == 1 {
+		count := uint(this.ibs.ReadBits(3)) + 1
+		this.transformType = this.ibs.ReadBits(6*count) << (48 - 6*count)
+	}
+
+	var tType string
+
+	if tType, err = transform.GetName(this.transformType); err != nil {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect transform type: %d", this.transformType)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+	}
+
+	this.blockSize = _COMPACT_BLOCK_SIZE
+	this.slots.reconfigure()
+	this.ctx["bsVersion"] = uint(_BITSTREAM_BASE_VERSION)
+	this.ctx["entropy"] = eType
+	this.ctx["transform"] = tType
+	this.ctx["blockSize"] = uint(this.blockSize)
+	this.outputSize = 0
+	this.nbInputBlocks = 1
+	this.blockCount = 1
+	return this.addSegment(offset, _BITSTREAM_BASE_VERSION, 0, true)
+}
+
+// endCompactSegment records the original size of a compact stream (not
+// stored in the header) once it has been decoded
+func (this *Reader) endCompactSegment() {
+	if this.segmentEnd == false || len(this.segments) == 0 {
+		return
+	}
+
+	last := &this.segments[len(this.segments)-1]
+
+	if last.Compact == false {
+		return
+	}
+
+	last.OriginalSize = this.decodedBytes - last.DecodedOffset
+
+	if this.parentCtx != nil {
+		if len(this.segments) == 1 {
+			(*this.parentCtx)["outputSize"] = last.OriginalSize
+		} else if sz, hasKey := (*this.parentCtx)["outputSize"]; hasKey == true && sz.(int64) != 0 {
+			(*this.parentCtx)["outputSize"] = sz.(int64) + last.OriginalSize
+		}
+	}
+}
+
+// CompressSmall compresses src in memory and returns the stream. The
+// stream uses the compact framing (see above) if src is small enough.
+// The stream is decoded by a regular Reader.
+func CompressSmall(src []byte, opts Options) ([]byte, error) {
+	ctx := opts.streamContext()
+	ctx["fileSize"] = int64(len(src))
+	ctx["compact"] = true
+	bufStream := internal.NewBufferStream(make([]byte, 0, len(src)/2+64))
+	w, err := NewWriterWithCtx(bufStream, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(src); err != nil {
+		return nil, err
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return bufStream.Bytes(), nil
+}
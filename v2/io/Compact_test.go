@@ -0,0 +1,116 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	fmt.Println("Compact Test")
+
+	msg := bytes.Repeat([]byte(`{"id":12345,"name":"kanzi","tags":["a","b"]}`), 20)
+
+	for _, opts := range []Options{{}, {Transform: "LZ", Entropy: "HUFFMAN", Checksum: 32}, {Transform: "TEXT+BWT+MTFT+ZRLT", Entropy: "ANS0"}} {
+		small, err := CompressSmall(msg, opts)
+
+		if err != nil {
+			t.Fatalf("Compression failed: %v", err)
+		}
+
+		regular, _ := compressedSize(msg, opts.streamContext())
+		fmt.Printf("%s&%s: %d => %d bytes (regular framing: %d bytes)\n", opts.Transform, opts.Entropy, len(msg), len(small), regular)
+
+		if small[0] != _COMPACT_MAGIC || int64(len(small)) > regular-12 {
+			t.Errorf("%s&%s: compact framing not used", opts.Transform, opts.Entropy)
+		}
+
+		r := mustReader(t, small, map[string]any{"jobs": uint(1)})
+		res, err := io.ReadAll(r)
+
+		if err != nil || bytes.Equal(res, msg) == false {
+			t.Errorf("%s&%s: invalid decompressed data: %v", opts.Transform, opts.Entropy, err)
+		}
+
+		if infos := r.Segments(); len(infos) != 1 || infos[0].Compact == false || infos[0].OriginalSize != int64(len(msg)) {
+			t.Errorf("%s&%s: invalid segment: %+v", opts.Transform, opts.Entropy, infos)
+		}
+	}
+
+	// More data than announced: regular framing
+	bs := internal.NewBufferStream()
+	w, _ := NewWriterWithCtx(bs, map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536),
+		"jobs": uint(1), "checksum": uint(0), "fileSize": int64(100), "compact": true})
+	w.Write(msg)
+	w.Close()
+
+	if bs.Bytes()[0] == _COMPACT_MAGIC {
+		t.Errorf("Compact framing used with more data than announced")
+	}
+
+	// Default settings: regular version 6 stream (readable by version 6
+	// decoders), even for a small input of known size
+	bs = internal.NewBufferStream()
+	w, _ = NewWriter(bs, "LZ", "HUFFMAN", 65536, 1, 32, int64(len(msg)), false)
+	w.Write(msg)
+	w.Close()
+	output := bs.Bytes()
+
+	if string(output[0:4]) != "KANZ" || output[4]>>4 != _BITSTREAM_BASE_VERSION {
+		t.Errorf("Expected a version 6 stream, got %x", output[0:5])
+	}
+
+	res, r, err := decompressData(output, nil)
+
+	if err != nil || bytes.Equal(res, msg) == false || r.Segments()[0].Compact == true ||
+		r.Segments()[0].BitstreamVersion != _BITSTREAM_BASE_VERSION {
+		t.Errorf("Default small stream: invalid decompressed data or segment: %v", err)
+	}
+
+	// Chained compact streams
+	stream := make([]byte, 0)
+	expected := make([]byte, 0)
+
+	for i := 0; i < 3; i++ {
+		data := msg[0 : 250*(i+1)]
+		small, _ := CompressSmall(data, Options{Entropy: "FPAQ", Checksum: 64})
+		stream = append(stream, small...)
+		expected = append(expected, data...)
+	}
+
+	large := bytes.Repeat(msg, 100)
+	bs = internal.NewBufferStream()
+	w, _ = NewWriter(bs, "LZ", "ANS0", 65536, 1, 0, int64(len(large)), false)
+	w.Write(large)
+	w.Close()
+	stream = append(stream, bs.Bytes()...)
+	expected = append(expected, large...)
+	ctx := map[string]any{"jobs": uint(2), "chained": true}
+	r = mustReader(t, stream, ctx)
+	res, err = io.ReadAll(r)
+
+	if err != nil || bytes.Equal(res, expected) == false {
+		t.Errorf("Chained compact streams: invalid decompressed data: %v", err)
+	}
+
+	if len(r.Segments()) != 4 || ctx["outputSize"].(int64) != int64(len(expected)) {
+		t.Errorf("Chained compact streams: invalid segments: %+v", r.Segments())
+	}
+}
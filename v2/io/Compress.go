@@ -0,0 +1,128 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const (
+	_COPY_BUFFER_SIZE = 1024 * 1024 // decompressed bytes between cancellation checks
+)
+
+// Compress compresses src to dst (not closed) with the options and returns
+// the size of the compressed stream. The cancellation of ctx is checked
+// before each block is read from src, in which case ctx.Err() is the cause
+// of the error returned. Opts.Jobs defaults to GOMAXPROCS.
+func Compress(ctx context.Context, dst io.Writer, src io.Reader, opts Options) (int64, error) {
+	params := opts.streamContext()
+
+	if opts.Jobs == 0 {
+		params["jobs"] = uint(min(runtime.GOMAXPROCS(0), _MAX_CONCURRENCY))
+	}
+
+	w, err := NewWriterWithCtx(nopWriteCloser{dst}, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, w.blockSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return int64(w.GetWritten()), newCancelError("Compression", err)
+		}
+
+		n, err := io.ReadFull(src, buf)
+
+		if n > 0 {
+			if _, err := w.Write(buf[0:n]); err != nil {
+				return int64(w.GetWritten()), err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return int64(w.GetWritten()), &IOError{msg: err.Error(), code: kanzi.ERR_READ_FILE, cause: err}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return int64(w.GetWritten()), err
+	}
+
+	return int64(w.GetWritten()), nil
+}
+
+// Decompress decompresses the stream in src to dst and returns the size of
+// the decompressed data. The cancellation of ctx is checked between
+// chunks of decompressed data, in which case ctx.Err() is the cause of the
+// error returned. Only opts.Jobs is used (GOMAXPROCS if 0): the other
+// parameters are read from the stream header.
+func Decompress(ctx context.Context, dst io.Writer, src io.Reader, opts Options) (int64, error) {
+	jobs := opts.Jobs
+
+	if jobs == 0 {
+		jobs = uint(min(runtime.GOMAXPROCS(0), _MAX_CONCURRENCY))
+	}
+
+	r, err := NewReaderWithCtx(io.NopCloser(src), map[string]any{"jobs": jobs})
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer r.Close()
+	buf := make([]byte, _COPY_BUFFER_SIZE)
+	written := int64(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, newCancelError("Decompression", err)
+		}
+
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			if _, err := dst.Write(buf[0:n]); err != nil {
+				return written, &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+			}
+
+			written += int64(n)
+		}
+
+		if err == io.EOF {
+			return written, nil
+		}
+
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func newCancelError(op string, cause error) *IOError {
+	return &IOError{msg: fmt.Sprintf("%s cancelled: %v", op, cause), code: kanzi.ERR_PROCESS_BLOCK, cause: cause}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// cancelReader cancels the context after a number of reads
+type cancelReader struct {
+	src    io.Reader
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (this *cancelReader) Read(buf []byte) (int, error) {
+	if this.reads--; this.reads == 0 {
+		this.cancel()
+	}
+
+	return this.src.Read(buf)
+}
+
+func TestCompress(t *testing.T) {
+	fmt.Println("Compress Test")
+	data := []byte{}
+
+	for i := 0; i < 50000; i++ {
+		data = append(data, fmt.Sprintf("%d: the quick brown fox jumps over the lazy dog. ", i*i)...)
+	}
+
+	for _, opts := range []Options{
+		{Transform: "TEXT+LZ", Entropy: "HUFFMAN", BlockSize: 65536, Checksum: 32},
+		{Transform: "BWT", Entropy: "CM", BlockSize: 256 * 1024, Jobs: 2},
+		{},
+	} {
+		var compressed, decompressed bytes.Buffer
+		n, err := Compress(context.Background(), &compressed, bytes.NewReader(data), opts)
+
+		if err != nil || n != int64(compressed.Len()) {
+			t.Fatalf("Compress failed: %v (%d bytes, %d written)", err, n, compressed.Len())
+		}
+
+		n, err = Decompress(context.Background(), &decompressed, bytes.NewReader(compressed.Bytes()), Options{})
+
+		if err != nil || n != int64(len(data)) || bytes.Equal(decompressed.Bytes(), data) == false {
+			t.Fatalf("Decompress failed: %v (%d bytes)", err, n)
+		}
+	}
+
+	// Invalid options are reported as errors
+	if _, err := Compress(context.Background(), io.Discard, bytes.NewReader(data), Options{Transform: "FOO"}); err == nil {
+		t.Errorf("Expected an error for an invalid transform")
+	}
+
+	// Cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	src := &cancelReader{src: bytes.NewReader(data), reads: 2, cancel: cancel}
+	_, err := Compress(ctx, io.Discard, src, Options{Transform: "LZ", BlockSize: 65536})
+
+	if errors.Is(err, context.Canceled) == false {
+		t.Errorf("Expected a cancelled compression, got %v", err)
+	}
+
+	var compressed bytes.Buffer
+	Compress(context.Background(), &compressed, bytes.NewReader(data), Options{Transform: "LZ", BlockSize: 65536})
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = Decompress(ctx, io.Discard, bytes.NewReader(compressed.Bytes()), Options{})
+
+	if errors.Is(err, context.Canceled) == false {
+		t.Errorf("Expected a cancelled decompression, got %v", err)
+	}
+}
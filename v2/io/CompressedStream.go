@@ -18,12 +18,15 @@ limitations under the License.
 package io
 
 import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
 	"fmt"
 	"io"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
@@ -42,22 +45,31 @@ import (
 
 const (
 	_BITSTREAM_TYPE             = 0x4B414E5A // "KANZ"
-	_BITSTREAM_FORMAT_VERSION   = 6
+	_BITSTREAM_FORMAT_VERSION   = 7
+	_BITSTREAM_BASE_VERSION     = 6       // version of the streams without header flags
+	_LINKED_WINDOW_SIZE         = 1 << 16 // end of the previous block used to prime the next one
 	_STREAM_DEFAULT_BUFFER_SIZE = 256 * 1024
 	_EXTRA_BUFFER_SIZE          = 512
+	_STRICT_BLOCK_MARGIN        = 1024
 	_COPY_BLOCK_MASK            = 0x80
 	_TRANSFORMS_MASK            = 0x10
 	_MIN_BITSTREAM_BLOCK_SIZE   = 1024
 	_MAX_BITSTREAM_BLOCK_SIZE   = 1024 * 1024 * 1024
-	_SMALL_BLOCK_SIZE           = 15
+	_SMALL_BLOCK_SIZE           = 15   // default size of the blocks always copied
+	_SMALL_BLOCK_PROBE_SIZE     = 4096 // blocks up to this size copied if the entropy probe fails
 	_MAX_CONCURRENCY            = 64
 	_CANCEL_TASKS_ID            = -1
+	_MIN_OUTPUT_BUFFER_FLOOR    = 4 * 1024
+	_MAX_OUTPUT_BUFFER_FLOOR    = 512 * 1024
+	_DEFAULT_BUFFER_MARGIN      = 3
+	_CONTAINER_CHUNK_SIZE       = 4096 // entropy test of the blocks of Parquet, ORC and Avro files
 )
 
 // IOError an extended error containing a message and a code value
 type IOError struct {
-	msg  string
-	code int
+	msg   string
+	code  int
+	cause error // underlying error (if any)
 }
 
 // Error returns the underlying error
@@ -75,11 +87,80 @@ func (this IOError) ErrorCode() int {
 	return this.code
 }
 
+// DecodingError an IOError returned by a Reader in strict mode, with the
+// position of the invalid data.
+type DecodingError struct {
+	IOError
+	BlockID int    // ID of the block (starting at 1), 0 if not in a block (EG. header)
+	Offset  uint64 // position in the input (in bits) of the block or of the error
+}
+
+// Error returns the underlying error and its position
+func (this DecodingError) Error() string {
+	return fmt.Sprintf("%v (code %v, block %v, offset %v)", this.msg, this.code, this.BlockID, this.Offset)
+}
+
+// TransformFailure captures diagnostic information about a block for which
+// the forward transform panicked. The block has been emitted untransformed.
+type TransformFailure struct {
+	BlockID   int
+	Transform string
+	BlockSize int
+	InputHash uint64 // XXHash64 of the block input
+	Error     string
+	Stack     string
+}
+
+type transformFailures struct {
+	lock    sync.Mutex
+	entries []TransformFailure
+}
+
 type blockBuffer struct {
 	// Enclose a slice in a struct to share it between stream and tasks
 	// and reduce memory allocation.
 	// The tasks can re-allocate the slice as needed.
-	Buf []byte
+	Buf   []byte
+	node  *numaNode // memory bound to this NUMA node if not nil (see Numa.go)
+	owned bool      // buffer of the caller, never returned to the pool (see ZeroCopy.go)
+}
+
+// grow replaces the slice with a slice of at least n bytes from the buffer
+// pool (if shorter) and returns it. The previous slice goes back to the
+// pool. The content is preserved if keep is true.
+func (this *blockBuffer) grow(n int, keep bool) []byte {
+	if len(this.Buf) >= n {
+		return this.Buf
+	}
+
+	buf := internal.DefaultBufferPool.GetBytes(n)
+
+	if keep == true {
+		copy(buf, this.Buf)
+	}
+
+	if this.owned == false {
+		internal.DefaultBufferPool.PutBytes(this.Buf)
+	}
+
+	this.Buf = buf
+	this.owned = false
+
+	if this.node != nil {
+		this.node.bind(buf)
+	}
+
+	return buf
+}
+
+// release returns the slice to the buffer pool
+func (this *blockBuffer) release() {
+	if this.owned == false {
+		internal.DefaultBufferPool.PutBytes(this.Buf)
+	}
+
+	this.Buf = make([]byte, 0)
+	this.owned = false
 }
 
 // Writer a Writer that writes compressed data
@@ -102,6 +183,52 @@ type Writer struct {
 	listeners     []kanzi.Listener
 	ctx           map[string]any
 	headless      bool
+	bufferFloor   uint
+	bufferMargin  uint
+	retryOnPanic  bool
+	failures      transformFailures
+	lock          sync.Mutex
+	flushInterval time.Duration
+	flushTimer    *time.Timer
+	flushArmed    bool
+	flushErr      error
+	manifest      *manifestBuilder
+	archive       *archiveBuilder
+	footer        *footerDigest // set if a footer is written
+	stats         *statsBuilder // set if a statistics trailer is written
+	aead          cipher.AEAD   // set if the blocks are encrypted
+	cipherType    uint
+	salt          []byte
+	header        []byte // stream header, authenticated with each encrypted block
+	processed     int64  // bytes of input written to the bitstream
+	linked        bool   // each block is primed with the end of the previous one
+	window        []byte // end of the previous block (linked blocks)
+	storeOnly     bool   // NONE transform and NONE entropy: blocks bypass the buffers
+	autoTune      bool   // codecs selected for each block (see AutoTune.go)
+	candidates    []autoTuneCandidate
+	maxMemory     int64          // memory budget (0 if none)
+	volumes       *volumeWriter  // set if the output is split in volumes (see MultiVolume.go)
+	governor      *speedGovernor // set if the codecs depend on the encoding speed (see Governor.go)
+	chunker       *blockChunker  // set if the blocks end at content defined cut points (see Rsyncable.go)
+	compact       bool           // single block with a compact header (see Compact.go)
+	blockHash     *blockHasher   // set if each block carries a strong hash (see BlockHash.go)
+	dedup         *dedupEncoder  // set if identical blocks are emitted as repeat records (see Dedup.go)
+	shared        *SharedContext // set if the transforms are primed with a shared dictionary (see Shared.go)
+	index         *indexBuilder  // set if the positions of the blocks are recorded (see Index.go)
+	smallBlock    uint           // blocks up to this size are copied
+	onBlock       func(BlockBoundary)
+	streamOffset  uint64         // bytes of the stream before the bitstream (appended stream)
+	options       map[string]any // parameters of the stream (see Reset.go)
+	recentBlock   int            // largest block since the last shrink of the buffers (see BufferGrowth.go)
+	batches       int            // batches of blocks since the last shrink of the buffers
+	numa          []*numaNode    // nodes of the job slots, nil if not NUMA aware (see Numa.go)
+	ckPolicy      ChecksumPolicy // set if the blocks are selected for checksums (see ChecksumPolicy.go)
+	checksumSeed  uint32         // seed of the block checksums
+	customSeed    bool           // the seed is stored in the header
+	stageParams   uint64         // parameters of the inverse transforms (see StageParams.go)
+	syncMarkers   bool           // a sync marker precedes each block (see Resync.go)
+	entropyLanes  uint           // max ANS lanes of a block (see entropy/ANSLanes.go), 0 if none
+	slots         *encodingSlots // state of the tasks reused by the batches (see TaskSlots.go)
 }
 
 type encodingTask struct {
@@ -109,7 +236,9 @@ type encodingTask struct {
 	oBuffer            *blockBuffer
 	hasher32           *hash.XXHash32
 	hasher64           *hash.XXHash64
+	blockHash          *blockHasher
 	blockLength        uint
+	smallBlock         uint
 	blockTransformType uint64
 	blockEntropyType   uint32
 	currentBlockID     int32
@@ -118,6 +247,33 @@ type encodingTask struct {
 	listeners          []kanzi.Listener
 	obs                kanzi.OutputBitStream
 	ctx                map[string]any
+	bufferFloor        uint
+	bufferMargin       uint
+	byteAlign          bool
+	retryOnPanic       bool
+	failures           *transformFailures
+	manifest           *manifestBuilder
+	archive            *archiveBuilder
+	stats              *statsBuilder
+	aead               cipher.AEAD
+	header             []byte
+	processed          *int64 // updated in block order
+	inputSize          int64
+	autoTune           bool
+	candidates         []autoTuneCandidate
+	volumes            *volumeWriter
+	governor           *speedGovernor
+	governorLevel      int
+	onBlock            func(BlockBoundary)
+	index              *indexBuilder
+	streamOffset       uint64
+	repeatOf           int32 // ID of the identical earlier block (0 if none)
+	ckPolicy           ChecksumPolicy
+	stageParams        uint64 // parameters of the stages of stageType (see StageParams.go)
+	stageType          uint64
+	syncMarkers        bool
+	scratch            *internal.BlockScratch
+	local              *taskLocal // reused bitstream of the job slot (nil if none)
 }
 
 type encodingTaskResult struct {
@@ -147,6 +303,7 @@ func NewWriter(os io.WriteCloser, transform, entropy string, blockSize, jobs uin
 // map of parameters and a writer.
 // The writer writes compressed data blocks to the provided os
 // using a default output bitstream.
+// The values of the map are not type checked: prefer NewWriterWithOptions.
 func NewWriterWithCtx(os io.WriteCloser, ctx map[string]any) (*Writer, error) {
 	var err error
 	var obs kanzi.OutputBitStream
@@ -167,12 +324,28 @@ func NewWriterWithCtx2(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer,
 }
 
 func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer, error) {
+	this := &Writer{}
+
+	if err := this.init(obs, ctx); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// init validates the parameters and initializes a new or reset Writer
+func (this *Writer) init(obs kanzi.OutputBitStream, ctx map[string]any) error {
 	if obs == nil {
-		return nil, &IOError{msg: "Invalid null output bitstream parameter", code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: "Invalid null output bitstream parameter", code: kanzi.ERR_INVALID_PARAM}
 	}
 
 	if ctx == nil {
-		return nil, &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	// Transform stages with options (see StageParams.go)
+	if err := applyTransformSequence(ctx); err != nil {
+		return err
 	}
 
 	entropyCodec := ctx["entropy"].(string)
@@ -181,35 +354,40 @@ func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer
 
 	if tasks == 0 || tasks > _MAX_CONCURRENCY {
 		errMsg := fmt.Sprintf("The number of jobs must be in [1..%d], got %d", _MAX_CONCURRENCY, tasks)
-		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if _SINGLE_THREAD == true {
+		// No concurrent tasks in single thread builds
+		tasks = 1
 	}
 
 	bSize := ctx["blockSize"].(uint)
 
 	if bSize > _MAX_BITSTREAM_BLOCK_SIZE {
 		errMsg := fmt.Sprintf("The block size must be at most %d MB", _MAX_BITSTREAM_BLOCK_SIZE>>20)
-		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
 	}
 
 	if bSize < _MIN_BITSTREAM_BLOCK_SIZE {
 		errMsg := fmt.Sprintf("The block size must be at least %d", _MIN_BITSTREAM_BLOCK_SIZE)
-		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
 	}
 
 	if int(bSize)&-16 != int(bSize) {
-		return nil, &IOError{msg: "The block size must be a multiple of 16", code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: "The block size must be a multiple of 16", code: kanzi.ERR_INVALID_PARAM}
 	}
 
-	this := &Writer{}
 	this.obs = obs
 	this.ctx = ctx
+	this.options = cloneContext(ctx)
 
 	// Check entropy type validity (panic on error)
 	var eType uint32
 	var err error
 
 	if eType, err = entropy.GetType(entropyCodec); err != nil {
-		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
 	}
 
 	this.entropyType = eType
@@ -218,7 +396,40 @@ func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer
 	this.transformType, err = transform.GetType(t)
 
 	if err != nil {
-		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	this.stageParams = getStageParams(ctx)
+
+	if this.stageParams != 0 {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true {
+			return &IOError{msg: "The transform stage parameters require a stream header", code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	// Sync marker before each block (see Resync.go)
+	if val, hasKey := ctx["syncMarkers"]; hasKey && val.(bool) == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true {
+			return &IOError{msg: "The sync markers require a stream header", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.syncMarkers = true
+	}
+
+	// ANS blocks split in lanes coded by several jobs (see entropy/ANSLanes.go)
+	if val, hasKey := ctx["entropyLanes"]; hasKey {
+		lanes, ok := val.(uint)
+
+		if ok == false || lanes == 1 || lanes > 16 {
+			errMsg := fmt.Sprintf("Invalid number of entropy lanes: %v (must be 0 or in [2..16])", val)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if hdl, _ := ctx["headerless"].(bool); hdl == true && lanes != 0 {
+			return &IOError{msg: "The entropy lanes require a stream header", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.entropyLanes = lanes
 	}
 
 	this.blockSize = int(bSize)
@@ -233,20 +444,178 @@ func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer
 
 	this.nbInputBlocks = min(nbBlocks, _MAX_CONCURRENCY-1)
 
-	if checksum := ctx["checksum"].(uint); checksum != 0 {
+	checksum := ctx["checksum"].(uint)
+
+	// Archival profile (see Archive.go): 64 bit block checksums, byte aligned
+	// blocks and a trailer with the header copy, index, digest and parity
+	if val, hasKey := ctx["archival"]; hasKey && val.(bool) == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true {
+			return &IOError{msg: "The archival mode requires a stream header", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if checksum != 0 && checksum != 64 {
+			return &IOError{msg: "The archival mode requires 64 bit block checksums", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		checksum = 64
+
+		if this.archive, err = newArchiveBuilder(); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR, cause: err}
+		}
+	}
+
+	// Footer with the original size and hash (see Footer.go)
+	if val, hasKey := ctx["footer"]; hasKey && val.(bool) == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true || this.archive != nil {
+			return &IOError{msg: "The footer requires a stream header and is not compatible with the archival mode",
+				code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if this.footer, err = newFooterDigest(true); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR, cause: err}
+		}
+	}
+
+	// Statistics trailer (see Stats.go)
+	if val, hasKey := ctx["stats"]; hasKey && val.(bool) == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true || this.archive != nil {
+			return &IOError{msg: "The statistics trailer requires a stream header and is not compatible with the archival mode",
+				code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.stats = newStatsBuilder()
+	}
+
+	// Linked blocks: the LZ, LZX and ROLZ transforms of each block are primed
+	// with the end of the previous block (see BlockScratch.Priming). Blocks are
+	// encoded one at a time.
+	if val, hasKey := ctx["linkedBlocks"]; hasKey && val.(bool) == true {
+		if tasks != 1 {
+			return &IOError{msg: "Linked blocks require a single job", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.linked = true
+	}
+
+	// Blocks ending at content defined cut points (see Rsyncable.go)
+	if val, hasKey := ctx["rsyncable"]; hasKey && val.(bool) == true {
+		this.chunker = newBlockChunker(this.blockSize)
+		this.nbInputBlocks = 0
+	}
+
+	// Selection of the transform and entropy codec of each block
+	if val, hasKey := ctx["autoTune"]; hasKey && val.(bool) == true {
+		this.autoTune = true
+	}
+
+	// Faster codecs when the encoding speed drops (see Governor.go)
+	if val, hasKey := ctx["minSpeedMBps"]; hasKey {
+		minSpeed, ok := val.(float64)
+
+		if ok == false || minSpeed <= 0 {
+			errMsg := fmt.Sprintf("Invalid minimum speed: %v", val)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if this.autoTune == true {
+			return &IOError{msg: "The speed governor is not compatible with the automatic codec selection", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.governor = newSpeedGovernor(minSpeed, this.transformType, this.entropyType)
+	}
+
+	// Encryption of the blocks (see Cipher.go)
+	cipherType, key, err := cipherParams(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if cipherType != _CIPHER_NONE {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true || this.archive != nil {
+			return &IOError{msg: "Encryption requires a stream header and is not compatible with the archival mode",
+				code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.cipherType = cipherType
+		this.salt = make([]byte, _CIPHER_SALT_SIZE)
+
+		if _, err = rand.Read(this.salt); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR, cause: err}
+		}
+
+		if this.aead, err = newStreamCipher(cipherType, key, this.salt); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	// Checksum seed and selection of the checksummed blocks (see ChecksumPolicy.go)
+	if this.checksumSeed, this.customSeed, err = getChecksumSeed(ctx); err != nil {
+		return err
+	}
+
+	if this.ckPolicy, err = getChecksumPolicy(ctx); err != nil {
+		return err
+	}
+
+	if this.ckPolicy != nil || this.customSeed == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true {
+			return &IOError{msg: "The checksum policy and seed require a stream header", code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	if checksum != 0 {
 		var err error
 
 		if checksum == 32 {
-			this.hasher32, err = hash.NewXXHash32(_BITSTREAM_TYPE)
+			this.hasher32, err = hash.NewXXHash32(this.checksumSeed)
 		} else if checksum == 64 {
-			this.hasher64, err = hash.NewXXHash64(_BITSTREAM_TYPE)
+			this.hasher64, err = hash.NewXXHash64(uint64(this.checksumSeed))
 		} else {
 			err = &IOError{msg: "The lock checksum size must be 32 or 64 bits", code: kanzi.ERR_INVALID_PARAM}
 		}
 
 		if err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	// Strong hash of each block (see BlockHash.go)
+	if val, hasKey := ctx["blockHash"]; hasKey {
+		name, _ := val.(string)
+		hashType, err := getBlockHashType(name)
+
+		if err == nil {
+			this.blockHash, err = newBlockHasher(hashType)
+		}
+
+		if err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	// Identical blocks emitted as repeat records (see Dedup.go)
+	if val, hasKey := ctx["dedup"]; hasKey && val.(bool) == true {
+		if this.linked == true || this.aead != nil {
+			return &IOError{msg: "Deduplication is not compatible with linked blocks nor encryption", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.dedup = newDedupEncoder(this.blockSize, this.blockHash)
+	}
+
+	// Transforms primed with a shared dictionary (see Shared.go)
+	if this.shared, err = getSharedContext(ctx); err != nil {
+		return err
+	}
+
+	// Index sidecar with the position of each block (see Index.go)
+	if val, hasKey := ctx["index"]; hasKey && val.(bool) == true {
+		if hdl, _ := ctx["headerless"].(bool); hdl == true || this.linked == true || this.dedup != nil {
+			return &IOError{msg: "The index requires a stream header and is not compatible with linked blocks nor deduplication",
+				code: kanzi.ERR_INVALID_PARAM}
 		}
+
+		this.index = &indexBuilder{}
 	}
 
 	if hdl, hasKey := ctx["headerless"]; hasKey == true {
@@ -255,23 +624,157 @@ func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer
 		this.headless = false
 	}
 
-	ctx["bsVersion"] = uint(_BITSTREAM_FORMAT_VERSION)
-	this.jobs = int(tasks)
-	this.buffers = make([]blockBuffer, 2*this.jobs)
+	// Minimum size of the per task output buffer. By default, it is
+	// proportionate to the block size (within bounds).
+	if val, hasKey := ctx["bufferFloor"]; hasKey {
+		this.bufferFloor = val.(uint)
+
+		if this.bufferFloor > _MAX_BITSTREAM_BLOCK_SIZE {
+			errMsg := fmt.Sprintf("The output buffer floor must be at most %d MB", _MAX_BITSTREAM_BLOCK_SIZE>>20)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+	} else {
+		this.bufferFloor = min(max(bSize<<2, _MIN_OUTPUT_BUFFER_FLOOR), _MAX_OUTPUT_BUFFER_FLOOR)
+	}
+
+	// Extra room reserved for blocks expanded by the entropy coder:
+	// blockSize >> bufferMargin bytes.
+	if val, hasKey := ctx["bufferMargin"]; hasKey {
+		this.bufferMargin = val.(uint)
+
+		if this.bufferMargin > 16 {
+			errMsg := fmt.Sprintf("The output buffer margin must be in [0..16], got %d", this.bufferMargin)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+	} else {
+		this.bufferMargin = _DEFAULT_BUFFER_MARGIN
+	}
+
+	// Blocks up to this size are copied (no transform, no entropy coding).
+	// The larger blocks up to _SMALL_BLOCK_PROBE_SIZE are copied if an order
+	// 0 estimate of the entropy coded size shows no gain.
+	this.smallBlock = _SMALL_BLOCK_SIZE
 
-	// Allocate first buffer and add padding for incompressible blocks
-	bufSize := max(this.blockSize+this.blockSize>>6, 65536)
-	this.buffers[0] = blockBuffer{Buf: make([]byte, bufSize)}
-	this.buffers[this.jobs] = blockBuffer{Buf: make([]byte, 0)}
+	if val, hasKey := ctx["smallBlockSize"]; hasKey {
+		this.smallBlock = val.(uint)
 
-	for i := 1; i < this.jobs; i++ {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
-		this.buffers[i+this.jobs] = blockBuffer{Buf: make([]byte, 0)}
+		if this.smallBlock > _SMALL_BLOCK_PROBE_SIZE {
+			errMsg := fmt.Sprintf("The small block size must be in [0..%d], got %d", _SMALL_BLOCK_PROBE_SIZE, this.smallBlock)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	// If the forward transform panics, emit the block untransformed instead
+	// of failing the stream. Requires a copy of each block input.
+	if val, hasKey := ctx["retryOnPanic"]; hasKey {
+		this.retryOnPanic = val.(bool)
+	}
+
+	// Collect the digests of the blocks to produce a detached manifest
+	if val, hasKey := ctx["manifest"]; hasKey && val.(bool) == true {
+		this.manifest = &manifestBuilder{}
+	}
+
+	// Buffered data older than the flush interval is encoded and pushed to
+	// the underlying stream automatically (0 means no automatic flush).
+	if val, hasKey := ctx["flushInterval"]; hasKey {
+		this.flushInterval = val.(time.Duration)
+
+		if this.flushInterval < 0 {
+			errMsg := fmt.Sprintf("The flush interval must be positive, got %v", this.flushInterval)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		// The automatic flush runs in a timer goroutine
+		if this.flushInterval > 0 && _SINGLE_THREAD == true {
+			return &IOError{msg: "The flush interval is not available in single thread builds", code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	// In deterministic mode, the output does not depend on the number of jobs,
+	// the number of CPUs or the timing: the blocks always have the same
+	// boundaries and the codecs produce the same output regardless of the
+	// jobs they are given. The automatic flush (timer based) is not allowed.
+	if val, hasKey := ctx["deterministic"]; hasKey && val.(bool) == true {
+		if this.flushInterval > 0 {
+			return &IOError{msg: "The deterministic mode is not compatible with a flush interval", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if this.governor != nil {
+			return &IOError{msg: "The deterministic mode is not compatible with the speed governor", code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	// In store mode (checksum and framing only), full blocks are written
+	// directly from the input of Write.
+	this.storeOnly = this.transformType == transform.NONE_TYPE && this.entropyType == entropy.NONE_TYPE
+
+	// Effort of the skip block detection (see SkipDetector.go)
+	if _, err := getAnalysisLevel(ctx); err != nil {
+		return err
+	}
+
+	if val, hasKey := ctx["skipBlocks"]; (hasKey && val.(bool) == true) || this.archive != nil || this.stats != nil || this.aead != nil || this.linked == true || this.autoTune == true || this.governor != nil || this.chunker != nil || this.dedup != nil || this.index != nil || this.volumes != nil {
+		this.storeOnly = false
+	}
+
+	// Reduce the number of jobs to fit in the memory budget (see Memory.go)
+	if this.maxMemory, err = getMaxMemory(ctx); err != nil {
+		return err
+	}
+
+	taskMemory := EstimateTaskMemory(bSize, this.transformType, this.entropyType)
+
+	if this.autoTune == true {
+		this.candidates = autoTuneCandidatesFor(bSize, this.maxMemory)
+		taskMemory = autoTuneTaskMemory(bSize, this.transformType, this.entropyType, this.candidates)
+	}
+
+	jobs, err := memoryLimitedJobs(int(tasks), taskMemory, this.maxMemory)
+
+	if err != nil {
+		return err
+	}
+
+	ctx["bsVersion"] = this.formatVersion()
+	this.jobs = jobs
+
+	// The buffers of a reset Writer are reused (see Reset.go)
+	if len(this.buffers) != 2*this.jobs {
+		this.buffers = make([]blockBuffer, 2*this.jobs)
+
+		for i := range this.buffers {
+			this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		}
+	}
+
+	this.numa = getNumaNodes(ctx)
+	setNumaNodes(this.buffers, this.numa)
+
+	if this.onBlock, err = getBlockCallback(ctx); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	if this.onBlock != nil {
+		// Byte aligned blocks (see BlockBoundary.go)
+		this.storeOnly = false
 	}
 
 	this.blockID = 0
-	this.listeners = make([]kanzi.Listener, 0)
-	return this, nil
+
+	if this.listeners == nil {
+		this.listeners = make([]kanzi.Listener, 0)
+	}
+
+	this.compact = this.allowCompact(ctx)
+
+	if this.aead != nil {
+		if this.header, err = this.headerBytes(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // AddListener adds an event listener to this writer.
@@ -303,10 +806,20 @@ func (this *Writer) RemoveListener(bl kanzi.Listener) bool {
 }
 
 func (this *Writer) writeHeader() *IOError {
-	if this.headless == true || atomic.SwapInt32(&this.initialized, 1) != 0 {
+	if this.headless == true || swapInt32(&this.initialized, 1) != 0 {
 		return nil
 	}
 
+	// The whole input is known to fit in one block only when closing
+	if this.compact == true && loadInt32(&this.closed) == 1 {
+		return this.encodeCompactHeader(this.obs)
+	}
+
+	return this.encodeHeader(this.obs)
+}
+
+// encodeHeader writes the stream header to the provided bitstream
+func (this *Writer) encodeHeader(obs kanzi.OutputBitStream) *IOError {
 	ckSize := 0
 
 	if this.hasher32 != nil {
@@ -315,57 +828,45 @@ func (this *Writer) writeHeader() *IOError {
 		ckSize = 2
 	}
 
-	if this.obs.WriteBits(_BITSTREAM_TYPE, 32) != 32 {
+	if obs.WriteBits(_BITSTREAM_TYPE, 32) != 32 {
 		return &IOError{msg: "Cannot write bitstream type to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	if this.obs.WriteBits(_BITSTREAM_FORMAT_VERSION, 4) != 4 {
+	version := this.formatVersion()
+
+	if obs.WriteBits(uint64(version), 4) != 4 {
 		return &IOError{msg: "Cannot write bitstream version to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	if this.obs.WriteBits(uint64(ckSize), 2) != 2 {
+	if obs.WriteBits(uint64(ckSize), 2) != 2 {
 		return &IOError{msg: "Cannot write checksum size to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	if this.obs.WriteBits(uint64(this.entropyType), 5) != 5 {
+	if obs.WriteBits(uint64(this.entropyType), 5) != 5 {
 		return &IOError{msg: "Cannot write entropy type to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	if this.obs.WriteBits(uint64(this.transformType), 48) != 48 {
+	if obs.WriteBits(uint64(this.transformType), 48) != 48 {
 		return &IOError{msg: "Cannot write transform types to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	if this.obs.WriteBits(uint64(this.blockSize>>4), 28) != 28 {
+	if obs.WriteBits(uint64(this.blockSize>>4), 28) != 28 {
 		return &IOError{msg: "Cannot write block size to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
-	// this.inputSize not provided or >= 2^48 -> 0, <2^16 -> 1, <2^32 -> 2, <2^48 -> 3
-	var szMask uint
-
-	switch {
-	case this.inputSize == 0:
-		szMask = 0
-	case this.inputSize >= (int64(1) << 48):
-		szMask = 0
-	case this.inputSize >= (int64(1) << 32):
-		szMask = 3
-	case this.inputSize >= (int64(1) << 16):
-		szMask = 2
-	default:
-		szMask = 1
-	}
+	szMask := getSizeMask(this.inputSize)
 
-	if this.obs.WriteBits(uint64(szMask), 2) != 2 {
+	if obs.WriteBits(uint64(szMask), 2) != 2 {
 		return &IOError{msg: "Cannot write size of input to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
 	if szMask > 0 {
-		if this.obs.WriteBits(uint64(this.inputSize), 16*szMask) != 16*szMask {
+		if obs.WriteBits(uint64(this.inputSize), 16*szMask) != 16*szMask {
 			return &IOError{msg: "Cannot write size of input to header", code: kanzi.ERR_WRITE_FILE}
 		}
 	}
 
-	seed := uint32(0x01030507 * _BITSTREAM_FORMAT_VERSION)
+	seed := uint32(0x01030507 * version)
 	HASH := uint32(0x1E35A7BD)
 	cksum := HASH * seed
 	cksum ^= (HASH * uint32(^this.entropyType))
@@ -380,27 +881,382 @@ func (this *Writer) writeHeader() *IOError {
 
 	cksum = (cksum >> 23) ^ (cksum >> 3)
 
-	if this.obs.WriteBits(uint64(cksum), 24) != 24 {
+	if obs.WriteBits(uint64(cksum), 24) != 24 {
 		return &IOError{msg: "Cannot write checksum to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
+	if version == _BITSTREAM_BASE_VERSION {
+		// No header flags: readable by version 6 decoders
+		if obs.WriteBits(0, 15) != 15 {
+			return &IOError{msg: "Cannot write padding to header", code: kanzi.ERR_WRITE_FILE}
+		}
+
+		return nil
+	}
+
+	if obs.WriteBits(uint64(this.cipherType), 2) != 2 {
+		return &IOError{msg: "Cannot write cipher type to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	linked := uint64(0)
+
+	if this.linked == true {
+		linked = 1
+	}
+
+	if obs.WriteBits(linked, 1) != 1 {
+		return &IOError{msg: "Cannot write linked blocks flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	autoTune := uint64(0)
+
+	if this.autoTune == true || this.governor != nil {
+		autoTune = 1
+	}
+
+	if obs.WriteBits(autoTune, 1) != 1 {
+		return &IOError{msg: "Cannot write codec selection flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	rsyncable := uint64(0)
+
+	if this.chunker != nil {
+		rsyncable = 1
+	}
+
+	if obs.WriteBits(rsyncable, 1) != 1 {
+		return &IOError{msg: "Cannot write rsyncable flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if obs.WriteBits(uint64(this.blockHash.getType()), 2) != 2 {
+		return &IOError{msg: "Cannot write block hash type to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	dedup := uint64(0)
+
+	if this.dedup != nil {
+		dedup = 1
+	}
+
+	if obs.WriteBits(dedup, 1) != 1 {
+		return &IOError{msg: "Cannot write deduplication flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	dictionary := uint64(0)
+
+	if this.shared != nil {
+		dictionary = 1
+	}
+
+	if obs.WriteBits(dictionary, 1) != 1 {
+		return &IOError{msg: "Cannot write dictionary flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	checksumFlags := uint64(this.checksumFlagBits())
+
+	if obs.WriteBits(checksumFlags, 1) != 1 {
+		return &IOError{msg: "Cannot write checksum policy flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	customSeed := uint64(0)
+
+	if this.customSeed == true {
+		customSeed = 1
+	}
+
+	if obs.WriteBits(customSeed, 1) != 1 {
+		return &IOError{msg: "Cannot write checksum seed flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	stageParams := uint64(0)
+
+	if this.stageParams != 0 {
+		stageParams = 1
+	}
+
+	if obs.WriteBits(stageParams, 1) != 1 {
+		return &IOError{msg: "Cannot write stage parameters flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	syncMarkers := uint64(0)
+
+	if this.syncMarkers == true {
+		syncMarkers = 1
+	}
+
+	if obs.WriteBits(syncMarkers, 1) != 1 {
+		return &IOError{msg: "Cannot write sync markers flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	entropyLanes := uint64(0)
+
+	if this.entropyLanes != 0 {
+		entropyLanes = 1
+	}
+
+	if obs.WriteBits(entropyLanes, 1) != 1 {
+		return &IOError{msg: "Cannot write entropy lanes flag to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
 	padding := uint64(0)
 
-	if this.obs.WriteBits(padding, 15) != 15 {
+	if obs.WriteBits(padding, 1) != 1 {
 		return &IOError{msg: "Cannot write padding to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
+	if this.shared != nil {
+		if obs.WriteBits(uint64(this.shared.id), 32) != 32 {
+			return &IOError{msg: "Cannot write dictionary ID to header", code: kanzi.ERR_WRITE_FILE}
+		}
+	}
+
+	if this.customSeed == true {
+		if obs.WriteBits(uint64(this.checksumSeed), 32) != 32 {
+			return &IOError{msg: "Cannot write checksum seed to header", code: kanzi.ERR_WRITE_FILE}
+		}
+	}
+
+	if this.cipherType != _CIPHER_NONE {
+		if obs.WriteArray(this.salt, 8*_CIPHER_SALT_SIZE) != 8*_CIPHER_SALT_SIZE {
+			return &IOError{msg: "Cannot write cipher salt to header", code: kanzi.ERR_WRITE_FILE}
+		}
+	}
+
 	return nil
 }
 
+// formatVersion returns the version of the bitstream written: the header
+// flags (cipher, linked blocks, codec selection, rsyncable, block hash,
+// dedup, dictionary, checksum policy and seed, stage parameters, sync
+// markers, entropy lanes), the BWT blocks with more than 8 primary indexes and the adaptive
+// hash size of the TEXT transform require version 7, otherwise the stream is
+// written with version 6 (padding bits in place of the flags) so that older
+// decoders can read it.
+func (this *Writer) formatVersion() uint {
+	if this.cipherType != _CIPHER_NONE || this.linked == true || this.autoTune == true ||
+		this.governor != nil || this.chunker != nil || this.blockHash != nil || this.dedup != nil ||
+		this.shared != nil || this.ckPolicy != nil || this.customSeed == true || this.stageParams != 0 ||
+		this.syncMarkers == true || this.entropyLanes != 0 ||
+		this.hasMultiIndexBWT() == true || this.hasTransform(transform.DICT_TYPE) == true {
+		return _BITSTREAM_FORMAT_VERSION
+	}
+
+	return _BITSTREAM_BASE_VERSION
+}
+
+// hasMultiIndexBWT returns true if the blocks are large enough to get more
+// BWT primary indexes in version 7 than in version 6
+func (this *Writer) hasMultiIndexBWT() bool {
+	if transform.GetBWTChunksForVersion(this.blockSize, _BITSTREAM_FORMAT_VERSION) == transform.GetBWTChunks(this.blockSize) {
+		return false
+	}
+
+	return this.hasTransform(transform.BWT_TYPE)
+}
+
+// hasTransform returns true if the transform is part of the sequence
+func (this *Writer) hasTransform(tType uint64) bool {
+	for t := this.transformType; t != 0; t <<= 6 {
+		if (t>>42)&0x3F == tType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSizeMask returns the number of 16 bit words used to store the input
+// size in the header: not provided or >= 2^48 -> 0, <2^16 -> 1, <2^32 -> 2,
+// <2^48 -> 3
+func getSizeMask(inputSize int64) uint {
+	switch {
+	case inputSize == 0:
+		return 0
+	case inputSize >= (int64(1) << 48):
+		return 0
+	case inputSize >= (int64(1) << 32):
+		return 3
+	case inputSize >= (int64(1) << 16):
+		return 2
+	default:
+		return 1
+	}
+}
+
 // Write writes len(block) bytes from block to the underlying data stream.
 // Returns the number of bytes written from block (0 <= n <= len(block)) and
 // any error encountered that caused the write to stop early.
 func (this *Writer) Write(block []byte) (int, error) {
-	if atomic.LoadInt32(&this.closed) == 1 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.writeInput(block, false)
+}
+
+// writeInput writes the data of Write and WriteOwned (owned buffer)
+func (this *Writer) writeInput(block []byte, owned bool) (int, error) {
+	if loadInt32(&this.closed) == 1 {
 		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
 	}
 
+	if this.flushErr != nil {
+		return 0, this.flushErr
+	}
+
+	if this.compact == true && this.processed+int64(this.available+len(block)) > this.inputSize {
+		this.compact = false
+	}
+
+	n := 0
+	var err error
+
+	// Store mode: frame the full blocks in place (no listener expects
+	// per block events)
+	if this.storeOnly == true && this.available == 0 && len(this.listeners) == 0 {
+		for len(block)-n >= this.blockSize {
+			if err = this.writeStoredBlock(block[n : n+this.blockSize]); err != nil {
+				return n, err
+			}
+
+			n += this.blockSize
+		}
+	}
+
+	hashed := 0
+
+	digest := func(end int) {
+		if this.archive != nil {
+			this.archive.update(block[hashed:end])
+		}
+
+		if this.footer != nil {
+			this.footer.update(block[hashed:end])
+		}
+
+		hashed = end
+	}
+
+	// Full blocks of a buffer of the caller encoded in place (see ZeroCopy.go).
+	// The buffer is overwritten: the digests are computed first.
+	if owned == true && this.available == 0 && this.chunker == nil && this.compact == false && err == nil {
+		var m int
+		digest(n + (len(block)-n)/this.blockSize*this.blockSize)
+		m, err = this.writeOwned(block[n:])
+		n += m
+	}
+
+	if n < len(block) && err == nil {
+		var m int
+		m, err = this.write(block[n:])
+		n += m
+	}
+
+	if n > hashed {
+		digest(n)
+	}
+
+	// Start the countdown when data starts sitting in the buffers
+	if this.flushInterval > 0 && this.available > 0 && this.flushArmed == false {
+		if this.flushTimer == nil {
+			this.flushTimer = time.AfterFunc(this.flushInterval, this.autoFlush)
+		} else {
+			this.flushTimer.Reset(this.flushInterval)
+		}
+
+		this.flushArmed = true
+	}
+
+	return n, err
+}
+
+// writeStoredBlock writes a block with the same layout as an encoding task
+// using the NONE transform and the NONE entropy codec, without copies. The
+// block is not recorded by the archive, the index or the volumes (the store
+// mode is disabled if they are used).
+func (this *Writer) writeStoredBlock(block []byte) error {
+	if err := this.writeHeader(); err != nil {
+		return err
+	}
+
+	blockID := addInt32(&this.blockID, 1)
+	length := len(block)
+	checksum := uint64(0)
+	ckBits := this.checksumBits()
+
+	if ckBits > 0 && this.ckPolicy != nil {
+		// Stored block (see ChecksumPolicy.go)
+		class := BlockClass{ID: int(blockID), Size: length, Copied: true,
+			DataType: statsDataTypeName(byte(classifyBlock(block)))}
+
+		if this.ckPolicy(class) == false {
+			ckBits = 0
+		}
+	}
+
+	if ckBits == 32 {
+		checksum = uint64(this.hasher32.Hash(block))
+	} else if ckBits == 64 {
+		checksum = this.hasher64.Hash(block)
+	}
+
+	var blockHash []byte
+
+	if this.blockHash != nil {
+		blockHash = this.blockHash.sum(block)
+	}
+
+	if this.manifest != nil {
+		this.manifest.add(int(blockID), block)
+	}
+
+	dataSize := uint(1)
+
+	if length >= 256 {
+		dataSize = uint(internal.Log2NoCheck(uint32(length))>>3) + 1
+	}
+
+	// Mode: size of 'block size' - 1 in bytes and skip flags of the NONE transform
+	mode := byte(((dataSize-1)&0x03)<<5) | byte(0x7F>>4)
+	written := getStoredBlockBits(uint(length), ckBits+this.checksumFlagBits()+this.blockHash.bits())
+	lw := getBlockSizeBits(written)
+
+	if this.syncMarkers == true {
+		writeSyncMarker(this.obs)
+	}
+
+	this.obs.WriteBits(uint64(lw-3), 5) // write length-3 (5 bits max)
+	this.obs.WriteBits(written, lw)
+	this.obs.WriteBits(uint64(mode), 8)
+	this.obs.WriteBits(uint64(length), 8*dataSize)
+
+	if this.ckPolicy != nil {
+		this.obs.WriteBits(uint64(min(ckBits, 1)), 1)
+	}
+
+	if ckBits > 0 {
+		this.obs.WriteBits(checksum, ckBits)
+	}
+
+	if blockHash != nil {
+		this.obs.WriteArray(blockHash, uint(8*len(blockHash)))
+	}
+
+	profileStage(this.ctx, _STAGE_BITSTREAM_WRITE, "", length, func() {
+		for off := 0; off < length; {
+			ckSize := min(length-off, 1<<23)
+			this.obs.WriteArray(block[off:], uint(8*ckSize))
+			off += ckSize
+		}
+	})
+
+	this.processed += int64(length)
+	return nil
+}
+
+func (this *Writer) write(block []byte) (int, error) {
+	if this.chunker != nil {
+		return this.writeRsyncable(block)
+	}
+
 	off := 0
 	remaining := len(block)
 
@@ -415,24 +1271,17 @@ func (this *Writer) Write(block []byte) (int, error) {
 		if lenChunk > 0 {
 			// Process a chunk of in-buffer data. No access to bitstream required
 			bufID := this.available / this.blockSize
+			this.growInput(bufID, bufOff+lenChunk)
 			copy(this.buffers[bufID].Buf[bufOff:], block[off:off+lenChunk])
 			bufOff += lenChunk
 			off += lenChunk
 			remaining -= lenChunk
 			this.available += lenChunk
 
-			if bufOff >= this.blockSize {
-				if bufID+1 < this.jobs {
-					// Current write buffer is full
-					if len(this.buffers[bufID+1].Buf) == 0 {
-						bufSize := max(this.blockSize+this.blockSize>>6, 65536)
-						this.buffers[bufID+1].Buf = make([]byte, bufSize)
-					}
-				} else {
-					// If all buffers are full, time to encode
-					if err := this.processBlock(); err != nil {
-						return len(block) - remaining, err
-					}
+			// If all buffers are full, time to encode
+			if bufOff >= this.blockSize && bufID+1 == this.jobs {
+				if err := this.processBlock(false); err != nil {
+					return len(block) - remaining, err
 				}
 			}
 
@@ -448,32 +1297,117 @@ func (this *Writer) Write(block []byte) (int, error) {
 // Close writes the buffered data to the writer then writes
 // a final empty block and releases resources.
 // Close makes the bitstream unavailable for further writes. Idempotent.
+// The underlying stream is not closed: another Writer (possibly using different
+// compression parameters) can append a chained stream that a Reader created
+// with ctx["chained"]=true decodes transparently.
 func (this *Writer) Close() error {
-	if atomic.SwapInt32(&this.closed, 1) == 1 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if swapInt32(&this.closed, 1) == 1 {
 		return nil
 	}
 
-	if err := this.processBlock(); err != nil {
+	if this.flushTimer != nil {
+		this.flushTimer.Stop()
+		this.flushArmed = false
+	}
+
+	if this.flushErr != nil {
+		return this.flushErr
+	}
+
+	if err := this.processBlock(false); err != nil {
 		return err
 	}
 
 	// Write end block of size 0
+	if this.syncMarkers == true {
+		writeSyncMarker(this.obs)
+	}
+
 	this.obs.WriteBits(0, 5) // write length-3 (5 bits max)
 	this.obs.WriteBits(0, 3)
 
+	if this.stats != nil {
+		this.writeStatsTrailer()
+	}
+
+	if this.archive != nil {
+		if err := this.writeArchiveTrailer(); err != nil {
+			return err
+		}
+	}
+
+	if this.footer != nil {
+		this.writeFooter()
+	}
+
 	if err := this.obs.Close(); err != nil {
 		return err
 	}
 
 	// Release resources
 	for i := range this.buffers {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		this.buffers[i].release()
+	}
+
+	if this.volumes != nil {
+		return this.volumes.Close()
+	}
+
+	return nil
+}
+
+// Flush encodes the data buffered so far (possibly a partial block) and
+// pushes it to the underlying stream, so that a reader can decode all the
+// data written before the call. The last block emitted by Flush is padded
+// to end on a byte boundary (the padding bits are ignored by the decoder).
+// Frequent flushes yield smaller blocks and degrade the compression ratio.
+// A reader consuming a live stream should use 1 job to get the data as
+// soon as each block is available.
+// See also the 'flushInterval' option to flush automatically.
+func (this *Writer) Flush() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if loadInt32(&this.closed) == 1 {
+		return &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	return this.flush()
+}
+
+// autoFlush is called by the flush timer. An error is reported by the next
+// call to Write or Close.
+func (this *Writer) autoFlush() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.flushArmed = false
+
+	if loadInt32(&this.closed) == 1 || this.available == 0 || this.flushErr != nil {
+		return
+	}
+
+	this.flushErr = this.flush()
+}
+
+func (this *Writer) flush() error {
+	if err := this.processBlock(true); err != nil {
+		return err
+	}
+
+	// Custom bitstreams may not support flushing
+	if f, ok := this.obs.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+		}
 	}
 
 	return nil
 }
 
-func (this *Writer) processBlock() error {
+func (this *Writer) processBlock(byteAlign bool) error {
 	if err := this.writeHeader(); err != nil {
 		return err
 	}
@@ -488,26 +1422,22 @@ func (this *Writer) processBlock() error {
 	listeners := make([]kanzi.Listener, len(this.listeners))
 	copy(listeners, this.listeners)
 
-	nbTasks := this.jobs
-	var jobsPerTask []uint
-
 	// Assign optimal number of tasks and jobs per task (if the number of blocks is known)
-	if nbTasks > 1 {
-		// Limit the number of jobs if there are fewer blocks that this.jobs
-		// It allows more jobs per task and reduces memory usage.
-		if this.nbInputBlocks > 0 {
-			nbTasks = min(nbTasks, this.nbInputBlocks)
-		}
-
-		jobsPerTask, _ = internal.ComputeJobsPerTask(make([]uint, nbTasks), uint(this.jobs), uint(nbTasks))
-	} else {
-		jobsPerTask = []uint{uint(this.jobs)}
-	}
+	// Fewer blocks than jobs allow more jobs per task and reduce memory usage.
+	slots := this.encodingSlots()
+	plan := slots.plan.get(this.nbInputBlocks, this.jobs)
+	nbTasks := plan.Tasks
+	jobsPerTask := plan.JobsPerTask
 
 	tasks := 0
-	wg := sync.WaitGroup{}
-	results := make([]encodingTaskResult, nbTasks)
 	firstID := this.blockID
+	blockMax := 0
+	var next []byte
+	var repeats []int32
+
+	if this.dedup != nil {
+		repeats = this.dedup.match(this.batchBlocks(nbTasks), firstID)
+	}
 
 	// Invoke as many go routines as required
 	for taskID := 0; taskID < nbTasks; taskID++ {
@@ -517,53 +1447,144 @@ func (this *Writer) processBlock() error {
 			dataLength = this.blockSize
 		}
 
+		if this.chunker != nil {
+			dataLength = this.chunker.length(taskID)
+		}
+
 		if dataLength == 0 {
 			break
 		}
 
-		copyCtx := make(map[string]any)
+		slot := &slots.slots[taskID]
+		slot.ctx = taskContext(slot.ctx, this.ctx, &slot.scratch, jobsPerTask[taskID])
+		slot.scratch.Reset(uint(dataLength))
+		slot.scratch.Dictionary = nil
+
+		if this.shared != nil {
+			slot.scratch.Dictionary = this.shared.dictionary
+		}
+
+		if this.linked == true {
+			slot.scratch.Priming = this.window
 
-		for k, v := range this.ctx {
-			copyCtx[k] = v
+			// Keep the end of the block to prime the next one (single task)
+			start := max(dataLength-_LINKED_WINDOW_SIZE, 0)
+			next = append(slots.window[0:0], this.buffers[taskID].Buf[start:dataLength]...)
 		}
 
-		copyCtx["jobs"] = jobsPerTask[taskID]
-		wg.Add(1)
+		slots.wg.Add(1)
 		tasks++
 		off += dataLength
+		blockMax = max(blockMax, dataLength)
 		this.available -= dataLength
+		level, tType, eType := 0, this.transformType, this.entropyType
 
-		task := encodingTask{
+		if this.governor != nil {
+			level, tType, eType = this.governor.codecs()
+		}
+
+		slot.res = encodingTaskResult{}
+		slot.task = encodingTask{
 			iBuffer:            &this.buffers[taskID],
 			oBuffer:            &this.buffers[this.jobs+taskID],
 			hasher32:           this.hasher32,
 			hasher64:           this.hasher64,
+			blockHash:          this.blockHash,
 			blockLength:        uint(dataLength),
-			blockTransformType: this.transformType,
-			blockEntropyType:   this.entropyType,
+			smallBlock:         this.smallBlock,
+			blockTransformType: tType,
+			blockEntropyType:   eType,
 			currentBlockID:     firstID + int32(taskID) + 1,
 			processedBlockID:   &this.blockID,
-			wg:                 &wg,
+			wg:                 &slots.wg,
 			obs:                this.obs,
 			listeners:          listeners,
-			ctx:                copyCtx}
+			ctx:                slot.ctx,
+			bufferFloor:        this.bufferFloor,
+			bufferMargin:       this.bufferMargin,
+			byteAlign:          (byteAlign && this.available == 0) || this.archive != nil || this.volumes != nil || this.onBlock != nil || this.index != nil,
+			retryOnPanic:       this.retryOnPanic,
+			failures:           &this.failures,
+			manifest:           this.manifest,
+			archive:            this.archive,
+			stats:              this.stats,
+			aead:               this.aead,
+			header:             this.header,
+			processed:          &this.processed,
+			inputSize:          this.inputSize,
+			autoTune:           this.autoTune,
+			candidates:         this.candidates,
+			volumes:            this.volumes,
+			governor:           this.governor,
+			governorLevel:      level,
+			onBlock:            this.onBlock,
+			index:              this.index,
+			streamOffset:       this.streamOffset,
+			ckPolicy:           this.ckPolicy,
+			stageParams:        this.stageParams,
+			stageType:          this.transformType,
+			syncMarkers:        this.syncMarkers,
+			scratch:            &slot.scratch,
+			local:              &slot.local}
+
+		if repeats != nil {
+			slot.task.repeatOf = repeats[taskID]
+		}
 
 		// Invoke the tasks concurrently
-		go task.encode(&results[taskID])
+		startSlotTask(this.numa, taskID, slot.run)
 	}
 
 	// Wait for completion of all tasks
-	wg.Wait()
+	slots.wg.Wait()
 
-	for _, r := range results {
-		if r.err != nil {
-			return r.err
+	for i := range slots.slots[0:tasks] {
+		if err := slots.slots[i].res.err; err != nil {
+			return err
 		}
 	}
 
+	if next != nil {
+		// The previous window is not used anymore: spare buffer of the next batch
+		slots.window, this.window = this.window, next
+	}
+
+	if this.chunker != nil {
+		this.chunker.reset()
+	}
+
+	if this.available == 0 {
+		this.shrinkBuffers(blockMax)
+	}
+
 	return nil
 }
 
+// Manifest returns the digests of the blocks written (see Manifest).
+// Available after Close if the writer was created with ctx["manifest"] = true.
+func (this *Writer) Manifest() (*Manifest, error) {
+	if this.manifest == nil {
+		return nil, &IOError{msg: "No manifest requested", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if loadInt32(&this.closed) == 0 {
+		return nil, &IOError{msg: "The manifest is only available once the stream is closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	return this.manifest.build(), nil
+}
+
+// TransformFailures returns diagnostic information about the blocks for
+// which the forward transform panicked and that have been emitted
+// untransformed (see ctx["retryOnPanic"]).
+func (this *Writer) TransformFailures() []TransformFailure {
+	this.failures.lock.Lock()
+	defer this.failures.lock.Unlock()
+	res := make([]TransformFailure, len(this.failures.entries))
+	copy(res, this.failures.entries)
+	return res
+}
+
 // GetWritten returns the number of bytes written so far
 func (this *Writer) GetWritten() uint64 {
 	return (this.obs.Written() + 7) >> 3
@@ -586,13 +1607,14 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	buffer := this.oBuffer.Buf
 	mode := byte(0)
 	checksum := uint64(0)
+	governed := false // codecs selected by the speed governor
 
 	defer func() {
 		if r := recover(); r != nil {
 			err, ok := r.(error)
 
 			if ok {
-				res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+				res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
 			} else {
 				res.err = &IOError{msg: "Unknown error", code: kanzi.ERR_PROCESS_BLOCK}
 			}
@@ -600,9 +1622,9 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 
 		// Unblock other tasks
 		if res.err != nil {
-			atomic.StoreInt32(this.processedBlockID, _CANCEL_TASKS_ID)
-		} else if atomic.LoadInt32(this.processedBlockID) == this.currentBlockID-1 {
-			atomic.StoreInt32(this.processedBlockID, this.currentBlockID)
+			storeInt32(this.processedBlockID, _CANCEL_TASKS_ID)
+		} else if loadInt32(this.processedBlockID) == this.currentBlockID-1 {
+			storeInt32(this.processedBlockID, this.currentBlockID)
 		}
 
 		this.wg.Done()
@@ -610,13 +1632,20 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 
 	hashType := kanzi.EVT_HASH_NONE
 
-	// Compute block checksum
-	if this.hasher32 != nil {
-		checksum = uint64(this.hasher32.Hash(data[0:this.blockLength]))
-		hashType = kanzi.EVT_HASH_32BITS
-	} else if this.hasher64 != nil {
-		checksum = this.hasher64.Hash(data[0:this.blockLength])
-		hashType = kanzi.EVT_HASH_64BITS
+	// Compute block checksum (with a checksum policy, once the block is
+	// classified, see ChecksumPolicy.go)
+	if this.ckPolicy == nil || this.repeatOf != 0 {
+		checksum, hashType = this.blockChecksum(data[0:this.blockLength])
+	}
+
+	var blockHash []byte
+
+	if this.blockHash != nil {
+		blockHash = this.blockHash.sum(data[0:this.blockLength])
+	}
+
+	if this.manifest != nil {
+		this.manifest.add(int(this.currentBlockID), data[0:this.blockLength])
 	}
 
 	if len(this.listeners) > 0 {
@@ -626,41 +1655,85 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 		notifyListeners(this.listeners, evt)
 	}
 
-	if this.blockLength <= _SMALL_BLOCK_SIZE {
+	if this.repeatOf != 0 {
+		// Identical to an earlier block (see Dedup.go)
+		record, written := this.repeatRecord(checksum)
+
+		if this.stats != nil {
+			this.recordStats(nil, 0xFF, 0, written, written, true)
+		}
+
+		this.emit(record, written, 0xFF, checksum, hashType)
+		return
+	}
+
+	if this.blockLength <= this.smallBlock {
 		this.blockTransformType = transform.NONE_TYPE
 		this.blockEntropyType = entropy.NONE_TYPE
 		mode |= byte(_COPY_BLOCK_MASK)
 	} else {
 		if skipOpt, hasKey := this.ctx["skipBlocks"]; hasKey == true {
 			if skipOpt.(bool) == true {
-				skip := false
-
-				if this.blockLength >= 8 {
-					skip = internal.IsDataCompressed(internal.GetMagicType(data))
-				}
+				// Sampled analysis (see SkipDetector.go), level checked by the Writer
+				level, _ := getAnalysisLevel(this.ctx)
 
-				if skip == false {
-					histo := [256]int{}
-					internal.ComputeHistogram(data[0:this.blockLength], histo[:], true, false)
-					entropy1024 := internal.ComputeFirstOrderEntropy1024(int(this.blockLength), histo[:])
-					skip = entropy1024 >= entropy.INCOMPRESSIBLE_THRESHOLD
-					//this.ctx["histo0"] = histo
-				}
-
-				if skip == true {
+				if isBlockIncompressible(data[0:this.blockLength], level) == true {
 					this.blockTransformType = transform.NONE_TYPE
 					this.blockEntropyType = entropy.NONE_TYPE
 					mode |= _COPY_BLOCK_MASK
 				}
 			}
 		}
+
+		if this.blockLength <= _SMALL_BLOCK_PROBE_SIZE && mode&_COPY_BLOCK_MASK == 0 &&
+			isSmallBlockIncompressible(data[0:this.blockLength], this.scratch) == true {
+			this.blockTransformType = transform.NONE_TYPE
+			this.blockEntropyType = entropy.NONE_TYPE
+			mode |= _COPY_BLOCK_MASK
+		}
+
+		if this.autoTune == true && mode&_COPY_BLOCK_MASK == 0 {
+			this.blockTransformType, this.blockEntropyType = selectCodecs(data[0:this.blockLength],
+				this.ctx, this.blockTransformType, this.blockEntropyType, this.candidates)
+
+			if this.blockTransformType == transform.NONE_TYPE && this.blockEntropyType == entropy.NONE_TYPE {
+				mode |= _COPY_BLOCK_MASK
+			}
+		}
+
+		if this.governor != nil && mode&_COPY_BLOCK_MASK == 0 {
+			governed = true
+
+			if this.blockTransformType == transform.NONE_TYPE && this.blockEntropyType == entropy.NONE_TYPE {
+				mode |= _COPY_BLOCK_MASK
+			}
+		}
 	}
 
-	this.ctx["size"] = this.blockLength
-	t, err := transform.New(&this.ctx, this.blockTransformType)
+	checksummed := hashType != kanzi.EVT_HASH_NONE
+
+	if this.ckPolicy != nil {
+		copied := mode&_COPY_BLOCK_MASK != 0 ||
+			(this.blockTransformType == transform.NONE_TYPE && this.blockEntropyType == entropy.NONE_TYPE)
+
+		if checksummed = this.hasChecksum(data[0:this.blockLength], copied); checksummed == true {
+			checksum, hashType = this.blockChecksum(data[0:this.blockLength])
+		}
+	}
+
+	start := time.Now()
+	this.scratch.Size = this.blockLength
+	stageParams := uint64(0)
+
+	// The parameters only apply to the transforms of the sequence
+	if this.blockTransformType == this.stageType {
+		stageParams = this.stageParams
+	}
+
+	t, err := transform.NewWithParams(&this.ctx, this.blockTransformType, stageParams)
 
 	if err != nil {
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC}
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
 		return
 	}
 
@@ -668,27 +1741,58 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	magic := internal.GetMagicType(data)
 
 	if internal.IsDataCompressed(magic) == true {
-		this.ctx["dataType"] = internal.DT_BIN
+		this.scratch.DataType = internal.DT_BIN
 	} else if internal.IsDataMultimedia(magic) == true {
-		this.ctx["dataType"] = internal.DT_MULTIMEDIA
+		this.scratch.DataType = internal.DT_MULTIMEDIA
 	} else if internal.IsDataExecutable(magic) == true {
-		this.ctx["dataType"] = internal.DT_EXE
+		this.scratch.DataType = internal.DT_EXE
 	}
 
-	if len(this.iBuffer.Buf) < requiredSize {
-		extraBuf := make([]byte, requiredSize-len(this.iBuffer.Buf))
-		data = append(data, extraBuf...)
-		this.iBuffer.Buf = data
+	// The transforms do not need a larger input buffer: a buffer of the
+	// caller is not copied (see ZeroCopy.go)
+	if len(this.iBuffer.Buf) < requiredSize && this.iBuffer.owned == false {
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "input", len(this.iBuffer.Buf), requiredSize, "requiredSize")
+		data = this.iBuffer.grow(requiredSize, true)
+	}
+
+	entropyOnly := isEntropyOnly(this.blockTransformType)
+
+	if len(this.oBuffer.Buf) < requiredSize && entropyOnly == false {
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "output", len(this.oBuffer.Buf), requiredSize, "requiredSize")
+		buffer = this.oBuffer.grow(requiredSize, false)
 	}
 
-	if len(this.oBuffer.Buf) < requiredSize {
-		buffer = make([]byte, requiredSize)
-		this.oBuffer.Buf = buffer
+	// Neither the transforms nor the entropy coder write to the input: it
+	// is used for the retry and for the blocks stored if expanded
+	original := data[0:this.blockLength]
+	var saved []byte
+
+	if this.retryOnPanic == true {
+		saved = original
 	}
 
 	// Forward transform (ignore error, encode skipFlags)
-	_, postTransformLength, _ := t.Forward(data[0:this.blockLength], buffer)
-	this.ctx["size"] = postTransformLength
+	tName, _ := transform.GetName(this.blockTransformType)
+	eName, _ := entropy.GetName(this.blockEntropyType)
+	var postTransformLength uint
+
+	if entropyOnly == true {
+		t.SetSkipFlags(_ENTROPY_ONLY_SKIP_FLAGS)
+		postTransformLength = this.blockLength
+		buffer = data
+	} else {
+		// The output buffer is the work buffer of the transforms and the
+		// transform output goes to a pooled buffer read by the entropy coder
+		work := buffer
+		buffer = internal.DefaultBufferPool.GetBytes(requiredSize)
+		defer internal.DefaultBufferPool.PutBytes(buffer)
+
+		profileStage(this.ctx, _STAGE_TRANSFORM_FORWARD, tName, int(this.blockLength), func() {
+			postTransformLength = this.forward(t, data[0:this.blockLength], buffer, work, saved)
+		})
+	}
+
+	this.scratch.Size = postTransformLength
 	dataSize := uint(1)
 
 	if postTransformLength >= 256 {
@@ -710,25 +1814,19 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 		notifyListeners(this.listeners, evt)
 	}
 
-	bufSize := postTransformLength
+	bufSize := computeOutputBufferSize(this.blockLength, postTransformLength, this.bufferFloor, this.bufferMargin)
 
-	if bufSize < this.blockLength+(this.blockLength>>3) {
-		bufSize = this.blockLength + (this.blockLength >> 3)
+	// The entropy coder writes to the output buffer
+	if len(this.oBuffer.Buf) < int(bufSize) {
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "entropy", len(this.oBuffer.Buf), int(bufSize), "postTransformLength")
+		this.oBuffer.grow(int(bufSize), false)
 	}
 
-	if bufSize < 512*1024 {
-		bufSize = 512 * 1024
-	}
-
-	if len(data) < int(bufSize) {
-		// Rare case where the transform expanded the input or the entropy
-		// coder may expand the size
-		data = make([]byte, bufSize)
-	}
+	data = this.oBuffer.Buf
 
 	// Create a bitstream local to the task
-	bufStream := internal.NewBufferStream(data[0:0:cap(data)])
-	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
+	initialCap := cap(data)
+	bufStream, obs := this.local.output(data[0:0:cap(data)])
 	skipFlags := t.SkipFlags()
 
 	// Write block 'header' (mode + compressed length)
@@ -741,13 +1839,22 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 		obs.WriteBits(uint64(t.SkipFlags()), 8)
 	}
 
+	if (this.autoTune == true || this.governor != nil) && mode&_COPY_BLOCK_MASK == 0 {
+		obs.WriteBits(this.blockTransformType, 48)
+		obs.WriteBits(uint64(this.blockEntropyType), _AUTO_TUNE_BLOCK_BITS-48)
+	}
+
+	if this.stageParams != 0 && mode&_COPY_BLOCK_MASK == 0 {
+		writeStageParams(obs, stageParams)
+	}
+
 	obs.WriteBits(uint64(postTransformLength), 8*dataSize)
 
 	// Write checksum
-	if this.hasher32 != nil {
-		obs.WriteBits(checksum, 32)
-	} else if this.hasher64 != nil {
-		obs.WriteBits(checksum, 64)
+	this.writeChecksum(obs, checksum, checksummed)
+
+	if blockHash != nil {
+		obs.WriteArray(blockHash, uint(8*len(blockHash)))
 	}
 
 	if len(this.listeners) > 0 {
@@ -762,24 +1869,66 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	ee, err := entropy.NewEntropyEncoder(obs, this.ctx, this.blockEntropyType)
 
 	if err != nil {
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC}
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC, cause: err}
 		return
 	}
 
 	// Entropy encode block
-	if _, err = ee.Write(buffer[0:postTransformLength]); err != nil {
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+	profileStage(this.ctx, _STAGE_ENTROPY_ENCODE, eName, int(postTransformLength), func() {
+		if _, err = ee.Write(buffer[0:postTransformLength]); err == nil {
+			// Dispose before displaying statistics. Dispose may write to the bitstream
+			ee.Dispose()
+		}
+	})
+
+	if err != nil {
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
 		return
 	}
 
-	// Dispose before displaying statistics. Dispose may write to the bitstream
-	ee.Dispose()
 	obs.Close()
 	written := obs.Written()
 
+	if governed == true {
+		this.governor.update(this.governorLevel, this.blockLength, time.Since(start))
+	}
+
+	// The buffer stream may have been re-allocated if the initial size was
+	// too small (small floor and expanding entropy coder)
+	data = bufStream.Bytes()
+
+	if cap(data) > initialCap {
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "entropy", initialCap, cap(data), "entropyOutput")
+	}
+
+	encoded := written
+	stored := mode&_COPY_BLOCK_MASK != 0
+
+	// Store the blocks expanded by the codecs (see Bound.go)
+	if stored == false && written > this.storedBlockBits(checksummed) {
+		data, written = this.storeExpandedBlock(original, data, checksum, checksummed, blockHash)
+
+		skipFlags = 0xFF
+		stored = true
+	}
+
+	if this.aead != nil {
+		data = this.encrypt(data[0 : (written+7)>>3])
+		written = uint64(len(data)) << 3
+	}
+
+	if this.stats != nil {
+		this.recordStats(t, skipFlags, postTransformLength, encoded, written, stored)
+	}
+
+	this.emit(data, written, skipFlags, checksum, hashType)
+}
+
+// emit writes the block data to the shared bitstream, in block order
+func (this *encodingTask) emit(data []byte, written uint64, skipFlags byte, checksum uint64, hashType int) {
 	// Lock free synchronization
 	for n := 0; ; n++ {
-		taskID := atomic.LoadInt32(this.processedBlockID)
+		taskID := loadInt32(this.processedBlockID)
 
 		if taskID == _CANCEL_TASKS_ID {
 			return
@@ -806,30 +1955,87 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 			if v.(uint) > 4 {
 				msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"offset\":%d, \"skipFlags\":%.8b }",
 					"BLOCK_INFO", int(this.currentBlockID), blockOffset, skipFlags)
-				evt1 := kanzi.NewEventFromString(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, time.Now())
+				fields := []kanzi.Field{{Key: "offset", Value: blockOffset}, {Key: "skipFlags", Value: skipFlags}}
+				evt1 := kanzi.NewEventWithFields(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, fields, time.Now())
 				notifyListeners(this.listeners, evt1)
 			}
 		}
 	}
 
+	if this.syncMarkers == true {
+		// The block records of the archive and index follow the marker
+		writeSyncMarker(this.obs)
+	}
+
 	// Emit block size in bits (max size pre-entropy is 1 GB = 1 << 30 bytes)
-	lw := uint(3)
+	lw := getBlockSizeBits(written)
+
+	if this.byteAlign == true {
+		// Pad the block data so that the block ends on a byte boundary
+		// in the shared bitstream. The decoder ignores the trailing bits.
+		pos := this.obs.Written() + 5
 
-	if written >= 8 {
-		lw = uint(internal.Log2NoCheck(uint32(written>>3)) + 4)
+		for (pos+uint64(lw)+written)&7 != 0 {
+			written++
+			lw = getBlockSizeBits(written)
+		}
+
+		if n := int((written + 7) >> 3); len(data) < n {
+			data = append(data, make([]byte, n-len(data))...)
+		}
 	}
 
-	this.obs.WriteBits(uint64(lw-3), 5) // write length-3 (5 bits max)
-	this.obs.WriteBits(written, lw)
+	if this.archive != nil {
+		// Keep a copy of the (byte aligned) block record for the archive
+		// index and parity
+		recStream := internal.NewBufferStream(make([]byte, 0, ((written+uint64(lw)+12)>>3)+8))
+		recObs, _ := bitstream.NewDefaultOutputBitStream(recStream, 16384)
+		writeBlockData(recObs, lw, written, data)
+		recObs.Close()
+		this.archive.add(this.obs.Written()>>3, recStream.Bytes(), int(this.blockLength))
+	}
+
+	if this.volumes != nil {
+		// The block ends on a byte boundary (5 bits for lw, lw bits for written)
+		this.volumes.addBlockEnd((this.obs.Written() + 5 + uint64(lw) + written) >> 3)
+	}
+
+	if this.index != nil {
+		this.index.add(this.obs.Written()>>3, uint32((5+uint64(lw)+written)>>3), int(this.blockLength))
+	}
+
+	if this.onBlock != nil {
+		this.onBlock(BlockBoundary{BlockID: int(this.currentBlockID), UncompressedOffset: *this.processed,
+			UncompressedSize: int(this.blockLength), CompressedOffset: this.streamOffset + this.obs.Written()>>3})
+	}
+
+	// Emit data to shared bitstream
+	profileStage(this.ctx, _STAGE_BITSTREAM_WRITE, "", int((written+7)>>3), func() {
+		writeBlockData(this.obs, lw, written, data)
+	})
+
+	*this.processed += int64(this.blockLength)
+
+	if len(this.listeners) > 0 {
+		progress := kanzi.Progress{InputBytes: *this.processed, OutputBytes: int64((this.obs.Written() + 7) >> 3),
+			TotalBytes: this.inputSize}
+		evt := kanzi.NewProgressEvent(kanzi.EVT_COMPRESSION_PROGRESS, int(this.currentBlockID), progress, time.Now())
+		notifyListeners(this.listeners, evt)
+	}
+}
+
+// writeBlockData writes the block length in bits followed by the block data
+func writeBlockData(obs kanzi.OutputBitStream, lw uint, written uint64, data []byte) {
+	obs.WriteBits(uint64(lw-3), 5) // write length-3 (5 bits max)
+	obs.WriteBits(written, lw)
 	chkSize := uint(1 << 30)
 
 	if written < 1<<30 {
 		chkSize = uint(written)
 	}
 
-	// Emit data to shared bitstream
 	for n := uint(0); written > 0; {
-		this.obs.WriteArray(data[n:], chkSize)
+		obs.WriteArray(data[n:], chkSize)
 		n += (chkSize + 7) >> 3
 		written -= uint64(chkSize)
 		chkSize = uint(1 << 30)
@@ -840,6 +2046,141 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	}
 }
 
+// forward applies the forward transform to the block without writing to
+// the input (work holds the intermediate data). If the transform panics and
+// the input is saved (retry on panic), it is copied to the output, all
+// transforms are marked as skipped and the failure is recorded. Otherwise
+// the panic is propagated. Panics in the worker goroutines of the
+// transforms (EG. concurrent BWT, DivSufSort) are covered: the workers raise
+// them again on this goroutine (see internal.WorkerPanic).
+func (this *encodingTask) forward(t *transform.ByteTransformSequence, src, dst, work, saved []byte) (length uint) {
+	defer func() {
+		r := recover()
+
+		if r == nil {
+			return
+		}
+
+		if saved == nil {
+			panic(r)
+		}
+
+		failure := TransformFailure{
+			BlockID:   int(this.currentBlockID),
+			BlockSize: len(saved),
+			Error:     fmt.Sprint(r),
+			Stack:     string(debug.Stack()),
+		}
+
+		if wp, ok := r.(*internal.WorkerPanic); ok == true {
+			failure.Stack = string(wp.Stack)
+		}
+
+		failure.Transform, _ = transform.GetName(this.blockTransformType)
+
+		if hasher, err := hash.NewXXHash64(_BITSTREAM_TYPE); err == nil {
+			failure.InputHash = hasher.Hash(saved)
+		}
+
+		this.failures.lock.Lock()
+		this.failures.entries = append(this.failures.entries, failure)
+		this.failures.lock.Unlock()
+
+		if len(this.listeners) > 0 {
+			msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"transform\":\"%s\", \"size\":%d, \"hash\":\"%x\", \"error\":%q }",
+				"TRANSFORM_FAILURE", failure.BlockID, failure.Transform, failure.BlockSize, failure.InputHash, failure.Error)
+			fields := []kanzi.Field{{Key: "transform", Value: failure.Transform}, {Key: "size", Value: failure.BlockSize},
+				{Key: "hash", Value: failure.InputHash}, {Key: "error", Value: failure.Error}}
+			evt := kanzi.NewEventWithFields(kanzi.EVT_TRANSFORM_FAILURE, failure.BlockID, msg, fields, time.Now())
+			notifyListeners(this.listeners, evt)
+		}
+
+		// Emit the block untransformed
+		copy(dst, saved)
+		t.SetSkipFlags(0xFF)
+		length = uint(len(saved))
+	}()
+
+	_, length, _ = t.ForwardKeepInput(src, dst, work)
+	return length
+}
+
+// isSmallBlockIncompressible returns true if the order 0 entropy coded size
+// of the block, including about one byte of code table per symbol used,
+// shows no significant gain over the copied block. Cheap probe for the
+// small blocks, where the code table is not negligible. The histogram is
+// kept in the scratch of the block (if not nil) for the transforms.
+func isSmallBlockIncompressible(block []byte, scratch *internal.BlockScratch) bool {
+	histo := [256]int{}
+	scratch.Histogram(block, histo[:])
+	symbols := 0
+
+	for _, f := range histo {
+		if f != 0 {
+			symbols++
+		}
+	}
+
+	estimate := internal.ComputeFirstOrderEntropy1024(len(block), histo[:])*len(block) + 1024*symbols
+	return estimate >= entropy.INCOMPRESSIBLE_THRESHOLD*len(block)
+}
+
+// isMostlyIncompressible returns true if at least half of the chunks of the
+// regions of a block have a high order 0 entropy (EG. the compressed pages
+// of a Parquet file)
+func isMostlyIncompressible(regions [][]byte) bool {
+	chunks, skipped := 0, 0
+
+	for _, block := range regions {
+		for off := 0; off < len(block); off += _CONTAINER_CHUNK_SIZE {
+			chunk := block[off:min(off+_CONTAINER_CHUNK_SIZE, len(block))]
+			histo := [256]int{}
+			internal.ComputeHistogram(chunk, histo[:], true, false)
+			chunks++
+
+			if internal.ComputeFirstOrderEntropy1024(len(chunk), histo[:]) >= entropy.INCOMPRESSIBLE_THRESHOLD {
+				skipped++
+			}
+		}
+	}
+
+	return 2*skipped >= chunks
+}
+
+// getBlockSizeBits returns the number of bits used to emit the size (in bits)
+// of a block
+func getBlockSizeBits(written uint64) uint {
+	if written < 8 {
+		return 3
+	}
+
+	return uint(internal.Log2NoCheck(uint32(written>>3)) + 4)
+}
+
+// computeOutputBufferSize returns the size of the buffer used to entropy
+// code a block: the post transform size or the block size plus a margin
+// (blockLength >> margin), whichever is larger, but no less than floor.
+// The buffer can still grow if the entropy coder expands the data further.
+func computeOutputBufferSize(blockLength, postTransformLength, floor, margin uint) uint {
+	bufSize := max(postTransformLength, blockLength+(blockLength>>margin))
+	return max(bufSize, floor)
+}
+
+// notifyBufferRealloc emits an event when a task grows a block buffer
+// beyond its initial allocation (the first allocation is not reported).
+func notifyBufferRealloc(listeners []kanzi.Listener, blockID int32, buffer string, oldSize, newSize int, reason string) {
+	if len(listeners) == 0 || oldSize == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"buffer\":\"%s\", \"oldSize\":%d, \"newSize\":%d, \"reason\":\"%s\" }",
+		"BUFFER_REALLOC", blockID, buffer, oldSize, newSize, reason)
+	fields := []kanzi.Field{{Key: "buffer", Value: buffer}, {Key: "oldSize", Value: oldSize},
+		{Key: "newSize", Value: newSize}, {Key: "reason", Value: reason}}
+	evt := kanzi.NewEventWithFields(kanzi.EVT_BUFFER_REALLOC, int(blockID), msg, fields, time.Now())
+	notifyListeners(listeners, evt)
+}
+
 func notifyListeners(listeners []kanzi.Listener, evt *kanzi.Event) {
 	defer func() {
 		// nolint:staticcheck
@@ -849,8 +2190,20 @@ func notifyListeners(listeners []kanzi.Listener, evt *kanzi.Event) {
 		}
 	}()
 
+	var evt2 *kanzi.EventV2
+
 	for _, bl := range listeners {
-		bl.ProcessEvent(evt)
+		// Structured listeners receive the typed fields of the event
+		if bl2, ok := bl.(kanzi.ListenerV2); ok == true {
+			if evt2 == nil {
+				v2 := evt.V2()
+				evt2 = &v2
+			}
+
+			bl2.ProcessEventV2(*evt2)
+		} else {
+			bl.ProcessEvent(evt)
+		}
 	}
 }
 
@@ -860,33 +2213,113 @@ type decodingTaskResult struct {
 	decoded        int
 	blockID        int
 	skipped        bool
+	endOfStream    bool
 	checksum       uint64
+	offset         uint64 // position of the block in the input (in bits)
+	end            uint64 // position of the end of the block in the input (in bits)
+	recoverable    bool   // error limited to the block (best effort mode)
+	repeatOf       int32  // ID of the identical earlier block (dedup), 0 if none
+	resyncStart    uint64 // region of the input skipped before the block (bits, see Resync.go)
+	resyncEnd      uint64
 	completionTime time.Time
+	info           BlockInfo
+}
+
+// SegmentInfo describes one of the streams (segments) chained in the input.
+// Each segment has its own header and compression parameters.
+type SegmentInfo struct {
+	Index            int    // index of the segment in the input
+	Offset           uint64 // offset of the segment in the compressed input (bytes)
+	DecodedOffset    int64  // offset of the segment in the decompressed output (bytes)
+	BitstreamVersion uint
+	BlockSize        uint
+	Transform        string
+	Entropy          string
+	Checksum         uint   // block checksum size in bits (0, 32 or 64)
+	Cipher           string // NONE if the blocks are not encrypted
+	AutoTune         bool   // codecs selected for each block (see BlockInfo)
+	Rsyncable        bool   // blocks end at content defined cut points
+	BlockHash        string // strong hash of each block: NONE, XXH3 or BLAKE3 (see BlockInfo)
+	Dedup            bool   // identical blocks emitted as repeat records (see Dedup.go)
+	Dictionary       uint32 // ID of the shared dictionary (see Shared.go), 0 if none
+	Compact          bool   // single block with a compact header (see Compact.go)
+	SyncMarkers      bool   // a sync marker precedes each block (see Resync.go)
+	EntropyLanes     bool   // the ANS blocks are split in lanes (see entropy/ANSLanes.go)
+	OriginalSize     int64  // 0 if not provided (set once decoded for compact streams)
+	BlockCount       int    // -1 if unknown (set once the end block is read)
 }
 
 // Reader a Reader that reads compressed data
 // from an InputBitStream.
 type Reader struct {
-	blockSize       int
-	hasher32        *hash.XXHash32
-	hasher64        *hash.XXHash64
-	buffers         []blockBuffer
-	entropyType     uint32
-	transformType   uint64
-	outputSize      int64
-	ibs             kanzi.InputBitStream
-	initialized     int32
-	closed          int32
-	blockID         int32
-	jobs            int
-	bufferThreshold int
-	available       int // decoded not consumed bytes
-	consumed        int // decoded consumed bytes
-	nbInputBlocks   int
-	listeners       []kanzi.Listener
-	ctx             map[string]any
-	parentCtx       *map[string]any
-	headless        bool
+	blockSize     int
+	hasher32      *hash.XXHash32
+	hasher64      *hash.XXHash64
+	buffers       []blockBuffer
+	entropyType   uint32
+	transformType uint64
+	outputSize    int64
+	ibs           kanzi.InputBitStream
+	initialized   int32
+	closed        int32
+	blockID       int32
+	jobs          int
+	bufferLengths []int // decoded bytes per buffer
+	bufferID      int   // index of buffer being consumed
+	available     int   // decoded not consumed bytes
+	consumed      int   // decoded consumed bytes in current buffer
+	nbInputBlocks int
+	listeners     []kanzi.Listener
+	ctx           map[string]any
+	parentCtx     *map[string]any
+	headless      bool
+	chained       bool
+	segmentEnd    bool  // end block of the current segment reached
+	decodedBytes  int64 // total decoded bytes (all segments)
+	segments      []SegmentInfo
+	substitutions *substitutionStats
+	manifest      *manifestChecker
+	archive       *archiveChecker // set in archival mode
+	footer        *footerDigest   // original data of the current segment
+	streamFooter  *streamFooter   // footer of the current segment (if read)
+	streamStats   *StreamStats    // statistics trailer of the current segment (if read)
+	blockHash     *blockHasher    // set if each block carries a strong hash (see BlockHash.go)
+	dedup         *dedupWindow    // decoded blocks that can be repeated (see Dedup.go)
+	dictionary    uint32          // ID of the shared dictionary of the segment, 0 if none (see Shared.go)
+	sharedDict    []byte          // data of the shared dictionary of the segment, nil if none
+	source        io.ReadCloser   // underlying stream (if known)
+	seek          *seekTable      // random access to the source (see SeekTable.go)
+	blockRange    *blockRange     // blocks selected for decoding, nil if all (see BlockRange.go)
+	aead          cipher.AEAD     // set if the blocks of the current segment are encrypted
+	cipherType    uint
+	header        []byte // header of the current segment (encrypted blocks)
+	linked        bool   // each block is primed with the end of the previous one
+	window        []byte // end of the previous block (linked blocks)
+	autoTune      bool   // codecs of each block stored in the block header
+	rsyncable     bool   // blocks end at content defined cut points (see Rsyncable.go)
+	maxMemory     int64  // memory budget (0 if none)
+	maxOutput     int64  // limit of the decoded size (0 if none, see OutputLimit.go)
+	maxJobs       int    // number of jobs requested
+	strict        bool   // errors (and panics) reported as DecodingErrors
+	bestEffort    bool   // corrupted blocks skipped (see BestEffort.go)
+	onCorrupted   func(CorruptedBlock)
+	damaged       int            // blocks skipped in the current segment
+	blockCount    int            // number of blocks in the current segment (-1 if unknown)
+	blockInfos    []BlockInfo    // decoded blocks (if recorded)
+	options       map[string]any // parameters of the stream (see Reset.go)
+	numa          []*numaNode    // nodes of the job slots, nil if not NUMA aware (see Numa.go)
+	slots         *decodingSlots // state of the tasks reused by the batches (see TaskSlots.go)
+	checksumFlags bool           // each block carries a checksum flag (see ChecksumPolicy.go)
+	checksumSeed  uint32         // seed of the block checksums stored in the header
+	customSeed    bool
+	stageParams   bool // each transformed block carries the stage parameters (see StageParams.go)
+	syncMarkers   bool // a sync marker precedes each block (see Resync.go)
+	entropyLanes  bool // the ANS blocks are split in lanes (see entropy/ANSLanes.go)
+}
+
+type substitutionStats struct {
+	lock   sync.Mutex
+	blocks map[string]int
 }
 
 type decodingTask struct {
@@ -894,6 +2327,7 @@ type decodingTask struct {
 	oBuffer            *blockBuffer
 	hasher32           *hash.XXHash32
 	hasher64           *hash.XXHash64
+	blockHash          *blockHasher
 	blockLength        uint
 	blockTransformType uint64
 	blockEntropyType   uint32
@@ -903,6 +2337,20 @@ type decodingTask struct {
 	listeners          []kanzi.Listener
 	ibs                kanzi.InputBitStream
 	ctx                map[string]any
+	substitutions      *substitutionStats
+	manifest           *manifestChecker
+	strict             bool
+	bestEffort         bool
+	aead               cipher.AEAD
+	header             []byte
+	autoTune           bool
+	dedup              bool
+	checksumFlags      bool
+	stageParams        bool
+	syncMarkers        bool
+	maxOutput          int64
+	scratch            *internal.BlockScratch
+	local              *taskLocal // reused bitstream of the job slot (nil if none)
 }
 
 // NewReader creates a new instance of Reader.
@@ -935,6 +2383,7 @@ func NewHeaderlessReader(is io.ReadCloser, jobs uint, transform, entropy string,
 // NewReaderWithCtx creates a new instance of Reader using a map of parameters.
 // The reader reads compressed data blocks from the provided is
 // using a default input bitstream.
+// The values of the map are not type checked: prefer NewReaderWithOptions.
 func NewReaderWithCtx(is io.ReadCloser, ctx map[string]any) (*Reader, error) {
 	var err error
 	var ibs kanzi.InputBitStream
@@ -944,7 +2393,14 @@ func NewReaderWithCtx(is io.ReadCloser, ctx map[string]any) (*Reader, error) {
 		return nil, &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
 	}
 
-	return createReaderWithCtx(ibs, ctx)
+	res, err := createReaderWithCtx(ibs, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.source = is
+	return res, nil
 }
 
 // NewReaderWithCtx2 creates a new instance of Reader.
@@ -955,54 +2411,203 @@ func NewReaderWithCtx2(ibs kanzi.InputBitStream, ctx map[string]any) (*Reader, e
 }
 
 func createReaderWithCtx(ibs kanzi.InputBitStream, ctx map[string]any) (*Reader, error) {
+	this := &Reader{}
+
+	if err := this.init(ibs, ctx); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+// init validates the parameters and initializes a new or reset Reader
+func (this *Reader) init(ibs kanzi.InputBitStream, ctx map[string]any) error {
 	if ibs == nil {
-		return nil, &IOError{msg: "Invalid null input bitstream parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+		return &IOError{msg: "Invalid null input bitstream parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
 	}
 
 	if ctx == nil {
-		return nil, &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+		return &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
 	}
 
 	tasks := ctx["jobs"].(uint)
 
 	if tasks == 0 || tasks > _MAX_CONCURRENCY {
 		errMsg := fmt.Sprintf("The number of jobs must be in [1..%d], got %d", _MAX_CONCURRENCY, tasks)
-		return nil, &IOError{msg: errMsg, code: kanzi.ERR_CREATE_DECOMPRESSOR}
+		return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	if _SINGLE_THREAD == true {
+		// No concurrent tasks in single thread builds
+		tasks = 1
 	}
 
-	this := &Reader{}
 	this.ibs = ibs
 	this.jobs = int(tasks)
+	this.maxJobs = this.jobs
 	this.blockID = 0
 	this.consumed = 0
 	this.available = 0
 	this.outputSize = 0
 	this.nbInputBlocks = 0
-	this.bufferThreshold = 0
-	this.buffers = make([]blockBuffer, 2*this.jobs)
+	this.blockCount = -1
+	this.bufferID = 0
+	this.bufferLengths = make([]int, this.jobs)
 
-	for i := range this.buffers {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+	// The buffers of a reset Reader are reused (see Reset.go)
+	if len(this.buffers) != 2*this.jobs {
+		this.buffers = make([]blockBuffer, 2*this.jobs)
+
+		for i := range this.buffers {
+			this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		}
+	}
+
+	this.numa = getNumaNodes(ctx)
+	setNumaNodes(this.buffers, this.numa)
+
+	if this.listeners == nil {
+		this.listeners = make([]kanzi.Listener, 0)
 	}
 
-	this.listeners = make([]kanzi.Listener, 0)
 	this.ctx = ctx
+	this.options = cloneContext(ctx)
 	this.parentCtx = &ctx
+	this.seek = &seekTable{}
 	this.blockSize = 0
 	this.entropyType = entropy.NONE_TYPE
 	this.transformType = transform.NONE_TYPE
 	this.headless = false
+	this.segments = make([]SegmentInfo, 0)
+
+	// Decode the streams chained after the end of the first one (if any).
+	// Off by default: data after the end block is ignored.
+	if val, hasKey := ctx["chained"]; hasKey == true {
+		this.chained = val.(bool)
+	}
+
+	// Route the blocks of old streams through the compatibility transforms
+	// registered with transform.RegisterSubstitution (if any)
+	if _, hasKey := ctx["substitutions"]; hasKey == false {
+		ctx["substitutions"] = true
+	}
+
+	this.substitutions = &substitutionStats{blocks: make(map[string]int)}
+
+	// Check the decoded blocks against a detached manifest
+	if val, hasKey := ctx["manifest"]; hasKey {
+		m, ok := val.(*Manifest)
+
+		if ok == false || m == nil {
+			return &IOError{msg: "Invalid manifest parameter", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		var err error
+
+		if this.manifest, err = newManifestChecker(m); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	// Strict mode: corrupted data is always reported as a DecodingError with
+	// the position of the faulty block, never as a panic.
+	if val, hasKey := ctx["strict"]; hasKey {
+		this.strict = val.(bool)
+	}
+
+	// Skip the blocks that fail to decode (see BestEffort.go)
+	if val, hasKey := ctx["bestEffort"]; hasKey {
+		this.bestEffort = val.(bool)
+	}
+
+	// Record the statistics of the decoded blocks (see BlockInfo)
+	if val, hasKey := ctx["blockInfo"]; hasKey && val.(bool) == true {
+		this.blockInfos = make([]BlockInfo, 0)
+	}
+
+	// Check the stream digest stored in the trailer of archival streams
+	if val, hasKey := ctx["archival"]; hasKey && val.(bool) == true {
+		this.archive = newArchiveChecker()
+	}
+
+	// Hash the decoded data and check it against the stream footer
+	checkFooter := false
+
+	if val, hasKey := ctx["footer"]; hasKey {
+		checkFooter = val.(bool)
+	}
+
+	var err error
+
+	if this.footer, err = newFooterDigest(checkFooter); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_DECOMPRESSOR, cause: err}
+	}
+
+	// Memory budget, applied once the parameters of a segment are known
+	// (see Memory.go)
+	if this.maxMemory, err = getMaxMemory(ctx); err != nil {
+		return err
+	}
+
+	if this.maxOutput, err = getMaxOutputSize(ctx); err != nil {
+		return err
+	}
+
+	if this.blockRange, err = getBlockRange(ctx); err != nil {
+		return err
+	}
+
+	if this.onCorrupted, err = getCorruptedBlockCallback(ctx); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
 
 	if hdl, hasKey := ctx["headerless"]; hasKey == true {
 		this.headless = hdl.(bool)
 
+		if val, hasKey := ctx["linkedBlocks"]; hasKey && this.headless == true {
+			this.linked = val.(bool)
+
+			if this.linked == true && this.bestEffort == true {
+				return &IOError{msg: "Best effort decoding is not supported with linked blocks", code: kanzi.ERR_INVALID_PARAM}
+			}
+		}
+
+		if val, hasKey := ctx["autoTune"]; hasKey && this.headless == true {
+			this.autoTune = val.(bool)
+		}
+
+		// The speed governor stores the codecs of each block (see Governor.go)
+		if _, hasKey := ctx["minSpeedMBps"]; hasKey && this.headless == true {
+			this.autoTune = true
+		}
+
+		if val, hasKey := ctx["rsyncable"]; hasKey && this.headless == true {
+			this.rsyncable = val.(bool)
+		}
+
 		// Validate required values
 		if err := this.validateHeaderless(); err != nil {
-			return nil, err
+			return err
+		}
+
+		if val, hasKey := ctx["dedup"]; hasKey && val.(bool) == true {
+			this.dedup = newDedupWindow(this.blockSize)
+		}
+
+		// Headerless streams: the dictionary is not checked
+		shared, err := getSharedContext(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if shared != nil {
+			this.dictionary = shared.id
+			this.sharedDict = shared.dictionary
 		}
 	}
 
-	return this, nil
+	return nil
 }
 
 func (this *Reader) validateHeaderless() error {
@@ -1016,7 +2621,7 @@ func (this *Reader) validateHeaderless() error {
 			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
 		}
 	} else {
-		this.ctx["bsVersion"] = _BITSTREAM_FORMAT_VERSION
+		this.ctx["bsVersion"] = uint(_BITSTREAM_FORMAT_VERSION)
 	}
 
 	if e, hasKey := this.ctx["entropy"]; hasKey {
@@ -1024,7 +2629,7 @@ func (this *Reader) validateHeaderless() error {
 		this.entropyType, err = entropy.GetType(eName)
 
 		if err != nil {
-			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
 		}
 	} else {
 		return &IOError{msg: "Missing entropy in headerless mode", code: kanzi.ERR_MISSING_PARAM}
@@ -1035,7 +2640,7 @@ func (this *Reader) validateHeaderless() error {
 		this.transformType, err = transform.GetType(tName)
 
 		if err != nil {
-			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
 		}
 	} else {
 		return &IOError{msg: "Missing transform in headerless mode", code: kanzi.ERR_MISSING_PARAM}
@@ -1050,16 +2655,15 @@ func (this *Reader) validateHeaderless() error {
 		}
 
 		this.blockSize = int(blk)
-		this.bufferThreshold = this.blockSize
 	} else {
 		return &IOError{msg: "Missing block size in headerless mode", code: kanzi.ERR_MISSING_PARAM}
 	}
 
 	if c, hasKey := this.ctx["checksum"]; hasKey {
 		if c.(uint) != 0 {
-			if c == 32 {
+			if c.(uint) == 32 {
 				this.hasher32, err = hash.NewXXHash32(_BITSTREAM_TYPE)
-			} else if c == 64 {
+			} else if c.(uint) == 64 {
 				this.hasher64, err = hash.NewXXHash64(_BITSTREAM_TYPE)
 			} else {
 				err = &IOError{msg: "The lock checksum size must be 32 or 64 bits", code: kanzi.ERR_INVALID_PARAM}
@@ -1078,11 +2682,16 @@ func (this *Reader) validateHeaderless() error {
 			this.outputSize = 0 // 'not provided'
 		}
 
+		// Hint only: flushed and content defined blocks are shorter
 		nbBlocks := int((this.outputSize + int64(this.blockSize-1)) / int64(this.blockSize))
 		this.nbInputBlocks = min(nbBlocks, _MAX_CONCURRENCY-1)
 	}
 
-	return nil
+	if this.rsyncable == true {
+		this.nbInputBlocks = 0
+	}
+
+	return this.applyMemoryLimit()
 }
 
 // AddListener adds an event listener to this reader.
@@ -1103,42 +2712,254 @@ func (this *Reader) RemoveListener(bl kanzi.Listener) bool {
 		return false
 	}
 
-	for i, e := range this.listeners {
-		if e == bl {
-			this.listeners = append(this.listeners[0:i-1], this.listeners[i+1:]...)
-			return true
-		}
-	}
+	for i, e := range this.listeners {
+		if e == bl {
+			this.listeners = append(this.listeners[0:i-1], this.listeners[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (this *Reader) readHeader() error {
+	if this.headless == true || swapInt32(&this.initialized, 1) != 0 {
+		return nil
+	}
+
+	return this.readStreamHeader(true)
+}
+
+// nextSegment reads the header of the stream chained after the end of
+// the current one (if any) and resets the decoding parameters.
+// Returns false if there is no such stream or if chained streams are not
+// decoded (ctx["chained"]). The statistics trailer, footer or archive
+// trailer of the current stream is read first. Trailing data that does not
+// start with a valid stream type is ignored.
+func (this *Reader) nextSegment() (found bool, err error) {
+	if this.segmentEnd == false || this.headless == true {
+		return false, nil
+	}
+
+	this.segmentEnd = false
+
+	defer func() {
+		if r := recover(); r != nil {
+			// Not enough data left for another stream header
+			found, err = false, nil
+		}
+	}()
+
+	// Each stream starts on a byte boundary
+	if pad := uint(8-(this.ibs.Read()&7)) & 7; pad != 0 {
+		this.ibs.ReadBits(pad)
+	}
+
+	if more, _ := this.ibs.HasMoreToRead(); more == false {
+		return false, this.missingTrailerError()
+	}
+
+	streamType := readStreamType(this.ibs)
+
+	if streamType == _STATS_TYPE {
+		if err = this.readStatsTrailer(); err != nil {
+			// Not checked: trailing data
+			this.streamStats = nil
+			return false, nil
+		}
+
+		if more, _ := this.ibs.HasMoreToRead(); more == false {
+			return false, this.missingTrailerError()
+		}
+
+		streamType = readStreamType(this.ibs)
+	}
+
+	if streamType == _FOOTER_TYPE {
+		if err = this.readFooter(); err != nil {
+			if this.footer.hasher == nil {
+				// Not checked: trailing data
+				this.streamFooter = nil
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		if more, _ := this.ibs.HasMoreToRead(); more == false || this.chained == false {
+			return false, nil
+		}
+
+		streamType = readStreamType(this.ibs)
+	} else if this.footer.hasher != nil && this.archive == nil {
+		return false, &IOError{msg: "Footer verification failed: missing footer", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	if this.chained == false && this.archive == nil {
+		return false, nil
+	}
+
+	if streamType == _ARCHIVE_TYPE {
+		// Archival stream: skip the trailer (and check the stream digest)
+		if err = this.readArchiveTrailer(); err != nil {
+			return false, err
+		}
+
+		if more, _ := this.ibs.HasMoreToRead(); more == false || this.chained == false {
+			return false, nil
+		}
+
+		streamType = readStreamType(this.ibs)
+	} else if this.archive != nil {
+		return false, &IOError{msg: "Archive verification failed: missing trailer", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	if this.chained == false || (streamType != _BITSTREAM_TYPE && streamType != _COMPACT_MAGIC) {
+		return false, nil
+	}
+
+	this.hasher32 = nil
+	this.hasher64 = nil
+	this.blockHash = nil
+	this.dedup = nil
+	this.checksumFlags = false
+	this.customSeed = false
+	this.stageParams = false
+	this.syncMarkers = false
+	this.entropyLanes = false
+	this.useDictionary(0)
+	this.outputSize = 0
+	this.nbInputBlocks = 0
+
+	if this.archive != nil {
+		this.archive.digest.Reset()
+	}
+
+	this.footer.reset()
+	this.streamFooter = nil
+	this.streamStats = nil
+	this.damaged = 0
+	this.aead = nil
+	this.cipherType = _CIPHER_NONE
+	this.linked = false
+	this.autoTune = false
+	this.rsyncable = false
+	this.window = nil
+	this.blockCount = -1
+	storeInt32(&this.blockID, 0)
+
+	if streamType == _COMPACT_MAGIC {
+		err = this.readCompactHeader()
+	} else {
+		err = this.readStreamHeader(false)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// missingTrailerError returns the error reported when the stream ends after
+// the end block (nil if no trailer nor footer is checked)
+func (this *Reader) missingTrailerError() error {
+	if this.archive != nil {
+		return &IOError{msg: "Archive verification failed: missing trailer", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	if this.footer.hasher != nil {
+		return &IOError{msg: "Footer verification failed: missing footer", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return nil
+}
+
+// Segments returns information about the streams (segments) decoded so far.
+// The input contains several segments when streams with possibly different
+// compression parameters have been written one after the other.
+func (this *Reader) Segments() []SegmentInfo {
+	res := make([]SegmentInfo, len(this.segments))
+	copy(res, this.segments)
+	return res
+}
+
+// BlockCount returns the number of blocks in the stream being decoded (the
+// current one for chained streams) and true if it is known: the stream has
+// been decoded up to the end block, the stream is compact (one block) or,
+// for old bitstreams, the header records a number of blocks less than 63.
+func (this *Reader) BlockCount() (int, bool) {
+	return this.blockCount, this.blockCount >= 0
+}
+
+// endSegmentBlocks records the number of blocks of the current segment once
+// its end block has been read
+func (this *Reader) endSegmentBlocks(count int) {
+	if count < 0 {
+		return
+	}
+
+	this.blockCount = count
 
-	return false
+	if len(this.segments) > 0 {
+		this.segments[len(this.segments)-1].BlockCount = count
+	}
 }
 
-// Use a named return value to update the error in the defer function (after return is executed)
-func (this *Reader) readHeader() (err error) {
-	if this.headless == true || atomic.SwapInt32(&this.initialized, 1) != 0 {
-		return nil
+// Substitutions returns the number of blocks decoded so far by each
+// compatibility transform (see transform.RegisterSubstitution).
+func (this *Reader) Substitutions() map[string]int {
+	this.substitutions.lock.Lock()
+	defer this.substitutions.lock.Unlock()
+	res := make(map[string]int, len(this.substitutions.blocks))
+
+	for k, v := range this.substitutions.blocks {
+		res[k] = v
 	}
 
+	return res
+}
+
+// Use a named return value to update the error in the defer function (after return is executed)
+// The stream type has already been read if checkType is false.
+func (this *Reader) readStreamHeader(checkType bool) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			ioErr, ok := r.(error)
 
 			if ok {
-				err = &IOError{msg: "Invalid bitstream header: " + ioErr.Error(), code: kanzi.ERR_READ_FILE}
+				err = &IOError{msg: "Invalid bitstream header: " + ioErr.Error(), code: kanzi.ERR_READ_FILE, cause: ioErr}
 			} else {
 				err = &IOError{msg: "Invalid bitstream header", code: kanzi.ERR_READ_FILE}
 			}
 		}
 	}()
 
-	// Read stream type
-	fileType := this.ibs.ReadBits(32)
+	if checkType == true {
+		// Read stream type
+		fileType := readStreamType(this.ibs)
 
-	// Sanity check
-	if fileType != _BITSTREAM_TYPE {
-		return &IOError{msg: "Invalid stream type", code: kanzi.ERR_INVALID_FILE}
+		if fileType == _COMPACT_MAGIC {
+			return this.readCompactHeader()
+		}
+
+		// Sanity check
+		if fileType != _BITSTREAM_TYPE {
+			return &IOError{msg: "Invalid stream type", code: kanzi.ERR_INVALID_FILE}
+		}
+	}
+
+	offset := (this.ibs.Read() >> 3) - 4
+
+	// Keep the header as read to authenticate the encrypted blocks
+	header, err := newHeaderRecorder(this.ibs)
+
+	if err != nil {
+		return err
 	}
 
+	this.ibs = header
+	defer func() { this.ibs = header.InputBitStream }()
 	bsVersion := uint(this.ibs.ReadBits(4))
 
 	// Sanity check
@@ -1147,7 +2968,10 @@ func (this *Reader) readHeader() (err error) {
 		return &IOError{msg: errMsg, code: kanzi.ERR_STREAM_VERSION}
 	}
 
+	// The contexts of the tasks are built again from the new parameters
+	this.slots.reconfigure()
 	this.ctx["bsVersion"] = bsVersion
+	delete(this.ctx, "entropyLanes")
 
 	// Read block checksum
 	if bsVersion >= 6 {
@@ -1200,7 +3024,6 @@ func (this *Reader) readHeader() (err error) {
 	}
 
 	this.ctx["blockSize"] = uint(this.blockSize)
-	this.bufferThreshold = this.blockSize
 	szMask := uint(0)
 
 	if bsVersion >= 5 {
@@ -1212,9 +3035,16 @@ func (this *Reader) readHeader() (err error) {
 			this.outputSize = int64(this.ibs.ReadBits(16 * szMask))
 
 			if this.parentCtx != nil {
-				(*this.parentCtx)["outputSize"] = this.outputSize
+				// Chained streams: the output size is the sum of the sizes of all the streams
+				if len(this.segments) == 0 {
+					(*this.parentCtx)["outputSize"] = this.outputSize
+				} else if sz, hasKey := (*this.parentCtx)["outputSize"]; hasKey == true && sz.(int64) != 0 {
+					(*this.parentCtx)["outputSize"] = sz.(int64) + this.outputSize
+				}
 			}
 
+			// Hint only: flushed and content defined blocks are shorter.
+			// The number of blocks is known once the end block is read.
 			nbBlocks := int((this.outputSize + int64(this.blockSize-1)) / int64(this.blockSize))
 			this.nbInputBlocks = min(nbBlocks, _MAX_CONCURRENCY-1)
 		}
@@ -1248,14 +3078,87 @@ func (this *Reader) readHeader() (err error) {
 			return &IOError{msg: "Invalid bitstream: checksum mismatch", code: kanzi.ERR_CRC_CHECK}
 		}
 
-		if bsVersion >= 6 {
-			// Padding
-			this.ibs.ReadBits(15)
+		if bsVersion == 6 {
+			this.ibs.ReadBits(15) // padding
+		} else if bsVersion >= 7 {
+			// Header flags (padding bits in version 6)
+			this.cipherType = uint(this.ibs.ReadBits(2))
+			this.linked = this.ibs.ReadBit() == 1
+			this.autoTune = this.ibs.ReadBit() == 1
+			this.rsyncable = this.ibs.ReadBit() == 1
+			hashType := uint(this.ibs.ReadBits(2))
+
+			if this.ibs.ReadBit() == 1 {
+				this.dedup = newDedupWindow(this.blockSize)
+			}
+
+			hasDictionary := this.ibs.ReadBit() == 1
+			this.checksumFlags = this.ibs.ReadBit() == 1
+			this.customSeed = this.ibs.ReadBit() == 1
+			this.stageParams = this.ibs.ReadBit() == 1
+			this.syncMarkers = this.ibs.ReadBit() == 1
+			this.entropyLanes = this.ibs.ReadBit() == 1
+
+			// Reserved: the header must be encoded again exactly (see Cipher.go)
+			if this.ibs.ReadBit() != 0 {
+				return &IOError{msg: "Invalid bitstream: reserved header bits set", code: kanzi.ERR_INVALID_FILE}
+			}
+
+			if hasDictionary == true {
+				if err = this.useDictionary(uint32(this.ibs.ReadBits(32))); err != nil {
+					return err
+				}
+			}
+
+			if this.entropyLanes == true {
+				// The ANS decoders expect a lane header (see entropy/ANSLanes.go)
+				this.ctx["entropyLanes"] = uint(1)
+			}
+
+			if this.customSeed == true {
+				// Seed of the block checksums (see ChecksumPolicy.go)
+				this.checksumSeed = uint32(this.ibs.ReadBits(32))
+
+				if this.hasher32 != nil {
+					this.hasher32.SetSeed(this.checksumSeed)
+				} else if this.hasher64 != nil {
+					this.hasher64.SetSeed(uint64(this.checksumSeed))
+				}
+			}
+
+			if this.blockHash, err = newBlockHasher(hashType); err != nil {
+				errMsg := fmt.Sprintf("Invalid bitstream, incorrect block hash type: %d", hashType)
+				return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+			}
+
+			if this.rsyncable == true {
+				// Content defined blocks: no hint for the number of blocks
+				this.nbInputBlocks = 0
+			}
+
+			_, hasFrom := this.ctx["from"]
+			_, hasTo := this.ctx["to"]
+
+			if this.linked == true && (hasFrom == true || hasTo == true) {
+				return &IOError{msg: "Partial decoding is not supported with linked blocks", code: kanzi.ERR_INVALID_PARAM}
+			}
+
+			if this.linked == true && this.bestEffort == true {
+				return &IOError{msg: "Best effort decoding is not supported with linked blocks", code: kanzi.ERR_INVALID_PARAM}
+			}
+
+			if err = this.readCipherSalt(header); err != nil {
+				return err
+			}
 		}
 	} else if bsVersion >= 3 {
 		// Read number of blocks in input. 0 means 'unknown' and 63 means 63 or more.
 		this.nbInputBlocks = int(this.ibs.ReadBits(6))
 
+		if this.nbInputBlocks > 0 && this.nbInputBlocks < _MAX_CONCURRENCY-1 {
+			this.blockCount = this.nbInputBlocks
+		}
+
 		// Read and verify checksum
 		cksum1 := uint32(this.ibs.ReadBits(4))
 		var cksum2 uint32
@@ -1275,8 +3178,60 @@ func (this *Reader) readHeader() (err error) {
 		// Header prior to version 3
 		this.nbInputBlocks = int(this.ibs.ReadBits(6))
 		this.ibs.ReadBits(4) // reserved
+
+		if this.nbInputBlocks > 0 && this.nbInputBlocks < _MAX_CONCURRENCY-1 {
+			this.blockCount = this.nbInputBlocks
+		}
+	}
+
+	return this.addSegment(offset, bsVersion, szMask, false)
+}
+
+// addSegment registers the stream whose header has just been read and
+// notifies the listeners
+func (this *Reader) addSegment(offset uint64, bsVersion, szMask uint, compact bool) error {
+	if szMask == 0 && compact == false && len(this.segments) != 0 && this.parentCtx != nil {
+		// The total output size of chained streams is unknown
+		(*this.parentCtx)["outputSize"] = int64(0)
+	}
+
+	ckBits := uint(0)
+
+	if this.hasher32 != nil {
+		ckBits = 32
+	} else if this.hasher64 != nil {
+		ckBits = 64
+	}
+
+	tType, _ := transform.GetName(this.transformType)
+	eType, _ := entropy.GetName(this.entropyType)
+
+	if err := this.applyMemoryLimit(); err != nil {
+		return err
 	}
 
+	this.segments = append(this.segments, SegmentInfo{
+		Index:            len(this.segments),
+		Offset:           offset,
+		DecodedOffset:    this.decodedBytes,
+		BitstreamVersion: bsVersion,
+		BlockSize:        uint(this.blockSize),
+		Transform:        tType,
+		Entropy:          eType,
+		Checksum:         ckBits,
+		Cipher:           getCipherName(this.cipherType),
+		AutoTune:         this.autoTune,
+		Rsyncable:        this.rsyncable,
+		BlockHash:        getBlockHashName(this.blockHash.getType()),
+		Dedup:            this.dedup != nil,
+		Dictionary:       this.dictionary,
+		Compact:          compact,
+		SyncMarkers:      this.syncMarkers,
+		EntropyLanes:     this.entropyLanes,
+		OriginalSize:     this.outputSize,
+		BlockCount:       this.blockCount,
+	})
+
 	if len(this.listeners) > 0 {
 		var sb strings.Builder
 		var ckSize string
@@ -1293,26 +3248,70 @@ func (this *Reader) readHeader() (err error) {
 		sb.WriteString(fmt.Sprintf("Bitstream version: %d\n", bsVersion))
 		sb.WriteString(fmt.Sprintf("Block checksum: %v\n", ckSize))
 		sb.WriteString(fmt.Sprintf("Block size: %d bytes\n", this.blockSize))
-		w1, _ := entropy.GetName(this.entropyType)
+		w1 := eType
 
 		if w1 == "NONE" {
 			w1 = "no"
 		}
 
 		sb.WriteString(fmt.Sprintf("Using %s entropy codec (stage 1)\n", w1))
-		w2, _ := transform.GetName(this.transformType)
+		w2 := tType
 
 		if w2 == "NONE" {
 			w2 = "no"
 		}
 
 		sb.WriteString(fmt.Sprintf("Using %s transform (stage 2)\n", w2))
+		fields := []kanzi.Field{{Key: "bitstreamVersion", Value: bsVersion}, {Key: "checksum", Value: ckBits},
+			{Key: "blockSize", Value: this.blockSize}, {Key: "entropy", Value: eType}, {Key: "transform", Value: tType},
+			{Key: "autoTune", Value: this.autoTune}, {Key: "rsyncable", Value: this.rsyncable},
+			{Key: "blockHash", Value: getBlockHashName(this.blockHash.getType())}, {Key: "dedup", Value: this.dedup != nil},
+			{Key: "dictionary", Value: this.dictionary},
+			{Key: "compact", Value: compact}, {Key: "cipher", Value: getCipherName(this.cipherType)},
+			{Key: "syncMarkers", Value: this.syncMarkers}}
+
+		if this.autoTune == true {
+			sb.WriteString("Codecs selected for each block\n")
+		}
+
+		if this.rsyncable == true {
+			sb.WriteString("Content defined blocks (rsyncable)\n")
+		}
+
+		if this.blockHash != nil {
+			sb.WriteString(fmt.Sprintf("Block hash: %s\n", getBlockHashName(this.blockHash.getType())))
+		}
+
+		if this.dedup != nil {
+			sb.WriteString("Identical blocks deduplicated\n")
+		}
+
+		if this.dictionary != 0 {
+			sb.WriteString(fmt.Sprintf("Shared dictionary: %x\n", this.dictionary))
+		}
+
+		if compact == true {
+			sb.WriteString("Compact framing (single block)\n")
+		}
+
+		if this.syncMarkers == true {
+			sb.WriteString("Sync marker before each block\n")
+		}
+
+		if this.entropyLanes == true {
+			sb.WriteString("ANS blocks split in lanes\n")
+		}
+
+		if this.cipherType != _CIPHER_NONE {
+			sb.WriteString(fmt.Sprintf("Encryption: %s\n", getCipherName(this.cipherType)))
+		}
 
 		if szMask != 0 {
 			sb.WriteString(fmt.Sprintf("Original size: %d byte(s)\n", this.outputSize))
+			fields = append(fields, kanzi.Field{Key: "originalSize", Value: this.outputSize})
 		}
 
-		evt := kanzi.NewEventFromString(kanzi.EVT_AFTER_HEADER_DECODING, 0, sb.String(), time.Now())
+		evt := kanzi.NewEventWithFields(kanzi.EVT_AFTER_HEADER_DECODING, 0, sb.String(), fields, time.Now())
 		notifyListeners(this.listeners, evt)
 	}
 
@@ -1322,7 +3321,7 @@ func (this *Reader) readHeader() (err error) {
 // Close reads the buffered data from the reader and releases resources.
 // Close makes the bitstream unavailable for further reads. Idempotent
 func (this *Reader) Close() error {
-	if atomic.SwapInt32(&this.closed, 1) == 1 {
+	if swapInt32(&this.closed, 1) == 1 {
 		return nil
 	}
 
@@ -1334,7 +3333,11 @@ func (this *Reader) Close() error {
 
 	// Release resources
 	for i := range this.buffers {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		this.buffers[i].release()
+	}
+
+	if this.seek.reader != nil {
+		this.seek.reader.Close()
 	}
 
 	return nil
@@ -1343,8 +3346,29 @@ func (this *Reader) Close() error {
 // Read reads up to len(block) bytes and copies them into block.
 // Returns the number of bytes read (0 <= n <= len(block)) and any error encountered.
 // io.EOF is returned when the end of stream is reached.
-func (this *Reader) Read(block []byte) (int, error) {
-	if atomic.LoadInt32(&this.closed) == 1 {
+// In strict mode (ctx["strict"] = true), the errors are *DecodingError.
+func (this *Reader) Read(block []byte) (n int, err error) {
+	if this.strict == false {
+		return this.read(block)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			// Stop decoding: the state of the reader is unknown
+			storeInt32(&this.blockID, _CANCEL_TASKS_ID)
+			n, err = 0, newDecodingError(fmt.Errorf("%v", r), 0, this.ibs.Read())
+		}
+	}()
+
+	if n, err = this.read(block); err != nil && err != io.EOF {
+		err = newDecodingError(err, 0, this.ibs.Read())
+	}
+
+	return n, err
+}
+
+func (this *Reader) read(block []byte) (int, error) {
+	if loadInt32(&this.closed) == 1 {
 		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
 	}
 
@@ -1352,51 +3376,83 @@ func (this *Reader) Read(block []byte) (int, error) {
 		return 0, err
 	}
 
+	if this.blockRange != nil {
+		// Blocks read with the seek table (if any, see BlockRange.go)
+		seekable, err := this.openBlockRange()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if seekable == true {
+			return this.readBlockRange(block)
+		}
+	}
+
 	off := 0
 	remaining := len(block)
 
 	for remaining > 0 {
-		avail := this.available
-		bufOff := this.consumed % this.blockSize
-
-		if avail > this.bufferThreshold-bufOff {
-			avail = this.bufferThreshold - bufOff
-		}
+		if this.available > 0 {
+			// Process a chunk of in-buffer data. No access to bitstream required
+			// Blocks may be shorter than the block size (EG. flushed blocks)
+			bufOff := this.consumed
+			lenChunk := min(remaining, this.bufferLengths[this.bufferID]-bufOff)
+			copy(block[off:], this.buffers[this.bufferID].Buf[bufOff:bufOff+lenChunk])
 
-		lenChunk := remaining
+			if this.archive != nil {
+				this.archive.digest.Write(block[off : off+lenChunk])
+			}
 
-		// lenChunk = min(remaining, min(this.available, this.bufferThreshold-bufOff))
-		if lenChunk > avail {
-			lenChunk = avail
-		}
+			this.footer.update(block[off : off+lenChunk])
 
-		if lenChunk > 0 {
-			// Process a chunk of in-buffer data. No access to bitstream required
-			bufID := this.consumed / this.blockSize
-			copy(block[off:], this.buffers[bufID].Buf[bufOff:bufOff+lenChunk])
 			off += lenChunk
 			remaining -= lenChunk
 			this.available -= lenChunk
 			this.consumed += lenChunk
 
-			if this.available > 0 && bufOff+lenChunk >= this.bufferThreshold {
+			if this.consumed >= this.bufferLengths[this.bufferID] {
 				// Move to next buffer
-				continue
+				this.bufferID++
+				this.consumed = 0
 			}
 
-			if remaining == 0 {
-				break
-			}
+			continue
 		}
 
 		// Buffer empty, time to decode
 		if this.available == 0 {
 			var err error
 
+			if this.blockRangeEnded() == true {
+				// The rest of the input is not read (see BlockRange.go)
+				if len(block) == remaining {
+					return 0, io.EOF
+				}
+
+				break
+			}
+
 			if this.available, err = this.processBlock(); err != nil {
 				return len(block) - remaining, err
 			}
 
+			if this.available == 0 {
+				// End of current stream, check for a chained stream
+				this.endCompactSegment()
+				found, err := this.nextSegment()
+
+				if err != nil {
+					return len(block) - remaining, err
+				}
+
+				if found == true {
+					continue
+				}
+			}
+
+			this.decodedBytes += int64(this.available)
+
 			if this.available == 0 {
 				// Reached end of stream
 				if len(block) == remaining {
@@ -1413,109 +3469,198 @@ func (this *Reader) Read(block []byte) (int, error) {
 }
 
 func (this *Reader) processBlock() (int, error) {
-	if atomic.LoadInt32(&this.blockID) == _CANCEL_TASKS_ID {
+	if loadInt32(&this.blockID) == _CANCEL_TASKS_ID {
 		return 0, nil
 	}
 
-	blkSize := this.blockSize
-
 	// Add a padding area to manage any block temporarily expanded
-	if _EXTRA_BUFFER_SIZE >= (blkSize >> 4) {
-		blkSize += _EXTRA_BUFFER_SIZE
-	} else {
-		blkSize += (blkSize >> 4)
-	}
+	blkSize := this.taskBlockSize()
 
 	// Protect against future concurrent modification of the list of block listeners
 	listeners := make([]kanzi.Listener, len(this.listeners))
 	copy(listeners, this.listeners)
 	decoded := 0
 
-	nbTasks := this.jobs
-	var jobsPerTask []uint
-
 	// Assign optimal number of tasks and jobs per task (if the number of blocks is known)
-	if nbTasks > 1 {
-		// Limit the number of jobs if there are fewer blocks that this.jobs
-		// It allows more jobs per task and reduces memory usage.
-		if this.nbInputBlocks > 0 {
-			nbTasks = min(nbTasks, this.nbInputBlocks)
-		}
+	// Fewer blocks than jobs allow more jobs per task and reduce memory usage.
+	nbBlocks := this.nbInputBlocks
 
-		jobsPerTask, _ = internal.ComputeJobsPerTask(make([]uint, nbTasks), uint(this.jobs), uint(nbTasks))
-	} else {
-		jobsPerTask = []uint{uint(this.jobs)}
+	if this.blockCount >= 0 {
+		// Exact number of blocks left (the end block needs one task)
+		nbBlocks = max(this.blockCount-int(loadInt32(&this.blockID)), 1)
+	}
+
+	if this.linked == true {
+		// Each block depends on the previous one
+		nbBlocks = 1
 	}
 
+	slots := this.decodingSlots()
+	plan := slots.plan.get(nbBlocks, this.jobs)
+	nbTasks := plan.Tasks
+	jobsPerTask := plan.JobsPerTask
+
 	bufSize := this.blockSize + _EXTRA_BUFFER_SIZE
 
 	if bufSize < this.blockSize+(this.blockSize>>4) {
 		bufSize = this.blockSize + (this.blockSize >> 4)
 	}
 
+	// The manifest only covers the first stream. All its blocks must be
+	// decoded unless a range of blocks has been selected.
+	manifest := this.manifest
+	_, hasFrom := this.ctx["from"]
+	_, hasTo := this.ctx["to"]
+	checkAll := hasFrom == false && hasTo == false
+
+	if len(this.segments) > 1 {
+		manifest = nil
+	}
+
 	for {
-		results := make([]decodingTaskResult, nbTasks)
-		wg := sync.WaitGroup{}
 		firstID := this.blockID
 
 		// Invoke as many go routines as required
 		for taskID := 0; taskID < nbTasks; taskID++ {
-			if len(this.buffers[taskID].Buf) < int(bufSize) {
-				this.buffers[taskID].Buf = make([]byte, bufSize)
-			}
+			this.buffers[taskID].grow(int(bufSize), false)
 
-			copyCtx := make(map[string]any)
+			slot := &slots.slots[taskID]
+			slot.ctx = taskContext(slot.ctx, this.ctx, &slot.scratch, jobsPerTask[taskID])
+			slot.scratch.Reset(0)
+			slot.scratch.Dictionary = this.sharedDict
 
-			for k, v := range this.ctx {
-				copyCtx[k] = v
+			if this.linked == true {
+				slot.scratch.Priming = this.window
 			}
 
-			copyCtx["jobs"] = jobsPerTask[taskID]
-			results[taskID] = decodingTaskResult{}
-			wg.Add(1)
+			slot.res = decodingTaskResult{}
+			slots.wg.Add(1)
 
-			task := decodingTask{
+			slot.task = decodingTask{
 				iBuffer:            &this.buffers[taskID],
 				oBuffer:            &this.buffers[this.jobs+taskID],
 				hasher32:           this.hasher32,
 				hasher64:           this.hasher64,
+				blockHash:          this.blockHash,
 				blockLength:        uint(blkSize),
 				blockTransformType: this.transformType,
 				blockEntropyType:   this.entropyType,
 				currentBlockID:     firstID + int32(taskID) + 1,
 				processedBlockID:   &this.blockID,
-				wg:                 &wg,
+				wg:                 &slots.wg,
 				listeners:          listeners,
 				ibs:                this.ibs,
-				ctx:                copyCtx}
+				ctx:                slot.ctx,
+				substitutions:      this.substitutions,
+				manifest:           manifest,
+				strict:             this.strict,
+				bestEffort:         this.bestEffort,
+				aead:               this.aead,
+				header:             this.header,
+				autoTune:           this.autoTune,
+				dedup:              this.dedup != nil,
+				checksumFlags:      this.checksumFlags,
+				stageParams:        this.stageParams,
+				syncMarkers:        this.syncMarkers,
+				maxOutput:          this.maxOutput,
+				scratch:            &slot.scratch,
+				local:              &slot.local}
 
 			// Invoke the tasks concurrently
-			go task.decode(&results[taskID])
+			startSlotTask(this.numa, taskID, slot.run)
 		}
 
 		// Wait for completion of all tasks
-		wg.Wait()
+		slots.wg.Wait()
 
 		// Process results
 		n, skipped := 0, 0
+		ended := false
+
+		for i := range slots.slots[0:nbTasks] {
+			r := slots.slots[i].res
+
+			if ended == true {
+				// Tasks planned past the end block (cancelled)
+				break
+			}
+
+			if r.resyncEnd != 0 {
+				// Region skipped to find a sync marker (see Resync.go)
+				this.reportResync(&r, this.decodedBytes+int64(decoded))
+			}
+
+			if r.endOfStream == true {
+				ended = true
+				this.segmentEnd = true
+				this.endSegmentBlocks(r.blockID - 1)
+
+				if manifest != nil && r.err == nil && checkAll == true && this.damaged == 0 {
+					if err := manifest.complete(); err != nil {
+						return decoded, err
+					}
+				}
+			}
 
-		for _, r := range results {
 			if r.skipped == true {
 				skipped++
 				continue
 			}
 
+			if r.err == nil && r.repeatOf != 0 {
+				if err := this.resolveRepeat(&r); err != nil {
+					r.err = err
+					r.recoverable = this.bestEffort
+				}
+			}
+
+			if r.err != nil && r.recoverable == true {
+				// Best effort mode: drop the block
+				this.skipBlock(&r, this.decodedBytes+int64(decoded))
+				skipped++
+				continue
+			}
+
 			if r.decoded > this.blockSize {
 				return decoded, &IOError{msg: "Invalid data", code: kanzi.ERR_PROCESS_BLOCK}
 			}
 
 			decoded += r.decoded
 
+			if r.err == nil && this.maxOutput > 0 && this.decodedBytes+int64(decoded) > this.maxOutput {
+				return decoded - r.decoded, newOutputLimitError("decoded data", this.decodedBytes+int64(decoded), this.maxOutput)
+			}
+
+			if r.err != nil && r.err.code == kanzi.ERR_OUTPUT_LIMIT {
+				// Block rejected by the task (see OutputLimit.go)
+				return decoded, &OutputLimitError{IOError: *r.err, Limit: this.maxOutput}
+			}
+
 			if r.err != nil {
+				if this.strict == true {
+					return decoded, newDecodingError(r.err, r.blockID, r.offset)
+				}
+
 				return decoded, r.err
 			}
 
 			copy(this.buffers[n].Buf, r.data[0:r.decoded])
+			this.bufferLengths[n] = r.decoded
+
+			if this.dedup != nil && r.repeatOf == 0 {
+				this.dedup.add(int32(r.blockID), "", r.data[0:r.decoded])
+			}
+
+			if this.blockInfos != nil && r.info.ID != 0 {
+				r.info.Segment = len(this.segments) - 1
+				r.info.DecodedSize = r.decoded
+				this.blockInfos = append(this.blockInfos, r.info)
+			}
+
+			if this.linked == true && r.decoded > 0 {
+				start := max(r.decoded-_LINKED_WINDOW_SIZE, 0)
+				slots.window, this.window = this.window, append(slots.window[0:0], r.data[start:r.decoded]...)
+			}
 			n++
 			hashType := kanzi.EVT_HASH_NONE
 
@@ -1530,6 +3675,19 @@ func (this *Reader) processBlock() (int, error) {
 				evt := kanzi.NewEvent(kanzi.EVT_AFTER_TRANSFORM, int(r.blockID),
 					int64(r.decoded), r.checksum, hashType, r.completionTime)
 				notifyListeners(listeners, evt)
+
+				if r.endOfStream == false {
+					progress := kanzi.Progress{InputBytes: int64((r.end + 7) >> 3),
+						OutputBytes: this.decodedBytes + int64(decoded)}
+
+					// The total size of chained streams is unknown
+					if len(this.segments) <= 1 {
+						progress.TotalBytes = this.outputSize
+					}
+
+					evt = kanzi.NewProgressEvent(kanzi.EVT_DECOMPRESSION_PROGRESS, int(r.blockID), progress, r.completionTime)
+					notifyListeners(listeners, evt)
+				}
 			}
 		}
 
@@ -1539,10 +3697,24 @@ func (this *Reader) processBlock() (int, error) {
 		}
 	}
 
+	this.bufferID = 0
 	this.consumed = 0
 	return decoded, nil
 }
 
+// newDecodingError returns err with a position (unchanged if err is
+// already a DecodingError).
+func newDecodingError(err error, blockID int, offset uint64) *DecodingError {
+	switch e := err.(type) {
+	case *DecodingError:
+		return e
+	case *IOError:
+		return &DecodingError{IOError: *e, BlockID: blockID, Offset: offset}
+	default:
+		return &DecodingError{IOError: IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}, BlockID: blockID, Offset: offset}
+	}
+}
+
 // GetRead returns the number of bytes read so far
 func (this *Reader) GetRead() uint64 {
 	return (this.ibs.Read() + 7) >> 3
@@ -1566,11 +3738,13 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	decoded := 0
 	checksum1 := uint64(0)
 	skipped := false
+	blockOffset := uint64(0)
 
 	defer func() {
 		res.data = this.iBuffer.Buf
 		res.decoded = decoded
 		res.blockID = int(this.currentBlockID)
+		res.offset = blockOffset
 		res.completionTime = time.Now()
 		res.checksum = checksum1
 		res.skipped = skipped
@@ -1579,17 +3753,25 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 			err, ok := r.(error)
 
 			if ok {
-				res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+				res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+			} else if this.strict == true {
+				res.err = &IOError{msg: fmt.Sprintf("Invalid block data: %v", r), code: kanzi.ERR_PROCESS_BLOCK}
 			} else {
 				res.err = &IOError{msg: "Unknown error", code: kanzi.ERR_PROCESS_BLOCK}
 			}
 		}
 
+		// Best effort mode: the next blocks can be decoded once the bitstream
+		// has been read
+		res.recoverable = res.err != nil && this.bestEffort == true && res.end != 0 && res.err.code != kanzi.ERR_OUTPUT_LIMIT
+
 		// Unblock other tasks
-		if res.err != nil || (res.decoded == 0 && res.skipped == false) {
-			atomic.StoreInt32(this.processedBlockID, _CANCEL_TASKS_ID)
-		} else if atomic.LoadInt32(this.processedBlockID) == this.currentBlockID-1 {
-			atomic.StoreInt32(this.processedBlockID, this.currentBlockID)
+		if res.recoverable == true {
+			res.decoded = 0
+		} else if res.err != nil || (res.decoded == 0 && res.skipped == false && res.repeatOf == 0) {
+			storeInt32(this.processedBlockID, _CANCEL_TASKS_ID)
+		} else if loadInt32(this.processedBlockID) == this.currentBlockID-1 {
+			storeInt32(this.processedBlockID, this.currentBlockID)
 		}
 
 		this.wg.Done()
@@ -1597,7 +3779,7 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 
 	// Lock free synchronization
 	for n := 0; ; n++ {
-		taskID := atomic.LoadInt32(this.processedBlockID)
+		taskID := loadInt32(this.processedBlockID)
 
 		if taskID == _CANCEL_TASKS_ID {
 			return
@@ -1613,11 +3795,16 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	}
 
 	// Read shared bitstream sequentially
-	blockOffset := this.ibs.Read()
-	lr := uint(this.ibs.ReadBits(5)) + 3
-	read := this.ibs.ReadBits(lr)
+	blockOffset = this.ibs.Read()
+	read, ioErr := this.readBlockLength(res)
+
+	if ioErr != nil {
+		res.err = ioErr
+		return
+	}
 
 	if read == 0 {
+		res.endOfStream = true
 		return
 	}
 
@@ -1626,34 +3813,58 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		return
 	}
 
+	// In strict mode, do not allocate huge buffers for corrupted block sizes
+	// (compressed blocks are never much bigger than the original data)
+	if this.strict == true && read > 16*uint64(this.blockLength)+8*_STRICT_BLOCK_MARGIN {
+		res.err = &IOError{msg: fmt.Sprintf("Invalid block size: %d bits", read), code: kanzi.ERR_BLOCK_SIZE}
+		return
+	}
+
+	// Same bound with an output size limit (the block length is capped by
+	// the limit, see OutputLimit.go)
+	if this.maxOutput > 0 && read > 16*uint64(this.blockLength)+8*_STRICT_BLOCK_MARGIN {
+		res.err = &newOutputLimitError("compressed block", int64(read>>3), this.maxOutput).IOError
+		return
+	}
+
 	r := int((read + 7) >> 3)
 	maxL := r
+	compressedSize := r
+
+	if this.aead != nil {
+		// Encrypted data: whole bytes followed by (byte alignment) padding bits
+		r = int(read >> 3)
+	}
 
 	if int(this.blockLength) > r {
 		maxL = int(this.blockLength)
 	}
 
 	if len(data) < maxL {
-		data = make([]byte, maxL)
-		this.iBuffer.Buf = data
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "input", len(data), maxL, "blockLength")
+		data = this.iBuffer.grow(maxL, false)
 	}
 
 	// Read data from shared bitstream
-	for n := uint(0); read > 0; {
-		chkSize := uint(1 << 30)
+	profileStage(this.ctx, _STAGE_BITSTREAM_READ, "", compressedSize, func() {
+		for n := uint(0); read > 0; {
+			chkSize := uint(1 << 30)
 
-		if read < 1<<30 {
-			chkSize = uint(read)
+			if read < 1<<30 {
+				chkSize = uint(read)
+			}
+
+			this.ibs.ReadArray(data[n:], chkSize)
+			n += ((chkSize + 7) >> 3)
+			read -= uint64(chkSize)
 		}
+	})
 
-		this.ibs.ReadArray(data[n:], chkSize)
-		n += ((chkSize + 7) >> 3)
-		read -= uint64(chkSize)
-	}
+	res.end = this.ibs.Read()
 
 	// After completion of the bitstream reading, increment the block id.
 	// It unblocks the task processing the next block (if any)
-	atomic.StoreInt32(this.processedBlockID, this.currentBlockID)
+	storeInt32(this.processedBlockID, this.currentBlockID)
 
 	// Check if the block must be skipped
 	if v, hasKey := this.ctx["from"]; hasKey {
@@ -1672,12 +3883,27 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 
 	// All the code below is concurrent
 	// Create a bitstream local to the task
-	bufStream := internal.NewBufferStream(data[0:r])
-	ibs, _ := bitstream.NewDefaultInputBitStream(bufStream, 16384)
+	if this.aead != nil {
+		plain, err := this.decrypt(data[0:r])
+
+		if err != nil {
+			res.err = err
+			return
+		}
+
+		r = len(plain)
+	}
 
+	ibs := this.local.input(data[0:r])
 	mode := byte(ibs.ReadBits(8))
 	skipFlags := byte(0)
 
+	if this.dedup == true && mode == _DEDUP_REPEAT_MODE {
+		// Identical to an earlier block, resolved in block order (see Dedup.go)
+		checksum1 = this.readRepeatRecord(ibs, res, blockOffset, compressedSize)
+		return
+	}
+
 	if mode&_COPY_BLOCK_MASK != 0 {
 		this.blockTransformType = transform.NONE_TYPE
 		this.blockEntropyType = entropy.NONE_TYPE
@@ -1689,6 +3915,17 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		}
 	}
 
+	if this.autoTune == true && mode&_COPY_BLOCK_MASK == 0 {
+		this.blockTransformType = ibs.ReadBits(48)
+		this.blockEntropyType = uint32(ibs.ReadBits(_AUTO_TUNE_BLOCK_BITS - 48))
+	}
+
+	stageParams := uint64(0)
+
+	if this.stageParams == true && mode&_COPY_BLOCK_MASK == 0 {
+		stageParams = readStageParams(ibs)
+	}
+
 	dataSize := 1 + uint((mode>>5)&0x03)
 	length := dataSize << 3
 	mask := uint64(1<<length) - 1
@@ -1701,23 +3938,47 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		return
 	}
 
+	// Checked before allocating the buffers (see OutputLimit.go)
+	if this.maxOutput > 0 && preTransformLength > this.blockLength {
+		res.err = &newOutputLimitError("block", int64(preTransformLength), this.maxOutput).IOError
+		return
+	}
+
 	hashType := kanzi.EVT_HASH_NONE
 
+	// Only the flagged blocks carry a checksum (see ChecksumPolicy.go)
+	checksummed := this.checksumFlags == false || ibs.ReadBit() == 1
+
 	// Extract checksum from bit stream (if any)
-	if this.hasher32 != nil {
+	if checksummed == true && this.hasher32 != nil {
 		checksum1 = ibs.ReadBits(32)
 		hashType = kanzi.EVT_HASH_32BITS
-	} else if this.hasher64 != nil {
+	} else if checksummed == true && this.hasher64 != nil {
 		checksum1 = ibs.ReadBits(64)
 		hashType = kanzi.EVT_HASH_64BITS
 	}
 
+	var blockHash []byte
+
+	if this.blockHash != nil {
+		blockHash = make([]byte, this.blockHash.bits()>>3)
+		ibs.ReadArray(blockHash, this.blockHash.bits())
+	}
+
+	res.info = BlockInfo{ID: int(this.currentBlockID), Offset: blockOffset,
+		CompressedSize: compressedSize, EntropySize: int(preTransformLength),
+		SkipFlags: skipFlags, Copied: mode&_COPY_BLOCK_MASK != 0,
+		Checksum: checksum1, ChecksumSize: uint(hashType), Hash: blockHash}
+	res.info.Transform, _ = transform.GetName(this.blockTransformType)
+	res.info.Entropy, _ = entropy.GetName(this.blockEntropyType)
+
 	if len(this.listeners) > 0 {
 		if v, hasKey := this.ctx["verbosity"]; hasKey {
 			if v.(uint) > 4 {
 				msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"offset\":%d, \"skipFlags\":%.8b }",
 					"BLOCK_INFO", int(this.currentBlockID), blockOffset, skipFlags)
-				evt1 := kanzi.NewEventFromString(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, time.Now())
+				fields := []kanzi.Field{{Key: "offset", Value: blockOffset}, {Key: "skipFlags", Value: skipFlags}}
+				evt1 := kanzi.NewEventWithFields(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, fields, time.Now())
 				notifyListeners(this.listeners, evt1)
 			}
 		}
@@ -1731,11 +3992,13 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	bufferSize := max(this.blockLength, preTransformLength+_EXTRA_BUFFER_SIZE)
 
 	if len(buffer) < int(bufferSize) {
-		buffer = make([]byte, int(bufferSize))
-		this.oBuffer.Buf = buffer
+		notifyBufferRealloc(this.listeners, this.currentBlockID, "output", len(buffer), int(bufferSize), "preTransformLength")
+		buffer = this.oBuffer.grow(int(bufferSize), false)
 	}
 
-	this.ctx["size"] = preTransformLength
+	entropyOnly := isEntropyOnly(this.blockTransformType)
+
+	this.scratch.Size = preTransformLength
 
 	// Each block is decoded separately
 	// Rebuild the entropy decoder to reset block statistics
@@ -1743,14 +4006,18 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 
 	if err != nil {
 		// Error => cancel concurrent decoding tasks
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC}
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC, cause: err}
 		return
 	}
 
 	// Block entropy decode
-	if _, err = ed.Read(buffer[0:preTransformLength]); err != nil {
+	profileStage(this.ctx, _STAGE_ENTROPY_DECODE, res.info.Entropy, int(preTransformLength), func() {
+		_, err = ed.Read(buffer[0:preTransformLength])
+	})
+
+	if err != nil {
 		// Error => cancel concurrent decoding tasks
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
 		return
 	}
 
@@ -1769,29 +4036,52 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		notifyListeners(this.listeners, evt2)
 	}
 
-	this.ctx["size"] = preTransformLength
-	transform, err := transform.New(&this.ctx, this.blockTransformType)
+	if entropyOnly == true {
+		// No inverse transform: the decoded data becomes the input buffer
+		// (see EntropyOnly.go)
+		this.iBuffer.Buf, this.oBuffer.Buf = this.oBuffer.Buf, this.iBuffer.Buf
+		data = this.iBuffer.Buf
+		decoded = int(preTransformLength)
+	} else {
+		this.scratch.Size = preTransformLength
+		this.scratch.Substituted = this.scratch.Substituted[0:0]
+		transform, err := transform.NewWithParams(&this.ctx, this.blockTransformType, stageParams)
 
-	if err != nil {
-		// Error => return
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC}
-		return
-	}
+		if err != nil {
+			// Error => return
+			res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC, cause: err}
+			return
+		}
 
-	transform.SetSkipFlags(skipFlags)
-	var oIdx uint
+		if used := this.scratch.Substituted; len(used) != 0 && skipFlags != 0xFF {
+			this.substitutions.lock.Lock()
 
-	// Inverse transform
-	if _, oIdx, err = transform.Inverse(buffer[0:preTransformLength], data); err != nil {
-		// Error => return
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
-		return
-	}
+			for _, name := range used {
+				this.substitutions.blocks[name]++
+			}
+
+			this.substitutions.lock.Unlock()
+		}
+
+		transform.SetSkipFlags(skipFlags)
+		var oIdx uint
+
+		// Inverse transform
+		profileStage(this.ctx, _STAGE_TRANSFORM_INVERSE, res.info.Transform, int(preTransformLength), func() {
+			_, oIdx, err = transform.Inverse(buffer[0:preTransformLength], data)
+		})
 
-	decoded = int(oIdx)
+		if err != nil {
+			// Error => return
+			res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+			return
+		}
+
+		decoded = int(oIdx)
+	}
 
 	// Verify checksum
-	if this.hasher32 != nil {
+	if checksummed == true && this.hasher32 != nil {
 		checksum2 := this.hasher32.Hash(data[0:decoded])
 
 		if checksum2 != uint32(checksum1) {
@@ -1799,7 +4089,7 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 			res.err = &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
 			return
 		}
-	} else if this.hasher64 != nil {
+	} else if checksummed == true && this.hasher64 != nil {
 		checksum2 := this.hasher64.Hash(data[0:decoded])
 
 		if checksum2 != checksum1 {
@@ -1808,4 +4098,19 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 			return
 		}
 	}
+
+	if blockHash != nil {
+		if hash2 := this.blockHash.sum(data[0:decoded]); bytes.Equal(hash2, blockHash) == false {
+			errMsg := fmt.Sprintf("Corrupted bitstream: expected block hash %x, found %x", blockHash, hash2)
+			res.err = &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+			return
+		}
+	}
+
+	if this.manifest != nil {
+		if err := this.manifest.verify(int(this.currentBlockID), data[0:decoded]); err != nil {
+			res.err = err
+			return
+		}
+	}
 }
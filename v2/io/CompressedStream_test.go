@@ -16,8 +16,10 @@ limitations under the License.
 package io
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -266,3 +268,76 @@ func compressAfterReadClose(block []byte) int {
 
 	return 7
 }
+
+// compressData compresses data with the Writer parameters in ctx (default
+// values for the missing codecs, block size, jobs and checksum) and returns
+// the compressed stream.
+func compressData(t *testing.T, data []byte, ctx map[string]any) []byte {
+	t.Helper()
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, withDefaults(ctx))
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	return bs.Bytes()
+}
+
+// decompressData decompresses input with the Reader parameters in ctx (1
+// job if missing). The Reader is returned (closed) for inspection.
+func decompressData(input []byte, ctx map[string]any) ([]byte, *Reader, error) {
+	params := map[string]any{"jobs": uint(1)}
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	r, err := NewReaderWithCtx(internal.NewBufferStream(input), params)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer r.Close()
+	res, err := io.ReadAll(r)
+	return res, r, err
+}
+
+// roundTrip compresses data with the Writer parameters in wCtx, decompresses
+// the stream with the Reader parameters in rCtx and checks the result.
+// Returns the compressed stream and the Reader.
+func roundTrip(t *testing.T, data []byte, wCtx, rCtx map[string]any) ([]byte, *Reader) {
+	t.Helper()
+	output := compressData(t, data, wCtx)
+	res, r, err := decompressData(output, rCtx)
+
+	if err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	if bytes.Equal(res, data) == false {
+		t.Fatalf("Invalid decompressed data: %d bytes, expected %d", len(res), len(data))
+	}
+
+	return output, r
+}
+
+func mustReader(t *testing.T, data []byte, ctx map[string]any) *Reader {
+	t.Helper()
+	r, err := NewReaderWithCtx(internal.NewBufferStream(data), ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	return r
+}
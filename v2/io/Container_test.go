@@ -0,0 +1,62 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestContainerBlocks(t *testing.T) {
+	fmt.Println("Container Blocks Test")
+
+	// Parquet file: compressed pages (high entropy) and some metadata (text)
+	data := make([]byte, 0, 100000)
+	data = append(data, []byte("PAR1")...)
+
+	for len(data) < 100000 {
+		page := make([]byte, 10000)
+		rand.Read(page)
+		data = append(data, page...)
+		data = append(data, bytes.Repeat([]byte("schema: {name: string, value: int64} "), 160)...)
+	}
+
+	for _, magic := range []string{"PAR1", "ORC", "NONE"} {
+		copy(data, magic)
+		bs := internal.NewBufferStream()
+		ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(len(data)) & 0xFFFFFFF0,
+			"jobs": uint(1), "checksum": uint(0), "skipBlocks": true}
+		w, _ := NewWriterWithCtx(bs, ctx)
+		w.Write(data)
+		w.Close()
+		r := mustReader(t, bs.Bytes(), map[string]any{"jobs": uint(1), "blockInfo": true})
+		res, err := io.ReadAll(r)
+
+		if err != nil || bytes.Equal(res, data) == false {
+			t.Fatalf("%s: invalid decompressed data: %v", magic, err)
+		}
+
+		info, found := r.BlockInfo(0)
+
+		if found == false || info.Copied != (magic != "NONE") {
+			t.Errorf("%s: incorrect block type (copied=%v)", magic, info.Copied)
+		}
+	}
+}
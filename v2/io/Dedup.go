@@ -0,0 +1,254 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Deduplication (ctx["dedup"] = true): each block identical to one of the
+// recently used distinct blocks of the stream is emitted as a repeat record
+// instead of being compressed again:
+//
+//	mode 0x90 (copy and transforms flags, never set together otherwise)
+//	ID of the earlier block (32) | checksum (32 or 64, if any)
+//
+// The Writer compares the strong hashes of the blocks (XXH3 128 bits unless
+// the block hash is BLAKE3). The Writer and the Reader keep the same window
+// of distinct blocks (least recently used first, up to _DEDUP_MAX_BLOCKS
+// blocks and _DEDUP_MAX_MEMORY bytes), so the Reader only keeps the data of
+// the blocks that can be referenced. The flag is stored in the header
+// (version 7). Not compatible with encryption (identical blocks would be
+// visible) nor with linked blocks. A partial decoding (ctx["from"]) fails
+// on the repeat of a block that was not decoded.
+
+const (
+	_DEDUP_REPEAT_MODE = _COPY_BLOCK_MASK | _TRANSFORMS_MASK
+	_DEDUP_MAX_BLOCKS  = 64
+	_DEDUP_MAX_MEMORY  = 64 * 1024 * 1024
+)
+
+// dedupWindow the distinct blocks that can be referenced, least recently
+// used first. The encoder keeps the hashes, the decoder the data.
+type dedupWindow struct {
+	capacity int
+	ids      []int32
+	keys     []string
+	blocks   [][]byte
+}
+
+func newDedupWindow(blockSize int) *dedupWindow {
+	capacity := max(min(_DEDUP_MAX_BLOCKS, _DEDUP_MAX_MEMORY/max(blockSize, 1)), 1)
+	return &dedupWindow{capacity: capacity}
+}
+
+// find returns the index of the block with the provided ID (-1 if absent)
+func (this *dedupWindow) find(id int32) int {
+	for i := range this.ids {
+		if this.ids[i] == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// touch makes the entry at index i the most recently used
+func (this *dedupWindow) touch(i int) {
+	id, key, block := this.ids[i], this.keys[i], this.blocks[i]
+	copy(this.ids[i:], this.ids[i+1:])
+	copy(this.keys[i:], this.keys[i+1:])
+	copy(this.blocks[i:], this.blocks[i+1:])
+	n := len(this.ids) - 1
+	this.ids[n], this.keys[n], this.blocks[n] = id, key, block
+}
+
+// add inserts a block, evicting the least recently used one if the window
+// is full. The data (if any) is copied.
+func (this *dedupWindow) add(id int32, key string, data []byte) {
+	var buf []byte
+
+	if len(this.ids) == this.capacity {
+		buf = this.blocks[0][:0]
+		this.ids = append(this.ids[:0], this.ids[1:]...)
+		this.keys = append(this.keys[:0], this.keys[1:]...)
+		this.blocks = append(this.blocks[:0], this.blocks[1:]...)
+	}
+
+	if data != nil {
+		buf = append(buf, data...)
+	}
+
+	this.ids = append(this.ids, id)
+	this.keys = append(this.keys, key)
+	this.blocks = append(this.blocks, buf)
+}
+
+// dedupEncoder finds the blocks of a batch identical to earlier blocks
+type dedupEncoder struct {
+	window *dedupWindow
+	hasher *blockHasher
+}
+
+func newDedupEncoder(blockSize int, blockHash *blockHasher) *dedupEncoder {
+	hashType := uint(_BLOCK_HASH_XXH3)
+
+	if blockHash.getType() == _BLOCK_HASH_BLAKE3 {
+		hashType = _BLOCK_HASH_BLAKE3
+	}
+
+	hasher, _ := newBlockHasher(hashType)
+	return &dedupEncoder{window: newDedupWindow(blockSize), hasher: hasher}
+}
+
+// match returns, for each block of the batch (IDs starting at firstID+1),
+// the ID of the identical earlier block (0 if none). The blocks are hashed
+// concurrently and the window is updated in block order.
+func (this *dedupEncoder) match(blocks [][]byte, firstID int32) []int32 {
+	keys := make([]string, len(blocks))
+	wg := sync.WaitGroup{}
+
+	for i := range blocks {
+		wg.Add(1)
+		key := &keys[i]
+		block := blocks[i]
+
+		startTask(func() {
+			defer wg.Done()
+			*key = string(this.hasher.sum(block))
+		})
+	}
+
+	wg.Wait()
+	res := make([]int32, len(blocks))
+
+	for i, key := range keys {
+		j := -1
+
+		for k := range this.window.keys {
+			if this.window.keys[k] == key {
+				j = k
+				break
+			}
+		}
+
+		if j >= 0 {
+			res[i] = this.window.ids[j]
+			this.window.touch(j)
+		} else {
+			this.window.add(firstID+int32(i)+1, key, nil)
+		}
+	}
+
+	return res
+}
+
+// batchBlocks returns the blocks of the next batch (as assigned to the
+// encoding tasks by processBlock)
+func (this *Writer) batchBlocks(nbTasks int) [][]byte {
+	res := make([][]byte, 0, nbTasks)
+	available := this.available
+
+	for taskID := 0; taskID < nbTasks; taskID++ {
+		dataLength := min(available, this.blockSize)
+
+		if this.chunker != nil {
+			dataLength = this.chunker.length(taskID)
+		}
+
+		if dataLength == 0 {
+			break
+		}
+
+		res = append(res, this.buffers[taskID].Buf[0:dataLength])
+		available -= dataLength
+	}
+
+	return res
+}
+
+// repeatRecord returns the repeat record of the block and its size in bits
+func (this *encodingTask) repeatRecord(checksum uint64) ([]byte, uint64) {
+	bufStream := internal.NewBufferStream(make([]byte, 0, 16))
+	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 1024)
+	obs.WriteBits(_DEDUP_REPEAT_MODE, 8)
+	obs.WriteBits(uint64(this.repeatOf), 32)
+
+	if this.hasher32 != nil {
+		obs.WriteBits(checksum, 32)
+	} else if this.hasher64 != nil {
+		obs.WriteBits(checksum, 64)
+	}
+
+	obs.Close()
+	return bufStream.Bytes(), obs.Written()
+}
+
+// readRepeatRecord reads the rest of a repeat record and returns the block
+// checksum (if any)
+func (this *decodingTask) readRepeatRecord(ibs kanzi.InputBitStream, res *decodingTaskResult,
+	blockOffset uint64, compressedSize int) uint64 {
+	res.repeatOf = int32(ibs.ReadBits(32))
+	checksum := uint64(0)
+	ckSize := uint(0)
+
+	if this.hasher32 != nil {
+		checksum = ibs.ReadBits(32)
+		ckSize = 32
+	} else if this.hasher64 != nil {
+		checksum = ibs.ReadBits(64)
+		ckSize = 64
+	}
+
+	res.info = BlockInfo{ID: int(this.currentBlockID), Offset: blockOffset, CompressedSize: compressedSize,
+		Transform: "NONE", Entropy: "NONE", Checksum: checksum, ChecksumSize: ckSize, RepeatOf: int(res.repeatOf)}
+	return checksum
+}
+
+// resolveRepeat provides the data of a repeat record from the window of
+// the decoded blocks and checks it against the block checksum (if any)
+func (this *Reader) resolveRepeat(r *decodingTaskResult) *IOError {
+	i := this.dedup.find(r.repeatOf)
+
+	if i < 0 || r.repeatOf >= int32(r.blockID) {
+		errMsg := fmt.Sprintf("Invalid repeat block: block %d is not available", r.repeatOf)
+		return &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK}
+	}
+
+	data := this.dedup.blocks[i]
+	this.dedup.touch(i)
+
+	if this.hasher32 != nil {
+		if checksum := this.hasher32.Hash(data); checksum != uint32(r.checksum) {
+			errMsg := fmt.Sprintf("Corrupted bitstream: expected checksum %x, found %x", r.checksum, checksum)
+			return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+		}
+	} else if this.hasher64 != nil {
+		if checksum := this.hasher64.Hash(data); checksum != r.checksum {
+			errMsg := fmt.Sprintf("Corrupted bitstream: expected checksum %x, found %x", r.checksum, checksum)
+			return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+		}
+	}
+
+	r.data = data
+	r.decoded = len(data)
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestDedup(t *testing.T) {
+	fmt.Println("Dedup Test")
+
+	// Disk image like data: zero pages, repeated pages and unique pages
+	const blockSize = 65536
+	page := make([]byte, blockSize)
+	rand.Read(page)
+	var data []byte
+
+	for i := 0; i < 40; i++ {
+		switch {
+		case i%4 == 0:
+			data = append(data, make([]byte, blockSize)...)
+		case i%4 == 1:
+			data = append(data, page...)
+		default:
+			unique := make([]byte, blockSize)
+			rand.Read(unique)
+			data = append(data, unique...)
+		}
+	}
+
+	data = append(data, page[0:1000]...)
+
+	for _, ctx := range []map[string]any{
+		{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "jobs": uint(4), "checksum": uint(32)},
+		{"transform": "NONE", "entropy": "NONE", "jobs": uint(1), "checksum": uint(64)},
+		{"transform": "LZ", "entropy": "ANS0", "jobs": uint(4), "blockHash": "BLAKE3"},
+		{"transform": "LZ", "entropy": "ANS0", "jobs": uint(2), "archival": true, "autoTune": true},
+	} {
+		ctx["blockSize"] = uint(blockSize)
+		plain := compressData(t, data, ctx)
+		ctx["dedup"] = true
+		output, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(4), "blockInfo": true})
+
+		if seg := r.Segments()[0]; seg.Dedup == false || seg.BitstreamVersion != _BITSTREAM_FORMAT_VERSION {
+			t.Errorf("Invalid segment: dedup %v, version %d", seg.Dedup, seg.BitstreamVersion)
+		}
+
+		if len(output) >= len(plain)*3/4 {
+			t.Errorf("Expected a smaller stream with dedup: %d bytes, %d without", len(output), len(plain))
+		}
+
+		if ctx["archival"] == true {
+			// Sequential decoding of the repeat records
+			dst := &memWriterAt{}
+
+			if _, err := DecompressFile(nil, &slowReaderAt{data: output}, int64(len(output)), dst); err != nil ||
+				bytes.Equal(dst.data, data) == false {
+				t.Errorf("DecompressFile failed: %v", err)
+			}
+		}
+
+		repeats := 0
+
+		for i := 0; i < r.BlockInfoCount(); i++ {
+			info, _ := r.BlockInfo(i)
+
+			if info.RepeatOf == 0 {
+				continue
+			}
+
+			repeats++
+			block := data[i*blockSize : (i+1)*blockSize]
+
+			if ref := data[(info.RepeatOf-1)*blockSize : info.RepeatOf*blockSize]; bytes.Equal(block, ref) == false {
+				t.Errorf("Block %d is not identical to block %d", info.ID, info.RepeatOf)
+			}
+		}
+
+		if repeats != 18 {
+			t.Errorf("Expected 18 repeated blocks, got %d", repeats)
+		}
+	}
+
+	// Appended blocks keep the setting of the stream
+	path := filepath.Join(t.TempDir(), "dedup.knz")
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(blockSize), "dedup": true}
+	os.WriteFile(path, compressData(t, data[0:8*blockSize], ctx), 0644)
+	f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+	defer f.Close()
+	w, err := OpenWriterForAppend(f, map[string]any{"jobs": uint(2)})
+
+	if err != nil {
+		t.Fatalf("Cannot append: %v", err)
+	}
+
+	w.Write(data[8*blockSize:])
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Cannot append: %v", err)
+	}
+
+	appended, _ := os.ReadFile(path)
+
+	if res, _, err := decompressData(appended, nil); err != nil || bytes.Equal(res, data) == false {
+		t.Errorf("Invalid appended stream: %v", err)
+	}
+
+	for _, extra := range []map[string]any{{"linkedBlocks": true}, {"cipher": "AES-GCM", "key": make([]byte, 32)}} {
+		ctx := withDefaults(map[string]any{"dedup": true})
+
+		for k, v := range extra {
+			ctx[k] = v
+		}
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+			t.Errorf("Expected an error with %v", extra)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	fmt.Println("Deterministic Test")
+
+	data := make([]byte, 300000)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(4*(i/20000+1)))
+	}
+
+	for _, codecs := range [][2]string{{"TEXT+BWT+RANK+ZRLT", "ANS0"}, {"LZX", "HUFFMAN"}, {"NONE", "NONE"}} {
+		var ref []byte
+
+		for _, jobs := range []uint{1, 2, 3, 8} {
+			ctx := map[string]any{"transform": codecs[0], "entropy": codecs[1], "blockSize": uint(32768),
+				"jobs": jobs, "checksum": uint(32), "fileSize": int64(len(data)), "deterministic": true}
+			bs := internal.NewBufferStream()
+			w, err := NewWriterWithCtx(bs, ctx)
+
+			if err != nil {
+				t.Fatalf("Cannot create writer: %v", err)
+			}
+
+			// Uneven writes
+			for off := 0; off < len(data); off += 10007 {
+				if _, err = w.Write(data[off:min(off+10007, len(data))]); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			if ref == nil {
+				ref = bs.Bytes()
+				fmt.Printf("%s&%s: %d => %d\n", codecs[0], codecs[1], len(data), len(ref))
+			} else if bytes.Equal(ref, bs.Bytes()) == false {
+				t.Errorf("%s&%s: output with %d jobs differs from output with 1 job", codecs[0], codecs[1], jobs)
+			}
+		}
+	}
+
+	// The automatic flush depends on the timing
+	ctx := map[string]any{"transform": "LZ", "entropy": "NONE", "blockSize": uint(32768), "jobs": uint(1),
+		"checksum": uint(0), "deterministic": true, "flushInterval": time.Second}
+
+	if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+		t.Errorf("A flush interval should be rejected in deterministic mode")
+	}
+}
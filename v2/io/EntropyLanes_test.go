@@ -0,0 +1,75 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropyLanes(t *testing.T) {
+	fmt.Println("Entropy Lanes Test")
+
+	// One large block coded by several jobs
+	data := make([]byte, 2500000)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(4+(i>>18)))
+	}
+
+	var ref []byte
+
+	for _, jobs := range []uint{1, 4} {
+		ctx := map[string]any{"transform": "NONE", "entropy": "ANS0", "blockSize": uint(4 << 20),
+			"jobs": jobs, "checksum": uint(32), "entropyLanes": uint(4)}
+		output := compressData(t, data, ctx)
+
+		if ref == nil {
+			ref = output
+			fmt.Printf("ANS0, 4 lanes: %d => %d\n", len(data), len(ref))
+		} else if bytes.Equal(ref, output) == false {
+			t.Errorf("Output with %d jobs differs from output with 1 job", jobs)
+		}
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		res, r, err := decompressData(ref, map[string]any{"jobs": jobs})
+
+		if err != nil || bytes.Equal(res, data) == false {
+			t.Fatalf("Jobs %d: decompression failed: %v", jobs, err)
+		}
+
+		if r.Segments()[0].EntropyLanes == false {
+			t.Errorf("Missing entropy lanes flag")
+		}
+	}
+
+	// Several blocks, encrypted
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS1", "blockSize": uint(1 << 20), "jobs": uint(4),
+		"checksum": uint(64), "entropyLanes": uint(16), "cipher": "AES-GCM", "key": make([]byte, 32)}
+	roundTrip(t, data, ctx, map[string]any{"jobs": uint(4), "key": make([]byte, 32)})
+
+	for _, lanes := range []any{uint(1), uint(17), 4} {
+		ctx := map[string]any{"entropy": "ANS0", "entropyLanes": lanes}
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), withDefaults(ctx)); err == nil {
+			t.Errorf("Invalid number of entropy lanes accepted: %v", lanes)
+		}
+	}
+}
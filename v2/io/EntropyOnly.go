@@ -0,0 +1,38 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Entropy-only mode: when the transform of a block is NONE, the tasks do
+// not run the transform pipeline. The encoder feeds the input buffer
+// directly to the entropy coder (which writes to the output buffer) and
+// the decoder swaps the task buffers after entropy decoding instead of
+// copying the block. The bitstream is the same as with a NONE transform
+// sequence: the skip flags of the block say that all transforms were
+// skipped.
+
+const (
+	_ENTROPY_ONLY_SKIP_FLAGS = 0x7F // skip flags of a NONE transform sequence
+)
+
+// isEntropyOnly returns true if the blocks with the provided transform
+// type are only entropy coded
+func isEntropyOnly(transformType uint64) bool {
+	return transformType == transform.NONE_TYPE
+}
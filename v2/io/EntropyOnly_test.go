@@ -0,0 +1,68 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropyOnly(t *testing.T) {
+	fmt.Println("Entropy Only Test")
+
+	// Skewed text followed by random (incompressible) data
+	rnd := rand.New(rand.NewSource(12345))
+	data := make([]byte, 300000)
+
+	for i := 0; i < 250000; i++ {
+		data[i] = byte(97 + rnd.Intn(4+i/20000))
+	}
+
+	rnd.Read(data[250000:])
+
+	// Digests of the streams produced with the transform pipeline: the
+	// bitstream must not change
+	digests := map[string]uint32{
+		"HUFFMAN": 0x5dce0886,
+		"ANS0":    0x4faaef2f,
+		"ANS1":    0xc62be5ea,
+		"RANGE":   0xfd5e7533,
+		"FPAQ":    0xc3c4837c,
+		"CM":      0xf49140bc,
+		"TPAQ":    0x95180334,
+		"NONE":    0xf4f6a789,
+	}
+
+	for _, name := range []string{"HUFFMAN", "ANS0", "ANS1", "RANGE", "FPAQ", "CM", "TPAQ", "NONE"} {
+		ctx := map[string]any{"transform": "NONE", "entropy": name, "blockSize": uint(65536),
+			"jobs": uint(2), "checksum": uint(32)}
+		output, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "blockInfo": true})
+		digest := crc32.ChecksumIEEE(output)
+		fmt.Printf("%-8s: %d => %d bytes, digest %08x\n", name, len(data), len(output), digest)
+
+		if digest != digests[name] {
+			t.Errorf("%s: bitstream changed, digest %08x, expected %08x", name, digest, digests[name])
+		}
+
+		for i := 0; i < r.BlockInfoCount(); i++ {
+			if info, _ := r.BlockInfo(i); info.Copied == false && info.SkipFlags != _ENTROPY_ONLY_SKIP_FLAGS {
+				t.Errorf("%s: block %d: invalid skip flags %.8b", name, i, info.SkipFlags)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Sentinel errors, one per error code. Any IOError (or DecodingError,
+// MemoryLimitError, OutputLimitError) matches the sentinel of its code with errors.Is:
+//
+//	if errors.Is(err, io.ErrStreamVersion) { ... }
+var (
+	ErrMissingParam       = &IOError{msg: "Missing parameter", code: kanzi.ERR_MISSING_PARAM}
+	ErrBlockSize          = &IOError{msg: "Invalid block size", code: kanzi.ERR_BLOCK_SIZE}
+	ErrInvalidCodec       = &IOError{msg: "Invalid codec", code: kanzi.ERR_INVALID_CODEC}
+	ErrCreateCompressor   = &IOError{msg: "Cannot create compressor", code: kanzi.ERR_CREATE_COMPRESSOR}
+	ErrCreateDecompressor = &IOError{msg: "Cannot create decompressor", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	ErrOutputIsDir        = &IOError{msg: "Output is a directory", code: kanzi.ERR_OUTPUT_IS_DIR}
+	ErrOverwriteFile      = &IOError{msg: "File already exists", code: kanzi.ERR_OVERWRITE_FILE}
+	ErrCreateFile         = &IOError{msg: "Cannot create file", code: kanzi.ERR_CREATE_FILE}
+	ErrCreateBitstream    = &IOError{msg: "Cannot create bitstream", code: kanzi.ERR_CREATE_BITSTREAM}
+	ErrOpenFile           = &IOError{msg: "Cannot open file", code: kanzi.ERR_OPEN_FILE}
+	ErrReadFile           = &IOError{msg: "Cannot read input", code: kanzi.ERR_READ_FILE}
+	ErrWriteFile          = &IOError{msg: "Cannot write output", code: kanzi.ERR_WRITE_FILE}
+	ErrBlockCorrupted     = &IOError{msg: "Corrupted block", code: kanzi.ERR_PROCESS_BLOCK}
+	ErrCreateCodec        = &IOError{msg: "Cannot create codec", code: kanzi.ERR_CREATE_CODEC}
+	ErrInvalidFile        = &IOError{msg: "Invalid file", code: kanzi.ERR_INVALID_FILE}
+	ErrStreamVersion      = &IOError{msg: "Unsupported stream version", code: kanzi.ERR_STREAM_VERSION}
+	ErrCreateStream       = &IOError{msg: "Cannot create stream", code: kanzi.ERR_CREATE_STREAM}
+	ErrInvalidParam       = &IOError{msg: "Invalid parameter", code: kanzi.ERR_INVALID_PARAM}
+	ErrChecksum           = &IOError{msg: "Checksum mismatch", code: kanzi.ERR_CRC_CHECK}
+	ErrMemoryLimit        = &IOError{msg: "Memory limit exceeded", code: kanzi.ERR_MEMORY_LIMIT}
+	ErrOutputLimit        = &IOError{msg: "Output size limit exceeded", code: kanzi.ERR_OUTPUT_LIMIT}
+	ErrUnknown            = &IOError{msg: "Unknown error", code: kanzi.ERR_UNKNOWN}
+)
+
+// Is returns true if target is an IOError with the same error code
+func (this IOError) Is(target error) bool {
+	switch t := target.(type) {
+	case *IOError:
+		return t != nil && t.code == this.code
+	case IOError:
+		return t.code == this.code
+	}
+
+	return false
+}
+
+// Unwrap returns the underlying error (EG. the error of the output stream)
+// or nil
+func (this IOError) Unwrap() error {
+	return this.cause
+}
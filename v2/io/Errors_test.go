@@ -0,0 +1,80 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"testing"
+)
+
+type failingWriter struct {
+	err error
+}
+
+func (this failingWriter) Write(b []byte) (int, error) {
+	return 0, this.err
+}
+
+func (this failingWriter) Close() error {
+	return nil
+}
+
+func TestSentinelErrors(t *testing.T) {
+	fmt.Println("Sentinel Errors Test")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 2000)
+
+	// Invalid parameter
+	_, err := NewWriter(internal.NewBufferStream(), "LZ", "HUFFMAN", 1000, 1, 0, 0, false)
+
+	if errors.Is(err, ErrInvalidParam) == false || errors.Is(err, ErrBlockSize) == true {
+		t.Errorf("Expected invalid parameter error, got %v", err)
+	}
+
+	// Unsupported version
+	input := compressData(t, text, map[string]any{"transform": "LZ", "entropy": "HUFFMAN",
+		"blockSize": uint(16384), "checksum": uint(32)})
+	version := input[4] & 0xF0
+	input[4] |= 0xF0
+	_, _, err = decompressData(input, nil)
+
+	if errors.Is(err, ErrStreamVersion) == false {
+		t.Errorf("Expected stream version error, got %v", err)
+	}
+
+	// Corrupted block (DecodingError in strict mode)
+	input[4] &= 0x0F
+	input[4] |= version
+	input[len(input)/2] ^= 0xFF
+	_, _, err = decompressData(input, map[string]any{"strict": true})
+	var decErr *DecodingError
+
+	if errors.As(err, &decErr) == false || (errors.Is(err, ErrBlockCorrupted) == false && errors.Is(err, ErrChecksum) == false) {
+		t.Errorf("Expected corrupted block error, got %v", err)
+	}
+
+	// The error of the output stream is wrapped
+	failure := errors.New("disk full")
+	w, _ := NewWriter(failingWriter{err: failure}, "LZ", "HUFFMAN", 16384, 1, 0, 0, false)
+	w.Write(text[0:1000])
+
+	if err = w.Flush(); errors.Is(err, ErrWriteFile) == false || errors.Is(err, failure) == false {
+		t.Errorf("Expected wrapped write error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+const (
+	_ESTIMATE_DEFAULT_BLOCK_SIZE = 4 * 1024 * 1024
+	_ESTIMATE_NB_SAMPLES         = 8
+	_ESTIMATE_MAX_SAMPLE_SIZE    = 1024 * 1024
+)
+
+// EstimateCompressedSize predicts the size of src once compressed with the
+// parameters in ctx (same keys as NewWriterWithCtx, the missing ones get
+// default values) without producing any output.
+// Small inputs are compressed entirely (exact result). Otherwise, a few
+// samples evenly spread over the input are compressed and the result is
+// extrapolated, which is accurate for data with homogeneous statistics.
+func EstimateCompressedSize(src []byte, ctx map[string]any) (int64, error) {
+	params := withDefaults(ctx)
+
+	// The output is discarded: no need to flush or collect anything
+	delete(params, "manifest")
+	delete(params, "flushInterval")
+	delete(params, "onBlock")
+	params["fileSize"] = int64(len(src))
+	blockSize := int(params["blockSize"].(uint))
+	sampleSize := min(blockSize, _ESTIMATE_MAX_SAMPLE_SIZE)
+
+	if len(src) <= _ESTIMATE_NB_SAMPLES*sampleSize {
+		return compressedSize(src, params)
+	}
+
+	// Fixed cost of a stream (header and end block)
+	overhead, err := compressedSize(nil, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	params["fileSize"] = int64(sampleSize)
+	gap := (len(src) - sampleSize) / (_ESTIMATE_NB_SAMPLES - 1)
+	sampled := int64(0)
+
+	for i := 0; i < _ESTIMATE_NB_SAMPLES; i++ {
+		start := i * gap
+		n, err := compressedSize(src[start:start+sampleSize], params)
+
+		if err != nil {
+			return 0, err
+		}
+
+		sampled += n - overhead
+	}
+
+	// Extrapolate to the whole input
+	total := int64(len(src))
+	return overhead + (sampled*total+int64(_ESTIMATE_NB_SAMPLES*sampleSize)/2)/int64(_ESTIMATE_NB_SAMPLES*sampleSize), nil
+}
+
+// withDefaults returns a copy of ctx with default values for the missing
+// Writer parameters
+func withDefaults(ctx map[string]any) map[string]any {
+	params := make(map[string]any, len(ctx)+5)
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	defaults := map[string]any{
+		"entropy":   "NONE",
+		"transform": "NONE",
+		"blockSize": uint(_ESTIMATE_DEFAULT_BLOCK_SIZE),
+		"jobs":      uint(1),
+		"checksum":  uint(0),
+	}
+
+	for k, v := range defaults {
+		if _, hasKey := params[k]; hasKey == false {
+			params[k] = v
+		}
+	}
+
+	return params
+}
+
+// compressedSize returns the size of the stream obtained by compressing src
+func compressedSize(src []byte, ctx map[string]any) (int64, error) {
+	os, _ := NewNullOutputStream()
+	params := make(map[string]any, len(ctx))
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	w, err := NewWriterWithCtx(os, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = w.Write(src); err != nil {
+		return 0, err
+	}
+
+	if err = w.Close(); err != nil {
+		return 0, err
+	}
+
+	return int64(w.GetWritten()), nil
+}
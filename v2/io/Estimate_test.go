@@ -0,0 +1,83 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEstimateCompressedSize(t *testing.T) {
+	fmt.Println("Estimate Compressed Size Test")
+	words := []string{"the ", "quick ", "brown ", "fox ", "jumps ", "over ", "lazy ", "dog ", "\n"}
+	var sb strings.Builder
+
+	for sb.Len() < 20000000 {
+		sb.WriteString(words[rand.Intn(len(words))])
+	}
+
+	values := []byte(sb.String())
+
+	for _, test := range [][2]string{{"NONE", "HUFFMAN"}, {"LZ", "ANS0"}, {"BWT+SRT+ZRLT", "ANS0"}} {
+		ctx := map[string]any{
+			"transform": test[0],
+			"entropy":   test[1],
+			"blockSize": uint(1 << 20),
+			"jobs":      uint(4),
+			"checksum":  uint(0),
+		}
+
+		// Small input: exact size
+		estimate, err := EstimateCompressedSize(values[0:100000], ctx)
+
+		if err != nil {
+			t.Fatalf("Estimate failed: %v", err)
+		}
+
+		if actual := int64(compressedLength(t, values[0:100000], ctx)); estimate != actual {
+			t.Errorf("%s+%s: expected exact estimate %d, got %d", test[0], test[1], actual, estimate)
+		}
+
+		estimate, err = EstimateCompressedSize(values, ctx)
+
+		if err != nil {
+			t.Fatalf("Estimate failed: %v", err)
+		}
+
+		actual := int64(compressedLength(t, values, ctx))
+		fmt.Printf("%s+%s: estimate %d, actual %d\n", test[0], test[1], estimate, actual)
+
+		if estimate < actual*95/100 || estimate > actual*105/100 {
+			t.Errorf("%s+%s: estimate %d too far from actual size %d", test[0], test[1], estimate, actual)
+		}
+	}
+
+	if _, err := EstimateCompressedSize(values, map[string]any{"transform": "UNKNOWN"}); err == nil {
+		t.Errorf("Expected error on invalid transform")
+	}
+}
+
+func compressedLength(t *testing.T, data []byte, ctx map[string]any) int {
+	params := map[string]any{"fileSize": int64(len(data))}
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	return len(compressData(t, data, params))
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	fmt.Println("Flush Test")
+	values := make([]byte, 300000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + 65)
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		bs := internal.NewBufferStream()
+		w, err := NewWriter(bs, "LZ", "HUFFMAN", 65536, jobs, 32, 0, false)
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		written := 0
+
+		// Flush after chunks of various sizes (partial and multiple blocks)
+		for _, n := range []int{10, 1000, 70000, 1, 150000, 5000} {
+			if _, err = w.Write(values[written : written+n]); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			written += n
+
+			if err = w.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			// All the data written so far must be decodable from the flushed bytes
+			flushed := make([]byte, bs.Len())
+			copy(flushed, bs.Bytes())
+			r, err := NewReader(internal.NewBufferStream(flushed), 1)
+
+			if err != nil {
+				t.Fatalf("Cannot create reader: %v", err)
+			}
+
+			res := make([]byte, written)
+
+			if _, err = io.ReadFull(r, res); err != nil {
+				t.Fatalf("Read after flush failed (%d bytes written): %v", written, err)
+			}
+
+			if !bytes.Equal(res, values[0:written]) {
+				t.Fatalf("Incorrect data after flush (%d bytes written)", written)
+			}
+		}
+
+		if _, err = w.Write(values[written:]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if err = w.Flush(); err == nil {
+			t.Errorf("Expected error on flush after close")
+		}
+
+		r, err := NewReader(bs, jobs)
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if !bytes.Equal(res, values) {
+			t.Errorf("Roundtrip failed with %d jobs", jobs)
+		}
+	}
+}
+
+// lockedBuffer is a WriteCloser safe to read while the writer flushes
+// from the timer goroutine.
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (this *lockedBuffer) Write(b []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.buf.Write(b)
+}
+
+func (this *lockedBuffer) Close() error {
+	return nil
+}
+
+func (this *lockedBuffer) snapshot() []byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return bytes.Clone(this.buf.Bytes())
+}
+
+func TestFlushInterval(t *testing.T) {
+	fmt.Println("Flush Interval Test")
+	values := make([]byte, 5000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + 65)
+	}
+
+	ctx := map[string]any{
+		"entropy":       "HUFFMAN",
+		"transform":     "LZ",
+		"blockSize":     uint(65536),
+		"jobs":          uint(1),
+		"checksum":      uint(32),
+		"flushInterval": 20 * time.Millisecond,
+	}
+
+	if _SINGLE_THREAD == true {
+		if _, err := NewWriterWithCtx(&lockedBuffer{}, ctx); err == nil {
+			t.Errorf("Expected the flush interval to be rejected in single thread builds")
+		}
+
+		return
+	}
+
+	lb := &lockedBuffer{}
+	w, err := NewWriterWithCtx(lb, ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	// Trickle data: each chunk must become decodable without any call to Flush
+	for written := 1000; written <= len(values); written += 1000 {
+		if _, err = w.Write(values[written-1000 : written]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		res := make([]byte, written)
+
+		for {
+			r, err := NewReader(internal.NewBufferStream(lb.snapshot()), 1)
+
+			if err == nil {
+				if _, err = io.ReadFull(r, res); err == nil {
+					break
+				}
+			}
+
+			if time.Now().After(deadline) {
+				t.Fatalf("Data not flushed after %d bytes written", written)
+			}
+
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		if !bytes.Equal(res, values[0:written]) {
+			t.Fatalf("Incorrect data after automatic flush (%d bytes written)", written)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	r, _ := NewReader(internal.NewBufferStream(lb.snapshot()), 1)
+	res, err := io.ReadAll(r)
+
+	if err != nil || !bytes.Equal(res, values) {
+		t.Errorf("Incorrect data after close: %v", err)
+	}
+
+	ctx["flushInterval"] = -time.Second
+
+	if _, err = NewWriterWithCtx(&lockedBuffer{}, ctx); err == nil {
+		t.Errorf("Expected error on negative flush interval")
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+// Stream footer (ctx["footer"] = true): the end block is followed by
+// (big endian, byte aligned):
+//
+//	type "KFTR" (4) | original size (8) | XXH64 of the original data (8)
+//
+// The footer is the last 20 bytes of the stream. It catches truncated or
+// reordered blocks (which the block checksums cannot detect) and provides
+// the original size when it was not known at compression time.
+// A Reader reads the footer when it reaches the end of the stream. With
+// ctx["footer"] = true, it also hashes the decoded data and checks the footer.
+
+const (
+	_FOOTER_TYPE = 0x4B465452 // "KFTR"
+	_FOOTER_SIZE = 20
+)
+
+// footerDigest tracks the size and the hash of the original data of a stream
+type footerDigest struct {
+	hasher *hash.XXHash64Stream // nil if the data is not hashed
+	size   int64
+}
+
+func newFooterDigest(hashed bool) (*footerDigest, error) {
+	res := &footerDigest{}
+
+	if hashed == true {
+		var err error
+
+		if res.hasher, err = hash.NewXXHash64Stream(_BITSTREAM_TYPE); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (this *footerDigest) update(data []byte) {
+	this.size += int64(len(data))
+
+	if this.hasher != nil {
+		this.hasher.Write(data)
+	}
+}
+
+func (this *footerDigest) reset() {
+	this.size = 0
+
+	if this.hasher != nil {
+		this.hasher.Reset()
+	}
+}
+
+// streamFooter a parsed footer
+type streamFooter struct {
+	size int64
+	hash uint64
+}
+
+func decodeFooter(buf []byte) (streamFooter, bool) {
+	if len(buf) < _FOOTER_SIZE || binary.BigEndian.Uint32(buf) != _FOOTER_TYPE {
+		return streamFooter{}, false
+	}
+
+	return streamFooter{size: int64(binary.BigEndian.Uint64(buf[4:])),
+		hash: binary.BigEndian.Uint64(buf[12:])}, true
+}
+
+// writeFooter writes the footer after the end block
+func (this *Writer) writeFooter() {
+	if pad := uint(8-(this.obs.Written()&7)) & 7; pad != 0 {
+		this.obs.WriteBits(0, pad)
+	}
+
+	this.obs.WriteBits(_FOOTER_TYPE, 32)
+	this.obs.WriteBits(uint64(this.footer.size), 64)
+	this.obs.WriteBits(this.footer.hasher.Sum64(), 64)
+}
+
+// readFooter reads the footer following the end block (the type has
+// already been read) and checks it if required.
+func (this *Reader) readFooter() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid stream footer: truncated data", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	size := int64(this.ibs.ReadBits(64))
+	hash := this.ibs.ReadBits(64)
+	this.streamFooter = &streamFooter{size: size, hash: hash}
+
+	// The data of the skipped blocks is missing (best effort mode)
+	if this.footer.hasher != nil && this.damaged == 0 {
+		return this.VerifyFooter()
+	}
+
+	return nil
+}
+
+// ExpectedSize returns the original size of the stream and true if it is
+// known before decoding: provided in the header at compression time or
+// stored in the footer. The footer is looked up at the end of the input
+// if it implements io.Seeker, which assumes that the input contains one
+// stream only (no chained streams).
+func (this *Reader) ExpectedSize() (int64, bool) {
+	if this.streamFooter != nil {
+		return this.streamFooter.size, true
+	}
+
+	if err := this.readHeader(); err != nil {
+		return 0, false
+	}
+
+	if this.outputSize > 0 {
+		return this.outputSize, true
+	}
+
+	seeker, ok := this.source.(io.ReadSeeker)
+
+	if ok == false || len(this.segments) > 1 {
+		return 0, false
+	}
+
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return 0, false
+	}
+
+	defer seeker.Seek(pos, io.SeekStart)
+
+	if _, err = seeker.Seek(-_FOOTER_SIZE, io.SeekEnd); err != nil {
+		return 0, false
+	}
+
+	buf := make([]byte, _FOOTER_SIZE)
+
+	if _, err = io.ReadFull(seeker, buf); err != nil {
+		return 0, false
+	}
+
+	if f, ok := decodeFooter(buf); ok == true && f.size >= 0 {
+		return f.size, true
+	}
+
+	return 0, false
+}
+
+// VerifyFooter checks the size of the data decoded from the stream (the
+// last one for chained streams) against the footer. The hash is also
+// checked if the Reader was created with ctx["footer"] = true.
+// Fails if the stream has not been fully read or has no footer.
+func (this *Reader) VerifyFooter() error {
+	if this.streamFooter == nil {
+		return &IOError{msg: "Footer verification failed: no footer read", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	if this.streamFooter.size != this.footer.size {
+		errMsg := fmt.Sprintf("Footer verification failed: size mismatch (expected %d, got %d)",
+			this.streamFooter.size, this.footer.size)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	if this.footer.hasher != nil && this.footer.hasher.Sum64() != this.streamFooter.hash {
+		return &IOError{msg: "Footer verification failed: hash mismatch", code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+type seekableStream struct {
+	*bytes.Reader
+}
+
+func (this seekableStream) Close() error {
+	return nil
+}
+
+func TestFooter(t *testing.T) {
+	fmt.Println("Footer Test")
+	data := []byte(strings.Repeat("The footer carries the size and the hash of the data. ", 20000))
+
+	for i := 0; i < len(data); i += 4999 {
+		data[i] = byte(rand.Intn(256))
+	}
+
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536),
+		"jobs": uint(4), "checksum": uint(0), "footer": true})
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	// Uneven writes to exercise the incremental hash
+	for off, n := 0, 1; off < len(data); n = n*3 + 1 {
+		n = min(n, len(data)-off)
+
+		if _, err = w.Write(data[off : off+n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		off += n
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	output := bs.Bytes()
+	f, ok := decodeFooter(output[len(output)-_FOOTER_SIZE:])
+	hasher, _ := hash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if ok == false || f.size != int64(len(data)) || f.hash != hasher.Hash(data) {
+		t.Fatalf("Invalid footer: %+v", f)
+	}
+
+	for _, check := range []bool{true, false} {
+		r, err := NewReaderWithCtx(seekableStream{bytes.NewReader(output)}, map[string]any{"jobs": uint(2), "footer": check})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		if size, ok := r.ExpectedSize(); ok == false || size != int64(len(data)) {
+			t.Errorf("Unexpected size: %d, %v", size, ok)
+		}
+
+		if err = r.VerifyFooter(); err == nil {
+			t.Errorf("Footer verification should fail before the end of the stream")
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Decompression failed (footer=%v): %v", check, err)
+		}
+
+		if bytes.Equal(res, data) == false {
+			t.Errorf("Roundtrip failed (footer=%v)", check)
+		}
+
+		if err = r.VerifyFooter(); err != nil {
+			t.Errorf("Footer verification failed (footer=%v): %v", check, err)
+		}
+
+		r.Close()
+	}
+
+	decompress := func(input []byte) error {
+		_, _, err := decompressData(input, map[string]any{"jobs": uint(2), "footer": true})
+		return err
+	}
+
+	// Tampered hash and missing footer
+	tampered := append([]byte(nil), output...)
+	tampered[len(tampered)-1] ^= 0x01
+
+	if err = decompress(tampered); err == nil {
+		t.Errorf("Tampered footer not detected")
+	}
+
+	if err = decompress(output[0 : len(output)-_FOOTER_SIZE]); err == nil {
+		t.Errorf("Missing footer not detected")
+	}
+
+	_, err = NewWriterWithCtx(internal.NewBufferStream(), map[string]any{"transform": "NONE", "entropy": "NONE",
+		"blockSize": uint(65536), "jobs": uint(1), "checksum": uint(0), "footer": true, "archival": true})
+
+	if err == nil {
+		t.Errorf("The footer should not be accepted in archival mode")
+	}
+}
@@ -0,0 +1,77 @@
+//go:build kanzi_fuzz
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Exercise the pipeline plumbing (expansion, skip flags, buffer growth)
+// with the development only FUZZ transform.
+func TestFuzzTransformPipeline(t *testing.T) {
+	fmt.Println("Fuzz Transform Pipeline Test")
+	input := make([]byte, 300000)
+
+	for i := range input {
+		input[i] = byte(rand.Intn(16) + 'a')
+	}
+
+	transforms := []string{"FUZZ", "FUZZ+FUZZ", "LZ+FUZZ", "FUZZ+BWT+SRT+ZRLT", "TEXT+FUZZ+RLT"}
+	entropies := []string{"NONE", "HUFFMAN", "ANS0"}
+
+	for _, tr := range transforms {
+		for i, blockSize := range []uint{1024, 16384, 1 << 20} {
+			for seed := uint(0); seed < 4; seed++ {
+				ctx := map[string]any{"transform": tr, "entropy": entropies[(i+int(seed))%len(entropies)],
+					"blockSize": blockSize, "jobs": uint(1 + seed), "checksum": uint(32),
+					"fuzzSeed": seed, "bufferFloor": uint(1024), "bufferMargin": uint(12)}
+				bs := internal.NewBufferStream()
+				w, err := NewWriterWithCtx(bs, ctx)
+
+				if err != nil {
+					t.Fatalf("%s: cannot create writer: %v", tr, err)
+				}
+
+				if _, err = w.Write(input); err != nil {
+					t.Fatalf("%s: write failed: %v", tr, err)
+				}
+
+				if err = w.Close(); err != nil {
+					t.Fatalf("%s: close failed: %v", tr, err)
+				}
+
+				r, _ := NewReaderWithCtx(bs, map[string]any{"jobs": uint(2), "fuzzSeed": seed})
+				res, err := io.ReadAll(r)
+
+				if err != nil {
+					t.Fatalf("%s (block size %d, seed %d): read failed: %v", tr, blockSize, seed, err)
+				}
+
+				if bytes.Equal(input, res) == false {
+					t.Fatalf("%s (block size %d, seed %d): round trip failed", tr, blockSize, seed)
+				}
+			}
+		}
+	}
+}
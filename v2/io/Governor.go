@@ -0,0 +1,134 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Speed governor (ctx["minSpeedMBps"] = float64): the encoding speed of
+// each block (MB/s per job) is measured and, when it drops below the
+// target, the next blocks use faster codecs: first a faster entropy codec,
+// then no BWT and finally no compression at all. The codecs of the stream
+// are used again after a run of blocks encoded well above the target. The
+// codecs of each block are stored in the block header (like in auto-tune
+// mode), so the output depends on the timing.
+
+const (
+	_GOVERNOR_UPGRADE_RATIO = 2 // speed ratio above the target to consider faster codecs unnecessary
+	_GOVERNOR_PROBE_BLOCKS  = 8 // fast blocks before trying slower codecs again
+)
+
+type governorLevel struct {
+	transformType uint64
+	entropyType   uint32
+}
+
+type speedGovernor struct {
+	lock     sync.Mutex
+	minSpeed float64 // bytes per second
+	levels   []governorLevel
+	level    int
+	fast     int // consecutive blocks encoded well above the target speed
+}
+
+// newSpeedGovernor creates a governor degrading the provided codecs
+func newSpeedGovernor(minSpeedMBps float64, tType uint64, eType uint32) *speedGovernor {
+	this := &speedGovernor{minSpeed: minSpeedMBps * (1 << 20)}
+	this.addLevel(tType, eType)
+
+	// Faster entropy codec
+	switch eType {
+	case entropy.TPAQ_TYPE, entropy.TPAQX_TYPE, entropy.CM_TYPE, entropy.FPAQ_TYPE:
+		eType = entropy.ANS0_TYPE
+	}
+
+	this.addLevel(tType, eType)
+
+	// No BWT (and no post BWT transform): use LZ instead
+	if name, err := transform.GetName(tType); err == nil {
+		tokens := make([]string, 0, 8)
+		removed := false
+
+		for _, t := range strings.Split(name, "+") {
+			switch t {
+			case "BWT", "BWTS", "SRT", "RANK", "MTFT", "ZRLT":
+				removed = true
+			default:
+				tokens = append(tokens, t)
+			}
+		}
+
+		if removed == true {
+			tokens = append(tokens, "LZ")
+
+			if t, err := transform.GetType(strings.Join(tokens, "+")); err == nil {
+				this.addLevel(t, eType)
+			}
+		}
+	}
+
+	this.addLevel(transform.NONE_TYPE, entropy.NONE_TYPE)
+	return this
+}
+
+func (this *speedGovernor) addLevel(tType uint64, eType uint32) {
+	if n := len(this.levels); n > 0 && this.levels[n-1].transformType == tType && this.levels[n-1].entropyType == eType {
+		return
+	}
+
+	this.levels = append(this.levels, governorLevel{transformType: tType, entropyType: eType})
+}
+
+// codecs returns the level and the codecs to use for the next block
+func (this *speedGovernor) codecs() (int, uint64, uint32) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	l := this.levels[this.level]
+	return this.level, l.transformType, l.entropyType
+}
+
+// update adjusts the level based on the time spent to encode a block at
+// the provided level (results of blocks started before a change ignored)
+func (this *speedGovernor) update(level int, length uint, elapsed time.Duration) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if level != this.level {
+		return
+	}
+
+	speed := float64(length) / max(elapsed.Seconds(), 1e-9)
+
+	if speed < this.minSpeed {
+		this.level = min(this.level+1, len(this.levels)-1)
+		this.fast = 0
+	} else if speed >= _GOVERNOR_UPGRADE_RATIO*this.minSpeed {
+		this.fast++
+
+		if this.fast >= _GOVERNOR_PROBE_BLOCKS && this.level > 0 {
+			this.level--
+			this.fast = 0
+		}
+	} else {
+		this.fast = 0
+	}
+}
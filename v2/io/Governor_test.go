@@ -0,0 +1,77 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"testing"
+)
+
+func TestSpeedGovernor(t *testing.T) {
+	fmt.Println("Speed Governor Test")
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 25000)[0 : 16*65536]
+
+	// An unreachable target degrades the codecs at each block, a tiny one never
+	for _, minSpeed := range []float64{1e9, 1e-6} {
+		ctx := map[string]any{"transform": "TEXT+BWT+RANK+ZRLT", "entropy": "TPAQ", "blockSize": uint(65536),
+			"jobs": uint(1), "checksum": uint(32), "minSpeedMBps": minSpeed}
+		output, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "blockInfo": true})
+		codecs := make([]string, r.BlockInfoCount())
+
+		for i := range codecs {
+			info, _ := r.BlockInfo(i)
+			codecs[i] = info.Transform + "&" + info.Entropy
+		}
+
+		fmt.Printf("Min speed %v MB/s: %d => %d, %v\n", minSpeed, len(data), len(output), codecs[0:5])
+
+		if codecs[0] != "TEXT+BWT+RANK+ZRLT&TPAQ" {
+			t.Errorf("Incorrect codecs of the first block: %s", codecs[0])
+		}
+
+		if minSpeed > 1 {
+			expected := []string{"TEXT+BWT+RANK+ZRLT&ANS0", "TEXT+LZ&ANS0", "NONE&NONE"}
+
+			for i := range expected {
+				if codecs[i+1] != expected[i] {
+					t.Errorf("Incorrect codecs of block %d: %s, expected %s", i+2, codecs[i+1], expected[i])
+				}
+			}
+		} else {
+			for i := range codecs {
+				if codecs[i] != codecs[0] {
+					t.Errorf("Unexpected codecs for block %d: %s", i+1, codecs[i])
+				}
+			}
+		}
+	}
+
+	// Invalid parameters
+	for _, opts := range []map[string]any{{"minSpeedMBps": 10}, {"minSpeedMBps": 10.0, "autoTune": true},
+		{"minSpeedMBps": 10.0, "deterministic": true}} {
+		ctx := map[string]any{"transform": "LZ", "entropy": "NONE", "blockSize": uint(65536), "jobs": uint(1), "checksum": uint(0)}
+
+		for k, v := range opts {
+			ctx[k] = v
+		}
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+			t.Errorf("Expected error with %v", opts)
+		}
+	}
+}
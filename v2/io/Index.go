@@ -0,0 +1,360 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	kanzihash "github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Index sidecar (ctx["index"] = true): the Writer records the position of
+// each block in the compressed stream and Writer.Index returns, once the
+// stream is closed, an index to store next to it (EG. as a .kzi file). The
+// blocks are byte aligned. Format (big endian):
+//
+//	type "KIDX" (4) | version (1) | header size (2) | copy of the stream header
+//	original size (8) | number of blocks (4)
+//	index: offset (8), length (4), original size (4) per block
+//	XXH64 of the above (8)
+//
+// Offsets are relative to the start of the stream and cover the whole
+// block records. A RangeReader uses the index to read any range of the
+// original data by fetching only the blocks that contain it, EG. with HTTP
+// range requests to an object storage. The index requires a stream header
+// and is not compatible with linked blocks nor deduplication (each block
+// must be decodable on its own).
+
+const (
+	_INDEX_TYPE    = 0x4B494458 // "KIDX"
+	_INDEX_VERSION = 1
+)
+
+// indexBuilder collects the records emitted by the encoding tasks (in order)
+type indexBuilder struct {
+	lock   sync.Mutex
+	blocks []archiveBlock
+}
+
+func (this *indexBuilder) add(offset uint64, length uint32, size int) {
+	this.lock.Lock()
+	this.blocks = append(this.blocks, archiveBlock{offset: offset, length: length, size: uint32(size)})
+	this.lock.Unlock()
+}
+
+// build returns the index of a stream with the provided header
+func (this *indexBuilder) build(header []byte) ([]byte, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	size := uint64(0)
+
+	for _, b := range this.blocks {
+		size += uint64(b.size)
+	}
+
+	res := binary.BigEndian.AppendUint32(nil, _INDEX_TYPE)
+	res = append(res, _INDEX_VERSION)
+	res = binary.BigEndian.AppendUint16(res, uint16(len(header)))
+	res = append(res, header...)
+	res = binary.BigEndian.AppendUint64(res, size)
+	res = binary.BigEndian.AppendUint32(res, uint32(len(this.blocks)))
+
+	for _, b := range this.blocks {
+		res = binary.BigEndian.AppendUint64(res, b.offset)
+		res = binary.BigEndian.AppendUint32(res, b.length)
+		res = binary.BigEndian.AppendUint32(res, b.size)
+	}
+
+	hasher, err := kanzihash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return binary.BigEndian.AppendUint64(res, hasher.Hash(res)), nil
+}
+
+// parseIndex checks and parses an index sidecar. Returns the stream header
+// and the blocks.
+func parseIndex(data []byte) ([]byte, []archiveBlock, error) {
+	invalid := func(reason string) error {
+		return &IOError{msg: "Invalid index: " + reason, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	if len(data) < 4+1+2+8+4+8 || binary.BigEndian.Uint32(data) != _INDEX_TYPE {
+		return nil, nil, invalid("bad type")
+	}
+
+	if data[4] != _INDEX_VERSION {
+		return nil, nil, invalid(fmt.Sprintf("unsupported version %d", data[4]))
+	}
+
+	hasher, err := kanzihash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content := data[0 : len(data)-8]
+
+	if hasher.Hash(content) != binary.BigEndian.Uint64(data[len(data)-8:]) {
+		return nil, nil, invalid("checksum mismatch")
+	}
+
+	hSize := int(binary.BigEndian.Uint16(content[5:]))
+
+	if 7+hSize+12 > len(content) {
+		return nil, nil, invalid("truncated header")
+	}
+
+	header := content[7 : 7+hSize]
+	idx := 7 + hSize
+	size := binary.BigEndian.Uint64(content[idx:])
+	count := int(binary.BigEndian.Uint32(content[idx+8:]))
+	idx += 12
+
+	if count != (len(content)-idx)/16 || (len(content)-idx)%16 != 0 {
+		return nil, nil, invalid("truncated block list")
+	}
+
+	blocks := make([]archiveBlock, count)
+	next := uint64(hSize)
+	total := uint64(0)
+
+	for i := range blocks {
+		b := &blocks[i]
+		b.offset = binary.BigEndian.Uint64(content[idx:])
+		b.length = binary.BigEndian.Uint32(content[idx+8:])
+		b.size = binary.BigEndian.Uint32(content[idx+12:])
+		idx += 16
+
+		// The records follow each other after the header
+		if b.offset != next {
+			return nil, nil, invalid(fmt.Sprintf("block %d", i+1))
+		}
+
+		next += uint64(b.length)
+		total += uint64(b.size)
+	}
+
+	if total != size {
+		return nil, nil, invalid("size mismatch")
+	}
+
+	return header, blocks, nil
+}
+
+// Index returns the index sidecar of the stream (see ctx["index"]). Only
+// available once the stream is closed.
+func (this *Writer) Index() ([]byte, error) {
+	if this.index == nil {
+		return nil, &IOError{msg: "No index requested", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if loadInt32(&this.closed) == 0 {
+		return nil, &IOError{msg: "The index is only available once the stream is closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	header, err := this.headerBytes()
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	return this.index.build(header)
+}
+
+// RangeReader random access to the original data of a remote stream
+// described by an index sidecar (see Writer.Index). Each ReadAt fetches the
+// compressed bytes of the blocks covering the range with one call to fetch,
+// decodes them and keeps the last block decoded for the next reads.
+// Safe for concurrent use (the reads are serialized).
+type RangeReader struct {
+	fetch     func(off, length int64) ([]byte, error)
+	reader    *Reader
+	blocks    []archiveBlock
+	positions []int64 // position of each block in the original data
+	size      int64
+	lock      sync.Mutex
+	buffers   []blockBuffer
+	cached    int // index of the block in cache, -1 if none
+	cache     []byte
+}
+
+// NewRangeReader creates a new instance of RangeReader reading the stream
+// described by index with fetch, which returns the bytes [off, off+length)
+// of the compressed stream.
+func NewRangeReader(fetch func(off, length int64) ([]byte, error), index []byte) (*RangeReader, error) {
+	return NewRangeReaderWithCtx(fetch, index, nil)
+}
+
+// NewRangeReaderWithCtx creates a new instance of RangeReader using a map
+// of parameters (same keys as NewReaderWithCtx, EG. the decryption key).
+func NewRangeReaderWithCtx(fetch func(off, length int64) ([]byte, error), index []byte, ctx map[string]any) (*RangeReader, error) {
+	if fetch == nil {
+		return nil, &IOError{msg: "Invalid null fetch function", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	header, blocks, err := parseIndex(index)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newRangeReader(fetch, header, blocks, ctx)
+}
+
+// newRangeReader creates a new instance of RangeReader reading the blocks
+// of the stream with the provided header
+func newRangeReader(fetch func(off, length int64) ([]byte, error), header []byte, blocks []archiveBlock, ctx map[string]any) (*RangeReader, error) {
+	params := make(map[string]any, len(ctx)+1)
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	params["jobs"] = uint(1)
+	delete(params, "headerless")
+	r, err := NewReaderWithCtx(io.NopCloser(internal.NewBufferStream(header)), params)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.readHeader(); err != nil {
+		return nil, err
+	}
+
+	if r.linked == true || r.dedup != nil {
+		return nil, &IOError{msg: "Random access is not supported with linked blocks nor deduplication", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this := &RangeReader{fetch: fetch, reader: r, blocks: blocks, cached: -1}
+	this.positions = make([]int64, len(blocks))
+
+	for i, b := range blocks {
+		if b.size > uint32(r.blockSize) {
+			errMsg := fmt.Sprintf("Invalid index: block %d", i+1)
+			return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+		}
+
+		this.positions[i] = this.size
+		this.size += int64(b.size)
+	}
+
+	this.buffers = []blockBuffer{{Buf: make([]byte, 0)}, {Buf: make([]byte, 0)}}
+	return this, nil
+}
+
+// Size returns the size of the original data
+func (this *RangeReader) Size() int64 {
+	return this.size
+}
+
+// ReadAt reads len(p) bytes of original data starting at off (see io.ReaderAt)
+func (this *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &IOError{msg: fmt.Sprintf("Invalid offset: %d", off), code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if off >= this.size {
+		return 0, io.EOF
+	}
+
+	end := min(off+int64(len(p)), this.size)
+
+	if end == off {
+		return 0, nil
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	// Blocks covering [off, end)
+	first := sort.Search(len(this.blocks), func(i int) bool { return this.positions[i]+int64(this.blocks[i].size) > off })
+	last := sort.Search(len(this.blocks), func(i int) bool { return this.positions[i]+int64(this.blocks[i].size) >= end })
+	fetchFirst := first
+
+	if first == this.cached {
+		fetchFirst++
+	}
+
+	var records []byte
+
+	if fetchFirst <= last {
+		start := int64(this.blocks[fetchFirst].offset)
+		length := int64(this.blocks[last].offset) + int64(this.blocks[last].length) - start
+		var err error
+
+		if records, err = this.fetch(start, length); err != nil {
+			errMsg := fmt.Sprintf("Cannot fetch %d bytes at offset %d: %v", length, start, err)
+			return 0, &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE, cause: err}
+		}
+
+		if int64(len(records)) != length {
+			errMsg := fmt.Sprintf("Cannot fetch %d bytes at offset %d: got %d bytes", length, start, len(records))
+			return 0, &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE}
+		}
+	}
+
+	n := 0
+
+	for i := first; i <= last; i++ {
+		b := &this.blocks[i]
+
+		if i != this.cached {
+			rec := records[b.offset-this.blocks[fetchFirst].offset:][0:b.length]
+			data, err := this.reader.decodeRecord(rec, i, b, int64(b.offset), this.buffers, this.reader.taskBlockSize())
+
+			if err != nil {
+				this.cached = -1
+				return n, err
+			}
+
+			this.cache = append(this.cache[:0], data...)
+			this.cached = i
+		}
+
+		from := max(off+int64(n)-this.positions[i], 0)
+		n += copy(p[n:], this.cache[from:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Close releases the buffers of the reader
+func (this *RangeReader) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for i := range this.buffers {
+		this.buffers[i].release()
+	}
+
+	this.cache = nil
+	this.cached = -1
+	return nil
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestIndex(t *testing.T) {
+	fmt.Println("Index Test")
+	var data []byte
+
+	for i := 0; len(data) < 1000000; i++ {
+		data = append(data, fmt.Sprintf("%d: index entries map original offsets to compressed ranges. ", i*i)...)
+	}
+
+	for _, ctx := range []map[string]any{
+		{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "jobs": uint(4), "checksum": uint(32)},
+		{"transform": "BWT", "entropy": "ANS0", "jobs": uint(2), "rsyncable": true, "archival": true},
+		{"transform": "LZ", "entropy": "FPAQ", "cipher": "AES-GCM", "key": make([]byte, 32), "autoTune": true},
+		{"transform": "NONE", "entropy": "NONE"},
+	} {
+		ctx["blockSize"] = uint(65536)
+		ctx["index"] = true
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, withDefaults(ctx))
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		if _, err = w.Index(); err == nil {
+			t.Errorf("Expected an error before close")
+		}
+
+		w.Write(data[0:100000])
+		w.Flush()
+		w.Write(data[100000:])
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		index, err := w.Index()
+
+		if err != nil {
+			t.Fatalf("Cannot get index: %v", err)
+		}
+
+		output := bs.Bytes()
+
+		// The stream is unchanged for a regular reader
+		if res, _, err := decompressData(output, map[string]any{"key": ctx["key"]}); err != nil || bytes.Equal(res, data) == false {
+			t.Fatalf("Decompression failed: %v", err)
+		}
+
+		fetches := 0
+		fetch := func(off, length int64) ([]byte, error) {
+			fetches++
+			return output[off : off+length], nil
+		}
+
+		rr, err := NewRangeReaderWithCtx(fetch, index, map[string]any{"key": ctx["key"]})
+
+		if err != nil {
+			t.Fatalf("Cannot create range reader: %v", err)
+		}
+
+		if rr.Size() != int64(len(data)) {
+			t.Errorf("Invalid size: %d, expected %d", rr.Size(), len(data))
+		}
+
+		for i := 0; i < 50; i++ {
+			off := rand.Intn(len(data))
+			buf := make([]byte, rand.Intn(200000))
+			fetches = 0
+			n, err := rr.ReadAt(buf, int64(off))
+
+			if expected := min(len(buf), len(data)-off); n != expected || bytes.Equal(buf[0:n], data[off:off+n]) == false {
+				t.Fatalf("Invalid read at %d: %d bytes, expected %d (%v)", off, n, expected, err)
+			}
+
+			if (err == io.EOF) != (off+len(buf) > len(data)) || (err != nil && err != io.EOF) {
+				t.Errorf("Unexpected error at %d: %v", off, err)
+			}
+
+			if fetches > 1 {
+				t.Errorf("Expected one fetch per read, got %d", fetches)
+			}
+		}
+
+		// Sequential reads use the cached block
+		buf := make([]byte, 100)
+		rr.ReadAt(buf[0:1], rr.Size()-1)
+		fetches = 0
+		sr := io.NewSectionReader(rr, 0, rr.Size())
+
+		for i := 0; i < 50; i++ {
+			if _, err := io.ReadFull(sr, buf); err != nil || bytes.Equal(buf, data[i*100:(i+1)*100]) == false {
+				t.Fatalf("Invalid sequential read %d: %v", i, err)
+			}
+		}
+
+		if fetches != 1 {
+			t.Errorf("Expected one fetch for the sequential reads, got %d", fetches)
+		}
+
+		if _, err := rr.ReadAt(buf, rr.Size()); err != io.EOF {
+			t.Errorf("Expected EOF, got %v", err)
+		}
+
+		rr.Close()
+
+		// Corrupted index
+		index[len(index)/2] ^= 1
+
+		if _, err := NewRangeReader(fetch, index); err == nil {
+			t.Errorf("Expected an error for a corrupted index")
+		}
+	}
+
+	// Fetch errors are reported
+	bs := internal.NewBufferStream()
+	w, _ := NewWriterWithCtx(bs, withDefaults(map[string]any{"transform": "LZ", "blockSize": uint(65536), "index": true}))
+	w.Write(data)
+	w.Close()
+	index, _ := w.Index()
+	failure := errors.New("unavailable")
+	rr, err := NewRangeReader(func(off, length int64) ([]byte, error) { return nil, failure }, index)
+
+	if err != nil {
+		t.Fatalf("Cannot create range reader: %v", err)
+	}
+
+	if _, err := rr.ReadAt(make([]byte, 10), 0); errors.Is(err, failure) == false {
+		t.Errorf("Expected a fetch error, got %v", err)
+	}
+
+	for _, extra := range []map[string]any{{"headerless": true}, {"linkedBlocks": true}, {"dedup": true}} {
+		ctx := withDefaults(map[string]any{"index": true})
+
+		for k, v := range extra {
+			ctx[k] = v
+		}
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), ctx); err == nil {
+			t.Errorf("Expected an error with %v", extra)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestLinkedBlocks(t *testing.T) {
+	fmt.Println("Linked Blocks Test")
+
+	// The redundancy is mostly between blocks
+	chunk := make([]byte, 61440)
+	rand.Read(chunk)
+	data := bytes.Repeat(chunk, 12)
+
+	compress := func(transform string, linked bool) []byte {
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, map[string]any{"transform": transform, "entropy": "NONE",
+			"blockSize": uint(65536), "jobs": uint(1), "checksum": uint(32), "linkedBlocks": linked})
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		// Small writes and a flush (partial block)
+		for off := 0; off < len(data); off += 10000 {
+			if _, err = w.Write(data[off:min(off+10000, len(data))]); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			if off == 300000 {
+				w.Flush()
+			}
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		return bs.Bytes()
+	}
+
+	decompress := func(input []byte, ctx map[string]any) ([]byte, error) {
+		r, err := NewReaderWithCtx(internal.NewBufferStream(input), ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	for _, transform := range []string{"LZ", "LZX", "ROLZ"} {
+		output1 := compress(transform, false)
+		output2 := compress(transform, true)
+		fmt.Printf("%s: %d => %d (independent blocks), %d (linked blocks)\n", transform, len(data), len(output1), len(output2))
+
+		if len(output2) >= len(output1)/2 {
+			t.Errorf("%s: linked blocks did not improve compression", transform)
+		}
+
+		res, err := decompress(output2, map[string]any{"jobs": uint(4)})
+
+		if err != nil {
+			t.Fatalf("%s: decompression failed: %v", transform, err)
+		}
+
+		if bytes.Equal(res, data) == false {
+			t.Errorf("%s: roundtrip failed", transform)
+		}
+
+		if _, err = decompress(output2, map[string]any{"jobs": uint(1), "from": 3}); err == nil {
+			t.Errorf("%s: partial decoding of linked blocks should fail", transform)
+		}
+	}
+
+	_, err := NewWriterWithCtx(internal.NewBufferStream(), map[string]any{"transform": "LZ", "entropy": "NONE",
+		"blockSize": uint(65536), "jobs": uint(2), "checksum": uint(0), "linkedBlocks": true})
+
+	// The number of jobs is forced to 1 in the single thread build
+	if err == nil && _SINGLE_THREAD == false {
+		t.Errorf("Linked blocks with several jobs should be rejected")
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const (
+	_MANIFEST_VERSION = 1
+)
+
+// Manifest a detached list of digests (SHA-256) of the blocks of a stream
+// (computed on the original data) and a digest of the whole stream.
+// The Writer produces it when ctx["manifest"] is true and the Reader checks
+// each decoded block against it when ctx["manifest"] is a *Manifest.
+// Signing the manifest allows to check the authenticity of the data in
+// clear (without encryption), EG. for code distribution.
+// Only the first stream of chained streams is covered.
+type Manifest struct {
+	Version   int           `json:"version"`
+	Size      int64         `json:"size"`
+	Blocks    []BlockDigest `json:"blocks"`
+	Digest    string        `json:"digest"`              // SHA-256 of the block digests
+	Signature string        `json:"signature,omitempty"` // Ed25519 signature of the digest
+}
+
+// BlockDigest the digest of one block of original data
+type BlockDigest struct {
+	ID     int    `json:"id"`
+	Size   int    `json:"size"`
+	Digest string `json:"digest"`
+}
+
+// Marshal returns the JSON encoding of the manifest
+func (this *Manifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(this, "", "  ")
+}
+
+// UnmarshalManifest parses a manifest encoded with Marshal and checks the
+// consistency of the stream digest.
+func UnmarshalManifest(data []byte) (*Manifest, error) {
+	res := &Manifest{}
+
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+
+	if res.Version != _MANIFEST_VERSION {
+		return nil, fmt.Errorf("Unsupported manifest version: %d", res.Version)
+	}
+
+	if res.Digest != res.computeDigest() {
+		return nil, errors.New("Invalid manifest: inconsistent stream digest")
+	}
+
+	return res, nil
+}
+
+// Sign signs the stream digest with the provided private key
+func (this *Manifest) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return errors.New("Invalid private key size")
+	}
+
+	digest, err := hex.DecodeString(this.computeDigest())
+
+	if err != nil {
+		return err
+	}
+
+	this.Signature = hex.EncodeToString(ed25519.Sign(key, digest))
+	return nil
+}
+
+// VerifySignature returns true if the manifest has been signed with the
+// private key matching the provided public key and has not been modified.
+func (this *Manifest) VerifySignature(key ed25519.PublicKey) bool {
+	if len(key) != ed25519.PublicKeySize || this.Digest != this.computeDigest() {
+		return false
+	}
+
+	digest, err1 := hex.DecodeString(this.Digest)
+	sig, err2 := hex.DecodeString(this.Signature)
+
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	return ed25519.Verify(key, digest, sig)
+}
+
+// computeDigest returns the SHA-256 of the list of (id, size, digest) of the blocks
+func (this *Manifest) computeDigest() string {
+	h := sha256.New()
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[0:], uint64(this.Version))
+	binary.BigEndian.PutUint64(buf[8:], uint64(this.Size))
+	h.Write(buf[:])
+
+	for _, b := range this.Blocks {
+		binary.BigEndian.PutUint64(buf[0:], uint64(b.ID))
+		binary.BigEndian.PutUint64(buf[8:], uint64(b.Size))
+		h.Write(buf[:])
+		h.Write([]byte(b.Digest))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// manifestBuilder collects the block digests computed by the encoding tasks
+type manifestBuilder struct {
+	lock   sync.Mutex
+	blocks []BlockDigest
+}
+
+func (this *manifestBuilder) add(blockID int, data []byte) {
+	digest := sha256.Sum256(data)
+	b := BlockDigest{ID: blockID, Size: len(data), Digest: hex.EncodeToString(digest[:])}
+	this.lock.Lock()
+	this.blocks = append(this.blocks, b)
+	this.lock.Unlock()
+}
+
+func (this *manifestBuilder) build() *Manifest {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	res := &Manifest{Version: _MANIFEST_VERSION}
+	res.Blocks = make([]BlockDigest, len(this.blocks))
+	copy(res.Blocks, this.blocks)
+	sort.Slice(res.Blocks, func(i, j int) bool { return res.Blocks[i].ID < res.Blocks[j].ID })
+
+	for _, b := range res.Blocks {
+		res.Size += int64(b.Size)
+	}
+
+	res.Digest = res.computeDigest()
+	return res
+}
+
+// manifestChecker verifies the blocks decoded by the decoding tasks
+type manifestChecker struct {
+	digests  map[int]BlockDigest
+	verified int32
+}
+
+func newManifestChecker(m *Manifest) (*manifestChecker, error) {
+	if m.Digest != m.computeDigest() {
+		return nil, errors.New("Invalid manifest: inconsistent stream digest")
+	}
+
+	this := &manifestChecker{digests: make(map[int]BlockDigest, len(m.Blocks))}
+
+	for _, b := range m.Blocks {
+		this.digests[b.ID] = b
+	}
+
+	return this, nil
+}
+
+func (this *manifestChecker) verify(blockID int, data []byte) *IOError {
+	b, found := this.digests[blockID]
+
+	if found == false {
+		errMsg := fmt.Sprintf("Manifest verification failed: unexpected block %d", blockID)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	digest := sha256.Sum256(data)
+
+	if b.Size != len(data) || b.Digest != hex.EncodeToString(digest[:]) {
+		errMsg := fmt.Sprintf("Manifest verification failed: block %d does not match", blockID)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	addInt32(&this.verified, 1)
+	return nil
+}
+
+// complete returns an error if some blocks of the manifest were not decoded
+func (this *manifestChecker) complete() *IOError {
+	if n := int(loadInt32(&this.verified)); n != len(this.digests) {
+		errMsg := fmt.Sprintf("Manifest verification failed: %d blocks decoded, %d expected", n, len(this.digests))
+		return &IOError{msg: errMsg, code: kanzi.ERR_CRC_CHECK}
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	fmt.Println("Manifest Test")
+	values := make([]byte, 300000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + 65)
+	}
+
+	compressWithManifest := func(data []byte) ([]byte, *Manifest) {
+		bs := internal.NewBufferStream()
+		ctx := map[string]any{
+			"entropy":   "ANS0",
+			"transform": "LZ",
+			"blockSize": uint(65536),
+			"jobs":      uint(4),
+			"checksum":  uint(0),
+			"manifest":  true,
+		}
+
+		w, err := NewWriterWithCtx(bs, ctx)
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		w.Write(data)
+
+		if _, err = w.Manifest(); err == nil {
+			t.Errorf("Expected error on manifest before close")
+		}
+
+		w.Close()
+		m, err := w.Manifest()
+
+		if err != nil {
+			t.Fatalf("Cannot get manifest: %v", err)
+		}
+
+		return bytes.Clone(bs.Bytes()), m
+	}
+
+	decompress := func(data []byte, m *Manifest) ([]byte, error) {
+		res, _, err := decompressData(data, map[string]any{"jobs": uint(2), "manifest": m})
+		return res, err
+	}
+
+	compressed, m := compressWithManifest(values)
+
+	if len(m.Blocks) != 5 || m.Size != int64(len(values)) {
+		t.Fatalf("Incorrect manifest: %d blocks, size %d", len(m.Blocks), m.Size)
+	}
+
+	// Sign, serialize and parse
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	if err := m.Sign(priv); err != nil {
+		t.Fatalf("Cannot sign manifest: %v", err)
+	}
+
+	encoded, _ := m.Marshal()
+	m2, err := UnmarshalManifest(encoded)
+
+	if err != nil {
+		t.Fatalf("Cannot parse manifest: %v", err)
+	}
+
+	if m2.VerifySignature(pub) == false {
+		t.Errorf("Signature verification failed")
+	}
+
+	res, err := decompress(bytes.Clone(compressed), m2)
+
+	if err != nil || !bytes.Equal(res, values) {
+		t.Fatalf("Decompression with manifest failed: %v", err)
+	}
+
+	// Tampered manifest
+	m2.Blocks[1].Digest = m2.Blocks[2].Digest
+
+	if m2.VerifySignature(pub) == true {
+		t.Errorf("Expected signature verification failure on modified manifest")
+	}
+
+	// Data not matching the manifest
+	other := bytes.Clone(values)
+	other[100000] ^= 1
+	compressed2, _ := compressWithManifest(other)
+
+	if _, err = decompress(compressed2, m); err == nil {
+		t.Errorf("Expected error on data not matching the manifest")
+	}
+
+	// Truncated data (missing blocks)
+	compressed3, _ := compressWithManifest(values[0 : 3*65536])
+
+	if _, err = decompress(compressed3, m); err == nil {
+		t.Errorf("Expected error on missing blocks")
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"strings"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Memory budget (ctx["maxMemory"] = int64, in bytes): the memory used by a
+// Writer or a Reader is roughly the number of concurrent tasks (one block
+// per task) times the memory of a task, which depends on the block size,
+// the transforms and the entropy codec (see EstimateTaskMemory). With a
+// budget, the number of jobs is reduced so that all the tasks fit in it
+// and, in auto-tune mode, the codecs that do not fit are not candidates.
+// A MemoryLimitError is returned if a single task does not fit.
+
+const (
+	_MEMORY_STREAM_OVERHEAD = 2 * _STREAM_DEFAULT_BUFFER_SIZE // bitstream buffers
+	_MEMORY_LZ_TABLES       = 4 << 21                         // LZX hash table
+	_MEMORY_LZP_TABLES      = 4 << 16
+	_MEMORY_ROLZ_TABLES     = 16 << 20
+	_MEMORY_TEXT_TABLES     = 16 << 20
+	_MEMORY_ENTROPY_TABLES  = 1 << 20 // CM, ANS1, ...
+)
+
+// MemoryLimitError an IOError returned by a Writer or a Reader when the
+// memory budget (ctx["maxMemory"]) is too small to process one block.
+type MemoryLimitError struct {
+	IOError
+	Required int64 // estimated memory of one task (bytes)
+	Limit    int64 // memory budget (bytes)
+}
+
+// EstimateTaskMemory returns an estimate of the memory (in bytes) used
+// to compress or decompress one block with the provided transform and
+// entropy codec. The estimate is meant to be an upper bound.
+func EstimateTaskMemory(blockSize uint, transformType uint64, entropyType uint32) int64 {
+	n := int64(blockSize)
+
+	// Input and output buffers (with padding)
+	res := 2 * (n + max(n>>4, _EXTRA_BUFFER_SIZE))
+
+	if name, err := transform.GetName(transformType); err == nil && name != "NONE" {
+		for _, t := range strings.Split(name, "+") {
+			switch t {
+			case "BWT", "BWTS":
+				// Suffix array and inverse buffers (int32)
+				res += 5 * n
+			case "ST4", "ST6":
+				// Ranks, permutation and context groups (int32)
+				res += 12 * n
+			case "LZ", "LZX":
+				res += n + _MEMORY_LZ_TABLES
+			case "LZP":
+				res += n + _MEMORY_LZP_TABLES
+			case "ROLZ", "ROLZX":
+				res += n + _MEMORY_ROLZ_TABLES
+			case "TEXT":
+				res += n + _MEMORY_TEXT_TABLES
+			default:
+				res += n / 2
+			}
+		}
+	}
+
+	name, _ := entropy.GetName(entropyType)
+
+	switch name {
+	case "TPAQ", "TPAQX":
+		states := int64(1 << 22)
+
+		switch {
+		case n >= 64<<20:
+			states = 1 << 28
+		case n >= 16<<20:
+			states = 1 << 27
+		case n >= 4<<20:
+			states = 1 << 26
+		case n >= 1<<20:
+			states = 1 << 24
+		}
+
+		hashes := 4 * min(16<<20, 16*n)
+
+		if name == "TPAQX" {
+			states <<= 2
+			hashes <<= 2
+		}
+
+		res += states + hashes + (16 << 20) + n
+	case "NONE":
+	default:
+		res += n + _MEMORY_ENTROPY_TABLES
+	}
+
+	return res
+}
+
+// getMaxMemory returns the memory budget in the context (0 if none)
+func getMaxMemory(ctx map[string]any) (int64, error) {
+	val, hasKey := ctx["maxMemory"]
+
+	if hasKey == false {
+		return 0, nil
+	}
+
+	maxMemory, ok := val.(int64)
+
+	if ok == false || maxMemory < 0 {
+		return 0, &IOError{msg: fmt.Sprintf("Invalid memory budget: %v", val), code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return maxMemory, nil
+}
+
+// memoryLimitedJobs returns the number of jobs (at most 'jobs') such that
+// the tasks fit in the memory budget
+func memoryLimitedJobs(jobs int, taskMemory, maxMemory int64) (int, error) {
+	if maxMemory == 0 {
+		return jobs, nil
+	}
+
+	budget := maxMemory - _MEMORY_STREAM_OVERHEAD
+
+	if taskMemory > budget {
+		errMsg := fmt.Sprintf("Memory budget too small: %d bytes required to process one block, budget is %d bytes",
+			taskMemory+_MEMORY_STREAM_OVERHEAD, maxMemory)
+		return 0, &MemoryLimitError{IOError: IOError{msg: errMsg, code: kanzi.ERR_MEMORY_LIMIT},
+			Required: taskMemory + _MEMORY_STREAM_OVERHEAD, Limit: maxMemory}
+	}
+
+	return int(min(int64(jobs), budget/taskMemory)), nil
+}
+
+// autoTuneCandidatesFor returns the auto-tune candidates that fit in the
+// memory budget (all of them if there is no budget)
+func autoTuneCandidatesFor(blockSize uint, maxMemory int64) []autoTuneCandidate {
+	if maxMemory == 0 {
+		return autoTuneCandidates
+	}
+
+	res := make([]autoTuneCandidate, 0, len(autoTuneCandidates))
+
+	for _, c := range autoTuneCandidates {
+		t, err1 := transform.GetType(c.transform)
+		e, err2 := entropy.GetType(c.entropy)
+
+		if err1 == nil && err2 == nil && EstimateTaskMemory(blockSize, t, e) <= maxMemory-_MEMORY_STREAM_OVERHEAD {
+			res = append(res, c)
+		}
+	}
+
+	return res
+}
+
+// autoTuneTaskMemory returns the memory of a task in auto-tune mode: the
+// largest estimate among the codecs of the stream and the candidates
+func autoTuneTaskMemory(blockSize uint, tType uint64, eType uint32, candidates []autoTuneCandidate) int64 {
+	res := EstimateTaskMemory(blockSize, tType, eType)
+
+	for _, c := range candidates {
+		t, err1 := transform.GetType(c.transform)
+		e, err2 := entropy.GetType(c.entropy)
+
+		if err1 == nil && err2 == nil {
+			res = max(res, EstimateTaskMemory(blockSize, t, e))
+		}
+	}
+
+	return res
+}
+
+// applyMemoryLimit reduces the number of jobs of the Reader so that the
+// tasks decoding the current segment fit in the memory budget
+func (this *Reader) applyMemoryLimit() error {
+	if this.maxMemory == 0 {
+		return nil
+	}
+
+	taskMemory := EstimateTaskMemory(uint(this.blockSize), this.transformType, this.entropyType)
+
+	if this.autoTune == true {
+		candidates := autoTuneCandidatesFor(uint(this.blockSize), this.maxMemory)
+		taskMemory = autoTuneTaskMemory(uint(this.blockSize), this.transformType, this.entropyType, candidates)
+	}
+
+	jobs, err := memoryLimitedJobs(this.maxJobs, taskMemory, this.maxMemory)
+
+	if err != nil {
+		return err
+	}
+
+	this.jobs = jobs
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	fmt.Println("Memory Budget Test")
+
+	blockSize := uint(4 << 20)
+	data := bytes.Repeat([]byte("Memory budget test: 0123456789 abcdefghijklmnopqrstuvwxyz\n"), 300000)
+	newCtx := func(maxMemory any) map[string]any {
+		return map[string]any{"transform": "BWT+RANK+ZRLT", "entropy": "ANS0", "blockSize": blockSize,
+			"jobs": uint(8), "checksum": uint(32), "maxMemory": maxMemory}
+	}
+
+	bType, _ := transform.GetType("BWT+RANK+ZRLT")
+	eType, _ := entropy.GetType("ANS0")
+	taskMemory := EstimateTaskMemory(blockSize, bType, eType)
+	maxMemory := 3*taskMemory + _MEMORY_STREAM_OVERHEAD
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, newCtx(maxMemory))
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	if w.jobs != 3 && _SINGLE_THREAD == false {
+		t.Errorf("Expected 3 jobs to fit in the budget, got %d", w.jobs)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	res, r, err := decompressData(bs.Bytes(), map[string]any{"jobs": uint(8), "maxMemory": 2*taskMemory + _MEMORY_STREAM_OVERHEAD})
+
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if bytes.Equal(res, data) == false {
+		t.Fatalf("Invalid decompressed data")
+	}
+
+	if r.jobs != 2 && _SINGLE_THREAD == false {
+		t.Errorf("Expected 2 jobs to fit in the budget, got %d", r.jobs)
+	}
+
+	// Budget too small for one block
+	_, err = NewWriterWithCtx(internal.NewBufferStream(), newCtx(taskMemory))
+	var mle *MemoryLimitError
+
+	if errors.As(err, &mle) == false {
+		t.Fatalf("Expected a MemoryLimitError, got %v", err)
+	}
+
+	fmt.Println(err)
+
+	if mle.ErrorCode() != kanzi.ERR_MEMORY_LIMIT || mle.Limit != taskMemory || mle.Required <= mle.Limit {
+		t.Errorf("Invalid memory limit error: %v", mle)
+	}
+
+	if _, _, err = decompressData(bs.Bytes(), map[string]any{"jobs": uint(2), "maxMemory": int64(1 << 20)}); errors.As(err, &mle) == false {
+		t.Errorf("Expected a MemoryLimitError, got %v", err)
+	}
+
+	if _, err = NewWriterWithCtx(internal.NewBufferStream(), newCtx(1<<30)); err == nil {
+		t.Errorf("Invalid memory budget type should be rejected")
+	}
+
+	// Auto-tune: the candidates that do not fit are excluded
+	ctx := newCtx(int64(32 << 20))
+	ctx["transform"] = "LZ"
+	ctx["entropy"] = "HUFFMAN"
+	ctx["autoTune"] = true
+	w, err = NewWriterWithCtx(internal.NewBufferStream(), ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	for _, c := range w.candidates {
+		if strings.Contains(c.transform, "BWT") {
+			t.Errorf("Unexpected candidate with a budget: %s", c.transform)
+		}
+	}
+
+	w.Close()
+}
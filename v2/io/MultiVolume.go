@@ -0,0 +1,311 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+)
+
+// Multi-volume streams: the compressed bitstream is split across several
+// volumes (parts numbered from 1) of at most volumeSize bytes each. The
+// blocks are byte aligned and the volumes are cut at block boundaries, so
+// that no block spans two volumes. The data after the last block (end
+// block, footer, archive trailer) fills the last volumes. The volumes are
+// not modified: their concatenation is the regular compressed stream.
+
+// NewMultiVolumeWriter creates a Writer (see NewWriterWithCtx) splitting
+// the compressed bitstream across volumes of at most volumeSize bytes. The
+// factory is called to create each volume (starting at part 1) and the
+// volumes are closed by the Writer. The volume size must be at least twice
+// the block size.
+func NewMultiVolumeWriter(factory func(part int) (io.WriteCloser, error), volumeSize int64, ctx map[string]any) (*Writer, error) {
+	if factory == nil {
+		return nil, &IOError{msg: "Invalid null volume factory parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if ctx == nil {
+		return nil, &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if bSize, ok := ctx["blockSize"].(uint); ok == true && volumeSize < 2*int64(bSize) {
+		errMsg := fmt.Sprintf("The volume size must be at least twice the block size, got %d", volumeSize)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	volumes := &volumeWriter{factory: factory, volumeSize: volumeSize}
+	obs, err := bitstream.NewDefaultOutputBitStream(volumes, _STREAM_DEFAULT_BUFFER_SIZE)
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot create output bit stream: %v", err)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+	}
+
+	w, err := createWriterWithCtx(obs, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Blocks must go through the encoding tasks to be byte aligned and
+	// recorded by the volumes (no store mode, see Writer.init)
+	w.volumes = volumes
+	w.storeOnly = false
+	w.compact = false
+	return w, nil
+}
+
+// NewMultiVolumeReader creates a Reader (see NewReaderWithCtx) decoding
+// a compressed bitstream split across volumes. The factory is called to
+// open each volume (starting at part 1) and must return an error wrapping
+// fs.ErrNotExist (or a nil reader) after the last volume.
+func NewMultiVolumeReader(factory func(part int) (io.ReadCloser, error), ctx map[string]any) (*Reader, error) {
+	if factory == nil {
+		return nil, &IOError{msg: "Invalid null volume factory parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return NewReaderWithCtx(&volumeReader{factory: factory}, ctx)
+}
+
+// volumeWriter the output of the bitstream of a multi-volume Writer. The
+// encoding tasks register the end of each block before writing it.
+type volumeWriter struct {
+	lock       sync.Mutex
+	factory    func(part int) (io.WriteCloser, error)
+	volumeSize int64
+	current    io.WriteCloser
+	part       int
+	used       int64   // bytes written to the current volume
+	pos        int64   // offset in the stream of the next byte
+	ends       []int64 // offsets of the ends of the blocks not fully written
+	started    bool    // the bytes of ends[0] have started to be written
+	pending    []byte  // bytes after the last registered block end
+}
+
+// addBlockEnd registers the offset (in bytes) of the end of the next block
+func (this *volumeWriter) addBlockEnd(end uint64) {
+	this.lock.Lock()
+	this.ends = append(this.ends, int64(end))
+	this.lock.Unlock()
+}
+
+func (this *volumeWriter) Write(p []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	n := len(p)
+
+	if len(this.ends) == 0 {
+		// Unknown size: keep the bytes until the next block end or Close
+		this.pending = append(this.pending, p...)
+		return n, nil
+	}
+
+	if len(this.pending) > 0 {
+		p = append(this.pending, p...)
+		this.pending = nil
+	}
+
+	for len(p) > 0 {
+		if len(this.ends) == 0 {
+			this.pending = append(this.pending, p...)
+			break
+		}
+
+		end := this.ends[0]
+
+		if this.started == false {
+			// Start a new volume if the block does not fit in the current one
+			if end-this.pos > this.volumeSize-this.used {
+				if this.used > 0 {
+					if err := this.nextVolume(); err != nil {
+						return 0, err
+					}
+				}
+
+				if end-this.pos > this.volumeSize {
+					errMsg := fmt.Sprintf("Block of %d bytes larger than the volume size", end-this.pos)
+					return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+				}
+			}
+
+			this.started = true
+		}
+
+		k := int(min(int64(len(p)), end-this.pos))
+
+		if err := this.writeVolume(p[0:k]); err != nil {
+			return 0, err
+		}
+
+		p = p[k:]
+
+		if this.pos == end {
+			this.ends = this.ends[1:]
+			this.started = false
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the remaining bytes (filling the volumes) and closes the
+// last volume
+func (this *volumeWriter) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	p := this.pending
+	this.pending = nil
+
+	for len(p) > 0 {
+		if this.used == this.volumeSize {
+			if err := this.nextVolume(); err != nil {
+				return err
+			}
+		}
+
+		k := int(min(int64(len(p)), this.volumeSize-this.used))
+
+		if err := this.writeVolume(p[0:k]); err != nil {
+			return err
+		}
+
+		p = p[k:]
+	}
+
+	if this.current == nil {
+		return nil
+	}
+
+	err := this.current.Close()
+	this.current = nil
+
+	if err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	return nil
+}
+
+func (this *volumeWriter) writeVolume(p []byte) error {
+	if this.current == nil {
+		if err := this.nextVolume(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := this.current.Write(p); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	this.used += int64(len(p))
+	this.pos += int64(len(p))
+	return nil
+}
+
+// nextVolume closes the current volume (if any) and creates the next one
+func (this *volumeWriter) nextVolume() error {
+	if this.current != nil {
+		err := this.current.Close()
+		this.current = nil
+
+		if err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE, cause: err}
+		}
+	}
+
+	os, err := this.factory(this.part + 1)
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot create volume %d: %v", this.part+1, err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_FILE}
+	}
+
+	this.part++
+	this.current = os
+	this.used = 0
+	return nil
+}
+
+// volumeReader reads the volumes in sequence
+type volumeReader struct {
+	factory func(part int) (io.ReadCloser, error)
+	current io.ReadCloser
+	part    int
+	done    bool
+}
+
+func (this *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if this.current == nil {
+			if this.done == true {
+				return 0, io.EOF
+			}
+
+			is, err := this.factory(this.part + 1)
+
+			if is == nil || (err != nil && errors.Is(err, fs.ErrNotExist)) {
+				if this.part == 0 {
+					return 0, &IOError{msg: "Cannot open volume 1", code: kanzi.ERR_OPEN_FILE}
+				}
+
+				this.done = true
+				return 0, io.EOF
+			}
+
+			if err != nil {
+				errMsg := fmt.Sprintf("Cannot open volume %d: %v", this.part+1, err)
+				return 0, &IOError{msg: errMsg, code: kanzi.ERR_OPEN_FILE}
+			}
+
+			this.part++
+			this.current = is
+		}
+
+		n, err := this.current.Read(p)
+
+		if err == io.EOF {
+			this.current.Close()
+			this.current = nil
+
+			if n == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+// Close closes the current volume
+func (this *volumeReader) Close() error {
+	this.done = true
+
+	if this.current == nil {
+		return nil
+	}
+
+	err := this.current.Close()
+	this.current = nil
+	return err
+}
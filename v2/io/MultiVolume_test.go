@@ -0,0 +1,156 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestMultiVolume(t *testing.T) {
+	fmt.Println("Multi Volume Test")
+
+	data := make([]byte, 500000)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(8*(i/50000+1)))
+	}
+
+	for _, volumeSize := range []int64{8192, 20000, 1 << 20} {
+		for _, footer := range []bool{false, true} {
+			volumes := make([]*internal.BufferStream, 0)
+			factory := func(part int) (io.WriteCloser, error) {
+				if part != len(volumes)+1 {
+					t.Fatalf("Unexpected volume %d", part)
+				}
+
+				volumes = append(volumes, internal.NewBufferStream())
+				return volumes[part-1], nil
+			}
+
+			ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(4096),
+				"jobs": uint(4), "checksum": uint(32), "footer": footer}
+			w, err := NewMultiVolumeWriter(factory, volumeSize, ctx)
+
+			if err != nil {
+				t.Fatalf("Cannot create writer: %v", err)
+			}
+
+			if _, err = w.Write(data); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			total := 0
+
+			for i, v := range volumes {
+				if int64(len(v.Bytes())) > volumeSize {
+					t.Errorf("Volume %d: size %d larger than %d", i+1, len(v.Bytes()), volumeSize)
+				}
+
+				total += len(v.Bytes())
+			}
+
+			fmt.Printf("Volume size %d, footer=%v: %d volumes, %d bytes\n", volumeSize, footer, len(volumes), total)
+
+			open := func(part int) (io.ReadCloser, error) {
+				if part > len(volumes) {
+					return nil, os.ErrNotExist
+				}
+
+				return internal.NewBufferStream(volumes[part-1].Bytes()), nil
+			}
+
+			r, err := NewMultiVolumeReader(open, map[string]any{"jobs": uint(2)})
+
+			if err != nil {
+				t.Fatalf("Cannot create reader: %v", err)
+			}
+
+			res, err := io.ReadAll(r)
+			r.Close()
+
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if bytes.Equal(res, data) == false {
+				t.Errorf("Decompressed data differs from the original data")
+			}
+		}
+	}
+
+	// Store mode (NONE+NONE): the full blocks written at once must also be
+	// split in volumes
+	parts := make([]*internal.BufferStream, 0)
+	factory := func(part int) (io.WriteCloser, error) {
+		parts = append(parts, internal.NewBufferStream())
+		return parts[part-1], nil
+	}
+
+	ctx := map[string]any{"transform": "NONE", "entropy": "NONE", "blockSize": uint(4096), "jobs": uint(1), "checksum": uint(32)}
+	w, err := NewMultiVolumeWriter(factory, 20000, ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	for i, v := range parts {
+		if len(v.Bytes()) > 20000 {
+			t.Errorf("Store mode, volume %d: size %d larger than 20000", i+1, len(v.Bytes()))
+		}
+	}
+
+	r, err := NewMultiVolumeReader(func(part int) (io.ReadCloser, error) {
+		if part > len(parts) {
+			return nil, os.ErrNotExist
+		}
+
+		return internal.NewBufferStream(parts[part-1].Bytes()), nil
+	}, map[string]any{"jobs": uint(1)})
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	if res, err := io.ReadAll(r); err != nil || bytes.Equal(res, data) == false {
+		t.Errorf("Store mode: incorrect decompressed data (%v)", err)
+	}
+
+	// The volumes must hold at least 2 blocks
+	factory = func(part int) (io.WriteCloser, error) { return internal.NewBufferStream(), nil }
+	ctx = map[string]any{"transform": "LZ", "entropy": "NONE", "blockSize": uint(65536), "jobs": uint(1), "checksum": uint(0)}
+
+	if _, err := NewMultiVolumeWriter(factory, 65536, ctx); err == nil {
+		t.Errorf("A volume size smaller than 2 blocks should be rejected")
+	}
+}
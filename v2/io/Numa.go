@@ -0,0 +1,61 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// NUMA aware processing (ctx["numaAware"]): on large machines, the tasks
+// of a stream move across the NUMA nodes and access remote memory. The job
+// slots are spread over the nodes: the task of slot i runs on the CPUs of
+// node i % nodes and the input and output buffers of the slot are bound to
+// that node. Only supported on Linux (see NumaLinux.go), ignored on the
+// other platforms or if the topology is not available.
+
+// getNumaNodes returns the NUMA nodes to spread the job slots over (nil if
+// not enabled or not available)
+func getNumaNodes(ctx map[string]any) []*numaNode {
+	if val, hasKey := ctx["numaAware"]; hasKey && val.(bool) == true {
+		return numaNodes()
+	}
+
+	return nil
+}
+
+// setNumaNodes assigns the node of their job slot to the buffers (input
+// buffers then output buffers)
+func setNumaNodes(buffers []blockBuffer, nodes []*numaNode) {
+	jobs := len(buffers) / 2
+
+	for i := range buffers {
+		buffers[i].node = nil
+
+		if len(nodes) > 0 {
+			buffers[i].node = nodes[(i%jobs)%len(nodes)]
+
+			if cap(buffers[i].Buf) > 0 {
+				buffers[i].node.bind(buffers[i].Buf)
+			}
+		}
+	}
+}
+
+// startSlotTask starts the task of a job slot, on the node of the slot if
+// any
+func startSlotTask(nodes []*numaNode, slot int, task func()) {
+	if len(nodes) > 0 {
+		task = nodes[slot%len(nodes)].run(task)
+	}
+
+	startTask(task)
+}
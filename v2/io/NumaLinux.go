@@ -0,0 +1,198 @@
+//go:build linux
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Linux: the CPUs of the NUMA nodes are listed in /sys. A task runs on a
+// locked OS thread restricted to the CPUs of its node (sched_setaffinity),
+// the previous affinity being restored at the end of the task. The memory
+// of a buffer is bound to its node (mbind with the preferred policy): the
+// pages allocated later come from the node and the allocated pages are
+// migrated.
+
+const (
+	_NUMA_SYSFS          = "/sys/devices/system/node"
+	_NUMA_MAX_CPUS       = 1024
+	_NUMA_MAX_NODES      = 64
+	_NUMA_MPOL_PREFERRED = 1
+	_NUMA_MPOL_MF_MOVE   = 1 << 1
+)
+
+type cpuMask [_NUMA_MAX_CPUS / 64]uint64
+
+// numaNode a NUMA node and its CPUs usable by the process
+type numaNode struct {
+	id   int
+	cpus cpuMask
+}
+
+// numaNodes returns the NUMA nodes with CPUs usable by the process (nil if
+// the topology is not available)
+func numaNodes() []*numaNode {
+	var allowed cpuMask
+
+	if getAffinity(&allowed) != nil {
+		return nil
+	}
+
+	dirs, err := os.ReadDir(_NUMA_SYSFS)
+
+	if err != nil {
+		return nil
+	}
+
+	res := make([]*numaNode, 0, len(dirs))
+
+	for _, d := range dirs {
+		name, found := strings.CutPrefix(d.Name(), "node")
+
+		if found == false {
+			continue
+		}
+
+		id, err := strconv.Atoi(name)
+
+		if err != nil || id >= _NUMA_MAX_NODES {
+			continue
+		}
+
+		cpus, err := os.ReadFile(_NUMA_SYSFS + "/" + d.Name() + "/cpulist")
+
+		if err != nil {
+			continue
+		}
+
+		node := &numaNode{id: id}
+
+		if node.cpus.parse(string(cpus), &allowed) == true {
+			res = append(res, node)
+		}
+	}
+
+	if len(res) == 0 {
+		return nil
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].id < res[j].id })
+	return res
+}
+
+// parse sets the CPUs of the list (EG. "0-7,16-23") that are also in the
+// allowed mask and returns true if at least one CPU has been set
+func (this *cpuMask) parse(list string, allowed *cpuMask) bool {
+	res := false
+
+	for _, r := range strings.Split(strings.TrimSpace(list), ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		last := first
+
+		if err == nil && isRange == true {
+			last, err = strconv.Atoi(hi)
+		}
+
+		if err != nil || first < 0 {
+			continue
+		}
+
+		for c := first; c <= last && c < _NUMA_MAX_CPUS; c++ {
+			if allowed[c>>6]&(1<<(c&63)) != 0 {
+				this[c>>6] |= 1 << (c & 63)
+				res = true
+			}
+		}
+	}
+
+	return res
+}
+
+// run returns the task wrapped to run on the CPUs of the node
+func (this *numaNode) run(task func()) func() {
+	return func() {
+		runtime.LockOSThread()
+		var saved cpuMask
+
+		if getAffinity(&saved) != nil || setAffinity(&this.cpus) != nil {
+			runtime.UnlockOSThread()
+			task()
+			return
+		}
+
+		// If the affinity cannot be restored, the thread stays locked and
+		// exits with the goroutine
+		defer func() {
+			if setAffinity(&saved) == nil {
+				runtime.UnlockOSThread()
+			}
+		}()
+
+		task()
+	}
+}
+
+// bind sets the memory policy of the pages of buf to the node
+func (this *numaNode) bind(buf []byte) {
+	if cap(buf) == 0 {
+		return
+	}
+
+	page := uintptr(syscall.Getpagesize())
+	addr := uintptr(unsafe.Pointer(unsafe.SliceData(buf)))
+	start := (addr + page - 1) &^ (page - 1)
+	end := (addr + uintptr(cap(buf))) &^ (page - 1)
+
+	if end <= start {
+		return
+	}
+
+	nodes := uint64(1) << this.id
+
+	// Best effort: the error (EG. pages that cannot be moved) is ignored
+	syscall.Syscall6(syscall.SYS_MBIND, start, end-start, _NUMA_MPOL_PREFERRED,
+		uintptr(unsafe.Pointer(&nodes)), _NUMA_MAX_NODES+1, _NUMA_MPOL_MF_MOVE)
+	runtime.KeepAlive(buf)
+}
+
+func getAffinity(mask *cpuMask) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_GETAFFINITY, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func setAffinity(mask *cpuMask) error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(*mask), uintptr(unsafe.Pointer(mask)))
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
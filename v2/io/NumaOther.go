@@ -0,0 +1,33 @@
+//go:build !linux
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// NUMA aware processing is not supported on this platform (see Numa.go)
+
+type numaNode struct{}
+
+func numaNodes() []*numaNode {
+	return nil
+}
+
+func (this *numaNode) run(task func()) func() {
+	return task
+}
+
+func (this *numaNode) bind(buf []byte) {
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestNumaAware(t *testing.T) {
+	fmt.Println("NUMA Aware Test")
+	nodes := getNumaNodes(map[string]any{"numaAware": true})
+
+	if _, err := os.Stat("/sys/devices/system/node/node0"); err == nil && runtime.GOOS == "linux" && len(nodes) == 0 {
+		t.Errorf("No NUMA node found")
+	}
+
+	if getNumaNodes(map[string]any{}) != nil {
+		t.Errorf("NUMA nodes used without the option")
+	}
+
+	fmt.Printf("%d NUMA node(s)\n", len(nodes))
+
+	// The tasks of all slots run (pinned or not)
+	var wg sync.WaitGroup
+	done := make([]bool, 8)
+
+	for i := range done {
+		i := i
+		wg.Add(1)
+		startSlotTask(nodes, i, func() {
+			defer wg.Done()
+			done[i] = true
+		})
+	}
+
+	wg.Wait()
+
+	for i := range done {
+		if done[i] == false {
+			t.Errorf("Task %d not run", i)
+		}
+	}
+
+	data := make([]byte, 1<<20)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(8))
+	}
+
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, withDefaults(map[string]any{"transform": "LZ", "entropy": "ANS0",
+		"blockSize": uint(64 * 1024), "jobs": uint(4), "numaAware": true}))
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	for i := range w.buffers {
+		if expected := len(nodes) > 0; (w.buffers[i].node != nil) != expected {
+			t.Errorf("Buffer %d: NUMA node set: %v, expected %v", i, w.buffers[i].node != nil, expected)
+		}
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	res, _, err := decompressData(bs.Bytes(), map[string]any{"jobs": uint(4), "numaAware": true})
+
+	if err != nil || bytes.Equal(res, data) == false {
+		t.Errorf("Invalid decompressed data: %v", err)
+	}
+}
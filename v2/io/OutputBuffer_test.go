@@ -0,0 +1,101 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestOutputBufferSize(t *testing.T) {
+	fmt.Println("Output Buffer Size Test")
+
+	for blockSize := uint(1024); blockSize <= 65536; blockSize <<= 1 {
+		floor := min(max(blockSize<<2, _MIN_OUTPUT_BUFFER_FLOOR), _MAX_OUTPUT_BUFFER_FLOOR)
+		size := computeOutputBufferSize(blockSize, blockSize, floor, _DEFAULT_BUFFER_MARGIN)
+		fmt.Printf("Block size: %d, output buffer size: %d\n", blockSize, size)
+
+		if size >= _MAX_OUTPUT_BUFFER_FLOOR {
+			t.Errorf("Output buffer too large for block size %d: %d", blockSize, size)
+		}
+
+		if size < blockSize+(blockSize>>3) {
+			t.Errorf("Output buffer too small for block size %d: %d", blockSize, size)
+		}
+
+		// The post transform length wins if it exceeds the floor
+		if size = computeOutputBufferSize(blockSize, 4*floor, floor, _DEFAULT_BUFFER_MARGIN); size != 4*floor {
+			t.Errorf("Incorrect output buffer size for expanded block of size %d: %d", blockSize, size)
+		}
+	}
+
+	for blockSize := uint(1024); blockSize <= 65536; blockSize <<= 2 {
+		values := make([]byte, 4*blockSize+17)
+
+		for i := range values {
+			values[i] = byte(rand.Intn(256))
+		}
+
+		// Tiny floor and no margin force the output buffer to grow
+		for _, entropy := range []string{"ANS1", "TPAQ", "HUFFMAN"} {
+			fmt.Printf("Block size: %d, entropy: %s\n", blockSize, entropy)
+			bs := internal.NewBufferStream()
+			ctx := make(map[string]any)
+			ctx["entropy"] = entropy
+			ctx["transform"] = "NONE"
+			ctx["blockSize"] = blockSize
+			ctx["jobs"] = uint(2)
+			ctx["checksum"] = uint(32)
+			ctx["bufferFloor"] = uint(0)
+			ctx["bufferMargin"] = uint(16)
+			w, err := NewWriterWithCtx(bs, ctx)
+
+			if err != nil {
+				t.Fatalf("Cannot create writer: %v", err)
+			}
+
+			if _, err = w.Write(values); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			if err = w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			r, err := NewReader(bs, 2)
+
+			if err != nil {
+				t.Fatalf("Cannot create reader: %v", err)
+			}
+
+			res := make([]byte, len(values))
+
+			if _, err = io.ReadFull(r, res); err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+
+			if !bytes.Equal(res, values) {
+				t.Errorf("Roundtrip failed for block size %d, entropy %s", blockSize, entropy)
+			}
+
+			r.Close()
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Output size limit (ctx["maxOutputSize"] = int64, in bytes): protection of
+// the services decoding untrusted data against decompression bombs. The
+// Reader stops with an OutputLimitError once the decoded data exceeds the
+// limit. The buffers of the decoding tasks are sized for blocks of at most
+// the limit (instead of the block size of the header), and the blocks
+// declaring a compressed or pre-transform length that does not fit are
+// rejected before any allocation.
+
+// OutputLimitError an IOError returned by a Reader when the decoded data
+// exceeds the output size limit (ctx["maxOutputSize"]).
+type OutputLimitError struct {
+	IOError
+	Limit int64 // output size limit (bytes)
+}
+
+// newOutputLimitError returns the error of a decoded (or declared) size
+// over the limit
+func newOutputLimitError(what string, size, limit int64) *OutputLimitError {
+	errMsg := fmt.Sprintf("Output size limit exceeded: %s of %d bytes, limit is %d bytes", what, size, limit)
+	return &OutputLimitError{IOError: IOError{msg: errMsg, code: kanzi.ERR_OUTPUT_LIMIT}, Limit: limit}
+}
+
+// getMaxOutputSize returns the output size limit in the context (0 if none)
+func getMaxOutputSize(ctx map[string]any) (int64, error) {
+	val, hasKey := ctx["maxOutputSize"]
+
+	if hasKey == false {
+		return 0, nil
+	}
+
+	maxOutput, ok := val.(int64)
+
+	if ok == false || maxOutput < 0 {
+		return 0, &IOError{msg: fmt.Sprintf("Invalid output size limit: %v", val), code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return maxOutput, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"strings"
+	"testing"
+)
+
+func TestOutputLimit(t *testing.T) {
+	fmt.Println("Output Limit Test")
+	data := []byte(strings.Repeat("Decompression bombs expand a few bytes to gigabytes. ", 20000))
+	size := int64(len(data))
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536),
+		"jobs": uint(4), "archival": true}
+	input := compressData(t, data, ctx)
+
+	// Limit at or above the decoded size
+	for _, limit := range []int64{size, size + 1, 1 << 40} {
+		for _, jobs := range []uint{1, 4} {
+			res, _, err := decompressData(input, map[string]any{"jobs": jobs, "maxOutputSize": limit})
+
+			if err != nil || bytes.Equal(res, data) == false {
+				t.Fatalf("Limit %d, jobs %d: decompression failed: %v", limit, jobs, err)
+			}
+		}
+	}
+
+	// Limit below the decoded size
+	for _, limit := range []int64{1, 65536, size - 1} {
+		for _, jobs := range []uint{1, 4} {
+			res, _, err := decompressData(input, map[string]any{"jobs": jobs, "maxOutputSize": limit})
+			var ole *OutputLimitError
+
+			if errors.As(err, &ole) == false || errors.Is(err, ErrOutputLimit) == false || ole.Limit != limit {
+				t.Fatalf("Limit %d, jobs %d: expected an output limit error, got %v", limit, jobs, err)
+			}
+
+			if int64(len(res)) > limit || bytes.Equal(res, data[0:len(res)]) == false {
+				t.Errorf("Limit %d, jobs %d: invalid partial output (%d bytes)", limit, jobs, len(res))
+			}
+		}
+
+		_, err := DecompressFile(map[string]any{"jobs": uint(4), "maxOutputSize": limit},
+			&slowReaderAt{data: input}, int64(len(input)), &memWriterAt{})
+
+		if errors.Is(err, ErrOutputLimit) == false {
+			t.Errorf("DecompressFile, limit %d: expected an output limit error, got %v", limit, err)
+		}
+	}
+
+	// The strict and best effort modes do not hide the error
+	for _, mode := range []string{"strict", "bestEffort"} {
+		_, _, err := decompressData(input, map[string]any{"jobs": uint(4), "maxOutputSize": int64(100000), mode: true})
+
+		if errors.Is(err, ErrOutputLimit) == false {
+			t.Errorf("Mode %s: expected an output limit error, got %v", mode, err)
+		}
+	}
+
+	// Block size of the header (64 MB) much larger than the limit: the
+	// buffers are sized for the limit and the blocks are rejected before
+	// the inverse transform
+	input = compressData(t, data, map[string]any{"transform": "LZ", "entropy": "ANS0",
+		"blockSize": uint(64 << 20), "jobs": uint(1)})
+	r := mustReader(t, input, map[string]any{"jobs": uint(1), "maxOutputSize": int64(4096)})
+	res := make([]byte, 4096)
+	n, err := r.Read(res)
+	var ole *OutputLimitError
+
+	if errors.As(err, &ole) == false || n != 0 {
+		t.Errorf("Expected an output limit error, got %d bytes, %v", n, err)
+	}
+
+	if r.blockSize != 64<<20 || r.taskBlockSize() > 4096+_EXTRA_BUFFER_SIZE {
+		t.Errorf("Invalid task buffer size for a block size of %d bytes: %d", r.blockSize, r.taskBlockSize())
+	}
+
+	r.Close()
+
+	// Invalid limits
+	for _, limit := range []any{int64(-1), 1024, uint(1024), "1024"} {
+		if _, err := NewReaderWithCtx(internal.NewBufferStream(input), map[string]any{"jobs": uint(1), "maxOutputSize": limit}); err == nil {
+			t.Errorf("Expected an error for the output size limit %v", limit)
+		}
+	}
+
+	if _, err := (ReaderOptions{MaxOutputSize: -1}).Context(); err == nil {
+		t.Errorf("Expected an error for a negative output size limit")
+	}
+
+	if ctx, _ := (ReaderOptions{MaxOutputSize: 4096}).Context(); ctx["maxOutputSize"] != int64(4096) {
+		t.Errorf("Invalid context for the output size limit: %v", ctx["maxOutputSize"])
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"io"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const (
+	_PIPE_DEFAULT_BLOCK_SIZE = 1024 * 1024
+	_PIPE_BUFFER_SIZE        = 1024 * 1024 // max compressed bytes pending in the pipe
+)
+
+// streamContext returns the context map of a Writer built from the options
+func (this Options) streamContext() map[string]any {
+	ctx := make(map[string]any)
+	ctx["transform"] = this.Transform
+	ctx["entropy"] = this.Entropy
+	ctx["blockSize"] = this.BlockSize
+	ctx["jobs"] = this.Jobs
+	ctx["checksum"] = this.Checksum
+
+	if this.Transform == "" {
+		ctx["transform"] = "NONE"
+	}
+
+	if this.Entropy == "" {
+		ctx["entropy"] = "NONE"
+	}
+
+	if this.BlockSize == 0 {
+		ctx["blockSize"] = uint(_PIPE_DEFAULT_BLOCK_SIZE)
+	}
+
+	if this.Jobs == 0 {
+		ctx["jobs"] = uint(1)
+	}
+
+	return ctx
+}
+
+// PipeWriter the write end of a compressed pipe
+type PipeWriter struct {
+	writer *Writer
+	buffer *pipeBuffer
+}
+
+// PipeReader the read end of a compressed pipe
+type PipeReader struct {
+	reader *Reader
+	buffer *pipeBuffer
+}
+
+// Pipe creates an in-memory pipe similar to io.Pipe where the data written
+// to the write end is compressed into a bounded internal buffer and
+// decompressed when read from the read end.
+// The data written becomes readable once a block is complete or after a
+// call to Flush or Close. Writes block when the internal buffer is full,
+// hence the two ends must be used from different goroutines.
+// Opts.Jobs is the number of concurrent compression jobs.
+func Pipe(opts Options) (*PipeWriter, *PipeReader, error) {
+	buffer := newPipeBuffer(_PIPE_BUFFER_SIZE)
+	ctx := opts.streamContext()
+	w, err := NewWriterWithCtx(buffer, ctx)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Decode one block at a time: decoding tasks read their blocks before
+	// starting and would wait for data not flushed yet.
+	r, err := NewReaderWithCtx(buffer, map[string]any{"jobs": uint(1)})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &PipeWriter{writer: w, buffer: buffer}, &PipeReader{reader: r, buffer: buffer}, nil
+}
+
+// Write compresses the data in block. It returns an error if the read
+// end has been closed.
+func (this *PipeWriter) Write(block []byte) (int, error) {
+	return this.writer.Write(block)
+}
+
+// Flush makes the data written so far available to the read end
+func (this *PipeWriter) Flush() error {
+	return this.writer.Flush()
+}
+
+// Close completes the compressed stream. The read end returns io.EOF
+// once all the data has been read.
+func (this *PipeWriter) Close() error {
+	return this.CloseWithError(nil)
+}
+
+// CloseWithError closes the write end. The read end returns the provided
+// error (if not nil) instead of io.EOF.
+func (this *PipeWriter) CloseWithError(err error) error {
+	var res error
+
+	if err == nil {
+		res = this.writer.Close()
+		err = res
+	}
+
+	this.buffer.closeWrite(err)
+	return res
+}
+
+// Read decompresses up to len(block) bytes into block
+func (this *PipeReader) Read(block []byte) (int, error) {
+	n, err := this.reader.Read(block)
+
+	if err != nil && err != io.EOF {
+		// Report the error of the write end if any
+		if wErr := this.buffer.writeError(); wErr != nil && wErr != io.EOF {
+			return n, wErr
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the read end. Subsequent writes to the write end fail.
+func (this *PipeReader) Close() error {
+	this.buffer.closeRead()
+	return this.reader.Close()
+}
+
+// pipeBuffer a bounded FIFO of compressed bytes shared by both ends of a pipe
+type pipeBuffer struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	data   []byte
+	start  int
+	end    int
+	wErr   error // set when the write end is closed
+	closed bool  // set when the read end is closed
+}
+
+func newPipeBuffer(size int) *pipeBuffer {
+	this := &pipeBuffer{data: make([]byte, size)}
+	this.cond = sync.NewCond(&this.lock)
+	return this
+}
+
+// Write blocks until all the bytes have been copied to the buffer
+func (this *pipeBuffer) Write(block []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	n := 0
+
+	for n < len(block) {
+		for this.closed == false && this.wErr == nil && this.end-this.start == len(this.data) {
+			this.cond.Wait()
+		}
+
+		if this.closed == true || this.wErr != nil {
+			return n, &IOError{msg: "Write to closed pipe", code: kanzi.ERR_WRITE_FILE}
+		}
+
+		if this.end == len(this.data) {
+			// Compact
+			copy(this.data, this.data[this.start:this.end])
+			this.end -= this.start
+			this.start = 0
+		}
+
+		k := copy(this.data[this.end:], block[n:])
+		this.end += k
+		n += k
+		this.cond.Broadcast()
+	}
+
+	return n, nil
+}
+
+// Read blocks until some bytes are available or the write end is closed
+func (this *pipeBuffer) Read(block []byte) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	for this.closed == false && this.wErr == nil && this.start == this.end {
+		this.cond.Wait()
+	}
+
+	if this.closed == true {
+		return 0, &IOError{msg: "Read from closed pipe", code: kanzi.ERR_READ_FILE}
+	}
+
+	if this.start == this.end {
+		return 0, this.wErr
+	}
+
+	n := copy(block, this.data[this.start:this.end])
+	this.start += n
+
+	if this.start == this.end {
+		this.start = 0
+		this.end = 0
+	}
+
+	this.cond.Broadcast()
+	return n, nil
+}
+
+// Close does nothing: each end of the pipe closes its side explicitly
+func (this *pipeBuffer) Close() error {
+	return nil
+}
+
+func (this *pipeBuffer) closeWrite(err error) {
+	this.lock.Lock()
+
+	if err == nil {
+		err = io.EOF
+	}
+
+	if this.wErr == nil {
+		this.wErr = err
+	}
+
+	this.cond.Broadcast()
+	this.lock.Unlock()
+}
+
+func (this *pipeBuffer) closeRead() {
+	this.lock.Lock()
+	this.closed = true
+	this.cond.Broadcast()
+	this.lock.Unlock()
+}
+
+func (this *pipeBuffer) writeError() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.wErr
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	fmt.Println("Pipe Test")
+	opts := Options{Transform: "LZ", Entropy: "HUFFMAN", BlockSize: 64 * 1024, Jobs: 4}
+	pw, pr, err := Pipe(opts)
+
+	if err != nil {
+		t.Fatalf("Cannot create pipe: %v", err)
+	}
+
+	// More data than the internal buffer can hold
+	input := make([]byte, 8*1024*1024)
+
+	for i := range input {
+		input[i] = byte(rand.Intn(16) + 'a')
+	}
+
+	go func() {
+		for i := 0; i < len(input); i += 100000 {
+			if _, err := pw.Write(input[i:min(i+100000, len(input))]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+
+		pw.Close()
+	}()
+
+	output, err := io.ReadAll(pr)
+
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if bytes.Equal(input, output) == false {
+		t.Errorf("Invalid output: got %d bytes, expected %d", len(output), len(input))
+	}
+
+	pr.Close()
+
+	// Flush makes data available before the block is complete
+	pw, pr, _ = Pipe(opts)
+	go func() {
+		pw.Write([]byte("hello"))
+		pw.Flush()
+	}()
+
+	buf := make([]byte, 5)
+
+	if _, err := io.ReadFull(pr, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("Flush failed: %q, %v", buf, err)
+	}
+
+	// The error of the write end is reported by the read end
+	failure := errors.New("producer failure")
+	pw.CloseWithError(failure)
+
+	if _, err := pr.Read(buf); errors.Is(err, failure) == false {
+		t.Errorf("Expected producer error, got %v", err)
+	}
+
+	// Writing after the read end is closed fails
+	pw, pr, _ = Pipe(opts)
+	pr.Close()
+	pw.Write(input[0 : 256*1024])
+
+	if err := pw.Close(); err == nil {
+		t.Errorf("Expected error when writing to a pipe with a closed read end")
+	}
+
+	if _, _, err := Pipe(Options{Transform: "FOO"}); err == nil {
+		t.Errorf("Expected error on invalid transform")
+	}
+}
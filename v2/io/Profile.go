@@ -0,0 +1,61 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"context"
+	"expvar"
+	"runtime/pprof"
+	"time"
+)
+
+// Profiling (ctx["profile"] = true): the stages of the encoding and decoding
+// tasks run with pprof labels ("kanzi.stage" and "kanzi.codec") so that CPU
+// profiles attribute the time to the stages instead of the task goroutines.
+// The calls, bytes (input of the stage) and time in nanoseconds of each
+// stage are added to the expvar map "kanzi" (EG. "entropy.encode.ns").
+
+const (
+	_STAGE_TRANSFORM_FORWARD = "transform.forward"
+	_STAGE_TRANSFORM_INVERSE = "transform.inverse"
+	_STAGE_ENTROPY_ENCODE    = "entropy.encode"
+	_STAGE_ENTROPY_DECODE    = "entropy.decode"
+	_STAGE_BITSTREAM_WRITE   = "bitstream.write"
+	_STAGE_BITSTREAM_READ    = "bitstream.read"
+)
+
+var _PROFILE_COUNTERS = expvar.NewMap("kanzi")
+
+// profileStage runs fn, with the labels of the stage and updating the
+// counters if profiling is enabled in ctx
+func profileStage(ctx map[string]any, stage, codec string, size int, fn func()) {
+	if enabled, _ := ctx["profile"].(bool); enabled == false {
+		fn()
+		return
+	}
+
+	labels := pprof.Labels("kanzi.stage", stage)
+
+	if codec != "" {
+		labels = pprof.Labels("kanzi.stage", stage, "kanzi.codec", codec)
+	}
+
+	start := time.Now()
+	pprof.Do(context.Background(), labels, func(context.Context) { fn() })
+	_PROFILE_COUNTERS.Add(stage+".calls", 1)
+	_PROFILE_COUNTERS.Add(stage+".bytes", int64(size))
+	_PROFILE_COUNTERS.Add(stage+".ns", int64(time.Since(start)))
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	fmt.Println("Profile Test")
+	data := []byte{}
+
+	for i := 0; i < 20000; i++ {
+		data = append(data, fmt.Sprintf("%d: the quick brown fox jumps over the lazy dog. ", i*i)...)
+	}
+
+	counter := func(name string) int64 {
+		if v, ok := _PROFILE_COUNTERS.Get(name).(*expvar.Int); ok == true {
+			return v.Value()
+		}
+
+		return 0
+	}
+
+	stages := []string{_STAGE_TRANSFORM_FORWARD, _STAGE_ENTROPY_ENCODE, _STAGE_BITSTREAM_WRITE,
+		_STAGE_BITSTREAM_READ, _STAGE_ENTROPY_DECODE, _STAGE_TRANSFORM_INVERSE}
+	calls := make(map[string]int64)
+
+	for _, s := range stages {
+		calls[s] = counter(s + ".calls")
+	}
+
+	wCtx := map[string]any{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "blockSize": uint(65536), "jobs": uint(4)}
+	rCtx := map[string]any{"jobs": uint(4)}
+	roundTrip(t, data, wCtx, rCtx)
+
+	for _, s := range stages {
+		if counter(s+".calls") != calls[s] {
+			t.Errorf("Stage %s: unexpected calls without profiling", s)
+		}
+	}
+
+	wCtx["profile"] = true
+	rCtx["profile"] = true
+	roundTrip(t, data, wCtx, rCtx)
+	blocks := int64((len(data) + 65535) / 65536)
+
+	for _, s := range stages {
+		if n := counter(s+".calls") - calls[s]; n != blocks {
+			t.Errorf("Stage %s: expected %d calls, got %d", s, blocks, n)
+		}
+
+		if counter(s+".bytes") <= 0 || counter(s+".ns") <= 0 {
+			t.Errorf("Stage %s: missing bytes or time", s)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/listeners"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type progressCollector struct {
+	lock   sync.Mutex
+	events []*kanzi.Event
+}
+
+func (this *progressCollector) ProcessEvent(evt *kanzi.Event) {
+	if _, ok := evt.Progress(); ok == false {
+		return
+	}
+
+	this.lock.Lock()
+	this.events = append(this.events, evt)
+	this.lock.Unlock()
+}
+
+func TestProgress(t *testing.T) {
+	fmt.Println("Progress Test")
+	data := []byte(strings.Repeat("Progress is reported after each block. ", 20000))
+	blockSize := 65536
+	nbBlocks := (len(data) + blockSize - 1) / blockSize
+
+	checkEvents := func(events []*kanzi.Event, evtType int, input, output int64) {
+		if len(events) != nbBlocks {
+			t.Fatalf("Expected %d progress events, got %d", nbBlocks, len(events))
+		}
+
+		var prev kanzi.Progress
+
+		for i, evt := range events {
+			p, _ := evt.Progress()
+
+			if evt.Type() != evtType || evt.ID() != i+1 || p.InputBytes <= prev.InputBytes || p.OutputBytes <= prev.OutputBytes {
+				t.Errorf("Unexpected progress event: %v", evt)
+			}
+
+			prev = p
+		}
+
+		if prev.InputBytes > input || prev.OutputBytes > output || prev.TotalBytes != int64(len(data)) {
+			t.Errorf("Unexpected final progress: %+v", prev)
+		}
+
+		if percent, ok := events[len(events)-1].Percent(); ok == false || percent != 100 {
+			t.Errorf("Unexpected final percentage: %v", percent)
+		}
+	}
+
+	collector := &progressCollector{}
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(blockSize),
+		"jobs": uint(4), "checksum": uint(0), "fileSize": int64(len(data))})
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	w.AddListener(collector)
+	w.Write(data)
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	output := bs.Bytes()
+	checkEvents(collector.events, kanzi.EVT_COMPRESSION_PROGRESS, int64(len(data)), int64(len(output)))
+
+	collector = &progressCollector{}
+	var sb strings.Builder
+	r, err := NewReaderWithCtx(internal.NewBufferStream(output), map[string]any{"jobs": uint(4)})
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	r.AddListener(collector)
+	r.AddListener(listeners.NewProgressListener(&sb))
+
+	if _, err = io.ReadAll(r); err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	r.Close()
+	checkEvents(collector.events, kanzi.EVT_DECOMPRESSION_PROGRESS, int64(len(output)), int64(len(data)))
+
+	if strings.Contains(sb.String(), "100.0%") == false {
+		t.Errorf("Unexpected progress output: %q", sb.String())
+	}
+}
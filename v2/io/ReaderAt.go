@@ -0,0 +1,166 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Parallel reads: when the input supports io.ReaderAt (EG. a file), each
+// block of a batch (one block per job) is read by its own goroutine with
+// ReadAt instead of being funneled through a single sequential Read, so
+// that fast storage and the encoding tasks are both kept busy. The stream
+// is identical to the one produced by writing the input to a Writer.
+
+// CompressFile compresses the first size bytes of src to dst with the
+// parameters in ctx (same keys as NewWriterWithCtx, the missing ones get
+// default values) and returns the size of the compressed stream. The size
+// of the input is stored in the header unless ctx["fileSize"] is provided.
+// dst is not closed.
+func CompressFile(ctx map[string]any, src io.ReaderAt, size int64, dst io.Writer) (int64, error) {
+	if size < 0 {
+		errMsg := fmt.Sprintf("Invalid input size: %d", size)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	params := withDefaults(ctx)
+
+	if _, hasKey := params["fileSize"]; hasKey == false {
+		params["fileSize"] = size
+	}
+
+	w, err := NewWriterWithCtx(nopWriteCloser{dst}, params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err = w.writeFrom(src, size); err != nil {
+		return int64(w.GetWritten()), err
+	}
+
+	if err = w.Close(); err != nil {
+		return int64(w.GetWritten()), err
+	}
+
+	return int64(w.GetWritten()), nil
+}
+
+// writeFrom writes the first size bytes of src. Content defined blocks
+// (see Rsyncable.go) require a sequential scan of the input.
+func (this *Writer) writeFrom(src io.ReaderAt, size int64) error {
+	if this.chunker != nil {
+		_, err := io.Copy(this, io.NewSectionReader(src, 0, size))
+		return err
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if loadInt32(&this.closed) == 1 {
+		return &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if this.compact == true && size > this.inputSize {
+		this.compact = false
+	}
+
+	if this.available != 0 {
+		return &IOError{msg: "Cannot read blocks in parallel: data already buffered", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	batchSize := int64(this.jobs) * int64(this.blockSize)
+
+	for off := int64(0); off < size; {
+		n := int(min(size-off, batchSize))
+
+		if err := this.readBatch(src, off, n); err != nil {
+			return err
+		}
+
+		off += int64(n)
+		this.available = n
+
+		// Like Write, keep a partial batch for Close (compact framing)
+		if int64(n) == batchSize {
+			if err := this.processBlock(false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readBatch reads n bytes of src at offset off into the block buffers,
+// one goroutine per block
+func (this *Writer) readBatch(src io.ReaderAt, off int64, n int) error {
+	blocks := (n + this.blockSize - 1) / this.blockSize
+	errs := make([]error, blocks)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < blocks; i++ {
+		if len(this.buffers[i].Buf) < this.blockSize {
+			this.buffers[i].grow(max(this.blockSize+this.blockSize>>6, 65536), false)
+		}
+
+		buf := this.buffers[i].Buf[0:min(n-i*this.blockSize, this.blockSize)]
+		pos := off + int64(i*this.blockSize)
+		err := &errs[i]
+		wg.Add(1)
+
+		startTask(func() {
+			defer wg.Done()
+
+			// ReadAt may return io.EOF with a full read at the end of the input
+			if m, e := src.ReadAt(buf, pos); m < len(buf) {
+				*err = e
+
+				if e == nil || e == io.EOF {
+					*err = io.ErrUnexpectedEOF
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+
+	for i := 0; i < blocks; i++ {
+		if errs[i] != nil {
+			errMsg := fmt.Sprintf("Cannot read block at offset %d: %v", off+int64(i*this.blockSize), errs[i])
+			return &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE, cause: errs[i]}
+		}
+	}
+
+	// The digests of the whole input are computed in order
+	for i := 0; i < blocks; i++ {
+		block := this.buffers[i].Buf[0:min(n-i*this.blockSize, this.blockSize)]
+
+		if this.archive != nil {
+			this.archive.update(block)
+		}
+
+		if this.footer != nil {
+			this.footer.update(block)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowReaderAt records the max number of concurrent reads
+type slowReaderAt struct {
+	data    []byte
+	err     error // returned for reads past 'failAt' (if not nil)
+	failAt  int64
+	current int32
+	max     int32
+}
+
+func (this *slowReaderAt) ReadAt(buf []byte, off int64) (int, error) {
+	n := atomic.AddInt32(&this.current, 1)
+	defer atomic.AddInt32(&this.current, -1)
+
+	for m := atomic.LoadInt32(&this.max); n > m; m = atomic.LoadInt32(&this.max) {
+		if atomic.CompareAndSwapInt32(&this.max, m, n) == true {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if this.err != nil && off >= this.failAt {
+		return 0, this.err
+	}
+
+	return bytes.NewReader(this.data).ReadAt(buf, off)
+}
+
+func TestCompressFile(t *testing.T) {
+	fmt.Println("Compress File Test")
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20000)
+
+	for i := 0; i < 10000; i++ {
+		data[rand.Intn(len(data))] = byte(rand.Intn(256))
+	}
+
+	for _, ctx := range []map[string]any{
+		{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536), "jobs": uint(4), "checksum": uint(32)},
+		{"transform": "NONE", "entropy": "NONE", "blockSize": uint(65536), "jobs": uint(2)},
+		{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "blockSize": uint(65536), "jobs": uint(4), "rsyncable": true},
+		{"transform": "LZ", "entropy": "ANS0", "compact": true},
+	} {
+		for _, size := range []int{0, 1000, 4 * 65536, len(data)} {
+			src := &slowReaderAt{data: data[0:size]}
+			var dst bytes.Buffer
+			n, err := CompressFile(ctx, src, int64(size), &dst)
+
+			if err != nil {
+				t.Fatalf("CompressFile failed: %v", err)
+			}
+
+			if n != int64(dst.Len()) {
+				t.Errorf("Invalid compressed size: %d, expected %d", n, dst.Len())
+			}
+
+			// Same stream as the sequential writes
+			params := withDefaults(ctx)
+			params["fileSize"] = int64(size)
+
+			if expected := compressData(t, data[0:size], params); bytes.Equal(expected, dst.Bytes()) == false {
+				t.Errorf("Invalid stream for %v (size %d)", ctx, size)
+			}
+
+			res, _, err := decompressData(dst.Bytes(), nil)
+
+			if err != nil || bytes.Equal(res, data[0:size]) == false {
+				t.Fatalf("Decompression failed: %v", err)
+			}
+
+			// Content defined blocks are read sequentially
+			if _SINGLE_THREAD == false && ctx["jobs"] == uint(4) && ctx["rsyncable"] == nil && size == len(data) && atomic.LoadInt32(&src.max) < 2 {
+				t.Errorf("Blocks not read concurrently")
+			}
+		}
+	}
+
+	// Read error and short input
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536), "jobs": uint(4)}
+	failure := errors.New("disk failure")
+	src := &slowReaderAt{data: data, err: failure, failAt: 3 * 65536}
+
+	if _, err := CompressFile(ctx, src, int64(len(data)), io.Discard); errors.Is(err, failure) == false {
+		t.Errorf("Expected read error, got %v", err)
+	}
+
+	if _, err := CompressFile(ctx, bytes.NewReader(data), int64(len(data)+1), io.Discard); errors.Is(err, io.ErrUnexpectedEOF) == false {
+		t.Errorf("Expected unexpected EOF error, got %v", err)
+	}
+}
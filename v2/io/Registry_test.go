@@ -0,0 +1,158 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+func TestUserTransform(t *testing.T) {
+	fmt.Println("User Transform Test")
+	values := make([]byte, 200000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(4) * 64)
+	}
+
+	var forward, inverse int32
+
+	err := transform.Register("myrlt", 40, func(ctx *map[string]any) (kanzi.ByteTransform, error) {
+		t, err := transform.NewRLTWithCtx(ctx)
+		return &countingTransform{ByteTransform: t, forward: &forward, inverse: &inverse}, err
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot register transform: %v", err)
+	}
+
+	tType, err := transform.GetType("MYRLT+LZ")
+
+	if err != nil {
+		t.Fatalf("Cannot get the type of the sequence: %v", err)
+	}
+
+	if name, _ := transform.GetName(tType); name != "MYRLT+LZ" {
+		t.Errorf("Incorrect name of the sequence: %s", name)
+	}
+
+	bs := internal.NewBufferStream()
+	w, _ := NewWriter(bs, "myrlt+LZ", "HUFFMAN", 65536, 2, 32, 0, false)
+	w.Write(values)
+	w.Close()
+	compressed := bytes.Clone(bs.Bytes())
+	r, _ := NewReaderWithCtx(internal.NewBufferStream(bytes.Clone(compressed)), map[string]any{"jobs": uint(2)})
+	res, err := io.ReadAll(r)
+
+	if err != nil || !bytes.Equal(res, values) {
+		t.Fatalf("Incorrect decompressed data: %v", err)
+	}
+
+	if forward != 4 || inverse != 4 {
+		t.Errorf("Expected 4 forward and inverse calls, got %d and %d", forward, inverse)
+	}
+
+	factory := func(ctx *map[string]any) (kanzi.ByteTransform, error) { return transform.NewNullTransformWithCtx(ctx) }
+
+	if transform.Register("LZ", 41, factory) == nil || transform.Register("other", 40, factory) == nil ||
+		transform.Register("other", 10, factory) == nil || transform.Register("a+b", 41, factory) == nil {
+		t.Errorf("Expected error on invalid registration")
+	}
+
+	if transform.Unregister("MYRLT") == false {
+		t.Errorf("Cannot unregister transform")
+	}
+
+	// The decoder cannot find the transform anymore
+	r, _ = NewReaderWithCtx(internal.NewBufferStream(compressed), map[string]any{"jobs": uint(1)})
+
+	if _, err = io.ReadAll(r); err == nil {
+		t.Errorf("Expected error on unknown transform")
+	}
+}
+
+func TestUserEntropyCodec(t *testing.T) {
+	fmt.Println("User Entropy Codec Test")
+	values := make([]byte, 200000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16))
+	}
+
+	var encoders, decoders int32
+
+	encFactory := func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error) {
+		atomic.AddInt32(&encoders, 1)
+		return entropy.NewHuffmanEncoder(obs)
+	}
+
+	decFactory := func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error) {
+		atomic.AddInt32(&decoders, 1)
+		return entropy.NewHuffmanDecoderWithCtx(ibs, &ctx)
+	}
+
+	err := entropy.Register("myhuff", 20, encFactory, decFactory)
+
+	if err != nil {
+		t.Fatalf("Cannot register entropy codec: %v", err)
+	}
+
+	if eType, _ := entropy.GetType("MyHuff"); eType != 20 {
+		t.Errorf("Incorrect entropy codec type: %d", eType)
+	}
+
+	bs := internal.NewBufferStream()
+	w, _ := NewWriter(bs, "NONE", "MYHUFF", 65536, 2, 32, 0, false)
+	w.Write(values)
+	w.Close()
+	compressed := bytes.Clone(bs.Bytes())
+
+	if len(compressed) >= len(values)*3/4 {
+		t.Errorf("No compression gain with the registered codec")
+	}
+
+	r, _ := NewReaderWithCtx(internal.NewBufferStream(bytes.Clone(compressed)), map[string]any{"jobs": uint(2)})
+	res, err := io.ReadAll(r)
+
+	if err != nil || !bytes.Equal(res, values) {
+		t.Fatalf("Incorrect decompressed data: %v", err)
+	}
+
+	if encoders != 4 || decoders != 4 {
+		t.Errorf("Expected 4 encoders and decoders, got %d and %d", encoders, decoders)
+	}
+
+	if entropy.Register("ANS0", 21, encFactory, decFactory) == nil || entropy.Register("other", 20, encFactory, decFactory) == nil ||
+		entropy.Register("other", 9, encFactory, decFactory) == nil {
+		t.Errorf("Expected error on invalid registration")
+	}
+
+	if entropy.Unregister("MYHUFF") == false {
+		t.Errorf("Cannot unregister entropy codec")
+	}
+
+	if _, err = entropy.GetName(20); err == nil {
+		t.Errorf("Expected error on unregistered entropy codec")
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+)
+
+// Reset: a Writer or a Reader can be reused for a new stream with the
+// parameters given to its constructor, EG. one stream per connection in a
+// server. The instance, the buffer of the bitstream, the table of block
+// buffers and the listeners are kept. The block buffers released by Close
+// are taken back from the buffer pool (internal.DefaultBufferPool), so that
+// a reused instance does not allocate new multi-MB buffers for each stream.
+// Reset must not be called concurrently with other methods.
+
+// Reset discards the state of the Writer and starts a new stream on os. The
+// current stream is not completed: call Close first. The encrypted streams
+// get a new salt. A multi-volume Writer cannot be reset.
+func (this *Writer) Reset(os io.WriteCloser) error {
+	if os == nil {
+		return &IOError{msg: "Invalid null output stream parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.volumes != nil {
+		return &IOError{msg: "A multi-volume writer cannot be reset", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	// The buffer of the default bitstream is reused
+	var obs kanzi.OutputBitStream
+	var err error
+
+	if dobs, ok := this.obs.(*bitstream.DefaultOutputBitStream); ok == true {
+		obs, err = dobs, dobs.Reset(os)
+	} else {
+		obs, err = bitstream.NewDefaultOutputBitStream(os, _STREAM_DEFAULT_BUFFER_SIZE)
+	}
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot create output bit stream: %v", err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+	}
+
+	this.lock.Lock()
+
+	if this.flushTimer != nil {
+		this.flushTimer.Stop()
+	}
+
+	buffers, listeners, options := this.buffers, this.listeners, this.options
+	this.lock.Unlock()
+	*this = Writer{buffers: buffers, listeners: listeners}
+	return this.init(obs, cloneContext(options))
+}
+
+// Reset discards the state of the Reader and starts reading a new stream
+// from is. The current stream is not closed.
+func (this *Reader) Reset(is io.ReadCloser) error {
+	if is == nil {
+		return &IOError{msg: "Invalid null input stream parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	var ibs kanzi.InputBitStream
+	var err error
+
+	if dibs, ok := this.ibs.(*bitstream.DefaultInputBitStream); ok == true {
+		ibs, err = dibs, dibs.Reset(is)
+	} else {
+		ibs, err = bitstream.NewDefaultInputBitStream(is, _STREAM_DEFAULT_BUFFER_SIZE)
+	}
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Cannot create input bit stream: %v", err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+	}
+
+	buffers, listeners, options := this.buffers, this.listeners, this.options
+	*this = Reader{buffers: buffers, listeners: listeners}
+
+	if err := this.init(ibs, cloneContext(options)); err != nil {
+		return err
+	}
+
+	this.source = is
+	return nil
+}
+
+// cloneContext returns a shallow copy of the parameters of a stream
+func cloneContext(ctx map[string]any) map[string]any {
+	res := make(map[string]any, len(ctx))
+
+	for k, v := range ctx {
+		res[k] = v
+	}
+
+	return res
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestReset(t *testing.T) {
+	fmt.Println("Reset Test")
+
+	key := bytes.Repeat([]byte{0x5A}, 32)
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 4000)
+
+	configs := []map[string]any{
+		{"transform": "LZ", "entropy": "HUFFMAN", "checksum": uint(32), "jobs": uint(2)},
+		{"transform": "TEXT+BWT+MTFT+ZRLT", "entropy": "ANS1", "checksum": uint(64), "footer": true},
+		{"transform": "BWT", "entropy": "CM", "blockSize": uint(32768), "cipher": "AES-GCM", "key": key},
+		{"transform": "LZX", "entropy": "NONE", "blockSize": uint(32768), "linkedBlocks": true},
+		{"transform": "NONE", "entropy": "NONE"},
+	}
+
+	for i, cfg := range configs {
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, withDefaults(cfg))
+
+		if err != nil {
+			t.Fatalf("Config %d: cannot create writer: %v", i, err)
+		}
+
+		collector := &eventCollector{eventType: kanzi.EVT_AFTER_HEADER_DECODING}
+		rCtx := map[string]any{"jobs": uint(2), "key": key}
+		r, err := NewReaderWithCtx(internal.NewBufferStream(), rCtx)
+
+		if err != nil {
+			t.Fatalf("Config %d: cannot create reader: %v", i, err)
+		}
+
+		r.AddListener(collector)
+		obs, ibs, buffers := w.obs, r.ibs, &w.buffers[0]
+		var previous []byte
+
+		for n := 0; n < 3; n++ {
+			data := text[n*1000:]
+			out := internal.NewBufferStream()
+
+			// The first stream is reset before completion
+			if err := w.Reset(out); err != nil {
+				t.Fatalf("Config %d: writer reset failed: %v", i, err)
+			}
+
+			if _, err := w.Write(data); err != nil {
+				t.Fatalf("Config %d: write failed: %v", i, err)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatalf("Config %d: close failed: %v", i, err)
+			}
+
+			if previous != nil && cfg["cipher"] != nil && bytes.Equal(out.Bytes()[:32], previous[:32]) == true {
+				t.Errorf("Config %d: same header with a new salt", i)
+			}
+
+			if expected := compressData(t, data, cfg); cfg["cipher"] == nil && bytes.Equal(out.Bytes(), expected) == false {
+				t.Errorf("Config %d: reset writer output differs from a new writer output", i)
+			}
+
+			previous = out.Bytes()
+
+			if err := r.Reset(internal.NewBufferStream(previous)); err != nil {
+				t.Fatalf("Config %d: reader reset failed: %v", i, err)
+			}
+
+			res, err := io.ReadAll(r)
+
+			if err != nil || bytes.Equal(res, data) == false {
+				t.Fatalf("Config %d: stream %d: invalid decompressed data: %v", i, n, err)
+			}
+
+			r.Close()
+		}
+
+		if w.obs != obs || r.ibs != ibs || &w.buffers[0] != buffers {
+			t.Errorf("Config %d: bitstreams or buffers not reused", i)
+		}
+
+		if len(collector.events) != 3 {
+			t.Errorf("Config %d: expected 3 header events, got %d", i, len(collector.events))
+		}
+	}
+
+	if err := (&Writer{volumes: &volumeWriter{}}).Reset(internal.NewBufferStream()); err == nil {
+		t.Errorf("Missing error for a multi-volume writer")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Sync markers (ctx["syncMarkers"] = true): each block (and the end block)
+// is preceded by a 32 bit marker aligned on a byte boundary (the bits up to
+// the boundary are zero). In best effort mode (see BestEffort.go), when the
+// marker is not found where the block is expected (EG. the length of the
+// previous block is corrupted) or the block length is not valid, the input
+// is scanned for the next marker and the decoding resumes from there: the
+// loss of a corrupted region is limited to the blocks it overlaps instead
+// of the rest of the stream. The skipped region is reported to the
+// ctx["onCorruptedBlock"] callback with the ID of the block decoded after
+// it. The blocks following a lost block get the next IDs: the encrypted
+// blocks and the repeat records (dedup) after it cannot be decoded.
+
+const (
+	_SYNC_MARKER = 0x4B5A5359 // "KZSY"
+)
+
+// writeSyncMarker pads the bitstream to a byte boundary and writes a sync
+// marker
+func writeSyncMarker(obs kanzi.OutputBitStream) {
+	if pad := uint(8-(obs.Written()&7)) & 7; pad != 0 {
+		obs.WriteBits(0, pad)
+	}
+
+	obs.WriteBits(_SYNC_MARKER, 32)
+}
+
+// syncMarkerBits returns the max size in bits of a sync marker and its
+// padding (0 if the blocks have no marker)
+func (this *Writer) syncMarkerBits() uint64 {
+	if this.syncMarkers == false {
+		return 0
+	}
+
+	return 32 + 7
+}
+
+// readBlockLength reads the sync marker (if any) and the length in bits of
+// the next block. In best effort mode, a missing marker or an invalid block
+// length starts a scan of the input for the next marker and the skipped
+// region is recorded in the result.
+func (this *decodingTask) readBlockLength(res *decodingTaskResult) (uint64, *IOError) {
+	if this.syncMarkers == false {
+		lr := uint(this.ibs.ReadBits(5)) + 3
+		return this.ibs.ReadBits(lr), nil
+	}
+
+	start := this.ibs.Read()
+	expected := (start + 7) &^ 7
+	maxBits := 16*uint64(this.blockLength) + 8*_STRICT_BLOCK_MARGIN
+
+	for {
+		if pad := uint(8-(this.ibs.Read()&7)) & 7; pad != 0 {
+			this.ibs.ReadBits(pad)
+		}
+
+		pos := this.ibs.Read()
+		marker := uint32(this.ibs.ReadBits(32))
+
+		for marker != _SYNC_MARKER {
+			if this.bestEffort == false {
+				return 0, &IOError{msg: "Invalid bitstream: missing sync marker", code: kanzi.ERR_INVALID_FILE}
+			}
+
+			marker = (marker << 8) | uint32(this.ibs.ReadBits(8))
+			pos += 8
+		}
+
+		lr := uint(this.ibs.ReadBits(5)) + 3
+		read := this.ibs.ReadBits(lr)
+
+		if this.bestEffort == false || read <= maxBits {
+			if pos != expected {
+				res.resyncStart = start
+				res.resyncEnd = pos
+			}
+
+			return read, nil
+		}
+
+		// Corrupted block length: skip to the next marker
+	}
+}
+
+// reportResync reports the region of the input skipped to find a sync
+// marker
+func (this *Reader) reportResync(r *decodingTaskResult, decodedOffset int64) {
+	this.damaged++
+
+	if this.onCorrupted == nil {
+		return
+	}
+
+	err := &IOError{msg: "Missing sync marker", code: kanzi.ERR_INVALID_FILE}
+
+	this.onCorrupted(CorruptedBlock{
+		Segment:       len(this.segments) - 1,
+		BlockID:       r.blockID,
+		Start:         r.resyncStart >> 3,
+		End:           r.resyncEnd >> 3,
+		DecodedOffset: decodedOffset,
+		Err:           newDecodingError(err, r.blockID, r.resyncStart),
+	})
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSyncMarkers(t *testing.T) {
+	fmt.Println("Sync Markers Test")
+
+	const blockSize = 32768
+	data := make([]byte, 0, 8*blockSize)
+
+	for i := 0; len(data) < 8*blockSize; i++ {
+		data = append(data, fmt.Sprintf("Block %d, line %d: the quick brown fox jumps over the lazy dog.\n", len(data)/blockSize, i)...)
+	}
+
+	data = data[0 : 8*blockSize]
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(blockSize),
+		"jobs": uint(2), "checksum": uint(32), "syncMarkers": true}
+	compressed, r := roundTrip(t, data, ctx, nil)
+
+	if r.Segments()[0].SyncMarkers == false {
+		t.Errorf("Missing sync markers flag")
+	}
+
+	// Markers of the 8 blocks and the end block
+	markers := make([]int, 0)
+	marker := []byte{0x4B, 0x5A, 0x53, 0x59}
+
+	for i := bytes.Index(compressed, marker); i >= 0; {
+		markers = append(markers, i)
+
+		if n := bytes.Index(compressed[i+4:], marker); n >= 0 {
+			i += n + 4
+		} else {
+			i = -1
+		}
+	}
+
+	if len(markers) != 9 {
+		t.Fatalf("Invalid number of sync markers: %d", len(markers))
+	}
+
+	// Stored blocks and bound
+	random := make([]byte, 3*blockSize+100)
+
+	for i := range random {
+		random[i] = byte(i * 7919 >> 3)
+	}
+
+	stored := map[string]any{"blockSize": uint(blockSize), "syncMarkers": true, "checksum": uint(64)}
+	output, _ := roundTrip(t, random, stored, nil)
+
+	if bound := MaxCompressedLen(len(random), stored); len(output) > bound {
+		t.Errorf("Invalid bound: %d, compressed size %d", bound, len(output))
+	}
+
+	// Corrupted length of the 3rd block, corrupted marker of the 6th block
+	corrupted := bytes.Clone(compressed)
+	corrupted[markers[2]+4] = 0xFF
+	corrupted[markers[2]+5] = 0xFF
+	corrupted[markers[5]+1] ^= 0x20
+	expected := append(bytes.Clone(data[0:2*blockSize]), data[3*blockSize:5*blockSize]...)
+	expected = append(expected, data[6*blockSize:]...)
+
+	if _, _, err := decompressData(corrupted, map[string]any{"jobs": uint(2)}); err == nil {
+		t.Errorf("Expected decoding error without best effort mode")
+	}
+
+	for _, jobs := range []uint{1, 2, 4} {
+		reports := make([]CorruptedBlock, 0)
+		rCtx := map[string]any{"jobs": jobs, "bestEffort": true,
+			"onCorruptedBlock": func(b CorruptedBlock) { reports = append(reports, b) }}
+		res, _, err := decompressData(corrupted, rCtx)
+
+		if err != nil {
+			t.Fatalf("Jobs %d: decoding failed: %v", jobs, err)
+		}
+
+		if bytes.Equal(res, expected) == false {
+			t.Errorf("Jobs %d: invalid decoded data: %d bytes, expected %d", jobs, len(res), len(expected))
+		}
+
+		for _, b := range reports {
+			fmt.Printf("Jobs %d: block %d, skipped [%d..%d] (%v)\n", jobs, b.BlockID, b.Start, b.End, b.Err)
+		}
+
+		// The skipped regions end at the markers of the 4th and 7th blocks
+		if len(reports) != 2 || reports[0].End != uint64(markers[3]) || reports[1].End != uint64(markers[6]) {
+			t.Errorf("Jobs %d: invalid reports: %+v", jobs, reports)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type panickingTransform struct{}
+
+func (this *panickingTransform) Forward(src, dst []byte) (uint, uint, error) {
+	// Clobber the input before failing
+	for i := range src {
+		src[i] = 0
+	}
+
+	panic(errors.New("Forward failed"))
+}
+
+func (this *panickingTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	return 0, 0, errors.New("Not implemented")
+}
+
+func (this *panickingTransform) MaxEncodedLen(srcLen int) int {
+	return srcLen
+}
+
+// workerPanickingTransform fails in a worker goroutine (like the concurrent
+// jobs of BWT or DivSufSort)
+type workerPanickingTransform struct{}
+
+func (this *workerPanickingTransform) Forward(src, dst []byte) (uint, uint, error) {
+	panics := make([]any, 2)
+	var wg sync.WaitGroup
+
+	for j := range panics {
+		wg.Add(1)
+
+		go func(j int) {
+			defer func() {
+				internal.RecoverWorker(panics, j, recover())
+				wg.Done()
+			}()
+
+			if j == 1 {
+				panic(errors.New("Worker failed"))
+			}
+		}(j)
+	}
+
+	wg.Wait()
+	internal.RaiseWorkerPanic(panics)
+	return uint(len(src)), uint(len(src)), nil
+}
+
+func (this *workerPanickingTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	return 0, 0, errors.New("Not implemented")
+}
+
+func (this *workerPanickingTransform) MaxEncodedLen(srcLen int) int {
+	return srcLen
+}
+
+func TestRetryOnPanic(t *testing.T) {
+	fmt.Println("Retry On Panic Test")
+	input := make([]byte, 10000)
+
+	for i := range input {
+		input[i] = byte(rand.Intn(256))
+	}
+
+	src := make([]byte, len(input))
+	copy(src, input)
+	dst := make([]byte, len(input))
+	work := make([]byte, len(input))
+	seq, _ := transform.NewByteTransformSequence([]kanzi.ByteTransform{&panickingTransform{}})
+	failures := transformFailures{}
+	task := encodingTask{currentBlockID: 3, blockTransformType: transform.LZ_TYPE << 42, failures: &failures}
+	saved := make([]byte, len(src))
+	copy(saved, src)
+
+	if n := task.forward(seq, src, dst, work, saved); n != uint(len(input)) {
+		t.Fatalf("Incorrect output length: %d", n)
+	}
+
+	if !bytes.Equal(dst, input) {
+		t.Errorf("Incorrect output after transform failure")
+	}
+
+	if seq.SkipFlags() != 0xFF {
+		t.Errorf("Incorrect skip flags: %x", seq.SkipFlags())
+	}
+
+	if len(failures.entries) != 1 {
+		t.Fatalf("Expected one transform failure, got %d", len(failures.entries))
+	}
+
+	f := failures.entries[0]
+	hasher, _ := hash.NewXXHash64(_BITSTREAM_TYPE)
+	fmt.Printf("Failure: block %d, transform %s, size %d, hash %x, error %s\n", f.BlockID, f.Transform, f.BlockSize, f.InputHash, f.Error)
+
+	if f.BlockID != 3 || f.Transform != "LZ" || f.BlockSize != len(input) ||
+		f.InputHash != hasher.Hash(input) || len(f.Stack) == 0 {
+		t.Errorf("Incorrect diagnostics: %+v", f)
+	}
+
+	// Panic in a worker goroutine of the transform
+	seq, _ = transform.NewByteTransformSequence([]kanzi.ByteTransform{&workerPanickingTransform{}})
+	copy(src, input)
+
+	if n := task.forward(seq, src, dst, work, saved); n != uint(len(input)) || !bytes.Equal(dst, input) {
+		t.Fatalf("Incorrect output after worker failure")
+	}
+
+	if f = failures.entries[1]; f.Error != "Worker failed" || strings.Contains(f.Stack, "workerPanickingTransform") == false {
+		t.Errorf("Incorrect diagnostics: %+v", f)
+	}
+
+	// No copy of the input => the panic is propagated
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic without retry")
+		}
+	}()
+
+	task.forward(seq, src, dst, work, nil)
+}
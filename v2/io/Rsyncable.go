@@ -0,0 +1,130 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// Rsyncable mode (ctx["rsyncable"] = true): the blocks end at content
+// defined cut points instead of every 'blockSize' bytes. A cut point is
+// found when a rolling (gear) hash of the last 64 bytes matches a mask, so
+// that an edit of the input only moves the boundaries of the blocks around
+// it: the other blocks are compressed identically, which suits rsync and
+// deduplicating replication. The blocks are between 1/4 of the block size
+// and the block size (1/2 on average). The stream header flags the mode
+// since the number of blocks cannot be derived from the original size.
+
+var rsyncGear = func() [256]uint64 {
+	var res [256]uint64
+	x := uint64(0x2545F4914F6CDD1D)
+
+	for i := range res {
+		// splitmix64
+		x += 0x9E3779B97F4A7C15
+		z := x
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		res[i] = z ^ (z >> 31)
+	}
+
+	return res
+}()
+
+// blockChunker tracks the content defined blocks of the Writer buffers
+type blockChunker struct {
+	hash    uint64
+	mask    uint64
+	minSize int
+	maxSize int
+	lengths []int // sizes of the full buffers
+	fill    int   // bytes in the current buffer
+}
+
+func newBlockChunker(blockSize int) *blockChunker {
+	minSize := blockSize >> 2
+	bits := 0
+
+	for 1<<(bits+1) <= minSize {
+		bits++
+	}
+
+	// Test the high bits of the hash (the low bits depend on fewer bytes)
+	return &blockChunker{minSize: minSize, maxSize: blockSize, mask: ((1 << bits) - 1) << (64 - bits)}
+}
+
+// scan returns the number of bytes of p belonging to the current block
+// and true if the block ends there
+func (this *blockChunker) scan(p []byte) (int, bool) {
+	n := min(len(p), this.maxSize-this.fill)
+
+	for i := 0; i < n; i++ {
+		this.hash = (this.hash << 1) + rsyncGear[p[i]]
+
+		if this.hash&this.mask == 0 && this.fill+i+1 >= this.minSize {
+			return i + 1, true
+		}
+	}
+
+	return n, this.fill+n == this.maxSize
+}
+
+// length returns the size of the i-th block in the buffers
+func (this *blockChunker) length(i int) int {
+	if i < len(this.lengths) {
+		return this.lengths[i]
+	}
+
+	if i == len(this.lengths) {
+		return this.fill
+	}
+
+	return 0
+}
+
+func (this *blockChunker) reset() {
+	this.lengths = this.lengths[:0]
+	this.fill = 0
+}
+
+// writeRsyncable fills the buffers up to the cut points and encodes them
+// once they are all full
+func (this *Writer) writeRsyncable(block []byte) (int, error) {
+	c := this.chunker
+	off := 0
+
+	for off < len(block) {
+		bufID := len(c.lengths)
+
+		n, cut := c.scan(block[off:])
+		this.growInput(bufID, c.fill+n)
+		copy(this.buffers[bufID].Buf[c.fill:], block[off:off+n])
+		c.fill += n
+		off += n
+		this.available += n
+
+		if cut == false {
+			continue
+		}
+
+		c.lengths = append(c.lengths, c.fill)
+		c.fill = 0
+
+		if len(c.lengths) == this.jobs {
+			if err := this.processBlock(false); err != nil {
+				return off, err
+			}
+		}
+	}
+
+	return len(block), nil
+}
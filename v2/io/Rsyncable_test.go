@@ -0,0 +1,119 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"testing"
+)
+
+func TestRsyncable(t *testing.T) {
+	fmt.Println("Rsyncable Test")
+
+	const blockSize = 32768
+	data := make([]byte, 400000)
+
+	for i := range data {
+		data[i] = byte(65 + rand.Intn(4*(i/50000+1)))
+	}
+
+	// Same data with a few bytes inserted near the start
+	edited := append(append(append([]byte(nil), data[0:1000]...), "inserted"...), data[1000:]...)
+
+	compress := func(input []byte, jobs uint) []byte {
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(blockSize),
+			"jobs": jobs, "checksum": uint(32), "fileSize": int64(len(input)), "rsyncable": true})
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		// Uneven writes
+		for off := 0; off < len(input); off += 7001 {
+			if _, err = w.Write(input[off:min(off+7001, len(input))]); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		return bs.Bytes()
+	}
+
+	decompress := func(input []byte, expected []byte) []BlockInfo {
+		res, r, err := decompressData(input, map[string]any{"jobs": uint(4), "blockInfo": true})
+
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+
+		if bytes.Equal(res, expected) == false {
+			t.Fatalf("Invalid decompressed data")
+		}
+
+		if segs := r.Segments(); len(segs) != 1 || segs[0].Rsyncable == false || segs[0].BlockCount != r.BlockInfoCount() {
+			t.Errorf("Invalid segment info: %+v", segs)
+		}
+
+		infos := make([]BlockInfo, r.BlockInfoCount())
+
+		for i := range infos {
+			infos[i], _ = r.BlockInfo(i)
+		}
+
+		return infos
+	}
+
+	ref := compress(data, 1)
+
+	for _, jobs := range []uint{2, 5} {
+		if bytes.Equal(ref, compress(data, jobs)) == false {
+			t.Errorf("Output with %d jobs differs from output with 1 job", jobs)
+		}
+	}
+
+	infos1 := decompress(ref, data)
+	infos2 := decompress(compress(edited, 3), edited)
+	blocks := make(map[uint64]bool)
+
+	for i, info := range infos1 {
+		if info.DecodedSize > blockSize || (info.DecodedSize < blockSize/4 && i != len(infos1)-1) {
+			t.Errorf("Block %d: invalid size %d", info.ID, info.DecodedSize)
+		}
+
+		blocks[info.Checksum] = true
+	}
+
+	shared := 0
+
+	for _, info := range infos2 {
+		if blocks[info.Checksum] == true {
+			shared++
+		}
+	}
+
+	fmt.Printf("%d blocks, %d blocks unchanged after edit\n", len(infos2), shared)
+
+	if shared < len(infos2)-2 {
+		t.Errorf("Too many changed blocks: %d out of %d", len(infos2)-shared, len(infos2))
+	}
+}
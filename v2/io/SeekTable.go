@@ -0,0 +1,152 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Partial decoding: Reader.ReadAt reads any range of the original data of a
+// stream written in archival mode (see Archive.go) without decompressing
+// the whole stream. The index of the archive trailer is the seek table:
+// only the blocks overlapping the range are read from the input (which
+// must implement io.ReaderAt and provide its size with a Size method or
+// io.Seeker) and decoded, with their checksums verified. The last block
+// decoded is kept for the next reads (see RangeReader). ReadAt does not
+// change the position of the sequential reads and does not check the
+// stream digest. Chained streams are not supported. The size of an input
+// implementing io.Seeker is read on the first call to ReadAt, which must
+// not run concurrently with Read.
+
+// seekTable the random access to the input of a Reader, opened on the
+// first call to ReadAt
+type seekTable struct {
+	once   sync.Once
+	reader *RangeReader
+	err    error
+}
+
+// ReadAt reads len(p) bytes of original data starting at off (see
+// io.ReaderAt) using the seek table of the stream. Safe for concurrent use
+// with other calls to ReadAt.
+func (this *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if loadInt32(&this.closed) == 1 {
+		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
+	}
+
+	this.seek.once.Do(func() {
+		this.seek.reader, this.seek.err = this.openSeekTable()
+	})
+
+	if this.seek.err != nil {
+		return 0, this.seek.err
+	}
+
+	return this.seek.reader.ReadAt(p, off)
+}
+
+// openSeekTable reads the archive trailer at the end of the input and
+// returns a RangeReader over the blocks of the stream
+func (this *Reader) openSeekTable() (*RangeReader, error) {
+	src, ok := this.source.(io.ReaderAt)
+
+	if ok == false {
+		return nil, &IOError{msg: "Random access requires an input implementing io.ReaderAt", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	size, err := inputSize(this.source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	trailer, start, err := readArchiveIndex(src, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if trailer == nil {
+		return nil, &IOError{msg: "Random access requires a seek table (stream written in archival mode)", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	if start != 0 {
+		return nil, &IOError{msg: "Random access is not supported with chained streams", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	// The stream header precedes the first block
+	hSize := int64(trailer.offset)
+
+	if len(trailer.blocks) > 0 {
+		hSize = int64(trailer.blocks[0].offset)
+	}
+
+	header := make([]byte, hSize)
+
+	if _, err := src.ReadAt(header, 0); err != nil {
+		return nil, &IOError{msg: fmt.Sprintf("Cannot read stream header: %v", err), code: kanzi.ERR_READ_FILE, cause: err}
+	}
+
+	fetch := func(off, length int64) ([]byte, error) {
+		if off < 0 || length < 0 || off+length > int64(trailer.offset) {
+			return nil, fmt.Errorf("invalid range [%d, %d) in the seek table", off, off+length)
+		}
+
+		buf := make([]byte, length)
+		n, err := src.ReadAt(buf, off)
+
+		if n == len(buf) {
+			// io.ReaderAt may return io.EOF at the end of the input
+			err = nil
+		}
+
+		return buf[0:n], err
+	}
+
+	return newRangeReader(fetch, header, trailer.blocks, this.options)
+}
+
+// inputSize returns the size of an input with a Size method (EG.
+// bytes.Reader) or implementing io.Seeker (the position is restored)
+func inputSize(src io.Reader) (int64, error) {
+	if s, ok := src.(interface{ Size() int64 }); ok == true {
+		return s.Size(), nil
+	}
+
+	s, ok := src.(io.Seeker)
+
+	if ok == false {
+		return 0, &IOError{msg: "Random access requires an input with a known size", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	pos, err := s.Seek(0, io.SeekCurrent)
+
+	if err == nil {
+		var size int64
+
+		if size, err = s.Seek(0, io.SeekEnd); err == nil {
+			if _, err = s.Seek(pos, io.SeekStart); err == nil {
+				return size, nil
+			}
+		}
+	}
+
+	return 0, &IOError{msg: fmt.Sprintf("Cannot get the size of the input: %v", err), code: kanzi.ERR_READ_FILE, cause: err}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// bytesReadCloser an in memory input implementing io.ReaderAt
+type bytesReadCloser struct {
+	*bytes.Reader
+}
+
+func (this bytesReadCloser) Close() error {
+	return nil
+}
+
+func TestReaderReadAt(t *testing.T) {
+	fmt.Println("Reader ReadAt Test")
+	data := []byte(strings.Repeat("Page reads from a compressed archive. ", 16000))
+
+	for i := 0; i < len(data); i += 4999 {
+		data[i] = byte(rand.Intn(256))
+	}
+
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(65536),
+		"jobs": uint(4), "archival": true}
+	archive := compressData(t, data, ctx)
+	path := filepath.Join(t.TempDir(), "archive.knz")
+
+	if err := os.WriteFile(path, archive, 0644); err != nil {
+		t.Fatalf("Cannot write file: %v", err)
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		t.Fatalf("Cannot open file: %v", err)
+	}
+
+	defer f.Close()
+
+	open := func(input io.ReadCloser) *Reader {
+		r, err := NewReaderWithCtx(input, map[string]any{"jobs": uint(2)})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		return r
+	}
+
+	for _, input := range []io.ReadCloser{bytesReadCloser{bytes.NewReader(archive)}, f} {
+		r := open(input)
+
+		// Ranges within a block, across blocks and at the end of the data
+		for _, rg := range [][2]int{{0, 10}, {65530, 20}, {100000, 200000}, {len(data) - 5, 5}, {len(data) - 5, 50}} {
+			buf := make([]byte, rg[1])
+			n, err := r.ReadAt(buf, int64(rg[0]))
+			expected := data[rg[0]:min(rg[0]+rg[1], len(data))]
+
+			if n != len(expected) || bytes.Equal(buf[0:n], expected) == false {
+				t.Errorf("ReadAt(%d, %d): invalid data (%d bytes)", rg[0], rg[1], n)
+			}
+
+			if (n < rg[1]) != (err == io.EOF) || (err != nil && err != io.EOF) {
+				t.Errorf("ReadAt(%d, %d): unexpected error: %v", rg[0], rg[1], err)
+			}
+		}
+
+		if _, err := r.ReadAt(make([]byte, 1), int64(len(data))); err != io.EOF {
+			t.Errorf("Expected io.EOF past the end of the data, got %v", err)
+		}
+
+		// Concurrent reads
+		wg := sync.WaitGroup{}
+		errs := make(chan error, 8)
+
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+
+			go func(seed int64) {
+				defer wg.Done()
+				rnd := rand.New(rand.NewSource(seed))
+
+				for k := 0; k < 20; k++ {
+					off := rnd.Intn(len(data) - 1000)
+					buf := make([]byte, 1+rnd.Intn(1000))
+
+					if _, err := r.ReadAt(buf, int64(off)); err != nil || bytes.Equal(buf, data[off:off+len(buf)]) == false {
+						errs <- fmt.Errorf("ReadAt(%d, %d) failed: %v", off, len(buf), err)
+						return
+					}
+				}
+			}(int64(j))
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Error(err)
+		}
+
+		// The sequential reads are not affected
+		if res, err := io.ReadAll(r); err != nil || bytes.Equal(res, data) == false {
+			t.Errorf("Sequential read after ReadAt failed: %v", err)
+		}
+
+		r.Close()
+	}
+
+	// Corrupted block: the other blocks remain readable
+	trailer, _, err := readArchiveIndex(bytes.NewReader(archive), int64(len(archive)))
+
+	if err != nil || trailer == nil {
+		t.Fatalf("Cannot read the archive index: %v", err)
+	}
+
+	corrupted := bytes.Clone(archive)
+	corrupted[trailer.blocks[2].offset+uint64(trailer.blocks[2].length)/2] ^= 0x55
+	r := open(bytesReadCloser{bytes.NewReader(corrupted)})
+
+	if _, err := r.ReadAt(make([]byte, 100), 2*65536+10); err == nil {
+		t.Errorf("Expected error reading a corrupted block")
+	}
+
+	buf := make([]byte, 100)
+
+	if _, err := r.ReadAt(buf, 65536+10); err != nil || bytes.Equal(buf, data[65546:65646]) == false {
+		t.Errorf("ReadAt of an intact block failed: %v", err)
+	}
+
+	// No seek table or no random access to the input
+	plain := compressData(t, data, map[string]any{"transform": "LZ", "entropy": "ANS0"})
+
+	for _, input := range []io.ReadCloser{bytesReadCloser{bytes.NewReader(plain)}, io.NopCloser(bytes.NewReader(archive))} {
+		if _, err := open(input).ReadAt(make([]byte, 10), 0); err == nil {
+			t.Errorf("Expected error without seek table or random access")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Integrity self-test: generated corpora (text, DNA, random bytes and x86
+// code) are compressed and decompressed with every pairing of transform
+// and entropy codec (including the registered ones and no codec at all)
+// and the output must match the input bit for bit. Meant to be run once
+// at startup to detect miscompiled or platform-broken builds. It takes a
+// few seconds, mostly spent in the CM and TPAQ codecs.
+
+const _SELF_TEST_CORPUS_SIZE = 4096
+
+// SelfTest round-trips corpora generated from seed through every transform
+// and entropy codec pairing. Returns nil if all the round trips succeed, an
+// error naming the first failing pairing otherwise.
+func SelfTest(seed int64) error {
+	rnd := rand.New(rand.NewSource(seed))
+	corpora := []struct {
+		name string
+		data []byte
+	}{
+		{"text", selfTestText(rnd)},
+		{"DNA", selfTestDNA(rnd)},
+		{"random", selfTestRandom(rnd)},
+		{"executable", selfTestExe(rnd)},
+	}
+
+	transforms := append([]string{"NONE"}, transform.Names()...)
+	entropies := append([]string{"NONE"}, entropy.Names()...)
+
+	for _, t := range transforms {
+		for _, e := range entropies {
+			for _, c := range corpora {
+				if err := selfTestRoundTrip(c.data, t, e); err != nil {
+					msg := err.Error()
+					var ioErr *IOError
+
+					if errors.As(err, &ioErr) == true {
+						msg = ioErr.Message()
+					}
+
+					errMsg := fmt.Sprintf("Self test failed (%s&%s on %s data): %s", t, e, c.name, msg)
+					return &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK, cause: err}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// selfTestRoundTrip compresses and decompresses data in memory
+func selfTestRoundTrip(data []byte, t, e string) error {
+	bs := internal.NewBufferStream(make([]byte, 0, 2*len(data)))
+	ctx := map[string]any{"transform": t, "entropy": e, "blockSize": uint(len(data)),
+		"jobs": uint(1), "checksum": uint(64)}
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	r, err := NewReaderWithCtx(bs, map[string]any{"jobs": uint(1)})
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+	res, err := io.ReadAll(r)
+
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(res, data) == false {
+		return fmt.Errorf("decompressed data differs from the original (%d bytes, expected %d)", len(res), len(data))
+	}
+
+	return nil
+}
+
+// selfTestText returns English like text (random words, punctuation and
+// line breaks)
+func selfTestText(rnd *rand.Rand) []byte {
+	words := strings.Fields("the of and to in is that for it with as was on be by this are " +
+		"from at or an have not which but all were when there can more data block stream " +
+		"compression transform entropy codec buffer length value table index")
+	var sb strings.Builder
+
+	for sb.Len() < _SELF_TEST_CORPUS_SIZE {
+		sb.WriteString(words[rnd.Intn(len(words))])
+
+		switch n := rnd.Intn(20); {
+		case n == 0:
+			sb.WriteString(".\n")
+		case n == 1:
+			sb.WriteString(", ")
+		default:
+			sb.WriteByte(' ')
+		}
+	}
+
+	return []byte(sb.String()[0:_SELF_TEST_CORPUS_SIZE])
+}
+
+// selfTestDNA returns nucleotides with some repeats
+func selfTestDNA(rnd *rand.Rand) []byte {
+	res := make([]byte, _SELF_TEST_CORPUS_SIZE)
+
+	for i := range res {
+		if i >= 64 && rnd.Intn(4) == 0 {
+			res[i] = res[i-64]
+		} else {
+			res[i] = "ACGT"[rnd.Intn(4)]
+		}
+	}
+
+	return res
+}
+
+// selfTestRandom returns incompressible bytes
+func selfTestRandom(rnd *rand.Rand) []byte {
+	res := make([]byte, _SELF_TEST_CORPUS_SIZE)
+	rnd.Read(res)
+	return res
+}
+
+// selfTestExe returns x86 like code: short instructions with frequent
+// relative calls and jumps to a small set of targets
+func selfTestExe(rnd *rand.Rand) []byte {
+	res := make([]byte, 0, _SELF_TEST_CORPUS_SIZE+8)
+	ops := []byte{0x55, 0x89, 0x8B, 0x48, 0x83, 0xC3, 0x31, 0x50, 0x58, 0x90}
+	targets := make([]int, 32)
+
+	for i := range targets {
+		targets[i] = rnd.Intn(_SELF_TEST_CORPUS_SIZE)
+	}
+
+	for len(res) < _SELF_TEST_CORPUS_SIZE {
+		if rnd.Intn(6) == 0 {
+			// CALL/JMP rel32
+			rel := int32(targets[rnd.Intn(len(targets))] - len(res) - 5)
+			res = append(res, 0xE8+byte(rnd.Intn(2)), byte(rel), byte(rel>>8), byte(rel>>16), byte(rel>>24))
+		} else {
+			res = append(res, ops[rnd.Intn(len(ops))], byte(rnd.Intn(16)))
+		}
+	}
+
+	return res[0:_SELF_TEST_CORPUS_SIZE]
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// brokenTransform corrupts the data on inverse
+type brokenTransform struct {
+	kanzi.ByteTransform
+}
+
+func (this *brokenTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	r, w, err := this.ByteTransform.Inverse(src, dst)
+
+	if w > 100 {
+		dst[100] ^= 1
+	}
+
+	return r, w, err
+}
+
+func TestSelfTest(t *testing.T) {
+	fmt.Println("Self Test")
+
+	if err := SelfTest(12345); err != nil {
+		t.Fatalf("Self test failed: %v", err)
+	}
+
+	err := transform.Register("broken", 42, func(ctx *map[string]any) (kanzi.ByteTransform, error) {
+		t, err := transform.NewNullTransformWithCtx(ctx)
+		return &brokenTransform{ByteTransform: t}, err
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot register transform: %v", err)
+	}
+
+	defer transform.Unregister("BROKEN")
+	err = SelfTest(12345)
+
+	if errors.Is(err, ErrBlockCorrupted) == false || strings.Contains(err.Error(), "BROKEN&") == false {
+		t.Errorf("Expected self test failure on the broken transform, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+// Shared context (ctx["shared"] = *SharedContext): immutable resources
+// created once and shared by any number of Writers and Readers, possibly
+// running concurrently. A shared dictionary primes the LZ, LZX and ROLZ
+// transforms of every block (the first block only with linked blocks), so
+// that small blocks can reference content common to many streams. The
+// stream header stores the ID of the dictionary and the Reader must be
+// given a shared context with the same dictionary.
+// The block buffers (internal.DefaultBufferPool), the static dictionaries
+// of the TEXT transform and the codec tables are already shared by all the
+// streams of the process.
+
+const (
+	_SHARED_MAX_DICTIONARY = 1 << 16 // largest priming data of the transforms
+)
+
+// SharedContext immutable resources shared by several Writers and Readers
+type SharedContext struct {
+	dictionary []byte
+	id         uint32
+}
+
+// NewSharedContext creates a new instance of SharedContext holding the
+// provided dictionary (copied). Only the last 64 KB of the dictionary are
+// used.
+func NewSharedContext(dictionary []byte) (*SharedContext, error) {
+	if len(dictionary) == 0 {
+		return nil, &IOError{msg: "Invalid empty dictionary", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	dictionary = dictionary[max(len(dictionary)-_SHARED_MAX_DICTIONARY, 0):]
+	hasher, err := hash.NewXXHash32(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR, cause: err}
+	}
+
+	this := &SharedContext{dictionary: append([]byte(nil), dictionary...)}
+	this.id = hasher.Hash(this.dictionary)
+
+	if this.id == 0 {
+		this.id = 1 // 0 means no dictionary
+	}
+
+	return this, nil
+}
+
+// DictionaryID returns the ID of the dictionary stored in the stream header
+func (this *SharedContext) DictionaryID() uint32 {
+	return this.id
+}
+
+// getSharedContext returns the shared context in the context (nil if none)
+func getSharedContext(ctx map[string]any) (*SharedContext, error) {
+	val, hasKey := ctx["shared"]
+
+	if hasKey == false || val == nil {
+		return nil, nil
+	}
+
+	shared, ok := val.(*SharedContext)
+
+	if ok == false || shared == nil {
+		errMsg := fmt.Sprintf("Invalid shared context: %T", val)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return shared, nil
+}
+
+// useDictionary primes the transforms of the Reader with the dictionary of
+// the segment (ID read from the header, 0 if none)
+func (this *Reader) useDictionary(id uint32) error {
+	this.dictionary = id
+
+	this.sharedDict = nil
+
+	if id == 0 {
+		return nil
+	}
+
+	shared, err := getSharedContext(this.ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if shared == nil {
+		return &IOError{msg: "Missing shared dictionary: the stream was compressed with a dictionary", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if shared.id != id {
+		errMsg := fmt.Sprintf("Invalid shared dictionary: ID %x, expected %x", shared.id, id)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	this.sharedDict = shared.dictionary
+	return nil
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestSharedContext(t *testing.T) {
+	fmt.Println("Shared Context Test")
+
+	// Small messages sharing most of their content with the dictionary
+	record := func(i int) string {
+		return fmt.Sprintf(`{"id":%d,"type":"order","status":"shipped","carrier":"express","warehouse":"north-east",`+
+			`"currency":"EUR","items":[{"sku":"A-%d","quantity":%d}],"customer":{"country":"FR","tier":"gold"}}`, i, i*7, i%5)
+	}
+
+	var dict []byte
+
+	for i := 0; i < 50; i++ {
+		dict = append(dict, record(i)...)
+	}
+
+	shared, err := NewSharedContext(dict)
+
+	if err != nil {
+		t.Fatalf("Cannot create shared context: %v", err)
+	}
+
+	for _, cfg := range []map[string]any{
+		{"transform": "LZX", "entropy": "HUFFMAN", "checksum": uint(32)},
+		{"transform": "ROLZ", "entropy": "NONE"},
+		{"transform": "LZ", "entropy": "ANS0", "linkedBlocks": true},
+		{"transform": "TEXT+LZ", "entropy": "FPAQ", "archival": true},
+	} {
+		msg := []byte(record(1000) + record(1001) + record(1002))
+		cfg["blockSize"] = uint(1024)
+		plain := compressData(t, msg, cfg)
+		cfg["shared"] = shared
+
+		output, r := roundTrip(t, msg, cfg, map[string]any{"shared": shared})
+
+		if seg := r.Segments()[0]; seg.Dictionary != shared.DictionaryID() || seg.BitstreamVersion != _BITSTREAM_FORMAT_VERSION {
+			t.Errorf("Invalid segment: dictionary %x, version %d", seg.Dictionary, seg.BitstreamVersion)
+		}
+
+		fmt.Printf("%v: %d bytes, %d without dictionary\n", cfg["transform"], len(output), len(plain))
+
+		if len(output) >= len(plain)*3/4 {
+			t.Errorf("Expected a smaller stream with a dictionary: %d bytes, %d without", len(output), len(plain))
+		}
+
+		// Concurrent readers share the context
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if res, _, err := decompressData(output, map[string]any{"shared": shared, "jobs": uint(2)}); err != nil ||
+					bytes.Equal(res, msg) == false {
+					t.Errorf("Concurrent decompression failed: %v", err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		// The dictionary is required to decode
+		other, _ := NewSharedContext([]byte("another dictionary"))
+
+		for _, rCtx := range []map[string]any{nil, {"shared": other}, {"shared": "dictionary"}} {
+			if _, _, err := decompressData(output, rCtx); err == nil {
+				t.Errorf("Expected an error for %v with %v", cfg, rCtx)
+			}
+		}
+
+		if cfg["archival"] == true {
+			dst := &memWriterAt{}
+			rCtx := map[string]any{"shared": shared}
+
+			if _, err := DecompressFile(rCtx, &slowReaderAt{data: output}, int64(len(output)), dst); err != nil ||
+				bytes.Equal(dst.data, msg) == false {
+				t.Errorf("DecompressFile failed: %v", err)
+			}
+		}
+	}
+
+	// Headerless streams
+	ctx := map[string]any{"transform": "LZX", "entropy": "NONE", "blockSize": uint(1024), "headerless": true, "shared": shared}
+	msg := []byte(record(2000))
+	rCtx := map[string]any{"transform": "LZX", "entropy": "NONE", "blockSize": uint(1024), "headerless": true}
+	output := compressData(t, msg, ctx)
+
+	if res, _, err := decompressData(output, rCtx); err == nil && bytes.Equal(res, msg) == true {
+		t.Errorf("Expected a failure without the dictionary")
+	}
+
+	rCtx["shared"] = shared
+
+	if res, _, err := decompressData(output, rCtx); err != nil || bytes.Equal(res, msg) == false {
+		t.Errorf("Invalid headerless stream: %v", err)
+	}
+
+	// The context of the caller is not modified
+	ctx = withDefaults(map[string]any{"transform": "LZX", "blockSize": uint(1024), "archival": true, "shared": shared})
+	w, err := NewWriterWithCtx(internal.NewBufferStream(), ctx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	w.Close()
+
+	if _, found := ctx["priming"]; found == true || ctx["checksum"] != uint(0) {
+		t.Errorf("Context modified: %v", ctx)
+	}
+
+	// Appended blocks use the dictionary of the stream
+	path := filepath.Join(t.TempDir(), "shared.knz")
+	ctx = map[string]any{"transform": "LZX", "blockSize": uint(1024), "shared": shared}
+	os.WriteFile(path, compressData(t, msg, ctx), 0644)
+	f, _ := os.OpenFile(path, os.O_RDWR, 0644)
+	defer f.Close()
+
+	if _, err := OpenWriterForAppend(f, map[string]any{}); err == nil {
+		t.Errorf("Expected an error without the dictionary")
+	}
+
+	w, err = OpenWriterForAppend(f, map[string]any{"shared": shared})
+
+	if err != nil {
+		t.Fatalf("Cannot append: %v", err)
+	}
+
+	w.Write([]byte(record(2001)))
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Cannot append: %v", err)
+	}
+
+	appended, _ := os.ReadFile(path)
+
+	if res, _, err := decompressData(appended, map[string]any{"shared": shared}); err != nil ||
+		bytes.Equal(res, []byte(record(2000)+record(2001))) == false {
+		t.Errorf("Invalid appended stream: %v", err)
+	}
+
+	if _, err := NewSharedContext(nil); err == nil {
+		t.Errorf("Expected an error for an empty dictionary")
+	}
+}
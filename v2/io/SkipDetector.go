@@ -0,0 +1,113 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Skip block detection (ctx["skipBlocks"] = true): a block is copied if its
+// data is already compressed (magic number at the start of the block) or
+// has a high order 0 entropy. The entropy is estimated on probes of 4 KB,
+// one per stratum of the block at a position depending only on the block
+// length (the output does not depend on the jobs), instead of the whole
+// block. ctx["analysisLevel"] sets the effort:
+//
+//	1: 16 probes (default)
+//	2: 64 probes
+//	3: whole block
+//
+// Blocks smaller than the probes are always analyzed in full.
+
+const (
+	_ANALYSIS_PROBE_SIZE    = 4096
+	_ANALYSIS_LEVEL_DEFAULT = 1
+	_ANALYSIS_LEVEL_FULL    = 3
+)
+
+// getAnalysisLevel returns the effort of the skip block detection
+func getAnalysisLevel(ctx map[string]any) (uint, error) {
+	val, hasKey := ctx["analysisLevel"]
+
+	if hasKey == false {
+		return _ANALYSIS_LEVEL_DEFAULT, nil
+	}
+
+	level, ok := val.(uint)
+
+	if ok == false || level == 0 || level > _ANALYSIS_LEVEL_FULL {
+		errMsg := fmt.Sprintf("Invalid analysis level: %v (must be in [1..%d])", val, _ANALYSIS_LEVEL_FULL)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return level, nil
+}
+
+// analysisProbes returns the regions of the block analyzed at the level
+func analysisProbes(block []byte, level uint) [][]byte {
+	n := 16
+
+	if level == 2 {
+		n = 64
+	}
+
+	if level >= _ANALYSIS_LEVEL_FULL || len(block) <= 2*n*_ANALYSIS_PROBE_SIZE {
+		return [][]byte{block}
+	}
+
+	stride := len(block) / n
+	res := make([][]byte, n)
+
+	for i := range res {
+		// Pseudo random position within the stratum
+		off := i*stride + int((uint32(i+1)*0x9E3779B1)>>8)%(stride-_ANALYSIS_PROBE_SIZE+1)
+		res[i] = block[off : off+_ANALYSIS_PROBE_SIZE]
+	}
+
+	return res
+}
+
+// isBlockIncompressible returns true if the block should be copied
+func isBlockIncompressible(block []byte, level uint) bool {
+	probes := analysisProbes(block, level)
+
+	if len(block) >= 8 {
+		magic := internal.GetMagicType(block)
+
+		if internal.IsDataContainer(magic) == true {
+			// Metadata mixed with pages possibly compressed
+			return isMostlyIncompressible(probes)
+		}
+
+		if internal.IsDataCompressed(magic) == true {
+			return true
+		}
+	}
+
+	histo := [256]int{}
+	length := 0
+
+	for _, p := range probes {
+		internal.ComputeHistogram(p, histo[:], true, false)
+		length += len(p)
+	}
+
+	return internal.ComputeFirstOrderEntropy1024(length, histo[:]) >= entropy.INCOMPRESSIBLE_THRESHOLD
+}
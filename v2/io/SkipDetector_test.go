@@ -0,0 +1,103 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestSkipDetector(t *testing.T) {
+	fmt.Println("Skip Detector Test")
+	const size = 8 << 20
+	random := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("Stratified sampling of the blocks, 16 probes of 4 KB. "), size/54+1)[0:size]
+
+	// Compressed pages of 64 KB (2 out of 3) in a Parquet file
+	const page = 65536
+	container := bytes.Clone(text)
+
+	for i := page; i < size; i += 3 * page {
+		copy(container[i:], random[i:min(i+2*page, size)])
+	}
+
+	copy(container, "PAR1")
+
+	if internal.IsDataContainer(internal.GetMagicType(container)) == false {
+		t.Fatalf("Container not detected")
+	}
+
+	for level := uint(1); level <= _ANALYSIS_LEVEL_FULL; level++ {
+		probes := analysisProbes(random, level)
+		analyzed := 0
+
+		for _, p := range probes {
+			analyzed += len(p)
+		}
+
+		start := time.Now()
+
+		for i, test := range []struct {
+			data     []byte
+			expected bool
+		}{{random, true}, {text, false}, {container, true}, {random[0:10000], true}, {text[0:10000], false}} {
+			if res := isBlockIncompressible(test.data, level); res != test.expected {
+				t.Errorf("Level %d, test %d: incompressible=%v, expected %v", level, i, res, test.expected)
+			}
+		}
+
+		fmt.Printf("Level %d: %d probes, %d bytes analyzed per 8 MB block, %v\n", level, len(probes), analyzed, time.Since(start))
+
+		if level < _ANALYSIS_LEVEL_FULL && analyzed > size/16 {
+			t.Errorf("Level %d: %d bytes analyzed", level, analyzed)
+		}
+	}
+
+	// Probes within their stratum
+	probes := analysisProbes(random, 2)
+	stride := size / len(probes)
+
+	for i, p := range probes {
+		off := len(random) - cap(p)
+
+		if off < i*stride || off+len(p) > (i+1)*stride {
+			t.Errorf("Probe %d at offset %d out of stratum", i, off)
+		}
+	}
+
+	// Random blocks copied
+	ctx := map[string]any{"transform": "LZ", "entropy": "ANS0", "blockSize": uint(1 << 20),
+		"jobs": uint(2), "skipBlocks": true, "analysisLevel": uint(1)}
+	output, _ := roundTrip(t, random[0:4<<20], ctx, nil)
+
+	if len(output) > 4<<20+1024 {
+		t.Errorf("Incompressible blocks not copied: %d bytes", len(output))
+	}
+
+	for _, level := range []any{uint(0), uint(4), 2} {
+		ctx := map[string]any{"skipBlocks": true, "analysisLevel": level}
+
+		if _, err := NewWriterWithCtx(internal.NewBufferStream(), withDefaults(ctx)); err == nil {
+			t.Errorf("Invalid analysis level accepted: %v", level)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"math/rand"
+	"testing"
+)
+
+func TestSmallBlocks(t *testing.T) {
+	fmt.Println("Small Blocks Test")
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 100)
+	random := make([]byte, 4096)
+	rand.Read(random)
+
+	// Round trips around the thresholds
+	for _, small := range []uint{0, 15, 256, 4096} {
+		for _, codecs := range [][2]string{{"TEXT+BWT+SRT+ZRLT", "ANS0"}, {"LZ", "HUFFMAN"}, {"NONE", "NONE"}} {
+			for _, size := range []int{1, 2, 15, 16, 100, 255, 256, 257, 2000, 4096} {
+				ctx := map[string]any{"transform": codecs[0], "entropy": codecs[1], "smallBlockSize": small}
+				roundTrip(t, text[0:min(size, len(text))], ctx, nil)
+				roundTrip(t, random[0:size], ctx, nil)
+			}
+		}
+	}
+
+	copied := func(data []byte, ctx map[string]any) bool {
+		ctx["transform"] = "LZ"
+		ctx["entropy"] = "HUFFMAN"
+		_, r := roundTrip(t, data, ctx, map[string]any{"blockInfo": true})
+		info, _ := r.BlockInfo(0)
+		return info.Copied
+	}
+
+	// Entropy probe
+	if copied(random[0:2000], map[string]any{}) == false {
+		t.Errorf("Small random block not copied")
+	}
+
+	if copied(text[0:2000], map[string]any{}) == true {
+		t.Errorf("Small text block copied")
+	}
+
+	// Copy threshold
+	if copied(text[0:200], map[string]any{}) == true {
+		t.Errorf("Text block of 200 bytes copied with the default threshold")
+	}
+
+	if copied(text[0:200], map[string]any{"smallBlockSize": uint(256)}) == false {
+		t.Errorf("Text block of 200 bytes not copied with a threshold of 256")
+	}
+
+	if _, err := NewWriterWithCtx(internal.NewBufferStream(), withDefaults(map[string]any{"smallBlockSize": uint(5000)})); err == nil {
+		t.Errorf("Expected error on invalid small block size")
+	}
+}
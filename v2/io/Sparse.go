@@ -0,0 +1,127 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const _SPARSE_PAGE_SIZE = 4096
+
+var sparseZeroPage [_SPARSE_PAGE_SIZE]byte
+
+// SparseFile a file that can be written at any position and truncated
+// (EG. *os.File)
+type SparseFile interface {
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// SparseWriter writes a sequential stream (EG. the output of a Reader with
+// io.Copy) to a SparseFile and skips the aligned pages of zeros: they are
+// left as holes (not allocated by file systems supporting sparse files).
+// Close truncates the file to the size of the stream so that trailing
+// holes are part of the file. The file is not closed.
+type SparseWriter struct {
+	file   SparseFile
+	offset int64
+	closed bool
+}
+
+// NewSparseWriter creates a new instance of SparseWriter. The file is
+// truncated (the holes must read as zeros).
+func NewSparseWriter(file SparseFile) (*SparseWriter, error) {
+	if file == nil {
+		return nil, &IOError{msg: "Invalid null output file parameter", code: kanzi.ERR_CREATE_STREAM}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return nil, &IOError{msg: fmt.Sprintf("Cannot truncate output file: %v", err), code: kanzi.ERR_CREATE_FILE, cause: err}
+	}
+
+	return &SparseWriter{file: file}, nil
+}
+
+// Write writes the non zero pages of p to the file (a run of such pages
+// with one WriteAt). The incomplete pages are always written.
+func (this *SparseWriter) Write(p []byte) (int, error) {
+	if this.closed == true {
+		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	start := 0 // first byte not written yet
+	written := 0
+
+	for i := 0; i < len(p); {
+		n := min(_SPARSE_PAGE_SIZE-int(this.offset+int64(i))%_SPARSE_PAGE_SIZE, len(p)-i)
+
+		if n == _SPARSE_PAGE_SIZE && bytes.Equal(p[i:i+n], sparseZeroPage[:]) == true {
+			if err := this.writeAt(p[start:i], this.offset+int64(start)); err != nil {
+				this.offset += int64(written)
+				return written, err
+			}
+
+			written = i + n
+			start = written
+		}
+
+		i += n
+	}
+
+	if err := this.writeAt(p[start:], this.offset+int64(start)); err != nil {
+		this.offset += int64(written)
+		return written, err
+	}
+
+	this.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (this *SparseWriter) writeAt(p []byte, off int64) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	if _, err := this.file.WriteAt(p, off); err != nil {
+		return &IOError{msg: fmt.Sprintf("Cannot write to output file: %v", err), code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	return nil
+}
+
+// Size returns the number of bytes written so far (holes included)
+func (this *SparseWriter) Size() int64 {
+	return this.offset
+}
+
+// Close sets the size of the file to the size of the stream
+func (this *SparseWriter) Close() error {
+	if this.closed == true {
+		return nil
+	}
+
+	this.closed = true
+
+	if err := this.file.Truncate(this.offset); err != nil {
+		return &IOError{msg: fmt.Sprintf("Cannot truncate output file: %v", err), code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	return nil
+}
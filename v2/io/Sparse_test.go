@@ -0,0 +1,145 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// sparseMemFile a SparseFile in memory that counts the bytes written
+type sparseMemFile struct {
+	data    []byte
+	written int
+}
+
+func (this *sparseMemFile) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(this.data) {
+		this.data = append(this.data, make([]byte, end-len(this.data))...)
+	}
+
+	this.written += len(p)
+	return copy(this.data[off:], p), nil
+}
+
+func (this *sparseMemFile) Truncate(size int64) error {
+	if int(size) > len(this.data) {
+		this.data = append(this.data, make([]byte, int(size)-len(this.data))...)
+	}
+
+	this.data = this.data[0:size]
+	return nil
+}
+
+func TestSparse(t *testing.T) {
+	fmt.Println("Sparse Test")
+
+	// Data pages, zero pages, data pages, zero pages (trailing holes)
+	page := _SPARSE_PAGE_SIZE
+	data := make([]byte, 200*page)
+	rand.Read(data[0 : 30*page])
+	rand.Read(data[100*page : 150*page+123])
+	data[120*page] = 0
+	output := compressData(t, data, map[string]any{"transform": "SPARSE+LZ", "entropy": "HUFFMAN", "blockSize": uint(256 * 1024)})
+
+	if len(output) > 90*page {
+		t.Errorf("Zero pages not removed: %d => %d bytes", len(data), len(output))
+	}
+
+	// Aligned (io.Copy) and unaligned writes
+	for _, chunk := range []int{0, 1000, 3*page + 5} {
+		r, err := NewReaderWithCtx(internal.NewBufferStream(output), map[string]any{"jobs": uint(2)})
+
+		if err != nil {
+			t.Fatalf("Cannot create reader: %v", err)
+		}
+
+		file := &sparseMemFile{data: bytes.Repeat([]byte{0xAA}, 1000)}
+		w, err := NewSparseWriter(file)
+
+		if err != nil {
+			t.Fatalf("Cannot create sparse writer: %v", err)
+		}
+
+		if chunk == 0 {
+			_, err = io.Copy(w, r)
+		} else {
+			_, err = io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, make([]byte, chunk))
+		}
+
+		if err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		r.Close()
+
+		if w.Size() != int64(len(data)) || bytes.Equal(file.data, data) == false {
+			t.Fatalf("Chunk %d: invalid output (%d bytes, expected %d)", chunk, len(file.data), len(data))
+		}
+
+		// 81 non zero pages, the writes smaller than a page write everything
+		if maxWritten := 81*page + 2*page*(len(data)/max(chunk, 32*1024)); chunk != 1000 && file.written > maxWritten {
+			t.Errorf("Chunk %d: zero pages written: %d bytes", chunk, file.written)
+		}
+
+		if _, err = w.Write(data[0:10]); err == nil {
+			t.Errorf("Missing error for write after close")
+		}
+	}
+
+	// Existing file with other content
+	name := filepath.Join(t.TempDir(), "sparse.out")
+
+	if err := os.WriteFile(name, bytes.Repeat([]byte{0xFF}, len(data)+5000), 0666); err != nil {
+		t.Fatalf("Cannot create file: %v", err)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR, 0666)
+
+	if err != nil {
+		t.Fatalf("Cannot open file: %v", err)
+	}
+
+	defer f.Close()
+	w, err := NewSparseWriter(f)
+
+	if err != nil {
+		t.Fatalf("Cannot create sparse writer: %v", err)
+	}
+
+	if _, err = w.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if res, err := os.ReadFile(name); err != nil || bytes.Equal(res, data) == false {
+		t.Errorf("Invalid file content (%d bytes, expected %d): %v", len(res), len(data), err)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Transform stage parameters: the stages of a transform sequence may be
+// configured with a transform.SequenceBuilder (ctx["transformSequence"]).
+// The options of the forward transforms are set in the context and the
+// parameters needed by the inverse transforms (EG. TEXT variant, ROLZ
+// position checks) are stored in the header of each transformed block
+// (flagged in the stream header), so that the decoder does not depend on
+// the defaults. The parameters are written after the block codecs: a mask
+// of the stages with a parameter followed by 8 bits per parameter.
+
+// applyTransformSequence sets the transform name of the sequence in the
+// context and the options of the forward transforms
+func applyTransformSequence(ctx map[string]any) error {
+	val, hasKey := ctx["transformSequence"]
+
+	if hasKey == false {
+		return nil
+	}
+
+	builder, ok := val.(*transform.SequenceBuilder)
+
+	if ok == false || builder == nil {
+		return &IOError{msg: "Invalid transform sequence parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	name, err := builder.Name()
+
+	if err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	ctx["transform"] = name
+	builder.Apply(ctx)
+	return nil
+}
+
+// getStageParams returns the packed parameters of the inverse transforms
+// of the sequence in the context (0 if none)
+func getStageParams(ctx map[string]any) uint64 {
+	if builder, ok := ctx["transformSequence"].(*transform.SequenceBuilder); ok == true && builder != nil {
+		return builder.Params()
+	}
+
+	return 0
+}
+
+// writeStageParams writes the packed parameters of the stages
+func writeStageParams(obs kanzi.OutputBitStream, params uint64) {
+	mask := uint64(0)
+
+	for i := 0; i < 8; i++ {
+		if byte(params>>(56-8*i)) != 0 {
+			mask |= 1 << (7 - i)
+		}
+	}
+
+	obs.WriteBits(mask, 8)
+
+	for i := 0; i < 8; i++ {
+		if p := byte(params >> (56 - 8*i)); p != 0 {
+			obs.WriteBits(uint64(p), 8)
+		}
+	}
+}
+
+// readStageParams reads the packed parameters of the stages
+func readStageParams(ibs kanzi.InputBitStream) uint64 {
+	mask := ibs.ReadBits(8)
+	params := uint64(0)
+
+	for i := 0; i < 8; i++ {
+		if mask&(1<<(7-i)) != 0 {
+			params |= ibs.ReadBits(8) << (56 - 8*i)
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+func TestStageParams(t *testing.T) {
+	fmt.Println("Stage Parameters Test")
+
+	for _, params := range []uint64{0, 0x0107000000000000, 0x00000000000000FF, 0x0203040506070809} {
+		bs := internal.NewBufferStream()
+		obs, _ := bitstream.NewDefaultOutputBitStream(bs, 1024)
+		writeStageParams(obs, params)
+		obs.Close()
+		ibs, _ := bitstream.NewDefaultInputBitStream(bs, 1024)
+
+		if res := readStageParams(ibs); res != params {
+			t.Errorf("Invalid stage parameters: %x, expected %x", res, params)
+		}
+	}
+}
+
+func TestTransformSequence(t *testing.T) {
+	fmt.Println("Transform Sequence Test")
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs.\n"), 4000)
+	key := bytes.Repeat([]byte{0x5A}, 32)
+
+	// HUFFMAN selects the TEXT variant 2 by default
+	newBuilder := func() *transform.SequenceBuilder {
+		return transform.NewSequenceBuilder().Add("TEXT", transform.TextOptions{Variant: 1}).
+			Add("ROLZX", transform.ROLZOptions{LogPosChecks: 7})
+	}
+
+	ctxs := []map[string]any{
+		{"entropy": "HUFFMAN", "blockSize": uint(65536), "jobs": uint(2), "checksum": uint(32)},
+		{"entropy": "HUFFMAN", "blockSize": uint(65536), "autoTune": true},
+		{"entropy": "HUFFMAN", "cipher": "AES-GCM", "key": key},
+	}
+
+	for i, ctx := range ctxs {
+		ctx["transformSequence"] = newBuilder()
+		output, r := roundTrip(t, data, ctx, map[string]any{"jobs": uint(2), "key": key})
+
+		if r.stageParams == false {
+			t.Errorf("Stream %d: missing stage parameters flag", i)
+		}
+
+		fmt.Printf("Stream %d: %d => %d bytes\n", i, len(data), len(output))
+	}
+
+	// No flag if the stages use the defaults
+	ctx := map[string]any{"entropy": "HUFFMAN", "transformSequence": transform.NewSequenceBuilder().Add("TEXT", nil).
+		Add("LZX", transform.LZOptions{MinMatch: 9})}
+
+	if _, r := roundTrip(t, data, ctx, nil); r.stageParams == true {
+		t.Errorf("Unexpected stage parameters flag")
+	}
+
+	// Typed options
+	os, _ := NewNullOutputStream()
+	opts := WriterOptions{Entropy: "HUFFMAN", Sequence: newBuilder()}
+
+	if _, err := NewWriterWithOptions(os, opts); err != nil {
+		t.Errorf("Cannot create writer: %v", err)
+	}
+
+	bad := []WriterOptions{
+		{Transform: "LZ", Sequence: newBuilder()},
+		{Sequence: transform.NewSequenceBuilder().Add("BWT", transform.ROLZOptions{})},
+		{Sequence: newBuilder(), Headerless: true},
+	}
+
+	for i, opts := range bad {
+		if _, err := NewWriterWithOptions(os, opts); err == nil {
+			t.Errorf("Invalid options %d: no error", i)
+		} else {
+			fmt.Printf("OK - expected error: %v\n", err)
+		}
+	}
+}
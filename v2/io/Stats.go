@@ -0,0 +1,392 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/analysis"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Statistics trailer (ctx["stats"] = true): the end block is followed by
+// aggregate statistics of the blocks of the stream (big endian, byte aligned):
+//
+//	type "KSTS" (4) | trailer size (4) | version (1) | blocks (4)
+//	stored blocks (4) | original size (8) | compressed size (8)
+//	number of stages (1) | per stage: name size (1), name, applied (4),
+//	skipped (4), input size (8), output size (8)
+//	number of data types (1) | per data type: type (1), blocks (4)
+//	trailer size (4) | type (4)
+//
+// The stages are the transforms and entropy codecs used by the blocks, in
+// order of first use. A transform is skipped when it does not apply to the
+// block (EG. TEXT on binary data). The stored blocks (small, incompressible
+// or expanded by the codecs) only count in the block totals and data types.
+// The trailer precedes the footer (if any). Reader.Stats locates it from the
+// end of a seekable input, without decoding the blocks.
+
+const (
+	_STATS_TYPE       = 0x4B535453 // "KSTS"
+	_STATS_VERSION    = 1
+	_STATS_FIXED_SIZE = 4 + 4 + 1 + 4 + 4 + 8 + 8 + 1 + 1 + 4 + 4
+	_STATS_TAIL_SIZE  = 8
+)
+
+// StreamStats the aggregate statistics of the blocks of a stream
+type StreamStats struct {
+	Blocks         int            // number of blocks
+	StoredBlocks   int            // blocks stored without transform nor entropy coding
+	OriginalSize   int64          // size of the original data
+	CompressedSize int64          // size of the block data
+	Stages         []StageStats   // transforms and entropy codecs, in order of first use
+	DataTypes      map[string]int // blocks per detected data type
+}
+
+// StageStats the statistics of a transform or entropy codec over the blocks
+// of a stream
+type StageStats struct {
+	Name       string
+	Applied    int   // blocks processed by the stage
+	Skipped    int   // blocks for which the transform did not apply
+	InputSize  int64 // bytes before the stage (applied blocks)
+	OutputSize int64 // bytes after the stage (applied blocks)
+}
+
+// Ratio returns the output size over the input size of the blocks processed
+// by the stage (1 if there is none)
+func (this StageStats) Ratio() float64 {
+	if this.InputSize == 0 {
+		return 1
+	}
+
+	return float64(this.OutputSize) / float64(this.InputSize)
+}
+
+// statsStage a stage and the position of its first use (ordering)
+type statsStage struct {
+	StageStats
+	first int32 // ID of the first block
+	pos   int   // position in the block pipeline
+}
+
+// statsBuilder collects the statistics of the blocks emitted by the
+// encoding tasks (in any order)
+type statsBuilder struct {
+	lock      sync.Mutex
+	stats     StreamStats
+	stages    map[string]*statsStage
+	dataTypes [256]int
+}
+
+func newStatsBuilder() *statsBuilder {
+	return &statsBuilder{stages: make(map[string]*statsStage)}
+}
+
+func (this *statsBuilder) stage(name string, blockID int32, pos int) *statsStage {
+	s := this.stages[name]
+
+	if s == nil {
+		s = &statsStage{StageStats: StageStats{Name: name}, first: blockID, pos: pos}
+		this.stages[name] = s
+	} else if blockID < s.first || (blockID == s.first && pos < s.pos) {
+		s.first, s.pos = blockID, pos
+	}
+
+	return s
+}
+
+// trailer returns the statistics trailer
+func (this *statsBuilder) trailer() []byte {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	stages := make([]*statsStage, 0, len(this.stages))
+
+	for _, s := range this.stages {
+		stages = append(stages, s)
+	}
+
+	sort.Slice(stages, func(i, j int) bool {
+		if stages[i].first != stages[j].first {
+			return stages[i].first < stages[j].first
+		}
+
+		return stages[i].pos < stages[j].pos
+	})
+
+	stages = stages[0:min(len(stages), 255)]
+	res := binary.BigEndian.AppendUint32(nil, _STATS_TYPE)
+	res = append(res, 0, 0, 0, 0, _STATS_VERSION)
+	res = binary.BigEndian.AppendUint32(res, uint32(this.stats.Blocks))
+	res = binary.BigEndian.AppendUint32(res, uint32(this.stats.StoredBlocks))
+	res = binary.BigEndian.AppendUint64(res, uint64(this.stats.OriginalSize))
+	res = binary.BigEndian.AppendUint64(res, uint64(this.stats.CompressedSize))
+	res = append(res, byte(len(stages)))
+
+	for _, s := range stages {
+		res = append(res, byte(len(s.Name)))
+		res = append(res, s.Name...)
+		res = binary.BigEndian.AppendUint32(res, uint32(s.Applied))
+		res = binary.BigEndian.AppendUint32(res, uint32(s.Skipped))
+		res = binary.BigEndian.AppendUint64(res, uint64(s.InputSize))
+		res = binary.BigEndian.AppendUint64(res, uint64(s.OutputSize))
+	}
+
+	n := len(res)
+	res = append(res, 0)
+
+	for dt, count := range this.dataTypes {
+		if count != 0 {
+			res = append(res, byte(dt))
+			res = binary.BigEndian.AppendUint32(res, uint32(count))
+			res[n]++
+		}
+	}
+
+	size := uint32(len(res) + _STATS_TAIL_SIZE)
+	binary.BigEndian.PutUint32(res[4:], size)
+	res = binary.BigEndian.AppendUint32(res, size)
+	return binary.BigEndian.AppendUint32(res, _STATS_TYPE)
+}
+
+// recordStats adds the block to the statistics of the stream. encoded is
+// the size in bits of the output of the entropy codec and written the size
+// of the block data.
+func (this *encodingTask) recordStats(t *transform.ByteTransformSequence, skipFlags byte,
+	postTransformLength uint, encoded, written uint64, stored bool) {
+	tName, _ := transform.GetName(this.blockTransformType)
+	eName, _ := entropy.GetName(this.blockEntropyType)
+	this.stats.lock.Lock()
+	defer this.stats.lock.Unlock()
+	this.stats.stats.Blocks++
+	this.stats.stats.OriginalSize += int64(this.blockLength)
+	this.stats.stats.CompressedSize += int64((written + 7) >> 3)
+	this.stats.dataTypes[byte(this.scratch.DataType)]++
+
+	if stored == true {
+		this.stats.stats.StoredBlocks++
+		return
+	}
+
+	lengths := t.Lengths()
+	in := int64(this.blockLength)
+
+	for i, name := range strings.Split(tName, "+") {
+		if name == "NONE" || i >= len(lengths) {
+			continue
+		}
+
+		s := this.stats.stage(name, this.currentBlockID, i)
+
+		if skipFlags&(1<<(7-uint(i))) != 0 {
+			s.Skipped++
+			continue
+		}
+
+		s.Applied++
+		s.InputSize += in
+		s.OutputSize += int64(lengths[i])
+		in = int64(lengths[i])
+	}
+
+	if eName != "NONE" {
+		s := this.stats.stage(eName, this.currentBlockID, 8)
+		s.Applied++
+		s.InputSize += int64(postTransformLength)
+		s.OutputSize += int64((encoded + 7) >> 3)
+	}
+}
+
+// writeStatsTrailer writes the statistics trailer after the end block
+func (this *Writer) writeStatsTrailer() {
+	// The trailer starts on a byte boundary
+	if pad := uint(8-(this.obs.Written()&7)) & 7; pad != 0 {
+		this.obs.WriteBits(0, pad)
+	}
+
+	trailer := this.stats.trailer()
+	this.obs.WriteArray(trailer, uint(8*len(trailer)))
+}
+
+// readStatsTrailer reads the statistics trailer following the end block
+// (the type has already been read)
+func (this *Reader) readStatsTrailer() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid statistics trailer: truncated data", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	size := this.ibs.ReadBits(32)
+
+	if size < _STATS_FIXED_SIZE || size > 1<<20 {
+		return &IOError{msg: "Invalid statistics trailer: bad size", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, _STATS_TYPE)
+	binary.BigEndian.PutUint32(buf[4:], uint32(size))
+	this.ibs.ReadArray(buf[8:], uint(8*(size-8)))
+	this.streamStats, err = decodeStatsTrailer(buf)
+	return err
+}
+
+// decodeStatsTrailer parses a statistics trailer
+func decodeStatsTrailer(buf []byte) (*StreamStats, error) {
+	invalid := func(reason string) error {
+		return &IOError{msg: "Invalid statistics trailer: " + reason, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	if len(buf) < _STATS_FIXED_SIZE || binary.BigEndian.Uint32(buf) != _STATS_TYPE ||
+		binary.BigEndian.Uint32(buf[len(buf)-4:]) != _STATS_TYPE {
+		return nil, invalid("bad type")
+	}
+
+	if int(binary.BigEndian.Uint32(buf[4:])) != len(buf) || int(binary.BigEndian.Uint32(buf[len(buf)-8:])) != len(buf) {
+		return nil, invalid("bad size")
+	}
+
+	if buf[8] != _STATS_VERSION {
+		return nil, invalid(fmt.Sprintf("unsupported version %d", buf[8]))
+	}
+
+	res := &StreamStats{DataTypes: make(map[string]int)}
+	res.Blocks = int(binary.BigEndian.Uint32(buf[9:]))
+	res.StoredBlocks = int(binary.BigEndian.Uint32(buf[13:]))
+	res.OriginalSize = int64(binary.BigEndian.Uint64(buf[17:]))
+	res.CompressedSize = int64(binary.BigEndian.Uint64(buf[25:]))
+	n := int(buf[33])
+	buf = buf[34 : len(buf)-_STATS_TAIL_SIZE]
+
+	for i := 0; i < n; i++ {
+		if len(buf) < 1 || len(buf) < 1+int(buf[0])+24 {
+			return nil, invalid("truncated stage")
+		}
+
+		s := StageStats{Name: string(buf[1 : 1+buf[0]])}
+		buf = buf[1+buf[0]:]
+		s.Applied = int(binary.BigEndian.Uint32(buf))
+		s.Skipped = int(binary.BigEndian.Uint32(buf[4:]))
+		s.InputSize = int64(binary.BigEndian.Uint64(buf[8:]))
+		s.OutputSize = int64(binary.BigEndian.Uint64(buf[16:]))
+		res.Stages = append(res.Stages, s)
+		buf = buf[24:]
+	}
+
+	if len(buf) < 1 || len(buf) != 1+5*int(buf[0]) {
+		return nil, invalid("truncated data types")
+	}
+
+	for i := 1; i < len(buf); i += 5 {
+		res.DataTypes[statsDataTypeName(buf[i])] += int(binary.BigEndian.Uint32(buf[i+1:]))
+	}
+
+	return res, nil
+}
+
+func statsDataTypeName(dt byte) string {
+	return analysis.DataType(dt).String()
+}
+
+// Stats returns the statistics stored in the trailer of the stream (written
+// with ctx["stats"] = true) and true if there is one. Once the end of the
+// stream has been reached, the trailer read (the last one for chained
+// streams) is returned. Otherwise, the trailer is looked up at the end of the
+// input if it implements io.Seeker, without decoding the blocks, which
+// assumes that the input contains one stream only (no chained streams).
+func (this *Reader) Stats() (*StreamStats, bool) {
+	if this.streamStats != nil {
+		return this.streamStats, true
+	}
+
+	if err := this.readHeader(); err != nil {
+		return nil, false
+	}
+
+	seeker, ok := this.source.(io.ReadSeeker)
+
+	if ok == false || len(this.segments) > 1 {
+		return nil, false
+	}
+
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+
+	if err != nil {
+		return nil, false
+	}
+
+	defer seeker.Seek(pos, io.SeekStart)
+	end, err := seeker.Seek(0, io.SeekEnd)
+
+	if err != nil || end < _FOOTER_SIZE {
+		return nil, false
+	}
+
+	// Skip the footer
+	buf := make([]byte, _FOOTER_SIZE)
+
+	if _, err = seeker.Seek(end-_FOOTER_SIZE, io.SeekStart); err != nil {
+		return nil, false
+	}
+
+	if _, err = io.ReadFull(seeker, buf); err != nil {
+		return nil, false
+	}
+
+	if _, ok := decodeFooter(buf); ok == true {
+		end -= _FOOTER_SIZE
+	}
+
+	if end < _STATS_FIXED_SIZE {
+		return nil, false
+	}
+
+	tail := buf[0:_STATS_TAIL_SIZE]
+
+	if _, err = seeker.Seek(end-_STATS_TAIL_SIZE, io.SeekStart); err != nil {
+		return nil, false
+	}
+
+	if _, err = io.ReadFull(seeker, tail); err != nil {
+		return nil, false
+	}
+
+	size := int64(binary.BigEndian.Uint32(tail))
+
+	if binary.BigEndian.Uint32(tail[4:]) != _STATS_TYPE || size < _STATS_FIXED_SIZE || size > end {
+		return nil, false
+	}
+
+	trailer := make([]byte, size)
+
+	if _, err = seeker.Seek(end-size, io.SeekStart); err != nil {
+		return nil, false
+	}
+
+	if _, err = io.ReadFull(seeker, trailer); err != nil {
+		return nil, false
+	}
+
+	res, err := decodeStatsTrailer(trailer)
+	return res, err == nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestStatsTrailer(t *testing.T) {
+	fmt.Println("Statistics Trailer Test")
+	const blockSize = 65536
+	text := []byte(strings.Repeat("The statistics trailer counts the blocks of each data type. ", 4500))
+	random := make([]byte, 2*blockSize)
+	rnd := rand.New(rand.NewSource(12345))
+	rnd.Read(random)
+	binary := make([]byte, 2*blockSize)
+
+	for i := range binary {
+		binary[i] = byte(i>>5) & byte(i)
+	}
+
+	data := append(append(text[0:4*blockSize:4*blockSize], random...), binary...)
+	output := compressData(t, data, map[string]any{"transform": "TEXT+LZ", "entropy": "ANS0",
+		"blockSize": uint(blockSize), "jobs": uint(4), "stats": true, "footer": true})
+
+	// Located from the end of the stream, without decoding the blocks
+	r, err := NewReaderWithCtx(seekableStream{bytes.NewReader(output)}, map[string]any{"jobs": uint(2), "footer": true})
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	stats, ok := r.Stats()
+
+	if ok == false {
+		t.Fatalf("No statistics found")
+	}
+
+	if stats.Blocks != 8 || stats.OriginalSize != int64(len(data)) || stats.StoredBlocks < 2 {
+		t.Errorf("Invalid block totals: %+v", stats)
+	}
+
+	if stats.CompressedSize <= 0 || stats.CompressedSize >= int64(len(output)) {
+		t.Errorf("Invalid compressed size: %d", stats.CompressedSize)
+	}
+
+	names := make([]string, len(stats.Stages))
+
+	for i, s := range stats.Stages {
+		names[i] = s.Name
+	}
+
+	if reflect.DeepEqual(names, []string{"TEXT", "LZ", "ANS0"}) == false {
+		t.Fatalf("Invalid stages: %v", names)
+	}
+
+	if txt := stats.Stages[0]; txt.Applied+txt.Skipped+stats.StoredBlocks != stats.Blocks || txt.Applied < 4 || txt.Skipped < 1 {
+		t.Errorf("Invalid TEXT stage: %+v", txt)
+	}
+
+	if lz := stats.Stages[1]; lz.Applied == 0 || lz.Ratio() >= 1 {
+		t.Errorf("Invalid LZ stage: %+v", lz)
+	}
+
+	if stats.DataTypes["TEXT"] < 4 {
+		t.Errorf("Invalid data types: %v", stats.DataTypes)
+	}
+
+	// Read at the end of the stream
+	res, err := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	if bytes.Equal(res, data) == false {
+		t.Errorf("Roundtrip failed")
+	}
+
+	if stats2, ok := r.Stats(); ok == false || reflect.DeepEqual(stats, stats2) == false {
+		t.Errorf("Statistics mismatch: %+v vs %+v", stats, stats2)
+	}
+
+	r.Close()
+
+	// No trailer
+	output = compressData(t, text, map[string]any{"transform": "LZ", "entropy": "NONE", "blockSize": uint(blockSize)})
+	r, _ = NewReaderWithCtx(seekableStream{bytes.NewReader(output)}, map[string]any{"jobs": uint(1)})
+
+	if _, ok = r.Stats(); ok == true {
+		t.Errorf("Unexpected statistics")
+	}
+
+	_, err = NewWriterWithCtx(internal.NewBufferStream(), map[string]any{"transform": "NONE", "entropy": "NONE",
+		"blockSize": uint(blockSize), "jobs": uint(1), "checksum": uint(0), "stats": true, "headerless": true})
+
+	if err == nil {
+		t.Errorf("The statistics trailer should not be accepted in headerless mode")
+	}
+}
+
+func TestStatsTrailerCorrupted(t *testing.T) {
+	b := newStatsBuilder()
+	b.stats.Blocks = 1
+	b.stage("LZ", 1, 0).Applied = 1
+	b.dataTypes[internal.DT_TEXT] = 1
+	trailer := b.trailer()
+
+	if s, err := decodeStatsTrailer(trailer); err != nil || s.Stages[0].Name != "LZ" || s.DataTypes["TEXT"] != 1 {
+		t.Fatalf("Cannot decode trailer: %v, %+v", err, s)
+	}
+
+	for n := 0; n < len(trailer); n++ {
+		if _, err := decodeStatsTrailer(trailer[0:n]); err == nil {
+			t.Errorf("Truncated trailer (%d bytes) not detected", n)
+		}
+	}
+
+	trailer[33]++
+
+	if _, err := decodeStatsTrailer(trailer); err == nil {
+		t.Errorf("Invalid number of stages not detected")
+	}
+}
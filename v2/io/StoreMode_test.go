@@ -0,0 +1,62 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestStoreMode(t *testing.T) {
+	fmt.Println("Store Mode Test")
+	values := make([]byte, 1000000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(256))
+	}
+
+	for _, checksum := range []uint{0, 32, 64} {
+		// One large write (blocks written in place) and small writes (buffered)
+		bs1 := internal.NewBufferStream()
+		w1, _ := NewWriter(bs1, "NONE", "NONE", 65536, 4, checksum, 0, false)
+		w1.Write(values)
+		w1.Close()
+
+		bs2 := internal.NewBufferStream()
+		w2, _ := NewWriter(bs2, "NONE", "NONE", 65536, 4, checksum, 0, false)
+
+		for i := 0; i < len(values); i += 1000 {
+			w2.Write(values[i:min(i+1000, len(values))])
+		}
+
+		w2.Close()
+
+		if !bytes.Equal(bs1.Bytes(), bs2.Bytes()) {
+			t.Fatalf("Store mode output differs from the regular output (checksum %d)", checksum)
+		}
+
+		r, _ := NewReader(internal.NewBufferStream(bytes.Clone(bs1.Bytes())), 2)
+		res, err := io.ReadAll(r)
+
+		if err != nil || !bytes.Equal(res, values) {
+			t.Fatalf("Incorrect decompressed data: %v", err)
+		}
+	}
+}
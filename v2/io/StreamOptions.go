@@ -0,0 +1,526 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Typed stream options: WriterOptions and ReaderOptions hold the parameters
+// of the Writer and Reader as typed fields and are converted to the context
+// map of NewWriterWithCtx and NewReaderWithCtx. Invalid values are reported
+// as errors instead of the type assertion panics of an ill-formed map. The
+// zero value of a field selects the default behavior.
+// The buffer tuning keys (bufferFloor, bufferMargin, smallBlockSize) are
+// only available through the context map.
+
+const (
+	_OPTIONS_DEFAULT_BLOCK_SIZE = 4 * 1024 * 1024
+)
+
+// WriterOptions the typed parameters of a Writer (see NewWriterWithOptions)
+type WriterOptions struct {
+	Transform     string              // EG. "TEXT+BWT+SRT+ZRLT", "NONE" if empty
+	Entropy       string              // EG. "ANS0", "NONE" if empty
+	BlockSize     uint                // 4 MB if 0, multiple of 16
+	Jobs          uint                // 1 if 0
+	Checksum      uint                // 0 (none), 32 or 64
+	FileSize      int64               // size of the input if known (hint), 0 otherwise
+	Headerless    bool                // no stream header
+	SkipBlocks    bool                // copy the incompressible blocks
+	AnalysisLevel uint                // effort of the skip block detection in [1..3] (see SkipDetector.go), 1 if 0
+	Deterministic bool                // output independent of the jobs and timing
+	LinkedBlocks  bool                // transforms primed with the previous block (single job)
+	Rsyncable     bool                // content defined block boundaries
+	AutoTune      bool                // transform and entropy codec selected per block
+	MinSpeedMBps  float64             // speed governor (see Governor.go), none if 0
+	Archival      bool                // archival profile (see Archive.go)
+	Footer        bool                // footer with the original size and hash
+	Stats         bool                // statistics trailer
+	Compact       bool                // compact framing for small inputs
+	Manifest      bool                // collect the block digests (see Writer.Manifest)
+	Index         bool                // record the block positions (see Writer.Index)
+	Cipher        string              // "AES-GCM" or "CHACHA20-POLY1305", none if empty
+	Key           []byte              // encryption key
+	BlockHash     string              // "XXH3" or "BLAKE3", none if empty
+	Dedup         bool                // identical blocks emitted as repeat records
+	RetryOnPanic  bool                // blocks emitted untransformed if the transform panics
+	FlushInterval time.Duration       // automatic flush, none if 0
+	MaxMemory     int64               // memory budget in bytes, none if 0
+	OnBlock       func(BlockBoundary) // called for each block written
+	Profile       bool                // pprof labels and expvar counters (see Profile.go)
+	Shared        *SharedContext      // shared dictionary (see Shared.go)
+	NumaAware     bool                // tasks and buffers spread over the NUMA nodes (Linux)
+	SyncMarkers   bool                // sync marker before each block (see Resync.go)
+	EntropyLanes  uint                // max ANS lanes per block (see entropy/ANSLanes.go), none if 0
+
+	// Block checksums (see ChecksumPolicy.go)
+	ChecksumSeed   uint32         // XXHash seed, default if 0
+	ChecksumPolicy ChecksumPolicy // blocks carrying a checksum, all if nil
+
+	// Transform stages with options (see StageParams.go), replaces Transform
+	Sequence *transform.SequenceBuilder
+}
+
+// ReaderOptions the typed parameters of a Reader (see NewReaderWithOptions).
+// The fields of the headerless section describe the stream and are only
+// used if Headerless is set.
+type ReaderOptions struct {
+	Jobs             uint                 // 1 if 0
+	Chained          bool                 // decode the streams chained after the first one
+	Strict           bool                 // corrupted data reported as DecodingError
+	BestEffort       bool                 // skip the blocks that fail to decode
+	BlockInfo        bool                 // record the statistics of the decoded blocks
+	Archival         bool                 // check the digest of archival streams
+	Footer           bool                 // check the stream footer
+	Key              []byte               // decryption key
+	Manifest         *Manifest            // detached manifest to check the blocks against
+	MaxMemory        int64                // memory budget in bytes, none if 0
+	MaxOutputSize    int64                // limit of the decoded size in bytes, none if 0
+	From             int                  // first block decoded (starting at 1), all if 0
+	To               int                  // first block not decoded, none if 0
+	OnCorruptedBlock func(CorruptedBlock) // called for each corrupted block
+	Profile          bool                 // pprof labels and expvar counters (see Profile.go)
+	Shared           *SharedContext       // shared dictionary (see Shared.go)
+	NumaAware        bool                 // tasks and buffers spread over the NUMA nodes (Linux)
+
+	// Headerless streams
+	Headerless       bool
+	Transform        string // "NONE" if empty
+	Entropy          string // "NONE" if empty
+	BlockSize        uint
+	Checksum         uint  // 0 (none), 32 or 64
+	OriginalSize     int64 // size of the decoded data if known (hint), 0 otherwise
+	BitstreamVersion uint  // current version if 0
+	LinkedBlocks     bool
+	AutoTune         bool
+	Rsyncable        bool
+	Dedup            bool
+}
+
+// NewWriterWithOptions creates a new instance of Writer using typed
+// parameters (see NewWriterWithCtx).
+func NewWriterWithOptions(os io.WriteCloser, opts WriterOptions) (*Writer, error) {
+	ctx, err := opts.Context()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterWithCtx(os, ctx)
+}
+
+// NewReaderWithOptions creates a new instance of Reader using typed
+// parameters (see NewReaderWithCtx).
+func NewReaderWithOptions(is io.ReadCloser, opts ReaderOptions) (*Reader, error) {
+	ctx, err := opts.Context()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReaderWithCtx(is, ctx)
+}
+
+// Validate checks the value of each option. The incompatible combinations
+// of options are reported when the Writer is created.
+func (this WriterOptions) Validate() error {
+	if err := validateCodecs(this.Transform, this.Entropy); err != nil {
+		return err
+	}
+
+	if this.Sequence != nil {
+		if this.Transform != "" {
+			return &IOError{msg: "The transform and the transform sequence are exclusive", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if _, err := this.Sequence.Type(); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	if this.BlockSize != 0 {
+		if err := validateBlockSize(this.BlockSize); err != nil {
+			return err
+		}
+
+		if this.BlockSize&^15 != this.BlockSize {
+			return &IOError{msg: "The block size must be a multiple of 16", code: kanzi.ERR_INVALID_PARAM}
+		}
+	}
+
+	if err := validateJobs(this.Jobs); err != nil {
+		return err
+	}
+
+	if err := validateChecksum(this.Checksum); err != nil {
+		return err
+	}
+
+	if this.FileSize < 0 {
+		errMsg := fmt.Sprintf("Invalid file size: %d", this.FileSize)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.MinSpeedMBps < 0 {
+		errMsg := fmt.Sprintf("Invalid minimum speed: %v", this.MinSpeedMBps)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if cipherType, err := getCipherType(this.Cipher); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	} else if cipherType != _CIPHER_NONE && len(this.Key) == 0 {
+		return &IOError{msg: "Missing encryption key", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if _, err := getBlockHashType(this.BlockHash); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+	}
+
+	if this.FlushInterval < 0 {
+		errMsg := fmt.Sprintf("The flush interval must be positive, got %v", this.FlushInterval)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.AnalysisLevel > _ANALYSIS_LEVEL_FULL {
+		errMsg := fmt.Sprintf("Invalid analysis level: %d (must be in [1..%d])", this.AnalysisLevel, _ANALYSIS_LEVEL_FULL)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.EntropyLanes == 1 || this.EntropyLanes > 16 {
+		errMsg := fmt.Sprintf("Invalid number of entropy lanes: %d (must be 0 or in [2..16])", this.EntropyLanes)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return validateMaxMemory(this.MaxMemory)
+}
+
+// Context validates the options and returns the equivalent context map
+// (see NewWriterWithCtx)
+func (this WriterOptions) Context() (map[string]any, error) {
+	if err := this.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx := make(map[string]any)
+	ctx["transform"] = this.Transform
+	ctx["entropy"] = this.Entropy
+	ctx["blockSize"] = this.BlockSize
+	ctx["jobs"] = this.Jobs
+	ctx["checksum"] = this.Checksum
+
+	if this.Transform == "" {
+		ctx["transform"] = "NONE"
+	}
+
+	if this.Entropy == "" {
+		ctx["entropy"] = "NONE"
+	}
+
+	if this.BlockSize == 0 {
+		ctx["blockSize"] = uint(_OPTIONS_DEFAULT_BLOCK_SIZE)
+	}
+
+	if this.Jobs == 0 {
+		ctx["jobs"] = uint(1)
+	}
+
+	if this.FileSize > 0 {
+		ctx["fileSize"] = this.FileSize
+	}
+
+	if this.MinSpeedMBps > 0 {
+		ctx["minSpeedMBps"] = this.MinSpeedMBps
+	}
+
+	if this.Cipher != "" {
+		ctx["cipher"] = this.Cipher
+		ctx["key"] = this.Key
+	}
+
+	if this.BlockHash != "" {
+		ctx["blockHash"] = this.BlockHash
+	}
+
+	if this.FlushInterval > 0 {
+		ctx["flushInterval"] = this.FlushInterval
+	}
+
+	if this.MaxMemory > 0 {
+		ctx["maxMemory"] = this.MaxMemory
+	}
+
+	if this.OnBlock != nil {
+		ctx["onBlock"] = this.OnBlock
+	}
+
+	if this.ChecksumSeed != 0 {
+		ctx["checksumSeed"] = this.ChecksumSeed
+	}
+
+	if this.ChecksumPolicy != nil {
+		ctx["checksumPolicy"] = this.ChecksumPolicy
+	}
+
+	if this.Sequence != nil {
+		ctx["transformSequence"] = this.Sequence
+	}
+
+	if this.AnalysisLevel != 0 {
+		ctx["analysisLevel"] = this.AnalysisLevel
+	}
+
+	if this.EntropyLanes != 0 {
+		ctx["entropyLanes"] = this.EntropyLanes
+	}
+
+	if this.Shared != nil {
+		ctx["shared"] = this.Shared
+	}
+
+	setFlags(ctx, map[string]bool{
+		"headerless":    this.Headerless,
+		"skipBlocks":    this.SkipBlocks,
+		"deterministic": this.Deterministic,
+		"linkedBlocks":  this.LinkedBlocks,
+		"rsyncable":     this.Rsyncable,
+		"autoTune":      this.AutoTune,
+		"archival":      this.Archival,
+		"footer":        this.Footer,
+		"stats":         this.Stats,
+		"compact":       this.Compact,
+		"manifest":      this.Manifest,
+		"index":         this.Index,
+		"dedup":         this.Dedup,
+		"retryOnPanic":  this.RetryOnPanic,
+		"profile":       this.Profile,
+		"numaAware":     this.NumaAware,
+		"syncMarkers":   this.SyncMarkers,
+	})
+
+	return ctx, nil
+}
+
+// Validate checks the value of each option. The incompatible combinations
+// of options are reported when the Reader is created or the stream header
+// is read.
+func (this ReaderOptions) Validate() error {
+	if err := validateJobs(this.Jobs); err != nil {
+		return err
+	}
+
+	if err := validateMaxMemory(this.MaxMemory); err != nil {
+		return err
+	}
+
+	if this.MaxOutputSize < 0 {
+		errMsg := fmt.Sprintf("Invalid output size limit: %d", this.MaxOutputSize)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.From < 0 || this.To < 0 || (this.To > 0 && this.To < this.From) {
+		errMsg := fmt.Sprintf("Invalid block range: [%d..%d)", this.From, this.To)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.Headerless == false {
+		return nil
+	}
+
+	if err := validateCodecs(this.Transform, this.Entropy); err != nil {
+		return err
+	}
+
+	if err := validateBlockSize(this.BlockSize); err != nil {
+		return err
+	}
+
+	if err := validateChecksum(this.Checksum); err != nil {
+		return err
+	}
+
+	if this.BitstreamVersion > _BITSTREAM_FORMAT_VERSION {
+		errMsg := fmt.Sprintf("Invalid bitstream version, cannot read this version of the stream: %d", this.BitstreamVersion)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.OriginalSize < 0 {
+		errMsg := fmt.Sprintf("Invalid original size: %d", this.OriginalSize)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
+
+// Context validates the options and returns the equivalent context map
+// (see NewReaderWithCtx)
+func (this ReaderOptions) Context() (map[string]any, error) {
+	if err := this.Validate(); err != nil {
+		return nil, err
+	}
+
+	ctx := make(map[string]any)
+	ctx["jobs"] = this.Jobs
+
+	if this.Jobs == 0 {
+		ctx["jobs"] = uint(1)
+	}
+
+	if len(this.Key) > 0 {
+		ctx["key"] = this.Key
+	}
+
+	if this.Manifest != nil {
+		ctx["manifest"] = this.Manifest
+	}
+
+	if this.MaxMemory > 0 {
+		ctx["maxMemory"] = this.MaxMemory
+	}
+
+	if this.MaxOutputSize > 0 {
+		ctx["maxOutputSize"] = this.MaxOutputSize
+	}
+
+	if this.From > 0 {
+		ctx["from"] = this.From
+	}
+
+	if this.To > 0 {
+		ctx["to"] = this.To
+	}
+
+	if this.OnCorruptedBlock != nil {
+		ctx["onCorruptedBlock"] = this.OnCorruptedBlock
+	}
+
+	if this.Shared != nil {
+		ctx["shared"] = this.Shared
+	}
+
+	setFlags(ctx, map[string]bool{
+		"chained":    this.Chained,
+		"strict":     this.Strict,
+		"bestEffort": this.BestEffort,
+		"blockInfo":  this.BlockInfo,
+		"archival":   this.Archival,
+		"footer":     this.Footer,
+		"profile":    this.Profile,
+		"numaAware":  this.NumaAware,
+	})
+
+	if this.Headerless == false {
+		return ctx, nil
+	}
+
+	ctx["headerless"] = true
+	ctx["transform"] = this.Transform
+	ctx["entropy"] = this.Entropy
+	ctx["blockSize"] = this.BlockSize
+	ctx["checksum"] = this.Checksum
+
+	if this.Transform == "" {
+		ctx["transform"] = "NONE"
+	}
+
+	if this.Entropy == "" {
+		ctx["entropy"] = "NONE"
+	}
+
+	if this.OriginalSize > 0 {
+		ctx["outputSize"] = this.OriginalSize
+	}
+
+	if this.BitstreamVersion != 0 {
+		ctx["bsVersion"] = this.BitstreamVersion
+	}
+
+	setFlags(ctx, map[string]bool{
+		"linkedBlocks": this.LinkedBlocks,
+		"autoTune":     this.AutoTune,
+		"rsyncable":    this.Rsyncable,
+		"dedup":        this.Dedup,
+	})
+
+	return ctx, nil
+}
+
+// setFlags adds the boolean options set to the context
+func setFlags(ctx map[string]any, flags map[string]bool) {
+	for key, val := range flags {
+		if val == true {
+			ctx[key] = true
+		}
+	}
+}
+
+func validateCodecs(t, e string) error {
+	if t != "" {
+		if _, err := transform.GetType(t); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	if e != "" {
+		if _, err := entropy.GetType(e); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM, cause: err}
+		}
+	}
+
+	return nil
+}
+
+func validateBlockSize(blockSize uint) error {
+	if blockSize < _MIN_BITSTREAM_BLOCK_SIZE || blockSize > _MAX_BITSTREAM_BLOCK_SIZE {
+		errMsg := fmt.Sprintf("The block size must be in [%d..%d], got %d", _MIN_BITSTREAM_BLOCK_SIZE, _MAX_BITSTREAM_BLOCK_SIZE, blockSize)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
+
+func validateJobs(jobs uint) error {
+	if jobs > _MAX_CONCURRENCY {
+		errMsg := fmt.Sprintf("The number of jobs must be in [1..%d], got %d", _MAX_CONCURRENCY, jobs)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
+
+func validateChecksum(checksum uint) error {
+	if checksum != 0 && checksum != 32 && checksum != 64 {
+		errMsg := fmt.Sprintf("The block checksum size must be 0, 32 or 64 bits, got %d", checksum)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
+
+func validateMaxMemory(maxMemory int64) error {
+	if maxMemory < 0 {
+		errMsg := fmt.Sprintf("Invalid memory budget: %d", maxMemory)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestStreamOptions(t *testing.T) {
+	fmt.Println("Stream Options Test")
+	data := []byte{}
+
+	for i := 0; i < 20000; i++ {
+		data = append(data, fmt.Sprintf("%d: the quick brown fox jumps over the lazy dog. ", i%777)...)
+	}
+
+	for _, cfg := range []struct {
+		w WriterOptions
+		r ReaderOptions
+	}{
+		{WriterOptions{}, ReaderOptions{}},
+		{WriterOptions{Transform: "TEXT+LZ", Entropy: "HUFFMAN", BlockSize: 65536, Jobs: 4, Checksum: 32, Footer: true},
+			ReaderOptions{Jobs: 4, Footer: true, Strict: true}},
+		{WriterOptions{Transform: "LZ", BlockSize: 65536, Archival: true, BlockHash: "XXH3", Dedup: true},
+			ReaderOptions{Archival: true, BlockInfo: true}},
+		{WriterOptions{Transform: "BWT", Entropy: "ANS0", BlockSize: 65536, Cipher: "AES-GCM", Key: []byte("0123456789abcdef")},
+			ReaderOptions{Key: []byte("0123456789abcdef")}},
+		{WriterOptions{Transform: "ROLZ", Entropy: "FPAQ", BlockSize: 65536, Checksum: 64, Headerless: true, LinkedBlocks: true},
+			ReaderOptions{Headerless: true, Transform: "ROLZ", Entropy: "FPAQ", BlockSize: 65536, Checksum: 64, LinkedBlocks: true}},
+	} {
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithOptions(bs, cfg.w)
+
+		if err != nil {
+			t.Fatalf("Cannot create writer for %+v: %v", cfg.w, err)
+		}
+
+		if _, err = w.Write(data); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if err = w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		r, err := NewReaderWithOptions(bs, cfg.r)
+
+		if err != nil {
+			t.Fatalf("Cannot create reader for %+v: %v", cfg.r, err)
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil || bytes.Equal(res, data) == false {
+			t.Fatalf("Invalid round trip for %+v: %v (%d bytes)", cfg.w, err, len(res))
+		}
+	}
+
+	// Partial decoding
+	bs := internal.NewBufferStream()
+	w, _ := NewWriterWithOptions(bs, WriterOptions{Transform: "LZ", BlockSize: 65536})
+	w.Write(data)
+	w.Close()
+	r, err := NewReaderWithOptions(bs, ReaderOptions{From: 2, To: 4})
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	if res, err := io.ReadAll(r); err != nil || bytes.Equal(res, data[65536:3*65536]) == false {
+		t.Errorf("Invalid partial decoding: %v (%d bytes)", err, len(res))
+	}
+
+	// Invalid values are reported as errors, not panics
+	for _, opts := range []WriterOptions{
+		{Transform: "FOO"},
+		{Entropy: "BAR"},
+		{BlockSize: 1000},
+		{BlockSize: 65537},
+		{Jobs: 65},
+		{Checksum: 16},
+		{FileSize: -1},
+		{MinSpeedMBps: -1},
+		{Cipher: "ROT13", Key: []byte("0123456789abcdef")},
+		{Cipher: "AES-GCM"},
+		{BlockHash: "MD5"},
+		{FlushInterval: -1},
+		{MaxMemory: -1},
+	} {
+		if _, err := NewWriterWithOptions(internal.NewBufferStream(), opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+
+	// Incompatible options are reported by the writer
+	if _, err := NewWriterWithOptions(internal.NewBufferStream(), WriterOptions{LinkedBlocks: true, Dedup: true}); err == nil {
+		t.Errorf("Expected an error for deduplication with linked blocks")
+	}
+
+	for _, opts := range []ReaderOptions{
+		{Jobs: 65},
+		{MaxMemory: -1},
+		{From: -1},
+		{From: 4, To: 2},
+		{Headerless: true},
+		{Headerless: true, BlockSize: 65536, Transform: "FOO"},
+		{Headerless: true, BlockSize: 65536, Checksum: 8},
+		{Headerless: true, BlockSize: 65536, BitstreamVersion: 99},
+		{Headerless: true, BlockSize: 65536, OriginalSize: -1},
+	} {
+		if _, err := NewReaderWithOptions(internal.NewBufferStream(), opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+
+	// Only the options set are added to the context
+	ctx, err := ReaderOptions{Strict: true}.Context()
+
+	if err != nil || len(ctx) != 2 || ctx["jobs"] != uint(1) || ctx["strict"] != true {
+		t.Errorf("Invalid reader context: %v (%v)", ctx, err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestStrictMode(t *testing.T) {
+	fmt.Println("Strict Mode Test")
+	text := []byte(strings.Repeat("Corrupted streams must not crash the application. ", 4000))
+	configs := [][2]string{{"BWT+SRT+ZRLT", "ANS0"}, {"TEXT+LZ", "HUFFMAN"}, {"ROLZ", "TPAQ"}, {"RLT+LZP", "FPAQ"}}
+	rng := rand.New(rand.NewSource(12345))
+
+	for _, cfg := range configs {
+		bs := internal.NewBufferStream()
+		w, _ := NewWriter(bs, cfg[0], cfg[1], 65536, 4, 32, int64(len(text)), false)
+		w.Write(text)
+		w.Close()
+		compressed := bs.Bytes()
+
+		for i := 0; i < 100; i++ {
+			input := append([]byte(nil), compressed...)
+
+			if i%10 == 9 {
+				input = input[0:rng.Intn(len(input))]
+			} else {
+				for j := 0; j < 1+i%4; j++ {
+					input[rng.Intn(len(input))] ^= byte(1 + rng.Intn(255))
+				}
+			}
+
+			ctx := map[string]any{"jobs": uint(4), "strict": true}
+			r, err := NewReaderWithCtx(internal.NewBufferStream(input), ctx)
+
+			if err != nil {
+				t.Fatalf("Cannot create reader: %v", err)
+			}
+
+			res, err := io.ReadAll(r)
+			r.Close()
+
+			if err == nil {
+				if bytes.Equal(res, text) == false {
+					t.Errorf("%v: corruption not detected", cfg)
+				}
+
+				continue
+			}
+
+			var decErr *DecodingError
+
+			if errors.As(err, &decErr) == false {
+				t.Errorf("%v: unexpected error type %T: %v", cfg, err, err)
+			} else if decErr.Offset > uint64(8*len(input)) {
+				t.Errorf("%v: invalid error position: %v", cfg, decErr)
+			}
+		}
+	}
+
+	// The header is not part of a block
+	bs := internal.NewBufferStream()
+	w, _ := NewWriter(bs, "LZ", "HUFFMAN", 16384, 1, 32, 0, false)
+	w.Write(text)
+	w.Close()
+	input := bs.Bytes()
+	input[9] ^= 0xFF
+	r, _ := NewReaderWithCtx(internal.NewBufferStream(input), map[string]any{"jobs": uint(1), "strict": true})
+	_, err := io.ReadAll(r)
+	var decErr *DecodingError
+
+	if errors.As(err, &decErr) == false || decErr.BlockID != 0 {
+		t.Errorf("Unexpected error for corrupted header: %v", err)
+	}
+
+	// A corrupted block is reported with its ID
+	input[9] ^= 0xFF
+	input[len(input)/2] ^= 0xFF
+	r, _ = NewReaderWithCtx(internal.NewBufferStream(input), map[string]any{"jobs": uint(1), "strict": true})
+	_, err = io.ReadAll(r)
+
+	if errors.As(err, &decErr) == false || decErr.BlockID == 0 || decErr.Offset == 0 {
+		t.Errorf("Unexpected error for corrupted block: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+	"io"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTransform wraps a transform and counts the calls
+type countingTransform struct {
+	kanzi.ByteTransform
+	forward *int32
+	inverse *int32
+}
+
+func (this *countingTransform) Forward(src, dst []byte) (uint, uint, error) {
+	atomic.AddInt32(this.forward, 1)
+	return this.ByteTransform.Forward(src, dst)
+}
+
+func (this *countingTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	atomic.AddInt32(this.inverse, 1)
+	return this.ByteTransform.Inverse(src, dst)
+}
+
+func TestSubstitutions(t *testing.T) {
+	fmt.Println("Substitutions Test")
+	values := make([]byte, 200000)
+
+	for i := range values {
+		if rand.Intn(4) == 0 {
+			values[i] = byte(rand.Intn(4))
+		}
+	}
+
+	var forward, inverse int32
+
+	err := transform.RegisterSubstitution(transform.Substitution{
+		Name:       "ZRLT-test",
+		Type:       transform.ZRLT_TYPE,
+		MinVersion: 6,
+		MaxVersion: 6,
+		Create: func(ctx *map[string]any) (kanzi.ByteTransform, error) {
+			t, err := transform.NewZRLTWithCtx(ctx)
+			return &countingTransform{ByteTransform: t, forward: &forward, inverse: &inverse}, err
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot register substitution: %v", err)
+	}
+
+	defer transform.UnregisterSubstitution("ZRLT-test")
+
+	bs := internal.NewBufferStream()
+	w, _ := NewWriter(bs, "ZRLT", "HUFFMAN", 65536, 2, 0, 0, false)
+	w.Write(values)
+	w.Close()
+
+	if forward != 0 {
+		t.Errorf("Unexpected substitution during compression")
+	}
+
+	compressed := bytes.Clone(bs.Bytes())
+
+	for _, enabled := range []bool{true, false} {
+		inverse = 0
+		ctx := map[string]any{"jobs": uint(2), "substitutions": enabled}
+		r, _ := NewReaderWithCtx(internal.NewBufferStream(bytes.Clone(compressed)), ctx)
+		res, err := io.ReadAll(r)
+
+		if err != nil || !bytes.Equal(res, values) {
+			t.Fatalf("Incorrect decompressed data: %v", err)
+		}
+
+		blocks := r.Substitutions()["ZRLT-test"]
+
+		if enabled && (blocks != 4 || inverse != 4) {
+			t.Errorf("Expected 4 substituted blocks, got %d (%d inverse calls)", blocks, inverse)
+		}
+
+		if !enabled && (blocks != 0 || inverse != 0) {
+			t.Errorf("Unexpected substitution: %d blocks", blocks)
+		}
+	}
+
+	if err = transform.RegisterSubstitution(transform.Substitution{Name: "bad", Type: transform.ZRLT_TYPE}); err == nil {
+		t.Errorf("Expected error on substitution without constructor")
+	}
+}
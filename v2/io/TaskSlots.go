@@ -0,0 +1,210 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Task slots: the state of the tasks of a batch of blocks (task, result,
+// context, local bitstream, job plan, window of the linked blocks) is kept in job slots reused by the
+// next batches, so that the Writer and the Reader do not allocate for each
+// block once the buffers have grown. The codecs are still created for each
+// block (and may allocate) and the events are only allocated if there are
+// listeners. The context of a slot holds the configuration of the stream,
+// the number of jobs of the task and the block scratch of the slot
+// (internal.BlockScratch): the state of a block (size, data type, ...) is
+// written in the scratch, not in the context, which is only built again if
+// the configuration changes (EG. the header of a chained stream).
+
+// encodingSlots the job slots of a Writer
+type encodingSlots struct {
+	wg     sync.WaitGroup
+	slots  []encodingSlot
+	plan   jobPlan
+	window []byte // spare buffer of the window of the linked blocks
+}
+
+// decodingSlots the job slots of a Reader
+type decodingSlots struct {
+	wg     sync.WaitGroup
+	slots  []decodingSlot
+	plan   jobPlan
+	window []byte // spare buffer of the window of the linked blocks
+}
+
+// jobPlan the plan of the jobs of the last batch
+type jobPlan struct {
+	tasks    int // number of tasks of the schedule (0 if none)
+	schedule kanzi.Schedule
+}
+
+// encodingSlot the state of an encoding task
+type encodingSlot struct {
+	task    encodingTask
+	res     encodingTaskResult
+	ctx     map[string]any
+	scratch internal.BlockScratch
+	local   taskLocal
+	run     func()
+}
+
+// decodingSlot the state of a decoding task
+type decodingSlot struct {
+	task    decodingTask
+	res     decodingTaskResult
+	ctx     map[string]any
+	scratch internal.BlockScratch
+	local   taskLocal
+	run     func()
+}
+
+// taskLocal the local bitstream of a task
+type taskLocal struct {
+	stream *internal.BufferStream
+	obs    *bitstream.DefaultOutputBitStream
+	ibs    *bitstream.DefaultInputBitStream
+}
+
+// encodingSlots returns the job slots of the Writer, created on first use
+// (or if the number of jobs has changed)
+func (this *Writer) encodingSlots() *encodingSlots {
+	if this.slots == nil || len(this.slots.slots) != this.jobs {
+		this.slots = &encodingSlots{slots: make([]encodingSlot, this.jobs)}
+
+		for i := range this.slots.slots {
+			s := &this.slots.slots[i]
+			s.run = func() { s.task.encode(&s.res) }
+		}
+	}
+
+	return this.slots
+}
+
+// decodingSlots returns the job slots of the Reader, created on first use
+// (or if the number of jobs has changed)
+func (this *Reader) decodingSlots() *decodingSlots {
+	if this.slots == nil || len(this.slots.slots) != this.jobs {
+		this.slots = &decodingSlots{slots: make([]decodingSlot, this.jobs)}
+
+		for i := range this.slots.slots {
+			s := &this.slots.slots[i]
+			s.run = func() { s.task.decode(&s.res) }
+		}
+	}
+
+	return this.slots
+}
+
+// reconfigure discards the contexts of the slots after a change of the
+// configuration of the Reader (see taskContext)
+func (this *decodingSlots) reconfigure() {
+	if this == nil {
+		return
+	}
+
+	for i := range this.slots {
+		this.slots[i].ctx = nil
+	}
+}
+
+// get returns the plan of the jobs for the number of blocks (see
+// kanzi.PlanJobs), computed again only if the number of tasks changes (the
+// number of batches is not updated)
+func (this *jobPlan) get(blocks, jobs int) kanzi.Schedule {
+	tasks := jobs
+
+	if blocks > 0 {
+		tasks = min(tasks, blocks)
+	}
+
+	if tasks != this.tasks || len(this.schedule.JobsPerTask) != tasks {
+		this.schedule, _ = kanzi.PlanJobs(blocks, uint(jobs), 0, 0)
+		this.tasks = tasks
+	}
+
+	return this.schedule
+}
+
+// taskContext returns the context of the codecs of a slot: ctx (created
+// from the configuration with the block scratch if nil) with the number of
+// jobs of the task
+func taskContext(ctx, config map[string]any, scratch *internal.BlockScratch, jobs uint) map[string]any {
+	if ctx == nil {
+		ctx = make(map[string]any, len(config)+2)
+
+		for k, v := range config {
+			ctx[k] = v
+		}
+
+		ctx[internal.SCRATCH_KEY] = scratch
+	}
+
+	if n, ok := ctx["jobs"].(uint); ok == false || n != jobs {
+		ctx["jobs"] = jobs
+	}
+
+	return ctx
+}
+
+// output returns a bitstream writing to buf (in a reused buffer stream)
+func (this *taskLocal) output(buf []byte) (*internal.BufferStream, kanzi.OutputBitStream) {
+	if this == nil {
+		bs := internal.NewBufferStream(buf)
+		obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+		return bs, obs
+	}
+
+	if this.stream == nil {
+		this.stream = internal.NewBufferStream(buf)
+	} else {
+		this.stream.Reset(buf)
+	}
+
+	if this.obs == nil {
+		this.obs, _ = bitstream.NewDefaultOutputBitStream(this.stream, 16384)
+	} else {
+		this.obs.Reset(this.stream)
+	}
+
+	return this.stream, this.obs
+}
+
+// input returns a bitstream reading from buf (in a reused buffer stream)
+func (this *taskLocal) input(buf []byte) kanzi.InputBitStream {
+	if this == nil {
+		ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(buf), 16384)
+		return ibs
+	}
+
+	if this.stream == nil {
+		this.stream = internal.NewBufferStream(buf)
+	} else {
+		this.stream.Reset(buf)
+	}
+
+	if this.ibs == nil {
+		this.ibs, _ = bitstream.NewDefaultInputBitStream(this.stream, 16384)
+	} else {
+		this.ibs.Reset(this.stream)
+	}
+
+	return this.ibs
+}
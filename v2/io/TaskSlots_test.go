@@ -0,0 +1,263 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// nopEncoder an entropy encoder copying the block (allocation free, the
+// instances are recycled)
+type nopEncoder struct {
+	obs kanzi.OutputBitStream
+}
+
+func (this *nopEncoder) Write(block []byte) (int, error) {
+	this.obs.WriteArray(block, uint(8*len(block)))
+	return len(block), nil
+}
+
+func (this *nopEncoder) BitStream() kanzi.OutputBitStream {
+	return this.obs
+}
+
+func (this *nopEncoder) Dispose() {
+}
+
+// nopDecoder the decoder of nopEncoder
+type nopDecoder struct {
+	ibs kanzi.InputBitStream
+}
+
+func (this *nopDecoder) Read(block []byte) (int, error) {
+	this.ibs.ReadArray(block, uint(8*len(block)))
+	return len(block), nil
+}
+
+func (this *nopDecoder) BitStream() kanzi.InputBitStream {
+	return this.ibs
+}
+
+func (this *nopDecoder) Dispose() {
+}
+
+// discardWriter an output discarding the data
+type discardWriter struct{}
+
+func (this discardWriter) Write(buf []byte) (int, error) {
+	return len(buf), nil
+}
+
+func (this discardWriter) Close() error {
+	return nil
+}
+
+func TestAllocationBudget(t *testing.T) {
+	fmt.Println("Allocation Budget Test")
+	const blockSize = 65536
+
+	// The codec instances are recycled (more instances than concurrent tasks)
+	encoders := make([]nopEncoder, 16)
+	decoders := make([]nopDecoder, 16)
+	next := uint32(0)
+
+	err := entropy.Register("NOALLOC", 26, func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error) {
+		e := &encoders[atomic.AddUint32(&next, 1)%16]
+		e.obs = obs
+		return e, nil
+	}, func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error) {
+		d := &decoders[atomic.AddUint32(&next, 1)%16]
+		d.ibs = ibs
+		return d, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Cannot register entropy codec: %v", err)
+	}
+
+	defer entropy.Unregister("NOALLOC")
+
+	// Allocations of the codecs created for each block (transform sequence)
+	ctx := map[string]any{internal.SCRATCH_KEY: &internal.BlockScratch{Size: uint(blockSize)}}
+	codecAllocs := testing.AllocsPerRun(100, func() {
+		transform.New(&ctx, transform.NONE_TYPE)
+	})
+
+	data := make([]byte, 64*blockSize)
+
+	for i := range data {
+		data[i] = byte('a' + rand.Intn(8))
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		block := data[0 : int(jobs)*blockSize]
+
+		for _, eType := range []string{"NONE", "NOALLOC"} {
+			// No allocation on top of the codecs in steady state
+			budget := float64(jobs) * codecAllocs
+
+			if eType == "NONE" {
+				// Store mode: the blocks bypass the codecs
+				budget = 0
+			}
+
+			wCtx := map[string]any{"transform": "NONE", "entropy": eType, "blockSize": uint(blockSize),
+				"jobs": jobs, "checksum": uint(32)}
+			w, err := NewWriterWithCtx(discardWriter{}, wCtx)
+
+			if err != nil {
+				t.Fatalf("Cannot create writer: %v", err)
+			}
+
+			if _, err := w.Write(block); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			allocs := testing.AllocsPerRun(20, func() {
+				w.Write(block)
+			})
+
+			w.Close()
+
+			if allocs > budget {
+				t.Errorf("Writer (%s, %d jobs): %.1f allocations per batch, expected at most %.1f", eType, jobs, allocs, budget)
+			}
+
+			if eType == "NONE" {
+				continue
+			}
+
+			stream := compressData(t, data, wCtx)
+			r, err := NewReaderWithCtx(internal.NewBufferStream(stream), map[string]any{"jobs": jobs})
+
+			if err != nil {
+				t.Fatalf("Cannot create reader: %v", err)
+			}
+
+			buf := make([]byte, len(block))
+			res := make([]byte, 0, len(data))
+			n, _ := r.Read(buf)
+			res = append(res, buf[0:n]...)
+
+			allocs = testing.AllocsPerRun(10, func() {
+				n, _ := r.Read(buf)
+				res = append(res, buf[0:n]...)
+			})
+
+			r.Close()
+
+			if allocs > budget {
+				t.Errorf("Reader (%s, %d jobs): %.1f allocations per batch, expected at most %.1f", eType, jobs, allocs, budget)
+			}
+
+			if bytes.Equal(res, data[0:len(res)]) == false {
+				t.Errorf("Reader (%s, %d jobs): invalid decompressed data", eType, jobs)
+			}
+		}
+	}
+}
+
+func TestTaskContext(t *testing.T) {
+	fmt.Println("Task Context Test")
+	const blockSize = 65536
+	r := rand.New(rand.NewSource(12345))
+	text := make([]byte, 8*blockSize)
+	dna := make([]byte, 8*blockSize)
+
+	for i := range text {
+		text[i] = " etaoinshrdlu"[r.Intn(13)]
+		dna[i] = "ACGT"[r.Intn(4)]
+	}
+
+	// The contexts of the slots are built once from the configuration
+	wCtx := map[string]any{"transform": "RLT+DNA+TEXT+LZ+RANK", "entropy": "HUFFMAN",
+		"blockSize": uint(blockSize), "jobs": uint(2), "checksum": uint(32)}
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, wCtx)
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	maps := make([]string, 2)
+
+	for i := 0; i < len(text); i += 2 * blockSize {
+		if _, err := w.Write(text[i : i+2*blockSize]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if w.slots == nil {
+			continue
+		}
+
+		for j := range w.slots.slots {
+			ctx := w.slots.slots[j].ctx
+
+			if m := fmt.Sprintf("%p", ctx); maps[j] != "" && m != maps[j] {
+				t.Errorf("Context of slot %d built again", j)
+			} else {
+				maps[j] = m
+			}
+
+			if len(ctx) != len(w.ctx)+1 || ctx[internal.SCRATCH_KEY] != &w.slots.slots[j].scratch {
+				t.Errorf("Incorrect context of slot %d: %v", j, ctx)
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if maps[0] == "" || (maps[1] == "" && _SINGLE_THREAD == false) {
+		t.Fatalf("No batch of 2 blocks processed")
+	}
+
+	for _, key := range []string{"size", "dataType", "priming", "lz", "sbrt", "substituted"} {
+		if _, hasKey := w.ctx[key]; hasKey == true {
+			t.Errorf("Configuration modified: %s", key)
+		}
+	}
+
+	// Chained streams: the contexts follow the header of each stream
+	second := compressData(t, dna, map[string]any{"transform": "PACK+LZP", "entropy": "ANS0",
+		"blockSize": uint(blockSize), "jobs": uint(2)})
+	input := append(append([]byte{}, bs.Bytes()...), second...)
+	res, rd, err := decompressData(input, map[string]any{"chained": true, "jobs": uint(2)})
+
+	if err != nil {
+		t.Fatalf("Chained decoding failed: %v", err)
+	}
+
+	if bytes.Equal(res, append(append([]byte{}, text...), dna...)) == false {
+		t.Fatalf("Incorrect decoded data")
+	}
+
+	for j := range rd.slots.slots {
+		if ctx := rd.slots.slots[j].ctx; ctx != nil && ctx["transform"] != rd.ctx["transform"] {
+			t.Errorf("Stale context of slot %d: %v", j, ctx["transform"])
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !kanzi_singlethread
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"sync/atomic"
+)
+
+// Default build: the blocks are processed by concurrent tasks (one goroutine
+// per block). See TasksSingleThread.go for the kanzi_singlethread build.
+
+const _SINGLE_THREAD = false
+
+// startTask runs the task in a new goroutine
+func startTask(task func()) {
+	go task()
+}
+
+func loadInt32(addr *int32) int32 {
+	return atomic.LoadInt32(addr)
+}
+
+func storeInt32(addr *int32, val int32) {
+	atomic.StoreInt32(addr, val)
+}
+
+func swapInt32(addr *int32, val int32) int32 {
+	return atomic.SwapInt32(addr, val)
+}
+
+func addInt32(addr *int32, delta int32) int32 {
+	return atomic.AddInt32(addr, delta)
+}
@@ -0,0 +1,58 @@
+//go:build kanzi_singlethread
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// Single thread build (go build -tags kanzi_singlethread) for environments
+// with limited support for goroutines (EG. GOOS=js/wasm, TinyGo). The Writer
+// and the Reader start no goroutine and use no atomic operation: the blocks
+// are processed synchronously, one at a time, by the calling goroutine and
+// the number of jobs is forced to 1 (which also disables the concurrent
+// paths of the transforms and entropy codecs they create). The stream format
+// is unchanged.
+// Not covered by this build: the features that need a background goroutine
+// (AsyncWriter, automatic flush with a flush interval) are rejected, the
+// mutexes and wait groups of the sync package are still used (never
+// contended) and the transforms or entropy codecs created directly with
+// more than one job (EG. BWT, DivSufSort, ANS lanes) still start goroutines.
+
+const _SINGLE_THREAD = true
+
+// startTask runs the task synchronously. The tasks are started in block
+// order, hence a task never waits for a block processed by a later task.
+func startTask(task func()) {
+	task()
+}
+
+func loadInt32(addr *int32) int32 {
+	return *addr
+}
+
+func storeInt32(addr *int32, val int32) {
+	*addr = val
+}
+
+func swapInt32(addr *int32, val int32) int32 {
+	old := *addr
+	*addr = val
+	return old
+}
+
+func addInt32(addr *int32, delta int32) int32 {
+	*addr += delta
+	return *addr
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Streams without header flags are written with version 6 (readable by
+// older decoders). The flags (as well as the BWT blocks with more than 8
+// primary indexes and the TEXT transform) require version 7 so that older
+// decoders reject the stream instead of ignoring them.
+func TestBitstreamVersion(t *testing.T) {
+	fmt.Println("Bitstream Version Test")
+	data := bytes.Repeat([]byte("Version 6 decoders ignore the padding bits of the header. "), 2000)
+	key := bytes.Repeat([]byte{7}, 32)
+
+	tests := []struct {
+		name    string
+		ctx     map[string]any
+		version byte
+	}{
+		{"default", map[string]any{"transform": "LZ", "entropy": "HUFFMAN"}, 6},
+		{"checksum", map[string]any{"transform": "BWT", "entropy": "ANS0", "checksum": uint(64)}, 6},
+		{"text", map[string]any{"transform": "TEXT+BWT", "entropy": "ANS0"}, 7},
+		{"cipher", map[string]any{"transform": "LZ", "cipher": "AES-GCM", "key": key}, 7},
+		{"linked", map[string]any{"transform": "LZ", "linkedBlocks": true}, 7},
+		{"autoTune", map[string]any{"autoTune": true}, 7},
+		{"rsyncable", map[string]any{"transform": "LZ", "rsyncable": true}, 7},
+		{"large LZ blocks", map[string]any{"transform": "LZ", "blockSize": uint(16 << 20)}, 6},
+		{"large BWT blocks", map[string]any{"transform": "BWT", "blockSize": uint(16 << 20)}, 7},
+	}
+
+	for _, test := range tests {
+		output := compressData(t, data, test.ctx)
+
+		if version := output[4] >> 4; version != test.version {
+			t.Errorf("%s: expected version %d, got %d", test.name, test.version, version)
+		}
+
+		if test.version == _BITSTREAM_BASE_VERSION {
+			// Header of a version 6 stream without size: the 15 bits after
+			// the header checksum are padding
+			r := mustReader(t, output, map[string]any{"jobs": uint(1)})
+
+			if err := r.readHeader(); err != nil {
+				t.Fatalf("%s: cannot read header: %v", test.name, err)
+			}
+
+			if pos := r.ibs.Read(); pos != 160 {
+				t.Errorf("%s: unexpected header size: %d bits", test.name, pos)
+			}
+
+			if output[18]&0x7F != 0 || output[19] != 0 {
+				t.Errorf("%s: expected zero padding bits, got %x", test.name, output[18:20])
+			}
+		}
+
+		rCtx := map[string]any{}
+
+		if _, hasKey := test.ctx["key"]; hasKey {
+			rCtx["key"] = key
+		}
+
+		res, _, err := decompressData(output, rCtx)
+
+		if err != nil || bytes.Equal(res, data) == false {
+			t.Errorf("%s: round trip failed: %v", test.name, err)
+		}
+	}
+}
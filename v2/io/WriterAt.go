@@ -0,0 +1,371 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	kanzihash "github.com/flanglet/kanzi-go/v2/hash"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// Out of order decompression: the index of the archive trailer (see
+// Archive.go) provides the position of each block in the stream and, from
+// the original block sizes, in the output. Each block is read with ReadAt,
+// decoded by a task with its own bitstream (no lock-step ordering with the
+// other tasks) and written with WriteAt as soon as it completes. Streams
+// without a trailer, linked blocks, deduplicated blocks and streams chained
+// after other data are decoded sequentially. The stream digest of the trailer is not checked
+// (archival blocks always carry a 64 bit checksum).
+
+// DecompressFile decompresses the stream in the first size bytes of src to
+// dst with the parameters in ctx (same keys as NewReaderWithCtx, the number
+// of jobs defaults to 1) and returns the size of the decompressed data.
+// dst is not truncated.
+func DecompressFile(ctx map[string]any, src io.ReaderAt, size int64, dst io.WriterAt) (int64, error) {
+	if size < 0 {
+		errMsg := fmt.Sprintf("Invalid input size: %d", size)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	params := make(map[string]any, len(ctx)+1)
+
+	for k, v := range ctx {
+		params[k] = v
+	}
+
+	if _, hasKey := params["jobs"]; hasKey == false {
+		params["jobs"] = uint(1)
+	}
+
+	trailer, start, err := readArchiveIndex(src, size)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if trailer == nil || start != 0 || len(trailer.blocks) == 0 {
+		return decompressSequential(params, src, size, dst)
+	}
+
+	// The stream header precedes the first block
+	header := make([]byte, trailer.blocks[0].offset)
+
+	if _, err := src.ReadAt(header, start); err != nil {
+		return 0, &IOError{msg: fmt.Sprintf("Cannot read stream header: %v", err), code: kanzi.ERR_READ_FILE, cause: err}
+	}
+
+	r, err := NewReaderWithCtx(io.NopCloser(bytes.NewReader(header)), params)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := r.readHeader(); err != nil {
+		return 0, err
+	}
+
+	if r.headless == true || r.linked == true || r.dedup != nil {
+		return decompressSequential(params, src, size, dst)
+	}
+
+	return r.decodeBlocksAt(src, start, trailer, dst)
+}
+
+// readArchiveIndex reads the archive trailer at the end of the first size
+// bytes of src and returns it with the position of the stream in src
+// (nil if there is no valid trailer).
+func readArchiveIndex(src io.ReaderAt, size int64) (*archiveTrailer, int64, error) {
+	read := func(off, n int64) ([]byte, error) {
+		buf := make([]byte, n)
+
+		if _, err := src.ReadAt(buf, off); err != nil {
+			errMsg := fmt.Sprintf("Cannot read archive trailer at offset %d: %v", off, err)
+			return nil, &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE, cause: err}
+		}
+
+		return buf, nil
+	}
+
+	if size < 2*_ARCHIVE_FOOTER_SIZE {
+		return nil, 0, nil
+	}
+
+	footers, err := read(size-2*_ARCHIVE_FOOTER_SIZE, 2*_ARCHIVE_FOOTER_SIZE)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Both footers store the size of the trailer, one may be damaged
+	tSize := int64(0)
+
+	for _, f := range [][]byte{footers[0:_ARCHIVE_FOOTER_SIZE], footers[_ARCHIVE_FOOTER_SIZE:]} {
+		if n := binary.BigEndian.Uint64(f); binary.BigEndian.Uint32(f[16:]) == _ARCHIVE_TYPE && n <= uint64(size) {
+			tSize = max(tSize, int64(n))
+		}
+	}
+
+	if tSize == 0 {
+		return nil, 0, nil
+	}
+
+	data, err := read(size-tSize, tSize)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hasher, err := kanzihash.NewXXHash64(_BITSTREAM_TYPE)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	trailer, err := parseArchiveTrailer(data, hasher)
+
+	if err != nil {
+		return nil, 0, nil
+	}
+
+	trailerStart := size - int64(len(data)-trailer.start)
+
+	if trailer.offset > uint64(trailerStart) {
+		return nil, 0, nil
+	}
+
+	return trailer, trailerStart - int64(trailer.offset), nil
+}
+
+// decompressSequential decodes the stream with a Reader and writes the
+// data in order
+func decompressSequential(ctx map[string]any, src io.ReaderAt, size int64, dst io.WriterAt) (int64, error) {
+	r, err := NewReaderWithCtx(io.NopCloser(io.NewSectionReader(src, 0, size)), ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(io.NewOffsetWriter(dst, 0), r)
+
+	if err != nil {
+		r.Close()
+		return n, err
+	}
+
+	return n, r.Close()
+}
+
+// decodeBlocksAt decodes the blocks listed in the archive index of the
+// stream at position start in src, one task per job, and writes each block
+// at its position in dst. Returns the first error in block order.
+func (this *Reader) decodeBlocksAt(src io.ReaderAt, start int64, trailer *archiveTrailer, dst io.WriterAt) (int64, error) {
+	blocks := trailer.blocks
+	positions := make([]int64, len(blocks))
+	total := int64(0)
+	end := uint64(start) + trailer.offset
+
+	for i, b := range blocks {
+		if b.size > uint32(this.blockSize) || uint64(start)+b.offset+uint64(b.length) > end {
+			errMsg := fmt.Sprintf("Invalid archive index: block %d", i+1)
+			return 0, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+		}
+
+		positions[i] = total
+		total += int64(b.size)
+	}
+
+	if this.maxOutput > 0 && total > this.maxOutput {
+		return 0, newOutputLimitError("decoded data", total, this.maxOutput)
+	}
+
+	blkSize := this.taskBlockSize()
+
+	ids := make(chan int, len(blocks))
+
+	for i := range blocks {
+		ids <- i
+	}
+
+	close(ids)
+	errs := make([]error, len(blocks))
+	cancelled := int32(0)
+	wg := sync.WaitGroup{}
+
+	for j := 0; j < min(this.jobs, len(blocks)); j++ {
+		wg.Add(1)
+
+		startTask(func() {
+			defer wg.Done()
+			buffers := []blockBuffer{{Buf: make([]byte, 0)}, {Buf: make([]byte, 0)}, {Buf: make([]byte, 0)}}
+
+			defer func() {
+				for k := range buffers {
+					buffers[k].release()
+				}
+			}()
+
+			for i := range ids {
+				if loadInt32(&cancelled) != 0 {
+					return
+				}
+
+				if errs[i] = this.decodeBlockAt(src, start, i, &blocks[i], positions[i], dst, buffers, blkSize); errs[i] != nil {
+					storeInt32(&cancelled, 1)
+				}
+			}
+		})
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if this.manifest != nil {
+		if err := this.manifest.complete(); err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// taskBlockSize returns the size of the buffers of a decoding task: the
+// block size (at most the output size limit) plus a padding area to manage
+// any block temporarily expanded
+func (this *Reader) taskBlockSize() int {
+	blockSize := this.blockSize
+
+	// No buffer larger than the output size limit (see OutputLimit.go)
+	if this.maxOutput > 0 && int64(blockSize) > this.maxOutput {
+		blockSize = int(this.maxOutput)
+	}
+
+	if _EXTRA_BUFFER_SIZE >= (blockSize >> 4) {
+		return blockSize + _EXTRA_BUFFER_SIZE
+	}
+
+	return blockSize + (blockSize >> 4)
+}
+
+// decodeBlockAt decodes the block with index i in the archive index
+func (this *Reader) decodeBlockAt(src io.ReaderAt, start int64, i int, b *archiveBlock, pos int64,
+	dst io.WriterAt, buffers []blockBuffer, blkSize int) error {
+	// The record is read into its own buffer (the input buffer of the task
+	// receives the block data)
+	record := buffers[2].grow(int(b.length), false)[0:b.length]
+	offset := start + int64(b.offset)
+
+	if _, err := src.ReadAt(record, offset); err != nil {
+		errMsg := fmt.Sprintf("Cannot read block at offset %d: %v", offset, err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE, cause: err}
+	}
+
+	data, err := this.decodeRecord(record, i, b, offset, buffers, blkSize)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.WriteAt(data, pos); err != nil {
+		errMsg := fmt.Sprintf("Cannot write block %d at offset %d: %v", i+1, pos, err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE, cause: err}
+	}
+
+	return nil
+}
+
+// decodeRecord decodes the byte aligned record of the block with index i
+// (at offset in the input) and returns the decoded data, valid until the
+// next use of the buffers.
+func (this *Reader) decodeRecord(record []byte, i int, b *archiveBlock, offset int64, buffers []blockBuffer, blkSize int) ([]byte, error) {
+	ibs, err := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(record), 16384)
+
+	if err != nil {
+		return nil, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM, cause: err}
+	}
+
+	copyCtx := make(map[string]any)
+
+	for k, v := range this.ctx {
+		copyCtx[k] = v
+	}
+
+	scratch := &internal.BlockScratch{Dictionary: this.sharedDict}
+	copyCtx["jobs"] = uint(1)
+	copyCtx[internal.SCRATCH_KEY] = scratch
+	delete(copyCtx, "from")
+	delete(copyCtx, "to")
+
+	// The bitstream is not shared: no wait for the previous block
+	processed := int32(i)
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	task := decodingTask{
+		iBuffer:            &buffers[0],
+		oBuffer:            &buffers[1],
+		hasher32:           this.hasher32,
+		hasher64:           this.hasher64,
+		blockHash:          this.blockHash,
+		blockLength:        uint(blkSize),
+		blockTransformType: this.transformType,
+		blockEntropyType:   this.entropyType,
+		currentBlockID:     int32(i + 1),
+		processedBlockID:   &processed,
+		wg:                 &wg,
+		ibs:                ibs,
+		ctx:                copyCtx,
+		substitutions:      this.substitutions,
+		manifest:           this.manifest,
+		strict:             this.strict,
+		aead:               this.aead,
+		header:             this.header,
+		autoTune:           this.autoTune,
+		checksumFlags:      this.checksumFlags,
+		stageParams:        this.stageParams,
+		maxOutput:          this.maxOutput,
+		scratch:            scratch}
+
+	var res decodingTaskResult
+	task.decode(&res)
+	ibs.Close()
+
+	if res.err == nil && (res.endOfStream == true || res.decoded != int(b.size)) {
+		errMsg := fmt.Sprintf("Invalid block %d: decoded %d bytes, expected %d", i+1, res.decoded, b.size)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK}
+	}
+
+	if res.err != nil {
+		if this.strict == true {
+			return nil, newDecodingError(res.err, i+1, uint64(offset)<<3)
+		}
+
+		return nil, res.err
+	}
+
+	return res.data[0:res.decoded], nil
+}
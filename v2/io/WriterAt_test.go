@@ -0,0 +1,105 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// memWriterAt records the data and the offsets of the writes
+type memWriterAt struct {
+	lock    sync.Mutex
+	data    []byte
+	offsets []int64
+}
+
+func (this *memWriterAt) WriteAt(buf []byte, off int64) (int, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if end := int(off) + len(buf); end > len(this.data) {
+		this.data = append(this.data, make([]byte, end-len(this.data))...)
+	}
+
+	this.offsets = append(this.offsets, off)
+	return copy(this.data[off:], buf), nil
+}
+
+func TestDecompressFile(t *testing.T) {
+	fmt.Println("Decompress File Test")
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20000)
+
+	for i := 0; i < 10000; i++ {
+		data[rand.Intn(len(data))] = byte(rand.Intn(256))
+	}
+
+	for _, ctx := range []map[string]any{
+		{"transform": "LZ", "entropy": "ANS0", "archival": true},
+		{"transform": "NONE", "entropy": "NONE", "archival": true},
+		{"transform": "TEXT+LZ", "entropy": "HUFFMAN", "archival": true, "blockHash": "XXH3"},
+		{"transform": "LZ", "entropy": "FPAQ", "archival": true, "checksum": uint(64)},
+		{"transform": "LZ", "entropy": "ANS0", "archival": true, "linkedBlocks": true, "jobs": uint(1)},
+		{"transform": "LZ", "entropy": "ANS0", "checksum": uint(32)},
+	} {
+		ctx["blockSize"] = uint(65536)
+
+		if _, hasKey := ctx["jobs"]; hasKey == false {
+			ctx["jobs"] = uint(4)
+		}
+
+		for _, size := range []int{0, 1000, 4 * 65536, len(data)} {
+			input := compressData(t, data[0:size], ctx)
+			src := &slowReaderAt{data: input}
+			dst := &memWriterAt{}
+			n, err := DecompressFile(map[string]any{"jobs": uint(4)}, src, int64(len(input)), dst)
+
+			if err != nil {
+				t.Fatalf("DecompressFile failed: %v", err)
+			}
+
+			if n != int64(size) || bytes.Equal(dst.data, data[0:size]) == false {
+				t.Fatalf("Invalid output for %v: got %d bytes, expected %d", ctx, n, size)
+			}
+
+			parallel := ctx["archival"] == true && ctx["linkedBlocks"] == nil
+
+			if parallel == true && size > 65536 && len(dst.offsets) != (size+65535)/65536 {
+				t.Errorf("Expected one write per block, got %d", len(dst.offsets))
+			}
+
+			if parallel == true && size == len(data) && _SINGLE_THREAD == false && src.max < 2 {
+				t.Errorf("Expected concurrent reads, got %d", src.max)
+			}
+		}
+	}
+
+	// Corrupted block
+	input := compressData(t, data, map[string]any{"transform": "LZ", "entropy": "ANS0",
+		"blockSize": uint(65536), "jobs": uint(4), "archival": true})
+	input[len(input)/2] ^= 0x40
+	_, err := DecompressFile(map[string]any{"jobs": uint(4), "strict": true},
+		&slowReaderAt{data: input}, int64(len(input)), &memWriterAt{})
+	var de *DecodingError
+
+	if errors.As(err, &de) == false || de.BlockID < 2 {
+		t.Errorf("Expected a decoding error, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+// Zero copy writes: Writer.WriteOwned encodes the full blocks of a buffer of
+// the caller in place instead of copying them to the input buffers of the
+// tasks (for large blocks, the copy is a significant part of the memory
+// bandwidth). The buffer is lent to the tasks for the duration of the call:
+// it is used as a work buffer (its content is undefined once WriteOwned
+// returns) and never returned to the buffer pool. No reference to it is
+// kept after the call, so the caller can fill it again with the next data.
+// The rest of the data (partial block, buffered data to complete first,
+// rsyncable and compact streams) is copied as with Write.
+
+// WriteOwned writes block to the underlying data stream, taking ownership
+// of the buffer until the call returns: the content of block is undefined
+// afterwards. The full blocks are encoded in place when no data is
+// buffered. Returns any error encountered.
+func (this *Writer) WriteOwned(block []byte) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	_, err := this.writeInput(block, true)
+	return err
+}
+
+// writeOwned encodes the full blocks of data in place, one batch of blocks
+// per job at a time, and returns the number of bytes written
+func (this *Writer) writeOwned(data []byte) (int, error) {
+	if len(data) < this.blockSize {
+		return 0, nil
+	}
+
+	saved := make([]blockBuffer, this.jobs)
+	copy(saved, this.buffers[0:this.jobs])
+
+	// Restore the input buffers (the tasks may have replaced a buffer of
+	// the caller with a larger one)
+	restore := func(n int) {
+		for i := 0; i < n; i++ {
+			if this.buffers[i].owned == false {
+				this.buffers[i].release()
+			}
+
+			this.buffers[i] = saved[i]
+		}
+	}
+
+	n := 0
+
+	for len(data)-n >= this.blockSize {
+		k := min((len(data)-n)/this.blockSize, this.jobs)
+
+		for i := 0; i < k; i++ {
+			start := n + i*this.blockSize
+			end := start + this.blockSize
+			this.buffers[i] = blockBuffer{Buf: data[start:end:end], owned: true}
+		}
+
+		this.available = k * this.blockSize
+		err := this.processBlock(false)
+		restore(k)
+
+		if err != nil {
+			this.available = 0
+			return n, err
+		}
+
+		n += k * this.blockSize
+	}
+
+	return n, nil
+}
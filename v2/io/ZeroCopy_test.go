@@ -0,0 +1,105 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+func TestWriteOwned(t *testing.T) {
+	fmt.Println("Write Owned Test")
+	const blockSize = 1 << 18
+	data := make([]byte, 0, 7*blockSize+123)
+
+	for i := 0; len(data) < cap(data); i++ {
+		data = append(data, fmt.Sprintf("Record %d: zero copy of the blocks of the caller.\n", i*7919%100003)...)
+	}
+
+	data = data[0:cap(data)]
+
+	for _, ctx := range []map[string]any{
+		{"transform": "LZ", "entropy": "ANS0", "checksum": uint(32)},
+		{"transform": "TEXT+BWT+SRT+ZRLT", "entropy": "ANS0", "checksum": uint(64), "footer": true},
+		{"transform": "LZX", "entropy": "HUFFMAN", "archival": true, "linkedBlocks": true},
+		{"transform": "NONE", "entropy": "NONE", "checksum": uint(32), "skipBlocks": true},
+	} {
+		ctx["blockSize"] = uint(blockSize)
+		ctx["jobs"] = uint(3)
+
+		if linked, _ := ctx["linkedBlocks"].(bool); linked == true {
+			ctx["jobs"] = uint(1)
+		}
+
+		ref := compressData(t, data, ctx)
+
+		// The same buffer is filled again after each call (3 full blocks,
+		// 2 full blocks, then the rest with a partial block)
+		bs := internal.NewBufferStream()
+		w, err := NewWriterWithCtx(bs, withDefaults(ctx))
+
+		if err != nil {
+			t.Fatalf("Cannot create writer: %v", err)
+		}
+
+		buffer := make([]byte, 3*blockSize)
+
+		for off, n := 0, 3*blockSize; off < len(data); off, n = off+n, 2*blockSize {
+			n = min(n, len(data)-off)
+			chunk := buffer[0:n]
+			copy(chunk, data[off:off+n])
+
+			if err := w.WriteOwned(chunk); err != nil {
+				t.Fatalf("WriteOwned failed: %v", err)
+			}
+
+			// No reference to the buffer of the caller
+			for i := range w.buffers {
+				if b := w.buffers[i].Buf; w.buffers[i].owned == true ||
+					(len(b) > 0 && uintptr(unsafe.Pointer(&b[0]))-uintptr(unsafe.Pointer(&buffer[0])) < uintptr(len(buffer))) {
+					t.Fatalf("Buffer %d refers to the buffer of the caller", i)
+				}
+			}
+
+			for i := range chunk {
+				chunk[i] = 0xFF
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		// Same blocks, same batches: same output
+		if bytes.Equal(bs.Bytes(), ref) == false {
+			t.Errorf("%s: output of WriteOwned differs from output of Write", ctx["transform"])
+		}
+
+		res, _, err := decompressData(bs.Bytes(), ctx)
+
+		if err != nil || bytes.Equal(res, data) == false {
+			t.Errorf("%s: decompression failed: %v", ctx["transform"], err)
+		}
+
+		if err := w.WriteOwned(data[0:blockSize]); err == nil {
+			t.Errorf("WriteOwned after Close should fail")
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listeners
+
+import (
+	"context"
+	"log/slog"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// SlogListener logs the structured events of a Writer or a Reader (see
+// kanzi.ListenerV2) as slog records: the message is the event name (EG.
+// "BLOCK_INFO") and the attributes are the block ID and the event fields.
+type SlogListener struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogListener creates a new instance of SlogListener logging the
+// events to logger at the provided level.
+func NewSlogListener(logger *slog.Logger, level slog.Level) *SlogListener {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SlogListener{logger: logger, level: level}
+}
+
+// ProcessEvent logs an event emitted without structured dispatch
+func (this *SlogListener) ProcessEvent(evt *kanzi.Event) {
+	this.ProcessEventV2(evt.V2())
+}
+
+// ProcessEventV2 logs a structured event. The record time is the event time.
+func (this *SlogListener) ProcessEventV2(evt kanzi.EventV2) {
+	ctx := context.Background()
+	handler := this.logger.Handler()
+
+	if handler.Enabled(ctx, this.level) == false {
+		return
+	}
+
+	r := slog.NewRecord(evt.Time, this.level, evt.Name(), 0)
+	r.AddAttrs(slog.Int("id", evt.ID))
+
+	for _, f := range evt.Fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+
+	handler.Handle(ctx, r)
+}
+
+// KeyValueListener logs the structured events of a Writer or a Reader
+// (see kanzi.ListenerV2) with a function taking a message and alternating
+// keys and values, EG. the Infow method of a zap.SugaredLogger or the Info
+// method of a logr.Logger. The message is the event name and the keys are
+// "id", "time" and the event fields.
+type KeyValueListener struct {
+	log func(msg string, keysAndValues ...any)
+}
+
+// NewKeyValueListener creates a new instance of KeyValueListener logging
+// the events with log.
+func NewKeyValueListener(log func(msg string, keysAndValues ...any)) *KeyValueListener {
+	return &KeyValueListener{log: log}
+}
+
+// ProcessEvent logs an event emitted without structured dispatch
+func (this *KeyValueListener) ProcessEvent(evt *kanzi.Event) {
+	this.ProcessEventV2(evt.V2())
+}
+
+// ProcessEventV2 logs a structured event
+func (this *KeyValueListener) ProcessEventV2(evt kanzi.EventV2) {
+	kv := make([]any, 0, 4+2*len(evt.Fields))
+	kv = append(kv, "id", evt.ID, "time", evt.Time)
+
+	for _, f := range evt.Fields {
+		kv = append(kv, f.Key, f.Value)
+	}
+
+	this.log(evt.Name(), kv...)
+}
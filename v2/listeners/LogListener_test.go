@@ -0,0 +1,91 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listeners
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+func TestLogListener(t *testing.T) {
+	fmt.Println("Log Listener Test")
+	data := []byte(strings.Repeat("Structured events carry typed fields. ", 10000))
+	bs := internal.NewBufferStream()
+	w, err := kio.NewWriterWithOptions(bs, kio.WriterOptions{Transform: "LZ", Entropy: "HUFFMAN", BlockSize: 65536, Checksum: 32})
+
+	if err != nil {
+		t.Fatalf("Cannot create writer: %v", err)
+	}
+
+	w.Write(data)
+	w.Close()
+
+	r, err := kio.NewReaderWithOptions(bs, kio.ReaderOptions{})
+
+	if err != nil {
+		t.Fatalf("Cannot create reader: %v", err)
+	}
+
+	var buf bytes.Buffer
+	var lock sync.Mutex
+	nbEvents := 0
+	r.AddListener(NewSlogListener(slog.New(slog.NewJSONHandler(&buf, nil)), slog.LevelInfo))
+	r.AddListener(NewKeyValueListener(func(msg string, keysAndValues ...any) {
+		lock.Lock()
+		nbEvents++
+		lock.Unlock()
+
+		if len(keysAndValues)%2 != 0 || keysAndValues[0] != "id" {
+			t.Errorf("Invalid key values for %s: %v", msg, keysAndValues)
+		}
+	}))
+
+	if res, err := io.ReadAll(r); err != nil || bytes.Equal(res, data) == false {
+		t.Fatalf("Decompression failed: %v", err)
+	}
+
+	// The header event is logged with typed attributes
+	out := buf.String()
+
+	for _, s := range []string{`"msg":"AFTER_HEADER_DECODING"`, `"blockSize":65536`, `"checksum":32`,
+		`"transform":"LZ"`, `"entropy":"HUFFMAN"`, `"msg":"DECOMPRESSION_PROGRESS"`} {
+		if strings.Contains(out, s) == false {
+			t.Errorf("Missing %s in the log: %s", s, out)
+		}
+	}
+
+	if nbEvents == 0 || nbEvents != strings.Count(out, "\n") {
+		t.Errorf("Invalid number of events: %d (%d log records)", nbEvents, strings.Count(out, "\n"))
+	}
+
+	// Plain events converted to structured events
+	evt := kanzi.NewEvent(kanzi.EVT_COMPRESSION_END, -1, 1234, 0xABCD, kanzi.EVT_HASH_32BITS, time.Now())
+	v2 := evt.V2()
+
+	if v2.Name() != "COMPRESSION_END" || len(v2.Fields) != 3 || v2.Fields[0].Value != int64(1234) || v2.Fields[1].Value != uint64(0xABCD) {
+		t.Errorf("Invalid structured event: %+v", v2)
+	}
+}
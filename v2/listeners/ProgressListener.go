@@ -0,0 +1,142 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package listeners provides ready-made implementations of kanzi.Listener
+package listeners
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const _PROGRESS_REFRESH_INTERVAL = 200 * time.Millisecond
+
+// ProgressListener renders the progress events of a Writer or a Reader on
+// one line (refreshed in place): processed bytes, percentage, throughput
+// (of uncompressed data) and ETA when the total size is known.
+type ProgressListener struct {
+	writer     io.Writer
+	lock       sync.Mutex
+	start      time.Time
+	lastUpdate time.Time
+	lastLength int
+	done       bool
+}
+
+// NewProgressListener creates a new instance of ProgressListener writing
+// to w. The throughput is computed from the creation time.
+func NewProgressListener(w io.Writer) *ProgressListener {
+	return &ProgressListener{writer: w, start: time.Now()}
+}
+
+// ProcessEvent renders progress events (at most every 200 ms and when the
+// processing completes). Other events are ignored.
+func (this *ProgressListener) ProcessEvent(evt *kanzi.Event) {
+	switch evt.Type() {
+	case kanzi.EVT_COMPRESSION_PROGRESS, kanzi.EVT_DECOMPRESSION_PROGRESS:
+	case kanzi.EVT_COMPRESSION_END, kanzi.EVT_DECOMPRESSION_END:
+		this.Done()
+		return
+	default:
+		return
+	}
+
+	progress, _ := evt.Progress()
+	percent, hasTotal := evt.Percent()
+	complete := hasTotal == true && percent >= 100
+	now := time.Now()
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.done == true || (complete == false && now.Sub(this.lastUpdate) < _PROGRESS_REFRESH_INTERVAL) {
+		return
+	}
+
+	this.lastUpdate = now
+	uncompressed := progress.InputBytes
+
+	if evt.Type() == kanzi.EVT_DECOMPRESSION_PROGRESS {
+		uncompressed = progress.OutputBytes
+	}
+
+	elapsed := now.Sub(this.start).Seconds()
+	throughput := 0.0
+
+	if elapsed > 0 {
+		throughput = float64(uncompressed) / elapsed
+	}
+
+	msg := fmt.Sprintf("%s => %s", formatSize(progress.InputBytes), formatSize(progress.OutputBytes))
+
+	if hasTotal == true {
+		msg = fmt.Sprintf("%5.1f%%  %s", percent, msg)
+	}
+
+	msg += fmt.Sprintf("  %s/s", formatSize(int64(throughput)))
+
+	if hasTotal == true && complete == false && throughput > 0 {
+		eta := time.Duration(float64(progress.TotalBytes-uncompressed) / throughput * float64(time.Second))
+		msg += fmt.Sprintf("  ETA %s", formatDuration(eta))
+	}
+
+	// Overwrite the previous line (pad if shorter)
+	padding := max(this.lastLength-len(msg), 0)
+	fmt.Fprintf(this.writer, "\r%s%*s", msg, padding, "")
+	this.lastLength = len(msg)
+
+	if complete == true {
+		fmt.Fprintln(this.writer)
+		this.done = true
+	}
+}
+
+// Done terminates the progress line. Idempotent.
+func (this *ProgressListener) Done() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if this.done == false && this.lastLength > 0 {
+		fmt.Fprintln(this.writer)
+	}
+
+	this.done = true
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, (s/60)%60, s%60)
+	}
+
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
@@ -67,16 +67,23 @@ func NewAliasCodec() (*AliasCodec, error) {
 // NewAliasCodecWithCtx creates a new instance of AliasCodec using a
 // configuration map as parameter.
 func NewAliasCodecWithCtx(ctx *map[string]any) (*AliasCodec, error) {
-	this := &AliasCodec{}
-	this.ctx = ctx
-	this.onlyDNA = false
+	onlyDNA := false
 
 	if ctx != nil {
-		if val, containsKey := (*this.ctx)["packOnlyDNA"]; containsKey {
-			this.onlyDNA = val.(bool)
+		if val, containsKey := (*ctx)["packOnlyDNA"]; containsKey {
+			onlyDNA = val.(bool)
 		}
 	}
 
+	return newAliasCodecWithCtx(ctx, onlyDNA)
+}
+
+// newAliasCodecWithCtx creates a new instance of AliasCodec (DNA only if
+// onlyDNA is true)
+func newAliasCodecWithCtx(ctx *map[string]any, onlyDNA bool) (*AliasCodec, error) {
+	this := &AliasCodec{}
+	this.ctx = ctx
+	this.onlyDNA = onlyDNA
 	return this, nil
 }
 
@@ -100,13 +107,9 @@ func (this *AliasCodec) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, fmt.Errorf("Input block is too small - size: %d, required %d", len(src), _ALIAS_MIN_BLOCKSIZE)
 	}
 
-	dt := internal.DT_UNDEFINED
+	dt := internal.GetDataType(this.ctx)
 
 	if this.ctx != nil {
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt = val.(internal.DataType)
-		}
-
 		if (dt == internal.DT_MULTIMEDIA) || (dt == internal.DT_UTF8) {
 			return 0, 0, errors.New("Alias Codec: forward transform skip, binary data")
 		}
@@ -122,7 +125,7 @@ func (this *AliasCodec) Forward(src, dst []byte) (uint, uint, error) {
 
 	// Find missing 1-byte symbols
 	var freqs0 [256]int
-	internal.ComputeHistogram(src[:], freqs0[:], true, false)
+	internal.Histogram(this.ctx, src, freqs0[:])
 	n0 := 0
 	var absent [256]int
 
@@ -140,8 +143,8 @@ func (this *AliasCodec) Forward(src, dst []byte) (uint, uint, error) {
 	if dt == internal.DT_UNDEFINED {
 		dt = internal.DetectSimpleType(len(src), freqs0[:])
 
-		if (this.ctx != nil) && (dt != internal.DT_UNDEFINED) {
-			(*this.ctx)["dataType"] = dt
+		if dt != internal.DT_UNDEFINED {
+			internal.SetDataType(this.ctx, dt)
 		}
 
 		if (dt != internal.DT_DNA) && (this.onlyDNA == true) {
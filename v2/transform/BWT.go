@@ -16,6 +16,7 @@ limitations under the License.
 package transform
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"sync"
@@ -29,6 +30,14 @@ const (
 	_BWT_MASK_FASTBITS         = (1 << _BWT_NB_FASTBITS) - 1
 	_BWT_BLOCK_SIZE_THRESHOLD1 = 256
 	_BWT_BLOCK_SIZE_THRESHOLD2 = 4 * 1024 * 1024
+	_BWT_MT_INVERSE_THRESHOLD  = 512 * 1024 // min block size to split the mergeTPSI inverse across jobs
+	_BWT_LOW_MEM_THRESHOLD     = 1024 * 1024
+	_BWT_LOW_MEM_SUBCHUNKS     = 64
+	_BWT_LOW_MEM_MIN_SUBCHUNK  = 16 * 1024
+	_BWT_LOW_MEM_MAX_SUBCHUNK  = 1<<24 - 1
+	_BWT_LOW_MEM_OCC_LOG       = 12
+	_BWT_MAX_CHUNKS            = 128     // max number of primary indexes (bitstream version 7)
+	_BWT_MIN_CHUNK_SIZE        = 1 << 20 // min chunk size beyond 8 chunks
 )
 
 // The Burrows-Wheeler Transform is a reversible transform based on
@@ -66,31 +75,51 @@ const (
 // This implementation extends the canonical algorithm to use up to MAX_CHUNKS primary
 // indexes (based on input block size). Each primary index corresponds to a data chunk.
 // Chunks may be inverted concurrently.
+//
+// In low memory mode (for blocks of at least 1 MB), the suffix array of the
+// whole block is never built. Instead, the block is processed by sub-chunks,
+// from the end to the start, and the BWT of each sub-chunk is merged into the
+// BWT of the suffixes already processed (blockwise construction as described
+// by Ferragina, Gagie and Manzini in [Lightweight data indexing and compression
+// in external memory], 2010). The peak memory (input, output and work buffers)
+// drops from about 6N to less than 3N: the work buffers, allocated once, take
+// less than N (see BenchmarkBWTForward). The cost is a forward transform about
+// 2 times slower (the existing rows are scanned and moved for each of the 64
+// sub-chunks). The output is identical.
+//
+// Up to bitstream version 6, a block has at most 8 chunks. Since version 7,
+// the number of chunks grows with the block size beyond 16 MB (chunks of at
+// least 1 MB, up to 128 chunks), so that the inverse of large blocks can be
+// split across more jobs.
 
 // BWT Burrows Wheeler Transform
 type BWT struct {
 	buffer         []int32
-	primaryIndexes [8]uint
+	primaryIndexes [_BWT_MAX_CHUNKS]uint
 	saAlgo         *DivSufSort
 	jobs           uint
+	maxChunks      int
+	lowMemory      bool
+	subChunkSize   int // 0 means computed from the block size
 }
 
 // NewBWT creates a new BWT instance with 1 job
 func NewBWT() (*BWT, error) {
 	this := &BWT{}
 	this.buffer = make([]int32, 0)
-	this.primaryIndexes = [8]uint{}
 	this.jobs = 1
+	this.maxChunks = 8
 	return this, nil
 }
 
 // NewBWTWithCtx creates a new BWT instance. The number of jobs is extracted
-// from the provided map or arguments.
+// from the provided map or arguments. The low memory mode is enabled with
+// the 'bwtLowMemory' key.
 func NewBWTWithCtx(ctx *map[string]any) (*BWT, error) {
 	this := &BWT{}
 	this.buffer = make([]int32, 0)
-	this.primaryIndexes = [8]uint{}
 	this.jobs = 1
+	this.maxChunks = 8
 
 	if _, containsKey := (*ctx)["jobs"]; containsKey {
 		this.jobs = (*ctx)["jobs"].(uint)
@@ -100,6 +129,14 @@ func NewBWTWithCtx(ctx *map[string]any) (*BWT, error) {
 		}
 	}
 
+	if val, containsKey := (*ctx)["bwtLowMemory"]; containsKey {
+		this.lowMemory = val.(bool)
+	}
+
+	if val, containsKey := (*ctx)["bsVersion"]; containsKey && val.(uint) >= 7 {
+		this.maxChunks = _BWT_MAX_CHUNKS
+	}
+
 	return this, nil
 }
 
@@ -145,10 +182,17 @@ func (this *BWT) Forward(src, dst []byte) (uint, uint, error) {
 		return uint(count), uint(count), nil
 	}
 
+	if this.lowMemory && count >= _BWT_LOW_MEM_THRESHOLD {
+		this.forwardLowMemory(src[0:count], dst)
+		return uint(count), uint(count), nil
+	}
+
 	if this.saAlgo == nil {
 		var err error
 
-		if this.saAlgo, err = NewDivSufSort(); err != nil {
+		ctx := map[string]any{"jobs": this.jobs}
+
+		if this.saAlgo, err = NewDivSufSortWithCtx(&ctx); err != nil {
 			return 0, 0, err
 		}
 	}
@@ -157,10 +201,11 @@ func (this *BWT) Forward(src, dst []byte) (uint, uint, error) {
 	minLenBuf := max(count, 256)
 
 	if len(this.buffer) < minLenBuf {
-		this.buffer = make([]int32, minLenBuf)
+		this.buffer = internal.DefaultBufferPool.GetInts(minLenBuf)
 	}
 
-	this.saAlgo.ComputeBWT(src[0:count], dst, this.buffer[0:count], this.primaryIndexes[:], GetBWTChunks(count))
+	defer this.releaseBuffer()
+	this.saAlgo.ComputeBWT(src[0:count], dst, this.buffer[0:count], this.primaryIndexes[:], this.chunks(count))
 	return uint(count), uint(count), nil
 }
 
@@ -191,6 +236,8 @@ func (this *BWT) Inverse(src, dst []byte) (uint, uint, error) {
 		return uint(count), uint(count), nil
 	}
 
+	defer this.releaseBuffer()
+
 	// Find the fastest way to implement inverse based on block size
 	if count <= _BWT_BLOCK_SIZE_THRESHOLD2 {
 		return this.inverseMergeTPSI(src, dst, count)
@@ -199,6 +246,12 @@ func (this *BWT) Inverse(src, dst []byte) (uint, uint, error) {
 	return this.inverseBiPSIv2(src, dst, count)
 }
 
+// releaseBuffer returns the scratch buffer to the pool once a block is processed
+func (this *BWT) releaseBuffer() {
+	internal.DefaultBufferPool.PutInts(this.buffer)
+	this.buffer = nil
+}
+
 // When count <= _BWT_BLOCK_SIZE_THRESHOLD2, mergeTPSI algo. Always in one chunk
 func (this *BWT) inverseMergeTPSI(src, dst []byte, count int) (uint, uint, error) {
 	if len(src) == 0 {
@@ -215,7 +268,7 @@ func (this *BWT) inverseMergeTPSI(src, dst []byte, count int) (uint, uint, error
 	minLenBuf := max(count, 64)
 
 	if len(this.buffer) < minLenBuf {
-		this.buffer = make([]int32, minLenBuf)
+		this.buffer = internal.DefaultBufferPool.GetInts(minLenBuf)
 	}
 
 	// Aliasing
@@ -247,7 +300,7 @@ func (this *BWT) inverseMergeTPSI(src, dst []byte, count int) (uint, uint, error
 		buckets[val]++
 	}
 
-	if GetBWTChunks(count) != 8 {
+	if this.chunks(count) != 8 {
 		t := int32(pIdx - 1)
 
 		for i := range src {
@@ -279,6 +332,11 @@ func (this *BWT) inverseMergeTPSI(src, dst []byte, count int) (uint, uint, error
 			return 0, 0, errors.New("BWT inverse transform failed: corrupted BWT primary index")
 		}
 
+		if this.jobs > 1 && count >= _BWT_MT_INVERSE_THRESHOLD {
+			this.inverseMergeTPSIConcurrent(data, dst, count, ckSize)
+			return uint(count), uint(count), nil
+		}
+
 		d0 := dst[0*ckSize : 1*ckSize]
 		d1 := dst[1*ckSize : 2*ckSize]
 		d2 := dst[2*ckSize : 3*ckSize]
@@ -349,13 +407,75 @@ func (this *BWT) inverseMergeTPSI(src, dst []byte, count int) (uint, uint, error
 	return uint(count), uint(count), nil
 }
 
+// inverseMergeTPSIConcurrent walks the 8 chains (one per primary index) of
+// the mergeTPSI inverse with several jobs, each job decoding whole chunks
+func (this *BWT) inverseMergeTPSIConcurrent(data []int32, dst []byte, count, ckSize int) {
+	chunks := 8
+	nbTasks := min(int(this.jobs), chunks)
+	jobsPerTask, _ := internal.ComputeJobsPerTask(make([]uint, nbTasks), uint(chunks), uint(nbTasks))
+	var wg sync.WaitGroup
+	panics := make([]any, nbTasks)
+
+	for j, c := 0, 0; j < nbTasks; j++ {
+		wg.Add(1)
+
+		go func(j, firstChunk, lastChunk int) {
+			defer func() {
+				internal.RecoverWorker(panics, j, recover())
+				wg.Done()
+			}()
+
+			this.inverseMergeTPSITask(data, dst, count, ckSize, firstChunk, lastChunk)
+		}(j, c, c+int(jobsPerTask[j]))
+
+		c += int(jobsPerTask[j])
+	}
+
+	wg.Wait()
+
+	internal.RaiseWorkerPanic(panics)
+}
+
+// inverseMergeTPSITask decodes the chunks in [firstChunk, lastChunk)
+// (interleaved to hide the memory latency)
+func (this *BWT) inverseMergeTPSITask(data []int32, dst []byte, count, ckSize, firstChunk, lastChunk int) {
+	var t [8]int32
+	var d [8][]byte
+	n := lastChunk - firstChunk
+
+	for i := 0; i < n; i++ {
+		c := firstChunk + i
+		t[i] = int32(this.PrimaryIndex(c) - 1)
+		d[i] = dst[c*ckSize : min((c+1)*ckSize, count)]
+	}
+
+	// Only the last chunk may be shorter
+	end := len(d[n-1])
+
+	for k := 0; k < end; k++ {
+		for i := 0; i < n; i++ {
+			ptr := data[t[i]]
+			d[i][k] = byte(ptr)
+			t[i] = ptr >> 8
+		}
+	}
+
+	for k := end; k < ckSize; k++ {
+		for i := 0; i < n-1; i++ {
+			ptr := data[t[i]]
+			d[i][k] = byte(ptr)
+			t[i] = ptr >> 8
+		}
+	}
+}
+
 // When count > _BWT_BLOCK_SIZE_THRESHOLD2, biPSIv2 algo
 func (this *BWT) inverseBiPSIv2(src, dst []byte, count int) (uint, uint, error) {
 	// Lazy dynamic memory allocations
 	minLenBuf := max(count+1, 256)
 
 	if len(this.buffer) < minLenBuf {
-		this.buffer = make([]int32, minLenBuf)
+		this.buffer = internal.DefaultBufferPool.GetInts(minLenBuf)
 	}
 
 	pIdx := int(this.PrimaryIndex(0))
@@ -462,7 +582,7 @@ func (this *BWT) inverseBiPSIv2(src, dst []byte, count int) (uint, uint, error)
 		}
 	}
 
-	chunks := GetBWTChunks(count)
+	chunks := this.chunks(count)
 
 	// Build inverse
 	// Several chunks may be decoded concurrently (depending on the availability
@@ -476,21 +596,30 @@ func (this *BWT) inverseBiPSIv2(src, dst []byte, count int) (uint, uint, error)
 	nbTasks := min(int(this.jobs), chunks)
 	jobsPerTask, _ := internal.ComputeJobsPerTask(make([]uint, nbTasks), uint(chunks), uint(nbTasks))
 	var wg sync.WaitGroup
+	panics := make([]any, nbTasks)
 
 	for j, c := 0, 0; j < nbTasks; j++ {
 		wg.Add(1)
 		start := c * ckSize
 
-		go func(dst []byte, buckets []int, fastBits []uint16, indexes []uint, total, start, ckSize, firstChunk, lastChunk int) {
+		go func(j int, dst []byte, buckets []int, fastBits []uint16, indexes []uint, total, start, ckSize, firstChunk, lastChunk int) {
+			// Invalid data may cause a panic that the caller cannot recover
+			// in this goroutine: report it to the caller.
+			defer func() {
+				internal.RecoverWorker(panics, j, recover())
+				wg.Done()
+			}()
+
 			this.inverseBiPSIv2Task(dst, buckets, fastBits, indexes, total, start, ckSize, firstChunk, lastChunk)
-			wg.Done()
-		}(dst, buckets[:], fastBits, this.primaryIndexes[:], count, start, ckSize, c, c+int(jobsPerTask[j]))
+		}(j, dst, buckets[:], fastBits, this.primaryIndexes[:], count, start, ckSize, c, c+int(jobsPerTask[j]))
 
 		c += int(jobsPerTask[j])
 	}
 
 	wg.Wait()
 
+	internal.RaiseWorkerPanic(panics)
+
 	dst[count-1] = byte(lastc)
 	return uint(count), uint(count), nil
 }
@@ -619,13 +748,383 @@ func (this *BWT) inverseBiPSIv2Task(dst []byte, buckets []int, fastBits []uint16
 	}
 }
 
+// forwardLowMemory computes the BWT of src by sub-chunks, from the end of
+// src to the start. The BWT rows of the suffixes already processed are kept
+// at the end of dst (except row 0, the empty suffix, whose symbol is always
+// src[n-1]). For each new sub-chunk, the rank of each of its suffixes among
+// the suffixes already processed is computed by backward search. These ranks
+// are used to sort the suffixes of the sub-chunk which are then merged in
+// place with the existing rows.
+func (this *BWT) forwardLowMemory(src, dst []byte) {
+	n := len(src)
+	chunks := this.chunks(n)
+	step := n / chunks
+
+	if step*chunks != n {
+		step++
+	}
+
+	subSize := this.subChunkSize
+
+	if subSize <= 0 {
+		subSize = max((n+_BWT_LOW_MEM_SUBCHUNKS-1)/_BWT_LOW_MEM_SUBCHUNKS, _BWT_LOW_MEM_MIN_SUBCHUNK)
+	}
+
+	subSize = min(subSize, _BWT_LOW_MEM_MAX_SUBCHUNK)
+
+	var symbols [256]byte
+
+	for i := range symbols {
+		symbols[i] = byte(i)
+	}
+
+	var freqs [256]int
+	var tracked [8]int // suffixes with a primary index (already processed)
+	nbTracked := 0
+
+	// The work buffers are allocated once (for the largest sub-chunk)
+	subSize = min(subSize, n)
+	rk := make([]int32, subSize)
+	keys := make([]uint64, 2*(subSize+1))
+	work := make([]int32, 4*(subSize+1)+1)
+	occ := make([]int32, ((n>>_BWT_LOW_MEM_OCC_LOG)+1)<<8)
+	rows := 1      // number of rows processed, including the empty suffix
+	dollarRow := 0 // row of the first suffix processed (its symbol is unknown yet)
+	last := int(src[n-1])
+
+	for end := n; end > 0; end -= subSize {
+		start := max(end-subSize, 0)
+		size := end - start
+		base := n - (rows - 1)
+		old := dst[base:n]
+
+		// Symbol occurrences in the existing rows, every 2^_BWT_LOW_MEM_OCC_LOG rows
+		clear(occ[0:256])
+
+		for i := 0; i+(1<<_BWT_LOW_MEM_OCC_LOG) <= len(old); i += 1 << _BWT_LOW_MEM_OCC_LOG {
+			b := (i >> _BWT_LOW_MEM_OCC_LOG) << 8
+			var histo [256]int
+			internal.ComputeHistogram(old[i:i+(1<<_BWT_LOW_MEM_OCC_LOG)], histo[:], true, false)
+
+			for c := range histo {
+				occ[b+256+c] = occ[b+c] + int32(histo[c])
+			}
+		}
+
+		var firsts [256]int
+		sum := 1
+
+		for c := range firsts {
+			firsts[c] = sum
+			sum += freqs[c]
+		}
+
+		// Backward search: rank of each suffix of the sub-chunk among the
+		// suffixes already processed
+		r := dollarRow
+
+		for k := end - 1; k >= start; k-- {
+			c := int(src[k])
+			res := firsts[c]
+
+			if r > 0 && dollarRow != 0 && c == last {
+				res++
+			}
+
+			if r > 1 {
+				// Count from the nearest sample
+				b := (r - 1) >> _BWT_LOW_MEM_OCC_LOG
+				next := (b + 1) << _BWT_LOW_MEM_OCC_LOG
+
+				if (r-1)&(1<<_BWT_LOW_MEM_OCC_LOG-1) >= 1<<(_BWT_LOW_MEM_OCC_LOG-1) && next <= len(old) {
+					res += int(occ[(b+1)<<8+c])
+					res -= bytes.Count(old[r-1:next], symbols[c:c+1])
+				} else {
+					res += int(occ[b<<8+c])
+					res += bytes.Count(old[b<<_BWT_LOW_MEM_OCC_LOG:r-1], symbols[c:c+1])
+				}
+
+				// The symbol of the first suffix processed is a placeholder (0)
+				if c == 0 && dollarRow > 0 && dollarRow < r {
+					res--
+				}
+			}
+
+			r = res
+			rk[k-start] = int32(r)
+		}
+
+		// Sort the suffixes of the sub-chunk. Each symbol is replaced with
+		// (2*rank of next suffix, byte) and a terminal symbol equal to
+		// 2*dollarRow+1 stands for the suffixes already processed.
+		// The keys (at most 40 bits) are packed with the positions (at most
+		// 24 bits) and sorted to compute dense symbols.
+		k0 := keys[0 : size+1]
+
+		for i := 0; i < size; i++ {
+			k0[i] = (uint64(rk[i])<<9|uint64(src[start+i]))<<24 | uint64(i)
+		}
+
+		k0[size] = uint64(2*dollarRow+1)<<32 | uint64(size)
+		k0 = bwtRadixSort(k0, keys[size+1:2*(size+1)], 24)
+		x := work[0 : size+1]
+		nbSymbols := 0
+
+		for i := range k0 {
+			if i > 0 && k0[i]>>24 != k0[i-1]>>24 {
+				nbSymbols++
+			}
+
+			x[k0[i]&0xFFFFFF] = int32(nbSymbols)
+		}
+
+		nbSymbols++
+		sa := bwtSortSuffixes(x, work[size+1:2*(size+1)], work[2*(size+1):3*(size+1)], work[3*(size+1):], nbSymbols)
+
+		// Update the rows of the tracked suffixes: an existing row r moves
+		// down by the number of new suffixes with a rank less or equal to r.
+		for t := 0; t < nbTracked; t++ {
+			row := int(this.primaryIndexes[tracked[t]])
+			cnt := 0
+
+			for _, p := range sa {
+				if int(p) != size && int(rk[p]) <= row {
+					cnt++
+				} else if int(p) != size {
+					break
+				}
+			}
+
+			this.primaryIndexes[tracked[t]] = uint(row + cnt)
+		}
+
+		// Merge in place (the write index never passes the read index). The
+		// new suffix with rank r goes before the existing row r: the existing
+		// rows in between are moved with one copy.
+		w, rd, row := base-size, base, 1
+		newDollarRow := 0
+
+		for _, p := range sa {
+			if int(p) == size {
+				continue
+			}
+
+			if r := min(int(rk[p]), rows); r > row {
+				copy(dst[w:w+r-row], dst[rd:rd+r-row])
+
+				if dollarRow >= row && dollarRow < r {
+					dst[w+dollarRow-row] = src[end-1]
+				}
+
+				w += r - row
+				rd += r - row
+				row = r
+			}
+
+			k := start + int(p)
+			newRow := w - (base - size) + 1
+
+			if k == start {
+				dst[w] = 0
+				newDollarRow = newRow
+			} else {
+				dst[w] = src[k-1]
+			}
+
+			if k%step == 0 {
+				this.primaryIndexes[k/step] = uint(newRow)
+				tracked[nbTracked] = k / step
+				nbTracked++
+			}
+
+			w++
+		}
+
+		// Remaining existing rows (already in place)
+		if dollarRow >= row {
+			dst[w+dollarRow-row] = src[end-1]
+		}
+
+		for _, c := range src[start:end] {
+			freqs[c]++
+		}
+
+		rows += size
+		dollarRow = newDollarRow
+	}
+
+	// Remove the placeholder (row of the whole input) and add row 0
+	copy(dst[1:dollarRow], dst[0:dollarRow-1])
+	dst[0] = src[n-1]
+}
+
+// bwtRadixSort sorts the keys by key>>shift (LSD radix sort by 11 bits,
+// stable) using buf (same size as keys). Returns the sorted slice (keys
+// or buf).
+func bwtRadixSort(keys, buf []uint64, shift uint) []uint64 {
+	maxKey := uint64(0)
+
+	for _, k := range keys {
+		maxKey = max(maxKey, k>>shift)
+	}
+
+	for ; maxKey != 0; maxKey >>= 11 {
+		var counts [2048]int
+
+		for _, k := range keys {
+			counts[(k>>shift)&2047]++
+		}
+
+		sum := 0
+
+		for i, c := range counts {
+			counts[i] = sum
+			sum += c
+		}
+
+		for _, k := range keys {
+			d := (k >> shift) & 2047
+			buf[counts[d]] = k
+			counts[d]++
+		}
+
+		keys, buf = buf, keys
+		shift += 11
+	}
+
+	return keys
+}
+
+// bwtSortSuffixes returns the suffix array of x (values in [0..alphabet))
+// using prefix doubling with radix sorts. The last symbol of x must be unique.
+// The content of x is destroyed. sa (returned) and tmp have the size of x,
+// counts has at least one more element.
+func bwtSortSuffixes(x, sa, tmp, counts []int32, alphabet int) []int32 {
+	n := len(x)
+	ranks := x
+	clear(counts[0:alphabet])
+
+	for _, v := range ranks {
+		counts[v]++
+	}
+
+	sum := int32(0)
+
+	for i := 0; i < alphabet; i++ {
+		c := counts[i]
+		counts[i] = sum
+		sum += c
+	}
+
+	for i, v := range ranks {
+		sa[counts[v]] = int32(i)
+		counts[v]++
+	}
+
+	maxRank := alphabet - 1
+
+	for h := 1; maxRank < n-1; h <<= 1 {
+		// Order by second key (suffixes shorter than h first)
+		p := 0
+
+		for i := max(n-h, 0); i < n; i++ {
+			tmp[p] = int32(i)
+			p++
+		}
+
+		for _, s := range sa {
+			if int(s) >= h {
+				tmp[p] = s - int32(h)
+				p++
+			}
+		}
+
+		// Stable sort by first key
+		clear(counts[0 : maxRank+1])
+
+		for _, v := range ranks {
+			counts[v]++
+		}
+
+		sum = 0
+
+		for i := 0; i <= maxRank; i++ {
+			c := counts[i]
+			counts[i] = sum
+			sum += c
+		}
+
+		for _, s := range tmp {
+			v := ranks[s]
+			sa[counts[v]] = s
+			counts[v]++
+		}
+
+		// Compute new ranks
+		second := func(s int32) int32 {
+			if int(s)+h < n {
+				return ranks[int(s)+h]
+			}
+
+			return -1
+		}
+
+		r := int32(0)
+		prev := sa[0]
+		tmp[prev] = 0
+
+		for _, s := range sa[1:] {
+			if ranks[s] != ranks[prev] || second(s) != second(prev) {
+				r++
+			}
+
+			tmp[s] = r
+			prev = s
+		}
+
+		ranks, tmp = tmp, ranks
+		maxRank = int(r)
+	}
+
+	return sa
+}
+
 // GetBWTChunks returns the number of chunks for a given block size
+// (bitstream version 6 and older)
 func GetBWTChunks(size int) int {
+	return getBWTChunks(size, 8)
+}
+
+// GetBWTChunksForVersion returns the number of chunks for a given block size
+// and bitstream version
+func GetBWTChunksForVersion(size int, bsVersion uint) int {
+	if bsVersion >= 7 {
+		return getBWTChunks(size, _BWT_MAX_CHUNKS)
+	}
+
+	return getBWTChunks(size, 8)
+}
+
+// getBWTChunks returns 1 chunk for small blocks, 8 chunks otherwise and
+// doubles the number of chunks, up to maxChunks, while the chunks have at
+// least _BWT_MIN_CHUNK_SIZE bytes
+func getBWTChunks(size, maxChunks int) int {
 	if size < _BWT_BLOCK_SIZE_THRESHOLD1 {
 		return 1
 	}
 
-	return 8
+	res := 8
+
+	for res < maxChunks && size >= 2*res*_BWT_MIN_CHUNK_SIZE {
+		res <<= 1
+	}
+
+	return res
+}
+
+// chunks returns the number of chunks (primary indexes) of a block
+func (this *BWT) chunks(size int) int {
+	return getBWTChunks(size, this.maxChunks)
 }
 
 // MaxEncodedLen returns the max size required for the encoding output buffer
@@ -33,6 +33,8 @@ const (
 //   yyy: log(chunks)
 //   zz: primary index size - 1 (in bytes)
 //   primary indexes (chunks * (8|16|24|32 bits))
+// The number of chunks depends on the block size and the bitstream version
+// (see BWT.go).
 
 // BWTBlockCodec a codec that encapsulates a Burrows Wheeler Transform and
 // takes care of encoding/decoding information about the primary indexes in a header.
@@ -93,7 +95,7 @@ func (this *BWTBlockCodec) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, errors.New("BWT forward failed: invalid index size")
 	}
 
-	chunks := GetBWTChunks(blockSize)
+	chunks := this.bwt.chunks(blockSize)
 	logNbChunks := internal.Log2NoCheck(uint32(chunks))
 
 	if logNbChunks > 7 {
@@ -157,17 +159,16 @@ func (this *BWTBlockCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		chunks := 1 << logNbChunks
-
-		if chunks != GetBWTChunks(blockSize) {
-			return 0, 0, errors.New("BWT inverse transform failed: invalid number of chunks")
-		}
-
 		headerSize := chunks*pIndexSize + 1
 
 		if len(src) < headerSize || blockSize < headerSize {
 			return 0, 0, errors.New("BWT inverse transform failed: invalid header size")
 		}
 
+		if chunks != this.bwt.chunks(blockSize-headerSize) {
+			return 0, 0, errors.New("BWT inverse transform failed: invalid number of chunks")
+		}
+
 		// Read header
 		for i, idx := 0, 1; i < chunks; i++ {
 			shift := (pIndexSize - 1) << 3
@@ -224,5 +225,5 @@ func (this *BWTBlockCodec) Inverse(src, dst []byte) (uint, uint, error) {
 
 // MaxEncodedLen returns the max size required for the encoding output buffer
 func (this *BWTBlockCodec) MaxEncodedLen(srcLen int) int {
-	return srcLen + _BWT_MAX_HEADER_SIZE
+	return srcLen + max(_BWT_MAX_HEADER_SIZE, 4*this.bwt.chunks(srcLen)+1)
 }
@@ -16,8 +16,11 @@ limitations under the License.
 package transform
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
+	"runtime"
+	"sort"
 	"testing"
 	"time"
 
@@ -162,3 +165,304 @@ func testCorrectnessBWT(isBWT bool) error {
 
 	return error(nil)
 }
+
+func TestSuffixArray(b *testing.T) {
+	fmt.Println("Test SuffixArray")
+
+	if _, err := SuffixArray([]byte{}); err == nil {
+		b.Errorf("Expected error on empty input")
+	}
+
+	for ii := 0; ii < 20; ii++ {
+		var buf []byte
+
+		if ii == 0 {
+			buf = []byte("mississippi")
+		} else {
+			buf = make([]byte, 1+rand.Intn(2000))
+
+			for i := range buf {
+				buf[i] = byte(65 + rand.Intn(ii))
+			}
+		}
+
+		sa, err := SuffixArray(buf)
+
+		if err != nil {
+			b.Fatalf("SuffixArray failed: %v", err)
+		}
+
+		// Naive suffix array
+		expected := make([]int32, len(buf))
+
+		for i := range expected {
+			expected[i] = int32(i)
+		}
+
+		sort.Slice(expected, func(i, j int) bool {
+			return bytes.Compare(buf[expected[i]:], buf[expected[j]:]) < 0
+		})
+
+		for i := range sa {
+			if sa[i] != expected[i] {
+				b.Fatalf("Incorrect suffix array at index %d: expected %d, got %d", i, expected[i], sa[i])
+			}
+		}
+
+		// BWT: dst[0] = last symbol, then the symbols preceding each suffix
+		// (the whole input is skipped and its rank+1 is the primary index)
+		dst := make([]byte, len(buf))
+		pIdx, err := BWTTransform(buf, dst)
+
+		if err != nil {
+			b.Fatalf("BWTTransform failed: %v", err)
+		}
+
+		bwt := []byte{buf[len(buf)-1]}
+
+		for i, s := range expected {
+			if s == 0 {
+				if pIdx != i+1 {
+					b.Fatalf("Incorrect primary index: expected %d, got %d", i+1, pIdx)
+				}
+
+				continue
+			}
+
+			bwt = append(bwt, buf[s-1])
+		}
+
+		if !bytes.Equal(bwt, dst) {
+			b.Fatalf("Incorrect BWT for input of size %d", len(buf))
+		}
+	}
+
+	if _, err := BWTTransform([]byte("abc"), make([]byte, 2)); err == nil {
+		b.Errorf("Expected error on small output buffer")
+	}
+}
+
+func TestBWTLowMemory(b *testing.T) {
+	fmt.Println("Test BWT low memory mode")
+
+	for ii := 0; ii < 12; ii++ {
+		var buf []byte
+
+		switch {
+		case ii == 0:
+			buf = []byte("mississippi")
+		case ii == 1:
+			buf = make([]byte, 5000)
+		case ii == 2:
+			buf = bytes.Repeat([]byte("abracadabra"), 700)
+		default:
+			buf = make([]byte, 1+rand.Intn(30000))
+
+			for i := range buf {
+				buf[i] = byte(65 + rand.Intn(ii))
+			}
+		}
+
+		ref, _ := NewBWT()
+		expected := make([]byte, len(buf))
+		ref.Forward(buf, expected)
+
+		for _, subSize := range []int{7, 100, 4096, len(buf)} {
+			bwt, _ := NewBWT()
+			bwt.subChunkSize = subSize
+			dst := make([]byte, len(buf))
+			bwt.forwardLowMemory(buf, dst)
+
+			if !bytes.Equal(expected, dst) {
+				b.Fatalf("Incorrect BWT for input of size %d (sub-chunk size %d)", len(buf), subSize)
+			}
+
+			step := (len(buf) + GetBWTChunks(len(buf)) - 1) / GetBWTChunks(len(buf))
+
+			for i := 0; i*step < len(buf); i++ {
+				if bwt.PrimaryIndex(i) != ref.PrimaryIndex(i) {
+					b.Fatalf("Incorrect primary index %d for input of size %d (sub-chunk size %d): expected %d, got %d",
+						i, len(buf), subSize, ref.PrimaryIndex(i), bwt.PrimaryIndex(i))
+				}
+			}
+		}
+	}
+
+	// Full path, including the inverse
+	ctx := map[string]any{"bwtLowMemory": true}
+	bwt, _ := NewBWTWithCtx(&ctx)
+	buf := make([]byte, _BWT_LOW_MEM_THRESHOLD+12345)
+
+	for i := range buf {
+		buf[i] = byte(rand.Intn(4) + 'a')
+	}
+
+	dst := make([]byte, len(buf))
+	res := make([]byte, len(buf))
+
+	if _, _, err := bwt.Forward(buf, dst); err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	if _, _, err := bwt.Inverse(dst, res); err != nil {
+		b.Fatalf("Inverse failed: %v", err)
+	}
+
+	if !bytes.Equal(buf, res) {
+		b.Errorf("Low memory BWT round trip failed")
+	}
+}
+
+func TestBWTLowMemoryFootprint(b *testing.T) {
+	fmt.Println("Test BWT low memory footprint")
+
+	for _, size := range []int{_BWT_LOW_MEM_THRESHOLD, 3 * _BWT_LOW_MEM_THRESHOLD} {
+		buf := make([]byte, size)
+
+		for i := range buf {
+			buf[i] = byte(rand.Intn(64) + 32)
+		}
+
+		dst := make([]byte, size)
+		bwt, _ := NewBWT()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		bwt.forwardLowMemory(buf, dst)
+		runtime.ReadMemStats(&after)
+
+		// The work buffers are allocated once: the allocated size is the peak
+		extra := after.TotalAlloc - before.TotalAlloc
+		fmt.Printf("Size %d: %d bytes of work buffers\n", size, extra)
+
+		if extra > uint64(size) {
+			b.Errorf("Size %d: too much memory allocated: %d bytes", size, extra)
+		}
+	}
+}
+
+func TestBWTConcurrentSort(b *testing.T) {
+	fmt.Println("Test BWT with concurrent suffix sorting")
+	inputs := [][]byte{
+		bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 20000),
+		make([]byte, 1<<20),
+		make([]byte, 600000),
+	}
+
+	for i := range inputs[1] {
+		inputs[1][i] = byte(rand.Intn(256))
+	}
+
+	for i := range inputs[2] {
+		inputs[2][i] = byte(65 + rand.Intn(4))
+	}
+
+	for _, buf := range inputs {
+		ref, _ := NewBWT()
+		expected := make([]byte, len(buf))
+		ref.Forward(buf, expected)
+
+		for _, jobs := range []uint{2, 5, 16} {
+			ctx := map[string]any{"jobs": jobs}
+			bwt, _ := NewBWTWithCtx(&ctx)
+			dst := make([]byte, len(buf))
+			bwt.Forward(buf, dst)
+
+			if !bytes.Equal(expected, dst) {
+				b.Fatalf("Incorrect BWT for input of size %d with %d jobs", len(buf), jobs)
+			}
+
+			for i := 0; i < GetBWTChunks(len(buf)); i++ {
+				if bwt.PrimaryIndex(i) != ref.PrimaryIndex(i) {
+					b.Fatalf("Incorrect primary index %d for input of size %d with %d jobs", i, len(buf), jobs)
+				}
+			}
+		}
+	}
+}
+
+func TestBWTConcurrentInverse(b *testing.T) {
+	fmt.Println("Test BWT with concurrent inverse")
+
+	for _, size := range []int{_BWT_MT_INVERSE_THRESHOLD, 1000003, 3 << 20} {
+		buf := make([]byte, size)
+
+		for i := range buf {
+			buf[i] = byte(65 + rand.Intn(4+i>>16))
+		}
+
+		ref, _ := NewBWT()
+		transformed := make([]byte, size)
+		ref.Forward(buf, transformed)
+
+		for _, jobs := range []uint{1, 2, 3, 8, 16} {
+			ctx := map[string]any{"jobs": jobs}
+			bwt, _ := NewBWTWithCtx(&ctx)
+
+			for i := 0; i < GetBWTChunks(size); i++ {
+				bwt.SetPrimaryIndex(i, ref.PrimaryIndex(i))
+			}
+
+			dst := make([]byte, size)
+
+			if _, _, err := bwt.Inverse(transformed, dst); err != nil {
+				b.Fatalf("Inverse failed for input of size %d with %d jobs: %v", size, jobs, err)
+			}
+
+			if !bytes.Equal(buf, dst) {
+				b.Fatalf("Incorrect inverse BWT for input of size %d with %d jobs", size, jobs)
+			}
+		}
+	}
+}
+
+func TestBWTMultiIndex(b *testing.T) {
+	fmt.Println("Test BWT with more than 8 primary indexes")
+
+	for _, size := range []int{4 << 20, 16 << 20, 256 << 20} {
+		if got, want := GetBWTChunksForVersion(size, 7), min(max(size>>20, 8), _BWT_MAX_CHUNKS); got != want {
+			b.Errorf("Expected %d chunks for size %d, got %d", want, size, got)
+		}
+
+		if GetBWTChunksForVersion(size, 6) != 8 {
+			b.Errorf("Expected 8 chunks for size %d with bitstream version 6", size)
+		}
+	}
+
+	size := 17 << 20
+	buf := make([]byte, size)
+
+	for i := range buf {
+		buf[i] = byte(65 + rand.Intn(4+i>>20))
+	}
+
+	ctx := map[string]any{"jobs": uint(4), "bsVersion": uint(7)}
+	codec, _ := NewBWTBlockCodecWithCtx(&ctx)
+	transformed := make([]byte, codec.MaxEncodedLen(size))
+	_, n, err := codec.Forward(buf, transformed)
+
+	if err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	if chunks := 1 << ((transformed[0] >> 2) & 0x07); chunks != 16 {
+		b.Errorf("Expected 16 primary indexes in the header, got %d", chunks)
+	}
+
+	for _, jobs := range []uint{1, 5, 16} {
+		ctx := map[string]any{"jobs": jobs, "bsVersion": uint(7)}
+		codec, _ := NewBWTBlockCodecWithCtx(&ctx)
+		dst := make([]byte, size)
+
+		if _, _, err := codec.Inverse(transformed[0:n], dst); err != nil || bytes.Equal(buf, dst) == false {
+			b.Fatalf("Incorrect inverse BWT with %d jobs: %v", jobs, err)
+		}
+	}
+
+	// A version 6 decoder expects 8 primary indexes
+	ctx = map[string]any{"jobs": uint(2), "bsVersion": uint(6)}
+	codec, _ = NewBWTBlockCodecWithCtx(&ctx)
+
+	if _, _, err := codec.Inverse(transformed[0:n], make([]byte, size)); err == nil {
+		b.Errorf("Expected error decoding 16 primary indexes with bitstream version 6")
+	}
+}
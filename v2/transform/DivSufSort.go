@@ -15,6 +15,15 @@ limitations under the License.
 
 package transform
 
+import (
+	"errors"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
 const (
 	_SS_INSERTIONSORT_THRESHOLD = int32(16)
 	_SS_BLOCKSIZE               = int32(4096)
@@ -22,9 +31,7 @@ const (
 	_SS_SMERGE_STACKSIZE        = int32(32)
 	_TR_STACKSIZE               = int32(64)
 	_TR_INSERTIONSORT_THRESHOLD = int32(16)
-	_MASK_FFFF0000              = -65536    // make 32 bit systems happy
-	_MASK_FF000000              = -16777216 // make 32 bit systems happy
-	_MASK_0000FF00              = 65280     // make 32 bit systems happy
+	_SS_PARALLEL_THRESHOLD      = int32(1 << 16) // min number of B* suffixes to sort concurrently
 )
 
 var _SQQ_TABLE = []int32{
@@ -69,6 +76,14 @@ type DivSufSort struct {
 	mergestack *stack
 	bucketA    [256]int32
 	bucketB    [65536]int32
+	jobs       int
+}
+
+// ssRange a bucket of type B* substrings to sort
+type ssRange struct {
+	first      int32
+	last       int32
+	lastSuffix bool
 }
 
 // NewDivSufSort creates a new instance of DivSufSort
@@ -77,6 +92,23 @@ func NewDivSufSort() (*DivSufSort, error) {
 	this.ssStack = newStack(_SS_MISORT_STACKSIZE)
 	this.trStack = newStack(_TR_STACKSIZE)
 	this.mergestack = newStack(_SS_SMERGE_STACKSIZE)
+	this.jobs = 1
+	return this, nil
+}
+
+// NewDivSufSortWithCtx creates a new instance of DivSufSort. The number of
+// jobs used to sort the type B* substrings of large inputs concurrently is
+// extracted from the provided map. The result does not depend on the
+// number of jobs.
+func NewDivSufSortWithCtx(ctx *map[string]any) (*DivSufSort, error) {
+	this, _ := NewDivSufSort()
+
+	if val, containsKey := (*ctx)["jobs"]; containsKey {
+		if this.jobs = int(val.(uint)); this.jobs == 0 {
+			return nil, errors.New("The number of jobs must be at least 1")
+		}
+	}
+
 	return this, nil
 }
 
@@ -402,17 +434,38 @@ func (this *DivSufSort) sortTypeBstar(bucketA, bucketB []int32, n int32) int32 {
 		bufSize := n - m - m
 		x0 = 254
 
-		for j := m; j > 0; x0-- {
-			idx := x0 << 8
+		if this.jobs > 1 && m >= _SS_PARALLEL_THRESHOLD {
+			// The buckets are independent: sort them concurrently
+			ranges := make([]ssRange, 0, 256)
 
-			for x1 := 255; x1 > x0; x1-- {
-				i := bucketB[idx+x1]
+			for j := m; j > 0; x0-- {
+				idx := x0 << 8
+
+				for x1 := 255; x1 > x0; x1-- {
+					i := bucketB[idx+x1]
 
-				if j-i > 1 {
-					this.ssSort(pab, i, j, m, bufSize, 2, n, arr[i] == m-1)
+					if j-i > 1 {
+						ranges = append(ranges, ssRange{first: i, last: j, lastSuffix: arr[i] == m-1})
+					}
+
+					j = i
 				}
+			}
 
-				j = i
+			this.ssSortConcurrently(ranges, pab, m, bufSize, n)
+		} else {
+			for j := m; j > 0; x0-- {
+				idx := x0 << 8
+
+				for x1 := 255; x1 > x0; x1-- {
+					i := bucketB[idx+x1]
+
+					if j-i > 1 {
+						this.ssSort(pab, i, j, m, bufSize, 2, n, arr[i] == m-1)
+					}
+
+					j = i
+				}
 			}
 		}
 
@@ -530,6 +583,51 @@ func (this *DivSufSort) sortTypeBstar(bucketA, bucketB []int32, n int32) int32 {
 	return m
 }
 
+// ssSortConcurrently sorts the buckets of type B* substrings with several
+// jobs. Each job has its own stacks and its own share of the work buffer
+// (starting at buf in the suffix array).
+func (this *DivSufSort) ssSortConcurrently(ranges []ssRange, pa, buf, bufSize, n int32) {
+	jobs := min(this.jobs, len(ranges))
+
+	if jobs <= 1 {
+		for _, r := range ranges {
+			this.ssSort(pa, r.first, r.last, buf, bufSize, 2, n, r.lastSuffix)
+		}
+
+		return
+	}
+
+	jobBufSize := bufSize / int32(jobs)
+	next := int32(-1)
+	panics := make([]any, jobs)
+	var wg sync.WaitGroup
+
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+
+		go func(j int) {
+			// Report a panic to the caller (it cannot be recovered from here)
+			defer func() {
+				internal.RecoverWorker(panics, j, recover())
+				wg.Done()
+			}()
+
+			worker := &DivSufSort{sa: this.sa, buffer: this.buffer, jobs: 1}
+			worker.ssStack = newStack(_SS_MISORT_STACKSIZE)
+			worker.mergestack = newStack(_SS_SMERGE_STACKSIZE)
+
+			for k := atomic.AddInt32(&next, 1); int(k) < len(ranges); k = atomic.AddInt32(&next, 1) {
+				r := ranges[k]
+				worker.ssSort(pa, r.first, r.last, buf+int32(j)*jobBufSize, jobBufSize, 2, n, r.lastSuffix)
+			}
+		}(j)
+	}
+
+	wg.Wait()
+
+	internal.RaiseWorkerPanic(panics)
+}
+
 // Sub String Sort
 func (this *DivSufSort) ssSort(pa, first, last, buf, bufSize, depth, n int32, lastSuffix bool) {
 	if lastSuffix == true {
@@ -1292,21 +1390,7 @@ func ssIsqrt(x int32) int32 {
 		return _SS_BLOCKSIZE
 	}
 
-	var e int32
-
-	if x&_MASK_FFFF0000 != 0 {
-		if x&_MASK_FF000000 != 0 {
-			e = 24 + _LOG_TABLE[(x>>24)&0xFF]
-		} else {
-			e = 16 + _LOG_TABLE[(x>>16)&0xFF]
-		}
-	} else {
-		if x&_MASK_0000FF00 != 0 {
-			e = 8 + _LOG_TABLE[(x>>8)&0xFF]
-		} else {
-			e = _LOG_TABLE[x&0xFF]
-		}
-	}
+	e := trIlg(x)
 
 	if e < 8 {
 		return _SQQ_TABLE[x] >> 4
@@ -2604,20 +2688,11 @@ func (this *DivSufSort) trCopy(isa, first, a, b, last, depth int32) {
 	}
 }
 
+// trIlg returns the index of the most significant bit of n (-1 if n is 0).
+// The bits of n are processed as uint32 (same result on 32 and 64 bit
+// platforms).
 func trIlg(n int32) int32 {
-	if n&_MASK_FFFF0000 != 0 {
-		if n&_MASK_FF000000 != 0 {
-			return 24 + _LOG_TABLE[(n>>24)&0xFF]
-		}
-
-		return 16 + _LOG_TABLE[(n>>16)&0xFF]
-	}
-
-	if n&_MASK_0000FF00 != 0 {
-		return 8 + _LOG_TABLE[(n>>8)&0xFF]
-	}
-
-	return _LOG_TABLE[n&0xFF]
+	return int32(bits.Len32(uint32(n))) - 1
 }
 
 type stackElement struct {
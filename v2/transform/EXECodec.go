@@ -64,7 +64,10 @@ const (
 	_EXE_MAC_LC_SEGMENT64     = 0x19
 	_EXE_MIN_BLOCK_SIZE       = 4096
 	_EXE_MAX_BLOCK_SIZE       = (1 << (26 + 2)) - 1 // max offset << 2
-
+	_EXE_ELF_SHT_PROGBITS     = 1
+	_EXE_ELF_SHF_EXECINSTR    = 0x04
+	_EXE_WIN_SCN_CODE         = 0x00000020
+	_EXE_WIN_SCN_MEM_EXECUTE  = 0x20000000
 )
 
 // EXECodec a codec for x86 code
@@ -120,14 +123,8 @@ func (this *EXECodec) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, fmt.Errorf("ExeCodec forward transform skip: Output buffer too small - size: %d, required %d", len(dst), n)
 	}
 
-	if this.ctx != nil {
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt := val.(internal.DataType)
-
-			if dt != internal.DT_UNDEFINED && dt != internal.DT_EXE && dt != internal.DT_BIN {
-				return 0, 0, fmt.Errorf("ExeCodec forward transform skip: Input is not an executable")
-			}
-		}
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_EXE && dt != internal.DT_BIN {
+		return 0, 0, fmt.Errorf("ExeCodec forward transform skip: Input is not an executable")
 	}
 
 	codeStart := 0
@@ -135,18 +132,14 @@ func (this *EXECodec) Forward(src, dst []byte) (uint, uint, error) {
 	mode := detectExeType(src[:codeEnd+4], &codeStart, &codeEnd)
 
 	if mode&_EXE_NOT_EXE != 0 {
-		if this.ctx != nil {
-			(*this.ctx)["dataType"] = internal.DataType(mode & _EXE_MASK_DT)
-		}
+		internal.SetDataType(this.ctx, internal.DataType(mode&_EXE_MASK_DT))
 
 		return 0, 0, fmt.Errorf("ExeCodec forward transform skip: Input is not an executable")
 	}
 
 	mode &= ^byte(_EXE_MASK_DT)
 
-	if this.ctx != nil {
-		(*this.ctx)["dataType"] = internal.DT_EXE
-	}
+	internal.SetDataType(this.ctx, internal.DT_EXE)
 
 	if mode == _EXE_X86 {
 		return this.forwardX86(src, dst, codeStart, codeEnd)
@@ -209,7 +202,7 @@ func (this *EXECodec) forwardX86(src, dst []byte, codeStart, codeEnd int) (uint,
 
 		// Current instruction is a jump/call.
 		sgn := src[srcIdx+4]
-		offset := int(binary.LittleEndian.Uint32(src[srcIdx+1:]))
+		offset := int64(binary.LittleEndian.Uint32(src[srcIdx+1:]))
 
 		if (sgn != 0 && sgn != 0xFF) || (offset == 0xFF000000) {
 			dst[dstIdx] = _EXE_X86_ESCAPE
@@ -220,7 +213,7 @@ func (this *EXECodec) forwardX86(src, dst []byte, codeStart, codeEnd int) (uint,
 		}
 
 		// Absolute target address = srcIdx + 5 + offset. Let us ignore the +5
-		addr := srcIdx
+		addr := int64(srcIdx)
 
 		if sgn == 0 {
 			addr += offset
@@ -326,8 +319,8 @@ func (this *EXECodec) inverseX86(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Current instruction is a jump/call. Decode absolute address
-		addr := int(binary.BigEndian.Uint32(src[srcIdx+1:])) ^ _EXE_MASK_ADDRESS
-		offset := addr - dstIdx
+		addr := int64(binary.BigEndian.Uint32(src[srcIdx+1:])) ^ _EXE_MASK_ADDRESS
+		offset := addr - int64(dstIdx)
 		dst[dstIdx] = src[srcIdx]
 		srcIdx++
 		dstIdx++
@@ -422,7 +415,7 @@ func (this *EXECodec) forwardARM(src, dst []byte, codeStart, codeEnd int) (uint,
 	}
 
 	for srcIdx < codeEnd && dstIdx < dstEnd {
-		instr := int(binary.LittleEndian.Uint32(src[srcIdx:]))
+		instr := int64(binary.LittleEndian.Uint32(src[srcIdx:]))
 		opcode1 := instr & _EXE_ARM_B_OPCODE_MASK
 		//opcode2 := instr & ARM_CB_OPCODE_MASK
 		isBL := (opcode1 == _EXE_ARM_OPCODE_B) || (opcode1 == _EXE_ARM_OPCODE_BL) // unconditional jump
@@ -437,18 +430,18 @@ func (this *EXECodec) forwardARM(src, dst []byte, codeStart, codeEnd int) (uint,
 			continue
 		}
 
-		var addr int
-		var val int
+		var addr int64
+		var val int64
 
 		if isBL == true {
 			// opcode(6) + sgn(1) + offset(25)
 			// Absolute target address = srcIdx +/- (offset*4)
-			offset := int(int32(instr & _EXE_ARM_B_ADDR_MASK))
+			offset := int64(int32(instr & _EXE_ARM_B_ADDR_MASK))
 
 			if instr&_EXE_ARM_B_ADDR_SGN_MASK == 0 {
-				addr = srcIdx + 4*offset
+				addr = int64(srcIdx) + 4*offset
 			} else {
-				addr = srcIdx - 4*int(int32(-offset&_EXE_ARM_B_ADDR_MASK))
+				addr = int64(srcIdx) - 4*int64(int32(-offset&_EXE_ARM_B_ADDR_MASK))
 			}
 
 			if addr < 0 {
@@ -462,9 +455,9 @@ func (this *EXECodec) forwardARM(src, dst []byte, codeStart, codeEnd int) (uint,
 			offset := (instr & _EXE_ARM_CB_ADDR_MASK) >> _EXE_ARM_CB_REG_BITS
 
 			if instr&_EXE_ARM_CB_ADDR_SGN_MASK == 0 {
-				addr = srcIdx + 4*offset
+				addr = int64(srcIdx) + 4*offset
 			} else {
-				addr = srcIdx + 4*(0xFFFC0000|offset)
+				addr = int64(srcIdx) + 4*(0xFFFC0000|offset)
 			}
 
 			if addr < 0 {
@@ -524,7 +517,7 @@ func (this *EXECodec) inverseARM(src, dst []byte) (uint, uint, error) {
 	}
 
 	for srcIdx < codeEnd {
-		instr := int(binary.LittleEndian.Uint32(src[srcIdx:]))
+		instr := int64(binary.LittleEndian.Uint32(src[srcIdx:]))
 		opcode1 := instr & _EXE_ARM_B_OPCODE_MASK
 		//copcode2 := instr & ARM_CB_OPCODE_MASK
 		isBL := (opcode1 == _EXE_ARM_OPCODE_B) || (opcode1 == _EXE_ARM_OPCODE_BL) // unconditional jump
@@ -540,16 +533,16 @@ func (this *EXECodec) inverseARM(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Decode absolute address
-		var addr int
-		var val int
+		var addr int64
+		var val int64
 
 		if isBL == true {
 			addr = (instr & _EXE_ARM_B_ADDR_MASK) << 2
-			offset := (addr - dstIdx) >> 2
+			offset := (addr - int64(dstIdx)) >> 2
 			val = opcode1 | (offset & _EXE_ARM_B_ADDR_MASK)
 		} else {
 			addr = ((instr & _EXE_ARM_CB_ADDR_MASK) >> _EXE_ARM_CB_REG_BITS) << 2
-			offset := (addr - dstIdx) >> 2
+			offset := (addr - int64(dstIdx)) >> 2
 			val = (instr & ^_EXE_ARM_CB_ADDR_MASK) | (offset << _EXE_ARM_CB_REG_BITS)
 		}
 
@@ -686,6 +679,47 @@ func detectExeType(src []byte, codeStart, codeEnd *int) byte {
 	return _EXE_NOT_EXE | byte(dt)
 }
 
+// parsePESections finds the range of the code sections in the file using
+// the section table. Returns false if no code section has been found.
+func parsePESections(src []byte, posPE int, codeStart, codeEnd *int) bool {
+	count := len(src)
+	nbSections := int(binary.LittleEndian.Uint16(src[posPE+6:]))
+	posSection := posPE + 24 + int(binary.LittleEndian.Uint16(src[posPE+20:]))
+	start, end := count, 0
+
+	for i := 0; i < nbSections; i++ {
+		startEntry := posSection + 40*i
+
+		if startEntry+40 > count {
+			break
+		}
+
+		flags := binary.LittleEndian.Uint32(src[startEntry+36:])
+
+		if flags&(_EXE_WIN_SCN_CODE|_EXE_WIN_SCN_MEM_EXECUTE) == 0 {
+			continue
+		}
+
+		lenSection := int(binary.LittleEndian.Uint32(src[startEntry+16:]))
+		offSection := int(binary.LittleEndian.Uint32(src[startEntry+20:]))
+
+		if lenSection < 64 || offSection >= count {
+			continue
+		}
+
+		start = min(start, offSection)
+		end = max(end, offSection+lenSection)
+	}
+
+	if start >= end {
+		return false
+	}
+
+	*codeStart = start
+	*codeEnd = min(end, count)
+	return true
+}
+
 // Return true if known header
 func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool {
 	count := len(src)
@@ -695,8 +729,12 @@ func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool
 			posPE := int(binary.LittleEndian.Uint32(src[60:]))
 
 			if (posPE > 0) && (posPE <= count-48) && (int(binary.LittleEndian.Uint32(src[posPE:])) == _EXE_WIN_PE) {
-				*codeStart = min(int(binary.LittleEndian.Uint32(src[posPE+44:])), count)
-				*codeEnd = min(*codeStart+int(binary.LittleEndian.Uint32(src[posPE+28:])), count)
+				if parsePESections(src, posPE, codeStart, codeEnd) == false {
+					// No section table: use the code base and size of the optional header
+					*codeStart = min(int(binary.LittleEndian.Uint32(src[posPE+44:])), count)
+					*codeEnd = min(*codeStart+int(binary.LittleEndian.Uint32(src[posPE+28:])), count)
+				}
+
 				*arch = int(binary.LittleEndian.Uint16(src[posPE+4:]))
 			}
 
@@ -724,10 +762,12 @@ func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool
 						}
 
 						typeSection := int(binary.LittleEndian.Uint32(src[startEntry+4:]))
+						flagsSection := int(binary.LittleEndian.Uint64(src[startEntry+8:]))
 						offSection := int(binary.LittleEndian.Uint64(src[startEntry+0x18:]))
 						lenSection := int(binary.LittleEndian.Uint64(src[startEntry+0x20:]))
 
-						if typeSection == 1 && lenSection >= 64 {
+						// Only the code sections (not .rodata, .data, ...)
+						if typeSection == _EXE_ELF_SHT_PROGBITS && flagsSection&_EXE_ELF_SHF_EXECINSTR != 0 && lenSection >= 64 {
 							if *codeStart == 0 {
 								*codeStart = offSection
 							}
@@ -749,10 +789,12 @@ func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool
 						}
 
 						typeSection := int(binary.LittleEndian.Uint32(src[startEntry+4:]))
+						flagsSection := int(binary.LittleEndian.Uint32(src[startEntry+8:]))
 						offSection := int(binary.LittleEndian.Uint32(src[startEntry+0x10:]))
 						lenSection := int(binary.LittleEndian.Uint32(src[startEntry+0x14:]))
 
-						if typeSection == 1 && lenSection >= 64 {
+						// Only the code sections (not .rodata, .data, ...)
+						if typeSection == _EXE_ELF_SHT_PROGBITS && flagsSection&_EXE_ELF_SHF_EXECINSTR != 0 && lenSection >= 64 {
 							if *codeStart == 0 {
 								*codeStart = offSection
 							}
@@ -779,10 +821,12 @@ func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool
 						}
 
 						typeSection := int(binary.BigEndian.Uint32(src[startEntry+4:]))
+						flagsSection := int(binary.BigEndian.Uint64(src[startEntry+8:]))
 						offSection := int(binary.BigEndian.Uint64(src[startEntry+0x18:]))
 						lenSection := int(binary.BigEndian.Uint64(src[startEntry+0x20:]))
 
-						if typeSection == 1 && lenSection >= 64 {
+						// Only the code sections (not .rodata, .data, ...)
+						if typeSection == _EXE_ELF_SHT_PROGBITS && flagsSection&_EXE_ELF_SHF_EXECINSTR != 0 && lenSection >= 64 {
 							if *codeStart == 0 {
 								*codeStart = offSection
 							}
@@ -804,10 +848,12 @@ func parseExeHeader(src []byte, magic uint, arch, codeStart, codeEnd *int) bool
 						}
 
 						typeSection := int(binary.BigEndian.Uint32(src[startEntry+4:]))
+						flagsSection := int(binary.BigEndian.Uint32(src[startEntry+8:]))
 						offSection := int(binary.BigEndian.Uint32(src[startEntry+0x10:]))
 						lenSection := int(binary.BigEndian.Uint32(src[startEntry+0x14:]))
 
-						if typeSection == 1 && lenSection >= 64 {
+						// Only the code sections (not .rodata, .data, ...)
+						if typeSection == _EXE_ELF_SHT_PROGBITS && flagsSection&_EXE_ELF_SHF_EXECINSTR != 0 && lenSection >= 64 {
 							if *codeStart == 0 {
 								*codeStart = offSection
 							}
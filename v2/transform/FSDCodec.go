@@ -148,14 +148,8 @@ func (this *FSDCodec) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, fmt.Errorf("Block too small, skip")
 	}
 
-	if this.ctx != nil {
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt := val.(internal.DataType)
-
-			if dt != internal.DT_UNDEFINED && dt != internal.DT_MULTIMEDIA && dt != internal.DT_BIN {
-				return 0, 0, fmt.Errorf("FSD forward transform skip")
-			}
-		}
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_MULTIMEDIA && dt != internal.DT_BIN {
+		return 0, 0, fmt.Errorf("FSD forward transform skip")
 	}
 
 	magic := internal.GetMagicType(src)
@@ -227,16 +221,12 @@ func (this *FSDCodec) Forward(src, dst []byte) (uint, uint, error) {
 
 	// If not better, quick exit
 	if ent[minIdx] >= ent[0] {
-		if this.ctx != nil {
-			(*this.ctx)["dataType"] = internal.DetectSimpleType(3*count10, histo[0][:])
-		}
+		internal.SetDataType(this.ctx, internal.DetectSimpleType(3*count10, histo[0][:]))
 
 		return 0, 0, fmt.Errorf("FSD forward transform skip")
 	}
 
-	if this.ctx != nil {
-		(*this.ctx)["dataType"] = internal.DT_MULTIMEDIA
-	}
+	internal.SetDataType(this.ctx, internal.DT_MULTIMEDIA)
 
 	var distances = []int{0, 1, 2, 3, 4, 8, 16}
 	dist := distances[minIdx]
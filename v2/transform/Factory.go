@@ -20,6 +20,7 @@ import (
 	"strings"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
 )
 
 const (
@@ -28,34 +29,52 @@ const (
 	_BFF_MASK      = (1 << _BFF_ONE_SHIFT) - 1
 
 	// Up to 64 transforms can be declared (6 bit index)
-	NONE_TYPE   = uint64(0)  // Copy
-	BWT_TYPE    = uint64(1)  // Burrows Wheeler
-	BWTS_TYPE   = uint64(2)  // Burrows Wheeler Scott
-	LZ_TYPE     = uint64(3)  // Lempel Ziv
-	SNAPPY_TYPE = uint64(4)  // Snappy (obsolete)
-	RLT_TYPE    = uint64(5)  // Run Length
-	ZRLT_TYPE   = uint64(6)  // Zero Run Length
-	MTFT_TYPE   = uint64(7)  // Move To Front
-	RANK_TYPE   = uint64(8)  // Rank
-	EXE_TYPE    = uint64(9)  // EXE codec
-	DICT_TYPE   = uint64(10) // Text codec
-	ROLZ_TYPE   = uint64(11) // ROLZ codec
-	ROLZX_TYPE  = uint64(12) // ROLZ Extra codec
-	SRT_TYPE    = uint64(13) // Sorted Rank
-	LZP_TYPE    = uint64(14) // Lempel Ziv Predict
-	MM_TYPE     = uint64(15) // Multimedia (FSD) codec
-	LZX_TYPE    = uint64(16) // Lempel Ziv Extra
-	UTF_TYPE    = uint64(17) // UTF codec
-	PACK_TYPE   = uint64(18) // Alias Codec
-	DNA_TYPE    = uint64(19) // DNA Alias Codec
-	RESERVED3   = uint64(20) // Reserved
-	RESERVED4   = uint64(21) // Reserved
-	RESERVED5   = uint64(22) // Reserved
+	NONE_TYPE    = uint64(0)  // Copy
+	BWT_TYPE     = uint64(1)  // Burrows Wheeler
+	BWTS_TYPE    = uint64(2)  // Burrows Wheeler Scott
+	LZ_TYPE      = uint64(3)  // Lempel Ziv
+	SNAPPY_TYPE  = uint64(4)  // Snappy (obsolete)
+	RLT_TYPE     = uint64(5)  // Run Length
+	ZRLT_TYPE    = uint64(6)  // Zero Run Length
+	MTFT_TYPE    = uint64(7)  // Move To Front
+	RANK_TYPE    = uint64(8)  // Rank
+	EXE_TYPE     = uint64(9)  // EXE codec
+	DICT_TYPE    = uint64(10) // Text codec
+	ROLZ_TYPE    = uint64(11) // ROLZ codec
+	ROLZX_TYPE   = uint64(12) // ROLZ Extra codec
+	SRT_TYPE     = uint64(13) // Sorted Rank
+	LZP_TYPE     = uint64(14) // Lempel Ziv Predict
+	MM_TYPE      = uint64(15) // Multimedia (FSD) codec
+	LZX_TYPE     = uint64(16) // Lempel Ziv Extra
+	UTF_TYPE     = uint64(17) // UTF codec
+	PACK_TYPE    = uint64(18) // Alias Codec
+	DNA_TYPE     = uint64(19) // DNA Alias Codec
+	LRM_TYPE     = uint64(20) // Long Range Matcher
+	JSON_TYPE    = uint64(21) // JSON codec
+	RESERVED5    = uint64(22) // Reserved
+	GENOMIC_TYPE = uint64(23) // FASTA/FASTQ codec
+	IMG_TYPE     = uint64(24) // Image filter codec
+	UTF16_TYPE   = uint64(25) // UTF-16 codec
+	NUMERIC_TYPE = uint64(26) // Numeric (delta) codec
+	ST4_TYPE     = uint64(27) // Schindler Transform (order 4)
+	ST6_TYPE     = uint64(28) // Schindler Transform (order 6)
+	SPARSE_TYPE  = uint64(29) // Zero and repeated pages codec
 )
 
 // New creates a new instance of ByteTransformSequence based on the provided
 // function type.
 func New(ctx *map[string]any, functionType uint64) (*ByteTransformSequence, error) {
+	return newSequence(ctx, functionType, 0, false)
+}
+
+// NewWithParams creates a new instance of ByteTransformSequence based on the
+// provided function type and the packed stage parameters (see
+// SequenceBuilder.Params). The parameters replace the ones of the context.
+func NewWithParams(ctx *map[string]any, functionType, params uint64) (*ByteTransformSequence, error) {
+	return newSequence(ctx, functionType, params, true)
+}
+
+func newSequence(ctx *map[string]any, functionType, params uint64, packed bool) (*ByteTransformSequence, error) {
 	nbtr := 0
 
 	// Several transforms
@@ -78,7 +97,14 @@ func New(ctx *map[string]any, functionType uint64) (*ByteTransformSequence, erro
 		t := (functionType >> (_BFF_MAX_SHIFT - _BFF_ONE_SHIFT*uint(i))) & _BFF_MASK
 
 		if t != NONE_TYPE || i == 0 {
-			if transforms[nbtr], err = newToken(ctx, t); err != nil {
+			// The context parameter is used if there are no packed parameters
+			param := -1
+
+			if packed == true {
+				param = int(byte(params >> (_SEQ_PARAM_MAX_SHIFT - _SEQ_PARAM_SHIFT*uint(i))))
+			}
+
+			if transforms[nbtr], err = newToken(ctx, t, param); err != nil {
 				return nil, err
 			}
 		}
@@ -86,33 +112,46 @@ func New(ctx *map[string]any, functionType uint64) (*ByteTransformSequence, erro
 		nbtr++
 	}
 
-	return NewByteTransformSequence(transforms)
+	seq, err := NewByteTransformSequence(transforms)
+
+	if err == nil {
+		seq.scratch = internal.GetScratch(ctx)
+	}
+
+	return seq, err
 }
 
-func newToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, error) {
+// newToken creates the transform of a stage. The parameter of the inverse
+// transform (see SequenceBuilder.Params) is param, 0 for the default or -1
+// to use the one of the context. The context is not modified.
+func newToken(ctx *map[string]any, functionType uint64, param int) (kanzi.ByteTransform, error) {
+	if s := findSubstitution(ctx, functionType); s != nil {
+		t, err := s.Create(ctx)
+
+		if err == nil {
+			internal.AddSubstitution(ctx, s.Name)
+		}
+
+		return t, err
+	}
+
 	switch functionType {
 
 	case DICT_TYPE:
-		textCodecType := 1
+		return newTextCodecWithCtx(ctx, getTextCodecType(ctx, param))
+
+	case ROLZ_TYPE, ROLZX_TYPE:
+		logPosChecks := uint(param)
 
-		if val, containsKey := (*ctx)["entropy"]; containsKey {
-			entropyType := strings.ToUpper(val.(string))
+		if param < 0 {
+			logPosChecks = 0
 
-			// Select text encoding based on entropy codec.
-			if entropyType == "NONE" || entropyType == "ANS0" ||
-				entropyType == "HUFFMAN" || entropyType == "RANGE" {
-				textCodecType = 2
+			if val, containsKey := (*ctx)["rolzLogPosChecks"]; containsKey {
+				logPosChecks = val.(uint)
 			}
 		}
 
-		(*ctx)["textcodec"] = textCodecType
-		return NewTextCodecWithCtx(ctx)
-
-	case ROLZ_TYPE:
-		return NewROLZCodecWithCtx(ctx)
-
-	case ROLZX_TYPE:
-		return NewROLZCodecWithCtx(ctx)
+		return newROLZCodecWithCtx(ctx, functionType == ROLZX_TYPE, logPosChecks)
 
 	case BWT_TYPE:
 		return NewBWTBlockCodecWithCtx(ctx)
@@ -120,17 +159,8 @@ func newToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, er
 	case BWTS_TYPE:
 		return NewBWTSWithCtx(ctx)
 
-	case LZ_TYPE:
-		(*ctx)["lz"] = LZ_TYPE
-		return NewLZCodecWithCtx(ctx)
-
-	case LZX_TYPE:
-		(*ctx)["lz"] = LZX_TYPE
-		return NewLZCodecWithCtx(ctx)
-
-	case LZP_TYPE:
-		(*ctx)["lz"] = LZP_TYPE
-		return NewLZCodecWithCtx(ctx)
+	case LZ_TYPE, LZX_TYPE, LZP_TYPE:
+		return newLZCodecWithCtx(ctx, functionType)
 
 	case UTF_TYPE:
 		return NewUTFCodecWithCtx(ctx)
@@ -139,22 +169,19 @@ func newToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, er
 		return NewFSDCodecWithCtx(ctx)
 
 	case PACK_TYPE:
-		return NewAliasCodecWithCtx(ctx)
+		return newAliasCodecWithCtx(ctx, false)
 
 	case DNA_TYPE:
-		(*ctx)["packOnlyDNA"] = true
-		return NewAliasCodecWithCtx(ctx)
+		return newAliasCodecWithCtx(ctx, true)
 
 	case SRT_TYPE:
 		return NewSRTWithCtx(ctx)
 
 	case RANK_TYPE:
-		(*ctx)["sbrt"] = SBRT_MODE_RANK
-		return NewSBRTWithCtx(ctx)
+		return NewSBRT(SBRT_MODE_RANK)
 
 	case MTFT_TYPE:
-		(*ctx)["sbrt"] = SBRT_MODE_MTF
-		return NewSBRTWithCtx(ctx)
+		return NewSBRT(SBRT_MODE_MTF)
 
 	case ZRLT_TYPE:
 		return NewZRLTWithCtx(ctx)
@@ -165,12 +192,67 @@ func newToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, er
 	case EXE_TYPE:
 		return NewEXECodecWithCtx(ctx)
 
+	case LRM_TYPE:
+		return NewLRMCodecWithCtx(ctx)
+
+	case JSON_TYPE:
+		return NewJSONCodecWithCtx(ctx)
+
+	case GENOMIC_TYPE:
+		return NewGenomicCodecWithCtx(ctx)
+
+	case IMG_TYPE:
+		return NewImageCodecWithCtx(ctx)
+
+	case UTF16_TYPE:
+		return NewUTF16CodecWithCtx(ctx)
+
+	case NUMERIC_TYPE:
+		return NewNumericCodecWithCtx(ctx)
+
+	case ST4_TYPE:
+		return NewST(4)
+
+	case ST6_TYPE:
+		return NewST(6)
+
+	case SPARSE_TYPE:
+		return NewSparseCodecWithCtx(ctx)
+
 	case NONE_TYPE:
 		return NewNullTransformWithCtx(ctx)
 
 	default:
-		return nil, fmt.Errorf("Unknown transform type: '%d'", functionType)
+		return newUserToken(ctx, functionType)
+	}
+}
+
+// getTextCodecType returns the variant of the text codec of a stage: the
+// parameter of the stage (see newToken) or else the variant selected by the
+// entropy codec
+func getTextCodecType(ctx *map[string]any, param int) int {
+	if param > 0 {
+		return param
+	}
+
+	if param < 0 {
+		if val, containsKey := (*ctx)["textVariant"]; containsKey {
+			// Variant of the context (see TextOptions)
+			return val.(int)
+		}
 	}
+
+	if val, containsKey := (*ctx)["entropy"]; containsKey {
+		entropyType := strings.ToUpper(val.(string))
+
+		// Select text encoding based on entropy codec.
+		if entropyType == "NONE" || entropyType == "ANS0" ||
+			entropyType == "HUFFMAN" || entropyType == "RANGE" {
+			return 2
+		}
+	}
+
+	return 1
 }
 
 // GetName transforms the function type into a function name
@@ -265,11 +347,38 @@ func getByteFunctionNameToken(functionType uint64) (string, error) {
 	case DNA_TYPE:
 		return "DNA", nil
 
+	case LRM_TYPE:
+		return "LRM", nil
+
+	case JSON_TYPE:
+		return "JSON", nil
+
+	case GENOMIC_TYPE:
+		return "GENOMIC", nil
+
+	case IMG_TYPE:
+		return "IMG", nil
+
+	case UTF16_TYPE:
+		return "UTF16", nil
+
+	case NUMERIC_TYPE:
+		return "NUMERIC", nil
+
+	case ST4_TYPE:
+		return "ST4", nil
+
+	case ST6_TYPE:
+		return "ST6", nil
+
+	case SPARSE_TYPE:
+		return "SPARSE", nil
+
 	case NONE_TYPE:
 		return "NONE", nil
 
 	default:
-		return "", fmt.Errorf("Unknown transform type: '%d'", functionType)
+		return getUserFunctionNameToken(functionType)
 	}
 }
 
@@ -375,10 +484,37 @@ func getByteFunctionTypeToken(name string) (uint64, error) {
 	case "DNA":
 		return DNA_TYPE, nil
 
+	case "LRM":
+		return LRM_TYPE, nil
+
+	case "JSON":
+		return JSON_TYPE, nil
+
+	case "GENOMIC":
+		return GENOMIC_TYPE, nil
+
+	case "IMG":
+		return IMG_TYPE, nil
+
+	case "UTF16":
+		return UTF16_TYPE, nil
+
+	case "NUMERIC":
+		return NUMERIC_TYPE, nil
+
+	case "ST4":
+		return ST4_TYPE, nil
+
+	case "ST6":
+		return ST6_TYPE, nil
+
+	case "SPARSE":
+		return SPARSE_TYPE, nil
+
 	case "NONE":
 		return NONE_TYPE, nil
 
 	default:
-		return 0, fmt.Errorf("Unknown transform type: '%s'", name)
+		return getUserFunctionTypeToken(name)
 	}
 }
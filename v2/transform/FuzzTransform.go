@@ -0,0 +1,176 @@
+//go:build kanzi_fuzz
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Development only transform (build tag 'kanzi_fuzz') used to exercise the
+// plumbing of the pipeline (expansion, skip flags, buffer growth) rather
+// than a codec. Forward deterministically (based on the 'fuzzSeed' context
+// value and the input) either fails (the block is skipped), scrambles the
+// data or scrambles and expands it, up to MaxEncodedLen.
+// Output: mode (1 byte) | padding length (4 bytes) | scrambled data | padding
+// The transform is registered as a user defined transform (see Registry.go)
+// with the last user type, which is not available to applications in this
+// build.
+
+const (
+	FUZZ_TYPE = USER_TYPE_MAX // Fuzz transform (development only)
+
+	_FUZZ_HEADER_SIZE = 5
+	_FUZZ_MODE_SKIP   = 0
+	_FUZZ_MODE_SAME   = 1
+	_FUZZ_MODE_EXPAND = 2
+	_FUZZ_MODE_MAX    = 3
+)
+
+var _fuzzRegistered = registerFuzzTransform()
+
+func registerFuzzTransform() bool {
+	err := Register("FUZZ", FUZZ_TYPE, func(ctx *map[string]any) (kanzi.ByteTransform, error) {
+		return NewFuzzTransformWithCtx(ctx)
+	})
+
+	return err == nil
+}
+
+// FuzzTransform a transform with a known inverse that perturbs the data
+type FuzzTransform struct {
+	seed uint64
+}
+
+// NewFuzzTransform creates a new instance of FuzzTransform
+func NewFuzzTransform() (*FuzzTransform, error) {
+	return &FuzzTransform{}, nil
+}
+
+// NewFuzzTransformWithCtx creates a new instance of FuzzTransform using a
+// configuration map as parameter.
+func NewFuzzTransformWithCtx(ctx *map[string]any) (*FuzzTransform, error) {
+	this := &FuzzTransform{}
+
+	if val, containsKey := (*ctx)["fuzzSeed"]; containsKey {
+		this.seed = uint64(val.(uint))
+	}
+
+	return this, nil
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *FuzzTransform) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if n := this.MaxEncodedLen(len(src)); len(dst) < n {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	h := this.seed ^ uint64(len(src))*0x9E3779B97F4A7C15
+
+	for _, b := range src[0:min(len(src), 64)] {
+		h = (h ^ uint64(b)) * 0x100000001B3
+	}
+
+	maxPadding := len(src)>>5 + 16
+	padding := 0
+
+	switch h % 4 {
+	case _FUZZ_MODE_SKIP:
+		return 0, 0, errors.New("Fuzz transform skip")
+	case _FUZZ_MODE_EXPAND:
+		padding = int((h >> 8) % uint64(maxPadding+1))
+	case _FUZZ_MODE_MAX:
+		padding = maxPadding
+	}
+
+	dst[0] = byte(h % 4)
+	binary.BigEndian.PutUint32(dst[1:], uint32(padding))
+	end := _FUZZ_HEADER_SIZE + len(src)
+	this.scramble(dst[_FUZZ_HEADER_SIZE:end], src, len(src))
+
+	for i := end; i < end+padding; i++ {
+		dst[i] = 0
+	}
+
+	this.scramble(dst[end:end+padding], dst[end:end+padding], len(src)+1)
+	return uint(len(src)), uint(end + padding), nil
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *FuzzTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if len(src) < _FUZZ_HEADER_SIZE || src[0] == _FUZZ_MODE_SKIP || src[0] > _FUZZ_MODE_MAX {
+		return 0, 0, errors.New("Fuzz transform: invalid header")
+	}
+
+	padding := int(binary.BigEndian.Uint32(src[1:]))
+	count := len(src) - _FUZZ_HEADER_SIZE - padding
+
+	if count <= 0 || padding > count>>5+16 {
+		return 0, 0, errors.New("Fuzz transform: invalid padding")
+	}
+
+	if len(dst) < count {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), count)
+	}
+
+	end := _FUZZ_HEADER_SIZE + count
+	pad := make([]byte, padding)
+	this.scramble(pad, pad, count+1)
+
+	for i := range pad {
+		if pad[i] != src[end+i] {
+			return 0, 0, errors.New("Fuzz transform: invalid padding data")
+		}
+	}
+
+	this.scramble(dst[0:count], src[_FUZZ_HEADER_SIZE:end], count)
+	return uint(len(src)), uint(count), nil
+}
+
+// scramble XORs src with a keystream derived from the seed and the key
+func (this *FuzzTransform) scramble(dst, src []byte, key int) {
+	x := this.seed ^ (uint64(key) * 0xBF58476D1CE4E5B9) ^ 0x94D049BB133111EB
+
+	for i := range src {
+		// xorshift64*
+		x ^= x >> 12
+		x ^= x << 25
+		x ^= x >> 27
+		dst[i] = src[i] ^ byte((x*0x2545F4914F6CDD1D)>>56)
+	}
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this *FuzzTransform) MaxEncodedLen(srcLen int) int {
+	return srcLen + _FUZZ_HEADER_SIZE + srcLen>>5 + 16
+}
@@ -0,0 +1,109 @@
+//go:build kanzi_fuzz
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+func TestFuzzTransform(b *testing.T) {
+	fmt.Println("Test Fuzz Transform")
+	modes := make(map[byte]int)
+
+	for seed := uint(0); seed < 64; seed++ {
+		ctx := map[string]any{"fuzzSeed": seed}
+		input := bytes.Repeat([]byte{byte(seed), 1, 2, 3}, 100+int(seed)*37)
+		t, _ := NewFuzzTransformWithCtx(&ctx)
+		dst := make([]byte, t.MaxEncodedLen(len(input)))
+		_, n, err := t.Forward(input, dst)
+
+		if err != nil {
+			modes[_FUZZ_MODE_SKIP]++
+			continue
+		}
+
+		modes[dst[0]]++
+		res := make([]byte, len(input))
+		_, m, err := t.Inverse(dst[0:n], res)
+
+		if err != nil || bytes.Equal(input, res[0:m]) == false {
+			b.Fatalf("Round trip failed for seed %d: %v", seed, err)
+		}
+
+		dst[n-1] ^= 1
+
+		if _, _, err = t.Inverse(dst[0:n], res); err == nil && dst[0] != _FUZZ_MODE_SAME && int(n) > len(input)+_FUZZ_HEADER_SIZE {
+			b.Errorf("Corrupted padding not detected for seed %d", seed)
+		}
+	}
+
+	if len(modes) != 4 {
+		b.Errorf("Expected all modes to be used, got %v", modes)
+	}
+}
+
+func TestFuzzTransformSequence(b *testing.T) {
+	fmt.Println("Test Fuzz Transform in sequences")
+	input := bytes.Repeat([]byte("abcdefghij0123456789"), 5000)
+
+	for _, name := range []string{"FUZZ", "FUZZ+FUZZ+FUZZ", "LZ+FUZZ", "FUZZ+BWT+SRT+ZRLT", "RLT+FUZZ+ZRLT"} {
+		for seed := uint(0); seed < 8; seed++ {
+			ctx := map[string]any{"fuzzSeed": seed, "bsVersion": uint(6)}
+			tType, err := GetType(name)
+
+			if err != nil {
+				b.Fatalf("Invalid transform '%s': %v", name, err)
+			}
+
+			seq, _ := New(&ctx, tType)
+			dst := make([]byte, seq.MaxEncodedLen(len(input)))
+			_, n, err := seq.Forward(input, dst)
+
+			if err != nil {
+				b.Fatalf("%s: forward failed: %v", name, err)
+			}
+
+			seq2, _ := New(&ctx, tType)
+			seq2.SetSkipFlags(seq.SkipFlags())
+			res := make([]byte, len(input)+len(input)/8)
+			_, m, err := seq2.Inverse(dst[0:n], res)
+
+			if err != nil || bytes.Equal(input, res[0:m]) == false {
+				b.Fatalf("%s (seed %d, skip flags %08b): round trip failed: %v", name, seed, seq.SkipFlags(), err)
+			}
+		}
+	}
+}
+
+func TestFuzzTransformType(b *testing.T) {
+	if tType, err := getByteFunctionTypeToken("FUZZ"); err != nil || tType != USER_TYPE_MAX {
+		b.Errorf("Expected FUZZ in the user type range, got %d (%v)", tType, err)
+	}
+
+	if _, err := GetName(RESERVED5); err == nil {
+		b.Errorf("Expected reserved type %d to be unknown", RESERVED5)
+	}
+
+	if err := Register("OTHER", FUZZ_TYPE, func(ctx *map[string]any) (kanzi.ByteTransform, error) { return nil, nil }); err == nil {
+		b.Errorf("Expected error on registration of the FUZZ type")
+	}
+}
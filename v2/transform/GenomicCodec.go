@@ -0,0 +1,412 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_GEN_NB_STREAMS     = 6
+	_GEN_HEADER_SIZE    = 1 + 4*_GEN_NB_STREAMS // flags + stream lengths
+	_GEN_MIN_BLOCK_SIZE = 64
+	_GEN_FLAG_NO_EOL    = 1 // last line not terminated by LF
+	_GEN_LINE_RAW       = byte('R')
+	_GEN_LINE_SEQUENCE  = byte('S')
+	_GEN_LINE_QUALITY   = byte('Q')
+)
+
+var _GEN_BASE_CODES = initGenomicBaseCodes()
+
+func initGenomicBaseCodes() []byte {
+	res := make([]byte, 256)
+
+	for i := range res {
+		res[i] = 0xFF
+	}
+
+	res['A'] = 0
+	res['C'] = 1
+	res['G'] = 2
+	res['T'] = 3
+	return res
+}
+
+// GenomicCodec a transform for FASTA/FASTQ data. The block is processed
+// line by line and each line is classified as sequence (mostly ACGT bases),
+// quality (FASTQ quality scores following a '+' line) or raw (headers,
+// '+' lines and anything else). The lines are split into streams:
+// - line types (one byte per line)
+// - lengths of the sequence lines (varints)
+// - raw lines, LF terminated
+// - quality lines, LF terminated
+// - exceptions: runs of non ACGT symbols in the sequence lines (EG. N),
+// as (distance from previous run, symbol, run length) with varints
+// - ACGT bases packed 2 bits per base
+// Blocks starting or ending in the middle of a record are supported since
+// the line types are stored. The transform is skipped if there are not
+// enough sequence lines.
+// Format: flags (1 byte), lengths of the 6 streams (4 bytes each), streams.
+type GenomicCodec struct {
+	ctx *map[string]any
+}
+
+// NewGenomicCodec creates a new instance of GenomicCodec
+func NewGenomicCodec() (*GenomicCodec, error) {
+	return &GenomicCodec{}, nil
+}
+
+// NewGenomicCodecWithCtx creates a new instance of GenomicCodec using a
+// configuration map as parameter.
+func NewGenomicCodecWithCtx(ctx *map[string]any) (*GenomicCodec, error) {
+	return &GenomicCodec{ctx: ctx}, nil
+}
+
+// isSequenceLine returns true if at least 7/8 of the symbols are ACGTN
+func isSequenceLine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+
+	n := 0
+
+	for _, c := range line {
+		if _GEN_BASE_CODES[c] != 0xFF || c == 'N' {
+			n++
+		}
+	}
+
+	return n >= len(line)-len(line)>>3
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *GenomicCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("GENOMIC forward transform skip: output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	if count < _GEN_MIN_BLOCK_SIZE {
+		return 0, 0, errors.New("GENOMIC forward transform skip: block too small")
+	}
+
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_DNA && dt != internal.DT_BIN {
+		return 0, 0, errors.New("GENOMIC forward transform skip: input is not genomic data")
+	}
+
+	var streams [_GEN_NB_STREAMS][]byte
+	types := make([]byte, 0, count/32)
+	lengths := make([]byte, 0, count/32)
+	raws := make([]byte, 0, count/8)
+	quals := make([]byte, 0, count/4)
+	excs := make([]byte, 0, 64)
+	bases := make([]byte, 0, count/4+1)
+	flags := byte(0)
+	pos := 0     // position in the sequence lines
+	lastExc := 0 // end of the previous exception run
+	nbSeqBytes := 0
+	packed := byte(0)
+	nbPacked := 0
+	prev1 := _GEN_LINE_RAW
+	prev2 := _GEN_LINE_RAW
+	plusLine := false // previous line starts with '+'
+	srcIdx := 0
+
+	for srcIdx < count {
+		end := bytes.IndexByte(src[srcIdx:], '\n')
+
+		if end < 0 {
+			end = count
+			flags |= _GEN_FLAG_NO_EOL
+		} else {
+			end += srcIdx
+		}
+
+		line := src[srcIdx:end]
+		srcIdx = end + 1
+		lineType := _GEN_LINE_RAW
+
+		if prev2 == _GEN_LINE_SEQUENCE && plusLine == true {
+			lineType = _GEN_LINE_QUALITY
+		} else if isSequenceLine(line) == true {
+			lineType = _GEN_LINE_SEQUENCE
+		}
+
+		types = append(types, lineType)
+		plusLine = lineType == _GEN_LINE_RAW && len(line) > 0 && line[0] == '+'
+		prev2 = prev1
+		prev1 = lineType
+
+		switch lineType {
+		case _GEN_LINE_RAW:
+			raws = append(raws, line...)
+			raws = append(raws, '\n')
+
+		case _GEN_LINE_QUALITY:
+			quals = append(quals, line...)
+			quals = append(quals, '\n')
+
+		case _GEN_LINE_SEQUENCE:
+			lengths = binary.AppendUvarint(lengths, uint64(len(line)))
+			nbSeqBytes += len(line)
+
+			for i := 0; i < len(line); {
+				c := line[i]
+
+				if code := _GEN_BASE_CODES[c]; code != 0xFF {
+					packed = (packed << 2) | code
+					nbPacked++
+					i++
+					pos++
+
+					if nbPacked&3 == 0 {
+						bases = append(bases, packed)
+						packed = 0
+					}
+
+					continue
+				}
+
+				// Run of other symbols (limited to the line)
+				run := 1
+
+				for i+run < len(line) && line[i+run] == c {
+					run++
+				}
+
+				excs = binary.AppendUvarint(excs, uint64(pos-lastExc))
+				excs = append(excs, c)
+				excs = binary.AppendUvarint(excs, uint64(run))
+				i += run
+				pos += run
+				lastExc = pos
+			}
+		}
+	}
+
+	if nbPacked&3 != 0 {
+		bases = append(bases, packed<<(8-2*uint(nbPacked&3)))
+	}
+
+	// Not worth it if the sequences are a small part of the block
+	if nbSeqBytes < count/4 {
+		return 0, 0, errors.New("GENOMIC forward transform skip: input is not genomic data")
+	}
+
+	streams[0] = types
+	streams[1] = lengths
+	streams[2] = raws
+	streams[3] = quals
+	streams[4] = excs
+	streams[5] = bases
+	dstIdx := _GEN_HEADER_SIZE
+
+	for i := range streams {
+		dstIdx += len(streams[i])
+	}
+
+	if dstIdx >= count {
+		return 0, 0, errors.New("GENOMIC forward transform skip: no compression")
+	}
+
+	dst[0] = flags
+	n := _GEN_HEADER_SIZE
+
+	for i := range streams {
+		binary.BigEndian.PutUint32(dst[1+4*i:], uint32(len(streams[i])))
+		n += copy(dst[n:], streams[i])
+	}
+
+	return uint(count), uint(dstIdx), nil
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *GenomicCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	errInvalid := errors.New("GENOMIC inverse transform failed: invalid data")
+	errOverflow := errors.New("GENOMIC inverse transform failed: output buffer too small")
+
+	if len(src) < _GEN_HEADER_SIZE {
+		return 0, 0, errInvalid
+	}
+
+	var streams [_GEN_NB_STREAMS][]byte
+	flags := src[0]
+	n := uint64(_GEN_HEADER_SIZE)
+
+	for i := range streams {
+		length := uint64(binary.BigEndian.Uint32(src[1+4*i:]))
+
+		if n+length > uint64(len(src)) {
+			return 0, 0, errInvalid
+		}
+
+		streams[i] = src[n : n+length]
+		n += length
+	}
+
+	types, lengths, raws, quals, excs, bases := streams[0], streams[1], streams[2], streams[3], streams[4], streams[5]
+	pos := 0      // position in the sequence lines
+	nextExc := -1 // start of the next exception run (-1 if none)
+	excSymbol := byte(0)
+	excRun := 0
+	basesIdx := 0 // index of the next packed base
+	dstIdx := 0
+
+	// Read the next exception run if any
+	readException := func(lastExc int) error {
+		if len(excs) == 0 {
+			nextExc = -1
+			return nil
+		}
+
+		gap, k1 := binary.Uvarint(excs)
+
+		if k1 <= 0 || k1 >= len(excs) || gap > uint64(len(dst)) {
+			return errInvalid
+		}
+
+		excSymbol = excs[k1]
+		run, k2 := binary.Uvarint(excs[k1+1:])
+
+		if k2 <= 0 || run == 0 || run > uint64(len(dst)) {
+			return errInvalid
+		}
+
+		excs = excs[k1+1+k2:]
+		nextExc = lastExc + int(gap)
+		excRun = int(run)
+		return nil
+	}
+
+	if err := readException(0); err != nil {
+		return 0, 0, err
+	}
+
+	for i, lineType := range types {
+		switch lineType {
+		case _GEN_LINE_RAW, _GEN_LINE_QUALITY:
+			stream := &raws
+
+			if lineType == _GEN_LINE_QUALITY {
+				stream = &quals
+			}
+
+			end := bytes.IndexByte(*stream, '\n')
+
+			if end < 0 {
+				return 0, 0, errInvalid
+			}
+
+			if dstIdx+end > len(dst) {
+				return 0, 0, errOverflow
+			}
+
+			dstIdx += copy(dst[dstIdx:], (*stream)[0:end])
+			*stream = (*stream)[end+1:]
+
+		case _GEN_LINE_SEQUENCE:
+			val, k := binary.Uvarint(lengths)
+
+			if k <= 0 {
+				return 0, 0, errInvalid
+			}
+
+			lengths = lengths[k:]
+
+			if val > uint64(len(dst)-dstIdx) {
+				return 0, 0, errOverflow
+			}
+
+			end := pos + int(val)
+
+			for pos < end {
+				if pos == nextExc {
+					if pos+excRun > end {
+						return 0, 0, errInvalid
+					}
+
+					for j := 0; j < excRun; j++ {
+						dst[dstIdx+j] = excSymbol
+					}
+
+					dstIdx += excRun
+					pos += excRun
+
+					if err := readException(pos); err != nil {
+						return 0, 0, err
+					}
+
+					continue
+				}
+
+				if basesIdx >= 4*len(bases) {
+					return 0, 0, errInvalid
+				}
+
+				code := (bases[basesIdx>>2] >> (6 - 2*uint(basesIdx&3))) & 3
+				dst[dstIdx] = "ACGT"[code]
+				dstIdx++
+				basesIdx++
+				pos++
+			}
+
+		default:
+			return 0, 0, errInvalid
+		}
+
+		if i+1 < len(types) || flags&_GEN_FLAG_NO_EOL == 0 {
+			if dstIdx >= len(dst) {
+				return 0, 0, errOverflow
+			}
+
+			dst[dstIdx] = '\n'
+			dstIdx++
+		}
+	}
+
+	return uint(len(src)), uint(dstIdx), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this GenomicCodec) MaxEncodedLen(srcLen int) int {
+	return srcLen + _GEN_HEADER_SIZE
+}
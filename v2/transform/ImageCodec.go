@@ -0,0 +1,327 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_IMG_HEADER_SIZE      = 13 // offset (4), stride (4), rows (4), bpp (1)
+	_IMG_MIN_BLOCK_LENGTH = 1024
+	_IMG_MIN_STRIDE       = 16
+	_IMG_FILTER_NONE      = 0
+	_IMG_FILTER_SUB       = 1
+	_IMG_FILTER_UP        = 2
+	_IMG_FILTER_AVERAGE   = 3
+	_IMG_FILTER_PAETH     = 4
+	_IMG_NB_FILTERS       = 5
+)
+
+// ImageCodec applies per row delta filtering (same filters as PNG: none,
+// sub, up, average and Paeth) to uncompressed images. The filter of each
+// row is selected with the PNG heuristic (min sum of absolute residuals).
+// The geometry of the image is read from the header (BMP, PGM, PPM, PAM)
+// or, for raw pixel buffers, provided in the context ('imageWidth' in
+// pixels and 'imageBpp' in bytes per pixel). The header of the image and
+// the trailing bytes (incomplete rows) are copied as is.
+// Format: header (offset, stride, number of rows, bytes per pixel), image
+// header, one filter type per row, filtered rows, trailing bytes.
+type ImageCodec struct {
+	ctx *map[string]any
+}
+
+// NewImageCodec creates a new instance of ImageCodec
+func NewImageCodec() (*ImageCodec, error) {
+	return &ImageCodec{}, nil
+}
+
+// NewImageCodecWithCtx creates a new instance of ImageCodec using a
+// configuration map as parameter.
+func NewImageCodecWithCtx(ctx *map[string]any) (*ImageCodec, error) {
+	return &ImageCodec{ctx: ctx}, nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this *ImageCodec) MaxEncodedLen(srcLen int) int {
+	return srcLen + srcLen/_IMG_MIN_STRIDE + _IMG_HEADER_SIZE
+}
+
+// imageInfo returns the geometry of the image in src
+func (this *ImageCodec) imageInfo(src []byte) (internal.ImageInfo, bool) {
+	if info, ok := internal.GetImageInfo(src); ok == true {
+		return info, true
+	}
+
+	var info internal.ImageInfo
+
+	if this.ctx == nil {
+		return info, false
+	}
+
+	width, ok1 := (*this.ctx)["imageWidth"].(uint)
+	bpp, ok2 := (*this.ctx)["imageBpp"].(uint)
+
+	if ok1 == false || ok2 == false || width == 0 || bpp == 0 || bpp > 16 {
+		return info, false
+	}
+
+	info.Width = int(width)
+	info.Bpp = int(bpp)
+	info.Stride = info.Width * info.Bpp
+	info.Height = len(src) / info.Stride
+	return info, true
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *ImageCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	if count < _IMG_MIN_BLOCK_LENGTH {
+		return 0, 0, errors.New("IMG forward transform skip: block too small")
+	}
+
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_MULTIMEDIA && dt != internal.DT_BIN {
+		return 0, 0, errors.New("IMG forward transform skip")
+	}
+
+	info, ok := this.imageInfo(src)
+
+	if ok == false || info.Stride < _IMG_MIN_STRIDE || info.Offset >= count {
+		return 0, 0, errors.New("IMG forward transform skip: not an uncompressed image")
+	}
+
+	// Only complete rows are filtered (the block may end before the image)
+	rows := min(info.Height, (count-info.Offset)/info.Stride)
+
+	if rows < 2 {
+		return 0, 0, errors.New("IMG forward transform skip: not enough rows")
+	}
+
+	binary.BigEndian.PutUint32(dst[0:], uint32(info.Offset))
+	binary.BigEndian.PutUint32(dst[4:], uint32(info.Stride))
+	binary.BigEndian.PutUint32(dst[8:], uint32(rows))
+	dst[12] = byte(info.Bpp)
+	dstIdx := _IMG_HEADER_SIZE
+	dstIdx += copy(dst[dstIdx:], src[0:info.Offset])
+	filters := dst[dstIdx : dstIdx+rows]
+	dstIdx += rows
+	residuals := dst[dstIdx : dstIdx+rows*info.Stride]
+	pixels := src[info.Offset : info.Offset+rows*info.Stride]
+	var residual [_IMG_NB_FILTERS][]byte
+
+	for f := range residual {
+		residual[f] = make([]byte, info.Stride)
+	}
+
+	for r := 0; r < rows; r++ {
+		row := pixels[r*info.Stride : (r+1)*info.Stride]
+		var prev []byte
+
+		if r > 0 {
+			prev = pixels[(r-1)*info.Stride : r*info.Stride]
+		}
+
+		best := 0
+		bestSum := -1
+
+		for f := range residual {
+			filterImageRow(byte(f), row, prev, info.Bpp, residual[f])
+			sum := 0
+
+			for _, v := range residual[f] {
+				sum += int(int8(v)) * (1 - 2*int(v>>7)) // abs
+			}
+
+			if bestSum < 0 || sum < bestSum {
+				best = f
+				bestSum = sum
+			}
+		}
+
+		filters[r] = byte(best)
+		copy(residuals[r*info.Stride:], residual[best])
+	}
+
+	dstIdx += len(residuals)
+	dstIdx += copy(dst[dstIdx:], src[info.Offset+len(pixels):])
+
+	// Check that the filtering makes sense
+	var histo0, histo1 [256]int
+	internal.ComputeHistogram(pixels, histo0[:], true, false)
+	internal.ComputeHistogram(residuals, histo1[:], true, false)
+	ent0 := internal.ComputeFirstOrderEntropy1024(len(pixels), histo0[:])
+
+	if internal.ComputeFirstOrderEntropy1024(len(residuals), histo1[:]) >= ent0 {
+		return 0, 0, errors.New("IMG forward transform skip: no improvement")
+	}
+
+	internal.SetDataType(this.ctx, internal.DT_MULTIMEDIA)
+
+	return uint(count), uint(dstIdx), nil
+}
+
+// filterImageRow computes the residuals of row (prev is nil for the first row)
+func filterImageRow(filter byte, row, prev []byte, bpp int, out []byte) {
+	for i := range row {
+		var a, b, c int
+
+		if i >= bpp {
+			a = int(row[i-bpp])
+		}
+
+		if prev != nil {
+			b = int(prev[i])
+
+			if i >= bpp {
+				c = int(prev[i-bpp])
+			}
+		}
+
+		out[i] = row[i] - predictPixel(filter, a, b, c)
+	}
+}
+
+// predictPixel returns the prediction of the filter given the left (a), up (b)
+// and up left (c) values
+func predictPixel(filter byte, a, b, c int) byte {
+	switch filter {
+	case _IMG_FILTER_SUB:
+		return byte(a)
+	case _IMG_FILTER_UP:
+		return byte(b)
+	case _IMG_FILTER_AVERAGE:
+		return byte((a + b) >> 1)
+	case _IMG_FILTER_PAETH:
+		p := a + b - c
+		pa := absImage(p - a)
+		pb := absImage(p - b)
+		pc := absImage(p - c)
+
+		if pa <= pb && pa <= pc {
+			return byte(a)
+		}
+
+		if pb <= pc {
+			return byte(b)
+		}
+
+		return byte(c)
+	default:
+		return 0
+	}
+}
+
+func absImage(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *ImageCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if len(src) < _IMG_HEADER_SIZE {
+		return 0, 0, errors.New("IMG inverse transform failed: invalid data")
+	}
+
+	offset := uint64(binary.BigEndian.Uint32(src[0:]))
+	stride := uint64(binary.BigEndian.Uint32(src[4:]))
+	rows := uint64(binary.BigEndian.Uint32(src[8:]))
+	bpp := int(src[12])
+	srcIdx := uint64(_IMG_HEADER_SIZE)
+
+	if bpp == 0 || uint64(bpp) > stride || srcIdx+offset+rows+rows*stride > uint64(len(src)) {
+		return 0, 0, errors.New("IMG inverse transform failed: invalid data")
+	}
+
+	if uint64(len(src))-srcIdx-rows > uint64(len(dst)) {
+		return 0, 0, errors.New("IMG inverse transform failed: output buffer too small")
+	}
+
+	dstIdx := copy(dst, src[srcIdx:srcIdx+offset])
+	srcIdx += offset
+	filters := src[srcIdx : srcIdx+rows]
+	srcIdx += rows
+	w := int(stride)
+
+	for r := range filters {
+		if filters[r] >= _IMG_NB_FILTERS {
+			return 0, 0, errors.New("IMG inverse transform failed: invalid filter type")
+		}
+
+		in := src[srcIdx : srcIdx+stride]
+		row := dst[dstIdx : dstIdx+w]
+		var prev []byte
+
+		if r > 0 {
+			prev = dst[dstIdx-w : dstIdx]
+		}
+
+		for i := range row {
+			var a, b, c int
+
+			if i >= bpp {
+				a = int(row[i-bpp])
+			}
+
+			if prev != nil {
+				b = int(prev[i])
+
+				if i >= bpp {
+					c = int(prev[i-bpp])
+				}
+			}
+
+			row[i] = in[i] + predictPixel(filters[r], a, b, c)
+		}
+
+		srcIdx += stride
+		dstIdx += w
+	}
+
+	dstIdx += copy(dst[dstIdx:], src[srcIdx:])
+	return uint(len(src)), uint(dstIdx), nil
+}
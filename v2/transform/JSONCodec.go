@@ -0,0 +1,437 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_JSON_HEADER_SIZE     = 12 // lengths of the key, string and number streams
+	_JSON_MIN_BLOCK_SIZE  = 64
+	_JSON_MAX_KEYS        = 128
+	_JSON_MAX_KEY_LENGTH  = 64
+	_JSON_TOKEN_STRING    = byte(0x01) // string value (in string stream)
+	_JSON_TOKEN_NEW_KEY   = byte(0x02) // key not in dictionary (in key stream)
+	_JSON_TOKEN_NUMBER    = byte(0x03) // number (in number stream)
+	_JSON_TOKEN_TRUE      = byte(0x04)
+	_JSON_TOKEN_FALSE     = byte(0x05)
+	_JSON_TOKEN_NULL      = byte(0x06)
+	_JSON_TOKEN_ESCAPE    = byte(0x07) // next byte is a literal
+	_JSON_TOKEN_KEY       = byte(0x80) // key in dictionary (index in 7 LSB)
+	_JSON_NUMBER_END      = 15
+	_JSON_MAX_ESCAPE_RATE = 32 // at most one escaped byte out of 32 input bytes
+)
+
+var (
+	_JSON_NUMBER_CHARS   = []byte("0123456789.-+eE")
+	_JSON_NUMBER_NIBBLES = initJSONNumberNibbles()
+	_JSON_LITERALS       = [][]byte{[]byte("true"), []byte("false"), []byte("null")}
+)
+
+func initJSONNumberNibbles() []byte {
+	res := make([]byte, 256)
+
+	for i := range res {
+		res[i] = _JSON_NUMBER_END
+	}
+
+	for i, c := range _JSON_NUMBER_CHARS {
+		res[c] = byte(i)
+	}
+
+	return res
+}
+
+// JSONCodec a structural transform for JSON data (EG. NDJSON logs). The
+// input is tokenized and split into 4 streams so that each one gets
+// homogeneous statistics:
+// - structure: punctuation, whitespaces and one token per value or key.
+// Up to 128 distinct keys are assigned an index (dictionary built on the
+// fly) and emitted as a single byte token.
+// - keys: new keys (not in the dictionary), 0 terminated
+// - strings: string values, 0 terminated
+// - numbers: packed as nibbles, terminated by the 0xF nibble
+// Only the lexical structure is analyzed (no validation of the grammar)
+// so that blocks starting or ending in the middle of a record are still
+// transformed. Unexpected bytes are escaped.
+// Format: key stream length, string stream length, number stream length
+// (4 bytes each), key stream, string stream, number stream, structure.
+type JSONCodec struct {
+	ctx  *map[string]any
+	keys map[string]int
+	dict [][]byte
+}
+
+// NewJSONCodec creates a new instance of JSONCodec
+func NewJSONCodec() (*JSONCodec, error) {
+	this := &JSONCodec{}
+	this.keys = make(map[string]int, _JSON_MAX_KEYS)
+	this.dict = make([][]byte, 0, _JSON_MAX_KEYS)
+	return this, nil
+}
+
+// NewJSONCodecWithCtx creates a new instance of JSONCodec using a
+// configuration map as parameter.
+func NewJSONCodecWithCtx(ctx *map[string]any) (*JSONCodec, error) {
+	this := &JSONCodec{}
+	this.ctx = ctx
+	this.keys = make(map[string]int, _JSON_MAX_KEYS)
+	this.dict = make([][]byte, 0, _JSON_MAX_KEYS)
+	return this, nil
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *JSONCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("JSON forward transform skip: output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	if count < _JSON_MIN_BLOCK_SIZE {
+		return 0, 0, errors.New("JSON forward transform skip: block too small")
+	}
+
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_BIN {
+		return 0, 0, errors.New("JSON forward transform skip: input is not JSON")
+	}
+
+	freqs0 := [256]int{}
+
+	if computeTextStats(src, freqs0[:], true, false)&_TC_MASK_JSON == 0 {
+		return 0, 0, errors.New("JSON forward transform skip: input is not JSON")
+	}
+
+	clear(this.keys)
+	structure := make([]byte, 0, count/2)
+	keys := make([]byte, 0, count/8)
+	strs := make([]byte, 0, count/4)
+	nums := make([]byte, 0, count/8)
+	half := false // one nibble pending in the number stream
+	escapes := 0
+	maxEscapes := count / _JSON_MAX_ESCAPE_RATE
+	srcIdx := 0
+
+	for srcIdx < count {
+		c := src[srcIdx]
+
+		switch {
+		case c == '"':
+			end := jsonStringEnd(src, srcIdx+1)
+
+			if end < 0 {
+				// Unterminated string (EG. at the end of the block)
+				structure = append(structure, _JSON_TOKEN_ESCAPE, c)
+				escapes++
+				srcIdx++
+				break
+			}
+
+			str := src[srcIdx+1 : end]
+			srcIdx = end + 1
+
+			if jsonIsKey(src, srcIdx) == false {
+				structure = append(structure, _JSON_TOKEN_STRING)
+				strs = append(strs, str...)
+				strs = append(strs, 0)
+				break
+			}
+
+			if idx, exists := this.keys[string(str)]; exists == true {
+				structure = append(structure, _JSON_TOKEN_KEY|byte(idx))
+				break
+			}
+
+			structure = append(structure, _JSON_TOKEN_NEW_KEY)
+			keys = append(keys, str...)
+			keys = append(keys, 0)
+
+			if len(this.keys) < _JSON_MAX_KEYS && len(str) <= _JSON_MAX_KEY_LENGTH {
+				this.keys[string(str)] = len(this.keys)
+			}
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			structure = append(structure, _JSON_TOKEN_NUMBER)
+
+			for srcIdx < count && _JSON_NUMBER_NIBBLES[src[srcIdx]] != _JSON_NUMBER_END {
+				nums, half = appendNibble(nums, half, _JSON_NUMBER_NIBBLES[src[srcIdx]])
+				srcIdx++
+			}
+
+			nums, half = appendNibble(nums, half, _JSON_NUMBER_END)
+
+		case c == 't' && bytes.HasPrefix(src[srcIdx:], _JSON_LITERALS[0]):
+			structure = append(structure, _JSON_TOKEN_TRUE)
+			srcIdx += 4
+
+		case c == 'f' && bytes.HasPrefix(src[srcIdx:], _JSON_LITERALS[1]):
+			structure = append(structure, _JSON_TOKEN_FALSE)
+			srcIdx += 5
+
+		case c == 'n' && bytes.HasPrefix(src[srcIdx:], _JSON_LITERALS[2]):
+			structure = append(structure, _JSON_TOKEN_NULL)
+			srcIdx += 4
+
+		case isJSONLiteral(c):
+			structure = append(structure, c)
+			srcIdx++
+
+		default:
+			structure = append(structure, _JSON_TOKEN_ESCAPE, c)
+			escapes++
+			srcIdx++
+		}
+
+		if escapes > maxEscapes {
+			return 0, 0, errors.New("JSON forward transform skip: input is not JSON")
+		}
+	}
+
+	if half == true {
+		nums[len(nums)-1] |= _JSON_NUMBER_END
+	}
+
+	dstIdx := _JSON_HEADER_SIZE + len(keys) + len(strs) + len(nums) + len(structure)
+
+	if dstIdx >= count {
+		return 0, 0, errors.New("JSON forward transform skip: no compression")
+	}
+
+	binary.BigEndian.PutUint32(dst[0:], uint32(len(keys)))
+	binary.BigEndian.PutUint32(dst[4:], uint32(len(strs)))
+	binary.BigEndian.PutUint32(dst[8:], uint32(len(nums)))
+	n := _JSON_HEADER_SIZE
+	n += copy(dst[n:], keys)
+	n += copy(dst[n:], strs)
+	n += copy(dst[n:], nums)
+	copy(dst[n:], structure)
+	return uint(count), uint(dstIdx), nil
+}
+
+// jsonStringEnd returns the index of the closing quote of the string
+// starting at idx or -1 if the string is not terminated. Strings containing
+// a 0 byte (stream terminator) are rejected.
+func jsonStringEnd(src []byte, idx int) int {
+	for idx < len(src) {
+		switch src[idx] {
+		case '"':
+			return idx
+		case 0:
+			return -1
+		case '\\':
+			idx++
+
+			if idx < len(src) && src[idx] == 0 {
+				return -1
+			}
+		}
+
+		idx++
+	}
+
+	return -1
+}
+
+// jsonIsKey returns true if the string ending before idx is an object key
+func jsonIsKey(src []byte, idx int) bool {
+	for idx < len(src) {
+		switch src[idx] {
+		case ':':
+			return true
+		case ' ', '\t', '\n', '\r':
+			idx++
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+// isJSONLiteral returns true for bytes copied as is to the structure stream
+func isJSONLiteral(c byte) bool {
+	switch c {
+	case '{', '}', '[', ']', ':', ',', ' ', '\t', '\n', '\r':
+		return true
+	default:
+		return false
+	}
+}
+
+func appendNibble(buf []byte, half bool, val byte) ([]byte, bool) {
+	if half == true {
+		buf[len(buf)-1] |= val
+		return buf, false
+	}
+
+	return append(buf, val<<4), true
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *JSONCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if len(src) < _JSON_HEADER_SIZE {
+		return 0, 0, errors.New("JSON inverse transform failed: invalid data")
+	}
+
+	kLen := uint64(binary.BigEndian.Uint32(src[0:]))
+	sLen := uint64(binary.BigEndian.Uint32(src[4:]))
+	nLen := uint64(binary.BigEndian.Uint32(src[8:]))
+
+	if _JSON_HEADER_SIZE+kLen+sLen+nLen > uint64(len(src)) {
+		return 0, 0, errors.New("JSON inverse transform failed: invalid data")
+	}
+
+	n := uint64(_JSON_HEADER_SIZE)
+	keys := src[n : n+kLen]
+	n += kLen
+	strs := src[n : n+sLen]
+	n += sLen
+	nums := src[n : n+nLen]
+	structure := src[n+nLen:]
+	this.dict = this.dict[:0]
+	nIdx := 0 // index of the next nibble
+	dstIdx := 0
+	errOverflow := errors.New("JSON inverse transform failed: output buffer too small")
+	errInvalid := errors.New("JSON inverse transform failed: invalid data")
+
+	for i := 0; i < len(structure); i++ {
+		c := structure[i]
+		var str []byte
+
+		switch {
+		case c >= _JSON_TOKEN_KEY:
+			if int(c&0x7F) >= len(this.dict) {
+				return 0, 0, errInvalid
+			}
+
+			str = this.dict[c&0x7F]
+
+		case c == _JSON_TOKEN_STRING || c == _JSON_TOKEN_NEW_KEY:
+			stream := &strs
+
+			if c == _JSON_TOKEN_NEW_KEY {
+				stream = &keys
+			}
+
+			end := bytes.IndexByte(*stream, 0)
+
+			if end < 0 {
+				return 0, 0, errInvalid
+			}
+
+			str = (*stream)[0:end]
+			*stream = (*stream)[end+1:]
+
+			if c == _JSON_TOKEN_NEW_KEY && len(this.dict) < _JSON_MAX_KEYS && len(str) <= _JSON_MAX_KEY_LENGTH {
+				this.dict = append(this.dict, str)
+			}
+
+		case c == _JSON_TOKEN_NUMBER:
+			for {
+				if nIdx >= 2*len(nums) {
+					return 0, 0, errInvalid
+				}
+
+				val := (nums[nIdx>>1] >> (4 - 4*(nIdx&1))) & 0x0F
+				nIdx++
+
+				if val == _JSON_NUMBER_END {
+					break
+				}
+
+				if dstIdx >= len(dst) {
+					return 0, 0, errOverflow
+				}
+
+				dst[dstIdx] = _JSON_NUMBER_CHARS[val]
+				dstIdx++
+			}
+
+			continue
+
+		case c == _JSON_TOKEN_TRUE || c == _JSON_TOKEN_FALSE || c == _JSON_TOKEN_NULL:
+			lit := _JSON_LITERALS[c-_JSON_TOKEN_TRUE]
+
+			if dstIdx+len(lit) > len(dst) {
+				return 0, 0, errOverflow
+			}
+
+			dstIdx += copy(dst[dstIdx:], lit)
+			continue
+
+		default:
+			if c == _JSON_TOKEN_ESCAPE {
+				if i++; i >= len(structure) {
+					return 0, 0, errInvalid
+				}
+
+				c = structure[i]
+			}
+
+			if dstIdx >= len(dst) {
+				return 0, 0, errOverflow
+			}
+
+			dst[dstIdx] = c
+			dstIdx++
+			continue
+		}
+
+		// Quoted string or key
+		if dstIdx+len(str)+2 > len(dst) {
+			return 0, 0, errOverflow
+		}
+
+		dst[dstIdx] = '"'
+		dstIdx++
+		dstIdx += copy(dst[dstIdx:], str)
+		dst[dstIdx] = '"'
+		dstIdx++
+	}
+
+	return uint(len(src)), uint(dstIdx), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this JSONCodec) MaxEncodedLen(srcLen int) int {
+	return srcLen + _JSON_HEADER_SIZE
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_LRM_WINDOW           = 64 // size of the rolling hash window
+	_LRM_MIN_MATCH        = 64
+	_LRM_HASH_MULT        = uint64(0x9E3779B97F4A7C15)
+	_LRM_HASH_SEED        = uint64(0xD6E8FEB86659FD93)
+	_LRM_SAMPLE_LOG       = 5 // one position in 32 is indexed (on average)
+	_LRM_SAMPLE_MASK      = (1 << _LRM_SAMPLE_LOG) - 1
+	_LRM_MIN_HASH_LOG     = 12
+	_LRM_MAX_HASH_LOG     = 24
+	_LRM_MIN_BLOCK_LENGTH = 1024
+)
+
+// LRMCodec Long Range Matcher. A pre-pass (similar to 'zstd --long') that
+// finds repeats at any distance within a block (up to 1 GB), well beyond
+// the window of the LZ codecs. Positions are indexed using a rolling hash
+// over a window of _LRM_WINDOW bytes. Only the positions selected by the
+// hash value (content defined sampling) are indexed so that the memory
+// used by the index stays low. Only long matches are emitted and the
+// literals are left untouched for the next transforms.
+// Format: a sequence of (literal length, literals, match length, distance)
+// with the literal and match lengths emitted as varints and the distance
+// as a 4 byte value. The last sequence only contains literals.
+type LRMCodec struct {
+	hashes []int32
+}
+
+// NewLRMCodec creates a new instance of LRMCodec
+func NewLRMCodec() (*LRMCodec, error) {
+	this := &LRMCodec{}
+	this.hashes = make([]int32, 0)
+	return this, nil
+}
+
+// NewLRMCodecWithCtx creates a new instance of LRMCodec using a
+// configuration map as parameter.
+func NewLRMCodecWithCtx(ctx *map[string]any) (*LRMCodec, error) {
+	this := &LRMCodec{}
+	this.hashes = make([]int32, 0)
+	return this, nil
+}
+
+func emitVarIntLRM(block []byte, val int) int {
+	n := 0
+
+	for val >= 0x80 {
+		block[n] = byte(val | 0x80)
+		val >>= 7
+		n++
+	}
+
+	block[n] = byte(val)
+	return n + 1
+}
+
+func readVarIntLRM(block []byte) (int, int) {
+	res := 0
+
+	for n, shift := 0, uint(0); n < len(block) && shift < 35; n, shift = n+1, shift+7 {
+		res |= int(block[n]&0x7F) << shift
+
+		if block[n] < 0x80 {
+			return res, n + 1
+		}
+	}
+
+	return -1, 0
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *LRMCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if n := this.MaxEncodedLen(len(src)); len(dst) < n {
+		return 0, 0, fmt.Errorf("LRM forward transform skip: output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	count := len(src)
+
+	if count < _LRM_MIN_BLOCK_LENGTH {
+		return 0, 0, errors.New("LRM forward transform skip: block too small")
+	}
+
+	hashLog := uint(_LRM_MIN_HASH_LOG)
+
+	if count>>_LRM_SAMPLE_LOG >= 1<<_LRM_MIN_HASH_LOG {
+		hashLog = min(uint(internal.Log2NoCheck(uint32(count>>_LRM_SAMPLE_LOG)))+1, _LRM_MAX_HASH_LOG)
+	}
+
+	if len(this.hashes) < 1<<hashLog {
+		this.hashes = make([]int32, 1<<hashLog)
+	} else {
+		for i := range this.hashes[0 : 1<<hashLog] {
+			this.hashes[i] = 0
+		}
+	}
+
+	hashes := this.hashes[0 : 1<<hashLog]
+	hashShift := 64 - hashLog
+
+	// Factor to remove the oldest byte from the rolling hash
+	outFactor := uint64(1)
+
+	for i := 0; i < _LRM_WINDOW; i++ {
+		outFactor *= _LRM_HASH_MULT
+	}
+
+	h := uint64(0)
+
+	for i := 0; i < _LRM_WINDOW; i++ {
+		h = h*_LRM_HASH_MULT + uint64(src[i])
+	}
+
+	// Keep room for the last literal length varint
+	dstEnd := count - 5
+	srcIdx, dstIdx, anchor := 0, 0, 0
+	matches := 0
+
+	for srcIdx+_LRM_WINDOW <= count {
+		if (h>>40)&_LRM_SAMPLE_MASK == 0 {
+			slot := ((h ^ _LRM_HASH_SEED) * _LRM_HASH_MULT) >> hashShift
+			ref := int(hashes[slot]) - 1
+			hashes[slot] = int32(srcIdx + 1)
+
+			if ref >= 0 {
+				mLen := 0
+
+				for srcIdx+mLen < count && src[ref+mLen] == src[srcIdx+mLen] {
+					mLen++
+				}
+
+				// Extend the match backward into the pending literals
+				start := srcIdx
+
+				for start > anchor && ref > 0 && src[start-1] == src[ref-1] {
+					start--
+					ref--
+					mLen++
+				}
+
+				if mLen >= _LRM_MIN_MATCH {
+					litLen := start - anchor
+
+					// Literal length (5) + literals + match length (5) + distance (4)
+					if dstIdx+litLen+14 > dstEnd {
+						break
+					}
+
+					dstIdx += emitVarIntLRM(dst[dstIdx:], litLen)
+					copy(dst[dstIdx:], src[anchor:start])
+					dstIdx += litLen
+					dstIdx += emitVarIntLRM(dst[dstIdx:], mLen-_LRM_MIN_MATCH)
+					dist := start - ref
+					dst[dstIdx] = byte(dist >> 24)
+					dst[dstIdx+1] = byte(dist >> 16)
+					dst[dstIdx+2] = byte(dist >> 8)
+					dst[dstIdx+3] = byte(dist)
+					dstIdx += 4
+					matches++
+					anchor = start + mLen
+					srcIdx = anchor
+
+					if srcIdx+_LRM_WINDOW > count {
+						break
+					}
+
+					h = 0
+
+					for i := srcIdx; i < srcIdx+_LRM_WINDOW; i++ {
+						h = h*_LRM_HASH_MULT + uint64(src[i])
+					}
+
+					continue
+				}
+			}
+		}
+
+		if srcIdx+_LRM_WINDOW < count {
+			h = h*_LRM_HASH_MULT + uint64(src[srcIdx+_LRM_WINDOW]) - uint64(src[srcIdx])*outFactor
+		}
+
+		srcIdx++
+	}
+
+	if matches == 0 {
+		return uint(count), uint(dstIdx), errors.New("LRM forward transform skip: no match found")
+	}
+
+	// Last literals
+	litLen := count - anchor
+
+	if dstIdx+litLen+5 > dstEnd {
+		return uint(count), uint(dstIdx), errors.New("LRM forward transform skip: no compression")
+	}
+
+	dstIdx += emitVarIntLRM(dst[dstIdx:], litLen)
+	copy(dst[dstIdx:], src[anchor:])
+	dstIdx += litLen
+	return uint(count), uint(dstIdx), nil
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *LRMCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	srcEnd := len(src)
+	dstEnd := len(dst)
+	srcIdx, dstIdx := 0, 0
+
+	for srcIdx < srcEnd {
+		litLen, n := readVarIntLRM(src[srcIdx:])
+
+		if litLen < 0 || srcIdx+n+litLen > srcEnd || dstIdx+litLen > dstEnd {
+			return uint(srcIdx), uint(dstIdx), errors.New("LRM inverse transform failed: invalid literal length")
+		}
+
+		srcIdx += n
+		copy(dst[dstIdx:], src[srcIdx:srcIdx+litLen])
+		srcIdx += litLen
+		dstIdx += litLen
+
+		if srcIdx == srcEnd {
+			break
+		}
+
+		mLen, n := readVarIntLRM(src[srcIdx:])
+
+		if mLen < 0 || srcIdx+n+4 > srcEnd {
+			return uint(srcIdx), uint(dstIdx), errors.New("LRM inverse transform failed: invalid match length")
+		}
+
+		srcIdx += n
+		mLen += _LRM_MIN_MATCH
+		dist := int(src[srcIdx])<<24 | int(src[srcIdx+1])<<16 | int(src[srcIdx+2])<<8 | int(src[srcIdx+3])
+		srcIdx += 4
+
+		if dist == 0 || dist > dstIdx || dstIdx+mLen > dstEnd {
+			return uint(srcIdx), uint(dstIdx), fmt.Errorf("LRM inverse transform failed: invalid match (distance %d, length %d)", dist, mLen)
+		}
+
+		ref := dstIdx - dist
+
+		if dist >= mLen {
+			copy(dst[dstIdx:dstIdx+mLen], dst[ref:ref+mLen])
+		} else {
+			// Overlapping match
+			for i := 0; i < mLen; i++ {
+				dst[dstIdx+i] = dst[ref+i]
+			}
+		}
+
+		dstIdx += mLen
+	}
+
+	return uint(srcIdx), uint(dstIdx), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this LRMCodec) MaxEncodedLen(srcLen int) int {
+	// The transform fails if the output is larger than the input
+	return srcLen
+}
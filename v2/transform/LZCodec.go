@@ -39,6 +39,8 @@ const (
 	_LZX_MIN_MATCH9       = 9
 	_LZX_MAX_MATCH        = 65535 + 254 + 15 + _LZX_MIN_MATCH4
 	_LZX_MIN_BLOCK_LENGTH = 24
+	_LZX_MAX_PRIMING      = 1 << 16
+	_LZX_PRIMING_FLAG     = 4
 	_LZP_HASH_SEED        = 0x7FEB352D
 	_LZP_HASH_LOG         = 16
 	_LZP_HASH_SHIFT       = 32 - _LZP_HASH_LOG
@@ -69,25 +71,30 @@ func (this *LZCodec) MaxEncodedLen(srcLen int) int {
 // NewLZCodecWithCtx creates a new instance of LZCodec using a
 // configuration map as parameter.
 func NewLZCodecWithCtx(ctx *map[string]any) (*LZCodec, error) {
+	lzType := LZ_TYPE
+
+	if val, containsKey := (*ctx)["lz"]; containsKey {
+		lzType = val.(uint64)
+	}
+
+	return newLZCodecWithCtx(ctx, lzType)
+}
+
+// newLZCodecWithCtx creates a new instance of LZCodec for the LZ type (LZ,
+// LZX or LZP)
+func newLZCodecWithCtx(ctx *map[string]any, lzType uint64) (*LZCodec, error) {
 	this := &LZCodec{}
 
 	var err error
 	var d kanzi.ByteTransform
 
-	if val, containsKey := (*ctx)["lz"]; containsKey {
-		lzType := val.(uint64)
-
-		if lzType == LZP_TYPE {
-			d, err = NewLZPCodecWithCtx(ctx)
-			this.delegate = d
-		}
-	}
-
-	if this.delegate == nil && err == nil {
-		d, err = NewLZXCodecWithCtx(ctx)
-		this.delegate = d
+	if lzType == LZP_TYPE {
+		d, err = NewLZPCodecWithCtx(ctx)
+	} else {
+		d, err = newLZXCodecWithCtx(ctx, lzType == LZX_TYPE)
 	}
 
+	this.delegate = d
 	return this, err
 }
 
@@ -124,6 +131,9 @@ func (this *LZCodec) Inverse(src, dst []byte) (uint, uint, error) {
 // LZXCodec Simple byte oriented LZ77 implementation.
 // It is a based on a heavily modified LZ4 with a bigger window, a bigger
 // hash map, 3+n*8 bit literal lengths and 17 or 24 bit match lengths.
+// Optional priming data (see internal.GetPriming) acts as a virtual prefix
+// of the block: matches can reference it, which helps with small blocks that
+// share content. The same priming data must be provided to decode.
 type LZXCodec struct {
 	hashes    []int32
 	mLenBuf   []byte
@@ -132,6 +142,8 @@ type LZXCodec struct {
 	extra     bool
 	ctx       *map[string]any
 	bsVersion uint
+	priming   []byte
+	finder    lzxMatchFinder
 }
 
 // NewLZXCodec creates a new instance of LZXCodec
@@ -149,29 +161,50 @@ func NewLZXCodec() (*LZXCodec, error) {
 // NewLZXCodecWithCtx creates a new instance of LZXCodec using a
 // configuration map as parameter.
 func NewLZXCodecWithCtx(ctx *map[string]any) (*LZXCodec, error) {
+	extra := false
+
+	if ctx != nil {
+		if val, containsKey := (*ctx)["lz"]; containsKey {
+			lzType := val.(uint64)
+			extra = lzType == LZX_TYPE
+		}
+	}
+
+	return newLZXCodecWithCtx(ctx, extra)
+}
+
+// newLZXCodecWithCtx creates a new instance of LZXCodec (LZX if extra is
+// true, LZ otherwise)
+func newLZXCodecWithCtx(ctx *map[string]any, extra bool) (*LZXCodec, error) {
 	this := &LZXCodec{}
 	this.hashes = make([]int32, 0)
 	this.mLenBuf = make([]byte, 0)
 	this.mBuf = make([]byte, 0)
 	this.tkBuf = make([]byte, 0)
-	this.extra = false
+	this.extra = extra
 	this.ctx = ctx
 	this.bsVersion = uint(3)
 
 	if ctx != nil {
-		if val, containsKey := (*ctx)["lz"]; containsKey {
-			lzType := val.(uint64)
-			this.extra = lzType == LZX_TYPE
-		}
-
 		if val, containsKey := (*ctx)["bsVersion"]; containsKey {
 			this.bsVersion = val.(uint)
 		}
+
+		this.priming = primingSuffix(internal.GetPriming(ctx), _LZX_MAX_PRIMING)
 	}
 
 	return this, nil
 }
 
+// primingSuffix returns the last (most relevant) bytes of the priming data
+func primingSuffix(priming []byte, maxSize int) []byte {
+	if len(priming) > maxSize {
+		return priming[len(priming)-maxSize:]
+	}
+
+	return priming
+}
+
 func emitLengthLZ(block []byte, length int) int {
 	if length < 254 {
 		block[0] = byte(length)
@@ -244,6 +277,18 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, errors.New("LZCodec forward transform skip: block too small, skip")
 	}
 
+	start := 0
+
+	if len(this.priming) != 0 {
+		// Prepend the priming data, the parsing starts right after it
+		start = len(this.priming)
+		buf := make([]byte, start+count)
+		copy(buf, this.priming)
+		copy(buf[start:], src)
+		src = buf
+		count += start
+	}
+
 	if len(this.hashes) == 0 {
 		if this.extra == true {
 			this.hashes = make([]int32, 1<<_LZX_HASH_LOG2)
@@ -274,32 +319,66 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 	maxDist := _LZX_MAX_DISTANCE2
 	dThreshold := 1 << 16
 	dst[12] = 1
+	smallWindow := false
+	minMatch := 0
+	level := getLZXLevel(this.ctx)
+
+	// Stage options (see LZOptions)
+	if this.ctx != nil {
+		if val, containsKey := (*this.ctx)["lzSmallWindow"]; containsKey {
+			smallWindow = val.(bool)
+		}
 
-	if srcEnd < 4*_LZX_MAX_DISTANCE1 {
+		if val, containsKey := (*this.ctx)["lzMinMatch"]; containsKey {
+			minMatch = int(val.(uint))
+		}
+	}
+
+	if srcEnd < 4*_LZX_MAX_DISTANCE1 || smallWindow == true {
 		maxDist = _LZX_MAX_DISTANCE1
 		dThreshold = 1 << 8
 		dst[12] = 0
 	}
 
-	minMatch := _LZX_MIN_MATCH4
+	if minMatch == 0 {
+		minMatch = _LZX_MIN_MATCH4
 
-	if this.ctx != nil {
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt := val.(internal.DataType)
-
-			if dt == internal.DT_DNA {
-				// Longer min match for DNA input
-				minMatch = _LZX_MIN_MATCH9
-				dst[12] |= 2
-			} else if dt == internal.DT_SMALL_ALPHABET {
-				return 0, 0, errors.New("LZCodec forward transform skip: Small alphabet")
+		if dt := internal.GetDataType(this.ctx); dt == internal.DT_DNA {
+			// Longer min match for DNA input
+			minMatch = _LZX_MIN_MATCH9
+		} else if dt == internal.DT_SMALL_ALPHABET {
+			return 0, 0, errors.New("LZCodec forward transform skip: Small alphabet")
+		}
+	}
+
+	if minMatch == _LZX_MIN_MATCH9 {
+		dst[12] |= 2
+	}
+
+	var finder *lzxMatchFinder
+
+	if level.finder != _LZX_FINDER_HASH {
+		// Hash chains or binary trees (see LZMatchFinder.go)
+		finder = &this.finder
+		finder.reset(level, this.hashes, this.hash, count, maxDist, srcEnd)
+		dst[12] |= byte(level.finder << _LZX_FINDER_SHIFT)
+	}
+
+	if start != 0 {
+		dst[12] |= _LZX_PRIMING_FLAG
+
+		if finder != nil {
+			finder.update(src, start)
+		} else {
+			for i := 0; i < start; i++ {
+				this.hashes[this.hash(src[i:])] = int32(i)
 			}
 		}
 	}
 
-	srcIdx := 0
+	srcIdx := start
 	dstIdx := 13
-	anchor := 0
+	anchor := start
 	mLenIdx := 0
 	mIdx := 0
 	tkIdx := 0
@@ -332,7 +411,17 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 			}
 		}
 
-		if bestLen < minMatch {
+		if bestLen < minMatch && finder != nil {
+			if ref, bestLen = finder.find(src, srcIdx); bestLen < minMatch {
+				srcIdx++
+				srcIdx += (srcInc >> 6)
+				srcInc++
+				repdIdx = 0
+				continue
+			}
+
+			srcIdx, ref, bestLen = finder.lazy(src, srcIdx, ref, bestLen)
+		} else if bestLen < minMatch {
 			h0 := this.hash(src[srcIdx:])
 			ref = int(this.hashes[h0])
 			this.hashes[h0] = int32(srcIdx)
@@ -350,7 +439,7 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 				continue
 			}
 
-			if ref != srcIdx-repd[0] && ref != srcIdx-repd[1] {
+			if ref != srcIdx-repd[0] && ref != srcIdx-repd[1] && level.lazy > 0 {
 				// Check if better match at next position
 				srcIdx1 := srcIdx + 1
 				h1 := this.hash(src[srcIdx1:])
@@ -375,16 +464,22 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 				}
 			}
 		} else {
-			h0 := this.hash(src[srcIdx:])
-			this.hashes[h0] = int32(srcIdx)
+			// The match finder inserts the positions after the match
+			if finder == nil {
+				h0 := this.hash(src[srcIdx:])
+				this.hashes[h0] = int32(srcIdx)
+			}
 
 			if src[srcIdx] == src[ref-1] && bestLen < _LZX_MAX_MATCH {
 				bestLen++
 				ref--
 			} else {
 				srcIdx++
-				h1 := this.hash(src[srcIdx:])
-				this.hashes[h1] = int32(srcIdx)
+
+				if finder == nil {
+					h1 := this.hash(src[srcIdx:])
+					this.hashes[h1] = int32(srcIdx)
+				}
 			}
 		}
 
@@ -490,6 +585,11 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 		anchor = srcIdx + bestLen
 		srcIdx++
 
+		if finder != nil {
+			finder.update(src, anchor)
+			srcIdx = anchor
+		}
+
 		for srcIdx < anchor {
 			this.hashes[this.hash(src[srcIdx:])] = int32(srcIdx)
 			srcIdx++
@@ -499,8 +599,8 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 	// Emit last literals
 	litLen := count - anchor
 
-	if dstIdx+litLen+tkIdx+mIdx >= count {
-		return uint(count), uint(dstIdx), errors.New("LZCodec forward transform skip: no compression")
+	if dstIdx+litLen+tkIdx+mIdx >= count-start {
+		return uint(count - start), uint(dstIdx), errors.New("LZCodec forward transform skip: no compression")
 	}
 
 	if litLen >= 7 {
@@ -525,18 +625,28 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 	dstIdx += mIdx
 	copy(dst[dstIdx:], this.mLenBuf[0:mLenIdx])
 	dstIdx += mLenIdx
-	return uint(count), uint(dstIdx), nil
+	return uint(count - start), uint(dstIdx), nil
 }
 
 func findMatchLZX(src []byte, srcIdx, ref, maxMatch int) int {
 	bestLen := 0
 
-	for bestLen+4 <= maxMatch {
+	// Compare 8 bytes at a time, then 4 bytes (same result as 4 bytes only)
+	for bestLen+8 <= maxMatch {
+		diff := binary.LittleEndian.Uint64(src[srcIdx+bestLen:]) ^ binary.LittleEndian.Uint64(src[ref+bestLen:])
+
+		if diff != 0 {
+			return bestLen + (bits.TrailingZeros64(diff) >> 3)
+		}
+
+		bestLen += 8
+	}
+
+	if bestLen+4 <= maxMatch {
 		diff := binary.LittleEndian.Uint32(src[srcIdx+bestLen:]) ^ binary.LittleEndian.Uint32(src[ref+bestLen:])
 
 		if diff != 0 {
-			bestLen += (bits.TrailingZeros32(diff) >> 3)
-			break
+			return bestLen + (bits.TrailingZeros32(diff) >> 3)
 		}
 
 		bestLen += 4
@@ -588,6 +698,20 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 
 	srcEnd := tkIdx - 13
 	mFlag := int(src[12]) & 1
+	output := dst
+	start := 0
+
+	if src[12]&_LZX_PRIMING_FLAG != 0 {
+		if len(this.priming) == 0 {
+			return 0, 0, errors.New("LZCodec inverse transform failed: missing priming data")
+		}
+
+		// Decode after a copy of the priming data
+		start = len(this.priming)
+		dst = make([]byte, start+len(output))
+		copy(dst, this.priming)
+	}
+
 	dstEnd := len(dst) - 16
 	maxDist := _LZX_MAX_DISTANCE2
 
@@ -602,7 +726,7 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 	}
 
 	srcIdx := 13
-	dstIdx := 0
+	dstIdx := start
 	repd0 := 0
 	repd1 := 0
 
@@ -713,7 +837,11 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 		err = errors.New("LZCodec inverse transform failed")
 	}
 
-	return uint(mIdx), uint(dstIdx), err
+	if start != 0 {
+		copy(output, dst[start:dstIdx])
+	}
+
+	return uint(mIdx), uint(dstIdx - start), err
 }
 
 func (this *LZXCodec) inverseV3(src, dst []byte) (uint, uint, error) {
@@ -0,0 +1,247 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+// Match finders of the LZ and LZX transforms (ctx["lzLevel"], see
+// LZOptions). Level 2 (default) uses one position per hash value and checks
+// the next position for a longer match. Level 1 is greedy. Levels 3 and 4
+// use hash chains and level 5 binary trees (the hash table holds the last
+// position or the root of the tree), with a limited number of candidates
+// per position and a lazy evaluation of the next one or two positions. The
+// match finder is recorded in the block flags but the bitstream is the same
+// for all levels: the inverse transform ignores it.
+
+const (
+	_LZX_FINDER_HASH   = 0
+	_LZX_FINDER_CHAIN  = 1
+	_LZX_FINDER_TREE   = 2
+	_LZX_FINDER_SHIFT  = 3 // position of the match finder in the block flags
+	_LZX_LEVEL_DEFAULT = 2
+	_LZX_LEVEL_MAX     = 5
+	_LZX_MAX_WINDOW    = 1 << 24 // positions in the chains and trees
+)
+
+// lzxLevel the match finder parameters of a level
+type lzxLevel struct {
+	finder  int // _LZX_FINDER_XXX
+	depth   int // max candidates checked per position
+	lazy    int // next positions checked for a longer match
+	niceLen int // length of the matches good enough to stop searching
+}
+
+var _LZX_LEVELS = [_LZX_LEVEL_MAX + 1]lzxLevel{
+	{},
+	{finder: _LZX_FINDER_HASH, lazy: 0},
+	{finder: _LZX_FINDER_HASH, lazy: 1},
+	{finder: _LZX_FINDER_CHAIN, depth: 16, lazy: 1, niceLen: 64},
+	{finder: _LZX_FINDER_CHAIN, depth: 64, lazy: 2, niceLen: 128},
+	{finder: _LZX_FINDER_TREE, depth: 48, lazy: 2, niceLen: 256},
+}
+
+// getLZXLevel returns the parameters of the level in the context (default
+// level if missing or invalid)
+func getLZXLevel(ctx *map[string]any) lzxLevel {
+	if ctx != nil {
+		if val, containsKey := (*ctx)["lzLevel"]; containsKey {
+			if level, ok := val.(uint); ok == true && level >= 1 && level <= _LZX_LEVEL_MAX {
+				return _LZX_LEVELS[level]
+			}
+		}
+	}
+
+	return _LZX_LEVELS[_LZX_LEVEL_DEFAULT]
+}
+
+// lzxMatchFinder hash chains or binary trees of the positions of a block.
+// The positions are inserted in order, the skipped ones when the next match
+// is searched or the parser moves past a match.
+type lzxMatchFinder struct {
+	level   lzxLevel
+	heads   []int32 // last position for each hash value (0 if none)
+	links   []int32 // previous position (chain) or children (tree) of each position
+	mask    int
+	maxDist int
+	srcEnd  int
+	next    int // first position not inserted
+	hash    func([]byte) uint32
+}
+
+// reset prepares the match finder for a block of count bytes
+func (this *lzxMatchFinder) reset(level lzxLevel, heads []int32, hash func([]byte) uint32, count, maxDist, srcEnd int) {
+	window := 1
+
+	for window < count && window < _LZX_MAX_WINDOW {
+		window <<= 1
+	}
+
+	size := window
+
+	if level.finder == _LZX_FINDER_TREE {
+		size <<= 1
+	}
+
+	// No need to clear the links: only the inserted positions are visited
+	if len(this.links) < size {
+		this.links = make([]int32, size)
+	}
+
+	this.level = level
+	this.heads = heads
+	this.hash = hash
+	this.mask = window - 1
+	this.maxDist = maxDist
+	this.srcEnd = srcEnd
+	this.next = 0
+}
+
+// find inserts the positions up to idx (included) and returns the position
+// and length of the longest match found at idx
+func (this *lzxMatchFinder) find(src []byte, idx int) (int, int) {
+	this.update(src, idx)
+
+	if this.level.finder == _LZX_FINDER_TREE {
+		return this.insertTree(src, idx)
+	}
+
+	return this.insertChain(src, idx, true)
+}
+
+// update inserts the positions up to end (excluded)
+func (this *lzxMatchFinder) update(src []byte, end int) {
+	for this.next < end {
+		if this.level.finder == _LZX_FINDER_TREE {
+			this.insertTree(src, this.next)
+		} else {
+			this.insertChain(src, this.next, false)
+		}
+	}
+}
+
+// lazy checks the next positions for a longer match and returns the start,
+// position and length of the selected match. A match starting d bytes later
+// must be at least d bytes longer to pay for the extra literals.
+func (this *lzxMatchFinder) lazy(src []byte, srcIdx, ref, bestLen int) (int, int, int) {
+	for d := 1; d <= this.level.lazy && bestLen < this.level.niceLen; {
+		idx := srcIdx + d
+
+		if idx >= this.srcEnd {
+			break
+		}
+
+		if ref1, bestLen1 := this.find(src, idx); bestLen1 >= bestLen+d {
+			srcIdx, ref, bestLen = idx, ref1, bestLen1
+			d = 1
+		} else {
+			d++
+		}
+	}
+
+	return srcIdx, ref, bestLen
+}
+
+func (this *lzxMatchFinder) insertChain(src []byte, idx int, search bool) (int, int) {
+	this.next = idx + 1
+	h := this.hash(src[idx:])
+	ref := int(this.heads[h])
+	this.heads[h] = int32(idx)
+	this.links[idx&this.mask] = int32(ref)
+
+	if search == false {
+		return 0, 0
+	}
+
+	minRef := max(idx-this.maxDist, 0)
+	maxMatch := min(this.srcEnd-idx, _LZX_MAX_MATCH)
+	bestRef := 0
+	bestLen := 0
+
+	for depth := this.level.depth; depth > 0 && ref > minRef; depth-- {
+		// The byte after the best length must match to find a longer match
+		if src[ref+bestLen] == src[idx+bestLen] {
+			if n := findMatchLZX(src, idx, ref, maxMatch); n > bestLen {
+				bestRef, bestLen = ref, n
+
+				if n >= this.level.niceLen || n == maxMatch {
+					break
+				}
+			}
+		}
+
+		ref = int(this.links[ref&this.mask])
+	}
+
+	return bestRef, bestLen
+}
+
+// insertTree inserts idx as the root of the tree of its hash value: the
+// tree is split while searched (the smaller suffixes on the left, the
+// larger ones on the right)
+func (this *lzxMatchFinder) insertTree(src []byte, idx int) (int, int) {
+	this.next = idx + 1
+	h := this.hash(src[idx:])
+	ref := int(this.heads[h])
+	this.heads[h] = int32(idx)
+	minRef := max(idx-this.maxDist, 0)
+	maxMatch := min(this.srcEnd-idx, _LZX_MAX_MATCH)
+	limit := min(maxMatch, this.level.niceLen)
+	left := (idx & this.mask) << 1
+	right := left + 1
+	leftLen := 0
+	rightLen := 0
+	bestRef := 0
+	bestLen := 0
+
+	for depth := this.level.depth; ; depth-- {
+		if depth == 0 || ref <= minRef {
+			this.links[left] = 0
+			this.links[right] = 0
+			break
+		}
+
+		node := (ref & this.mask) << 1
+		n := min(leftLen, rightLen)
+		n += findMatchLZX(src, idx+n, ref+n, limit-n)
+
+		if n > bestLen {
+			bestRef, bestLen = ref, n
+		}
+
+		if n >= limit {
+			// Same suffix (up to the limit): ref replaced by idx
+			this.links[left] = this.links[node]
+			this.links[right] = this.links[node+1]
+			break
+		}
+
+		if src[ref+n] < src[idx+n] {
+			this.links[left] = int32(ref)
+			left = node + 1
+			ref = int(this.links[left])
+			leftLen = n
+		} else {
+			this.links[right] = int32(ref)
+			right = node
+			ref = int(this.links[right])
+			rightLen = n
+		}
+	}
+
+	if bestLen == limit && limit < maxMatch {
+		bestLen = findMatchLZX(src, idx, bestRef, maxMatch)
+	}
+
+	return bestRef, bestLen
+}
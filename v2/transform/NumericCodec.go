@@ -0,0 +1,294 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_NUM_HEADER_SIZE      = 1 // mode
+	_NUM_MIN_BLOCK_LENGTH = 256
+	_NUM_SAMPLE_SIZE      = 64 * 1024
+	_NUM_MODE_STRIDE      = 0x03 // log2(stride) - 1
+	_NUM_MODE_XOR         = 0x04 // xor of consecutive values instead of delta
+	_NUM_MODE_BIG_ENDIAN  = 0x08
+)
+
+// NumericCodec a transform for arrays of fixed size numbers (EG. metrics,
+// time series, sensor dumps). Each value is replaced with the difference
+// with the previous value (zigzag encoded so that small negative deltas
+// have small codes) or, for floating point numbers, the xor with the
+// previous value. The residuals are then split into byte planes: the
+// high planes are mostly zeros and the low planes have a skewed
+// distribution, which suits the entropy codecs.
+// The layout (size of the values: 2, 4 or 8 bytes, endianness, delta or
+// xor) is selected by trying all of them on a sample of the block. It can
+// be forced with the context: 'numericStride' (2, 4 or 8), 'numericFloat'
+// and 'numericBigEndian'. The trailing bytes (incomplete value) are copied
+// as is.
+// Format: mode (stride, xor, endianness), byte planes (least significant
+// first), trailing bytes.
+type NumericCodec struct {
+	ctx *map[string]any
+}
+
+// NewNumericCodec creates a new instance of NumericCodec
+func NewNumericCodec() (*NumericCodec, error) {
+	return &NumericCodec{}, nil
+}
+
+// NewNumericCodecWithCtx creates a new instance of NumericCodec using a
+// configuration map as parameter.
+func NewNumericCodecWithCtx(ctx *map[string]any) (*NumericCodec, error) {
+	return &NumericCodec{ctx: ctx}, nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this *NumericCodec) MaxEncodedLen(srcLen int) int {
+	return srcLen + _NUM_HEADER_SIZE
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *NumericCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	if count < _NUM_MIN_BLOCK_LENGTH {
+		return 0, 0, errors.New("NUMERIC forward transform skip: block too small")
+	}
+
+	if internal.IsDataCompressed(internal.GetMagicType(src)) == true {
+		return 0, 0, errors.New("NUMERIC forward transform skip: compressed data")
+	}
+
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_BIN && dt != internal.DT_MULTIMEDIA && dt != internal.DT_SMALL_ALPHABET {
+		return 0, 0, errors.New("NUMERIC forward transform skip: not numeric data")
+	}
+
+	mode, ok := this.selectMode(src)
+
+	if ok == false {
+		return 0, 0, errors.New("NUMERIC forward transform skip: no improvement")
+	}
+
+	dst[0] = mode
+	stride := 2 << (mode & _NUM_MODE_STRIDE)
+	n := count / stride
+	end := n * stride
+	encodeNumeric(src[0:end], dst[_NUM_HEADER_SIZE:], mode)
+	copy(dst[_NUM_HEADER_SIZE+end:], src[end:])
+	return uint(count), uint(count + _NUM_HEADER_SIZE), nil
+}
+
+// selectMode returns the layout that minimizes the order 0 entropy of
+// the byte planes of a sample of the block and true if it is lower than
+// the entropy of the sample
+func (this *NumericCodec) selectMode(src []byte) (byte, bool) {
+	strides := []int{2, 4, 8}
+	endianness := []byte{0, _NUM_MODE_BIG_ENDIAN}
+	kinds := []byte{0, _NUM_MODE_XOR}
+
+	if this.ctx != nil {
+		if val, hasKey := (*this.ctx)["numericStride"]; hasKey {
+			if s := val.(uint); s == 2 || s == 4 || s == 8 {
+				strides = []int{int(s)}
+			}
+		}
+
+		if val, hasKey := (*this.ctx)["numericFloat"]; hasKey {
+			if val.(bool) == true {
+				kinds = []byte{_NUM_MODE_XOR}
+			} else {
+				kinds = []byte{0}
+			}
+		}
+
+		if val, hasKey := (*this.ctx)["numericBigEndian"]; hasKey {
+			if val.(bool) == true {
+				endianness = []byte{_NUM_MODE_BIG_ENDIAN}
+			} else {
+				endianness = []byte{0}
+			}
+		}
+	}
+
+	sample := src[0 : min(len(src), _NUM_SAMPLE_SIZE)&-8]
+	histo := [256]int{}
+	internal.ComputeHistogram(sample, histo[:], true, false)
+	bestCost := internal.ComputeFirstOrderEntropy1024(len(sample), histo[:]) * len(sample)
+	baseCost := bestCost
+	best := byte(0)
+	buf := make([]byte, len(sample))
+
+	for _, stride := range strides {
+		for _, kind := range kinds {
+			if kind == _NUM_MODE_XOR && stride == 2 {
+				// No 16 bit floats
+				continue
+			}
+
+			for _, order := range endianness {
+				mode := byte(internal.Log2NoCheck(uint32(stride))-1) | kind | order
+				encodeNumeric(sample, buf, mode)
+				cost := 0
+				planeSize := len(sample) / stride
+
+				for p := 0; p < stride; p++ {
+					plane := buf[p*planeSize : (p+1)*planeSize]
+					clear(histo[:])
+					internal.ComputeHistogram(plane, histo[:], true, false)
+					cost += internal.ComputeFirstOrderEntropy1024(len(plane), histo[:]) * len(plane)
+				}
+
+				if cost < bestCost {
+					bestCost = cost
+					best = mode
+				}
+			}
+		}
+	}
+
+	// Require a significant gain
+	return best, bestCost < baseCost-baseCost/8
+}
+
+// encodeNumeric writes the byte planes of the residuals of the values in
+// src (len(src) is a multiple of the stride) to dst
+func encodeNumeric(src, dst []byte, mode byte) {
+	stride := 2 << (mode & _NUM_MODE_STRIDE)
+	width := uint(8 * stride)
+	n := len(src) / stride
+	prev := uint64(0)
+
+	for i := 0; i < n; i++ {
+		val := readNumeric(src[i*stride:], stride, mode&_NUM_MODE_BIG_ENDIAN != 0)
+		var res uint64
+
+		if mode&_NUM_MODE_XOR != 0 {
+			res = val ^ prev
+		} else {
+			// Sign extended delta, zigzag encoded
+			delta := int64((val-prev)<<(64-width)) >> (64 - width)
+			res = uint64((delta << 1) ^ (delta >> 63))
+		}
+
+		prev = val
+
+		for p := 0; p < stride; p++ {
+			dst[p*n+i] = byte(res >> (8 * uint(p)))
+		}
+	}
+}
+
+func readNumeric(buf []byte, stride int, bigEndian bool) uint64 {
+	res := uint64(0)
+
+	if bigEndian == true {
+		for i := 0; i < stride; i++ {
+			res = (res << 8) | uint64(buf[i])
+		}
+	} else {
+		for i := stride - 1; i >= 0; i-- {
+			res = (res << 8) | uint64(buf[i])
+		}
+	}
+
+	return res
+}
+
+func writeNumeric(buf []byte, stride int, bigEndian bool, val uint64) {
+	if bigEndian == true {
+		for i := stride - 1; i >= 0; i-- {
+			buf[i] = byte(val)
+			val >>= 8
+		}
+	} else {
+		for i := 0; i < stride; i++ {
+			buf[i] = byte(val)
+			val >>= 8
+		}
+	}
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *NumericCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	mode := src[0]
+
+	if mode&^(_NUM_MODE_STRIDE|_NUM_MODE_XOR|_NUM_MODE_BIG_ENDIAN) != 0 || mode&_NUM_MODE_STRIDE == _NUM_MODE_STRIDE {
+		return 0, 0, errors.New("NUMERIC inverse transform failed: invalid mode")
+	}
+
+	count := len(src) - _NUM_HEADER_SIZE
+
+	if len(dst) < count {
+		return 0, 0, errors.New("NUMERIC inverse transform failed: output buffer too small")
+	}
+
+	stride := 2 << (mode & _NUM_MODE_STRIDE)
+	width := uint(8 * stride)
+	mask := ^uint64(0) >> (64 - width)
+	bigEndian := mode&_NUM_MODE_BIG_ENDIAN != 0
+	n := count / stride
+	planes := src[_NUM_HEADER_SIZE:]
+	prev := uint64(0)
+
+	for i := 0; i < n; i++ {
+		res := uint64(0)
+
+		for p := stride - 1; p >= 0; p-- {
+			res = (res << 8) | uint64(planes[p*n+i])
+		}
+
+		if mode&_NUM_MODE_XOR != 0 {
+			prev ^= res
+		} else {
+			delta := uint64(int64(res>>1) ^ -int64(res&1))
+			prev = (prev + delta) & mask
+		}
+
+		writeNumeric(dst[i*stride:], stride, bigEndian, prev)
+	}
+
+	copy(dst[n*stride:], planes[n*stride:count])
+	return uint(len(src)), uint(count), nil
+}
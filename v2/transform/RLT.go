@@ -21,6 +21,12 @@ package transform
 // 4    <= runLen < 224+4      -> 1 byte
 // 228  <= runLen < 6944+228   -> 2 bytes
 // 7172 <= runLen < 65535+7172 -> 3 bytes
+//
+// Unit modes (multimedia and binary data): runs of 2-byte or 4-byte units
+// (EG. 16-bit PCM samples, RGBA pixels) are encoded instead of runs of bytes.
+// The stream starts with escape, escape, mode (stride | tail size << 3),
+// a sequence that cannot start a byte mode stream. The unit size is selected
+// by sampling the block or forced with the context ('rltStride' = 1, 2 or 4).
 
 import (
 	"encoding/binary"
@@ -39,6 +45,7 @@ const (
 	_RLT_MAX_RUN4         = _RLT_MAX_RUN - 4
 	_RLT_MIN_BLOCK_LENGTH = 16
 	_RLT_DEFAULT_ESCAPE   = 0xFB
+	_RLT_STRIDE_SAMPLE    = 65536
 )
 
 // RLT a Run Length Transform with escape symbol
@@ -84,12 +91,10 @@ func (this *RLT) Forward(src, dst []byte) (uint, uint, error) {
 	findBestEscape := true
 
 	if this.ctx != nil {
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt = val.(internal.DataType)
+		dt = internal.GetDataType(this.ctx)
 
-			if dt == internal.DT_DNA || dt == internal.DT_BASE64 || dt == internal.DT_UTF8 {
-				return 0, 0, fmt.Errorf("RLT forward transform skip")
-			}
+		if dt == internal.DT_DNA || dt == internal.DT_BASE64 || dt == internal.DT_UTF8 {
+			return 0, 0, fmt.Errorf("RLT forward transform skip")
 		}
 
 		if val, containsKey := (*this.ctx)["entropy"]; containsKey {
@@ -107,13 +112,13 @@ func (this *RLT) Forward(src, dst []byte) (uint, uint, error) {
 
 	if findBestEscape == true {
 		freqs := [256]int{}
-		internal.ComputeHistogram(src, freqs[:], true, false)
+		internal.Histogram(this.ctx, src, freqs[:])
 
 		if dt == internal.DT_UNDEFINED {
 			dt = internal.DetectSimpleType(len(src), freqs[:])
 
-			if this.ctx != nil && dt != internal.DT_UNDEFINED {
-				(*this.ctx)["dataType"] = dt
+			if dt != internal.DT_UNDEFINED {
+				internal.SetDataType(this.ctx, dt)
 			}
 
 			if dt == internal.DT_DNA || dt == internal.DT_BASE64 || dt == internal.DT_UTF8 {
@@ -139,6 +144,10 @@ func (this *RLT) Forward(src, dst []byte) (uint, uint, error) {
 		escape = byte(minIdx)
 	}
 
+	if stride := this.selectStride(src, dt); stride > 1 {
+		return this.forwardUnits(src, dst, escape, stride)
+	}
+
 	srcIdx := 0
 	dstIdx := 0
 	srcEnd := len(src)
@@ -342,8 +351,9 @@ func (this *RLT) Inverse(src, dst []byte) (uint, uint, error) {
 		srcIdx++
 
 		// The data cannot start with a run but may start with an escape literal
+		// (byte mode) or a unit mode
 		if srcIdx < srcEnd && src[srcIdx] != 0 {
-			return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: input starts with a run")
+			return this.inverseUnits(src, dst)
 		}
 
 		srcIdx++
@@ -435,6 +445,229 @@ func (this *RLT) Inverse(src, dst []byte) (uint, uint, error) {
 	return uint(srcIdx), uint(dstIdx), err
 }
 
+// selectStride returns the size of the repeated units (1, 2 or 4)
+func (this *RLT) selectStride(src []byte, dt internal.DataType) int {
+	if this.ctx != nil {
+		if val, containsKey := (*this.ctx)["rltStride"]; containsKey {
+			if stride := val.(uint); stride == 2 || stride == 4 {
+				return int(stride)
+			}
+
+			return 1
+		}
+	}
+
+	if dt != internal.DT_UNDEFINED && dt != internal.DT_MULTIMEDIA && dt != internal.DT_BIN {
+		return 1
+	}
+
+	sample := src[0:min(len(src), _RLT_STRIDE_SAMPLE)]
+	best := 1
+	bestScore := countRunBytes(sample, 1)
+
+	// Byte runs are also unit runs: units must cover significantly more bytes
+	for _, stride := range []int{2, 4} {
+		if score := countRunBytes(sample, stride); score > bestScore+bestScore/8 && score >= len(sample)/16 {
+			best, bestScore = stride, score
+		}
+	}
+
+	return best
+}
+
+// countRunBytes returns the number of bytes in runs of units long enough to
+// be encoded as a run
+func countRunBytes(buf []byte, stride int) int {
+	end := len(buf) - len(buf)%stride
+	res := 0
+	run := 1
+
+	for i := stride; i < end; i += stride {
+		if loadUnit(buf, i, stride) == loadUnit(buf, i-stride, stride) {
+			run++
+			continue
+		}
+
+		if run > _RLT_RUN_THRESHOLD {
+			res += run * stride
+		}
+
+		run = 1
+	}
+
+	if run > _RLT_RUN_THRESHOLD {
+		res += run * stride
+	}
+
+	return res
+}
+
+func loadUnit(buf []byte, idx, stride int) uint32 {
+	switch stride {
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(buf[idx:]))
+	case 4:
+		return binary.LittleEndian.Uint32(buf[idx:])
+	default:
+		return uint32(buf[idx])
+	}
+}
+
+// forwardUnits encodes runs of 'stride' bytes units. The first byte of a
+// literal unit is escaped if equal to the escape symbol.
+func (this *RLT) forwardUnits(src, dst []byte, escape byte, stride int) (uint, uint, error) {
+	srcEnd := len(src) - len(src)%stride
+	dstEnd := len(dst)
+	dst[0] = escape
+	dst[1] = escape
+	dst[2] = byte(stride | ((len(src) - srcEnd) << 3))
+	srcIdx := 0
+	dstIdx := 3
+
+	for srcIdx < srcEnd {
+		unit := loadUnit(src, srcIdx, stride)
+		next := srcIdx + stride
+		run := 1
+
+		for next < srcEnd && run < _RLT_MAX_RUN && loadUnit(src, next, stride) == unit {
+			next += stride
+			run++
+		}
+
+		// Literal unit, run length (up to 4 bytes) and one more unit at most
+		if dstIdx+2*stride+6 >= dstEnd {
+			return uint(srcIdx), uint(dstIdx), errors.New("RLT forward transform skip: output buffer is too small")
+		}
+
+		if src[srcIdx] == escape {
+			dst[dstIdx] = escape
+			dst[dstIdx+1] = 0
+			dstIdx += 2
+			dstIdx += copy(dst[dstIdx:], src[srcIdx+1:srcIdx+stride])
+		} else {
+			dstIdx += copy(dst[dstIdx:], src[srcIdx:srcIdx+stride])
+		}
+
+		if run > _RLT_RUN_THRESHOLD {
+			dst[dstIdx] = escape
+			dstIdx++
+			dstIdx += emitRunLength(dst[dstIdx:dstEnd], run)
+			srcIdx = next
+		} else {
+			srcIdx += stride
+		}
+	}
+
+	if dstIdx+len(src)-srcEnd >= dstEnd {
+		return uint(srcIdx), uint(dstIdx), errors.New("RLT forward transform skip: output buffer is too small")
+	}
+
+	dstIdx += copy(dst[dstIdx:], src[srcEnd:])
+	srcIdx = len(src)
+
+	if dstIdx >= srcIdx {
+		return uint(srcIdx), uint(dstIdx), errors.New("RLT forward transform skip: no compression")
+	}
+
+	return uint(srcIdx), uint(dstIdx), nil
+}
+
+// inverseUnits decodes a stream encoded by forwardUnits
+func (this *RLT) inverseUnits(src, dst []byte) (uint, uint, error) {
+	if len(src) < 3 {
+		return 0, 0, errors.New("RLT inverse transform failed: invalid data")
+	}
+
+	escape := src[0]
+	stride := int(src[2] & 0x07)
+	tail := int(src[2] >> 3)
+
+	if (stride != 2 && stride != 4) || tail >= stride || len(src) < 3+tail {
+		return 0, 0, errors.New("RLT inverse transform failed: invalid unit mode")
+	}
+
+	srcIdx := 3
+	dstIdx := 0
+	srcEnd := len(src) - tail
+	dstEnd := len(dst)
+
+	for srcIdx < srcEnd {
+		if src[srcIdx] == escape {
+			if srcIdx+1 >= srcEnd {
+				return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: invalid data")
+			}
+
+			if src[srcIdx+1] != 0 {
+				// Run of the previous unit
+				run, n := readRunLength(src[srcIdx+1 : srcEnd])
+				srcIdx += 1 + n
+
+				if n == 0 || dstIdx < stride || run > _RLT_MAX_RUN || dstIdx+run*stride > dstEnd {
+					return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: invalid run length")
+				}
+
+				for i := 0; i < run; i++ {
+					dstIdx += copy(dst[dstIdx:dstIdx+stride], dst[dstIdx-stride:dstIdx])
+				}
+
+				continue
+			}
+
+			// Escaped literal unit
+			if srcIdx+stride+1 > srcEnd || dstIdx+stride > dstEnd {
+				return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: invalid data")
+			}
+
+			dst[dstIdx] = escape
+			copy(dst[dstIdx+1:], src[srcIdx+2:srcIdx+stride+1])
+			srcIdx += stride + 1
+			dstIdx += stride
+			continue
+		}
+
+		if srcIdx+stride > srcEnd || dstIdx+stride > dstEnd {
+			return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: invalid data")
+		}
+
+		dstIdx += copy(dst[dstIdx:], src[srcIdx:srcIdx+stride])
+		srcIdx += stride
+	}
+
+	if dstIdx+tail > dstEnd {
+		return uint(srcIdx), uint(dstIdx), errors.New("RLT inverse transform failed: output buffer is too small")
+	}
+
+	dstIdx += copy(dst[dstIdx:], src[srcEnd:])
+	return uint(len(src)), uint(dstIdx), nil
+}
+
+// readRunLength decodes a run length written by emitRunLength and returns
+// the number of repeats and the number of bytes read (0 if invalid)
+func readRunLength(src []byte) (int, int) {
+	run := int(src[0])
+	n := 1
+
+	if run == 0xFF {
+		if len(src) < 3 {
+			return 0, 0
+		}
+
+		run = (int(src[1]) << 8) | int(src[2])
+		run += _RLT_RUN_LEN_ENCODE2
+		n = 3
+	} else if run >= _RLT_RUN_LEN_ENCODE1 {
+		if len(src) < 2 {
+			return 0, 0
+		}
+
+		run = ((run - _RLT_RUN_LEN_ENCODE1) << 8) | int(src[1])
+		run += _RLT_RUN_LEN_ENCODE1
+		n = 2
+	}
+
+	return run + _RLT_RUN_THRESHOLD - 1, n
+}
+
 // MaxEncodedLen returns the max size required for the encoding output buffer
 func (this *RLT) MaxEncodedLen(srcLen int) int {
 	if srcLen <= 512 {
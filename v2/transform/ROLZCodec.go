@@ -42,6 +42,8 @@ const (
 	_ROLZ_LOG_POS_CHECKS2 = 5
 	_ROLZ_CHUNK_SIZE      = 16 * 1024 * 1024
 	_ROLZ_HASH_MASK       = ^uint32(_ROLZ_CHUNK_SIZE - 1)
+	_ROLZ_MAX_PRIMING     = 1 << 16
+	_ROLZ_PRIMING_FLAG    = uint32(1 << 31)
 	_ROLZ_MATCH_FLAG      = 0
 	_ROLZ_LITERAL_FLAG    = 1
 	_ROLZ_MATCH_CTX       = 0
@@ -126,28 +128,52 @@ func NewROLZCodecWithFlag(extra bool) (*ROLZCodec, error) {
 }
 
 // NewROLZCodecWithCtx creates a new instance of ROLZCodec providing a
-// context map. If the map contains a transform name set to "ROLZX"
-// encode literals and matches using ANS. Otherwise encode literals
-// and matches using CM and check more match positions.
+// context map. If the map contains a ROLZ type (ctx["rolz"]) or else a
+// transform name set to "ROLZX" encode literals and matches using ANS.
+// Otherwise encode literals and matches using CM and check more match
+// positions. The number of positions checked can be set with
+// ctx["rolzLogPosChecks"] (see ROLZOptions).
 func NewROLZCodecWithCtx(ctx *map[string]any) (*ROLZCodec, error) {
+	extra := false
+
+	if val, containsKey := (*ctx)["rolz"]; containsKey {
+		extra = val.(uint64) == ROLZX_TYPE
+	} else if val, containsKey := (*ctx)["transform"]; containsKey {
+		extra = strings.Contains(val.(string), "ROLZX")
+	}
+
+	logPosChecks := uint(0)
+
+	if val, containsKey := (*ctx)["rolzLogPosChecks"]; containsKey {
+		logPosChecks = val.(uint)
+	}
+
+	return newROLZCodecWithCtx(ctx, extra, logPosChecks)
+}
+
+// newROLZCodecWithCtx creates a new instance of ROLZCodec (ROLZX if extra is
+// true) checking 1<<logPosChecks match positions (default if 0)
+func newROLZCodecWithCtx(ctx *map[string]any, extra bool, logPosChecks uint) (*ROLZCodec, error) {
 	this := &ROLZCodec{}
 	var err error
 	var d kanzi.ByteTransform
 
-	if val, containsKey := (*ctx)["transform"]; containsKey {
-		transform := val.(string)
+	if logPosChecks == 0 {
+		logPosChecks = _ROLZ_LOG_POS_CHECKS1
 
-		if strings.Contains(transform, "ROLZX") {
-			d, err = newROLZCodec2WithCtx(_ROLZ_LOG_POS_CHECKS2, ctx)
-			this.delegate = d
+		if extra == true {
+			logPosChecks = _ROLZ_LOG_POS_CHECKS2
 		}
 	}
 
-	if this.delegate == nil && err == nil {
-		d, err = newROLZCodec1WithCtx(_ROLZ_LOG_POS_CHECKS1, ctx)
-		this.delegate = d
+	if extra == true {
+		d, err = newROLZCodec2WithCtx(logPosChecks, ctx)
+	} else {
+		d, err = newROLZCodec1WithCtx(logPosChecks, ctx)
 	}
 
+	this.delegate = d
+
 	return this, err
 }
 
@@ -199,6 +225,9 @@ func (this *ROLZCodec) MaxEncodedLen(srcLen int) int {
 }
 
 // Use ANS to encode/decode literals and matches
+// Optional priming data (see internal.GetPriming) is registered in the match tables
+// before the first chunk is processed. The same priming data must be
+// provided to decode.
 type rolzCodec1 struct {
 	matches      []uint32
 	counters     []int32
@@ -207,6 +236,7 @@ type rolzCodec1 struct {
 	posChecks    int32
 	minMatch     int
 	ctx          *map[string]any
+	priming      []byte
 }
 
 func newROLZCodec1(logPosChecks uint) (*rolzCodec1, error) {
@@ -237,9 +267,64 @@ func newROLZCodec1WithCtx(logPosChecks uint, ctx *map[string]any) (*rolzCodec1,
 	this.counters = make([]int32, 1<<16)
 	this.matches = make([]uint32, 0)
 	this.ctx = ctx
+
+	if ctx != nil {
+		this.priming = primingSuffix(internal.GetPriming(ctx), _ROLZ_MAX_PRIMING)
+	}
+
 	return this, nil
 }
 
+// registerPriming adds the positions of the priming data (at the start of
+// buf) to the match tables. The encoder also stores the hash of each position.
+func (this *rolzCodec1) registerPriming(buf []byte, delta int, hashed bool) {
+	for i := delta; i < len(this.priming); i++ {
+		var key uint32
+
+		if this.minMatch == _ROLZ_MIN_MATCH3 {
+			key = getKey1(buf[i-delta:])
+		} else {
+			key = getKey2(buf[i-delta:])
+		}
+
+		pos := uint32(i)
+
+		if hashed == true {
+			pos |= rolzhash(buf[i : i+4])
+		}
+
+		c := (this.counters[key] + 1) & this.maskChecks
+		this.matches[(key<<this.logPosChecks)+uint32(c)] = pos
+		this.counters[key] = c
+	}
+}
+
+// rolzMatchLength returns the length of the match (compared 4 bytes at a
+// time while shorter than maxMatch, hence possibly longer than maxMatch).
+// Both buffers must have at least maxMatch+4 bytes.
+func rolzMatchLength(refBuf, curBuf []byte, maxMatch int) int {
+	n := 0
+
+	// 8 bytes at a time while two 4 byte compares would be performed
+	for n+4 < maxMatch {
+		if diff := binary.LittleEndian.Uint64(refBuf[n:]) ^ binary.LittleEndian.Uint64(curBuf[n:]); diff != 0 {
+			return n + (bits.TrailingZeros64(diff) >> 3)
+		}
+
+		n += 8
+	}
+
+	for n < maxMatch {
+		if diff := binary.LittleEndian.Uint32(refBuf[n:]) ^ binary.LittleEndian.Uint32(curBuf[n:]); diff != 0 {
+			return n + (bits.TrailingZeros32(diff) >> 3)
+		}
+
+		n += 4
+	}
+
+	return n
+}
+
 // findMatch returns match position index (logPosChecks bits) + length (8 bits) or -1
 func (this *rolzCodec1) findMatch(buf []byte, pos int, hash32 uint32, counter int32, matches []uint32) (int, int) {
 	maxMatch := min(_ROLZ_MAX_MATCH1, len(buf)-pos)
@@ -269,16 +354,7 @@ func (this *rolzCodec1) findMatch(buf []byte, pos int, hash32 uint32, counter in
 			continue
 		}
 
-		n := 0
-
-		for n < maxMatch {
-			if diff := binary.LittleEndian.Uint32(refBuf[n:]) ^ binary.LittleEndian.Uint32(curBuf[n:]); diff != 0 {
-				n += (bits.TrailingZeros32(diff) >> 3)
-				break
-			}
-
-			n += 4
-		}
+		n := rolzMatchLength(refBuf, curBuf, maxMatch)
 
 		if n > bestLen {
 			bestIdx = int(i)
@@ -306,18 +382,28 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 	}
 
 	srcEnd := len(src) - 4
-	binary.BigEndian.PutUint32(dst[0:], uint32(len(src)))
-	sizeChunk := len(src)
+	header := uint32(len(src))
+	maxChunk := _ROLZ_CHUNK_SIZE
 
-	if sizeChunk > _ROLZ_CHUNK_SIZE {
-		sizeChunk = _ROLZ_CHUNK_SIZE
+	if len(this.priming) != 0 {
+		// Positions in the first chunk are shifted by the size of the priming data
+		header |= _ROLZ_PRIMING_FLAG
+		maxChunk -= _ROLZ_MAX_PRIMING
 	}
 
+	binary.BigEndian.PutUint32(dst[0:], header)
+	sizeChunk := min(len(src), maxChunk)
+
 	startChunk := 0
-	litBuf := make([]byte, this.MaxEncodedLen(sizeChunk))
-	lenBuf := make([]byte, sizeChunk/5)
-	mIdxBuf := make([]byte, sizeChunk/4)
-	tkBuf := make([]byte, sizeChunk/4)
+	pool := internal.DefaultBufferPool
+	litBuf := pool.GetBytes(this.MaxEncodedLen(sizeChunk))
+	lenBuf := pool.GetBytes(sizeChunk / 5)
+	mIdxBuf := pool.GetBytes(sizeChunk / 4)
+	tkBuf := pool.GetBytes(sizeChunk / 4)
+	defer pool.PutBytes(litBuf)
+	defer pool.PutBytes(lenBuf)
+	defer pool.PutBytes(mIdxBuf)
+	defer pool.PutBytes(tkBuf)
 	var err error
 
 	for i := range this.counters {
@@ -335,19 +421,15 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 	delta := 2
 
 	if this.ctx != nil {
-		dt := internal.DT_UNDEFINED
-
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt = val.(internal.DataType)
-		}
+		dt := internal.GetDataType(this.ctx)
 
 		if dt == internal.DT_UNDEFINED {
 			var freqs0 [256]int
-			internal.ComputeHistogram(src, freqs0[:], true, false)
+			internal.Histogram(this.ctx, src, freqs0[:])
 			dt = internal.DetectSimpleType(len(src), freqs0[:])
 
 			if dt != internal.DT_UNDEFINED {
-				(*this.ctx)["dataType"] = dt
+				internal.SetDataType(this.ctx, dt)
 			}
 		}
 
@@ -394,6 +476,18 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 
 		buf := src[startChunk:endChunk]
 		srcIdx = 0
+		prefix := 0
+
+		if startChunk == 0 && len(this.priming) != 0 {
+			// Keep the bytes after the chunk available (as with a slice of src)
+			prefix = len(this.priming)
+			buf = make([]byte, prefix+sizeChunk, prefix+sizeChunk+8)
+			copy(buf, this.priming)
+			copy(buf[prefix:cap(buf)], src[startChunk:min(endChunk+8, len(src))])
+			this.registerPriming(buf, delta, true)
+			srcIdx = prefix
+		}
+
 		n := min(srcEnd-startChunk, 8)
 
 		for j := 0; j < n; j++ {
@@ -406,7 +500,7 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		srcInc := 0
 
 		// Next chunk
-		for srcIdx < sizeChunk {
+		for srcIdx < prefix+sizeChunk {
 			var key uint32
 
 			if this.minMatch == _ROLZ_MIN_MATCH3 {
@@ -492,8 +586,8 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Emit last chunk literals
+		litLen := prefix + sizeChunk - firstLitIdx
 		srcIdx = sizeChunk
-		litLen := srcIdx - firstLitIdx
 
 		if tkIdx != 0 {
 			// At least one match to emit
@@ -613,20 +707,37 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 		return 0, 0, errors.New("ROLZ codec inverse transform failed: invalid input data (input array too small)")
 	}
 
-	dstEnd := int(binary.BigEndian.Uint32(src[0:])) - 4
+	header := binary.BigEndian.Uint32(src[0:])
+	dstEnd := int(header&^_ROLZ_PRIMING_FLAG) - 4
 
 	if dstEnd <= 0 || dstEnd > len(dst) {
 		return 0, 0, errors.New("ROLZ codec inverse transform failed: invalid input data")
 	}
 
+	primed := header&_ROLZ_PRIMING_FLAG != 0
+	maxChunk := _ROLZ_CHUNK_SIZE
+
+	if primed == true {
+		if len(this.priming) == 0 {
+			return 0, 0, errors.New("ROLZ codec inverse transform failed: missing priming data")
+		}
+
+		maxChunk -= _ROLZ_MAX_PRIMING
+	}
+
 	startChunk := 0
 	srcIdx := 5
 	dstIdx := 0
-	sizeChunk := min(len(dst), _ROLZ_CHUNK_SIZE)
-	litBuf := make([]byte, sizeChunk)
-	mLenBuf := make([]byte, sizeChunk/5)
-	mIdxBuf := make([]byte, sizeChunk/4)
-	tkBuf := make([]byte, sizeChunk/4)
+	sizeChunk := min(len(dst), maxChunk)
+	pool := internal.DefaultBufferPool
+	litBuf := pool.GetBytes(sizeChunk)
+	mLenBuf := pool.GetBytes(sizeChunk / 5)
+	mIdxBuf := pool.GetBytes(sizeChunk / 4)
+	tkBuf := pool.GetBytes(sizeChunk / 4)
+	defer pool.PutBytes(litBuf)
+	defer pool.PutBytes(mLenBuf)
+	defer pool.PutBytes(mIdxBuf)
+	defer pool.PutBytes(tkBuf)
 	var err error
 
 	for i := range this.counters {
@@ -695,6 +806,16 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 
 		sizeChunk = endChunk - startChunk
 		buf := dst[startChunk:endChunk]
+		prefix := 0
+
+		if startChunk == 0 && primed == true {
+			// Decode after a copy of the priming data
+			prefix = len(this.priming)
+			buf = make([]byte, prefix+sizeChunk, prefix+sizeChunk+8)
+			copy(buf, this.priming)
+			this.registerPriming(buf, delta, false)
+		}
+
 		onlyLiterals := false
 
 		// Scope to deallocate resources early
@@ -769,13 +890,13 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 
 		if onlyLiterals == true {
 			// Shortcut when no match
-			copy(buf[dstIdx:], litBuf[0:sizeChunk])
+			copy(dst[startChunk+dstIdx:endChunk], litBuf[0:sizeChunk])
 			startChunk = endChunk
 			dstIdx += sizeChunk
 			continue
 		}
 
-		dstIdx = 0
+		dstIdx = prefix
 		mm := 8
 
 		if bsVersion < 3 {
@@ -793,7 +914,7 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Next chunk
-		for dstIdx < sizeChunk {
+		for dstIdx < prefix+sizeChunk {
 			// mode LLLLLMMM -> L lit length, M match length
 			mode := tkBuf[tkIdx]
 			tkIdx++
@@ -816,7 +937,7 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			}
 
 			if litLen > 0 {
-				if dstIdx+litLen > len(litBuf) {
+				if dstIdx-prefix+litLen > len(litBuf) {
 					err = errors.New("ROLZ codec inverse transform failed: invalid data")
 					goto End
 				}
@@ -848,9 +969,9 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 				litIdx += litLen
 				dstIdx += litLen
 
-				if dstIdx >= sizeChunk {
+				if dstIdx >= prefix+sizeChunk {
 					// Last chunk literals not followed by match
-					if dstIdx == sizeChunk {
+					if dstIdx == prefix+sizeChunk {
 						break
 					}
 
@@ -860,7 +981,7 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			}
 
 			// Sanity check
-			if dstIdx+matchLen+this.minMatch > dstEnd {
+			if dstIdx-prefix+matchLen+this.minMatch > dstEnd {
 				err = errors.New("ROLZ codec inverse transform failed: invalid data")
 				goto End
 			}
@@ -883,6 +1004,11 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			m[this.counters[key]] = savedIdx
 		}
 
+		if prefix != 0 {
+			copy(dst[startChunk:endChunk], buf[prefix:])
+			dstIdx -= prefix
+		}
+
 		startChunk = endChunk
 	}
 
@@ -1043,16 +1169,7 @@ func (this *rolzCodec2) findMatch(buf []byte, pos int, key uint32) (int, int) {
 			continue
 		}
 
-		n := 0
-
-		for n < maxMatch {
-			if diff := binary.LittleEndian.Uint32(refBuf[n:]) ^ binary.LittleEndian.Uint32(curBuf[n:]); diff != 0 {
-				n += (bits.TrailingZeros32(diff) >> 3)
-				break
-			}
-
-			n += 4
-		}
+		n := rolzMatchLength(refBuf, curBuf, maxMatch)
 
 		if n > bestLen {
 			bestIdx = int(i)
@@ -1099,19 +1216,15 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 	flags := byte(0)
 
 	if this.ctx != nil {
-		dt := internal.DT_UNDEFINED
-
-		if val, containsKey := (*this.ctx)["dataType"]; containsKey {
-			dt = val.(internal.DataType)
-		}
+		dt := internal.GetDataType(this.ctx)
 
 		if dt == internal.DT_UNDEFINED {
 			var freqs0 [256]int
-			internal.ComputeHistogram(src, freqs0[:], true, false)
+			internal.Histogram(this.ctx, src, freqs0[:])
 			dt = internal.DetectSimpleType(len(src), freqs0[:])
 
 			if dt == internal.DT_UNDEFINED {
-				(*this.ctx)["dataType"] = dt
+				internal.SetDataType(this.ctx, dt)
 			}
 		}
 
@@ -1119,8 +1232,9 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 			delta = 3
 			flags |= 8
 		} else if dt == internal.DT_DNA {
+			delta = 8
 			this.minMatch = _ROLZ_MIN_MATCH7
-			flags = 1
+			flags |= 4
 		}
 	}
 
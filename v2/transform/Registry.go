@@ -0,0 +1,175 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/analysis"
+	"github.com/flanglet/kanzi-go/v2/internal"
+)
+
+// User defined transforms.
+// Applications can register their own transforms with a name and a type
+// in [USER_TYPE_MIN..USER_TYPE_MAX]. Once registered, a transform can be
+// used in sequences (EG. "MYCODEC+LZ") like the built-in transforms and the
+// type is stored in the bitstream: the decoder must register the same
+// transform with the same type. The context given to the factory is the
+// configuration of the stream, shared by the blocks of a task: the
+// transforms must not modify it (see DataType and SetDataType for the type
+// of the block data).
+
+const (
+	USER_TYPE_MIN = uint64(32) // first type available for user defined transforms
+	USER_TYPE_MAX = uint64(63) // last type available for user defined transforms
+)
+
+type registeredTransform struct {
+	name    string
+	typeID  uint64
+	factory func(ctx *map[string]any) (kanzi.ByteTransform, error)
+}
+
+var registry = struct {
+	lock    sync.RWMutex
+	entries []registeredTransform
+}{}
+
+// Register adds a user defined transform. The name (case insensitive) and
+// the type must not be used by another transform.
+func Register(name string, typeID uint64, factory func(ctx *map[string]any) (kanzi.ByteTransform, error)) error {
+	if factory == nil {
+		return errors.New("Invalid transform: missing constructor")
+	}
+
+	name = strings.ToUpper(name)
+
+	if name == "" || strings.ContainsAny(name, "+&") {
+		return fmt.Errorf("Invalid transform name: '%s'", name)
+	}
+
+	if typeID < USER_TYPE_MIN || typeID > USER_TYPE_MAX {
+		return fmt.Errorf("Invalid transform type: %d (must be in [%d..%d])", typeID, USER_TYPE_MIN, USER_TYPE_MAX)
+	}
+
+	if _, err := getByteFunctionTypeToken(name); err == nil {
+		return fmt.Errorf("Transform name already used: '%s'", name)
+	}
+
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, e := range registry.entries {
+		if e.name == name {
+			return fmt.Errorf("Transform name already used: '%s'", name)
+		}
+
+		if e.typeID == typeID {
+			return fmt.Errorf("Transform type already used: %d", typeID)
+		}
+	}
+
+	registry.entries = append(registry.entries, registeredTransform{name: name, typeID: typeID, factory: factory})
+	return nil
+}
+
+// Unregister removes the user defined transform with the provided name.
+// Returns true if it was found.
+func Unregister(name string) bool {
+	name = strings.ToUpper(name)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for i := range registry.entries {
+		if registry.entries[i].name == name {
+			registry.entries = append(registry.entries[:i], registry.entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// DataType returns the type of the block data processed by the transforms
+// created with the context (DT_UNDEFINED if unknown)
+func DataType(ctx *map[string]any) analysis.DataType {
+	return internal.GetDataType(ctx)
+}
+
+// SetDataType records the type of the block data for the next transforms
+// created with the context
+func SetDataType(ctx *map[string]any, dt analysis.DataType) {
+	internal.SetDataType(ctx, dt)
+}
+
+// findRegistered returns the user defined transform with the provided
+// type or name (if not empty)
+func findRegistered(typeID uint64, name string) (registeredTransform, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	for _, e := range registry.entries {
+		if (name == "" && e.typeID == typeID) || (name != "" && e.name == name) {
+			return e, true
+		}
+	}
+
+	return registeredTransform{}, false
+}
+
+func newUserToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, error) {
+	if e, ok := findRegistered(functionType, ""); ok == true {
+		return e.factory(ctx)
+	}
+
+	return nil, fmt.Errorf("Unknown transform type: '%d'", functionType)
+}
+
+func getUserFunctionNameToken(functionType uint64) (string, error) {
+	if e, ok := findRegistered(functionType, ""); ok == true {
+		return e.name, nil
+	}
+
+	return "", fmt.Errorf("Unknown transform type: '%d'", functionType)
+}
+
+func getUserFunctionTypeToken(name string) (uint64, error) {
+	if e, ok := findRegistered(0, name); ok == true {
+		return e.typeID, nil
+	}
+
+	return 0, fmt.Errorf("Unknown transform type: '%s'", name)
+}
+
+// Names returns the names of the available transforms: the built-in ones
+// followed by the registered ones
+func Names() []string {
+	res := []string{"TEXT", "BWT", "BWTS", "ROLZ", "ROLZX", "LZ", "LZX", "LZP", "UTF", "MM", "SRT",
+		"RANK", "MTFT", "ZRLT", "RLT", "EXE", "PACK", "DNA", "LRM", "JSON", "GENOMIC", "IMG", "UTF16", "NUMERIC",
+		"ST4", "ST6", "SPARSE"}
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	for _, e := range registry.entries {
+		res = append(res, e.name)
+	}
+
+	return res
+}
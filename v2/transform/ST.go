@@ -0,0 +1,276 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ST (Schindler Transform) of order k: the positions of the block are
+// sorted by their context (the k next symbols, the block being circular),
+// ties broken by position, and the symbol preceding each position is
+// emitted. It is a BWT with a bounded context: the forward transform is
+// k linear passes (radix sort) instead of a suffix sort, at the cost of a
+// slightly lower compression ratio, and it feeds the same second stage
+// (EG. ST4+SRT+ZRLT).
+// The inverse transform rebuilds the sorted contexts as ranks (k stable
+// counting sorts of the symbols) and walks the block backwards, each
+// context group being consumed from its last row.
+
+// ST stream format: Header (mode + primary index) | Data (n bytes)
+//   mode (8 bits): xxooooii
+//   oooo: order
+//   ii: primary index size - 1 (in bytes)
+
+const (
+	_ST_MIN_ORDER     = 1
+	_ST_MAX_ORDER     = 8
+	_ST_DEFAULT_ORDER = 4
+)
+
+// ST Schindler Transform (sort transform of order k)
+type ST struct {
+	order int
+}
+
+// NewST creates a new instance of ST with the provided order (context
+// size in [1..8])
+func NewST(order int) (*ST, error) {
+	if order < _ST_MIN_ORDER || order > _ST_MAX_ORDER {
+		return nil, fmt.Errorf("Invalid ST order: %d (must be in [%d..%d])", order, _ST_MIN_ORDER, _ST_MAX_ORDER)
+	}
+
+	return &ST{order: order}, nil
+}
+
+// NewSTWithCtx creates a new instance of ST using a configuration map as
+// parameter. The order is ctx["stOrder"] (4 by default).
+func NewSTWithCtx(ctx *map[string]any) (*ST, error) {
+	order := _ST_DEFAULT_ORDER
+
+	if val, containsKey := (*ctx)["stOrder"]; containsKey {
+		order = val.(int)
+	}
+
+	return NewST(order)
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *ST) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if n := this.MaxEncodedLen(len(src)); len(dst) < n {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	count := len(src)
+	sa := make([]int32, count)
+	tmp := make([]int32, count)
+
+	buckets := make([]int32, 65537)
+
+	for i := range sa {
+		sa[i] = int32(i)
+	}
+
+	// LSD radix sort of the positions by context (stable), 2 symbols per
+	// pass (the last symbol alone first if the order is odd)
+	for d := this.order; d > 0; {
+		width := 2 - d&1
+		d -= width
+		off0 := d % count
+		off1 := (d + width - 1) % count
+		digit := func(p int) int {
+			q0, q1 := p+off0, p+off1
+
+			if q0 >= count {
+				q0 -= count
+			}
+
+			if q1 >= count {
+				q1 -= count
+			}
+
+			return (int(src[q0])<<8 | int(src[q1])) >> (8 * (2 - width))
+		}
+
+		clear(buckets)
+
+		for p := 0; p < count; p++ {
+			buckets[digit(p)+1]++
+		}
+
+		for i := 1; i < len(buckets); i++ {
+			buckets[i] += buckets[i-1]
+		}
+
+		for _, p := range sa {
+			c := digit(int(p))
+			tmp[buckets[c]] = p
+			buckets[c]++
+		}
+
+		sa, tmp = tmp, sa
+	}
+
+	pIndexSize := 1
+
+	for count > 1<<(8*pIndexSize) {
+		pIndexSize++
+	}
+
+	headerSize := 1 + pIndexSize
+	out := dst[headerSize : headerSize+count]
+	primaryIndex := 0
+
+	for i, p := range sa {
+		if p == 0 {
+			primaryIndex = i
+			out[i] = src[count-1]
+		} else {
+			out[i] = src[p-1]
+		}
+	}
+
+	dst[0] = byte(this.order<<2 | (pIndexSize - 1))
+
+	for i, shift := 1, 8*(pIndexSize-1); shift >= 0; i, shift = i+1, shift-8 {
+		dst[i] = byte(primaryIndex >> uint(shift))
+	}
+
+	return uint(count), uint(headerSize + count), nil
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *ST) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	order := int(src[0]>>2) & 0x0F
+	pIndexSize := int(src[0]&0x03) + 1
+	headerSize := 1 + pIndexSize
+
+	if order < _ST_MIN_ORDER || order > _ST_MAX_ORDER || len(src) <= headerSize {
+		return 0, 0, errors.New("ST inverse transform failed: invalid header")
+	}
+
+	primaryIndex := 0
+
+	for i := 1; i < headerSize; i++ {
+		primaryIndex = primaryIndex<<8 | int(src[i])
+	}
+
+	data := src[headerSize:]
+	count := len(data)
+
+	if primaryIndex >= count {
+		return 0, 0, errors.New("ST inverse transform failed: invalid primary index")
+	}
+
+	if len(dst) < count {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), count)
+	}
+
+	// ranks[i]: rank of the context (of the current order) of row i. The
+	// rows are sorted by context, so that the sorted contexts of order m+1
+	// are the contexts of order m of the rows prefixed with the preceding
+	// symbol, sorted: perm, the stable counting sort of the rows by symbol,
+	// lists the rows by context of order m+1 for any m.
+	ranks := make([]int32, count)
+	perm := make([]int32, count)
+	next := make([]int32, count)
+	buckets := [257]int32{}
+
+	for _, c := range data {
+		buckets[int(c)+1]++
+	}
+
+	for i := 1; i < len(buckets); i++ {
+		buckets[i] += buckets[i-1]
+	}
+
+	positions := buckets
+
+	for j, c := range data {
+		perm[positions[c]] = int32(j)
+		positions[c]++
+	}
+
+	// The ranks of order 0 are all 0. The last pass stores the group of the
+	// context of the preceding position of each row (in place) and the last
+	// row of each group.
+	for m := 1; m <= order; m++ {
+		rank := int32(-1)
+
+		for c := 0; c < 256; c++ {
+			prevRank := int32(-1)
+
+			for i := buckets[c]; i < buckets[c+1]; i++ {
+				j := perm[i]
+
+				if ranks[j] != prevRank {
+					prevRank = ranks[j]
+					rank++
+				}
+
+				if m == order {
+					ranks[j] = rank
+					next[rank] = i
+				} else {
+					next[i] = rank
+				}
+			}
+		}
+
+		if m != order {
+			ranks, next = next, ranks
+		}
+	}
+
+	ends := next
+
+	// Walk backwards from position 0: within a group, the rows are sorted
+	// by position, so that the previous positions use the last free rows
+	for i, p := count-1, int32(primaryIndex); i >= 0; i-- {
+		dst[i] = data[p]
+		g := ranks[p]
+		p = ends[g]
+		ends[g]--
+	}
+
+	return uint(len(src)), uint(count), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this ST) MaxEncodedLen(srcLen int) int {
+	return srcLen + 5
+}
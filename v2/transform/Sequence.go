@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
 )
 
 const (
@@ -30,6 +31,9 @@ const (
 type ByteTransformSequence struct {
 	transforms []kanzi.ByteTransform // transforms or functions
 	skipFlags  byte                  // skip transforms
+	lengths    [8]uint               // output size of each transform
+	// State of the block shared by the transforms (nil if none)
+	scratch *internal.BlockScratch
 }
 
 // NewByteTransformSequence creates a new instance of NewByteTransformSequence
@@ -54,6 +58,19 @@ func NewByteTransformSequence(transforms []kanzi.ByteTransform) (*ByteTransformS
 // Returns number of bytes read, number of bytes
 // written and possibly an error.
 func (this *ByteTransformSequence) Forward(src, dst []byte) (uint, uint, error) {
+	return this.forward(src, dst, src)
+}
+
+// ForwardKeepInput applies the transforms like Forward but does not write
+// to src: work is used for the intermediate data instead (a larger buffer
+// is allocated if it is smaller than MaxEncodedLen(len(src))).
+func (this *ByteTransformSequence) ForwardKeepInput(src, dst, work []byte) (uint, uint, error) {
+	return this.forward(src, dst, work)
+}
+
+// forward applies the transforms to src, alternating between dst and work
+// for the intermediate data, and writes the result to dst
+func (this *ByteTransformSequence) forward(src, dst, work []byte) (uint, uint, error) {
 	this.skipFlags = _TRANSFORM_SKIP_MASK
 
 	if len(src) == 0 {
@@ -93,11 +110,20 @@ func (this *ByteTransformSequence) Forward(src, dst []byte) (uint, uint, error)
 			// Transform failed. Either it does not apply to this type
 			// of data or a recoverable error occurred => revert
 			length = savedLength
+			this.lengths[i] = length
 			continue
 		}
 
+		this.lengths[i] = length
 		this.skipFlags &= ^(1 << (7 - uint(i)))
-		in, out = out, in
+		this.scratch.InvalidateHistogram()
+
+		if swaps == 0 {
+			in, out = out, work
+		} else {
+			in, out = out, in
+		}
+
 		swaps++
 
 		if i == this.Len()-1 {
@@ -203,6 +229,12 @@ func (this *ByteTransformSequence) SkipFlags() byte {
 	return this.skipFlags
 }
 
+// Lengths returns the size of the data after each function of the sequence
+// during the last call to Forward (unchanged for the skipped functions)
+func (this *ByteTransformSequence) Lengths() []uint {
+	return this.lengths[0:len(this.transforms)]
+}
+
 // SetSkipFlags sets the flags describing which function to skip
 func (this *ByteTransformSequence) SetSkipFlags(flags byte) bool {
 	this.skipFlags = flags
@@ -0,0 +1,294 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Transform sequences with per stage options.
+// A SequenceBuilder assembles the stages of a sequence (up to 8 transforms)
+// with typed options. The options only used by the forward transforms are
+// set in the context: the transforms record their choices in their output.
+// The options the inverse transforms depend on (EG. the TEXT variant) are
+// packed in a uint64 (8 bits per stage, in the order of the transform
+// types, see Params), to be stored with the data and provided to
+// NewWithParams when decoding. A parameter of 0 selects the default.
+
+const (
+	_SEQ_PARAM_SHIFT     = 8
+	_SEQ_PARAM_MAX_SHIFT = (8 - 1) * _SEQ_PARAM_SHIFT
+)
+
+// StageOptions the options of a stage of a sequence (see TextOptions,
+// ROLZOptions, LZOptions and RLTOptions)
+type StageOptions interface {
+	// accepts returns true if the options apply to the transform type
+	accepts(functionType uint64) bool
+
+	// validate returns an error if an option is invalid
+	validate() error
+
+	// apply sets the options of the forward transform in the context
+	apply(ctx map[string]any)
+
+	// param returns the parameter needed by the inverse transform
+	param() byte
+}
+
+// TextOptions the options of the TEXT transform
+type TextOptions struct {
+	Variant int // 1 (large dictionary) or 2 (escaped words), selected from the entropy codec if 0
+}
+
+// ROLZOptions the options of the ROLZ and ROLZX transforms
+type ROLZOptions struct {
+	LogPosChecks uint // log2 of the match positions checked, in [2..8], default if 0
+}
+
+// LZOptions the options of the LZ and LZX transforms
+type LZOptions struct {
+	MinMatch    uint // minimum match length, 4 or 9, selected from the data type if 0
+	SmallWindow bool // 64 KB window (always used for small blocks)
+	Level       uint // match finder in [1..5] (see LZMatchFinder.go), 2 if 0
+}
+
+// RLTOptions the options of the RLT transform
+type RLTOptions struct {
+	Stride uint // size of the repeated units, 1, 2 or 4, detected if 0
+}
+
+func (this TextOptions) accepts(functionType uint64) bool {
+	return functionType == DICT_TYPE
+}
+
+func (this TextOptions) validate() error {
+	if this.Variant < 0 || this.Variant > 2 {
+		return fmt.Errorf("Invalid TEXT variant: %d (must be 1 or 2)", this.Variant)
+	}
+
+	return nil
+}
+
+func (this TextOptions) apply(ctx map[string]any) {
+}
+
+func (this TextOptions) param() byte {
+	return byte(this.Variant)
+}
+
+func (this ROLZOptions) accepts(functionType uint64) bool {
+	return functionType == ROLZ_TYPE || functionType == ROLZX_TYPE
+}
+
+func (this ROLZOptions) validate() error {
+	if this.LogPosChecks != 0 && (this.LogPosChecks < 2 || this.LogPosChecks > 8) {
+		return fmt.Errorf("Invalid ROLZ logPosChecks: %d (must be in [2..8])", this.LogPosChecks)
+	}
+
+	return nil
+}
+
+func (this ROLZOptions) apply(ctx map[string]any) {
+}
+
+func (this ROLZOptions) param() byte {
+	return byte(this.LogPosChecks)
+}
+
+func (this LZOptions) accepts(functionType uint64) bool {
+	return functionType == LZ_TYPE || functionType == LZX_TYPE
+}
+
+func (this LZOptions) validate() error {
+	if this.MinMatch != 0 && this.MinMatch != _LZX_MIN_MATCH4 && this.MinMatch != _LZX_MIN_MATCH9 {
+		return fmt.Errorf("Invalid LZ minimum match: %d (must be %d or %d)", this.MinMatch, _LZX_MIN_MATCH4, _LZX_MIN_MATCH9)
+	}
+
+	if this.Level > _LZX_LEVEL_MAX {
+		return fmt.Errorf("Invalid LZ level: %d (must be in [1..%d])", this.Level, _LZX_LEVEL_MAX)
+	}
+
+	return nil
+}
+
+func (this LZOptions) apply(ctx map[string]any) {
+	if this.MinMatch != 0 {
+		ctx["lzMinMatch"] = this.MinMatch
+	}
+
+	if this.SmallWindow == true {
+		ctx["lzSmallWindow"] = true
+	}
+
+	if this.Level != 0 {
+		ctx["lzLevel"] = this.Level
+	}
+}
+
+func (this LZOptions) param() byte {
+	return 0
+}
+
+func (this RLTOptions) accepts(functionType uint64) bool {
+	return functionType == RLT_TYPE
+}
+
+func (this RLTOptions) validate() error {
+	if this.Stride > 4 || this.Stride == 3 {
+		return fmt.Errorf("Invalid RLT stride: %d (must be 1, 2 or 4)", this.Stride)
+	}
+
+	return nil
+}
+
+func (this RLTOptions) apply(ctx map[string]any) {
+	if this.Stride != 0 {
+		ctx["rltStride"] = this.Stride
+	}
+}
+
+func (this RLTOptions) param() byte {
+	return 0
+}
+
+// SequenceBuilder builds a transform sequence stage by stage
+type SequenceBuilder struct {
+	types   []uint64
+	options []StageOptions
+	err     error
+}
+
+// NewSequenceBuilder creates a new instance of SequenceBuilder
+func NewSequenceBuilder() *SequenceBuilder {
+	return &SequenceBuilder{}
+}
+
+// Add appends a stage: the transform name (EG. "ROLZX") and its options
+// (nil for the defaults). The first error is reported by Type and Build.
+func (this *SequenceBuilder) Add(name string, options StageOptions) *SequenceBuilder {
+	if this.err != nil {
+		return this
+	}
+
+	if len(this.types) == 8 {
+		this.err = errors.New("Only 8 transforms allowed")
+		return this
+	}
+
+	if strings.ContainsAny(name, "+&") {
+		this.err = fmt.Errorf("Invalid transform name: '%s' (one stage expected)", name)
+		return this
+	}
+
+	t, err := getByteFunctionTypeToken(name)
+
+	if err != nil {
+		this.err = err
+		return this
+	}
+
+	if options != nil {
+		if options.accepts(t) == false {
+			this.err = fmt.Errorf("Invalid options for transform '%s': %T", name, options)
+			return this
+		}
+
+		if err = options.validate(); err != nil {
+			this.err = err
+			return this
+		}
+
+		// The options are shared by the stages of the same type
+		for i := range this.types {
+			if this.options[i] != nil && options.accepts(this.types[i]) == true {
+				this.err = fmt.Errorf("Options already provided for transform '%s'", name)
+				return this
+			}
+		}
+	}
+
+	this.types = append(this.types, t)
+	this.options = append(this.options, options)
+	return this
+}
+
+// Type returns the packed transform types of the sequence (see GetType)
+func (this *SequenceBuilder) Type() (uint64, error) {
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	res := uint64(0)
+
+	for i, t := range this.types {
+		res |= t << (_BFF_MAX_SHIFT - _BFF_ONE_SHIFT*uint(i))
+	}
+
+	return res, nil
+}
+
+// Name returns the name of the sequence (EG. "TEXT+ROLZX")
+func (this *SequenceBuilder) Name() (string, error) {
+	t, err := this.Type()
+
+	if err != nil {
+		return "", err
+	}
+
+	return GetName(t)
+}
+
+// Params returns the packed parameters of the inverse transforms (0 if
+// they all use the defaults)
+func (this *SequenceBuilder) Params() uint64 {
+	res := uint64(0)
+
+	for i, o := range this.options {
+		if o != nil {
+			res |= uint64(o.param()) << (_SEQ_PARAM_MAX_SHIFT - _SEQ_PARAM_SHIFT*uint(i))
+		}
+	}
+
+	return res
+}
+
+// Apply sets the options of the forward transforms in the context
+func (this *SequenceBuilder) Apply(ctx map[string]any) {
+	for _, o := range this.options {
+		if o != nil {
+			o.apply(ctx)
+		}
+	}
+}
+
+// Build creates the transform sequence with the options of the stages
+func (this *SequenceBuilder) Build(ctx *map[string]any) (*ByteTransformSequence, error) {
+	t, err := this.Type()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(this.types) == 0 {
+		return nil, errors.New("Empty transform sequence")
+	}
+
+	this.Apply(*ctx)
+	return NewWithParams(ctx, t, this.Params())
+}
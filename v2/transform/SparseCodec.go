@@ -0,0 +1,278 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	_SPARSE_PAGE_LOG       = 12 // 4 KB pages
+	_SPARSE_PAGE_SIZE      = 1 << _SPARSE_PAGE_LOG
+	_SPARSE_EXTENT_LITERAL = 0
+	_SPARSE_EXTENT_ZERO    = 1
+	_SPARSE_EXTENT_REPEAT  = 2
+	_SPARSE_HASH_SAMPLES   = 32 // words hashed per page
+	_SPARSE_CHAIN_DEPTH    = 16 // pages compared per hash bucket
+)
+
+var sparseZeroPage [_SPARSE_PAGE_SIZE]byte
+
+// SparseCodec a transform for sparse data (EG. VM images, database files):
+// the block is split into 4 KB pages and the runs of zero pages and of pages
+// identical to previous pages of the block are encoded as extents. Only the
+// other pages (and the trailing incomplete page) are passed downstream.
+// Format: page log (8 bits), number of extents (varint), extents, literal
+// pages, trailing bytes.
+// An extent is a varint (count << 2 | kind) followed, for the repeat
+// extents, by the distance (in pages) to the first copied page (varint).
+type SparseCodec struct {
+}
+
+type sparseExtent struct {
+	kind  int
+	count int
+	dist  int
+}
+
+// NewSparseCodec creates a new instance of SparseCodec
+func NewSparseCodec() (*SparseCodec, error) {
+	return &SparseCodec{}, nil
+}
+
+// NewSparseCodecWithCtx creates a new instance of SparseCodec using a
+// configuration map as parameter.
+func NewSparseCodecWithCtx(ctx *map[string]any) (*SparseCodec, error) {
+	return &SparseCodec{}, nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+// (the forward transform fails if the output is not smaller than the input)
+func (this *SparseCodec) MaxEncodedLen(srcLen int) int {
+	return srcLen
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *SparseCodec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	pages := count >> _SPARSE_PAGE_LOG
+
+	if pages == 0 {
+		return 0, 0, errors.New("SPARSE forward transform skip: block too small")
+	}
+
+	// Pages by hash of a sample of their words (index + 1, most recent),
+	// chained to the previous page with the same bucket
+	hashLog := 1
+
+	for 1<<hashLog < 2*pages {
+		hashLog++
+	}
+
+	table := make([]int32, 1<<hashLog)
+	chain := make([]int32, pages)
+	hashes := make([]uint64, pages)
+	extents := make([]sparseExtent, 0, 16)
+	sparsePages := 0
+
+	for p := 0; p < pages; p++ {
+		page := src[p<<_SPARSE_PAGE_LOG : (p+1)<<_SPARSE_PAGE_LOG]
+		kind, dist := _SPARSE_EXTENT_LITERAL, 0
+
+		if bytes.Equal(page, sparseZeroPage[:]) == true {
+			kind = _SPARSE_EXTENT_ZERO
+		} else {
+			hashes[p] = hashPage(page)
+			h := hashes[p] >> (64 - hashLog)
+
+			for ref, depth := int(table[h])-1, 0; ref >= 0 && depth < _SPARSE_CHAIN_DEPTH; ref, depth = int(chain[ref])-1, depth+1 {
+				if hashes[ref] == hashes[p] && bytes.Equal(page, src[ref<<_SPARSE_PAGE_LOG:(ref+1)<<_SPARSE_PAGE_LOG]) == true {
+					kind, dist = _SPARSE_EXTENT_REPEAT, p-ref
+					break
+				}
+			}
+
+			chain[p] = table[h]
+			table[h] = int32(p + 1)
+		}
+
+		if kind != _SPARSE_EXTENT_LITERAL {
+			sparsePages++
+		}
+
+		if n := len(extents); n > 0 && extents[n-1].kind == kind && extents[n-1].dist == dist {
+			extents[n-1].count++
+		} else {
+			extents = append(extents, sparseExtent{kind: kind, count: 1, dist: dist})
+		}
+	}
+
+	if sparsePages == 0 {
+		return 0, 0, errors.New("SPARSE forward transform skip: no sparse page")
+	}
+
+	// Each sparse extent saves at least one page, the header fits in dst
+	dst[0] = _SPARSE_PAGE_LOG
+	dstIdx := 1 + binary.PutUvarint(dst[1:], uint64(len(extents)))
+
+	for _, e := range extents {
+		dstIdx += binary.PutUvarint(dst[dstIdx:], uint64(e.count<<2|e.kind))
+
+		if e.kind == _SPARSE_EXTENT_REPEAT {
+			dstIdx += binary.PutUvarint(dst[dstIdx:], uint64(e.dist))
+		}
+	}
+
+	if dstIdx+count-sparsePages<<_SPARSE_PAGE_LOG >= count {
+		return 0, 0, errors.New("SPARSE forward transform skip: no improvement")
+	}
+
+	srcIdx := 0
+
+	for _, e := range extents {
+		n := e.count << _SPARSE_PAGE_LOG
+
+		if e.kind == _SPARSE_EXTENT_LITERAL {
+			dstIdx += copy(dst[dstIdx:], src[srcIdx:srcIdx+n])
+		}
+
+		srcIdx += n
+	}
+
+	dstIdx += copy(dst[dstIdx:], src[srcIdx:])
+	return uint(count), uint(dstIdx), nil
+}
+
+// hashPage returns a hash of a sample of the words of the page
+func hashPage(page []byte) uint64 {
+	h := uint64(0)
+
+	for i := 0; i < len(page); i += len(page) / _SPARSE_HASH_SAMPLES {
+		h = (h + binary.LittleEndian.Uint64(page[i:])) * 0x9E3779B97F4A7C15
+	}
+
+	return h
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *SparseCodec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if src[0] != _SPARSE_PAGE_LOG {
+		return 0, 0, errors.New("SPARSE inverse transform failed: invalid header")
+	}
+
+	nbExtents, k := binary.Uvarint(src[1:])
+
+	if k <= 0 || nbExtents > uint64(len(src)) {
+		return 0, 0, errors.New("SPARSE inverse transform failed: invalid number of extents")
+	}
+
+	srcIdx := 1 + k
+	maxPages := uint64(len(dst) >> _SPARSE_PAGE_LOG)
+	extents := make([]sparseExtent, nbExtents)
+
+	for i := range extents {
+		val, k := binary.Uvarint(src[srcIdx:])
+
+		if k <= 0 || val>>2 == 0 || val>>2 > maxPages || val&3 > _SPARSE_EXTENT_REPEAT {
+			return 0, 0, errors.New("SPARSE inverse transform failed: invalid extent")
+		}
+
+		srcIdx += k
+		extents[i] = sparseExtent{kind: int(val & 3), count: int(val >> 2)}
+
+		if extents[i].kind == _SPARSE_EXTENT_REPEAT {
+			if val, k = binary.Uvarint(src[srcIdx:]); k <= 0 || val == 0 || val > maxPages {
+				return 0, 0, errors.New("SPARSE inverse transform failed: invalid extent")
+			}
+
+			srcIdx += k
+			extents[i].dist = int(val)
+		}
+	}
+
+	literals := src[srcIdx:]
+	dstIdx := 0
+
+	for _, e := range extents {
+		n := e.count << _SPARSE_PAGE_LOG
+
+		if dstIdx+n > len(dst) {
+			return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), dstIdx+n)
+		}
+
+		switch e.kind {
+		case _SPARSE_EXTENT_LITERAL:
+			if n > len(literals) {
+				return 0, 0, errors.New("SPARSE inverse transform failed: missing literal pages")
+			}
+
+			copy(dst[dstIdx:], literals[0:n])
+			literals = literals[n:]
+
+		case _SPARSE_EXTENT_ZERO:
+			clear(dst[dstIdx : dstIdx+n])
+
+		case _SPARSE_EXTENT_REPEAT:
+			ref := dstIdx - e.dist<<_SPARSE_PAGE_LOG
+
+			if ref < 0 {
+				return 0, 0, errors.New("SPARSE inverse transform failed: invalid page reference")
+			}
+
+			// Page by page: the source may overlap the extent
+			for i := 0; i < n; i += _SPARSE_PAGE_SIZE {
+				copy(dst[dstIdx+i:dstIdx+i+_SPARSE_PAGE_SIZE], dst[ref+i:])
+			}
+		}
+
+		dstIdx += n
+	}
+
+	if len(literals) >= _SPARSE_PAGE_SIZE || dstIdx+len(literals) > len(dst) {
+		return 0, 0, errors.New("SPARSE inverse transform failed: invalid trailing bytes")
+	}
+
+	dstIdx += copy(dst[dstIdx:], literals)
+	return uint(len(src)), uint(dstIdx), nil
+}
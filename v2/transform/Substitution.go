@@ -0,0 +1,216 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Decode time substitution of transforms.
+// A stream written with an old bitstream version may reference a transform
+// variant that is deprecated or has a faster equivalent. A substitution
+// routes the inverse transform of such blocks through a compatibility
+// implementation selected at runtime, based on the transform type and the
+// bitstream version found in the stream header.
+// Substitutions are only considered when the context contains the key
+// 'substitutions' set to true (the Reader does it by default). The names of
+// the substitutions used are recorded in the block scratch of the context
+// (see internal.BlockScratch).
+// Built-in substitution: LZP-V3 (LZP blocks of bitstream versions up to 3).
+
+// Substitution describes a compatibility implementation of a transform
+type Substitution struct {
+	Name       string // reported to observers
+	Type       uint64 // transform type (EG. DICT_TYPE)
+	MinVersion uint   // first bitstream version handled
+	MaxVersion uint   // last bitstream version handled
+	Create     func(ctx *map[string]any) (kanzi.ByteTransform, error)
+}
+
+// Built-in substitutions (see lzpV3Codec)
+var substitutions = struct {
+	lock    sync.RWMutex
+	entries []Substitution
+}{entries: []Substitution{
+	{Name: "LZP-V3", Type: LZP_TYPE, MinVersion: 0, MaxVersion: 3, Create: newLZPV3Codec},
+}}
+
+// RegisterSubstitution adds a substitution. The most recently registered
+// substitution wins when several match the same transform and version.
+func RegisterSubstitution(s Substitution) error {
+	if s.Name == "" || s.Create == nil {
+		return errors.New("Invalid substitution: missing name or constructor")
+	}
+
+	if s.Type == NONE_TYPE || s.Type > _BFF_MASK {
+		return fmt.Errorf("Invalid substitution transform type: %d", s.Type)
+	}
+
+	if s.MinVersion > s.MaxVersion {
+		return fmt.Errorf("Invalid substitution bitstream version range: [%d..%d]", s.MinVersion, s.MaxVersion)
+	}
+
+	substitutions.lock.Lock()
+	substitutions.entries = append(substitutions.entries, s)
+	substitutions.lock.Unlock()
+	return nil
+}
+
+// UnregisterSubstitution removes the substitution with the provided name.
+// Returns true if it was found.
+func UnregisterSubstitution(name string) bool {
+	substitutions.lock.Lock()
+	defer substitutions.lock.Unlock()
+
+	for i := range substitutions.entries {
+		if substitutions.entries[i].Name == name {
+			substitutions.entries = append(substitutions.entries[:i], substitutions.entries[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// findSubstitution returns the substitution matching the transform type
+// and the bitstream version in the context or nil.
+func findSubstitution(ctx *map[string]any, functionType uint64) *Substitution {
+	if val, containsKey := (*ctx)["substitutions"]; containsKey == false || val.(bool) == false {
+		return nil
+	}
+
+	val, containsKey := (*ctx)["bsVersion"]
+
+	if containsKey == false {
+		return nil
+	}
+
+	bsVersion := val.(uint)
+	substitutions.lock.RLock()
+	defer substitutions.lock.RUnlock()
+
+	for i := len(substitutions.entries) - 1; i >= 0; i-- {
+		s := &substitutions.entries[i]
+
+		if s.Type == functionType && bsVersion >= s.MinVersion && bsVersion <= s.MaxVersion {
+			res := *s
+			return &res
+		}
+	}
+
+	return nil
+}
+
+// lzpV3Codec decodes the LZP blocks of streams written with bitstream
+// versions up to 3 (minimum match length of 96 instead of 64). Unlike
+// LZPCodec, it does not check the version for each block and it copies the
+// overlapping matches by chunks (of the match distance) instead of byte by
+// byte. Decoding only.
+type lzpV3Codec struct {
+	hashes []int32
+}
+
+func newLZPV3Codec(ctx *map[string]any) (kanzi.ByteTransform, error) {
+	return &lzpV3Codec{hashes: make([]int32, 1<<_LZP_HASH_LOG)}, nil
+}
+
+// Forward fails: the legacy format is never written
+func (this *lzpV3Codec) Forward(src, dst []byte) (uint, uint, error) {
+	return 0, 0, errors.New("LZP forward transform failed: the bitstream version 3 format is decode only")
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *lzpV3Codec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if len(src) < 4 || len(dst) < 4 {
+		return 0, 0, errors.New("LZP inverse transform failed: block too small")
+	}
+
+	clear(this.hashes)
+	srcEnd := len(src)
+	copy(dst, src[0:4])
+	ctx := binary.LittleEndian.Uint32(dst)
+	srcIdx := 4
+	dstIdx := 4
+
+	for srcIdx < srcEnd {
+		h := (_LZP_HASH_SEED * ctx) >> _LZP_HASH_SHIFT
+		ref := int(this.hashes[h])
+		this.hashes[h] = int32(dstIdx)
+
+		if dstIdx >= len(dst) {
+			return uint(srcIdx), uint(dstIdx), errors.New("LZP inverse transform failed: output buffer too small")
+		}
+
+		if ref == 0 || src[srcIdx] != _LZP_MATCH_FLAG {
+			dst[dstIdx] = src[srcIdx]
+			ctx = (ctx << 8) | uint32(dst[dstIdx])
+			srcIdx++
+			dstIdx++
+			continue
+		}
+
+		srcIdx++
+
+		if srcIdx < srcEnd && src[srcIdx] == 0xFF {
+			// Escaped flag
+			dst[dstIdx] = _LZP_MATCH_FLAG
+			ctx = (ctx << 8) | uint32(_LZP_MATCH_FLAG)
+			srcIdx++
+			dstIdx++
+			continue
+		}
+
+		mLen := _LZP_MIN_MATCH96
+
+		for srcIdx < srcEnd && src[srcIdx] == 0xFE {
+			srcIdx++
+			mLen += 254
+		}
+
+		if srcIdx >= srcEnd || dstIdx+mLen+int(src[srcIdx]) > len(dst) {
+			return uint(srcIdx), uint(dstIdx), errors.New("LZP inverse transform failed: invalid data")
+		}
+
+		mLen += int(src[srcIdx])
+		srcIdx++
+
+		// The match may overlap the output: copy by chunks of the distance
+		for n := 0; n < mLen; {
+			n += copy(dst[dstIdx+n:dstIdx+mLen], dst[ref+n:dstIdx+n])
+		}
+
+		dstIdx += mLen
+		ctx = binary.LittleEndian.Uint32(dst[dstIdx-4:])
+	}
+
+	return uint(srcIdx), uint(dstIdx), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this *lzpV3Codec) MaxEncodedLen(srcLen int) int {
+	return srcLen
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Stable public wrappers around DivSufSort to reuse the suffix array and BWT
+// machinery (EG. for indexing or deduplication) outside of the compression
+// pipeline.
+
+// SuffixArray computes the suffix array of src: the starting positions of
+// the suffixes of src in lexicographic order.
+// The size of src must be in [1..1 GB].
+func SuffixArray(src []byte) ([]int32, error) {
+	if len(src) == 0 {
+		return nil, errors.New("Invalid empty input")
+	}
+
+	if len(src) > _BWT_MAX_BLOCK_SIZE {
+		return nil, fmt.Errorf("The max suffix array input size is %d, got %d", _BWT_MAX_BLOCK_SIZE, len(src))
+	}
+
+	sa := make([]int32, len(src))
+
+	if len(src) == 1 {
+		return sa, nil
+	}
+
+	saAlgo, err := NewDivSufSort()
+
+	if err != nil {
+		return nil, err
+	}
+
+	saAlgo.ComputeSuffixArray(src, sa)
+	return sa, nil
+}
+
+// BWTTransform computes the Burrows-Wheeler transform of src in one chunk and
+// writes it to dst. Returns the primary index (the rank of the whole input
+// among its suffixes, plus one). See the description of the BWT for details.
+// The size of src must be in [1..1 GB], dst must be at least as big as src
+// and the two slices cannot start at the same address.
+func BWTTransform(src, dst []byte) (primaryIndex int, err error) {
+	if len(src) == 0 {
+		return 0, errors.New("Invalid empty input")
+	}
+
+	if len(src) > _BWT_MAX_BLOCK_SIZE {
+		return 0, fmt.Errorf("The max BWT block size is %d, got %d", _BWT_MAX_BLOCK_SIZE, len(src))
+	}
+
+	if len(dst) < len(src) {
+		return 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), len(src))
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	if len(src) == 1 {
+		dst[0] = src[0]
+		return 1, nil
+	}
+
+	saAlgo, err := NewDivSufSort()
+
+	if err != nil {
+		return 0, err
+	}
+
+	indexes := []uint{0}
+	buf := make([]int32, len(src))
+	return int(saAlgo.ComputeBWT(src, dst, buf, indexes, 1)), nil
+}
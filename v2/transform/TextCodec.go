@@ -18,6 +18,7 @@ package transform
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
 	internal "github.com/flanglet/kanzi-go/v2/internal"
@@ -41,12 +42,28 @@ const (
 	_TC_ESCAPE_TOKEN1   = byte(0x0F) // dictionary word preceded by space symbol
 	_TC_ESCAPE_TOKEN2   = byte(0x0E) // toggle upper/lower case of first word char
 	_TC_MASK_NOT_TEXT   = 0x80
+	_TC_MASK_UNICODE    = 0x80 // emitted in place of _TC_MASK_NOT_TEXT: UTF-8 letters in words
 	_TC_MASK_CRLF       = 0x40
 	_TC_MASK_XML_HTML   = 0x20
+	_TC_MASK_JSON       = 0x10 // not emitted
+	_TC_MASK_ADAPTIVE   = 0x10 // emitted in place of _TC_MASK_JSON: adaptive hash size
 	_TC_MASK_DT         = 0x0F
+	_TC_MASK_DICT       = 0x0F               // emitted in place of _TC_MASK_DT: static dictionary
 	_TC_MASK_LENGTH     = 0x0007FFFF         // 19 bits
 	_TC_HASH1           = int32(2146121005)  // 0x7FEB352D
 	_TC_HASH2           = int32(-2073254261) // 0x846CA68B
+	_TC_CHECK_SIZE      = 64 * 1024          // input size processed before checking the hit rate
+	_TC_MIN_HIT_RATE    = 10                 // min percentage of input replaced by dictionary words
+	_TC_HASH_CHECK_SIZE = 1024               // new words between two checks of the collision rate
+	_TC_MAX_COLLISIONS  = 5                  // max percentage of words not added because of hash collisions
+	_TC_LOG_HASH_DELTA  = 2                  // range of the adaptive hash size around the default size
+	_TC_LANG_AUTO       = -1                 // static dictionary selected from the symbol frequencies
+	_TC_LANG_EN         = 0
+	_TC_LANG_FR         = 1
+	_TC_LANG_DE         = 2
+	_TC_LANG_ES         = 3
+	_TC_LANG_PT         = 4
+	_TC_LANG_CODE       = 5
 )
 
 type dictEntry struct {
@@ -57,6 +74,22 @@ type dictEntry struct {
 
 // TextCodec is a simple one-pass text codec that replaces words with indexes.
 // Uses a default (small) static dictionary. Generates a dynamic dictionary.
+// Since bitstream version 7, the hash map of the dictionary starts smaller
+// than the default size (derived from the block size) and doubles when too
+// many new words cannot be added because of hash collisions. The decoder
+// sees the same additions and collisions, hence resizes the map at the same
+// positions.
+// Since bitstream version 7, the UTF-8 sequences of letters (Latin, Greek,
+// Cyrillic, Armenian, Hebrew, Arabic, Devanagari, Georgian, Hangul, see
+// _TC_UTF8_LETTER_RANGES) are word characters. The first codec emits them
+// as is. The second codec emits them unescaped inside a word and after an
+// _TC_ESCAPE_TOKEN2 marker at the start of a word (the raw 0x0E symbol is
+// escaped instead).
+// Since bitstream version 7, the static dictionary is selected with
+// ctx["lang"]: "en", "fr", "de", "es", "pt", "code" (keywords and identifiers
+// of programming languages) or "auto" (default: detected from the frequencies
+// of the accented letters and of the symbols of source code). The dictionary
+// of each block is stored in the mode byte.
 type TextCodec struct {
 	delegate kanzi.ByteTransform
 }
@@ -70,6 +103,15 @@ type textCodec1 struct {
 	hashMask       int32
 	isCRLF         bool // EOL = CR+LF ?
 	ctx            *map[string]any
+	baseLogHash    uint // default hash size
+	maxLogHash     uint // max adaptive hash size
+	adaptiveHash   bool // encode with an adaptive hash size (bitstream version 7)
+	growHash       bool // adaptive hash size for the current block
+	hashAdds       int  // words added to the dictionary since the last check
+	hashCollisions int  // words not added because of a hash collision since the last check
+	unicodeWords   bool // encode UTF-8 letters as word characters (bitstream version 7)
+	utf8Words      bool // UTF-8 letters are word characters in the current block
+	lang           int  // static dictionary or _TC_LANG_AUTO (bitstream version 7)
 }
 
 type textCodec2 struct {
@@ -81,12 +123,50 @@ type textCodec2 struct {
 	hashMask       int32
 	isCRLF         bool // EOL = CR+LF ?
 	ctx            *map[string]any
+	baseLogHash    uint // default hash size
+	maxLogHash     uint // max adaptive hash size
+	adaptiveHash   bool // encode with an adaptive hash size (bitstream version 7)
+	growHash       bool // adaptive hash size for the current block
+	hashAdds       int  // words added to the dictionary since the last check
+	hashCollisions int  // words not added because of a hash collision since the last check
+	unicodeWords   bool // encode UTF-8 letters as word characters (bitstream version 7)
+	utf8Words      bool // UTF-8 letters are word characters in the current block
+	lang           int  // static dictionary or _TC_LANG_AUTO (bitstream version 7)
 }
 
 var (
 	_TC_STATIC_DICTIONARY = [1024]dictEntry{}
 	_TC_STATIC_DICT_WORDS = createDictionary(_TC_DICT_EN_1024, _TC_STATIC_DICTIONARY[:], 1024, 0)
 	_TC_DELIMITER_CHARS   = initDelimiterChars()
+	_TC_UTF8_LETTERS      = initUTF8Letters()
+	_TC_LANG_NAMES        = []string{"en", "fr", "de", "es", "pt", "code"}
+
+	// Static dictionaries indexed by language (see _TC_LANG_NAMES)
+	_TC_STATIC_DICTIONARIES = [][]dictEntry{
+		_TC_STATIC_DICTIONARY[0:_TC_STATIC_DICT_WORDS],
+		createWordList(_TC_DICT_FR),
+		createWordList(_TC_DICT_DE),
+		createWordList(_TC_DICT_ES),
+		createWordList(_TC_DICT_PT),
+		createWordList(_TC_DICT_CODE),
+	}
+
+	// Code points (BMP only) of the UTF-8 letters in words. The table is frozen
+	// (changing it breaks the bitstream), hence not derived from package unicode.
+	_TC_UTF8_LETTER_RANGES = [][2]int{
+		{0x00AA, 0x00AA}, {0x00B5, 0x00B5}, {0x00BA, 0x00BA}, // ª µ º
+		{0x00C0, 0x00D6}, {0x00D8, 0x00F6}, {0x00F8, 0x02AF}, // Latin-1, Latin Extended-A/B, IPA
+		{0x0300, 0x036F},                   // Combining diacritical marks
+		{0x0370, 0x03FF},                   // Greek
+		{0x0400, 0x0481}, {0x0483, 0x052F}, // Cyrillic
+		{0x0531, 0x0556}, {0x0561, 0x0587}, // Armenian
+		{0x05B0, 0x05BD}, {0x05D0, 0x05EA}, // Hebrew
+		{0x0620, 0x065F}, {0x066E, 0x06D3}, // Arabic
+		{0x0900, 0x0963}, {0x0971, 0x097F}, // Devanagari
+		{0x10A0, 0x10FF}, // Georgian
+		{0x1E00, 0x1FFF}, // Latin Extended Additional, Greek Extended
+		{0xAC00, 0xD7A3}, // Hangul syllables
+	}
 
 	// Default dictionary
 	// 1024 of the most common English words with at least 2 chars.
@@ -176,11 +256,169 @@ var (
 	rGenerationLeafCopyMatchClaimAnyoneSoftwarePartyDeviceCodeLangua
 	geLinkHoweverConfirmCommentCityAnywhereSomewhereDebateDriveHighe
 	rBeautifulOnlineFanPriorityTraditionalSixUnited`)
+
+	// Common French words
+	_TC_DICT_FR = `de la le et les des en un une du est que qui dans pour pas au sur plus
+	par ne se ce il elle sont avec son sa ses ou mais comme on tout nous
+	vous ils elles leur leurs été être avoir fait faire très aussi bien sans
+	peut tous cette entre deux dont même ont après avant aux encore où ces
+	autre autres donc alors fois temps depuis sous lui moins contre chez ans
+	année années monde pays france français française premier première grand
+	grande petit petite nouveau nouvelle jour jours vie homme femme enfant
+	enfants selon ainsi toujours jamais rien chose choses peu beaucoup trop
+	déjà ici là partie place travail ville état gouvernement président
+	politique histoire question point cas fin part non oui quand comment
+	pourquoi parce celui celle ceux celles quelque quelques chaque plusieurs
+	lors pendant vers dire voir savoir pouvoir vouloir venir prendre donner
+	aller mettre falloir devoir trouver rendre parler aimer passer croire
+	demander rester comprendre suivre connaître penser tenir porter mort
+	famille maison eau terre guerre groupe service société nombre forme mot
+	main tête raison moment heure soir nuit matin semaine mois côté façon
+	manière besoin droit loi système effet exemple public publique général
+	générale seul seule long longue haut haute bon bonne mauvais meilleur
+	dernier dernière prochain certain certaine possible important importante
+	national nationale social sociale était avait étaient avaient sera
+	serait pourrait doit peuvent fut dit vu pris mis notre nos votre vos mon
+	ma mes ton ta tes cet cela ça ceci toute toutes personne tant puis
+	lorsque car si plutôt surtout seulement vraiment presque bientôt enfin
+	hier demain aujourd région europe européen européenne mondial économie
+	économique entreprise marché prix argent projet développement recherche
+	mise âge père mère fils fille frère sœur ami amis amour cœur corps yeux
+	voix regard problème idée sens ordre niveau rapport début suite nom
+	livre film musique art école université étude études santé feu air route
+	rue porte fenêtre table lieu ligne œuvre`
+
+	// Common German words
+	_TC_DICT_DE = `der die und in den von zu das mit sich des auf für ist im dem nicht ein
+	eine als auch es an werden aus er hat dass sie nach wird bei einer um am
+	sind noch wie einem über einen so zum war haben nur oder aber vor zur
+	bis mehr durch man sein wurde sei hatte kann gegen vom können schon wenn
+	habe seine ihre dann unter wir soll ich eines jahr zwei jahren diese
+	dieser wieder keine seiner worden will zwischen immer was sagte gibt
+	alle diesem seit muss wurden beim doch jetzt waren drei neue neuen damit
+	bereits da ab ihr ihrer ihren sehr weil uns hier ohne müssen sollen
+	sagen geht ganz gut große großen groß kein keinen deutschland deutschen
+	deutsche land stadt welt zeit leben menschen mensch frau mann kinder
+	kind haus arbeit heute etwa viel viele vielen weiter weitere dabei
+	seinen dort selbst allerdings also eigentlich fast nichts etwas jedoch
+	während möglich gemacht machen kommen gehen sehen lassen stehen finden
+	bleiben liegen heißt denken nehmen tun dürfen glauben halten nennen
+	zeigen führen sprechen bringen fahren meinen fragen kennen gelten
+	stellen spielen arbeiten brauchen folgen lernen bestehen verstehen
+	setzen bekommen beginnen erzählen versuchen schreiben laufen erklären
+	sitzen ziehen scheinen fallen gehören entstehen erhalten treffen suchen
+	legen tragen schaffen lesen verlieren erkennen entwickeln reden
+	erscheinen bilden anfangen erwarten wohnen warten helfen gewinnen
+	schließen fühlen bieten erinnern bedeuten frage teil ende recht seite
+	beispiel fall grund platz woche monat tag tage nacht morgen abend weg
+	wasser geld unternehmen regierung politik system gesellschaft problem
+	probleme geschichte schule familie vater mutter sohn tochter bruder
+	schwester freund freunde auge augen hand kopf wort wörter sprache buch
+	raum stelle art weise form zahl punkt bild länder staat krieg natürlich
+	später zurück würde wäre hätte könnte möchte würden müsste dürfte sollte
+	wollte konnte musste tür grün früh schön klein kleine kleinen alt alte
+	alten jung lang lange hoch gleich eigene eigenen letzte letzten erste
+	ersten zweite nächste ganze ganzen wichtig richtig einfach wirklich
+	vielleicht sogar nie oft manchmal bald schnell wenig weniger zusammen
+	allein dafür darauf davon dazu darüber trotz wegen seitdem obwohl
+	sondern denn sowie bzw`
+
+	// Common Spanish words
+	_TC_DICT_ES = `de la que el en los se del las un por con no una su para es al lo como
+	más pero sus le ya este sí porque esta entre cuando muy sin sobre
+	también me hasta hay donde quien desde todo nos durante todos uno les ni
+	contra otros ese eso ante ellos esto mí antes algunos qué unos yo otro
+	otras otra él tanto esa estos mucho quienes nada muchos cual poco ella
+	estar estas algunas algo nosotros mi mis tú te ti tu tus ellas vosotros
+	os esos esas estoy está estamos están ser soy eres somos son era fue han
+	ha he había tiene tienen tener hacer hace puede pueden decir dijo año
+	años día días vez veces tiempo vida mundo país países gobierno parte
+	caso forma casa hombre mujer niños gente ciudad trabajo lugar momento
+	manera cosa cosas grande gran nuevo nueva primer primera primero mejor
+	mismo misma bien así ahora siempre nunca aquí allí después luego
+	mientras según tan todavía además sólo solo menos ver dar saber querer
+	llegar pasar deber poner parecer quedar creer hablar llevar dejar seguir
+	encontrar llamar venir pensar salir volver tomar conocer vivir sentir
+	tratar mirar contar empezar esperar buscar existir entrar trabajar
+	escribir perder producir ocurrir entender pedir recibir recordar
+	terminar permitir aparecer conseguir comenzar servir sacar necesitar
+	mantener resultar leer caer cambiar presentar crear abrir considerar oír
+	acabar convertir ganar formar traer partir morir aceptar realizar
+	suponer comprender lograr explicar través política político público
+	pública económico económica historia información educación situación
+	relación población atención acción nación presidente estado sistema
+	desarrollo empresa mercado problema problemas grupo guerra agua tierra
+	familia padre madre hijo hija hermano amigo amigos nombre punto señor
+	señora noche mañana tarde semana mes hora palabra libro mano cabeza ojos
+	cuerpo corazón muerte derecho ley orden nivel centro fin principio final
+	tipo medio sociedad internacional nacional social general importante
+	posible necesario cierto claro fácil difícil largo alto bajo pequeño
+	pequeña mayor menor último última propio propia cada varios varias dos
+	tres cuatro cinco cualquier ninguno ningún nadie`
+
+	// Common Portuguese words
+	_TC_DICT_PT = `de que não do da em um para é com uma os no se na por mais as dos como
+	mas foi ao ele das tem à seu sua ou ser quando muito há nos já está eu
+	também só pelo pela até isso ela entre era depois sem mesmo aos ter seus
+	quem nas me esse eles estão você tinha foram essa num nem suas meu às
+	minha têm numa pelos elas havia seja qual será nós tenho lhe deles essas
+	esses pelas este fosse dele tu te vocês vos lhes meus minhas teu tua
+	teus tuas nosso nossa nossos nossas dela delas esta estes estas aquele
+	aquela aqueles aquelas isto aquilo estou estamos estava estavam fazer
+	feito faz pode podem poder dizer disse ano anos dia dias vez vezes tempo
+	vida mundo país países governo parte caso forma casa homem mulher gente
+	cidade trabalho lugar momento coisa coisas grande novo nova primeiro
+	primeira melhor bem assim agora sempre nunca aqui ali então ainda
+	enquanto segundo tão apenas menos outro outra outros outras ver dar
+	saber querer chegar passar dever pôr parecer ficar achar falar levar
+	deixar seguir encontrar chamar vir pensar sair voltar tomar conhecer
+	viver sentir tratar olhar contar começar esperar procurar entrar
+	trabalhar escrever perder produzir entender pedir receber lembrar
+	terminar permitir aparecer conseguir servir precisar manter resultar ler
+	cair mudar apresentar criar abrir considerar ouvir acabar ganhar formar
+	trazer partir morrer aceitar realizar explicar além após política
+	político público pública história informação educação situação relação
+	população ação nação mãe pai irmão irmã filho filha amigo amigos mão
+	coração questão razão presidente estado sistema desenvolvimento empresa
+	mercado problema problemas grupo guerra água terra família nome ponto
+	senhor senhora noite manhã tarde semana mês hora palavra livro cabeça
+	olhos corpo morte direito lei ordem nível centro fim início final tipo
+	meio sociedade internacional nacional social geral importante possível
+	necessário certo claro fácil difícil longo alto baixo pequeno pequena
+	maior menor último última próprio própria cada vários várias dois três
+	quatro cinco qualquer nenhum ninguém brasil portugal são`
+
+	// Common keywords and identifiers of programming languages
+	_TC_DICT_CODE = `the if else for return int while in is to of and this self def function
+	var const let new null true false none nil string void static public
+	private class import from include define end case break struct char
+	value data len size type err error name get set key byte bool boolean
+	long short unsigned float double auto sizeof typedef enum union extern
+	register volatile inline do switch default continue goto try catch throw
+	throws finally except raise assert pass yield lambda global nonlocal
+	with as elif async await package interface extends implements abstract
+	final protected override virtual super instanceof namespace using
+	template typename operator friend explicit mutable constexpr noexcept
+	nullptr std vector map list dict array object module require exports
+	export undefined typeof prototype console log document window func go
+	chan defer range select fallthrough make cap append copy delete panic
+	recover rune impl trait pub mut fn use crate match loop mod where ref
+	str print println printf sprintf format fmt args argv argc param params
+	config options opts context ctx file path dir buffer buf src dst tmp
+	temp ptr addr obj result res results count index idx item items keys
+	values node nodes parent child children next prev head tail left right
+	root tree start begin offset pos length min max sum init main test tests
+	expect debug info warn input output read write open close flush seek id
+	ids handler request response http url json xml html div span style href
+	width height color text label button event events callback listener
+	state props component render update create remove add insert query table
+	column row user users message msg status code token`
 )
 
 // Analyze the block and return an 8-bit status (see MASK flags constants)
 // The goal is to detect text data amenable to pre-processing.
-func computeTextStats(block []byte, freqs0 []int, strict bool) byte {
+// If unicode is true, the UTF-8 letters count as text.
+func computeTextStats(block []byte, freqs0 []int, strict, unicode bool) byte {
 	if strict == false && internal.GetMagicType(block) != internal.NO_MAGIC {
 		// This is going to fail if the block is not the first of the file.
 		// But this is a cheap test, good enough for fast mode.
@@ -229,6 +467,13 @@ func computeTextStats(block []byte, freqs0 []int, strict bool) byte {
 
 	// Not text (crude threshold)
 	nbBinChars := count - nbASCII
+
+	if unicode == true && nbBinChars > 0 {
+		letters := countUTF8Letters(block)
+		nbTextChars += letters
+		nbASCII += letters
+		nbBinChars -= letters
+	}
 	notText := false
 
 	if nbBinChars > (count >> 2) {
@@ -243,8 +488,12 @@ func computeTextStats(block []byte, freqs0 []int, strict bool) byte {
 
 	res := byte(0)
 
+	if nbBinChars <= count>>2 && isJSON(freqs0, count) == true {
+		res |= _TC_MASK_JSON
+	}
+
 	if notText == true {
-		return res | detectTextType(freqs0, freqs1[:], count)
+		return res | detectTextType(freqs0, freqs1[:], count, hasUTF16BOM(block))
 	}
 
 	if nbBinChars <= count-count/10 {
@@ -299,7 +548,30 @@ func computeTextStats(block []byte, freqs0 []int, strict bool) byte {
 	return res
 }
 
-func detectTextType(freqs0 []int, freqs [][256]int, count int) byte {
+// Another crude test: JSON data (EG. NDJSON) has balanced and frequent
+// braces, at least one colon per object and two quotes per colon (keys).
+func isJSON(freqs0 []int, count int) bool {
+	f1 := freqs0['{']
+	f2 := freqs0['}']
+	f3 := freqs0[':']
+	minFreq := max(count>>10, 2)
+
+	if f1 < minFreq || f2 < minFreq || f3 < f1 || freqs0['"'] < 2*f3 {
+		return false
+	}
+
+	if f1 < f2 {
+		return f1 >= f2-f2/16-2
+	}
+
+	return f2 >= f1-f1/16-2
+}
+
+func detectTextType(freqs0 []int, freqs [][256]int, count int, bom bool) byte {
+	if isUTF16(freqs0, freqs, count, bom) == true {
+		return _TC_MASK_NOT_TEXT | byte(internal.DT_UTF16)
+	}
+
 	if dt := internal.DetectSimpleType(count, freqs0); dt != internal.DT_UNDEFINED {
 		return _TC_MASK_NOT_TEXT | byte(dt)
 	}
@@ -362,6 +634,107 @@ func detectTextType(freqs0 []int, freqs [][256]int, count int) byte {
 	return _TC_MASK_NOT_TEXT | byte(internal.DT_UTF8)
 }
 
+// hasUTF16BOM returns true if the block starts with a UTF-16 Byte Order Mark
+func hasUTF16BOM(block []byte) bool {
+	return len(block) >= 2 && ((block[0] == 0xFF && block[1] == 0xFE) || (block[0] == 0xFE && block[1] == 0xFF))
+}
+
+// Check UTF-16 (EG. Windows text files): mostly Latin characters interleaved
+// with isolated zero bytes (high or low half of the code units). With a
+// Byte Order Mark, only runs of zeros (binary data) are ruled out.
+func isUTF16(freqs0 []int, freqs [][256]int, count int, bom bool) bool {
+	zeros := freqs0[0]
+
+	if count < 64 || freqs[0][0] > zeros/16 {
+		return false
+	}
+
+	if bom == true {
+		return true
+	}
+
+	if zeros < count/4 || zeros > count/2+1 {
+		return false
+	}
+
+	nbTextChars := 0
+	nbPrintable := freqs0[CR] + freqs0[LF] + freqs0['\t']
+
+	for i := 32; i < 127; i++ {
+		if isText(byte(i)) == true {
+			nbTextChars += freqs0[i]
+		}
+
+		nbPrintable += freqs0[i]
+	}
+
+	// The other halves are mostly printable ASCII with enough letters
+	others := count - zeros
+	return nbPrintable >= others-others/8 && nbTextChars >= others/4
+}
+
+// countUTF8Letters returns the number of bytes of UTF-8 letters in block
+func countUTF8Letters(block []byte) int {
+	res := 0
+
+	for i := 0; i < len(block); {
+		if block[i] < 0xC2 {
+			i++
+			continue
+		}
+
+		if n := utf8LetterLength(block[i:]); n > 0 {
+			res += n
+			i += n
+		} else {
+			i++
+		}
+	}
+
+	return res
+}
+
+// utf8LetterLength returns the length of the UTF-8 sequence at the start of
+// buf if it encodes a letter, 0 otherwise (other symbol or invalid sequence)
+func utf8LetterLength(buf []byte) int {
+	if len(buf) < 2 {
+		return 0
+	}
+
+	var cp, n int
+
+	if b := buf[0]; b >= 0xC2 && b < 0xE0 {
+		cp, n = int(b&0x1F), 2
+	} else if b >= 0xE0 && b < 0xF0 {
+		cp, n = int(b&0x0F), 3
+	} else {
+		return 0
+	}
+
+	if len(buf) < n {
+		return 0
+	}
+
+	for i := 1; i < n; i++ {
+		if buf[i]&0xC0 != 0x80 {
+			return 0
+		}
+
+		cp = (cp << 6) | int(buf[i]&0x3F)
+	}
+
+	// Overlong sequence ?
+	if n == 3 && cp < 0x800 {
+		return 0
+	}
+
+	if _TC_UTF8_LETTERS[cp>>3]&(1<<(cp&7)) == 0 {
+		return 0
+	}
+
+	return n
+}
+
 func sameWords(buf1, buf2 []byte) bool {
 	for i := range buf1 {
 		if buf1[i] != buf2[i] {
@@ -413,6 +786,88 @@ func initDelimiterChars() []bool {
 	return res[:]
 }
 
+// initUTF8Letters returns a bit set of the code points in _TC_UTF8_LETTER_RANGES
+func initUTF8Letters() []byte {
+	res := make([]byte, 0x10000>>3)
+
+	for _, r := range _TC_UTF8_LETTER_RANGES {
+		for cp := r[0]; cp <= r[1]; cp++ {
+			res[cp>>3] |= 1 << (cp & 7)
+		}
+	}
+
+	return res
+}
+
+// createWordList creates a dictionary from a list of words separated by spaces
+func createWordList(words string) []dictEntry {
+	list := strings.Fields(words)
+	res := make([]dictEntry, len(list))
+
+	for i, w := range list {
+		h := _TC_HASH1
+
+		for j := 0; j < len(w); j++ {
+			h = h*_TC_HASH1 ^ int32(w[j])*_TC_HASH2
+		}
+
+		res[i] = dictEntry{ptr: []byte(w), hash: h, data: int32((len(w) << 24) | i)}
+	}
+
+	return res
+}
+
+// getLanguage returns the static dictionary for the provided name
+func getLanguage(name string) (int, error) {
+	name = strings.ToLower(name)
+
+	if name == "auto" {
+		return _TC_LANG_AUTO, nil
+	}
+
+	for i := range _TC_LANG_NAMES {
+		if _TC_LANG_NAMES[i] == name {
+			return i, nil
+		}
+	}
+
+	return _TC_LANG_EN, fmt.Errorf("Invalid text dictionary: '%s' (must be auto or one of %s)", name, strings.Join(_TC_LANG_NAMES, ", "))
+}
+
+// selectDictionary returns the static dictionary matching the frequencies of
+// the symbols of source code and of the accented letters (second byte of the
+// UTF-8 sequences starting with 0xC3)
+func selectDictionary(freqs0 []int, count int) int {
+	code := freqs0['('] + freqs0[')'] + freqs0['{'] + freqs0['}'] + freqs0[';'] + freqs0['='] + freqs0['_']
+
+	if code >= count/20 {
+		return _TC_LANG_CODE
+	}
+
+	if freqs0[0xC3] < count/256 {
+		return _TC_LANG_EN
+	}
+
+	scores := [...]int{
+		_TC_LANG_FR: freqs0[0xA9] + freqs0[0xA0] + 2*(freqs0[0xA8]+freqs0[0xAA]+freqs0[0xB9]), // é à è ê ù
+		_TC_LANG_DE: 2 * (freqs0[0xA4] + freqs0[0xB6] + freqs0[0xBC] + freqs0[0x9F]),          // ä ö ü ß
+		_TC_LANG_ES: 3*freqs0[0xB1] + freqs0[0xA1] + freqs0[0xAD] + freqs0[0xB3],              // ñ á í ó
+		_TC_LANG_PT: 3*(freqs0[0xA3]+freqs0[0xB5]) + freqs0[0xA7] + freqs0[0xAA],              // ã õ ç ê
+	}
+
+	res := _TC_LANG_EN
+	best := 0
+
+	for i, score := range scores {
+		if score > best {
+			res = i
+			best = score
+		}
+	}
+
+	return res
+}
+
 // Create dictionary from array of words
 func createDictionary(words []byte, dict []dictEntry, maxWords, startWord int) int {
 	anchor := 0
@@ -455,6 +910,20 @@ func createDictionary(words []byte, dict []dictEntry, maxWords, startWord int) i
 	return nbWords
 }
 
+// rehashDictionary returns a hash map of size mask+1 with the entries of
+// dictMap (hashed with a mask half the size, so that there is no collision)
+func rehashDictionary(dictMap []*dictEntry, mask int32) []*dictEntry {
+	res := make([]*dictEntry, mask+1)
+
+	for _, pe := range dictMap {
+		if pe != nil {
+			res[pe.hash&mask] = pe
+		}
+	}
+
+	return res
+}
+
 func isText(val byte) bool {
 	return isLowerCase(val | 0x20)
 }
@@ -482,27 +951,32 @@ func NewTextCodec() (*TextCodec, error) {
 // NewTextCodecWithCtx creates a new instance of TextCodec using a
 // configuration map as parameter.
 func NewTextCodecWithCtx(ctx *map[string]any) (*TextCodec, error) {
-	this := &TextCodec{}
-
-	var err error
-	var d kanzi.ByteTransform
+	encodingType := 1
 
 	if ctx != nil {
 		if val, hasKey := (*ctx)["textcodec"]; hasKey {
-			encodingType := val.(int)
-
-			if encodingType == 2 {
-				d, err = newTextCodec2WithCtx(ctx)
-				this.delegate = d
-			}
+			encodingType = val.(int)
 		}
 	}
 
-	if this.delegate == nil && err == nil {
+	return newTextCodecWithCtx(ctx, encodingType)
+}
+
+// newTextCodecWithCtx creates a new instance of TextCodec for the encoding
+// type (1 or 2)
+func newTextCodecWithCtx(ctx *map[string]any, encodingType int) (*TextCodec, error) {
+	this := &TextCodec{}
+
+	var err error
+	var d kanzi.ByteTransform
+
+	if encodingType == 2 {
+		d, err = newTextCodec2WithCtx(ctx)
+	} else {
 		d, err = newTextCodec1WithCtx(ctx)
-		this.delegate = d
 	}
 
+	this.delegate = d
 	return this, err
 }
 
@@ -557,6 +1031,8 @@ func (this *TextCodec) MaxEncodedLen(srcLen int) int {
 func newTextCodec1() (*textCodec1, error) {
 	this := &textCodec1{}
 	this.logHashSize = _TC_LOG_HASHES_SIZE
+	this.baseLogHash = this.logHashSize
+	this.maxLogHash = this.logHashSize
 	this.dictSize = 1 << 13
 	this.dictMap = make([]*dictEntry, 0)
 	this.dictList = make([]dictEntry, 0)
@@ -585,9 +1061,30 @@ func newTextCodec1WithCtx(ctx *map[string]any) (*textCodec1, error) {
 				log++
 			}
 		}
+
+		if val, hasKey := (*ctx)["bsVersion"]; hasKey {
+			this.adaptiveHash = val.(uint) >= 7
+			this.unicodeWords = val.(uint) >= 7
+		}
+
+		if this.unicodeWords == true {
+			lang := "auto"
+
+			if val, hasKey := (*ctx)["lang"]; hasKey {
+				lang = val.(string)
+			}
+
+			var err error
+
+			if this.lang, err = getLanguage(lang); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	this.logHashSize = uint(log)
+	this.baseLogHash = this.logHashSize
+	this.maxLogHash = max(this.logHashSize, min(this.logHashSize+_TC_LOG_HASH_DELTA, 26))
 	this.dictSize = 1 << 13
 	this.dictMap = make([]*dictEntry, 0)
 	this.dictList = make([]dictEntry, 0)
@@ -597,7 +1094,18 @@ func newTextCodec1WithCtx(ctx *map[string]any) (*textCodec1, error) {
 	return this, nil
 }
 
-func (this *textCodec1) reset(count int) {
+func (this *textCodec1) reset(count int, adaptive bool, dict int) {
+	this.growHash = adaptive
+	this.logHashSize = this.baseLogHash
+	this.hashAdds = 0
+	this.hashCollisions = 0
+
+	if adaptive == true {
+		this.logHashSize = max(this.baseLogHash, 13+_TC_LOG_HASH_DELTA) - _TC_LOG_HASH_DELTA
+	}
+
+	this.hashMask = int32(1<<this.logHashSize) - 1
+
 	if count >= 1024 {
 		// Select an appropriate initial dictionary size
 		log, _ := internal.Log2(uint32(count / 128))
@@ -617,15 +1125,15 @@ func (this *textCodec1) reset(count int) {
 
 	if len(this.dictList) < this.dictSize {
 		this.dictList = make([]dictEntry, this.dictSize)
-		size := min(len(_TC_STATIC_DICTIONARY), this.dictSize)
-		copy(this.dictList, _TC_STATIC_DICTIONARY[0:size])
-
-		// Add special entries at end of static dictionary
-		this.dictList[_TC_STATIC_DICT_WORDS] = dictEntry{ptr: []byte{_TC_ESCAPE_TOKEN2}, hash: 0, data: int32((1 << 24) | (_TC_STATIC_DICT_WORDS))}
-		this.dictList[_TC_STATIC_DICT_WORDS+1] = dictEntry{ptr: []byte{_TC_ESCAPE_TOKEN1}, hash: 0, data: int32((1 << 24) | (_TC_STATIC_DICT_WORDS + 1))}
-		this.staticDictSize = _TC_STATIC_DICT_WORDS + 2
 	}
 
+	n := copy(this.dictList, _TC_STATIC_DICTIONARIES[dict])
+
+	// Add special entries at end of static dictionary
+	this.dictList[n] = dictEntry{ptr: []byte{_TC_ESCAPE_TOKEN2}, hash: 0, data: int32((1 << 24) | n)}
+	this.dictList[n+1] = dictEntry{ptr: []byte{_TC_ESCAPE_TOKEN1}, hash: 0, data: int32((1 << 24) | (n + 1))}
+	this.staticDictSize = n + 2
+
 	// Update map
 	for i := 0; i < this.staticDictSize; i++ {
 		e := this.dictList[i]
@@ -645,34 +1153,31 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
 	}
 
-	if this.ctx != nil {
-		if val, hasKey := (*this.ctx)["dataType"]; hasKey {
-			dt := val.(internal.DataType)
-
-			// Filter out most types. Still check binaries which may contain significant parts of text
-			if dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_BIN {
-				return 0, 0, fmt.Errorf("Input is not text, skip")
-			}
-		}
+	// Filter out most types. Still check binaries which may contain significant parts of text
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_BIN {
+		return 0, 0, fmt.Errorf("Input is not text, skip")
 	}
 
 	freqs0 := [256]int{}
-	mode := computeTextStats(src[0:count], freqs0[:], true)
+	mode := computeTextStats(src[0:count], freqs0[:], true, this.unicodeWords)
 
 	// Not text ?
 	if mode&_TC_MASK_NOT_TEXT != 0 {
-		if this.ctx != nil {
-			(*this.ctx)["dataType"] = internal.DataType(mode & _TC_MASK_DT)
-		}
+		internal.SetDataType(this.ctx, internal.DataType(mode&_TC_MASK_DT))
 
 		return 0, 0, errors.New("Input is not text, skip")
 	}
 
-	if this.ctx != nil {
-		(*this.ctx)["dataType"] = internal.DT_TEXT
+	internal.SetDataType(this.ctx, internal.DT_TEXT)
+
+	dict := this.lang
+
+	if dict == _TC_LANG_AUTO {
+		dict = selectDictionary(freqs0[:], count)
 	}
 
-	this.reset(count)
+	this.reset(count, this.adaptiveHash, dict)
+	this.utf8Words = this.unicodeWords
 	srcEnd := count
 	dstEnd := this.MaxEncodedLen(count)
 	dstEnd4 := dstEnd - 4
@@ -681,7 +1186,16 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 
 	// DOS encoded end of line (CR+LF) ?
 	this.isCRLF = mode&_TC_MASK_CRLF != 0
-	dst[0] = mode
+	dst[0] = (mode &^ _TC_MASK_JSON) | byte(dict)
+
+	if this.adaptiveHash == true {
+		dst[0] |= _TC_MASK_ADAPTIVE
+	}
+
+	if this.utf8Words == true {
+		dst[0] |= _TC_MASK_UNICODE
+	}
+
 	dstIdx := 1
 	srcIdx := 0
 
@@ -694,8 +1208,14 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 
 	var err error
 	var delimAnchor int // previous delimiter
+	hits := 0           // bytes of input replaced by dictionary words
+	checkIdx := 0
+
+	if count >= 4*_TC_CHECK_SIZE {
+		checkIdx = _TC_CHECK_SIZE
+	}
 
-	if isText(src[srcIdx]) {
+	if isText(src[srcIdx]) || (this.utf8Words == true && utf8LetterLength(src[srcIdx:]) > 0) {
 		delimAnchor = srcIdx - 1
 	} else {
 		delimAnchor = srcIdx
@@ -709,6 +1229,13 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 			continue
 		}
 
+		if cur >= 0x80 && this.utf8Words == true {
+			if n := utf8LetterLength(src[srcIdx:srcEnd]); n > 0 {
+				srcIdx += n
+				continue
+			}
+		}
+
 		if (srcIdx > delimAnchor+2) && isDelimiter(cur) { // At least 2 letters
 			length := int32(srcIdx - delimAnchor - 1)
 
@@ -748,7 +1275,9 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 				if pe == nil {
 					// Word not found in the dictionary or hash collision.
 					// Replace entry if not in static dictionary
-					if ((length > 3) || (length == 3 && words < _TC_THRESHOLD2)) && (pe1 == nil) {
+					add := (length > 3) || (length == 3 && words < _TC_THRESHOLD2)
+
+					if add == true && pe1 == nil {
 						pe = &this.dictList[words]
 
 						if int(pe.data&_TC_MASK_LENGTH) >= this.staticDictSize {
@@ -770,6 +1299,10 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 							}
 						}
 					}
+
+					if add == true && this.growHash == true {
+						this.updateHashSize(pe1 != nil)
+					}
 				} else {
 					// Word found in the dictionary
 					// Skip space if only delimiter between 2 word references
@@ -791,6 +1324,7 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 					dstIdx++
 					dstIdx += emitWordIndex1(dst[dstIdx:dstIdx+3], int(pe.data&_TC_MASK_LENGTH))
 					emitAnchor = delimAnchor + 1 + int(pe.data>>24)
+					hits += int(length)
 				}
 			}
 		}
@@ -798,6 +1332,15 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		// Reset delimiter position
 		delimAnchor = srcIdx
 		srcIdx++
+
+		if checkIdx != 0 && srcIdx >= checkIdx {
+			// Bail out early if the dictionary is not effective (EG. pseudo text)
+			if hits*100 < srcIdx*_TC_MIN_HIT_RATE {
+				return uint(srcIdx), uint(dstIdx), errors.New("Text transform skip: low dictionary hit rate")
+			}
+
+			checkIdx = 0
+		}
 	}
 
 	if err == nil {
@@ -816,6 +1359,30 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 	return uint(srcIdx), uint(dstIdx), err
 }
 
+// updateHashSize records the addition of a word to the dictionary (failed if
+// collision is true) and doubles the size of the hash map if too many
+// additions failed since the last check
+func (this *textCodec1) updateHashSize(collision bool) {
+	this.hashAdds++
+
+	if collision == true {
+		this.hashCollisions++
+	}
+
+	if this.hashAdds < _TC_HASH_CHECK_SIZE {
+		return
+	}
+
+	if this.hashCollisions*100 > this.hashAdds*_TC_MAX_COLLISIONS && this.logHashSize < this.maxLogHash {
+		this.logHashSize++
+		this.hashMask = int32(1<<this.logHashSize) - 1
+		this.dictMap = rehashDictionary(this.dictMap, this.hashMask)
+	}
+
+	this.hashAdds = 0
+	this.hashCollisions = 0
+}
+
 func (this *textCodec1) expandDictionary() bool {
 	if this.dictSize >= _TC_MAX_DICT_SIZE {
 		return false
@@ -903,17 +1470,18 @@ func emitWordIndex1(dst []byte, val int) int {
 }
 
 func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
-	this.reset(len(dst))
-	srcEnd := len(src)
-	dstEnd := len(dst)
-	var delimAnchor int // previous delimiter
+	dict := int(src[0] & _TC_MASK_DICT)
 
-	if isText(src[0]) {
-		delimAnchor = -1
-	} else {
-		delimAnchor = 0
+	if dict >= len(_TC_STATIC_DICTIONARIES) {
+		return 0, 0, errors.New("Text transform failed. Invalid static dictionary")
 	}
 
+	this.reset(len(dst), src[0]&_TC_MASK_ADAPTIVE != 0, dict)
+	this.utf8Words = src[0]&_TC_MASK_UNICODE != 0
+	srcEnd := len(src)
+	dstEnd := len(dst)
+	delimAnchor := 0 // previous delimiter (the mode byte is not part of a word)
+
 	words := this.staticDictSize
 	wordRun := false
 	err := error(nil)
@@ -931,6 +1499,20 @@ func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			continue
 		}
 
+		if cur >= 0x80 && this.utf8Words == true {
+			if n := utf8LetterLength(src[srcIdx:srcEnd]); n > 0 {
+				if dstIdx+n > dstEnd {
+					err = errors.New("Text transform failed. Invalid input data")
+					break
+				}
+
+				copy(dst[dstIdx:], src[srcIdx:srcIdx+n])
+				srcIdx += n
+				dstIdx += n
+				continue
+			}
+		}
+
 		if (srcIdx > delimAnchor+3) && isDelimiter(cur) {
 			length := int32(srcIdx - delimAnchor - 1) // length > 2
 
@@ -955,7 +1537,9 @@ func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 				if pe == nil {
 					// Word not found in the dictionary or hash collision.
 					// Replace entry if not in static dictionary
-					if ((length > 3) || (words < _TC_THRESHOLD2)) && (pe1 == nil) {
+					add := (length > 3) || (words < _TC_THRESHOLD2)
+
+					if add == true && pe1 == nil {
 						pe = &this.dictList[words]
 
 						if int(pe.data&_TC_MASK_LENGTH) >= this.staticDictSize {
@@ -976,6 +1560,10 @@ func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 							}
 						}
 					}
+
+					if add == true && this.growHash == true {
+						this.updateHashSize(pe1 != nil)
+					}
 				}
 			}
 		}
@@ -1076,6 +1664,8 @@ func (this *textCodec1) MaxEncodedLen(srcLen int) int {
 func newTextCodec2() (*textCodec2, error) {
 	this := &textCodec2{}
 	this.logHashSize = _TC_LOG_HASHES_SIZE
+	this.baseLogHash = this.logHashSize
+	this.maxLogHash = this.logHashSize
 	this.dictSize = 1 << 13
 	this.dictMap = make([]*dictEntry, 0)
 	this.dictList = make([]dictEntry, 0)
@@ -1104,9 +1694,30 @@ func newTextCodec2WithCtx(ctx *map[string]any) (*textCodec2, error) {
 				log++
 			}
 		}
+
+		if val, hasKey := (*ctx)["bsVersion"]; hasKey {
+			this.adaptiveHash = val.(uint) >= 7
+			this.unicodeWords = val.(uint) >= 7
+		}
+
+		if this.unicodeWords == true {
+			lang := "auto"
+
+			if val, hasKey := (*ctx)["lang"]; hasKey {
+				lang = val.(string)
+			}
+
+			var err error
+
+			if this.lang, err = getLanguage(lang); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	this.logHashSize = uint(log)
+	this.baseLogHash = this.logHashSize
+	this.maxLogHash = max(this.logHashSize, min(this.logHashSize+_TC_LOG_HASH_DELTA, 24))
 	this.dictSize = 1 << 13
 	this.dictMap = make([]*dictEntry, 0)
 	this.dictList = make([]dictEntry, 0)
@@ -1116,7 +1727,18 @@ func newTextCodec2WithCtx(ctx *map[string]any) (*textCodec2, error) {
 	return this, nil
 }
 
-func (this *textCodec2) reset(count int) {
+func (this *textCodec2) reset(count int, adaptive bool, dict int) {
+	this.growHash = adaptive
+	this.logHashSize = this.baseLogHash
+	this.hashAdds = 0
+	this.hashCollisions = 0
+
+	if adaptive == true {
+		this.logHashSize = max(this.baseLogHash, 13+_TC_LOG_HASH_DELTA) - _TC_LOG_HASH_DELTA
+	}
+
+	this.hashMask = int32(1<<this.logHashSize) - 1
+
 	if count >= 1024 {
 		// Select an appropriate initial dictionary size
 		log, _ := internal.Log2(uint32(count / 128))
@@ -1136,10 +1758,10 @@ func (this *textCodec2) reset(count int) {
 
 	if len(this.dictList) < this.dictSize {
 		this.dictList = make([]dictEntry, this.dictSize)
-		size := min(len(_TC_STATIC_DICTIONARY), this.dictSize)
-		copy(this.dictList, _TC_STATIC_DICTIONARY[0:size])
 	}
 
+	this.staticDictSize = copy(this.dictList, _TC_STATIC_DICTIONARIES[dict])
+
 	// Update map
 	for i := 0; i < this.staticDictSize; i++ {
 		e := this.dictList[i]
@@ -1159,34 +1781,31 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 		return 0, 0, fmt.Errorf("Output buffer is too small - size: %d, required %d", len(dst), n)
 	}
 
-	if this.ctx != nil {
-		if val, hasKey := (*this.ctx)["dataType"]; hasKey {
-			dt := val.(internal.DataType)
-
-			// Filter out most types. Still check binaries which may contain significant parts of text
-			if dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_BIN {
-				return 0, 0, fmt.Errorf("Input is not text, skip")
-			}
-		}
+	// Filter out most types. Still check binaries which may contain significant parts of text
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_TEXT && dt != internal.DT_BIN {
+		return 0, 0, fmt.Errorf("Input is not text, skip")
 	}
 
 	freqs0 := [256]int{}
-	mode := computeTextStats(src[0:count], freqs0[:], false)
+	mode := computeTextStats(src[0:count], freqs0[:], false, this.unicodeWords)
 
 	// Not text ?
 	if mode&_TC_MASK_NOT_TEXT != 0 {
-		if this.ctx != nil {
-			(*this.ctx)["dataType"] = internal.DataType(mode & _TC_MASK_DT)
-		}
+		internal.SetDataType(this.ctx, internal.DataType(mode&_TC_MASK_DT))
 
 		return uint(0), uint(0), errors.New("Input is not text, skip")
 	}
 
-	if this.ctx != nil {
-		(*this.ctx)["dataType"] = internal.DT_TEXT
+	internal.SetDataType(this.ctx, internal.DT_TEXT)
+
+	dict := this.lang
+
+	if dict == _TC_LANG_AUTO {
+		dict = selectDictionary(freqs0[:], count)
 	}
 
-	this.reset(count)
+	this.reset(count, this.adaptiveHash, dict)
+	this.utf8Words = this.unicodeWords
 	srcEnd := count
 	dstEnd := this.MaxEncodedLen(count)
 	dstEnd3 := dstEnd - 3
@@ -1195,7 +1814,16 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 
 	// DOS encoded end of line (CR+LF) ?
 	this.isCRLF = mode&_TC_MASK_CRLF != 0
-	dst[0] = mode
+	dst[0] = (mode &^ _TC_MASK_JSON) | byte(dict)
+
+	if this.adaptiveHash == true {
+		dst[0] |= _TC_MASK_ADAPTIVE
+	}
+
+	if this.utf8Words == true {
+		dst[0] |= _TC_MASK_UNICODE
+	}
+
 	srcIdx := 0
 	dstIdx := 1
 
@@ -1208,8 +1836,14 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 
 	var err error
 	var delimAnchor int // previous delimiter
+	hits := 0           // bytes of input replaced by dictionary words
+	checkIdx := 0
+
+	if count >= 4*_TC_CHECK_SIZE {
+		checkIdx = _TC_CHECK_SIZE
+	}
 
-	if isText(src[srcIdx]) {
+	if isText(src[srcIdx]) || (this.utf8Words == true && utf8LetterLength(src[srcIdx:]) > 0) {
 		delimAnchor = srcIdx - 1
 	} else {
 		delimAnchor = srcIdx
@@ -1223,6 +1857,13 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 			continue
 		}
 
+		if cur >= 0x80 && this.utf8Words == true {
+			if n := utf8LetterLength(src[srcIdx:srcEnd]); n > 0 {
+				srcIdx += n
+				continue
+			}
+		}
+
 		if (srcIdx > delimAnchor+2) && isDelimiter(cur) { // At least 2 letters
 			length := int32(srcIdx - delimAnchor - 1)
 
@@ -1264,7 +1905,9 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 				if pe == nil {
 					// Word not found in the dictionary or hash collision.
 					// Replace entry if not in static dictionary
-					if ((length > 3) || (length == 3 && words < _TC_THRESHOLD2)) && (pe1 == nil) {
+					add := (length > 3) || (length == 3 && words < _TC_THRESHOLD2)
+
+					if add == true && pe1 == nil {
 						pe = &this.dictList[words]
 
 						if int(pe.data&_TC_MASK_LENGTH) >= this.staticDictSize {
@@ -1286,6 +1929,10 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 							}
 						}
 					}
+
+					if add == true && this.growHash == true {
+						this.updateHashSize(pe1 != nil)
+					}
 				} else {
 					// Word found in the dictionary
 					// Skip space if only delimiter between 2 word references
@@ -1305,6 +1952,7 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 					}
 
 					emitAnchor = delimAnchor + 1 + int(pe.data>>24)
+					hits += int(length)
 				}
 			}
 		}
@@ -1312,6 +1960,15 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 		// Reset delimiter position
 		delimAnchor = srcIdx
 		srcIdx++
+
+		if checkIdx != 0 && srcIdx >= checkIdx {
+			// Bail out early if the dictionary is not effective (EG. pseudo text)
+			if hits*100 < srcIdx*_TC_MIN_HIT_RATE {
+				return uint(srcIdx), uint(dstIdx), errors.New("Text transform skip: low dictionary hit rate")
+			}
+
+			checkIdx = 0
+		}
 	}
 
 	if err == nil {
@@ -1330,6 +1987,30 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 	return uint(srcIdx), uint(dstIdx), err
 }
 
+// updateHashSize records the addition of a word to the dictionary (failed if
+// collision is true) and doubles the size of the hash map if too many
+// additions failed since the last check
+func (this *textCodec2) updateHashSize(collision bool) {
+	this.hashAdds++
+
+	if collision == true {
+		this.hashCollisions++
+	}
+
+	if this.hashAdds < _TC_HASH_CHECK_SIZE {
+		return
+	}
+
+	if this.hashCollisions*100 > this.hashAdds*_TC_MAX_COLLISIONS && this.logHashSize < this.maxLogHash {
+		this.logHashSize++
+		this.hashMask = int32(1<<this.logHashSize) - 1
+		this.dictMap = rehashDictionary(this.dictMap, this.hashMask)
+	}
+
+	this.hashAdds = 0
+	this.hashCollisions = 0
+}
+
 func (this *textCodec2) expandDictionary() bool {
 	if this.dictSize >= _TC_MAX_DICT_SIZE {
 		return false
@@ -1346,6 +2027,10 @@ func (this *textCodec2) expandDictionary() bool {
 }
 
 func (this *textCodec2) emitSymbols(src, dst []byte) int {
+	if this.utf8Words == true {
+		return this.emitUTF8Symbols(src, dst)
+	}
+
 	dstIdx := 0
 
 	if 2*len(src) < len(dst) {
@@ -1419,6 +2104,67 @@ func (this *textCodec2) emitSymbols(src, dst []byte) int {
 	return dstIdx
 }
 
+// emitUTF8Symbols emits the symbols when UTF-8 letters are word characters:
+// the letters are not escaped but a letter starting a word is preceded by
+// _TC_ESCAPE_TOKEN2 (else it would be decoded as a word index)
+func (this *textCodec2) emitUTF8Symbols(src, dst []byte) int {
+	dstIdx := 0
+	dstEnd := len(dst)
+	inWord := false // src starts after a delimiter or a word index
+
+	for i := 0; i < len(src); {
+		cur := src[i]
+
+		if cur >= 0x80 {
+			if n := utf8LetterLength(src[i:]); n > 0 {
+				if inWord == false {
+					if dstIdx >= dstEnd {
+						return dstEnd + 1
+					}
+
+					dst[dstIdx] = _TC_ESCAPE_TOKEN2
+					dstIdx++
+				}
+
+				if dstIdx+n > dstEnd {
+					return dstEnd + 1
+				}
+
+				copy(dst[dstIdx:], src[i:i+n])
+				dstIdx += n
+				i += n
+				inWord = true
+				continue
+			}
+		}
+
+		i++
+
+		if cur == CR && this.isCRLF == true {
+			continue
+		}
+
+		if cur >= 0x80 || cur == _TC_ESCAPE_TOKEN1 || cur == _TC_ESCAPE_TOKEN2 {
+			if dstIdx >= dstEnd {
+				return dstEnd + 1
+			}
+
+			dst[dstIdx] = _TC_ESCAPE_TOKEN1
+			dstIdx++
+		}
+
+		if dstIdx >= dstEnd {
+			return dstEnd + 1
+		}
+
+		dst[dstIdx] = cur
+		dstIdx++
+		inWord = isText(cur)
+	}
+
+	return dstIdx
+}
+
 func emitWordIndex2(dst []byte, val, mask int) int {
 	// Emit word index (varint 5 bits + 7 bits + 7 bits)
 	// 1st byte: 0x80 => word idx, 0x40 => more bytes, 0x20 => toggle case 1st symbol
@@ -1443,17 +2189,19 @@ func emitWordIndex2(dst []byte, val, mask int) int {
 }
 
 func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
-	this.reset(len(dst))
-	var delimAnchor int // previous delimiter
+	dict := int(src[0] & _TC_MASK_DICT)
 
-	if isText(src[0]) {
-		delimAnchor = -1
-	} else {
-		delimAnchor = 0
+	if dict >= len(_TC_STATIC_DICTIONARIES) {
+		return 0, 0, errors.New("Text transform failed. Invalid static dictionary")
 	}
 
+	this.reset(len(dst), src[0]&_TC_MASK_ADAPTIVE != 0, dict)
+	this.utf8Words = src[0]&_TC_MASK_UNICODE != 0
+	delimAnchor := 0 // previous delimiter (the mode byte is not part of a word)
+
 	words := this.staticDictSize
 	wordRun := false
+	inWord := false // previous symbol is a word character
 	var err error
 	this.isCRLF = src[0]&_TC_MASK_CRLF != 0
 	srcIdx := 1
@@ -1468,9 +2216,36 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			dst[dstIdx] = cur
 			srcIdx++
 			dstIdx++
+			inWord = true
 			continue
 		}
 
+		if this.utf8Words == true {
+			if cur >= 0x80 && inWord == true {
+				// UTF-8 letter inside a word
+				n := utf8LetterLength(src[srcIdx:srcEnd])
+
+				if n == 0 || dstIdx+n > dstEnd {
+					err = errors.New("Text transform failed. Invalid input data")
+					break
+				}
+
+				copy(dst[dstIdx:], src[srcIdx:srcIdx+n])
+				srcIdx += n
+				dstIdx += n
+				continue
+			}
+
+			if cur == _TC_ESCAPE_TOKEN2 {
+				// Marker of a word starting with a UTF-8 letter
+				srcIdx++
+				wordRun = false
+				delimAnchor = srcIdx - 1
+				inWord = true
+				continue
+			}
+		}
+
 		if (srcIdx > delimAnchor+3) && isDelimiter(cur) {
 			length := int32(srcIdx - delimAnchor - 1) // length > 2
 
@@ -1495,7 +2270,9 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 				if pe == nil {
 					// Word not found in the dictionary or hash collision.
 					// Replace entry if not in static dictionary
-					if ((length > 3) || (words < _TC_THRESHOLD2)) && (pe1 == nil) {
+					add := (length > 3) || (words < _TC_THRESHOLD2)
+
+					if add == true && pe1 == nil {
 						pe = &this.dictList[words]
 
 						if int(pe.data&_TC_MASK_LENGTH) >= this.staticDictSize {
@@ -1516,6 +2293,10 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 							}
 						}
 					}
+
+					if add == true && this.growHash == true {
+						this.updateHashSize(pe1 != nil)
+					}
 				}
 			}
 		}
@@ -1575,6 +2356,7 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			// Flip case of first character
 			dst[dstIdx] ^= (cur & 0x20)
 			dstIdx += length
+			inWord = false
 		} else {
 			if cur == _TC_ESCAPE_TOKEN1 {
 				dst[dstIdx] = src[srcIdx]
@@ -1597,6 +2379,7 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 
 			wordRun = false
 			delimAnchor = srcIdx - 1
+			inWord = false
 		}
 	}
 
@@ -16,12 +16,19 @@ limitations under the License.
 package transform
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"math"
+	"math/bits"
 	"math/rand"
+	"strings"
 	"testing"
 	"time"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/internal/testutil"
 )
 
 func getTransform(name string) (kanzi.ByteTransform, error) {
@@ -81,85 +88,1439 @@ func getTransform(name string) (kanzi.ByteTransform, error) {
 		res, err := NewFSDCodecWithCtx(&ctx)
 		return res, err
 
+	case "LRM":
+		res, err := NewLRMCodecWithCtx(&ctx)
+		return res, err
+
+	case "JSON":
+		res, err := NewJSONCodecWithCtx(&ctx)
+		return res, err
+
+	case "GENOMIC":
+		res, err := NewGenomicCodecWithCtx(&ctx)
+		return res, err
+
+	case "IMG":
+		res, err := NewImageCodecWithCtx(&ctx)
+		return res, err
+
+	case "UTF16":
+		res, err := NewUTF16CodecWithCtx(&ctx)
+		return res, err
+
+	case "NUMERIC":
+		res, err := NewNumericCodecWithCtx(&ctx)
+		return res, err
+
+	case "ST4", "ST6":
+		ctx["stOrder"] = int(name[2] - '0')
+		res, err := NewSTWithCtx(&ctx)
+		return res, err
+
+	case "SPARSE":
+		res, err := NewSparseCodecWithCtx(&ctx)
+		return res, err
+
 	default:
 		panic(fmt.Errorf("No such transform: '%s'", name))
 	}
 }
 
-func TestLZ(b *testing.T) {
-	if err := testTransformCorrectness("LZ"); err != nil {
-		b.Errorf(err.Error())
+func TestLZ(b *testing.T) {
+	if err := testTransformCorrectness("LZ"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestLZX(b *testing.T) {
+	if err := testTransformCorrectness("LZX"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestLZP(b *testing.T) {
+	if err := testTransformCorrectness("LZP"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestROLZ(b *testing.T) {
+	if err := testTransformCorrectness("ROLZ"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestROLZX(b *testing.T) {
+	if err := testTransformCorrectness("ROLZX"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+// Reference match lengths: 4 bytes compared at a time
+func findMatchLZX4(src []byte, srcIdx, ref, maxMatch int) int {
+	bestLen := 0
+
+	for bestLen+4 <= maxMatch {
+		if diff := binary.LittleEndian.Uint32(src[srcIdx+bestLen:]) ^ binary.LittleEndian.Uint32(src[ref+bestLen:]); diff != 0 {
+			return bestLen + bits.TrailingZeros32(diff)>>3
+		}
+
+		bestLen += 4
+	}
+
+	return bestLen
+}
+
+func rolzMatchLength4(refBuf, curBuf []byte, maxMatch int) int {
+	n := 0
+
+	for n < maxMatch {
+		if diff := binary.LittleEndian.Uint32(refBuf[n:]) ^ binary.LittleEndian.Uint32(curBuf[n:]); diff != 0 {
+			return n + bits.TrailingZeros32(diff)>>3
+		}
+
+		n += 4
+	}
+
+	return n
+}
+
+// Matches ending within 8 bytes of the end of the buffer: the 8 byte
+// compares must neither read past the end nor change the match lengths
+func TestMatchExtensionNearEnd(b *testing.T) {
+	fmt.Println("Test match extension near the end of the buffer")
+	r := rand.New(rand.NewSource(12345))
+
+	for m := 1; m <= 48; m++ {
+		pattern := make([]byte, m)
+		r.Read(pattern)
+
+		// Mismatch at position d (no mismatch if d == m)
+		for d := max(m-12, 0); d <= m; d++ {
+			buf := make([]byte, 2*m) // exact size: any overread panics
+			copy(buf, pattern)
+			copy(buf[m:], pattern)
+
+			if d < m {
+				buf[m+d] ^= 0x5A
+			}
+
+			// LZX: maxMatch is the distance to the end of the buffer
+			for maxMatch := max(m-9, 0); maxMatch <= m; maxMatch++ {
+				if n1, n2 := findMatchLZX(buf, m, 0, maxMatch), findMatchLZX4(buf, m, 0, maxMatch); n1 != n2 {
+					b.Fatalf("LZX: size %d, mismatch at %d, max %d: got %d, expected %d", m, d, maxMatch, n1, n2)
+				}
+			}
+
+			// ROLZ: maxMatch is the distance to the end of the buffer - 4
+			if m >= 4 {
+				if n1, n2 := rolzMatchLength(buf, buf[m:], m-4), rolzMatchLength4(buf, buf[m:], m-4); n1 != n2 {
+					b.Fatalf("ROLZ: size %d, mismatch at %d: got %d, expected %d", m, d, n1, n2)
+				}
+			}
+		}
+	}
+
+	// Round trips with a long match ending at the end of the block or
+	// within 8 bytes of it
+	prefix := make([]byte, 4096)
+	r.Read(prefix)
+
+	for _, name := range []string{"LZX", "ROLZ", "ROLZX"} {
+		for k := 0; k <= 16; k++ {
+			input := append(append([]byte(nil), prefix...), prefix[1000:3000]...)
+
+			for i := 0; i < k; i++ {
+				input = append(input, byte(r.Intn(256)))
+			}
+
+			f, _ := getTransform(name)
+			output := make([]byte, f.MaxEncodedLen(len(input)))
+			_, dstIdx, err := f.Forward(input, output)
+
+			if err != nil {
+				b.Fatalf("%s: forward failed with %d trailing bytes: %v", name, k, err)
+			}
+
+			if int(dstIdx) > len(input)-1500 {
+				b.Fatalf("%s: long match not found with %d trailing bytes", name, k)
+			}
+
+			f, _ = getTransform(name)
+			res := make([]byte, len(input))
+			_, n, err := f.Inverse(output[0:dstIdx], res)
+
+			if err != nil || bytes.Equal(res[0:n], input) == false {
+				b.Fatalf("%s: round trip failed with %d trailing bytes: %v", name, k, err)
+			}
+		}
+	}
+}
+
+func TestCopy(b *testing.T) {
+	if err := testTransformCorrectness("NONE"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestAlias(b *testing.T) {
+	if err := testTransformCorrectness("ALIAS"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestZRLT(b *testing.T) {
+	if err := testTransformCorrectness("ZRLT"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestRLT(b *testing.T) {
+	if err := testTransformCorrectness("RLT"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing unit modes ===")
+
+	// 16-bit samples and 32-bit pixels held for a few units, odd sizes
+	samples := make([]byte, 2*30000+1)
+	pixels := make([]byte, 4*30000+3)
+
+	for i := 0; i < 30000; i += 8 {
+		s := uint16(rand.Intn(65536))
+		p := rand.Uint32()
+
+		for j := i; j < i+8; j++ {
+			binary.LittleEndian.PutUint16(samples[2*j:], s)
+			binary.LittleEndian.PutUint32(pixels[4*j:], p)
+		}
+	}
+
+	samples[len(samples)-1] = 0x7A
+	pixels[5] = _RLT_DEFAULT_ESCAPE // escaped literal
+
+	for i, data := range [][]byte{samples, pixels} {
+		ctx := make(map[string]any)
+		ctx[internal.SCRATCH_KEY] = &internal.BlockScratch{DataType: internal.DT_MULTIMEDIA}
+		f, _ := NewRLTWithCtx(&ctx)
+		output := make([]byte, f.MaxEncodedLen(len(data)))
+		reverse := make([]byte, len(data))
+		_, dstIdx, err := f.Forward(data, output)
+
+		if err != nil {
+			b.Fatalf("Data %d: forward failed: %v", i, err)
+		}
+
+		fmt.Printf("Data %d: unit size %d, %d => %d\n", i, output[2]&7, len(data), dstIdx)
+
+		if output[0] != output[1] || int(output[2]&7) != 2*(i+1) || dstIdx > uint(len(data)/3) {
+			b.Errorf("Data %d: unit mode not selected", i)
+		}
+
+		f, _ = NewRLTWithCtx(&ctx)
+		_, m, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("Data %d: inverse failed: %v", i, err)
+		}
+
+		if bytes.Equal(data, reverse[0:m]) == false {
+			b.Errorf("Data %d: input and inverse are different", i)
+		}
+	}
+}
+
+func TestSRT(b *testing.T) {
+	if err := testTransformCorrectness("SRT"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestST(b *testing.T) {
+	for _, name := range []string{"ST4", "ST6"} {
+		if err := testTransformCorrectness(name); err != nil {
+			b.Errorf(err.Error())
+		}
+	}
+
+	// All orders, blocks shorter than the context included, small alphabets
+	// at both ends of the byte range
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for order := _ST_MIN_ORDER; order <= _ST_MAX_ORDER; order++ {
+		st, _ := NewST(order)
+
+		for n := 1; n < 300; n += 7 {
+			input := make([]byte, n)
+
+			for i := range input {
+				input[i] = byte(rnd.Intn(1+n&15)) + byte(n&2)*120
+			}
+
+			output := make([]byte, st.MaxEncodedLen(n))
+			_, dstIdx, err := st.Forward(input, output)
+
+			if err != nil {
+				b.Fatalf("Order %d, size %d: forward failed: %v", order, n, err)
+			}
+
+			reverse := make([]byte, n)
+			_, dstIdx, err = st.Inverse(output[0:dstIdx], reverse)
+
+			if err != nil || int(dstIdx) != n || bytes.Equal(input, reverse) == false {
+				b.Fatalf("Order %d, size %d: invalid inverse (%v)", order, n, err)
+			}
+		}
+	}
+
+	// Order 4: the text is grouped by context as with a BWT
+	st, _ := NewST(4)
+	input := []byte(strings.Repeat("the cat sat on the mat, the dog sat on the log. ", 20))
+	output := make([]byte, st.MaxEncodedLen(len(input)))
+	_, dstIdx, _ := st.Forward(input, output)
+	runs := func(buf []byte) int {
+		res := 1
+
+		for i := 1; i < len(buf); i++ {
+			if buf[i] != buf[i-1] {
+				res++
+			}
+		}
+
+		return res
+	}
+
+	data := output[2+int(output[0]&0x03) : dstIdx] // skip the header
+
+	if runs(data) >= runs(input)/4 {
+		b.Errorf("Too many runs after ST4: %d (%d before)", runs(data), runs(input))
+	}
+
+	if _, err := NewST(9); err == nil {
+		b.Errorf("Missing error for invalid order")
+	}
+
+	output[0] = 0x3F // order 15
+
+	if _, _, err := st.Inverse(output[0:dstIdx], make([]byte, len(input))); err == nil {
+		b.Errorf("Missing error for invalid header")
+	}
+}
+
+func TestSparse(b *testing.T) {
+	if err := testTransformCorrectness("SPARSE"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	// Disk image like block: zero pages, data pages, a copy of a range of
+	// pages, runs of identical pages and an incomplete trailing page
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	input := make([]byte, 64*_SPARSE_PAGE_SIZE+1000)
+	rnd.Read(input[0 : 8*_SPARSE_PAGE_SIZE])
+	copy(input[20*_SPARSE_PAGE_SIZE:], input[0:8*_SPARSE_PAGE_SIZE])
+	rnd.Read(input[40*_SPARSE_PAGE_SIZE : 41*_SPARSE_PAGE_SIZE])
+
+	for i := 41; i < 50; i++ {
+		copy(input[i*_SPARSE_PAGE_SIZE:], input[40*_SPARSE_PAGE_SIZE:41*_SPARSE_PAGE_SIZE])
+	}
+
+	rnd.Read(input[60*_SPARSE_PAGE_SIZE:])
+	input[55*_SPARSE_PAGE_SIZE+17] = 1
+	codec, _ := NewSparseCodec()
+	output := make([]byte, codec.MaxEncodedLen(len(input)))
+	_, dstIdx, err := codec.Forward(input, output)
+
+	if err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	// 8 + 1 + 1 + 4 literal pages and the trailing bytes
+	if expected := 14*_SPARSE_PAGE_SIZE + 1000; int(dstIdx) < expected || int(dstIdx) > expected+64 {
+		b.Errorf("Unexpected encoded size: %d (literals: %d)", dstIdx, expected)
+	}
+
+	reverse := make([]byte, len(input))
+	_, n, err := codec.Inverse(output[0:dstIdx], reverse)
+
+	if err != nil || int(n) != len(input) || bytes.Equal(input, reverse) == false {
+		b.Fatalf("Invalid inverse (%v)", err)
+	}
+
+	// Output buffer too small
+	if _, _, err := codec.Inverse(output[0:dstIdx], reverse[0:len(input)-2000]); err == nil {
+		b.Errorf("Missing error for small output buffer")
+	}
+
+	output[0] = 0
+
+	if _, _, err := codec.Inverse(output[0:dstIdx], reverse); err == nil {
+		b.Errorf("Missing error for invalid header")
+	}
+
+	// No sparse page: skip
+	rnd.Read(input)
+
+	if _, _, err := codec.Forward(input, output); err == nil {
+		b.Errorf("Missing error for random data")
+	}
+}
+
+func TestMM(b *testing.T) {
+	if err := testTransformCorrectness("MM"); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+func TestLRM(b *testing.T) {
+	if err := testTransformCorrectness("LRM"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	// Repeats far beyond the LZ windows
+	fmt.Println("=== Testing LRM long distance matches ===")
+	input := make([]byte, 40<<20)
+	chunk := make([]byte, 1<<20)
+
+	for i := range input {
+		input[i] = byte(rand.Intn(256))
+	}
+
+	copy(chunk, input[100:])
+	copy(input[(32<<20)+17:], chunk)
+	copy(input[(39<<20)+5:], chunk[0:1000])
+	f, _ := NewLRMCodec()
+	output := make([]byte, f.MaxEncodedLen(len(input)))
+	_, dstIdx, err := f.Forward(input, output)
+
+	if err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	fmt.Printf("%d => %d\n", len(input), dstIdx)
+
+	if int(dstIdx) > len(input)-len(chunk) {
+		b.Errorf("Long distance match not found: %d => %d", len(input), dstIdx)
+	}
+
+	reverse := make([]byte, len(input))
+	f, _ = NewLRMCodec()
+
+	if _, _, err = f.Inverse(output[0:dstIdx], reverse); err != nil {
+		b.Fatalf("Inverse failed: %v", err)
+	}
+
+	if !bytes.Equal(input, reverse) {
+		b.Errorf("Roundtrip failed")
+	}
+}
+
+func TestJSON(b *testing.T) {
+	if err := testTransformCorrectness("JSON"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing JSON records ===")
+	var buf bytes.Buffer
+	levels := []string{"info", "warn", "error"}
+
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&buf, `{"ts":%d,"level":"%s","msg":"request \"%d\" done","latency":%.3f,`,
+			int64(1700000000000)+int64(i*17), levels[rand.Intn(3)], i, rand.Float64()*100)
+		fmt.Fprintf(&buf, `"ok":%v,"user":null,"tags":["a","b\u00e9"],"k%d": -1.5e-3}`+"\n", i%7 != 0, i%200)
+	}
+
+	data := buf.Bytes()
+
+	// Whole records, then blocks starting and ending in the middle of a record
+	for _, block := range [][]byte{data, data[13 : len(data)-29], data[1 : len(data)/3]} {
+		f, _ := getTransform("JSON")
+		output := make([]byte, f.MaxEncodedLen(len(block)))
+		reverse := make([]byte, len(block))
+		_, dstIdx, err := f.Forward(block, output)
+
+		if err != nil {
+			b.Fatalf("Forward failed: %v", err)
+		}
+
+		fmt.Printf("%d => %d bytes\n", len(block), dstIdx)
+		f, _ = getTransform("JSON")
+		_, n, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("Inverse failed: %v", err)
+		}
+
+		if bytes.Equal(block, reverse[0:n]) == false {
+			b.Errorf("Input and inverse are different")
+		}
+
+		// Truncated data must be reported
+		if _, _, err = f.Inverse(output[0:10], reverse); err == nil {
+			b.Errorf("Truncated data: no error reported")
+		}
+	}
+
+	// Plain text is not JSON
+	f, _ := getTransform("JSON")
+	text := bytes.Repeat([]byte("Some plain text, not JSON: {x} {y}. "), 100)
+
+	if _, _, err := f.Forward(text, make([]byte, f.MaxEncodedLen(len(text)))); err == nil {
+		b.Errorf("Plain text: JSON transform not skipped")
+	}
+}
+
+func TestUTF16(b *testing.T) {
+	if err := testTransformCorrectness("UTF16"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing UTF-16 text ===")
+	var buf bytes.Buffer
+
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "INSERT INTO logs VALUES (%d, 'Événement reçu', 'ok');\r\n", i)
+	}
+
+	text := []rune(buf.String())
+	le := make([]byte, 2+2*len(text))
+	be := make([]byte, 2*len(text))
+	le[0], le[1] = 0xFF, 0xFE // BOM
+
+	for i, r := range text {
+		binary.LittleEndian.PutUint16(le[2+2*i:], uint16(r))
+		binary.BigEndian.PutUint16(be[2*i:], uint16(r))
+	}
+
+	// Blocks with and without BOM, starting in the middle of a code unit,
+	// with an odd size
+	for _, block := range [][]byte{le, be, le[3:], be[0 : len(be)-1]} {
+		freqs0 := [256]int{}
+
+		if dt := computeTextStats(block, freqs0[:], true, false) & _TC_MASK_DT; internal.DataType(dt) != internal.DT_UTF16 {
+			b.Errorf("UTF-16 text not detected: data type %d", dt)
+		}
+
+		f, _ := getTransform("UTF16")
+		output := make([]byte, f.MaxEncodedLen(len(block)))
+		reverse := make([]byte, len(block))
+		_, dstIdx, err := f.Forward(block, output)
+
+		if err != nil {
+			b.Fatalf("Forward failed: %v", err)
+		}
+
+		fmt.Printf("%d => %d bytes\n", len(block), dstIdx)
+
+		if int(dstIdx) > len(block)/2+len(block)/16 {
+			b.Errorf("Zero bytes not removed: %d => %d bytes", len(block), dstIdx)
+		}
+
+		f, _ = getTransform("UTF16")
+		_, n, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("Inverse failed: %v", err)
+		}
+
+		if bytes.Equal(block, reverse[0:n]) == false {
+			b.Errorf("Input and inverse are different")
+		}
+	}
+
+	// Plain 8 bit text is not UTF-16
+	f, _ := getTransform("UTF16")
+	plain := []byte(buf.String())
+
+	if _, _, err := f.Forward(plain, make([]byte, f.MaxEncodedLen(len(plain)))); err == nil {
+		b.Errorf("Plain text: UTF16 transform not skipped")
+	}
+}
+
+func TestNumeric(b *testing.T) {
+	if err := testTransformCorrectness("NUMERIC"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing numeric arrays ===")
+	n := 20000
+	timestamps := make([]byte, 8*n+5) // trailing bytes
+	samples := make([]byte, 2*n)
+	doubles := make([]byte, 8*n)
+	ts := uint64(1700000000000)
+	val := int16(0)
+
+	for i := 0; i < n; i++ {
+		ts += uint64(1000 + rand.Intn(5))
+		val += int16(rand.Intn(21) - 10)
+		binary.LittleEndian.PutUint64(timestamps[8*i:], ts)
+		binary.BigEndian.PutUint16(samples[2*i:], uint16(val))
+		binary.LittleEndian.PutUint64(doubles[8*i:], math.Float64bits(20.0+float64(i%100)*0.25))
+	}
+
+	for i, data := range [][]byte{timestamps, samples, doubles} {
+		f, _ := getTransform("NUMERIC")
+		output := make([]byte, f.MaxEncodedLen(len(data)))
+		reverse := make([]byte, len(data))
+		_, dstIdx, err := f.Forward(data, output)
+
+		if err != nil {
+			b.Fatalf("Array %d: forward failed: %v", i, err)
+		}
+
+		histo1 := [256]int{}
+		histo2 := [256]int{}
+		internal.ComputeHistogram(data, histo1[:], true, false)
+		internal.ComputeHistogram(output[0:dstIdx], histo2[:], true, false)
+		e1 := internal.ComputeFirstOrderEntropy1024(len(data), histo1[:])
+		e2 := internal.ComputeFirstOrderEntropy1024(int(dstIdx), histo2[:])
+		fmt.Printf("Array %d: mode %d, entropy %d => %d\n", i, output[0], e1, e2)
+
+		if e2 >= e1-e1/4 {
+			b.Errorf("Array %d: no entropy reduction (%d => %d)", i, e1, e2)
+		}
+
+		f, _ = getTransform("NUMERIC")
+		_, m, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("Array %d: inverse failed: %v", i, err)
+		}
+
+		if bytes.Equal(data, reverse[0:m]) == false {
+			b.Errorf("Array %d: input and inverse are different", i)
+		}
+	}
+
+	// Random data is skipped
+	random := make([]byte, 4096)
+	rand.Read(random)
+	f, _ := getTransform("NUMERIC")
+
+	if _, _, err := f.Forward(random, make([]byte, f.MaxEncodedLen(len(random)))); err == nil {
+		b.Errorf("Random data: NUMERIC transform not skipped")
+	}
+}
+
+func TestGenomic(b *testing.T) {
+	if err := testTransformCorrectness("GENOMIC"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing GENOMIC FASTA/FASTQ ===")
+	randomBases := func(n int) string {
+		buf := make([]byte, n)
+
+		for i := range buf {
+			buf[i] = "ACGT"[rand.Intn(4)]
+		}
+
+		if n > 40 {
+			copy(buf[n/2:], "NNNNNNNN")
+		}
+
+		return string(buf)
+	}
+
+	var fasta, fastq bytes.Buffer
+
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&fasta, ">chr%d description %d\n", i, i*i)
+
+		for j := 0; j < 1+i%5; j++ {
+			fmt.Fprintf(&fasta, "%s\n", randomBases(60))
+		}
+
+		fmt.Fprintf(&fasta, "%s\n", randomBases(1+rand.Intn(59)))
+		seq := randomBases(100 + i%3)
+		qual := make([]byte, len(seq))
+
+		for j := range qual {
+			qual[j] = byte(33 + rand.Intn(41))
+		}
+
+		fmt.Fprintf(&fastq, "@read.%d/1\n%s\n+\n%s\n", i, seq, qual)
+	}
+
+	data := fasta.Bytes()
+	reads := fastq.Bytes()
+	blocks := [][]byte{data, data[17 : len(data)-33], reads, reads[5 : len(reads)-7], reads[0 : len(reads)-1]}
+
+	for _, block := range blocks {
+		f, _ := getTransform("GENOMIC")
+		output := make([]byte, f.MaxEncodedLen(len(block)))
+		reverse := make([]byte, len(block))
+		_, dstIdx, err := f.Forward(block, output)
+
+		if err != nil {
+			b.Fatalf("Forward failed: %v", err)
+		}
+
+		fmt.Printf("%d => %d bytes\n", len(block), dstIdx)
+		f, _ = getTransform("GENOMIC")
+		_, n, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("Inverse failed: %v", err)
+		}
+
+		if bytes.Equal(block, reverse[0:n]) == false {
+			b.Errorf("Input and inverse are different")
+		}
+
+		if _, _, err = f.Inverse(output[0:dstIdx/2], reverse); err == nil {
+			b.Errorf("Truncated data: no error reported")
+		}
+	}
+}
+
+func TestImage(b *testing.T) {
+	if err := testTransformCorrectness("IMG"); err != nil {
+		b.Errorf(err.Error())
+	}
+
+	fmt.Println("=== Testing IMG images ===")
+	width, height := 301, 200
+	pixels := make([]byte, 0, 4*width*height)
+
+	// Smooth RGB gradients with some noise
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pixels = append(pixels, byte(x+y+rand.Intn(4)), byte(2*x-y), byte(x*y/64+rand.Intn(2)))
+		}
+	}
+
+	ppm := append([]byte(fmt.Sprintf("P6\n# comment\n%d %d\n255\n", width, height)), pixels...)
+	bmp := make([]byte, 54)
+	stride := (width*3 + 3) &^ 3
+	copy(bmp, "BM")
+	binary.LittleEndian.PutUint32(bmp[10:], 54)
+	binary.LittleEndian.PutUint32(bmp[14:], 40)
+	binary.LittleEndian.PutUint32(bmp[18:], uint32(width))
+	binary.LittleEndian.PutUint32(bmp[22:], uint32(height))
+	binary.LittleEndian.PutUint16(bmp[26:], 1)
+	binary.LittleEndian.PutUint16(bmp[28:], 24)
+
+	for y := 0; y < height; y++ {
+		bmp = append(bmp, pixels[y*width*3:(y+1)*width*3]...)
+		bmp = append(bmp, make([]byte, stride-width*3)...)
+	}
+
+	tests := []struct {
+		name  string
+		data  []byte
+		width uint
+	}{
+		{"PPM", ppm, 0},
+		{"PPM (truncated)", ppm[0 : len(ppm)-1000], 0},
+		{"BMP", bmp, 0},
+		{"Raw RGB", pixels, uint(width)},
+	}
+
+	for _, test := range tests {
+		ctx := map[string]any{}
+
+		if test.width != 0 {
+			ctx["imageWidth"] = test.width
+			ctx["imageBpp"] = uint(3)
+		}
+
+		f, _ := NewImageCodecWithCtx(&ctx)
+		output := make([]byte, f.MaxEncodedLen(len(test.data)))
+		reverse := make([]byte, len(test.data))
+		_, dstIdx, err := f.Forward(test.data, output)
+
+		if err != nil {
+			b.Fatalf("%s: forward failed: %v", test.name, err)
+		}
+
+		fmt.Printf("%s: %d => %d bytes\n", test.name, len(test.data), dstIdx)
+		f, _ = NewImageCodec()
+		_, n, err := f.Inverse(output[0:dstIdx], reverse)
+
+		if err != nil {
+			b.Fatalf("%s: inverse failed: %v", test.name, err)
+		}
+
+		if bytes.Equal(test.data, reverse[0:n]) == false {
+			b.Errorf("%s: input and inverse are different", test.name)
+		}
+	}
+
+	// Raw pixels without geometry are not detected
+	f, _ := NewImageCodec()
+
+	if _, _, err := f.Forward(pixels, make([]byte, f.MaxEncodedLen(len(pixels)))); err == nil {
+		b.Errorf("Raw pixels without geometry: transform not skipped")
+	}
+}
+
+func TestPriming(b *testing.T) {
+	fmt.Println("=== Testing LZ and ROLZ priming data ===")
+	priming := []byte(`{"user":{"id":0,"name":"","email":"","roles":["admin","editor","viewer"],` +
+		`"settings":{"theme":"dark","language":"en-US","notifications":true}},"status":"active"}`)
+	msg := []byte(`{"user":{"id":4217,"name":"Alice","email":"alice@example.com","roles":["editor","viewer"],` +
+		`"settings":{"theme":"dark","language":"en-US","notifications":false}},"status":"active"}`)
+
+	for _, name := range []string{"LZ", "LZX", "ROLZ"} {
+		sizes := [2]uint{}
+
+		for i := range sizes {
+			ctx := map[string]any{"transform": name, "bsVersion": uint(6)}
+
+			if name == "LZX" {
+				ctx["lz"] = LZX_TYPE
+			}
+
+			if i == 1 {
+				ctx[internal.SCRATCH_KEY] = &internal.BlockScratch{Dictionary: priming}
+			}
+
+			var f kanzi.ByteTransform
+
+			if name == "ROLZ" {
+				f, _ = NewROLZCodecWithCtx(&ctx)
+			} else {
+				f, _ = NewLZCodecWithCtx(&ctx)
+			}
+
+			output := make([]byte, f.MaxEncodedLen(len(msg)))
+			srcIdx, dstIdx, err := f.Forward(msg, output)
+
+			if i == 0 {
+				// Without priming, the message may not be compressible
+				sizes[i] = uint(len(msg))
+
+				if err == nil {
+					sizes[i] = dstIdx
+				}
+
+				continue
+			}
+
+			if err != nil || srcIdx != uint(len(msg)) {
+				b.Fatalf("%s: forward with priming failed: %v", name, err)
+			}
+
+			sizes[i] = dstIdx
+			reverse := make([]byte, len(msg))
+
+			if name == "ROLZ" {
+				f, _ = NewROLZCodecWithCtx(&ctx)
+			} else {
+				f, _ = NewLZCodecWithCtx(&ctx)
+			}
+
+			if _, dstIdx, err = f.Inverse(output[0:sizes[i]], reverse); err != nil {
+				b.Fatalf("%s: inverse with priming failed: %v", name, err)
+			}
+
+			if !bytes.Equal(msg, reverse[0:dstIdx]) {
+				b.Errorf("%s: roundtrip with priming failed", name)
+			}
+
+			// Decoding requires the priming data
+			delete(ctx, internal.SCRATCH_KEY)
+
+			if name == "ROLZ" {
+				f, _ = NewROLZCodecWithCtx(&ctx)
+			} else {
+				f, _ = NewLZCodecWithCtx(&ctx)
+			}
+
+			if _, _, err = f.Inverse(output[0:sizes[i]], reverse); err == nil {
+				b.Errorf("%s: inverse without priming data should fail", name)
+			}
+		}
+
+		fmt.Printf("%s: %d => %d (no priming), %d (priming)\n", name, len(msg), sizes[0], sizes[1])
+
+		if sizes[1] >= sizes[0] {
+			b.Errorf("%s: priming data did not improve compression", name)
+		}
+	}
+}
+
+func TestTextCodecHitRate(b *testing.T) {
+	fmt.Println("=== Testing TextCodec bail out on pseudo text ===")
+	r := rand.New(rand.NewSource(12345))
+	words := [][]byte{[]byte("The"), []byte("house"), []byte("which"), []byte("would"), []byte("there")}
+	text := make([]byte, 0, 1<<20)
+	pseudo := make([]byte, 0, 1<<20)
+
+	for len(text) < 1<<20 {
+		text = append(text, words[r.Intn(len(words))]...)
+		text = append(text, ' ')
+	}
+
+	for len(pseudo) < 1<<20 {
+		for n := 2 + r.Intn(8); n > 0; n-- {
+			pseudo = append(pseudo, byte('a'+r.Intn(26)))
+		}
+
+		pseudo = append(pseudo, ' ')
+	}
+
+	for i, input := range [][]byte{text, pseudo} {
+		ctx := map[string]any{"transform": "TEXT", "bsVersion": uint(6)}
+		f, _ := NewTextCodecWithCtx(&ctx)
+		output := make([]byte, f.MaxEncodedLen(len(input)))
+		srcIdx, dstIdx, err := f.Forward(input, output)
+
+		if i == 0 && err != nil {
+			b.Errorf("Text transform failed on text: %v", err)
+		}
+
+		if i == 1 {
+			if err == nil {
+				b.Errorf("Text transform did not skip pseudo text")
+			} else if srcIdx >= uint(len(input)) {
+				b.Errorf("Text transform did not bail out early: %d bytes processed", srcIdx)
+			}
+		}
+
+		fmt.Printf("%d => %d (%v)\n", srcIdx, dstIdx, err)
+	}
+}
+
+func TestTextCodecAdaptiveHash(b *testing.T) {
+	fmt.Println("=== Testing TextCodec adaptive hash size ===")
+	r := rand.New(rand.NewSource(12345))
+	vocabulary := make([][]byte, 100000)
+
+	for i := range vocabulary {
+		for n := 4 + r.Intn(6); n > 0; n-- {
+			vocabulary[i] = append(vocabulary[i], byte('a'+r.Intn(26)))
+		}
+	}
+
+	dense := make([]byte, 0, 8<<20)
+	sparse := make([]byte, 0, 8<<20)
+	zipf := rand.NewZipf(r, 1.1, 1, uint64(len(vocabulary)-1))
+
+	for len(dense) < 8<<20 {
+		dense = append(dense, vocabulary[zipf.Uint64()]...)
+		dense = append(dense, ' ')
+	}
+
+	for len(sparse) < 8<<20 {
+		sparse = append(sparse, vocabulary[r.Intn(100)]...)
+		sparse = append(sparse, ' ')
+	}
+
+	// The mode byte of CRLF text with an adaptive hash is a letter ('P')
+	crlf := []byte(strings.Repeat("Hello world, this is some text\r\nAnother line with words\r\n", 20000))
+
+	for _, codec := range []int{1, 2} {
+		for _, bsVersion := range []uint{6, 7} {
+			for i, input := range [][]byte{dense, sparse, crlf} {
+				ctx := map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)),
+					"bsVersion": bsVersion}
+				f, _ := NewTextCodecWithCtx(&ctx)
+				output := make([]byte, f.MaxEncodedLen(len(input)))
+				_, dstIdx, err := f.Forward(input, output)
+
+				if err != nil {
+					b.Fatalf("Text transform failed: %v", err)
+				}
+
+				var base, log uint
+
+				if codec == 1 {
+					base, log = f.delegate.(*textCodec1).baseLogHash, f.delegate.(*textCodec1).logHashSize
+				} else {
+					base, log = f.delegate.(*textCodec2).baseLogHash, f.delegate.(*textCodec2).logHashSize
+				}
+
+				fmt.Printf("codec %d, version %d, input %d: %d => %d, hash size %d (default %d)\n",
+					codec, bsVersion, i, len(input), dstIdx, log, base)
+
+				if bsVersion < 7 && log != base {
+					b.Errorf("Unexpected hash size: %d, expected %d", log, base)
+				}
+
+				if bsVersion >= 7 && i == 0 && log <= base-_TC_LOG_HASH_DELTA {
+					b.Errorf("The hash size did not grow on dense text: %d", log)
+				}
+
+				if bsVersion >= 7 && i == 1 && log != base-_TC_LOG_HASH_DELTA {
+					b.Errorf("The hash size grew on sparse text: %d", log)
+				}
+
+				ctx = map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)),
+					"bsVersion": bsVersion}
+				f, _ = NewTextCodecWithCtx(&ctx)
+				res := make([]byte, len(input))
+
+				if _, _, err = f.Inverse(output[0:dstIdx], res); err != nil {
+					b.Fatalf("Inverse text transform failed: %v", err)
+				}
+
+				if bytes.Equal(res, input) == false {
+					b.Errorf("Roundtrip failed (codec %d, version %d, input %d)", codec, bsVersion, i)
+				}
+			}
+		}
+	}
+}
+
+func TestTextCodecUnicode(b *testing.T) {
+	fmt.Println("=== Testing TextCodec UTF-8 words ===")
+	r := rand.New(rand.NewSource(12345))
+	syllables := [][]string{
+		{"ra", "ver", "mai", "son", "ré", "gle", "œu", "vre", "fa", "çon", "tê", "te", "è", "à", "ou", "ça"},
+		{"stra", "ße", "grü", "ne", "bä", "ren", "schön", "ö", "über", "ge", "hen", "ä", "ung", "ei"},
+		{"ра", "ско", "вед", "мир", "дом", "ного", "лю", "пре", "ство", "жи", "ть", "ы", "щи", "ё"},
+	}
+	symbols := []string{", ", ". ", "\n", " « ", " » ", "\u00a0", " © ", " 42 ", "\x0e", "\x0f", "€", "-"}
+	inputs := make([][]byte, 0)
+
+	for lang := range syllables {
+		vocabulary := make([]string, 500)
+
+		for i := range vocabulary {
+			for n := 2 + r.Intn(3); n > 0; n-- {
+				vocabulary[i] += syllables[lang][r.Intn(len(syllables[lang]))]
+			}
+		}
+
+		// Start with a word made of UTF-8 letters
+		input := []byte(syllables[lang][len(syllables[lang])-1] + vocabulary[0])
+
+		for len(input) < 1<<20 {
+			word := vocabulary[r.Intn(len(vocabulary))]
+
+			if r.Intn(8) == 0 {
+				word = strings.ToUpper(word[0:1]) + word[1:]
+			}
+
+			input = append(input, word...)
+
+			if r.Intn(16) == 0 {
+				input = append(input, symbols[r.Intn(len(symbols))]...)
+			} else {
+				input = append(input, ' ')
+			}
+		}
+
+		inputs = append(inputs, input)
+	}
+
+	crlf := strings.ReplaceAll(string(inputs[0][0:1<<18]), "\r", "")
+	inputs = append(inputs, []byte(strings.ReplaceAll(crlf, "\n", "\r\n")))
+
+	for _, codec := range []int{1, 2} {
+		for i, input := range inputs {
+			sizes := [2]int{}
+
+			for j, bsVersion := range []uint{6, 7} {
+				ctx := map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)),
+					"bsVersion": bsVersion}
+				f, _ := NewTextCodecWithCtx(&ctx)
+				output := make([]byte, f.MaxEncodedLen(len(input)))
+				_, dstIdx, err := f.Forward(input, output)
+
+				if err != nil {
+					if bsVersion >= 7 {
+						b.Fatalf("Text transform failed (codec %d, input %d): %v", codec, i, err)
+					}
+
+					sizes[j] = len(input)
+					continue
+				}
+
+				sizes[j] = int(dstIdx)
+				ctx = map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)),
+					"bsVersion": bsVersion}
+				f, _ = NewTextCodecWithCtx(&ctx)
+				res := make([]byte, len(input))
+
+				if _, _, err = f.Inverse(output[0:dstIdx], res); err != nil {
+					b.Fatalf("Inverse text transform failed (codec %d, version %d, input %d): %v", codec, bsVersion, i, err)
+				}
+
+				if bytes.Equal(res, input) == false {
+					b.Errorf("Roundtrip failed (codec %d, version %d, input %d)", codec, bsVersion, i)
+				}
+			}
+
+			fmt.Printf("codec %d, input %d: %d => %d (version 6), %d (version 7)\n", codec, i, len(input), sizes[0], sizes[1])
+
+			if sizes[1]*10 > sizes[0]*9 {
+				b.Errorf("No gain with UTF-8 words (codec %d, input %d): %d => %d", codec, i, sizes[0], sizes[1])
+			}
+		}
+	}
+}
+
+func TestTextCodecDictionaries(b *testing.T) {
+	fmt.Println("=== Testing TextCodec static dictionaries ===")
+	texts := map[string]string{
+		"en": `The history of the city is closely related to the development of the region. During the last century, ` +
+			`the population grew very quickly because many people came from other countries to work in the new ` +
+			`factories. Today, most of them live in the suburbs and they still travel every day to the center. `,
+		"fr": `L'histoire de la ville est très liée au développement de la région. Pendant le dernier siècle, la ` +
+			`population a beaucoup augmenté parce que de nombreuses personnes sont venues des autres pays pour ` +
+			`travailler dans les nouvelles usines. Aujourd'hui, la plupart vivent en banlieue et elles vont ` +
+			`encore chaque jour au centre. Il était déjà très difficile de trouver une maison près de l'école. `,
+		"de": `Die Geschichte der Stadt ist eng mit der Entwicklung der Region verbunden. Während des letzten ` +
+			`Jahrhunderts ist die Bevölkerung sehr schnell gewachsen, weil viele Menschen aus anderen Ländern ` +
+			`kamen, um in den neuen Fabriken zu arbeiten. Heute leben die meisten von ihnen außerhalb und fahren ` +
+			`noch jeden Tag in das Zentrum. Es wäre für sie natürlich schöner, näher an der Arbeit zu wohnen. `,
+		"es": `La historia de la ciudad está muy relacionada con el desarrollo de la región. Durante el último ` +
+			`siglo, la población creció muy rápido porque muchas personas llegaron de otros países para trabajar ` +
+			`en las nuevas fábricas. Hoy, la mayoría vive en las afueras y todavía viaja cada día al centro. ` +
+			`También es difícil encontrar una casa pequeña cerca del trabajo, según los niños de la familia. `,
+		"pt": `A história da cidade está muito ligada ao desenvolvimento da região. Durante o último século, a ` +
+			`população cresceu muito rápido porque muitas pessoas chegaram de outros países para trabalhar nas ` +
+			`novas fábricas. Hoje, a maioria vive nos subúrbios e ainda viaja todos os dias até o centro. Não ` +
+			`é fácil encontrar uma casa perto do trabalho, então eles também não têm muitas opções. `,
+		"code": `static int read_value(const char *buffer, size_t len, int *result) {\n` +
+			`    if (buffer == NULL || len == 0) {\n        return -1;\n    }\n` +
+			`    for (int index = 0; index < len; index++) {\n        *result = (*result << 1) + buffer[index];\n    }\n` +
+			`    return 0;\n}\n\nfunc (self *node) next_item(key string) (value string, err error) {\n` +
+			`    item, ok := self.items[key];\n    if ok == false { return "", error_not_found; }\n    return item.value, nil;\n}\n`,
 	}
-}
 
-func TestLZX(b *testing.T) {
-	if err := testTransformCorrectness("LZX"); err != nil {
-		b.Errorf(err.Error())
+	for lang, text := range texts {
+		input := []byte(text)
+
+		for len(input) < 2048 {
+			input = append(input, text...)
+		}
+
+		for _, codec := range []int{1, 2} {
+			sizes := make(map[string]int)
+
+			for _, name := range []string{"auto", "en", lang} {
+				ctx := map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)),
+					"bsVersion": uint(7), "lang": name}
+				f, err := NewTextCodecWithCtx(&ctx)
+
+				if err != nil {
+					b.Fatalf("Cannot create text codec: %v", err)
+				}
+
+				output := make([]byte, f.MaxEncodedLen(len(input)))
+				_, dstIdx, err := f.Forward(input, output)
+
+				if err != nil {
+					b.Fatalf("Text transform failed (codec %d, %s, lang %s): %v", codec, lang, name, err)
+				}
+
+				if name == "auto" && _TC_LANG_NAMES[output[0]&_TC_MASK_DICT] != lang {
+					b.Errorf("Wrong dictionary selected for %s text: %s", lang, _TC_LANG_NAMES[output[0]&_TC_MASK_DICT])
+				}
+
+				sizes[name] = int(dstIdx)
+
+				// The decoder does not need the language
+				ctx = map[string]any{"transform": "TEXT", "textcodec": codec, "blockSize": uint(len(input)), "bsVersion": uint(7)}
+				f, _ = NewTextCodecWithCtx(&ctx)
+				res := make([]byte, len(input))
+
+				if _, _, err = f.Inverse(output[0:dstIdx], res); err != nil {
+					b.Fatalf("Inverse text transform failed (codec %d, %s, lang %s): %v", codec, lang, name, err)
+				}
+
+				if bytes.Equal(res, input) == false {
+					b.Errorf("Roundtrip failed (codec %d, %s, lang %s)", codec, lang, name)
+				}
+
+				if name == "code" {
+					// Corrupted dictionary
+					output[0] |= _TC_MASK_DICT
+
+					if _, _, err = f.Inverse(output[0:dstIdx], res); err == nil {
+						b.Errorf("No error with an invalid dictionary")
+					}
+				}
+			}
+
+			fmt.Printf("codec %d, %s: %d => %d (en: %d)\n", codec, lang, len(input), sizes[lang], sizes["en"])
+
+			if lang != "en" && sizes[lang] >= sizes["en"] {
+				b.Errorf("No gain with the %s dictionary (codec %d): %d => %d", lang, codec, sizes["en"], sizes[lang])
+			}
+		}
 	}
-}
 
-func TestLZP(b *testing.T) {
-	if err := testTransformCorrectness("LZP"); err != nil {
-		b.Errorf(err.Error())
+	ctx := map[string]any{"transform": "TEXT", "bsVersion": uint(7), "lang": "xx"}
+
+	if _, err := NewTextCodecWithCtx(&ctx); err == nil {
+		b.Errorf("No error with an invalid language")
 	}
 }
 
-func TestROLZ(b *testing.T) {
-	if err := testTransformCorrectness("ROLZ"); err != nil {
+func TestRank(b *testing.T) {
+	if err := testTransformCorrectness("RANK"); err != nil {
 		b.Errorf(err.Error())
 	}
 }
-
-func TestROLZX(b *testing.T) {
-	if err := testTransformCorrectness("ROLZX"); err != nil {
+func TestMTFT(b *testing.T) {
+	if err := testTransformCorrectness("MTFT"); err != nil {
 		b.Errorf(err.Error())
 	}
 }
 
-func TestCopy(b *testing.T) {
-	if err := testTransformCorrectness("NONE"); err != nil {
-		b.Errorf(err.Error())
+func TestEXESections(b *testing.T) {
+	fmt.Println("=== Testing EXE sections ===")
+
+	// ELF64 x86-64 image: .text (AX) followed by .rodata (A) holding call-like patterns
+	src := make([]byte, 0x9000)
+	copy(src, []byte{0x7F, 'E', 'L', 'F', 2, 1, 1})
+	binary.LittleEndian.PutUint16(src[0x12:], _EXE_ELF_AMD64_ARCH)
+	binary.LittleEndian.PutUint64(src[0x28:], 0x8000) // section headers
+	binary.LittleEndian.PutUint16(src[0x3A:], 0x40)
+	binary.LittleEndian.PutUint16(src[0x3C:], 3)
+
+	sections := []struct{ flags, off, size uint64 }{
+		{0, 0, 0},              // null section
+		{0x06, 0x1000, 0x4000}, // .text
+		{0x02, 0x5000, 0x2000}, // .rodata
 	}
-}
 
-func TestAlias(b *testing.T) {
-	if err := testTransformCorrectness("ALIAS"); err != nil {
-		b.Errorf(err.Error())
+	for i, s := range sections {
+		entry := src[0x8000+0x40*i:]
+
+		if s.size != 0 {
+			binary.LittleEndian.PutUint32(entry[4:], _EXE_ELF_SHT_PROGBITS)
+		}
+
+		binary.LittleEndian.PutUint64(entry[8:], s.flags)
+		binary.LittleEndian.PutUint64(entry[0x18:], s.off)
+		binary.LittleEndian.PutUint64(entry[0x20:], s.size)
 	}
-}
 
-func TestZRLT(b *testing.T) {
-	if err := testTransformCorrectness("ZRLT"); err != nil {
-		b.Errorf(err.Error())
+	for i := 0x1000; i < 0x7000; i += 16 {
+		src[i] = 0xE8
+		binary.LittleEndian.PutUint32(src[i+1:], uint32(rand.Intn(0x10000)))
+		src[i+5] = 0xFF
 	}
-}
 
-func TestRLT(b *testing.T) {
-	if err := testTransformCorrectness("RLT"); err != nil {
-		b.Errorf(err.Error())
+	codeStart, codeEnd := 0, len(src)-8
+
+	if mode := detectExeType(src[:codeEnd+4], &codeStart, &codeEnd); mode != _EXE_X86 {
+		b.Errorf("Wrong mode: %d", mode)
 	}
-}
 
-func TestSRT(b *testing.T) {
-	if err := testTransformCorrectness("SRT"); err != nil {
-		b.Errorf(err.Error())
+	if codeStart != 0x1000 || codeEnd != 0x5000 {
+		b.Errorf("Wrong code range: [%x, %x] instead of [1000, 5000]", codeStart, codeEnd)
+	}
+
+	f, _ := NewEXECodec()
+	output := make([]byte, f.MaxEncodedLen(len(src)))
+	reverse := make([]byte, len(src))
+	_, dstIdx, err := f.Forward(src, output)
+
+	if err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	f, _ = NewEXECodec()
+	_, m, err := f.Inverse(output[0:dstIdx], reverse)
+
+	if err != nil {
+		b.Fatalf("Inverse failed: %v", err)
+	}
+
+	if bytes.Equal(src, reverse[0:m]) == false {
+		b.Errorf("Input and inverse are different")
 	}
 }
 
-func TestMM(b *testing.T) {
-	if err := testTransformCorrectness("MM"); err != nil {
-		b.Errorf(err.Error())
+// legacyLZPForward encodes src with the LZP format of bitstream versions
+// up to 3 (minimum match length of 96), as older releases did
+func legacyLZPForward(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/64)
+	hashes := make([]int32, 1<<_LZP_HASH_LOG)
+	dst = append(dst, src[0:4]...)
+	ctx := binary.LittleEndian.Uint32(src)
+	srcIdx := 4
+
+	for srcIdx < len(src) {
+		h := (_LZP_HASH_SEED * ctx) >> _LZP_HASH_SHIFT
+		ref := int(hashes[h])
+		hashes[h] = int32(srcIdx)
+		bestLen := 0
+
+		if ref != 0 && srcIdx < len(src)-_LZP_MIN_MATCH96 {
+			for srcIdx+bestLen < len(src) && src[ref+bestLen] == src[srcIdx+bestLen] {
+				bestLen++
+			}
+		}
+
+		if bestLen < _LZP_MIN_MATCH96 {
+			dst = append(dst, src[srcIdx])
+
+			if ref != 0 && src[srcIdx] == _LZP_MATCH_FLAG {
+				dst = append(dst, 0xFF)
+			}
+
+			ctx = (ctx << 8) | uint32(src[srcIdx])
+			srcIdx++
+			continue
+		}
+
+		srcIdx += bestLen
+		ctx = binary.LittleEndian.Uint32(src[srcIdx-4:])
+		dst = append(dst, _LZP_MATCH_FLAG)
+
+		for bestLen -= _LZP_MIN_MATCH96; bestLen >= 254; bestLen -= 254 {
+			dst = append(dst, 0xFE)
+		}
+
+		dst = append(dst, byte(bestLen))
 	}
+
+	return dst
 }
 
-func TestRank(b *testing.T) {
-	if err := testTransformCorrectness("RANK"); err != nil {
-		b.Errorf(err.Error())
+func TestLZPV3Substitution(b *testing.T) {
+	fmt.Println("=== Testing LZP bitstream version 3 substitution ===")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 500)
+	runs := bytes.Repeat([]byte{_LZP_MATCH_FLAG, 'a', _LZP_MATCH_FLAG, 'b'}, 3000)
+	random := make([]byte, 50000)
+
+	for i := range random {
+		random[i] = byte(rand.Intn(8) + _LZP_MATCH_FLAG - 4)
+	}
+
+	lzpType, _ := GetType("LZP")
+
+	for _, data := range [][]byte{text, runs, random, append(bytes.Clone(random), text...)} {
+		encoded := legacyLZPForward(data)
+		scratch := &internal.BlockScratch{}
+		ctx := map[string]any{"bsVersion": uint(3), "substitutions": true, internal.SCRATCH_KEY: scratch}
+		seq, err := New(&ctx, lzpType)
+
+		if err != nil {
+			b.Fatalf("Cannot create transform: %v", err)
+		}
+
+		if used := scratch.Substituted; len(used) != 1 || used[0] != "LZP-V3" {
+			b.Fatalf("Substitution not used: %v", used)
+		}
+
+		res := make([]byte, len(data))
+
+		if _, n, err := seq.Inverse(encoded, res); err != nil || bytes.Equal(res[0:n], data) == false {
+			b.Fatalf("Incorrect decoded data (%d => %d bytes): %v", len(data), len(encoded), err)
+		}
+
+		// Same result as the legacy path of LZPCodec
+		ctx = map[string]any{"bsVersion": uint(3)}
+		codec, _ := NewLZPCodecWithCtx(&ctx)
+		ref := make([]byte, len(data))
+
+		if _, n, err := codec.Inverse(encoded, ref); err != nil || bytes.Equal(ref[0:n], data) == false {
+			b.Errorf("LZPCodec cannot decode the legacy data: %v", err)
+		}
+
+		fmt.Printf("%d => %d bytes\n", len(data), len(encoded))
+	}
+
+	// Current streams are not substituted
+	scratch := &internal.BlockScratch{}
+	ctx := map[string]any{"bsVersion": uint(6), "substitutions": true, internal.SCRATCH_KEY: scratch}
+	New(&ctx, lzpType)
+
+	if len(scratch.Substituted) != 0 {
+		b.Errorf("Unexpected substitution for bitstream version 6")
+	}
+
+	codec, _ := newLZPV3Codec(&ctx)
+
+	if _, _, err := codec.Forward(text, make([]byte, len(text))); err == nil {
+		b.Errorf("Expected error on legacy forward transform")
 	}
 }
-func TestMTFT(b *testing.T) {
-	if err := testTransformCorrectness("MTFT"); err != nil {
-		b.Errorf(err.Error())
+
+func TestSequenceBuilder(b *testing.T) {
+	fmt.Println("=== Testing SequenceBuilder ===")
+
+	text := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs. "), 2000)
+	builder := NewSequenceBuilder().Add("TEXT", TextOptions{Variant: 1}).Add("ROLZX", ROLZOptions{LogPosChecks: 7})
+	name, err := builder.Name()
+
+	if err != nil || name != "TEXT+ROLZX" {
+		b.Fatalf("Invalid sequence name: %s (%v)", name, err)
+	}
+
+	if params := builder.Params(); params != 0x0107000000000000 {
+		b.Fatalf("Invalid stage parameters: %x", params)
+	}
+
+	// The entropy codec selects the other TEXT variant by default
+	ctx := map[string]any{"entropy": "HUFFMAN", "transform": "TEXT+ROLZ"}
+	seq, err := builder.Build(&ctx)
+
+	if err != nil {
+		b.Fatalf("Cannot build sequence: %v", err)
+	}
+
+	encoded := make([]byte, seq.MaxEncodedLen(len(text)))
+	_, dstIdx, err := seq.Forward(text, encoded)
+
+	if err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	fmt.Printf("%d => %d bytes\n", len(text), dstIdx)
+	tType, _ := builder.Type()
+	res := make([]byte, len(text))
+
+	// Decoding with the parameters
+	ctx = map[string]any{"entropy": "HUFFMAN", "transform": "TEXT+ROLZ", "rolzLogPosChecks": uint(3)}
+	inv, _ := NewWithParams(&ctx, tType, builder.Params())
+	inv.SetSkipFlags(seq.SkipFlags())
+
+	if _, n, err := inv.Inverse(encoded[0:dstIdx], res); err != nil || bytes.Equal(res[0:n], text) == false {
+		b.Fatalf("Incorrect decoded data: %v", err)
+	}
+
+	// Without the parameters, the defaults do not match
+	ctx = map[string]any{"entropy": "HUFFMAN"}
+	inv, _ = New(&ctx, tType)
+	inv.SetSkipFlags(seq.SkipFlags())
+
+	if _, n, err := inv.Inverse(encoded[0:dstIdx], res); err == nil && bytes.Equal(res[0:n], text) == true {
+		b.Errorf("Unexpected decoding with the default parameters")
+	}
+
+	// Forward only options
+	ctx = map[string]any{}
+	lz := NewSequenceBuilder().Add("LZ", LZOptions{MinMatch: 9, SmallWindow: true})
+	seq, _ = lz.Build(&ctx)
+	_, dstIdx, err = seq.Forward(text, encoded)
+
+	if err != nil || encoded[12] != 2 {
+		b.Fatalf("LZ options not applied: flags %d (%v)", encoded[12], err)
+	}
+
+	if lz.Params() != 0 {
+		b.Errorf("Unexpected LZ parameters: %x", lz.Params())
+	}
+
+	// Invalid sequences
+	invalid := []*SequenceBuilder{
+		NewSequenceBuilder().Add("FOO", nil),
+		NewSequenceBuilder().Add("LZ+BWT", nil),
+		NewSequenceBuilder().Add("BWT", TextOptions{Variant: 1}),
+		NewSequenceBuilder().Add("TEXT", TextOptions{Variant: 3}),
+		NewSequenceBuilder().Add("ROLZ", ROLZOptions{LogPosChecks: 9}),
+		NewSequenceBuilder().Add("RLT", RLTOptions{Stride: 3}),
+		NewSequenceBuilder().Add("ROLZ", ROLZOptions{LogPosChecks: 4}).Add("ROLZX", ROLZOptions{LogPosChecks: 6}),
+		NewSequenceBuilder().Add("RLT", nil).Add("RLT", nil).Add("RLT", nil).Add("RLT", nil).
+			Add("RLT", nil).Add("RLT", nil).Add("RLT", nil).Add("RLT", nil).Add("RLT", nil),
+	}
+
+	for i, sb := range invalid {
+		if _, err := sb.Type(); err == nil {
+			b.Errorf("Invalid sequence %d: no error", i)
+		} else {
+			fmt.Printf("OK - expected error: %v\n", err)
+		}
 	}
 }
 
@@ -349,3 +1710,245 @@ func testTransformCorrectness(name string) error {
 	fmt.Println()
 	return error(nil)
 }
+
+func TestTransformCorpus(b *testing.T) {
+	fmt.Println("=== Testing transforms on the adversarial corpus ===")
+	sizes := testutil.NearThresholdSizes(_RLT_MIN_BLOCK_LENGTH, _LZX_MIN_BLOCK_LENGTH, _ROLZ_MIN_BLOCK_SIZE,
+		_LZP_MIN_BLOCK_LENGTH, _NUM_MIN_BLOCK_LENGTH, _TC_MIN_BLOCK_SIZE, _EXE_MIN_BLOCK_SIZE)
+	sizes = append(sizes, 100000)
+	corpus := testutil.Corpus(12345, sizes, 1, _TC_MAX_WORD_LENGTH-1, _TC_MAX_WORD_LENGTH, _TC_MAX_WORD_LENGTH+1, 300)
+	names := []string{"TEXT", "BWT", "BWTS", "ROLZ", "ROLZX", "LZ", "LZX", "LZP", "UTF", "MM", "SRT", "RANK",
+		"MTFT", "ZRLT", "RLT", "EXE", "PACK", "DNA", "LRM", "JSON", "GENOMIC", "IMG", "UTF16", "NUMERIC",
+		"ST4", "ST6", "SPARSE"}
+
+	for _, name := range names {
+		failures := 0
+
+		for _, input := range corpus {
+			ctx := map[string]any{"transform": name, "bsVersion": uint(6), "blockSize": uint(max(len(input.Data), 1))}
+			t, err := New(&ctx, mustGetType(b, name))
+
+			if err != nil {
+				b.Fatalf("%s: cannot create transform: %v", name, err)
+			}
+
+			if err = testutil.RoundTripCheck(t, input.Data); err != nil {
+				b.Errorf("%s, %s: %v", name, input.Name, err)
+
+				if failures++; failures == 5 {
+					break
+				}
+			}
+		}
+	}
+}
+
+func mustGetType(b *testing.T, name string) uint64 {
+	t, err := GetType(name)
+
+	if err != nil {
+		b.Fatalf("Unknown transform %s: %v", name, err)
+	}
+
+	return t
+}
+
+func TestLZLevels(b *testing.T) {
+	fmt.Println("=== Testing the LZ levels ===")
+	corpus := testutil.Corpus(12345, testutil.NearThresholdSizes(_LZX_MIN_BLOCK_LENGTH), 1, 5, 300)
+	r := rand.New(rand.NewSource(12345))
+	words := make([]string, 1000)
+
+	for i := range words {
+		words[i] = string(testutil.Random(r, 2+r.Intn(10), 26))
+	}
+
+	// Text with a skewed word distribution
+	var sb strings.Builder
+
+	for sb.Len() < 200000 {
+		sb.WriteString(words[r.Intn(r.Intn(len(words))+1)])
+		sb.WriteByte(" .,\n"[r.Intn(4)])
+	}
+
+	text := []byte(sb.String())
+	corpus = append(corpus, testutil.Input{Name: "text", Data: text})
+
+	for _, name := range []string{"LZ", "LZX"} {
+		prev := 0
+
+		for level := uint(1); level <= _LZX_LEVEL_MAX; level++ {
+			for _, input := range corpus {
+				ctx := map[string]any{"transform": name, "bsVersion": uint(6), "lzLevel": level}
+				t, _ := New(&ctx, mustGetType(b, name))
+
+				if err := testutil.RoundTripCheck(t, input.Data); err != nil {
+					b.Fatalf("%s, level %d, %s: %v", name, level, input.Name, err)
+				}
+			}
+
+			// The match finder is recorded in the block flags
+			ctx := map[string]any{"transform": name, "bsVersion": uint(6), "lzLevel": level}
+			t, _ := New(&ctx, mustGetType(b, name))
+			output := make([]byte, t.MaxEncodedLen(len(text)))
+			_, dstIdx, err := t.Forward(text, output)
+
+			if err != nil {
+				b.Fatalf("%s, level %d: forward failed: %v", name, level, err)
+			}
+
+			if finder := int(output[12] >> _LZX_FINDER_SHIFT); finder != _LZX_LEVELS[level].finder {
+				b.Errorf("%s, level %d: invalid match finder in the flags: %d", name, level, finder)
+			}
+
+			fmt.Printf("%s, level %d: %d => %d bytes\n", name, level, len(text), dstIdx)
+
+			if level > 1 && int(dstIdx) > prev {
+				b.Errorf("%s, level %d: larger output than level %d (%d > %d bytes)", name, level, level-1, dstIdx, prev)
+			}
+
+			prev = int(dstIdx)
+		}
+	}
+
+	// Priming data and small window
+	priming := text[0:1000]
+
+	for level := uint(1); level <= _LZX_LEVEL_MAX; level++ {
+		ctx := map[string]any{"bsVersion": uint(6), "lzLevel": level, "lzSmallWindow": true,
+			internal.SCRATCH_KEY: &internal.BlockScratch{Priming: priming}}
+		t, _ := New(&ctx, mustGetType(b, "LZX"))
+		output := make([]byte, t.MaxEncodedLen(len(text)))
+		_, dstIdx, err := t.Forward(text, output)
+
+		if err != nil {
+			b.Fatalf("Level %d with priming: forward failed: %v", level, err)
+		}
+
+		inv, _ := New(&ctx, mustGetType(b, "LZX"))
+		res := make([]byte, len(text))
+
+		if _, n, err := inv.Inverse(output[0:dstIdx], res); err != nil || bytes.Equal(res[0:n], text) == false {
+			b.Fatalf("Level %d with priming: round trip failed: %v", level, err)
+		}
+	}
+
+	if err := (LZOptions{Level: _LZX_LEVEL_MAX + 1}).validate(); err == nil {
+		b.Errorf("Expected an error for an invalid LZ level")
+	}
+}
+
+func TestBlockScratch(b *testing.T) {
+	fmt.Println("=== Testing the block scratch ===")
+	r := rand.New(rand.NewSource(12345))
+	dna := testutil.Random(r, 100000, 4)
+
+	for i := range dna {
+		dna[i] = "ACGT"[dna[i]]
+	}
+
+	// The state of the block goes to the scratch: the context is not modified
+	scratch := &internal.BlockScratch{}
+	ctx := map[string]any{"entropy": "TPAQ", "bsVersion": uint(6), internal.SCRATCH_KEY: scratch}
+	tType := mustGetType(b, "RLT+DNA+PACK+TEXT+LZ+ROLZX+RANK+ST4")
+	params := NewSequenceBuilder().Add("TEXT", TextOptions{Variant: 2}).Add("ROLZX", ROLZOptions{LogPosChecks: 3}).Params()
+	seq, err := NewWithParams(&ctx, tType, params)
+
+	if err != nil {
+		b.Fatalf("Cannot create sequence: %v", err)
+	}
+
+	scratch.Reset(uint(len(dna)))
+	output := make([]byte, seq.MaxEncodedLen(len(dna)))
+
+	if _, _, err = seq.Forward(dna, output); err != nil {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	if len(ctx) != 3 {
+		b.Errorf("Context modified: %v", ctx)
+	}
+
+	if scratch.DataType != internal.DT_DNA || internal.GetDataType(&ctx) != internal.DT_DNA {
+		b.Errorf("Incorrect data type in the scratch: %v", scratch.DataType)
+	}
+
+	// The histogram is reused until the data is transformed
+	var freqs [256]int
+	scratch.Reset(uint(len(dna)))
+	scratch.Histogram(dna, freqs[:])
+	scratch.Histo['A'] = -1
+	freqs = [256]int{}
+	internal.Histogram(&ctx, dna, freqs[:])
+
+	if freqs['A'] != -1 {
+		b.Errorf("Histogram of the scratch not reused")
+	}
+
+	ctx = map[string]any{"entropy": "TPAQ", internal.SCRATCH_KEY: scratch}
+	seq, _ = New(&ctx, mustGetType(b, "PACK"))
+
+	if _, _, err = seq.Forward(dna, output); err != nil || seq.SkipFlags() == 0xFF {
+		b.Fatalf("Forward failed: %v", err)
+	}
+
+	freqs = [256]int{}
+	internal.Histogram(&ctx, dna, freqs[:])
+
+	if freqs['A'] <= 0 {
+		b.Errorf("Histogram of transformed data reused")
+	}
+
+	// Contexts without scratch are not modified
+	ctx = map[string]any{"size": uint(len(dna))}
+	SetDataType(&ctx, internal.DT_DNA)
+	internal.AddSubstitution(&ctx, "LZP-V3")
+
+	if len(ctx) != 1 || DataType(&ctx) != internal.DT_UNDEFINED {
+		b.Errorf("Unexpected entries in the context: %v", ctx)
+	}
+
+	if size, known := internal.GetDataSize(&ctx); known == true {
+		b.Errorf("Unexpected size in the context: %d", size)
+	}
+}
+
+func TestForwardKeepInput(b *testing.T) {
+	fmt.Println("=== Testing ForwardKeepInput ===")
+	input := make([]byte, 0, 65536)
+
+	for i := 0; len(input) < 60000; i++ {
+		input = append(input, bytes.Repeat([]byte{byte('a' + i%7)}, 5+i%11)...)
+	}
+
+	tType, _ := GetType("BWT+MTFT+ZRLT")
+	ctx := map[string]any{"bsVersion": uint(7)}
+	seq, _ := New(&ctx, tType)
+	src := make([]byte, len(input))
+	copy(src, input)
+	dst1 := make([]byte, seq.MaxEncodedLen(len(src)))
+	dst2 := make([]byte, len(dst1))
+	work := make([]byte, len(dst1))
+
+	// Same output as Forward, the input is not written to
+	_, n2, err := seq.ForwardKeepInput(src, dst2, work)
+
+	if err != nil {
+		b.Fatalf("ForwardKeepInput failed: %v", err)
+	}
+
+	if bytes.Equal(src, input) == false {
+		b.Errorf("The input was modified")
+	}
+
+	flags := seq.SkipFlags()
+	_, n1, _ := seq.Forward(src, dst1)
+
+	if n1 != n2 || flags != seq.SkipFlags() || bytes.Equal(dst1[0:n1], dst2[0:n2]) == false {
+		b.Errorf("Different output: %d bytes, expected %d", n2, n1)
+	}
+
+	if flags&0xE0 != 0 {
+		b.Errorf("Expected all transforms to apply, skip flags: %08b", flags)
+	}
+}
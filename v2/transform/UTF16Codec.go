@@ -0,0 +1,243 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+
+	internal "github.com/flanglet/kanzi-go/v2/internal"
+)
+
+const (
+	_UTF16_HEADER_SIZE    = 2 // mode, escape symbol
+	_UTF16_MIN_BLOCK_SIZE = 64
+	_UTF16_MODE_HIGH_LAST = 0x01 // UTF-16LE: the high half of each code unit comes last
+	_UTF16_MODE_ODD       = 0x02 // odd block size: the last byte is copied as is
+)
+
+// UTF16Codec a transform for UTF-16 text (EG. Windows logs and SQL dumps).
+// The high half of the code units of Latin text is mostly 0: the code units
+// in [0..255] are replaced with their low half and the other ones (plus
+// the code units equal to the escape symbol) are emitted as escape, high
+// half, low half. The escape symbol is the least frequent low half.
+// The endianness is given by the Byte Order Mark or guessed from the
+// positions of the zero bytes. The output is 8 bit text that can be fed
+// to TextCodec (EG. "UTF16+TEXT+BWT").
+// Format: mode, escape symbol, code units, last byte if the size is odd.
+type UTF16Codec struct {
+	ctx *map[string]any
+}
+
+// NewUTF16Codec creates a new instance of UTF16Codec
+func NewUTF16Codec() (*UTF16Codec, error) {
+	this := &UTF16Codec{}
+	return this, nil
+}
+
+// NewUTF16CodecWithCtx creates a new instance of UTF16Codec using a
+// configuration map as parameter.
+func NewUTF16CodecWithCtx(ctx *map[string]any) (*UTF16Codec, error) {
+	this := &UTF16Codec{}
+	this.ctx = ctx
+	return this, nil
+}
+
+// Forward applies the function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *UTF16Codec) Forward(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+
+	if n := this.MaxEncodedLen(count); len(dst) < n {
+		return 0, 0, fmt.Errorf("UTF16 forward transform skip: output buffer is too small - size: %d, required %d", len(dst), n)
+	}
+
+	if count < _UTF16_MIN_BLOCK_SIZE {
+		return 0, 0, errors.New("UTF16 forward transform skip: block too small")
+	}
+
+	if dt := internal.GetDataType(this.ctx); dt != internal.DT_UNDEFINED && dt != internal.DT_UTF16 && dt != internal.DT_BIN {
+		return 0, 0, errors.New("UTF16 forward transform skip: input is not UTF-16")
+	}
+
+	// Index of the high half in the code units
+	hi := 1
+
+	if src[0] == 0xFE && src[1] == 0xFF {
+		hi = 0
+	} else if src[0] != 0xFF || src[1] != 0xFE {
+		zeros := [2]int{}
+
+		for i := range src {
+			if src[i] == 0 {
+				zeros[i&1]++
+			}
+		}
+
+		if zeros[0] > zeros[1] {
+			hi = 0
+		}
+	}
+
+	end := count & -2
+	freqs := [256]int{}
+	wide := 0
+
+	for i := 0; i < end; i += 2 {
+		if src[i+hi] == 0 {
+			freqs[src[i+1-hi]]++
+		} else {
+			wide++
+		}
+	}
+
+	esc := 0
+
+	for i := 1; i < 256; i++ {
+		if freqs[i] < freqs[esc] {
+			esc = i
+		}
+	}
+
+	escaped := wide + freqs[esc]
+	dstEnd := _UTF16_HEADER_SIZE + (end >> 1) + 2*escaped + (count - end)
+
+	if dstEnd >= count-count/8 {
+		return 0, 0, errors.New("UTF16 forward transform skip: no improvement")
+	}
+
+	mode := byte(0)
+
+	if hi == 1 {
+		mode |= _UTF16_MODE_HIGH_LAST
+	}
+
+	if end < count {
+		mode |= _UTF16_MODE_ODD
+	}
+
+	dst[0] = mode
+	dst[1] = byte(esc)
+	dstIdx := _UTF16_HEADER_SIZE
+
+	for i := 0; i < end; i += 2 {
+		lo := src[i+1-hi]
+
+		if src[i+hi] == 0 && lo != byte(esc) {
+			dst[dstIdx] = lo
+			dstIdx++
+			continue
+		}
+
+		dst[dstIdx] = byte(esc)
+		dst[dstIdx+1] = src[i+hi]
+		dst[dstIdx+2] = lo
+		dstIdx += 3
+	}
+
+	if end < count {
+		dst[dstIdx] = src[end]
+		dstIdx++
+	}
+
+	// Let the next transforms analyze the 8 bit text
+	internal.SetDataType(this.ctx, internal.DT_UNDEFINED)
+
+	return uint(count), uint(dstIdx), nil
+}
+
+// Inverse applies the reverse function to the src and writes the result
+// to the destination. Returns number of bytes read, number of bytes
+// written and possibly an error.
+func (this *UTF16Codec) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) == 0 {
+		return 0, 0, nil
+	}
+
+	if &src[0] == &dst[0] {
+		return 0, 0, errors.New("Input and output buffers cannot be equal")
+	}
+
+	count := len(src)
+	errInvalid := errors.New("UTF16 inverse transform failed: invalid data")
+	errOverflow := errors.New("UTF16 inverse transform failed: output buffer too small")
+
+	if count < _UTF16_HEADER_SIZE || src[0]&^(_UTF16_MODE_HIGH_LAST|_UTF16_MODE_ODD) != 0 {
+		return 0, 0, errInvalid
+	}
+
+	hi := int(src[0] & _UTF16_MODE_HIGH_LAST)
+	esc := src[1]
+	end := count
+
+	if src[0]&_UTF16_MODE_ODD != 0 {
+		end--
+
+		if end < _UTF16_HEADER_SIZE {
+			return 0, 0, errInvalid
+		}
+	}
+
+	srcIdx := _UTF16_HEADER_SIZE
+	dstIdx := 0
+
+	for srcIdx < end {
+		if dstIdx+2 > len(dst) {
+			return 0, 0, errOverflow
+		}
+
+		if src[srcIdx] != esc {
+			dst[dstIdx+hi] = 0
+			dst[dstIdx+1-hi] = src[srcIdx]
+			srcIdx++
+		} else {
+			if srcIdx+3 > end {
+				return 0, 0, errInvalid
+			}
+
+			dst[dstIdx+hi] = src[srcIdx+1]
+			dst[dstIdx+1-hi] = src[srcIdx+2]
+			srcIdx += 3
+		}
+
+		dstIdx += 2
+	}
+
+	if end < count {
+		if dstIdx >= len(dst) {
+			return 0, 0, errOverflow
+		}
+
+		dst[dstIdx] = src[end]
+		dstIdx++
+	}
+
+	return uint(count), uint(dstIdx), nil
+}
+
+// MaxEncodedLen returns the max size required for the encoding output buffer
+func (this UTF16Codec) MaxEncodedLen(srcLen int) int {
+	return srcLen + _UTF16_HEADER_SIZE
+}